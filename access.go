@@ -0,0 +1,97 @@
+package indiclient
+
+import (
+	"errors"
+	"path"
+)
+
+// ErrForbidden is returned when the access policy does not allow a property to be written. See SetAccessPolicy.
+var ErrForbidden = errors.New("forbidden by access policy")
+
+// AccessRule matches properties by device and property name. Both are patterns as in path.Match, so "*" matches
+// anything and "CCD_*" any property starting with CCD_. An empty pattern matches anything. Device is matched against
+// both the device name and its alias.
+type AccessRule struct {
+	Device   string `json:"device"`
+	Property string `json:"property"`
+}
+
+// AccessPolicy restricts which properties may be written.
+type AccessPolicy struct {
+	// Allow, if not empty, lists the only properties that may be written.
+	Allow []AccessRule `json:"allow,omitempty"`
+	// Deny lists properties that may not be written, even if Allow matches them.
+	Deny []AccessRule `json:"deny,omitempty"`
+}
+
+// Allows returns true if the policy allows propName to be written on the device with any of deviceNames.
+func (p AccessPolicy) Allows(propName string, deviceNames ...string) bool {
+	for _, r := range p.Deny {
+		if r.matches(propName, deviceNames) {
+			return false
+		}
+	}
+
+	if len(p.Allow) == 0 {
+		return true
+	}
+
+	for _, r := range p.Allow {
+		if r.matches(propName, deviceNames) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r AccessRule) matches(propName string, deviceNames []string) bool {
+	if !matchPattern(r.Property, propName) {
+		return false
+	}
+
+	for _, name := range deviceNames {
+		if matchPattern(r.Device, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchPattern(pattern, name string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// SetAccessPolicy restricts which properties the Set*Value methods, and everything built on them, may write. They
+// return ErrForbidden for the rest. Commands from downstream clients of a Repeater are checked too, and dropped if
+// they are not allowed. The zero AccessPolicy, the default, allows everything.
+func (c *INDIClient) SetAccessPolicy(p AccessPolicy) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.accessPolicy = p
+}
+
+// AccessPolicy returns the policy set with SetAccessPolicy.
+func (c *INDIClient) AccessPolicy() AccessPolicy {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.accessPolicy
+}
+
+// checkAccess returns ErrForbidden if the access policy does not allow propName to be written on deviceName. Only
+// call when INDIClient.rwm is at least reader locked.
+func (c *INDIClient) checkAccess(deviceName, propName string) error {
+	if !c.accessPolicy.Allows(propName, deviceName, c.aliasDevice(deviceName)) {
+		return ErrForbidden
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package indiclient
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AccessPolicy_Allows(t *testing.T) {
+	assert.True(t, AccessPolicy{}.Allows("CONNECTION", "Mount"))
+
+	p := AccessPolicy{
+		Allow: []AccessRule{{Device: "CCD *"}, {Device: "Mount", Property: "EQUATORIAL_*"}},
+		Deny:  []AccessRule{{Property: "CONNECTION"}},
+	}
+
+	assert.True(t, p.Allows("CCD_EXPOSURE", "CCD Simulator"))
+	assert.False(t, p.Allows("CONNECTION", "CCD Simulator"))
+	assert.True(t, p.Allows("EQUATORIAL_EOD_COORD", "Mount"))
+	assert.False(t, p.Allows("TELESCOPE_PARK", "Mount"))
+	assert.False(t, p.Allows("ABS_FOCUS_POSITION", "Focuser"))
+	assert.True(t, p.Allows("CCD_EXPOSURE", "Main Camera", "CCD Simulator"))
+}
+
+func Test_SetAccessPolicy(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+	require.NoError(t, c.SetDeviceAlias("scope", "Mount"))
+
+	c.SetAccessPolicy(AccessPolicy{Deny: []AccessRule{{Device: "scope", Property: "EQUATORIAL_EOD_COORD"}}})
+
+	_, err := c.DryRunNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"})
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	assert.True(t, errors.Is(c.SetNumberValue("scope", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"}), ErrForbidden))
+
+	c.SetAccessPolicy(AccessPolicy{})
+
+	_, err = c.DryRunNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,94 @@
+package indiclient
+
+import "errors"
+
+var (
+	// ErrAliasConflict is returned when an alias is already in use by another device, or is the name of a device.
+	ErrAliasConflict = errors.New("alias conflicts with another device")
+
+	// ErrInvalidAlias is returned when an alias or the device name it stands for is empty.
+	ErrInvalidAlias = errors.New("invalid alias")
+)
+
+// SetDeviceAlias registers alias as another name for deviceName, e.g. "main-camera" for "ZWO CCD ASI1600MM Pro".
+// Once set, the alias is accepted wherever the client takes a device name, and is used instead of the driver's name in
+// Devices, snapshots, events and BLOB events. Commands sent to indiserver always use the driver's name. A device has at
+// most one alias; setting another replaces it.
+func (c *INDIClient) SetDeviceAlias(alias, deviceName string) error {
+	if len(alias) == 0 || len(deviceName) == 0 {
+		return ErrInvalidAlias
+	}
+
+	c.aliasMu.Lock()
+	defer c.aliasMu.Unlock()
+
+	if real, ok := c.aliases[alias]; ok && real != deviceName {
+		return ErrAliasConflict
+	}
+
+	if _, ok := c.aliasOf[alias]; ok && alias != deviceName {
+		return ErrAliasConflict
+	}
+
+	if old, ok := c.aliasOf[deviceName]; ok {
+		delete(c.aliases, old)
+	}
+
+	c.aliases[alias] = deviceName
+	c.aliasOf[deviceName] = alias
+
+	return nil
+}
+
+// RemoveDeviceAlias removes an alias set with SetDeviceAlias.
+func (c *INDIClient) RemoveDeviceAlias(alias string) error {
+	c.aliasMu.Lock()
+	defer c.aliasMu.Unlock()
+
+	real, ok := c.aliases[alias]
+	if !ok {
+		return ErrDeviceNotFound
+	}
+
+	delete(c.aliases, alias)
+	delete(c.aliasOf, real)
+
+	return nil
+}
+
+// DeviceAliases returns the registered aliases, mapped to the driver's device names.
+func (c *INDIClient) DeviceAliases() map[string]string {
+	c.aliasMu.RLock()
+	defer c.aliasMu.RUnlock()
+
+	aliases := make(map[string]string, len(c.aliases))
+	for k, v := range c.aliases {
+		aliases[k] = v
+	}
+
+	return aliases
+}
+
+// resolveDevice returns the driver's name for name, which may be an alias.
+func (c *INDIClient) resolveDevice(name string) string {
+	c.aliasMu.RLock()
+	defer c.aliasMu.RUnlock()
+
+	if real, ok := c.aliases[name]; ok {
+		return real
+	}
+
+	return name
+}
+
+// aliasDevice returns the name to show users for the device the driver calls name.
+func (c *INDIClient) aliasDevice(name string) string {
+	c.aliasMu.RLock()
+	defer c.aliasMu.RUnlock()
+
+	if alias, ok := c.aliasOf[name]; ok {
+		return alias
+	}
+
+	return name
+}
@@ -0,0 +1,34 @@
+package indiclient
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SetDeviceAlias(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	c := NewINDIClient(log, nil, afero.NewMemMapFs(), 10)
+
+	assert.Equal(t, ErrInvalidAlias, c.SetDeviceAlias("", "CCD"))
+
+	require.NoError(t, c.SetDeviceAlias("main-camera", "ZWO CCD ASI1600MM Pro"))
+	assert.Equal(t, ErrAliasConflict, c.SetDeviceAlias("main-camera", "Guide Camera"))
+	assert.Equal(t, ErrAliasConflict, c.SetDeviceAlias("ZWO CCD ASI1600MM Pro", "Guide Camera"))
+
+	// A new alias replaces the old one.
+	require.NoError(t, c.SetDeviceAlias("camera", "ZWO CCD ASI1600MM Pro"))
+	assert.Equal(t, map[string]string{"camera": "ZWO CCD ASI1600MM Pro"}, c.DeviceAliases())
+
+	assert.Equal(t, "ZWO CCD ASI1600MM Pro", c.resolveDevice("camera"))
+	assert.Equal(t, "camera", c.aliasDevice("ZWO CCD ASI1600MM Pro"))
+	assert.Equal(t, "Other", c.resolveDevice("Other"))
+
+	assert.Equal(t, ErrDeviceNotFound, c.RemoveDeviceAlias("main-camera"))
+	require.NoError(t, c.RemoveDeviceAlias("camera"))
+	assert.Empty(t, c.DeviceAliases())
+}
@@ -0,0 +1,430 @@
+// Package alpaca exposes devices managed by an INDIClient through the ASCOM Alpaca REST API, so ASCOM clients on
+// Windows, such as imaging and planetarium programs, can control INDI hardware through this process:
+//
+//	s := alpaca.NewServer(log, c, alpaca.Options{
+//		Telescopes: []string{"Telescope Simulator"},
+//		Cameras:    []string{"CCD Simulator"},
+//		Focusers:   []string{"Focuser Simulator"},
+//	})
+//	conn, err := net.ListenPacket("udp", alpaca.DefaultDiscoveryAddr)
+//	...
+//	go s.ServeDiscovery(conn, alpaca.DefaultPort)
+//	http.ListenAndServe(fmt.Sprintf(":%d", alpaca.DefaultPort), s)
+//
+// Devices are numbered from zero in the order they are listed in Options. The commonly used members of the camera,
+// telescope and focuser interfaces are mapped to the standard INDI properties; the rest return the Alpaca "not
+// implemented" error, which ASCOM clients handle. Slews, parking, focuser moves and exposures start and return
+// straight away, as Alpaca expects, and clients poll Slewing, IsMoving or ImageReady for them to finish.
+package alpaca
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rickbassham/logging"
+
+	"github.com/goastro/indiclient"
+)
+
+const (
+	// DefaultPort is the port Alpaca servers usually listen on.
+	DefaultPort = 11111
+	// DefaultDiscoveryAddr is the address Alpaca clients send discovery requests to.
+	DefaultDiscoveryAddr = ":32227"
+
+	// discoveryRequest is the datagram Alpaca clients broadcast to find servers.
+	discoveryRequest = "alpacadiscovery1"
+)
+
+// Alpaca error numbers, sent in ErrorNumber.
+const (
+	// ErrorNotImplemented is sent for members that are not mapped to INDI properties, or that the device lacks.
+	ErrorNotImplemented = 0x400
+	// ErrorInvalidValue is sent when a parameter is out of range.
+	ErrorInvalidValue = 0x401
+	// ErrorNotConnected is sent when the device is not connected.
+	ErrorNotConnected = 0x407
+	// ErrorInvalidWhileParked is sent when a parked telescope is asked to move.
+	ErrorInvalidWhileParked = 0x408
+	// ErrorInvalidOperation is sent when a member cannot be used in the device's current state.
+	ErrorInvalidOperation = 0x40B
+	// ErrorDriver is sent when the INDI device or server reports an error.
+	ErrorDriver = 0x500
+)
+
+// Error is an error sent to Alpaca clients with its error number.
+type Error struct {
+	Number  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("alpaca error 0x%X: %s", e.Number, e.Message)
+}
+
+var (
+	errNotImplemented = &Error{Number: ErrorNotImplemented, Message: "not implemented"}
+	errNotConnected   = &Error{Number: ErrorNotConnected, Message: "device is not connected"}
+)
+
+// Options describes the server and the devices it exposes.
+type Options struct {
+	// ServerName, Manufacturer and Location are sent in the server description.
+	ServerName   string
+	Manufacturer string
+	Location     string
+	// Telescopes, Cameras and Focusers are the INDI device names exposed as each type, numbered from zero.
+	Telescopes []string
+	Cameras    []string
+	Focusers   []string
+}
+
+// Server answers Alpaca requests for the devices in its Options. It is an http.Handler.
+type Server struct {
+	c    *indiclient.INDIClient
+	log  logging.Logger
+	opts Options
+
+	transaction uint32
+
+	mu      sync.Mutex
+	cameras map[int]*cameraState
+}
+
+// NewServer creates a Server for the devices in opts. Serve it with net/http.
+func NewServer(log logging.Logger, c *indiclient.INDIClient, opts Options) *Server {
+	if len(opts.ServerName) == 0 {
+		opts.ServerName = "indiclient Alpaca bridge"
+	}
+	if len(opts.Manufacturer) == 0 {
+		opts.Manufacturer = "goastro"
+	}
+
+	return &Server{
+		c:       c,
+		log:     log,
+		opts:    opts,
+		cameras: map[int]*cameraState{},
+	}
+}
+
+// request is an Alpaca request, with its parameters keyed by their lower case names, since Alpaca parameter names
+// are case insensitive.
+type request struct {
+	ctx    context.Context
+	put    bool
+	params map[string]string
+}
+
+// response is the JSON body of every Alpaca response. Value is only sent in answer to GET, and Type and Rank only
+// with image arrays.
+type response struct {
+	Value               *json.RawMessage `json:"Value,omitempty"`
+	Type                int              `json:"Type,omitempty"`
+	Rank                int              `json:"Rank,omitempty"`
+	ClientTransactionID uint32           `json:"ClientTransactionID"`
+	ServerTransactionID uint32           `json:"ServerTransactionID"`
+	ErrorNumber         int              `json:"ErrorNumber"`
+	ErrorMessage        string           `json:"ErrorMessage"`
+}
+
+// imageArray is returned by the camera's imagearray member, and sent with its element type and rank.
+type imageArray struct {
+	rank  int
+	value interface{}
+}
+
+// ServeHTTP answers an Alpaca API or management request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := request{ctx: r.Context(), put: r.Method == http.MethodPut, params: map[string]string{}}
+	for k, v := range r.Form {
+		if len(v) > 0 {
+			req.params[strings.ToLower(k)] = v[0]
+		}
+	}
+
+	parts := strings.Split(strings.Trim(strings.ToLower(r.URL.Path), "/"), "/")
+
+	var value interface{}
+	var err error
+
+	switch {
+	case len(parts) == 2 && parts[0] == "management" && parts[1] == "apiversions":
+		value = []int{1}
+	case len(parts) == 3 && parts[0] == "management" && parts[1] == "v1" && parts[2] == "description":
+		value = map[string]string{
+			"ServerName":          s.opts.ServerName,
+			"Manufacturer":        s.opts.Manufacturer,
+			"ManufacturerVersion": "1.0",
+			"Location":            s.opts.Location,
+		}
+	case len(parts) == 3 && parts[0] == "management" && parts[1] == "v1" && parts[2] == "configureddevices":
+		value = s.configuredDevices()
+	case len(parts) == 5 && parts[0] == "api" && parts[1] == "v1":
+		number, perr := strconv.Atoi(parts[3])
+		name, ok := s.device(parts[2], number)
+		if perr != nil || !ok {
+			http.Error(w, "unknown device", http.StatusBadRequest)
+			return
+		}
+
+		value, err = s.handle(parts[2], number, name, parts[4], req)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	var badRequest *paramError
+	if errors.As(err, &badRequest) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.respond(w, req, value, err)
+}
+
+// respond writes the JSON response for value or err.
+func (s *Server) respond(w http.ResponseWriter, req request, value interface{}, err error) {
+	resp := response{ServerTransactionID: atomic.AddUint32(&s.transaction, 1)}
+
+	if id, perr := strconv.ParseUint(req.params["clienttransactionid"], 10, 32); perr == nil {
+		resp.ClientTransactionID = uint32(id)
+	}
+
+	if img, ok := value.(imageArray); ok {
+		// Alpaca image arrays are always of Int32 elements here.
+		resp.Type, resp.Rank, value = 2, img.rank, img.value
+	}
+
+	if err != nil {
+		alpacaErr := &Error{}
+		if !errors.As(err, &alpacaErr) {
+			alpacaErr = &Error{Number: ErrorDriver, Message: err.Error()}
+		}
+
+		resp.ErrorNumber = alpacaErr.Number
+		resp.ErrorMessage = alpacaErr.Message
+	} else if !req.put {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			resp.ErrorNumber, resp.ErrorMessage = ErrorDriver, err.Error()
+		} else {
+			v := json.RawMessage(raw)
+			resp.Value = &v
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.log.WithError(err).Warn("error writing alpaca response")
+	}
+}
+
+// configuredDevices returns the devices for the management API.
+func (s *Server) configuredDevices() []map[string]interface{} {
+	devices := []map[string]interface{}{}
+
+	add := func(deviceType string, names []string) {
+		for i, name := range names {
+			devices = append(devices, map[string]interface{}{
+				"DeviceName":   name,
+				"DeviceType":   deviceType,
+				"DeviceNumber": i,
+				"UniqueID":     strings.ToLower(deviceType) + "-" + name,
+			})
+		}
+	}
+
+	add("Telescope", s.opts.Telescopes)
+	add("Camera", s.opts.Cameras)
+	add("Focuser", s.opts.Focusers)
+
+	return devices
+}
+
+// device returns the INDI device name of a device type and number.
+func (s *Server) device(deviceType string, number int) (string, bool) {
+	var names []string
+
+	switch deviceType {
+	case "telescope":
+		names = s.opts.Telescopes
+	case "camera":
+		names = s.opts.Cameras
+	case "focuser":
+		names = s.opts.Focusers
+	}
+
+	if number < 0 || number >= len(names) {
+		return "", false
+	}
+
+	return names[number], true
+}
+
+// handle answers a member of a device, first from the members every device has, then from its type's.
+func (s *Server) handle(deviceType string, number int, name, member string, req request) (interface{}, error) {
+	switch member {
+	case "connected":
+		if req.put {
+			connected, err := req.bool("connected")
+			if err != nil {
+				return nil, err
+			}
+
+			action := "DISCONNECT"
+			if connected {
+				action = "CONNECT"
+			}
+
+			return nil, s.c.SelectSwitch(name, "CONNECTION", action)
+		}
+
+		return s.connected(name), nil
+	case "name":
+		return name, nil
+	case "description":
+		return "INDI " + deviceType + " " + name, nil
+	case "driverinfo":
+		return "indiclient Alpaca bridge to the INDI device " + name, nil
+	case "driverversion":
+		return "1.0", nil
+	case "interfaceversion":
+		return 3, nil
+	case "supportedactions":
+		return []string{}, nil
+	case "action", "commandblind", "commandbool", "commandstring":
+		return nil, errNotImplemented
+	}
+
+	if !s.connected(name) {
+		return nil, errNotConnected
+	}
+
+	switch deviceType {
+	case "telescope":
+		return s.telescope(name, member, req)
+	case "camera":
+		return s.camera(number, name, member, req)
+	case "focuser":
+		return s.focuser(name, member, req)
+	}
+
+	return nil, errNotImplemented
+}
+
+// connected returns true if name is connected to its hardware.
+func (s *Server) connected(name string) bool {
+	v, err := s.c.GetSwitch(name, "CONNECTION", "CONNECT")
+	return err == nil && v.Value == indiclient.SwitchStateOn
+}
+
+// number returns the value of a number element, or errNotImplemented if the device does not have it.
+func (s *Server) number(deviceName, propName, numberName string) (float64, error) {
+	v, err := s.c.GetNumber(deviceName, propName, numberName)
+	if err != nil {
+		return 0, errNotImplemented
+	}
+
+	return indiclient.ParseNumber(v.Value)
+}
+
+// state returns the state of a property, or an empty state if the device does not have it.
+func (s *Server) state(deviceName, propName string) indiclient.PropertyState {
+	device, err := s.c.GetDevice(deviceName)
+	if err != nil {
+		return ""
+	}
+
+	info, _ := device.PropertyInfo(propName)
+	return info.State
+}
+
+// async runs fn on its own goroutine, logging its error, for members that return before the device finishes.
+func (s *Server) async(deviceName, member string, fn func() error) {
+	go func() {
+		if err := fn(); err != nil {
+			s.log.WithField("device", deviceName).WithField("member", member).WithError(err).Warn("alpaca command failed")
+		}
+	}()
+}
+
+// paramError is a missing or malformed parameter, which Alpaca answers with HTTP 400.
+type paramError struct {
+	name string
+}
+
+func (e *paramError) Error() string {
+	return "missing or invalid parameter " + e.name
+}
+
+// float returns the parameter name as a number.
+func (r request) float(name string) (float64, error) {
+	f, err := strconv.ParseFloat(r.params[strings.ToLower(name)], 64)
+	if err != nil {
+		return 0, &paramError{name: name}
+	}
+
+	return f, nil
+}
+
+// int returns the parameter name as an integer.
+func (r request) int(name string) (int, error) {
+	i, err := strconv.Atoi(r.params[strings.ToLower(name)])
+	if err != nil {
+		return 0, &paramError{name: name}
+	}
+
+	return i, nil
+}
+
+// bool returns the parameter name as a boolean.
+func (r request) bool(name string) (bool, error) {
+	switch strings.ToLower(r.params[strings.ToLower(name)]) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+
+	return false, &paramError{name: name}
+}
+
+// ServeDiscovery answers Alpaca discovery requests on conn, usually listening on DefaultDiscoveryAddr, with port, the
+// port the Server is served on. It returns when conn fails or is closed.
+func (s *Server) ServeDiscovery(conn net.PacketConn, port int) error {
+	reply, _ := json.Marshal(map[string]int{"AlpacaPort": port})
+	buf := make([]byte, 1024)
+
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(string(buf[:n]), discoveryRequest) {
+			if _, err := conn.WriteTo(reply, from); err != nil {
+				return err
+			}
+		}
+	}
+}
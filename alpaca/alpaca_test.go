@@ -0,0 +1,226 @@
+package alpaca_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/alpaca"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+type response struct {
+	Value               interface{}
+	Rank                int
+	ClientTransactionID uint32
+	ServerTransactionID uint32
+	ErrorNumber         int
+	ErrorMessage        string
+}
+
+func get(t *testing.T, srv *httptest.Server, path string) response {
+	resp, err := http.Get(srv.URL + path + "?ClientTransactionID=42")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var r response
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&r))
+	assert.Equal(t, uint32(42), r.ClientTransactionID)
+
+	return r
+}
+
+func put(t *testing.T, srv *httptest.Server, path string, form url.Values) response {
+	req, err := http.NewRequest(http.MethodPut, srv.URL+path, strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var r response
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&r))
+	assert.Nil(t, r.Value)
+
+	return r
+}
+
+func setup(t *testing.T) (*indiclient.INDIClient, *httptest.Server) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+
+	focuser := simulators.NewFocuser("Focuser Simulator")
+	focuser.Speed = 100000
+
+	c := indiclient.NewINDIClient(log, simulators.NewServer(
+		simulators.NewTelescope("Telescope Simulator"),
+		simulators.NewCCD("CCD Simulator"),
+		focuser,
+	), afero.NewMemMapFs(), 100)
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	require.NoError(t, c.GetProperties("", ""))
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == 3 })
+
+	srv := httptest.NewServer(alpaca.NewServer(log, c, alpaca.Options{
+		Telescopes: []string{"Telescope Simulator"},
+		Cameras:    []string{"CCD Simulator"},
+		Focusers:   []string{"Focuser Simulator"},
+	}))
+
+	return c, srv
+}
+
+func Test_Management(t *testing.T) {
+	c, srv := setup(t)
+	defer c.Disconnect()
+	defer srv.Close()
+
+	assert.Equal(t, []interface{}{1.0}, get(t, srv, "/management/apiversions").Value)
+
+	devices := get(t, srv, "/management/v1/configureddevices").Value.([]interface{})
+	require.Len(t, devices, 3)
+	assert.Equal(t, "Camera", devices[1].(map[string]interface{})["DeviceType"])
+	assert.Equal(t, "CCD Simulator", devices[1].(map[string]interface{})["DeviceName"])
+
+	resp, err := http.Get(srv.URL + "/api/v1/camera/3/connected")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	first := get(t, srv, "/api/v1/telescope/0/name")
+	second := get(t, srv, "/api/v1/telescope/0/name")
+	assert.Equal(t, "Telescope Simulator", first.Value)
+	assert.Greater(t, second.ServerTransactionID, first.ServerTransactionID)
+}
+
+func Test_Telescope(t *testing.T) {
+	c, srv := setup(t)
+	defer c.Disconnect()
+	defer srv.Close()
+
+	r := get(t, srv, "/api/v1/telescope/0/rightascension")
+	assert.Equal(t, alpaca.ErrorNotConnected, r.ErrorNumber)
+
+	assert.Equal(t, 0, put(t, srv, "/api/v1/telescope/0/connected", url.Values{"Connected": {"True"}}).ErrorNumber)
+	testutil.WaitFor(t, func() bool { return get(t, srv, "/api/v1/telescope/0/connected").Value == true })
+
+	assert.Equal(t, true, get(t, srv, "/api/v1/telescope/0/cansync").Value)
+	assert.Equal(t, false, get(t, srv, "/api/v1/telescope/0/atpark").Value)
+
+	r = put(t, srv, "/api/v1/telescope/0/synctocoordinates", url.Values{"RightAscension": {"5.5"}, "Declination": {"-20"}})
+	assert.Equal(t, 0, r.ErrorNumber, r.ErrorMessage)
+	assert.InDelta(t, 5.5, get(t, srv, "/api/v1/telescope/0/rightascension").Value, 0.001)
+	assert.InDelta(t, -20, get(t, srv, "/api/v1/telescope/0/declination").Value, 0.001)
+
+	r = put(t, srv, "/api/v1/telescope/0/slewtocoordinates", url.Values{"RightAscension": {"30"}, "Declination": {"0"}})
+	assert.Equal(t, alpaca.ErrorInvalidValue, r.ErrorNumber)
+
+	require.NoError(t, c.SetNumber("Telescope Simulator", "GEOGRAPHIC_COORD", map[string]float64{"LONG": 300}))
+	assert.InDelta(t, -60, get(t, srv, "/api/v1/telescope/0/sitelongitude").Value, 0.001)
+
+	r = put(t, srv, "/api/v1/telescope/0/pulseguide", url.Values{"Direction": {"2"}, "Duration": {"200"}})
+	assert.Equal(t, 0, r.ErrorNumber, r.ErrorMessage)
+	testutil.WaitFor(t, func() bool { return get(t, srv, "/api/v1/telescope/0/ispulseguiding").Value == true })
+	testutil.WaitFor(t, func() bool { return get(t, srv, "/api/v1/telescope/0/ispulseguiding").Value == false })
+
+	assert.Equal(t, alpaca.ErrorNotImplemented, get(t, srv, "/api/v1/telescope/0/azimuth").ErrorNumber)
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL+"/api/v1/telescope/0/pulseguide", strings.NewReader("Direction=north"))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func Test_Camera(t *testing.T) {
+	c, srv := setup(t)
+	defer c.Disconnect()
+	defer srv.Close()
+
+	put(t, srv, "/api/v1/camera/0/connected", url.Values{"Connected": {"true"}})
+	testutil.WaitFor(t, func() bool { return c.BlobPropertySet("CCD Simulator", "CCD1") })
+
+	assert.Equal(t, 320.0, get(t, srv, "/api/v1/camera/0/cameraxsize").Value)
+	assert.Equal(t, 5.2, get(t, srv, "/api/v1/camera/0/pixelsizey").Value)
+	assert.Equal(t, alpaca.ErrorInvalidOperation, get(t, srv, "/api/v1/camera/0/imagearray").ErrorNumber)
+
+	r := put(t, srv, "/api/v1/camera/0/startexposure", url.Values{"Duration": {"0.01"}, "Light": {"true"}})
+	require.Equal(t, 0, r.ErrorNumber, r.ErrorMessage)
+
+	testutil.WaitFor(t, func() bool { return get(t, srv, "/api/v1/camera/0/imageready").Value == true })
+	assert.Equal(t, 0.0, get(t, srv, "/api/v1/camera/0/camerastate").Value)
+	assert.Equal(t, 0.01, get(t, srv, "/api/v1/camera/0/lastexposureduration").Value)
+
+	img := get(t, srv, "/api/v1/camera/0/imagearray")
+	require.Equal(t, 0, img.ErrorNumber, img.ErrorMessage)
+	assert.Equal(t, 2, img.Rank)
+
+	columns := img.Value.([]interface{})
+	assert.Len(t, columns, 320)
+	assert.Len(t, columns[0], 240)
+}
+
+func Test_Focuser(t *testing.T) {
+	c, srv := setup(t)
+	defer c.Disconnect()
+	defer srv.Close()
+
+	put(t, srv, "/api/v1/focuser/0/connected", url.Values{"Connected": {"true"}})
+	testutil.WaitFor(t, func() bool { return get(t, srv, "/api/v1/focuser/0/connected").Value == true })
+
+	assert.Equal(t, 100000.0, get(t, srv, "/api/v1/focuser/0/maxstep").Value)
+
+	r := put(t, srv, "/api/v1/focuser/0/move", url.Values{"Position": {"42000"}})
+	require.Equal(t, 0, r.ErrorNumber, r.ErrorMessage)
+
+	testutil.WaitFor(t, func() bool { return get(t, srv, "/api/v1/focuser/0/position").Value == 42000.0 })
+	testutil.WaitFor(t, func() bool { return get(t, srv, "/api/v1/focuser/0/ismoving").Value == false })
+}
+
+func Test_ServeDiscovery(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	s := alpaca.NewServer(log, nil, alpaca.Options{})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	go s.ServeDiscovery(conn, 4567)
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Write([]byte("alpacadiscovery1"))
+	require.NoError(t, err)
+
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	buf := make([]byte, 256)
+	n, err := client.Read(buf)
+	require.NoError(t, err)
+
+	var reply map[string]int
+	require.NoError(t, json.Unmarshal(buf[:n], &reply))
+	assert.Equal(t, 4567, reply["AlpacaPort"])
+}
@@ -0,0 +1,351 @@
+package alpaca
+
+import (
+	"context"
+	"image"
+	"io/ioutil"
+	"time"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/imaging"
+	"github.com/goastro/indiclient/observatory"
+)
+
+// Alpaca camera states, as returned by camerastate.
+const (
+	cameraIdle     = 0
+	cameraExposing = 2
+	cameraError    = 5
+)
+
+// cameraState is the exposure a camera is taking, or last took. Protected by Server.mu.
+type cameraState struct {
+	exposing bool
+	cancel   context.CancelFunc
+	image    image.Image
+	duration float64
+	start    time.Time
+	err      error
+}
+
+// cameraState returns the state of camera number, creating it if needed. Only call when Server.mu is locked.
+func (s *Server) cameraState(number int) *cameraState {
+	cs, ok := s.cameras[number]
+	if !ok {
+		cs = &cameraState{}
+		s.cameras[number] = cs
+	}
+
+	return cs
+}
+
+// camera answers the members of the Alpaca camera interface.
+func (s *Server) camera(number int, name, member string, req request) (interface{}, error) {
+	cam := observatory.NewCamera(s.c, name)
+
+	switch member {
+	case "startexposure":
+		if !req.put {
+			return nil, errNotImplemented
+		}
+		return nil, s.startExposure(number, cam, req)
+	case "abortexposure", "stopexposure":
+		if !req.put {
+			return nil, errNotImplemented
+		}
+		return nil, s.abortExposure(number, name)
+	case "canabortexposure", "canstopexposure":
+		return s.c.SwitchPropertySet(name, "CCD_ABORT_EXPOSURE"), nil
+	case "camerastate", "imageready", "imagearray", "lastexposureduration", "lastexposurestarttime":
+		return s.exposure(number, member)
+	case "cameraxsize":
+		return s.number(name, "CCD_INFO", "CCD_MAX_X")
+	case "cameraysize":
+		return s.number(name, "CCD_INFO", "CCD_MAX_Y")
+	case "pixelsizex", "pixelsizey":
+		element := "CCD_PIXEL_SIZE_X"
+		if member == "pixelsizey" {
+			element = "CCD_PIXEL_SIZE_Y"
+		}
+
+		if v, err := s.number(name, "CCD_INFO", element); err == nil {
+			return v, nil
+		}
+		return s.number(name, "CCD_INFO", "CCD_PIXEL_SIZE")
+	case "binx", "biny":
+		element := "HOR_BIN"
+		if member == "biny" {
+			element = "VER_BIN"
+		}
+
+		if req.put {
+			bin, err := req.int(member)
+			if err != nil {
+				return nil, err
+			}
+			if !s.c.NumberPropertySet(name, "CCD_BINNING") {
+				return nil, errNotImplemented
+			}
+			return nil, s.c.SetNumber(name, "CCD_BINNING", map[string]float64{element: float64(bin)})
+		}
+
+		if v, err := s.number(name, "CCD_BINNING", element); err == nil {
+			return v, nil
+		}
+		return 1, nil
+	case "maxbinx", "maxbiny":
+		v, err := s.c.GetNumber(name, "CCD_BINNING", "HOR_BIN")
+		if err != nil {
+			return 1, nil
+		}
+		return indiclient.ParseNumber(v.Max)
+	case "numx", "numy", "startx", "starty":
+		return s.subframe(name, member, req)
+	case "ccdtemperature":
+		return cam.Temperature()
+	case "setccdtemperature":
+		if req.put {
+			celsius, err := req.float("SetCCDTemperature")
+			if err != nil {
+				return nil, err
+			}
+			if !s.c.NumberPropertySet(name, "CCD_TEMPERATURE") {
+				return nil, errNotImplemented
+			}
+
+			// The setpoint is reached in the background; clients poll ccdtemperature for it.
+			s.async(name, member, func() error { return cam.SetTemperature(context.Background(), celsius) })
+			return nil, nil
+		}
+		return cam.Temperature()
+	case "cansetccdtemperature":
+		return s.c.NumberPropertySet(name, "CCD_TEMPERATURE"), nil
+	case "cangetcoolerpower":
+		return s.c.NumberPropertySet(name, "CCD_COOLER_POWER"), nil
+	case "coolerpower":
+		v, err := cam.CoolerPower()
+		if err != nil {
+			return nil, errNotImplemented
+		}
+		return v, nil
+	case "cooleron":
+		if req.put {
+			return nil, errNotImplemented
+		}
+		if v, err := s.c.GetSwitch(name, "CCD_COOLER", "COOLER_ON"); err == nil {
+			return v.Value == indiclient.SwitchStateOn, nil
+		}
+		power, err := cam.CoolerPower()
+		return err == nil && power > 0, nil
+	case "hasshutter", "canasymmetricbin", "canfastreadout", "canpulseguide":
+		return false, nil
+	case "sensortype":
+		// Monochrome; colour frames are debayered before they are returned.
+		return 0, nil
+	case "maxadu":
+		bits, err := s.number(name, "CCD_INFO", "CCD_BITSPERPIXEL")
+		if err != nil {
+			return 65535, nil
+		}
+		return int(1)<<uint(bits) - 1, nil
+	}
+
+	return nil, errNotImplemented
+}
+
+// startExposure starts an exposure on camera number, returning straight away. The frame is decoded when it arrives,
+// ready for imagearray.
+func (s *Server) startExposure(number int, cam *observatory.Camera, req request) error {
+	duration, err := req.float("Duration")
+	if err != nil {
+		return err
+	}
+
+	light, err := req.bool("Light")
+	if err != nil {
+		return err
+	}
+
+	if duration < 0 {
+		return &Error{Number: ErrorInvalidValue, Message: "duration must not be negative"}
+	}
+
+	frameType := "FRAME_DARK"
+	if light {
+		frameType = "FRAME_LIGHT"
+	}
+
+	if s.c.SwitchPropertySet(cam.Name(), "CCD_FRAME_TYPE") {
+		if err := s.c.SelectSwitch(cam.Name(), "CCD_FRAME_TYPE", frameType); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.mu.Lock()
+	cs := s.cameraState(number)
+	if cs.exposing {
+		s.mu.Unlock()
+		cancel()
+		return &Error{Number: ErrorInvalidOperation, Message: "an exposure is already in progress"}
+	}
+
+	*cs = cameraState{exposing: true, cancel: cancel, duration: duration, start: s.c.Clock().Now()}
+	s.mu.Unlock()
+
+	go func() {
+		defer cancel()
+
+		img, err := s.expose(ctx, cam, duration)
+		if err != nil {
+			s.log.WithField("device", cam.Name()).WithError(err).Warn("alpaca exposure failed")
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		cs.exposing, cs.image, cs.err = false, img, err
+	}()
+
+	return nil
+}
+
+// expose takes an exposure and decodes the frame.
+func (s *Server) expose(ctx context.Context, cam *observatory.Camera, duration float64) (image.Image, error) {
+	frame, err := cam.Expose(ctx, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	r := frame.Open()
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return imaging.Decode(frame.Format, data, imaging.RawOptions{})
+}
+
+// abortExposure aborts the exposure camera number is taking, if any.
+func (s *Server) abortExposure(number int, name string) error {
+	s.mu.Lock()
+	cs := s.cameraState(number)
+	if cs.cancel != nil {
+		cs.cancel()
+	}
+	s.mu.Unlock()
+
+	if !s.c.SwitchPropertySet(name, "CCD_ABORT_EXPOSURE") {
+		return nil
+	}
+
+	return s.c.SelectSwitch(name, "CCD_ABORT_EXPOSURE", "ABORT")
+}
+
+// exposure answers the members describing the last exposure of camera number.
+func (s *Server) exposure(number int, member string) (interface{}, error) {
+	s.mu.Lock()
+	cs := *s.cameraState(number)
+	s.mu.Unlock()
+
+	switch member {
+	case "camerastate":
+		switch {
+		case cs.exposing:
+			return cameraExposing, nil
+		case cs.err != nil:
+			return cameraError, nil
+		}
+		return cameraIdle, nil
+	case "imageready":
+		return !cs.exposing && cs.image != nil, nil
+	case "imagearray":
+		if cs.exposing || cs.image == nil {
+			return nil, &Error{Number: ErrorInvalidOperation, Message: "no image is ready"}
+		}
+		return toImageArray(cs.image), nil
+	}
+
+	if cs.start.IsZero() {
+		return nil, &Error{Number: ErrorInvalidOperation, Message: "no exposure has been taken"}
+	}
+
+	if member == "lastexposureduration" {
+		return cs.duration, nil
+	}
+
+	// Alpaca uses the FITS date format, in UTC.
+	return cs.start.UTC().Format("2006-01-02T15:04:05.000"), nil
+}
+
+// subframe gets or sets an element of CCD_FRAME. Without the property, the frame is the whole sensor.
+func (s *Server) subframe(name, member string, req request) (interface{}, error) {
+	element := map[string]string{"numx": "WIDTH", "numy": "HEIGHT", "startx": "X", "starty": "Y"}[member]
+
+	if req.put {
+		v, err := req.int(member)
+		if err != nil {
+			return nil, err
+		}
+		if !s.c.NumberPropertySet(name, "CCD_FRAME") {
+			return nil, errNotImplemented
+		}
+		return nil, s.c.SetNumber(name, "CCD_FRAME", map[string]float64{element: float64(v)})
+	}
+
+	if v, err := s.number(name, "CCD_FRAME", element); err == nil {
+		return v, nil
+	}
+
+	switch member {
+	case "numx":
+		return s.number(name, "CCD_INFO", "CCD_MAX_X")
+	case "numy":
+		return s.number(name, "CCD_INFO", "CCD_MAX_Y")
+	}
+
+	return 0, nil
+}
+
+// toImageArray converts img to an Alpaca image array, indexed by x then y, with a third index for the colour plane
+// of colour images.
+func toImageArray(img image.Image) imageArray {
+	b := img.Bounds()
+
+	if gray, ok := img.(*image.Gray16); ok {
+		value := make([][]int, b.Dx())
+		for x := range value {
+			value[x] = make([]int, b.Dy())
+			for y := range value[x] {
+				value[x][y] = int(gray.Gray16At(b.Min.X+x, b.Min.Y+y).Y)
+			}
+		}
+		return imageArray{rank: 2, value: value}
+	}
+
+	if _, ok := img.(*image.Gray); ok {
+		value := make([][]int, b.Dx())
+		for x := range value {
+			value[x] = make([]int, b.Dy())
+			for y := range value[x] {
+				r, _, _, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				value[x][y] = int(r >> 8)
+			}
+		}
+		return imageArray{rank: 2, value: value}
+	}
+
+	value := make([][][3]int, b.Dx())
+	for x := range value {
+		value[x] = make([][3]int, b.Dy())
+		for y := range value[x] {
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			value[x][y] = [3]int{int(r), int(g), int(bl)}
+		}
+	}
+
+	return imageArray{rank: 3, value: value}
+}
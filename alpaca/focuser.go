@@ -0,0 +1,72 @@
+package alpaca
+
+import (
+	"context"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/observatory"
+)
+
+// focuser answers the members of the Alpaca focuser interface. Only absolute focusers are supported.
+func (s *Server) focuser(name, member string, req request) (interface{}, error) {
+	f := observatory.NewFocuser(s.c, name)
+
+	switch member {
+	case "absolute":
+		return true, nil
+	case "position":
+		position, err := f.Position()
+		if err != nil {
+			return nil, errNotImplemented
+		}
+		return int(position), nil
+	case "ismoving":
+		return s.state(name, "ABS_FOCUS_POSITION") == indiclient.PropertyStateBusy, nil
+	case "maxstep", "maxincrement":
+		if v, err := s.number(name, "FOCUS_MAX", "FOCUS_MAX_VALUE"); err == nil {
+			return int(v), nil
+		}
+
+		v, err := s.c.GetNumber(name, "ABS_FOCUS_POSITION", "FOCUS_ABSOLUTE_POSITION")
+		if err != nil {
+			return nil, errNotImplemented
+		}
+
+		max, err := indiclient.ParseNumber(v.Max)
+		return int(max), err
+	case "move":
+		if !req.put {
+			return nil, errNotImplemented
+		}
+
+		position, err := req.int("Position")
+		if err != nil {
+			return nil, err
+		}
+		if position < 0 {
+			return nil, &Error{Number: ErrorInvalidValue, Message: "position must not be negative"}
+		}
+
+		s.async(name, member, func() error { return f.MoveTo(context.Background(), float64(position)) })
+		return nil, nil
+	case "halt":
+		if !req.put {
+			return nil, errNotImplemented
+		}
+		if !s.c.SwitchPropertySet(name, "FOCUS_ABORT_MOTION") {
+			return nil, errNotImplemented
+		}
+		return nil, s.c.SelectSwitch(name, "FOCUS_ABORT_MOTION", "ABORT")
+	case "temperature":
+		return s.number(name, "FOCUS_TEMPERATURE", "TEMPERATURE")
+	case "tempcomp":
+		if req.put {
+			return nil, errNotImplemented
+		}
+		return false, nil
+	case "tempcompavailable":
+		return false, nil
+	}
+
+	return nil, errNotImplemented
+}
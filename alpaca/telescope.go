@@ -0,0 +1,214 @@
+package alpaca
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/observatory"
+)
+
+// Alpaca guide directions, as sent to pulseguide.
+var guideDirections = []struct{ prop, element string }{
+	{"TELESCOPE_TIMED_GUIDE_NS", "TIMED_GUIDE_N"},
+	{"TELESCOPE_TIMED_GUIDE_NS", "TIMED_GUIDE_S"},
+	{"TELESCOPE_TIMED_GUIDE_WE", "TIMED_GUIDE_E"},
+	{"TELESCOPE_TIMED_GUIDE_WE", "TIMED_GUIDE_W"},
+}
+
+// telescope answers the members of the Alpaca telescope interface.
+func (s *Server) telescope(name, member string, req request) (interface{}, error) {
+	t := observatory.NewTelescope(s.c, name)
+
+	switch member {
+	case "rightascension":
+		ra, _, err := t.Coordinates()
+		return ra, err
+	case "declination":
+		_, dec, err := t.Coordinates()
+		return dec, err
+	case "slewing":
+		return s.state(name, "EQUATORIAL_EOD_COORD") == indiclient.PropertyStateBusy ||
+			s.state(name, "TELESCOPE_PARK") == indiclient.PropertyStateBusy, nil
+	case "atpark":
+		parked, err := t.Parked()
+		if err != nil {
+			return false, nil
+		}
+		return parked, nil
+	case "canpark", "canunpark":
+		return s.c.SwitchPropertySet(name, "TELESCOPE_PARK"), nil
+	case "canslew", "canslewasync":
+		return s.c.NumberPropertySet(name, "EQUATORIAL_EOD_COORD"), nil
+	case "cansync":
+		_, err := s.c.GetSwitch(name, "ON_COORD_SET", "SYNC")
+		return err == nil, nil
+	case "canpulseguide":
+		return s.c.NumberPropertySet(name, "TELESCOPE_TIMED_GUIDE_NS") && s.c.NumberPropertySet(name, "TELESCOPE_TIMED_GUIDE_WE"), nil
+	case "cansettracking":
+		return s.c.SwitchPropertySet(name, "TELESCOPE_TRACK_STATE"), nil
+	case "canslewaltaz", "canslewaltazasync", "cansyncaltaz", "cansetpark", "canfindhome", "cansetpierside",
+		"cansetguiderates", "cansetrightascensionrate", "cansetdeclinationrate":
+		return false, nil
+	case "equatorialsystem":
+		// EQUATORIAL_EOD_COORD is JNow, Alpaca's topocentric system.
+		return 1, nil
+	case "alignmentmode":
+		return 2, nil
+	case "park":
+		if !req.put {
+			return nil, errNotImplemented
+		}
+		s.async(name, member, func() error { return t.Park(context.Background()) })
+		return nil, nil
+	case "unpark":
+		if !req.put {
+			return nil, errNotImplemented
+		}
+		s.async(name, member, func() error { return t.Unpark(context.Background()) })
+		return nil, nil
+	case "slewtocoordinates", "slewtocoordinatesasync", "synctocoordinates":
+		if !req.put {
+			return nil, errNotImplemented
+		}
+		return nil, s.slew(t, member, req)
+	case "abortslew":
+		if !req.put {
+			return nil, errNotImplemented
+		}
+		return nil, t.Abort()
+	case "tracking":
+		if req.put {
+			tracking, err := req.bool("Tracking")
+			if err != nil {
+				return nil, err
+			}
+
+			action := "TRACK_OFF"
+			if tracking {
+				action = "TRACK_ON"
+			}
+
+			if !s.c.SwitchPropertySet(name, "TELESCOPE_TRACK_STATE") {
+				return nil, errNotImplemented
+			}
+
+			return nil, s.c.SelectSwitch(name, "TELESCOPE_TRACK_STATE", action)
+		}
+
+		v, err := s.c.GetSwitch(name, "TELESCOPE_TRACK_STATE", "TRACK_ON")
+		if err != nil {
+			// Mounts without the property track whenever they are not parked.
+			parked, _ := t.Parked()
+			return !parked, nil
+		}
+		return v.Value == indiclient.SwitchStateOn, nil
+	case "sitelatitude":
+		return s.site(name, "LAT", req)
+	case "sitelongitude":
+		return s.site(name, "LONG", req)
+	case "siteelevation":
+		return s.site(name, "ELEV", req)
+	case "pulseguide":
+		if !req.put {
+			return nil, errNotImplemented
+		}
+		return nil, s.pulseGuide(name, req)
+	case "ispulseguiding":
+		return s.state(name, "TELESCOPE_TIMED_GUIDE_NS") == indiclient.PropertyStateBusy ||
+			s.state(name, "TELESCOPE_TIMED_GUIDE_WE") == indiclient.PropertyStateBusy, nil
+	}
+
+	return nil, errNotImplemented
+}
+
+// slew starts a slew, or syncs, to the coordinates in req. slewtocoordinates waits for the slew to finish, as
+// Alpaca's synchronous slew does.
+func (s *Server) slew(t *observatory.Telescope, member string, req request) error {
+	ra, err := req.float("RightAscension")
+	if err != nil {
+		return err
+	}
+
+	dec, err := req.float("Declination")
+	if err != nil {
+		return err
+	}
+
+	if ra < 0 || ra >= 24 || dec < -90 || dec > 90 {
+		return &Error{Number: ErrorInvalidValue, Message: "coordinates out of range"}
+	}
+
+	if parked, _ := t.Parked(); parked {
+		return &Error{Number: ErrorInvalidWhileParked, Message: "telescope is parked"}
+	}
+
+	switch member {
+	case "synctocoordinates":
+		return t.Sync(req.ctx, ra, dec)
+	case "slewtocoordinates":
+		return t.SlewTo(req.ctx, ra, dec)
+	}
+
+	s.async(t.Name(), member, func() error { return t.SlewTo(context.Background(), ra, dec) })
+
+	return nil
+}
+
+// site gets or sets an element of GEOGRAPHIC_COORD. INDI longitudes run from 0 to 360 degrees east, and Alpaca's
+// from -180 to 180.
+func (s *Server) site(name, element string, req request) (interface{}, error) {
+	param := map[string]string{"LAT": "SiteLatitude", "LONG": "SiteLongitude", "ELEV": "SiteElevation"}[element]
+
+	if req.put {
+		v, err := req.float(param)
+		if err != nil {
+			return nil, err
+		}
+
+		if element == "LONG" && v < 0 {
+			v += 360
+		}
+
+		return nil, s.c.SetNumber(name, "GEOGRAPHIC_COORD", map[string]float64{element: v})
+	}
+
+	v, err := s.number(name, "GEOGRAPHIC_COORD", element)
+	if err != nil {
+		return nil, err
+	}
+
+	if element == "LONG" && v > 180 {
+		v -= 360
+	}
+
+	return v, nil
+}
+
+// pulseGuide starts a guide pulse in the Direction of req lasting Duration milliseconds.
+func (s *Server) pulseGuide(name string, req request) error {
+	direction, err := req.int("Direction")
+	if err != nil {
+		return err
+	}
+
+	duration, err := req.int("Duration")
+	if err != nil {
+		return err
+	}
+
+	if direction < 0 || direction >= len(guideDirections) || duration < 0 {
+		return &Error{Number: ErrorInvalidValue, Message: "invalid direction or duration"}
+	}
+
+	d := guideDirections[direction]
+	if !s.c.NumberPropertySet(name, d.prop) {
+		return errNotImplemented
+	}
+
+	s.async(name, "pulseguide", func() error {
+		return s.c.SetNumberValue(name, d.prop, []string{d.element}, []string{strconv.Itoa(duration)})
+	})
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package indiclient
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNoBlobAnalyzer is returned by BlobEvent.Stats when no analyzer was set with SetBlobAnalyzer.
+var ErrNoBlobAnalyzer = errors.New("no blob analyzer")
+
+// FrameStats are basic statistics of the pixel values of a camera frame, useful for tuning exposures and as a focus
+// metric. For color frames they are computed on the luminance of each pixel.
+type FrameStats struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// BitDepth is the number of bits per sample, which sets the range of the values below.
+	BitDepth int     `json:"bitDepth"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	Mean     float64 `json:"mean"`
+	Median   float64 `json:"median"`
+	StdDev   float64 `json:"stdDev"`
+	// Histogram counts the pixels in equal bins covering the full range of BitDepth, if the analyzer computes one.
+	Histogram []uint64 `json:"histogram,omitempty"`
+}
+
+// BlobAnalyzer computes statistics for a BLOB with the given format and contents. See the imaging package for an
+// implementation that handles FITS and raw frames.
+type BlobAnalyzer func(format string, data []byte) (*FrameStats, error)
+
+// SetBlobAnalyzer sets the analyzer used by BlobEvent.Stats for BLOBs received from now on. A nil fn disables
+// analysis.
+func (c *INDIClient) SetBlobAnalyzer(fn BlobAnalyzer) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.blobAnalyzer = fn
+}
+
+// blobAnalysis runs an analyzer at most once for a BLOB, however many handlers ask for its stats.
+type blobAnalysis struct {
+	fn     BlobAnalyzer
+	format string
+	data   []byte
+
+	once  sync.Once
+	stats *FrameStats
+	err   error
+}
+
+// newBlobAnalysis returns the analysis for a BLOB, or nil if there is no analyzer. Reads INDIClient.blobAnalyzer.
+// Only call when INDIClient.rwm is at least reader locked.
+func (c *INDIClient) newBlobAnalysis(format string, data []byte) *blobAnalysis {
+	if c.blobAnalyzer == nil {
+		return nil
+	}
+
+	return &blobAnalysis{fn: c.blobAnalyzer, format: format, data: data}
+}
+
+// Stats returns statistics of the frame, computed by the analyzer set with SetBlobAnalyzer. They are computed the
+// first time any handler asks for them, on that handler's goroutine, and shared with every other handler of the same
+// BLOB. Returns ErrNoBlobAnalyzer if there was no analyzer when the BLOB was received. The returned FrameStats is
+// shared, so do not modify it.
+func (e BlobEvent) Stats() (*FrameStats, error) {
+	a := e.analysis
+	if a == nil {
+		return nil, ErrNoBlobAnalyzer
+	}
+
+	a.once.Do(func() {
+		a.stats, a.err = a.fn(a.format, a.data)
+	})
+
+	return a.stats, a.err
+}
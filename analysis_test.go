@@ -0,0 +1,55 @@
+package indiclient
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BlobEvent_Stats(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+
+	var calls int32
+	c.SetBlobAnalyzer(func(format string, data []byte) (*FrameStats, error) {
+		atomic.AddInt32(&calls, 1)
+		return &FrameStats{Width: len(data), Max: 255}, nil
+	})
+
+	events := make(chan BlobEvent, 2)
+	for i := 0; i < 2; i++ {
+		_, err := c.OnBlob("Camera", "", "", func(e BlobEvent) {
+			events <- e
+		})
+		require.NoError(t, err)
+	}
+
+	sendBlob(c, "1234567890")
+
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-events:
+			stats, err := e.Stats()
+			require.NoError(t, err)
+			assert.Equal(t, 10, stats.Width)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for blob event")
+		}
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	c.SetBlobAnalyzer(nil)
+	sendBlob(c, "1234567890")
+
+	select {
+	case e := <-events:
+		_, err := e.Stats()
+		assert.Equal(t, ErrNoBlobAnalyzer, err)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for blob event")
+	}
+}
@@ -0,0 +1,95 @@
+// Package astro has the coordinate math needed for pointing a telescope: precession between J2000 and JNow, local
+// sidereal time, conversion between equatorial and horizontal coordinates at a site, atmospheric refraction, and low
+// precision positions of the sun and moon:
+//
+//	ra, dec := astro.ToJNow(5.588, -5.39, time.Now())
+//	alt, az := astro.AltAz(ra, dec, site, time.Now())
+//	fmt.Println(astro.Refract(alt), az)
+//
+// RA is in hours and all other angles are in degrees throughout. Coordinates of date (JNow) are what INDI drivers use
+// for EQUATORIAL_EOD_COORD, while catalogs and plate solvers use J2000.
+package astro
+
+import (
+	"math"
+	"time"
+)
+
+const rad = math.Pi / 180
+
+// JulianDate returns the Julian date of t.
+func JulianDate(t time.Time) float64 {
+	return float64(t.UnixNano())/float64(24*time.Hour) + 2440587.5
+}
+
+// LocalSiderealTime returns the local mean sidereal time at t, in hours, at longitude, in degrees east. Use a longitude
+// of 0 for Greenwich mean sidereal time.
+func LocalSiderealTime(t time.Time, longitude float64) float64 {
+	d := JulianDate(t) - 2451545
+	T := d / 36525
+
+	gmst := 280.46061837 + 360.98564736629*d + 0.000387933*T*T - T*T*T/38710000
+
+	return normalize(gmst+longitude) / 15
+}
+
+// ToJNow precesses J2000 coordinates to the epoch of t, with the IAU 1976 precession model.
+func ToJNow(ra, dec float64, t time.Time) (float64, float64) {
+	return precess(ra, dec, t, false)
+}
+
+// ToJ2000 precesses coordinates of the epoch of t to J2000. It is the inverse of ToJNow.
+func ToJ2000(ra, dec float64, t time.Time) (float64, float64) {
+	return precess(ra, dec, t, true)
+}
+
+// precess rotates ra and dec by the precession matrix from J2000 to t, or by its inverse.
+func precess(ra, dec float64, t time.Time, inverse bool) (float64, float64) {
+	// Julian centuries since J2000.
+	T := (JulianDate(t) - 2451545) / 36525
+
+	arcsec := rad / 3600
+
+	zeta := (2306.2181*T + 0.30188*T*T + 0.017998*T*T*T) * arcsec
+	z := (2306.2181*T + 1.09468*T*T + 0.018203*T*T*T) * arcsec
+	theta := (2004.3109*T - 0.42665*T*T - 0.041833*T*T*T) * arcsec
+
+	cz, sz := math.Cos(zeta), math.Sin(zeta)
+	cZ, sZ := math.Cos(z), math.Sin(z)
+	ct, st := math.Cos(theta), math.Sin(theta)
+
+	m := [3][3]float64{
+		{cZ*ct*cz - sZ*sz, -cZ*ct*sz - sZ*cz, -cZ * st},
+		{sZ*ct*cz + cZ*sz, -sZ*ct*sz + cZ*cz, -sZ * st},
+		{st * cz, -st * sz, ct},
+	}
+
+	a, d := ra*15*rad, dec*rad
+	v := [3]float64{math.Cos(d) * math.Cos(a), math.Cos(d) * math.Sin(a), math.Sin(d)}
+
+	var p [3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			// The matrix is a rotation, so its inverse is its transpose.
+			if inverse {
+				p[i] += m[j][i] * v[j]
+			} else {
+				p[i] += m[i][j] * v[j]
+			}
+		}
+	}
+
+	ra = normalize(math.Atan2(p[1], p[0])/rad) / 15
+	dec = math.Asin(math.Max(-1, math.Min(1, p[2]))) / rad
+
+	return ra, dec
+}
+
+// normalize returns deg in the range 0 to 360.
+func normalize(deg float64) float64 {
+	deg = math.Mod(deg, 360)
+	if deg < 0 {
+		deg += 360
+	}
+	return deg
+}
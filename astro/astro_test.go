@@ -0,0 +1,116 @@
+package astro_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/astro"
+)
+
+func Test_JulianDate(t *testing.T) {
+	assert.Equal(t, 2451545.0, astro.JulianDate(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 2446895.5, astro.JulianDate(time.Date(1987, 4, 10, 0, 0, 0, 0, time.UTC)))
+}
+
+func Test_LocalSiderealTime(t *testing.T) {
+	// Meeus, Astronomical Algorithms, example 12.a.
+	lst := astro.LocalSiderealTime(time.Date(1987, 4, 10, 0, 0, 0, 0, time.UTC), 0)
+	assert.InDelta(t, 197.693195/15, lst, 1e-6)
+
+	// Longitude is added, wrapping at 24 hours.
+	lst = astro.LocalSiderealTime(time.Date(1987, 4, 10, 0, 0, 0, 0, time.UTC), 200)
+	assert.InDelta(t, 37.693195/15, lst, 1e-6)
+}
+
+func Test_Precession(t *testing.T) {
+	j2000 := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	ra, dec := astro.ToJNow(6, 30, j2000)
+	assert.InDelta(t, 6, ra, 1e-9)
+	assert.InDelta(t, 30, dec, 1e-9)
+
+	// On the equator at RA 0, 50 years of precession is about 3.07s of RA and 20.04" of Dec a year.
+	ra, dec = astro.ToJNow(0, 0, time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC))
+	assert.InDelta(t, 50*3.075/3600, ra, 0.1/3600)
+	assert.InDelta(t, 50*20.04/3600, dec, 1.0/3600)
+
+	now := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	ra, dec = astro.ToJNow(23.99, 89, now)
+	ra, dec = astro.ToJ2000(ra, dec, now)
+	assert.InDelta(t, 23.99, ra, 1e-9)
+	assert.InDelta(t, 89, dec, 1e-9)
+}
+
+func Test_AltAz(t *testing.T) {
+	// Meeus example 13.b, Venus from the US Naval Observatory. Meeus measures azimuth from the south, and uses apparent
+	// sidereal time, which differs from mean sidereal time by a few arcseconds.
+	site := indiclient.Site{Latitude: 38 + 55.0/60 + 17.0/3600, Longitude: -(77 + 3.0/60 + 56.0/3600)}
+	at := time.Date(1987, 4, 10, 19, 21, 0, 0, time.UTC)
+	ra, dec := 23+9.0/60+16.641/3600, -(6 + 43.0/60 + 11.61/3600)
+
+	alt, az := astro.AltAz(ra, dec, site, at)
+	assert.InDelta(t, 15.1249, alt, 0.005)
+	assert.InDelta(t, 68.0337+180, az, 0.005)
+
+	assert.InDelta(t, 64.352133/15, astro.HourAngle(ra, site, at), 0.005/15)
+
+	ra2, dec2 := astro.RADec(alt, az, site, at)
+	assert.InDelta(t, ra, ra2, 1e-9)
+	assert.InDelta(t, dec, dec2, 1e-9)
+
+	// The celestial pole is always at the latitude.
+	alt, _ = astro.AltAz(3, 90, site, at)
+	assert.InDelta(t, site.Latitude, alt, 1e-9)
+
+	// An object on the meridian culminates at 90 - latitude + dec, due south.
+	alt, az = astro.AltAz(astro.LocalSiderealTime(at, site.Longitude), 10, site, at)
+	assert.InDelta(t, 90-site.Latitude+10, alt, 1e-9)
+	assert.InDelta(t, 180, az, 1e-9)
+}
+
+func Test_HourAngle(t *testing.T) {
+	site := indiclient.Site{Longitude: 0}
+	at := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	lst := astro.LocalSiderealTime(at, 0)
+
+	assert.InDelta(t, 0, astro.HourAngle(lst, site, at), 1e-9)
+	assert.InDelta(t, 2, astro.HourAngle(lst-2, site, at), 1e-9)
+	assert.InDelta(t, -2, astro.HourAngle(lst+2, site, at), 1e-9)
+}
+
+func Test_Refraction(t *testing.T) {
+	// Meeus example 16.a: an apparent altitude of 0.5 degrees is lifted by 28.754'.
+	assert.InDelta(t, 0.5-28.754/60, astro.Unrefract(0.5), 1e-4)
+
+	// The two formulas are inverses to within a few arcseconds.
+	for _, alt := range []float64{0, 5, 20, 45, 80} {
+		assert.InDelta(t, alt, astro.Unrefract(astro.Refract(alt)), 5.0/3600, "altitude %v", alt)
+	}
+
+	// Refraction vanishes at the zenith and is about a minute at 45 degrees.
+	assert.InDelta(t, 90, astro.Refract(90), 1e-4)
+	assert.InDelta(t, 1.0/60, astro.Refract(45)-45, 0.05/60)
+}
+
+func Test_SunPosition(t *testing.T) {
+	// Meeus example 25.a, 1992 October 13 at 0h TD.
+	ra, dec := astro.SunPosition(time.Date(1992, 10, 13, 0, 0, 0, 0, time.UTC))
+	assert.InDelta(t, 198.38083/15, ra, 0.02/15)
+	assert.InDelta(t, -7.78507, dec, 0.02)
+}
+
+func Test_MoonPosition(t *testing.T) {
+	// Meeus example 47.a, 1992 April 12 at 0h TD.
+	ra, dec := astro.MoonPosition(time.Date(1992, 4, 12, 0, 0, 0, 0, time.UTC))
+	assert.InDelta(t, 134.688470/15, ra, 0.5/15)
+	assert.InDelta(t, 13.768368, dec, 0.5)
+}
+
+func Test_Separation(t *testing.T) {
+	// Meeus example 17.a, Arcturus and Spica.
+	assert.InDelta(t, 32.7930, astro.Separation(213.9154/15, 19.1825, 201.2983/15, -11.1614), 1e-4)
+	assert.Equal(t, 0.0, astro.Separation(1, 2, 1, 2))
+}
@@ -0,0 +1,61 @@
+package astro
+
+import (
+	"math"
+	"time"
+)
+
+// obliquity returns the obliquity of the ecliptic at t, in degrees.
+func obliquity(t time.Time) float64 {
+	return 23.439 - 0.0000004*(JulianDate(t)-2451545)
+}
+
+// SunPosition returns the position of the sun at t, of date, accurate to about 0.01 degrees.
+func SunPosition(t time.Time) (ra, dec float64) {
+	n := JulianDate(t) - 2451545
+
+	L := 280.460 + 0.9856474*n
+	g := (357.528 + 0.9856003*n) * rad
+
+	lambda := L + 1.915*math.Sin(g) + 0.020*math.Sin(2*g)
+
+	return eclipticToEquatorial(lambda, 0, obliquity(t))
+}
+
+// MoonPosition returns the geocentric position of the moon at t, of date, accurate to about 0.3 degrees. Parallax,
+// which moves the moon by up to a degree as seen from the surface, is ignored.
+func MoonPosition(t time.Time) (ra, dec float64) {
+	T := (JulianDate(t) - 2451545) / 36525
+
+	sin := func(deg float64) float64 { return math.Sin(deg * rad) }
+
+	lambda := 218.32 + 481267.881*T +
+		6.29*sin(135.0+477198.87*T) - 1.27*sin(259.3-413335.36*T) + 0.66*sin(235.7+890534.22*T) +
+		0.21*sin(269.9+954397.74*T) - 0.19*sin(357.5+35999.05*T) - 0.11*sin(186.5+966404.03*T)
+
+	beta := 5.13*sin(93.3+483202.02*T) + 0.28*sin(228.2+960400.89*T) -
+		0.28*sin(318.3+6003.15*T) - 0.17*sin(217.6-407332.21*T)
+
+	return eclipticToEquatorial(lambda, beta, obliquity(t))
+}
+
+// eclipticToEquatorial converts ecliptic longitude and latitude to RA and Dec.
+func eclipticToEquatorial(lambda, beta, epsilon float64) (ra, dec float64) {
+	l, b, e := lambda*rad, beta*rad, epsilon*rad
+
+	ra = math.Atan2(math.Sin(l)*math.Cos(e)-math.Tan(b)*math.Sin(e), math.Cos(l)) / rad
+	dec = math.Asin(math.Sin(b)*math.Cos(e)+math.Cos(b)*math.Sin(e)*math.Sin(l)) / rad
+
+	return normalize(ra) / 15, dec
+}
+
+// Separation returns the angle between two positions.
+func Separation(ra1, dec1, ra2, dec2 float64) float64 {
+	d1, d2 := dec1*rad, dec2*rad
+	dra := (ra1 - ra2) * 15 * rad
+
+	// The haversine formula is accurate for small separations, unlike the spherical law of cosines.
+	h := math.Pow(math.Sin((d1-d2)/2), 2) + math.Cos(d1)*math.Cos(d2)*math.Pow(math.Sin(dra/2), 2)
+
+	return 2 * math.Asin(math.Min(1, math.Sqrt(h))) / rad
+}
@@ -0,0 +1,61 @@
+package astro
+
+import (
+	"math"
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// AltAz returns the altitude and azimuth of the object at ra and dec, of date, seen from site at t. Azimuth is
+// measured from north through east, as in HORIZONTAL_COORD. Refraction is ignored; see Refract.
+func AltAz(ra, dec float64, site indiclient.Site, t time.Time) (alt, az float64) {
+	ha := HourAngle(ra, site, t) * 15 * rad
+	lat, d := site.Latitude*rad, dec*rad
+
+	alt = math.Asin(math.Sin(lat)*math.Sin(d)+math.Cos(lat)*math.Cos(d)*math.Cos(ha)) / rad
+	az = math.Atan2(-math.Sin(ha)*math.Cos(d), math.Cos(lat)*math.Sin(d)-math.Sin(lat)*math.Cos(d)*math.Cos(ha)) / rad
+
+	return alt, normalize(az)
+}
+
+// RADec returns the coordinates of date at the altitude and azimuth seen from site at t. It is the inverse of AltAz.
+func RADec(alt, az float64, site indiclient.Site, t time.Time) (ra, dec float64) {
+	lat, a, z := site.Latitude*rad, alt*rad, az*rad
+
+	dec = math.Asin(math.Sin(lat)*math.Sin(a)+math.Cos(lat)*math.Cos(a)*math.Cos(z)) / rad
+	ha := math.Atan2(-math.Sin(z)*math.Cos(a), math.Cos(lat)*math.Sin(a)-math.Sin(lat)*math.Cos(a)*math.Cos(z)) / rad
+
+	return normalize(LocalSiderealTime(t, site.Longitude)*15-ha) / 15, dec
+}
+
+// HourAngle returns the hour angle of ra, of date, at site at t, in hours from -12 to 12. It is negative east of the
+// meridian and positive west of it.
+func HourAngle(ra float64, site indiclient.Site, t time.Time) float64 {
+	ha := normalize((LocalSiderealTime(t, site.Longitude)-ra)*15) / 15
+	if ha >= 12 {
+		ha -= 24
+	}
+	return ha
+}
+
+// Refract returns the apparent altitude of an object at the true altitude alt, raised by atmospheric refraction at a
+// pressure of 1010 hPa and a temperature of 10°C. Below the horizon, refraction is taken as at an altitude of -1
+// degree.
+func Refract(alt float64) float64 {
+	// Sæmundsson's formula, in arcminutes.
+	h := math.Max(alt, -1)
+	r := 1.02 / math.Tan((h+10.3/(h+5.11))*rad)
+
+	return alt + r/60
+}
+
+// Unrefract returns the true altitude of an object seen at the apparent altitude alt. It is the inverse of Refract,
+// to within a few arcseconds.
+func Unrefract(alt float64) float64 {
+	// Bennett's formula, in arcminutes.
+	h := math.Max(alt, -1)
+	r := 1 / math.Tan((h+7.31/(h+4.4))*rad)
+
+	return alt - r/60
+}
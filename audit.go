@@ -0,0 +1,219 @@
+package indiclient
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultAuditLogSize is the number of commands kept in the audit log by NewINDIClient.
+const DefaultAuditLogSize = 1000
+
+// AuditEntry records a command sent to a device, and the device's response to it.
+type AuditEntry struct {
+	// ID is the correlation ID of the command. It is also set on the command's trace span.
+	ID string `json:"id"`
+	// User is the user set with SetAuditUser when the command was sent.
+	User     string `json:"user"`
+	Device   string `json:"device"`
+	Property string `json:"property"`
+	// Command is the name of the element sent to indiserver, e.g. newNumberVector.
+	Command string `json:"command"`
+	// Values are the element values sent. BLOBs are summarized by their size and format.
+	Values map[string]string `json:"values"`
+	Sent   time.Time         `json:"sent"`
+	// Transitions are the states reported by the device after the command was sent.
+	Transitions []AuditTransition `json:"transitions"`
+	// Completed is when the device reported Ok or Alert, or the command failed. It is zero while the command is in
+	// flight.
+	Completed time.Time `json:"completed"`
+	// Result is the final state of the property.
+	Result PropertyState `json:"result"`
+	// Error is set if the command failed.
+	Error string `json:"error"`
+}
+
+// AuditTransition is a state reported by a device for a property while a command was in flight.
+type AuditTransition struct {
+	State     PropertyState `json:"state"`
+	Message   string        `json:"message"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// AuditFilter selects entries from the audit log. Empty fields match everything.
+type AuditFilter struct {
+	Device   string
+	Property string
+	User     string
+	// Since and Until limit entries by the time the command was sent.
+	Since time.Time
+	Until time.Time
+}
+
+func (f AuditFilter) matches(e *AuditEntry) bool {
+	if len(f.Device) > 0 && f.Device != e.Device {
+		return false
+	}
+
+	if len(f.Property) > 0 && f.Property != e.Property {
+		return false
+	}
+
+	if len(f.User) > 0 && f.User != e.User {
+		return false
+	}
+
+	if !f.Since.IsZero() && e.Sent.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && e.Sent.After(f.Until) {
+		return false
+	}
+
+	return true
+}
+
+// SetAuditUser sets the user recorded in the audit log for commands sent from now on.
+func (c *INDIClient) SetAuditUser(user string) {
+	c.auditMu.Lock()
+	defer c.auditMu.Unlock()
+
+	c.auditUser = user
+}
+
+// SetAuditLogSize sets how many commands are kept in the audit log. Once the log is full, the oldest entry is removed
+// for each new command. Zero disables the audit log.
+func (c *INDIClient) SetAuditLogSize(n int) {
+	if n < 0 {
+		n = 0
+	}
+
+	c.auditMu.Lock()
+	defer c.auditMu.Unlock()
+
+	c.auditSize = n
+	c.trimAudit()
+}
+
+// AuditLog returns the entries in the audit log that match filter, oldest first.
+func (c *INDIClient) AuditLog(filter AuditFilter) []AuditEntry {
+	c.auditMu.Lock()
+	defer c.auditMu.Unlock()
+
+	entries := []AuditEntry{}
+
+	for _, e := range c.audit {
+		if filter.matches(e) {
+			entries = append(entries, copyAuditEntry(e))
+		}
+	}
+
+	return entries
+}
+
+// FindAuditEntry returns the entry with the correlation ID id.
+func (c *INDIClient) FindAuditEntry(id string) (AuditEntry, bool) {
+	c.auditMu.Lock()
+	defer c.auditMu.Unlock()
+
+	for _, e := range c.audit {
+		if e.ID == id {
+			return copyAuditEntry(e), true
+		}
+	}
+
+	return AuditEntry{}, false
+}
+
+// newAuditEntry creates an entry for cmd, which must be one of the new*Vector types, and adds it to the log.
+func (c *INDIClient) newAuditEntry(cmd interface{}) *AuditEntry {
+	e := &AuditEntry{
+		ID:     uuid.New().String(),
+		Values: map[string]string{},
+		Sent:   c.now(),
+	}
+
+	switch item := cmd.(type) {
+	case NewTextVector:
+		e.Command, e.Device, e.Property = "newTextVector", item.Device, item.Name
+		for _, v := range item.Texts {
+			e.Values[v.Name] = v.Value
+		}
+	case NewNumberVector:
+		e.Command, e.Device, e.Property = "newNumberVector", item.Device, item.Name
+		for _, v := range item.Numbers {
+			e.Values[v.Name] = v.Value
+		}
+	case NewSwitchVector:
+		e.Command, e.Device, e.Property = "newSwitchVector", item.Device, item.Name
+		for _, v := range item.Switches {
+			e.Values[v.Name] = string(v.Value)
+		}
+	case NewBlobVector:
+		e.Command, e.Device, e.Property = "newBLOBVector", item.Device, item.Name
+		for _, v := range item.Blobs {
+			e.Values[v.Name] = fmt.Sprintf("%d bytes %s", v.Size, v.Format)
+		}
+	}
+
+	c.auditMu.Lock()
+	defer c.auditMu.Unlock()
+
+	e.User = c.auditUser
+
+	if c.auditSize > 0 {
+		c.audit = append(c.audit, e)
+		c.trimAudit()
+	}
+
+	return e
+}
+
+func (c *INDIClient) auditTransition(e *AuditEntry, state PropertyState, message string) {
+	c.auditMu.Lock()
+	defer c.auditMu.Unlock()
+
+	e.Transitions = append(e.Transitions, AuditTransition{
+		State:     state,
+		Message:   message,
+		Timestamp: c.now(),
+	})
+}
+
+func (c *INDIClient) auditComplete(e *AuditEntry, err error) {
+	c.auditMu.Lock()
+	defer c.auditMu.Unlock()
+
+	e.Completed = c.now()
+
+	if len(e.Transitions) > 0 {
+		e.Result = e.Transitions[len(e.Transitions)-1].State
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
+
+// Only call when INDIClient.auditMu is locked.
+func (c *INDIClient) trimAudit() {
+	if len(c.audit) > c.auditSize {
+		c.audit = append([]*AuditEntry{}, c.audit[len(c.audit)-c.auditSize:]...)
+	}
+}
+
+// Only call when INDIClient.auditMu is locked.
+func copyAuditEntry(e *AuditEntry) AuditEntry {
+	cp := *e
+
+	cp.Values = map[string]string{}
+	for k, v := range e.Values {
+		cp.Values[k] = v
+	}
+
+	cp.Transitions = append([]AuditTransition{}, e.Transitions...)
+
+	return cp
+}
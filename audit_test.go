@@ -0,0 +1,74 @@
+package indiclient_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func Test_AuditLog(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	server := simulators.NewServer(simulators.NewFocuser("Focuser Simulator"))
+
+	tracer := &recordingTracer{}
+
+	c := indiclient.NewINDIClient(log, server, afero.NewMemMapFs(), 100)
+	c.SetTracer(tracer)
+	c.SetAuditUser("observer")
+
+	err := c.Connect("tcp", "localhost:7624")
+	require.NoError(t, err)
+	defer c.Disconnect()
+
+	err = c.GetProperties("", "")
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return c.SwitchPropertySet("Focuser Simulator", "CONNECTION") })
+
+	start := time.Now()
+
+	err = c.SetSwitchValue("Focuser Simulator", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return c.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION") })
+
+	err = c.SetNumberValue("Focuser Simulator", "ABS_FOCUS_POSITION", []string{"FOCUS_ABSOLUTE_POSITION"}, []string{"50100"})
+	require.NoError(t, err)
+
+	entries := c.AuditLog(indiclient.AuditFilter{})
+	require.Len(t, entries, 2)
+	assert.Equal(t, "CONNECTION", entries[0].Property)
+	assert.Equal(t, "newSwitchVector", entries[0].Command)
+
+	entries = c.AuditLog(indiclient.AuditFilter{Device: "Focuser Simulator", Property: "ABS_FOCUS_POSITION", Since: start})
+	require.Len(t, entries, 1)
+
+	e := entries[0]
+	assert.Equal(t, "observer", e.User)
+	assert.Equal(t, "newNumberVector", e.Command)
+	assert.Equal(t, map[string]string{"FOCUS_ABSOLUTE_POSITION": "50100"}, e.Values)
+	assert.Equal(t, indiclient.PropertyStateBusy, e.Transitions[0].State)
+	assert.Equal(t, indiclient.PropertyStateOk, e.Result)
+	assert.False(t, e.Completed.IsZero())
+	assert.Empty(t, e.Error)
+
+	found, ok := c.FindAuditEntry(e.ID)
+	require.True(t, ok)
+	assert.Equal(t, e, found)
+
+	span := tracer.find("SetNumberValue")
+	require.NotNil(t, span)
+	assert.Equal(t, e.ID, span.attrs[indiclient.SpanAttrCorrelationID])
+
+	c.SetAuditLogSize(1)
+	assert.Len(t, c.AuditLog(indiclient.AuditFilter{}), 1)
+}
@@ -0,0 +1,270 @@
+// Package autofocus focuses a camera by stepping a focuser through a range of positions, measuring the half-flux
+// radius (HFR) of the stars at each one, and moving to the best position of a hyperbola fitted to the measurements:
+//
+//	result, err := autofocus.AutoFocus(ctx, c, autofocus.Options{
+//		Focuser:  "Focuser Simulator",
+//		Camera:   "CCD Simulator",
+//		Exposure: 2,
+//		StepSize: 100,
+//		Steps:    4,
+//	})
+//
+// The focuser must be absolute (ABS_FOCUS_POSITION), and the camera must send frames the imaging package can decode
+// on its CCD1 BLOB. See INDIClient.CaptureFrame.
+package autofocus
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/hfr"
+	"github.com/goastro/indiclient/imaging"
+)
+
+var (
+	// ErrBestOutOfRange is returned when the fitted best position is outside the range that was measured, which
+	// means focus is further away than the range covers. Move the focuser closer, or use more or larger steps.
+	ErrBestOutOfRange = errors.New("best focus is outside the measured range")
+	// ErrFrameTimeout is returned when a frame does not arrive within Options.FrameTimeout beyond the exposure time.
+	ErrFrameTimeout = errors.New("timed out waiting for frame")
+)
+
+const (
+	// DefaultSteps is the default number of steps measured on either side of the center.
+	DefaultSteps = 4
+	// DefaultFrameTimeout is how long to wait for a frame beyond the exposure time.
+	DefaultFrameTimeout = 30 * time.Second
+
+	focusProperty = "ABS_FOCUS_POSITION"
+	focusElement  = "FOCUS_ABSOLUTE_POSITION"
+)
+
+// Options controls an AutoFocus run.
+type Options struct {
+	// Focuser and Camera are the device names.
+	Focuser string
+	Camera  string
+	// Exposure is the exposure time of each frame, in seconds.
+	Exposure float64
+	// Center is the focuser position the range is centered on. Defaults to the current position.
+	Center float64
+	// StepSize is the distance between positions, in focuser steps.
+	StepSize float64
+	// Steps is the number of positions measured on either side of Center. Defaults to DefaultSteps.
+	Steps int
+	// Backlash, if set, is how far below a position the focuser moves first, so that positions are always reached
+	// moving in the same direction, taking up any backlash in the focuser.
+	Backlash float64
+	// FrameTimeout is how long to wait for a frame beyond the exposure time. Defaults to DefaultFrameTimeout.
+	FrameTimeout time.Duration
+	// HFR controls star detection.
+	HFR hfr.Options
+	// Raw describes the frames if the camera sends raw frames. See imaging.Decode.
+	Raw imaging.RawOptions
+	// Progress, if set, is called after each frame is measured.
+	Progress func(Progress)
+}
+
+// Point is the HFR measured at a focuser position.
+type Point struct {
+	Position float64 `json:"position"`
+	HFR      float64 `json:"hfr"`
+	// Stars is the number of stars the HFR is the median of.
+	Stars int `json:"stars"`
+}
+
+// Progress reports a measured frame. Step counts from 1 to Total.
+type Progress struct {
+	Step  int   `json:"step"`
+	Total int   `json:"total"`
+	Point Point `json:"point"`
+	// Err is set if no stars could be measured at this position, in which case it is left out of the fit.
+	Err error `json:"-"`
+}
+
+// Result describes a completed AutoFocus run.
+type Result struct {
+	// Points are the measurements with stars, in the order they were taken.
+	Points []Point `json:"points"`
+	Fit    Fit     `json:"fit"`
+	// Position is the best focus position the focuser was moved to.
+	Position float64 `json:"position"`
+	// HFR is measured in a final frame taken at Position.
+	HFR float64 `json:"hfr"`
+}
+
+// AutoFocus steps the focuser through 2*Steps+1 positions around Center, takes a frame at each, fits a hyperbola to
+// the HFR of the stars and moves the focuser to its minimum. If the fit fails, the focuser is moved back to where it
+// started, and the points measured so far are returned along with the error.
+//
+// Cancelling ctx stops the run between moves and exposures. A move or exposure already in progress is left to finish.
+func AutoFocus(ctx context.Context, c *indiclient.INDIClient, opts Options) (Result, error) {
+	result := Result{Points: []Point{}}
+
+	if opts.Steps <= 0 {
+		opts.Steps = DefaultSteps
+	}
+
+	if opts.FrameTimeout <= 0 {
+		opts.FrameTimeout = DefaultFrameTimeout
+	}
+
+	start, err := position(c, opts.Focuser)
+	if err != nil {
+		return result, err
+	}
+
+	if opts.Center == 0 {
+		opts.Center = start
+	}
+
+	r := &run{c: c, opts: opts}
+
+	total := 2*opts.Steps + 2
+
+	for i := -opts.Steps; i <= opts.Steps; i++ {
+		pos := opts.Center + float64(i)*opts.StepSize
+
+		// Only the first position needs the overshoot, since every later one is reached moving in the same direction.
+		if err := r.move(ctx, pos, i == -opts.Steps); err != nil {
+			return result, err
+		}
+
+		p, err := r.measure(ctx, pos)
+		if err != nil && err != hfr.ErrNoStars {
+			return result, err
+		}
+
+		if err == nil {
+			result.Points = append(result.Points, p)
+		}
+
+		r.progress(Progress{Step: i + opts.Steps + 1, Total: total, Point: p, Err: err})
+	}
+
+	fit, err := FitHyperbola(result.Points)
+	if err == nil && (fit.C < opts.Center-float64(opts.Steps)*opts.StepSize || fit.C > opts.Center+float64(opts.Steps)*opts.StepSize) {
+		err = ErrBestOutOfRange
+	}
+
+	if err != nil {
+		// Leave the focuser where it was found, rather than at the end of the range.
+		r.move(ctx, start, true)
+		return result, err
+	}
+
+	result.Fit = fit
+	result.Position = math.Round(fit.C)
+
+	if err := r.move(ctx, result.Position, true); err != nil {
+		return result, err
+	}
+
+	p, err := r.measure(ctx, result.Position)
+	r.progress(Progress{Step: total, Total: total, Point: p, Err: err})
+	if err != nil {
+		return result, err
+	}
+
+	result.HFR = p.HFR
+
+	return result, nil
+}
+
+// run holds the state of an AutoFocus call.
+type run struct {
+	c    *indiclient.INDIClient
+	opts Options
+}
+
+func (r *run) progress(p Progress) {
+	if r.opts.Progress != nil {
+		r.opts.Progress(p)
+	}
+}
+
+// move moves the focuser to pos, overshooting by Backlash first if overshoot is set.
+func (r *run) move(ctx context.Context, pos float64, overshoot bool) error {
+	if overshoot && r.opts.Backlash > 0 {
+		if err := r.moveTo(ctx, pos-r.opts.Backlash); err != nil {
+			return err
+		}
+	}
+
+	return r.moveTo(ctx, pos)
+}
+
+func (r *run) moveTo(ctx context.Context, pos float64) error {
+	return do(ctx, func() error {
+		return r.c.SetNumber(r.opts.Focuser, focusProperty, map[string]float64{focusElement: pos})
+	})
+}
+
+// measure takes a frame and measures the HFR of its stars.
+func (r *run) measure(ctx context.Context, pos float64) (Point, error) {
+	p := Point{Position: pos}
+
+	timeout := time.Duration(r.opts.Exposure*float64(time.Second)) + r.opts.FrameTimeout
+
+	frameCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	e, err := r.c.CaptureFrame(frameCtx, r.opts.Camera, r.opts.Exposure)
+	if err != nil {
+		if err == context.DeadlineExceeded && ctx.Err() == nil {
+			err = ErrFrameTimeout
+		}
+		return p, err
+	}
+
+	rdr := e.Open()
+	data, err := ioutil.ReadAll(rdr)
+	rdr.Close()
+	if err != nil {
+		return p, err
+	}
+
+	m, err := hfr.MeasureBlob(e.Format, data, r.opts.Raw, r.opts.HFR)
+	if err != nil {
+		return p, err
+	}
+
+	p.HFR = m.HFR
+	p.Stars = len(m.Stars)
+
+	return p, nil
+}
+
+// position returns the current position of the focuser.
+func position(c *indiclient.INDIClient, focuser string) (float64, error) {
+	v, err := c.GetNumber(focuser, focusProperty, focusElement)
+	if err != nil {
+		return 0, err
+	}
+
+	return indiclient.ParseNumber(v.Value)
+}
+
+// do runs fn, which blocks until a command completes, returning early if ctx is cancelled.
+func do(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,136 @@
+package autofocus_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/autofocus"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func connect(t *testing.T, devices ...simulators.Device) *indiclient.INDIClient {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	c := indiclient.NewINDIClient(log, simulators.NewServer(devices...), afero.NewMemMapFs(), 100)
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	require.NoError(t, c.GetProperties("", ""))
+
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == len(devices) })
+
+	for _, d := range devices {
+		err := c.SetSwitchValue(d.Name(), "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+		require.NoError(t, err)
+	}
+
+	testutil.WaitFor(t, func() bool {
+		return c.BlobPropertySet("CCD Simulator", "CCD1") && c.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION")
+	})
+
+	return c
+}
+
+func Test_AutoFocus(t *testing.T) {
+	focuser := simulators.NewFocuser("Focuser Simulator")
+	focuser.Speed = 50000
+
+	ccd := simulators.NewCCD("CCD Simulator")
+	ccd.Focuser = focuser
+	ccd.BestFocus = 50230
+
+	c := connect(t, focuser, ccd)
+	defer c.Disconnect()
+
+	progress := []autofocus.Progress{}
+
+	result, err := autofocus.AutoFocus(context.Background(), c, autofocus.Options{
+		Focuser:  "Focuser Simulator",
+		Camera:   "CCD Simulator",
+		Exposure: 0.01,
+		StepSize: 300,
+		Steps:    3,
+		Backlash: 100,
+		Progress: func(p autofocus.Progress) { progress = append(progress, p) },
+	})
+	require.NoError(t, err)
+
+	assert.Len(t, result.Points, 7)
+	assert.InDelta(t, 50230, result.Position, 150)
+	assert.True(t, result.Fit.R2 > 0.9, "r2 %g", result.Fit.R2)
+	assert.Equal(t, result.Position, focuser.Position())
+	assert.True(t, result.HFR < result.Points[0].HFR)
+
+	require.Len(t, progress, 8)
+	assert.Equal(t, 8, progress[7].Step)
+	assert.Equal(t, 8, progress[7].Total)
+}
+
+func Test_AutoFocus_OutOfRange(t *testing.T) {
+	focuser := simulators.NewFocuser("Focuser Simulator")
+	focuser.Speed = 50000
+
+	ccd := simulators.NewCCD("CCD Simulator")
+	ccd.Focuser = focuser
+	ccd.BestFocus = 51500
+
+	c := connect(t, focuser, ccd)
+	defer c.Disconnect()
+
+	_, err := autofocus.AutoFocus(context.Background(), c, autofocus.Options{
+		Focuser:  "Focuser Simulator",
+		Camera:   "CCD Simulator",
+		Exposure: 0.01,
+		StepSize: 200,
+		Steps:    2,
+	})
+	assert.Equal(t, autofocus.ErrBestOutOfRange, err)
+
+	// The focuser is left where it started.
+	assert.Equal(t, 50000.0, focuser.Position())
+}
+
+func Test_AutoFocus_Cancel(t *testing.T) {
+	focuser := simulators.NewFocuser("Focuser Simulator")
+	ccd := simulators.NewCCD("CCD Simulator")
+
+	c := connect(t, focuser, ccd)
+	defer c.Disconnect()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := autofocus.AutoFocus(ctx, c, autofocus.Options{Focuser: "Focuser Simulator", Camera: "CCD Simulator", StepSize: 100})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func Test_FitHyperbola(t *testing.T) {
+	truth := autofocus.Fit{A: 2, B: 400, C: 31234}
+
+	points := []autofocus.Point{}
+	for x := 30000.0; x <= 32500; x += 250 {
+		points = append(points, autofocus.Point{Position: x, HFR: truth.HFR(x)})
+	}
+
+	fit, err := autofocus.FitHyperbola(points)
+	require.NoError(t, err)
+
+	assert.InDelta(t, truth.A, fit.A, 1e-6)
+	assert.InDelta(t, truth.B, fit.B, 1e-3)
+	assert.InDelta(t, truth.C, fit.C, 1e-3)
+	assert.InDelta(t, 1, fit.R2, 1e-9)
+
+	_, err = autofocus.FitHyperbola(points[:2])
+	assert.Equal(t, autofocus.ErrNotEnoughPoints, err)
+
+	// HFR that peaks in the middle has no minimum.
+	peaked := []autofocus.Point{{Position: 0, HFR: 2}, {Position: 1, HFR: 3}, {Position: 2, HFR: 3.5}, {Position: 3, HFR: 3}, {Position: 4, HFR: 2}}
+	_, err = autofocus.FitHyperbola(peaked)
+	assert.Equal(t, autofocus.ErrNoMinimum, err)
+}
@@ -0,0 +1,148 @@
+package autofocus
+
+import (
+	"errors"
+	"math"
+)
+
+var (
+	// ErrNotEnoughPoints is returned when fewer than three positions had measurable stars.
+	ErrNotEnoughPoints = errors.New("not enough points to fit")
+	// ErrNoMinimum is returned when the measurements do not form a V-curve, e.g. because the range was too small or
+	// the frames were too noisy.
+	ErrNoMinimum = errors.New("focus curve has no minimum")
+)
+
+// Fit is a hyperbola fitted to the HFR measured at each focuser position:
+//
+//	HFR(x) = A * sqrt(1 + ((x - C) / B)^2)
+//
+// which is how the size of a defocused star grows on either side of focus. C is the best focus position, A the HFR
+// there, and B how quickly the HFR grows away from it.
+type Fit struct {
+	A float64 `json:"a"`
+	B float64 `json:"b"`
+	C float64 `json:"c"`
+	// R2 is the coefficient of determination of the fit, from 0 for no fit at all to 1 for a perfect fit.
+	R2 float64 `json:"r2"`
+}
+
+// HFR returns the HFR the fit predicts at position.
+func (f Fit) HFR(position float64) float64 {
+	d := (position - f.C) / f.B
+	return f.A * math.Sqrt(1+d*d)
+}
+
+// FitHyperbola fits a hyperbola to the HFR of points. Squaring the hyperbola gives a parabola,
+//
+//	HFR^2 = A^2 + (A/B)^2 * (x - C)^2
+//
+// so it is fitted with linear least squares on HFR^2.
+func FitHyperbola(points []Point) (Fit, error) {
+	if len(points) < 3 {
+		return Fit{}, ErrNotEnoughPoints
+	}
+
+	// Center and scale the positions, so the normal equations are well conditioned for positions in the tens of
+	// thousands.
+	var mean, scale float64
+	for _, p := range points {
+		mean += p.Position
+	}
+	mean /= float64(len(points))
+
+	for _, p := range points {
+		scale = math.Max(scale, math.Abs(p.Position-mean))
+	}
+
+	if scale == 0 {
+		return Fit{}, ErrNotEnoughPoints
+	}
+
+	// Normal equations for y = p0 + p1 x + p2 x^2.
+	var m [3][4]float64
+	for _, p := range points {
+		x := (p.Position - mean) / scale
+		y := p.HFR * p.HFR
+		xs := [3]float64{1, x, x * x}
+
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				m[i][j] += xs[i] * xs[j]
+			}
+			m[i][3] += xs[i] * y
+		}
+	}
+
+	coef, ok := solve3(m)
+	if !ok || coef[2] <= 0 {
+		return Fit{}, ErrNoMinimum
+	}
+
+	c := -coef[1] / (2 * coef[2])
+	a2 := coef[0] - coef[1]*coef[1]/(4*coef[2])
+	if a2 <= 0 {
+		return Fit{}, ErrNoMinimum
+	}
+
+	fit := Fit{
+		A: math.Sqrt(a2),
+		C: mean + c*scale,
+	}
+	fit.B = fit.A / math.Sqrt(coef[2]) * scale
+
+	var avg, ssTot, ssRes float64
+	for _, p := range points {
+		avg += p.HFR
+	}
+	avg /= float64(len(points))
+
+	for _, p := range points {
+		ssTot += (p.HFR - avg) * (p.HFR - avg)
+		ssRes += (p.HFR - fit.HFR(p.Position)) * (p.HFR - fit.HFR(p.Position))
+	}
+
+	fit.R2 = 1
+	if ssTot > 0 {
+		fit.R2 = math.Max(0, 1-ssRes/ssTot)
+	}
+
+	return fit, nil
+}
+
+// solve3 solves a 3x3 linear system given as an augmented matrix, by Gaussian elimination with partial pivoting.
+func solve3(m [3][4]float64) ([3]float64, bool) {
+	var x [3]float64
+
+	for col := 0; col < 3; col++ {
+		pivot := col
+		for row := col + 1; row < 3; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return x, false
+		}
+
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for row := col + 1; row < 3; row++ {
+			f := m[row][col] / m[col][col]
+			for k := col; k < 4; k++ {
+				m[row][k] -= f * m[col][k]
+			}
+		}
+	}
+
+	for row := 2; row >= 0; row-- {
+		sum := m[row][3]
+		for k := row + 1; k < 3; k++ {
+			sum -= m[row][k] * x[k]
+		}
+		x[row] = sum / m[row][row]
+	}
+
+	return x, true
+}
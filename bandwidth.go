@@ -0,0 +1,170 @@
+package indiclient
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CompressionProperty is the switch property cameras use to choose whether frames are sent compressed.
+	CompressionProperty = "CCD_COMPRESSION"
+	// CompressionOn is the element of CompressionProperty that turns compression on.
+	CompressionOn = "CCD_COMPRESS"
+
+	// blobRateChunk is how many bytes of a BLOB are read between waits on the rate limiter.
+	blobRateChunk = 4096
+)
+
+// BlobBandwidthOptions limits the bandwidth BLOBs use, for clients on slow links such as 4G. See SetBlobBandwidth.
+type BlobBandwidthOptions struct {
+	// MaxRate is the most bytes per second read from indiserver while a BLOB is being received. Zero means no limit.
+	MaxRate int64 `json:"maxRate"`
+	// PreferCompressed turns on CCD_COMPRESSION on every device that has it, so frames are sent compressed with zlib,
+	// e.g. as .fits.z. Compressed BLOBs are decompressed as they are received, so they are stored, streamed and
+	// analyzed as usual, with the .z removed from their format.
+	PreferCompressed bool `json:"preferCompressed"`
+}
+
+// SetBlobBandwidth limits the bandwidth BLOBs use, and takes effect immediately.
+//
+// Slowing down reads of a BLOB makes indiserver send it more slowly too, which leaves room on the link for other
+// connections. Every message on a connection arrives in order, so control traffic on the same connection still waits
+// for the BLOB ahead of it: enable BLOBs on a client of their own, and limit that one.
+func (c *INDIClient) SetBlobBandwidth(opts BlobBandwidthOptions) {
+	if opts.MaxRate < 0 {
+		opts.MaxRate = 0
+	}
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.blobBandwidth = opts
+	c.blobLimiter.setRate(opts.MaxRate)
+
+	for name := range c.devices {
+		c.preferCompression(name)
+	}
+}
+
+// BlobBandwidth returns the BLOB bandwidth options. See SetBlobBandwidth.
+func (c *INDIClient) BlobBandwidth() BlobBandwidthOptions {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.blobBandwidth
+}
+
+// preferCompression turns on compression for deviceName if it has CCD_COMPRESSION, it is not already on, and
+// BlobBandwidthOptions.PreferCompressed is set. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) preferCompression(deviceName string) {
+	if !c.blobBandwidth.PreferCompressed {
+		return
+	}
+
+	prop, ok := c.devices[deviceName].SwitchProperties[CompressionProperty]
+	if !ok || prop.State == PropertyStateBusy || prop.Permissions == PropertyPermissionReadOnly {
+		return
+	}
+
+	v, ok := prop.Values[CompressionOn]
+	if !ok || v.Value == SwitchStateOn {
+		return
+	}
+
+	log := c.log.WithField("device", deviceName)
+
+	go func() {
+		if err := c.SelectSwitch(c.aliasDevice(deviceName), CompressionProperty, CompressionOn); err != nil {
+			log.WithError(err).Warn("could not turn on compression")
+		}
+	}()
+}
+
+// inflateBlob decompresses a BLOB in format, if it is compressed, and returns the format without the .z. Only use it
+// when BlobBandwidthOptions.PreferCompressed is set.
+func inflateBlob(format string, buf *[]byte) (string, error) {
+	if !strings.HasSuffix(format, ".z") {
+		return format, nil
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(*buf))
+	if err != nil {
+		return format, err
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return format, err
+	}
+
+	*buf = data
+
+	return strings.TrimSuffix(format, ".z"), nil
+}
+
+// rateLimiter limits the rate BLOB data is read at. It is shared by the parser and SetBlobBandwidth, which may change
+// the rate while a BLOB is being read.
+type rateLimiter struct {
+	// clock returns the clock to measure and wait with, usually INDIClient.Clock. nil uses the system clock.
+	clock func() Clock
+
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func (r *rateLimiter) getClock() Clock {
+	if r.clock == nil {
+		return SystemClock{}
+	}
+
+	return r.clock()
+}
+
+func (r *rateLimiter) setRate(rate int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rate = rate
+	r.tokens = float64(rate)
+	r.last = r.getClock().Now()
+}
+
+// wait blocks until n more bytes may be read. Up to a second's worth of bytes may be read at once.
+func (r *rateLimiter) wait(n int) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+
+	if r.rate <= 0 {
+		r.mu.Unlock()
+		return
+	}
+
+	clock := r.getClock()
+	now := clock.Now()
+	rate := float64(r.rate)
+
+	r.tokens += now.Sub(r.last).Seconds() * rate
+	if r.tokens > rate {
+		r.tokens = rate
+	}
+	r.last = now
+
+	r.tokens -= float64(n)
+	deficit := -r.tokens
+
+	r.mu.Unlock()
+
+	if deficit > 0 {
+		<-clock.After(time.Duration(deficit / rate * float64(time.Second)))
+	}
+}
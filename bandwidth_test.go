@@ -0,0 +1,109 @@
+package indiclient
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BlobBandwidth_MaxRate(t *testing.T) {
+	blob := base64.StdEncoding.EncodeToString(make([]byte, 45000))
+	input := fmt.Sprintf(`<setBLOBVector device="Camera" name="CCD1"><oneBLOB name="CCD1" size="45000" format=".fits">%s</oneBLOB></setBLOBVector>`, blob) +
+		`<setNumberVector device="Mount" name="EQUATORIAL_EOD_COORD"><oneNumber name="RA">1</oneNumber></setNumberVector>`
+
+	limiter := &rateLimiter{}
+	limiter.setRate(40000)
+
+	p := newParser(strings.NewReader(input), DefaultParserLimits, ParseModeLenient)
+	p.lr.limiter = limiter
+
+	// 60000 bytes of base64, less the first second's worth, at 40000 bytes a second.
+	start := time.Now()
+
+	item, err := p.next()
+	require.NoError(t, err)
+	assert.IsType(t, &SetBlobVector{}, item)
+	assert.True(t, time.Since(start) >= 400*time.Millisecond, time.Since(start).String())
+
+	// Other messages are not limited.
+	start = time.Now()
+
+	item, err = p.next()
+	require.NoError(t, err)
+	assert.IsType(t, &SetNumberVector{}, item)
+	assert.True(t, time.Since(start) < 100*time.Millisecond, time.Since(start).String())
+}
+
+func Test_BlobBandwidth_PreferCompressed(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+
+	defineBlob(c)
+	c.defSwitchVector(&DefSwitchVector{
+		Device: "Camera",
+		Name:   CompressionProperty,
+		State:  PropertyStateIdle,
+		Perm:   PropertyPermissionReadWrite,
+		Rule:   SwitchRuleOneOfMany,
+		Switches: []DefSwitch{
+			{Name: CompressionOn, Value: SwitchStateOff},
+			{Name: "CCD_RAW", Value: SwitchStateOn},
+		},
+	})
+
+	assert.Empty(t, c.write)
+
+	c.SetBlobBandwidth(BlobBandwidthOptions{PreferCompressed: true})
+	assert.True(t, c.BlobBandwidth().PreferCompressed)
+
+	select {
+	case sent := <-c.write:
+		cmd := sent.(NewSwitchVector)
+		assert.Equal(t, CompressionProperty, cmd.Name)
+		assert.Equal(t, []OneSwitch{{Name: CompressionOn, Value: SwitchStateOn}, {Name: "CCD_RAW", Value: SwitchStateOff}}, cmd.Switches)
+	case <-time.After(time.Second):
+		t.Fatal("compression not turned on")
+	}
+
+	c.rwm.Lock()
+	c.setSwitchVector(&SetSwitchVector{Device: "Camera", Name: CompressionProperty, State: PropertyStateOk, Switches: []OneSwitch{{Name: CompressionOn, Value: SwitchStateOn}, {Name: "CCD_RAW", Value: SwitchStateOff}}})
+	c.rwm.Unlock()
+
+	compressed := bytes.Buffer{}
+	w := zlib.NewWriter(&compressed)
+	_, err := w.Write([]byte("SIMPLE  =                    T"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	c.rwm.Lock()
+	c.setBlobVector(&SetBlobVector{
+		Device: "Camera",
+		Name:   "CCD1",
+		State:  PropertyStateOk,
+		Blobs: []OneBlob{
+			{Name: "CCD1", Format: ".fits.z", Size: 30, Value: base64.StdEncoding.EncodeToString(compressed.Bytes())},
+		},
+	})
+	c.rwm.Unlock()
+
+	rdr, _, size, err := c.GetBlob("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	data, err := ioutil.ReadAll(rdr)
+	require.NoError(t, err)
+	assert.Equal(t, "SIMPLE  =                    T", string(data))
+	assert.Equal(t, int64(30), size)
+
+	prop, err := c.GetBlobProperty("Camera", "CCD1")
+	require.NoError(t, err)
+	assert.Equal(t, ".fits", prop.Values["CCD1"].Format)
+}
@@ -0,0 +1,194 @@
+package indiclient
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// SetBlobRetention sets how many of the most recent BLOBs are kept on the file system for each BLOB element. The
+// default of 1 overwrites the same file every time a BLOB is received. With a higher value, each BLOB is written to a
+// new file with a sequence number in its name, and the oldest file is removed once there are more than n.
+func (c *INDIClient) SetBlobRetention(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.blobRetention = n
+}
+
+// PeekBlob is like GetBlob, but leaves the BLOB available so it can be read again. Be sure to close rdr when you are
+// done with it.
+func (c *INDIClient) PeekBlob(deviceName, propName, blobName string) (rdr io.ReadCloser, fileName string, length int64, err error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.openBlob(deviceName, propName, blobName)
+}
+
+// RetainedBlobs returns the BLOBs kept on the file system for the given deviceName, propName, blobName, oldest first.
+// Value holds the name of each file, which can be opened with the file system given to NewINDIClient.
+func (c *INDIClient) RetainedBlobs(deviceName, propName, blobName string) ([]BlobValue, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	if _, err := c.findBlobValue(deviceName, propName, blobName); err != nil {
+		return nil, err
+	}
+
+	retained := c.blobFiles[blobStreamKey(deviceName, propName, blobName)]
+
+	blobs := make([]BlobValue, len(retained))
+	copy(blobs, retained)
+
+	return blobs, nil
+}
+
+// ReleaseBlob removes all retained BLOB files for the given deviceName, propName, blobName from the file system. The
+// BLOB is no longer available until the next one is received.
+func (c *INDIClient) ReleaseBlob(deviceName, propName, blobName string) error {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	val, err := c.findBlobValue(deviceName, propName, blobName)
+	if err != nil {
+		return err
+	}
+
+	key := blobStreamKey(deviceName, propName, blobName)
+
+	for _, b := range c.blobFiles[key] {
+		if err := c.fs.Remove(b.Value); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	delete(c.blobFiles, key)
+
+	val.Value = ""
+	val.Size = 0
+	c.devices[deviceName].BlobProperties[propName].Values[blobName] = val
+	c.publishProperty(deviceName, propName)
+
+	return nil
+}
+
+// Reads INDIClient.devices. Only call when INDIClient.rwm is at least reader locked.
+func (c *INDIClient) findBlobValue(deviceName, propName, blobName string) (BlobValue, error) {
+	device, err := c.findDevice(deviceName)
+	if err != nil {
+		return BlobValue{}, err
+	}
+
+	prop, ok := device.BlobProperties[propName]
+	if !ok {
+		return BlobValue{}, ErrPropertyNotFound
+	}
+
+	val, ok := prop.Values[blobName]
+	if !ok {
+		return BlobValue{}, ErrPropertyValueNotFound
+	}
+
+	return val, nil
+}
+
+// Reads INDIClient.devices. Only call when INDIClient.rwm is at least reader locked.
+func (c *INDIClient) openBlob(deviceName, propName, blobName string) (rdr io.ReadCloser, fileName string, length int64, err error) {
+	val, err := c.findBlobValue(deviceName, propName, blobName)
+	if err != nil {
+		return
+	}
+
+	if val.Size == 0 || val.Name == "" {
+		err = ErrBlobNotFound
+		return
+	}
+
+	f, err := c.fs.Open(val.Value)
+	if err != nil {
+		return
+	}
+
+	rdr = f
+
+	if c.blobMapping.Enabled && val.Size >= c.blobMapping.MinSize {
+		if m, ok := c.mapBlob(f, val.Size); ok {
+			rdr = m
+		}
+	}
+
+	fileName = filepath.Base(val.Value)
+	length = val.Size
+
+	return
+}
+
+// blobFile returns the name of the file to store val in, applying the storage quota, or an empty name if the storage
+// options do not allow size bytes to be written. Modifies INDIClient.blobFiles and INDIClient.devices. Only call when
+// INDIClient.rwm is locked.
+func (c *INDIClient) blobFile(deviceName, propName string, val BlobValue, size int64) string {
+	fname := c.blobFileName(deviceName, propName, val)
+
+	err := c.checkBlobStorage(BlobWrite{
+		Device:   c.aliasDevice(deviceName),
+		Property: propName,
+		Name:     val.Name,
+		FileName: fname,
+		Size:     size,
+	})
+	if err != nil {
+		c.log.WithField("file", fname).WithError(err).Warn("blob not stored")
+		return ""
+	}
+
+	return fname
+}
+
+// writeBlob writes data to fname, creating its directory if needed, and returns the name of the file. See
+// writeBlobFile for replace. It does not need INDIClient.rwm.
+func (c *INDIClient) writeBlob(fname string, data []byte, replace bool) (string, error) {
+	if dir := filepath.Dir(fname); dir != "." {
+		if err := c.fs.MkdirAll(dir, 0777); err != nil {
+			return "", err
+		}
+	}
+
+	return c.writeBlobFile(fname, data, replace)
+}
+
+// retainBlob records that val was stored in the file named by val.Value, and removes the oldest files of its element
+// beyond the retention policy. Modifies INDIClient.blobFiles. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) retainBlob(deviceName, propName string, val BlobValue) {
+	key := blobStreamKey(deviceName, propName, val.Name)
+
+	retained := c.blobFiles[key]
+
+	// A file that was overwritten is not retained separately, and must not be removed.
+	for i, b := range retained {
+		if b.Value == val.Value {
+			retained = append(retained[:i:i], retained[i+1:]...)
+			break
+		}
+	}
+
+	retained = append(retained, val)
+
+	for len(retained) > c.blobRetention {
+		if err := c.fs.Remove(retained[0].Value); err != nil && !os.IsNotExist(err) {
+			c.log.WithField("file", retained[0].Value).WithError(err).Warn("error in c.fs.Remove")
+		}
+		retained = retained[1:]
+	}
+
+	c.blobFiles[key] = retained
+}
@@ -0,0 +1,466 @@
+package indiclient
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+func Test_PeekBlob_NonDestructive(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+	sendBlob(c, "1234567890")
+
+	for i := 0; i < 2; i++ {
+		rdr, name, size, err := c.PeekBlob("Camera", "CCD1", "CCD1")
+		require.NoError(t, err)
+		assert.Equal(t, "Camera_CCD1_CCD1.fits", name)
+		assert.Equal(t, int64(10), size)
+
+		b, _ := ioutil.ReadAll(rdr)
+		assert.Equal(t, "1234567890", string(b))
+		rdr.Close()
+	}
+
+	assert.True(t, c.BlobAvailable("Camera", "CCD1", "CCD1"))
+}
+
+func Test_GetBlob_OnlyOnce(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+	sendBlob(c, "1234567890")
+
+	rdr, _, _, err := c.GetBlob("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+	rdr.Close()
+
+	assert.False(t, c.BlobAvailable("Camera", "CCD1", "CCD1"))
+
+	_, _, _, err = c.GetBlob("Camera", "CCD1", "CCD1")
+	assert.Equal(t, ErrBlobNotFound, err)
+}
+
+func Test_BlobRetention(t *testing.T) {
+	c := newTestClient()
+	c.SetBlobRetention(2)
+	defineBlob(c)
+
+	sendBlob(c, "one")
+	sendBlob(c, "two")
+	sendBlob(c, "three")
+
+	retained, err := c.RetainedBlobs("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+	require.Len(t, retained, 2)
+	assert.Equal(t, "Camera_CCD1_CCD1_2.fits", retained[0].Value)
+	assert.Equal(t, "Camera_CCD1_CCD1_3.fits", retained[1].Value)
+	assert.Equal(t, int64(5), retained[1].Size)
+	assert.Equal(t, ".fits", retained[1].Format)
+
+	exists, _ := afero.Exists(c.fs, "Camera_CCD1_CCD1_1.fits")
+	assert.False(t, exists)
+
+	rdr, name, _, err := c.PeekBlob("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+	assert.Equal(t, "Camera_CCD1_CCD1_3.fits", name)
+	rdr.Close()
+
+	err = c.ReleaseBlob("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+
+	assert.False(t, c.BlobAvailable("Camera", "CCD1", "CCD1"))
+
+	for _, b := range retained {
+		exists, _ := afero.Exists(c.fs, b.Value)
+		assert.False(t, exists)
+	}
+
+	retained, err = c.RetainedBlobs("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+	assert.Empty(t, retained)
+}
+
+func Test_ReleaseBlob_MissingValue(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+
+	assert.Equal(t, ErrPropertyValueNotFound, c.ReleaseBlob("Camera", "CCD1", "CCD2"))
+	assert.Equal(t, ErrDeviceNotFound, c.ReleaseBlob("Focuser", "CCD1", "CCD1"))
+}
+
+func Test_OnBlob(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+
+	events := make(chan BlobEvent, 10)
+
+	id, err := c.OnBlob("Camera", "CCD1", "", func(e BlobEvent) {
+		events <- e
+	})
+	require.NoError(t, err)
+
+	sendBlob(c, "one")
+	sendBlob(c, "two")
+
+	for _, expected := range []string{"one", "two"} {
+		select {
+		case e := <-events:
+			assert.Equal(t, "Camera", e.Device)
+			assert.Equal(t, "CCD1", e.Property)
+			assert.Equal(t, "CCD1", e.Name)
+			assert.Equal(t, "Camera_CCD1_CCD1.fits", e.FileName)
+			assert.Equal(t, ".fits", e.Format)
+			assert.Equal(t, int64(len(expected)), e.Size)
+			assert.False(t, e.Timestamp.IsZero())
+
+			b, _ := ioutil.ReadAll(e.Open())
+			assert.Equal(t, expected, string(b))
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for blob event")
+		}
+	}
+
+	require.NoError(t, c.RemoveBlobHandler(id))
+	assert.Equal(t, ErrSubscriptionNotFound, c.RemoveBlobHandler(id))
+
+	sendBlob(c, "three")
+
+	select {
+	case <-events:
+		t.Fatal("handler called after it was removed")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// pausingClock calls pause whenever the client reads the time.
+type pausingClock struct {
+	SystemClock
+	pause func()
+}
+
+func (c pausingClock) Now() time.Time {
+	c.pause()
+	return time.Now()
+}
+
+func Test_OnBlob_Published(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+
+	called := make(chan struct{})
+	available := make(chan bool, 1)
+
+	id, err := c.OnBlob("Camera", "CCD1", "", func(e BlobEvent) {
+		available <- c.BlobAvailable(e.Device, e.Property, e.Name)
+		close(called)
+	})
+	require.NoError(t, err)
+	defer c.RemoveBlobHandler(id)
+
+	// Reading the time for the vector's message gives the handler every chance to run before the device is
+	// published.
+	c.SetClock(pausingClock{pause: func() {
+		select {
+		case <-called:
+		case <-time.After(20 * time.Millisecond):
+		}
+	}})
+
+	c.rwm.Lock()
+	c.setBlobVector(&SetBlobVector{
+		Device:  "Camera",
+		Name:    "CCD1",
+		State:   PropertyStateOk,
+		Message: "Exposure done",
+		Blobs:   []OneBlob{{Name: "CCD1", Format: ".fits", Size: 5, Value: base64.StdEncoding.EncodeToString([]byte("frame"))}},
+	})
+	c.rwm.Unlock()
+
+	select {
+	case ok := <-available:
+		assert.True(t, ok, "the handler was called before the BLOB was published")
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for blob event")
+	}
+}
+
+func Test_OnBlobWithOptions_Bounded(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+
+	release := make(chan struct{})
+	events := make(chan BlobEvent, 10)
+
+	id, err := c.OnBlobWithOptions("Camera", "CCD1", "", func(e BlobEvent) {
+		<-release
+		events <- e
+	}, BlobHandlerOptions{Buffer: 1})
+	require.NoError(t, err)
+	defer c.RemoveBlobHandler(id)
+
+	// The first BLOB is taken by the handler, which blocks, so the next one fills the buffer, and the rest are dropped.
+	sendBlob(c, "one")
+	value, _ := c.blobHandlers.Load(id)
+	testutil.WaitFor(t, func() bool { return len(value.(*blobHandler).events) == 0 })
+
+	for _, data := range []string{"two", "three", "four"} {
+		sendBlob(c, data)
+	}
+
+	close(release)
+
+	for _, seq := range []uint64{1, 2} {
+		select {
+		case e := <-events:
+			assert.Equal(t, seq, e.Sequence)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for blob event")
+		}
+	}
+
+	// The gap in Sequence shows the BLOBs that were dropped.
+	sendBlob(c, "five")
+
+	select {
+	case e := <-events:
+		assert.Equal(t, uint64(5), e.Sequence)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for blob event")
+	}
+}
+
+func Test_OnBlob_PropertyWithoutDevice(t *testing.T) {
+	c := newTestClient()
+
+	_, err := c.OnBlob("", "CCD1", "", func(BlobEvent) {})
+	assert.Equal(t, ErrPropertyWithoutDevice, err)
+}
+
+func Test_blobPolicyFor(t *testing.T) {
+	policies := []BlobPolicy{
+		{Device: "Camera", Value: BlobEnableAlso},
+		{Device: "Camera", Property: "CCD2", Value: BlobEnableOnly},
+	}
+
+	assert.Equal(t, BlobEnableOnly, blobPolicyFor(policies, "Camera", "CCD2"))
+	assert.Equal(t, BlobEnableAlso, blobPolicyFor(policies, "Camera", "CCD1"))
+	assert.Equal(t, BlobEnableNever, blobPolicyFor(policies, "Guider", "CCD1"))
+}
+
+func Test_BlobSequence(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+
+	ts := "2026-10-15T01:02:03"
+
+	send := func(data, timestamp string) BlobValue {
+		c.setBlobVector(&SetBlobVector{
+			Device:    "Camera",
+			Name:      "CCD1",
+			State:     PropertyStateOk,
+			Timestamp: timestamp,
+			Blobs: []OneBlob{
+				{Name: "CCD1", Format: ".fits", Size: len(data), Value: base64.StdEncoding.EncodeToString([]byte(data))},
+			},
+		})
+
+		prop, err := c.GetBlobProperty("Camera", "CCD1")
+		require.NoError(t, err)
+		return prop.Values["CCD1"]
+	}
+
+	v := send("one", ts)
+	assert.Equal(t, uint64(1), v.Sequence)
+	assert.False(t, v.Duplicate)
+
+	// Same timestamp and size.
+	v = send("two", ts)
+	assert.Equal(t, uint64(2), v.Sequence)
+	assert.True(t, v.Duplicate)
+
+	v = send("three", ts)
+	assert.Equal(t, uint64(3), v.Sequence)
+	assert.False(t, v.Duplicate)
+
+	v = send("three", "2026-10-15T01:02:04")
+	assert.Equal(t, uint64(4), v.Sequence)
+	assert.False(t, v.Duplicate)
+}
+
+func Test_BlobStorage_Quota(t *testing.T) {
+	c := newTestClient()
+	c.SetBlobRetention(10)
+	c.SetBlobStorage(BlobStorageOptions{Quota: 10})
+	defineBlob(c)
+
+	sendBlob(c, "1111")
+	sendBlob(c, "2222")
+	assert.Equal(t, int64(8), c.BlobStorageUsed())
+
+	// The oldest file is pruned to make room.
+	sendBlob(c, "3333")
+	assert.Equal(t, int64(8), c.BlobStorageUsed())
+
+	exists, _ := afero.Exists(c.fs, "Camera_CCD1_CCD1_1.fits")
+	assert.False(t, exists)
+
+	retained, err := c.RetainedBlobs("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+	require.Len(t, retained, 2)
+	assert.Equal(t, "Camera_CCD1_CCD1_2.fits", retained[0].Value)
+	assert.Equal(t, "Camera_CCD1_CCD1_3.fits", retained[1].Value)
+
+	// Too big to ever fit, so it is delivered but not stored.
+	events := make(chan BlobEvent, 1)
+	id, err := c.OnBlob("Camera", "CCD1", "CCD1", func(e BlobEvent) { events <- e })
+	require.NoError(t, err)
+	defer c.RemoveBlobHandler(id)
+
+	sendBlob(c, "12345678901")
+
+	select {
+	case e := <-events:
+		assert.Empty(t, e.FileName)
+		assert.Equal(t, int64(11), e.Size)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for blob")
+	}
+
+	assert.False(t, c.BlobAvailable("Camera", "CCD1", "CCD1"))
+}
+
+func Test_BlobStorage_PrunePatternAndPreWrite(t *testing.T) {
+	c := newTestClient()
+	c.SetBlobRetention(10)
+	defineBlob(c)
+
+	sendBlob(c, "1111")
+
+	var writes []BlobWrite
+	c.SetBlobStorage(BlobStorageOptions{
+		Quota:        6,
+		PrunePattern: "*_2.fits",
+		PreWrite: func(w BlobWrite) error {
+			writes = append(writes, w)
+			if w.Used > 0 {
+				return assert.AnError
+			}
+			return nil
+		},
+	})
+
+	// The first file does not match the pattern, so cannot be pruned.
+	sendBlob(c, "2222")
+	assert.False(t, c.BlobAvailable("Camera", "CCD1", "CCD1"))
+	assert.Empty(t, writes)
+
+	sendBlob(c, "22")
+	require.Len(t, writes, 1)
+	assert.Equal(t, BlobWrite{Device: "Camera", Property: "CCD1", Name: "CCD1", FileName: "Camera_CCD1_CCD1_3.fits", Size: 2, Used: 4}, writes[0])
+	assert.False(t, c.BlobAvailable("Camera", "CCD1", "CCD1"))
+	assert.Equal(t, int64(4), c.BlobStorageUsed())
+}
+
+func Test_BlobNameTemplate(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+
+	c.defTextVector(&DefTextVector{
+		Device: "Camera",
+		Name:   "ACTIVE_DEVICES",
+		Perm:   PropertyPermissionReadWrite,
+		Texts:  []DefText{{Name: "ACTIVE_FILTER", Value: "Wheel"}},
+	})
+	c.defNumberVector(&DefNumberVector{
+		Device:  "Wheel",
+		Name:    "FILTER_SLOT",
+		Perm:    PropertyPermissionReadWrite,
+		Numbers: []DefNumber{{Name: "FILTER_SLOT_VALUE", Value: "2"}},
+	})
+	c.defTextVector(&DefTextVector{
+		Device: "Wheel",
+		Name:   "FILTER_NAME",
+		Perm:   PropertyPermissionReadWrite,
+		Texts:  []DefText{{Name: "FILTER_SLOT_NAME_1", Value: "Red"}, {Name: "FILTER_SLOT_NAME_2", Value: "Ha"}},
+	})
+
+	c.blobExposure["Camera"] = 300
+
+	assert.Error(t, c.SetBlobNameTemplate("{{.Device"))
+	require.NoError(t, c.SetBlobNameTemplate(`{{.Filter}}/{{.Device}}_{{printf "%gs" .Exposure}}_{{printf "%03d" .Sequence}}{{.Format}}`))
+
+	sendBlob(c, "one")
+	sendBlob(c, "two")
+
+	// With a retention of 1, the file of the previous BLOB is removed when the name changes.
+	exists, _ := afero.Exists(c.fs, "Ha/Camera_300s_001.fits")
+	assert.False(t, exists)
+
+	rdr, name, _, err := c.PeekBlob("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+	assert.Equal(t, "Camera_300s_002.fits", name)
+	rdr.Close()
+
+	exists, _ = afero.Exists(c.fs, "Ha/Camera_300s_002.fits")
+	assert.True(t, exists)
+
+	// A template that fails falls back to the default name.
+	require.NoError(t, c.SetBlobNameTemplate("{{.Missing}}"))
+	sendBlob(c, "three")
+
+	exists, _ = afero.Exists(c.fs, "Camera_CCD1_CCD1.fits")
+	assert.True(t, exists)
+
+	require.NoError(t, c.SetBlobNameTemplate(""))
+	sendBlob(c, "four")
+
+	rdr, name, _, err = c.PeekBlob("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+	assert.Equal(t, "Camera_CCD1_CCD1.fits", name)
+	rdr.Close()
+}
+
+func Test_BlobPermissions(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+
+	c.defBlobVector(&DefBlobVector{
+		Device: "Camera",
+		Name:   "UPLOAD",
+		State:  PropertyStateIdle,
+		Perm:   PropertyPermission(" WO "),
+		Blobs:  []DefBlob{{Name: "FILE"}},
+	})
+
+	c.defBlobVector(&DefBlobVector{
+		Device: "Camera",
+		Name:   "LEGACY",
+		State:  PropertyStateIdle,
+		Blobs:  []DefBlob{{Name: "FILE"}},
+	})
+
+	for name, perm := range map[string]PropertyPermission{
+		"CCD1":   PropertyPermissionReadOnly,
+		"UPLOAD": PropertyPermissionWriteOnly,
+		// A missing permission does not stop commands.
+		"LEGACY": PropertyPermissionReadWrite,
+	} {
+		prop, err := c.GetBlobProperty("Camera", name)
+		require.NoError(t, err)
+		assert.Equal(t, perm, prop.Permissions, name)
+	}
+
+	err := c.SetBlobValue("Camera", "CCD1", "CCD1", "data", ".txt", 4)
+	assert.True(t, errors.Is(err, ErrPropertyReadOnly))
+
+	_, err = c.DryRunBlobValue("Camera", "UPLOAD", "FILE", "data", ".txt", 4)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,318 @@
+package indiclient
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// DefaultBlobConnections is how many connections NewBlobConnPool opens by default.
+const DefaultBlobConnections = 2
+
+// ErrBlobConnPoolClosed is returned when a BlobConnPool is used after Close.
+var ErrBlobConnPoolClosed = errors.New("blob connection pool closed")
+
+// BlobConnPoolOptions configures NewBlobConnPool.
+type BlobConnPoolOptions struct {
+	// Connections is how many auxiliary connections to open. Zero means DefaultBlobConnections.
+	Connections int `json:"connections"`
+	// BufferSize is the size of each connection's message buffer. Zero means the client's buffer size.
+	BufferSize int `json:"bufferSize"`
+}
+
+// BlobConnStats describes one of the connections of a BlobConnPool.
+type BlobConnStats struct {
+	// Properties are the BLOB properties received on the connection. An empty Property means the whole device.
+	Properties []WatchedDevice `json:"properties"`
+	// BytesReceived is the size of the base64 encoded BLOBs received on the connection.
+	BytesReceived int64 `json:"bytesReceived"`
+	Connected     bool  `json:"connected"`
+}
+
+// BlobConnPool receives the BLOBs of a client over auxiliary connections to the same indiserver, each with enableBLOB
+// Only, for rigs with several cameras whose frames would otherwise queue up behind each other, and behind every other
+// message, on a single TCP stream.
+//
+// Each BLOB property added to the pool is assigned to the connection with the fewest properties, and BLOBs are turned
+// off for it on the client's own connection. BLOBs received by the pool are applied to the client as if it had
+// received them itself, so GetBlob, OnBlob, blob streams and CaptureFrame work as usual. The BLOBs of a property
+// always arrive on the same connection, in order.
+type BlobConnPool struct {
+	c     *INDIClient
+	conns []*blobConn
+
+	mu       sync.Mutex
+	assigned map[string]*blobConn // Keyed by blobStreamKey with an empty BLOB name.
+	restore  map[string]BlobEnable
+	closed   bool
+}
+
+// blobConn is a connection of a BlobConnPool.
+type blobConn struct {
+	client *INDIClient
+	props  []WatchedDevice // Protected by BlobConnPool.mu
+
+	mu       sync.Mutex
+	received int64
+}
+
+// NewBlobConnPool opens the auxiliary connections of a pool for c, to the address c last connected to, with c's
+// dialer. Add the BLOB properties that should use the pool, and remember to call Close when you are done.
+func NewBlobConnPool(c *INDIClient, opts BlobConnPoolOptions) (*BlobConnPool, error) {
+	if opts.Connections <= 0 {
+		opts.Connections = DefaultBlobConnections
+	}
+
+	p := c.Profile()
+	if len(p.Address) == 0 {
+		return nil, ErrInvalidAddress
+	}
+
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = p.BufferSize
+	}
+
+	c.rwm.RLock()
+	dialer := c.dialer
+	c.rwm.RUnlock()
+
+	pool := &BlobConnPool{
+		c:        c,
+		assigned: map[string]*blobConn{},
+		restore:  map[string]BlobEnable{},
+	}
+
+	for i := 0; i < opts.Connections; i++ {
+		// The connection never stores anything: its BLOBs are stored by c.
+		bc := &blobConn{client: NewINDIClient(c.log, dialer, afero.NewMemMapFs(), opts.BufferSize)}
+		bc.client.UseInbound(pool.intercept(bc))
+
+		if err := bc.client.Connect(p.Network, p.Address); err != nil {
+			pool.Close()
+			return nil, err
+		}
+
+		pool.conns = append(pool.conns, bc)
+	}
+
+	return pool, nil
+}
+
+// Add receives the BLOBs of propName on deviceName, or of every BLOB property of deviceName if propName is empty, on
+// the pool's least loaded connection. The device must be defined on the client.
+func (p *BlobConnPool) Add(deviceName, propName string) error {
+	deviceName = p.c.resolveDevice(deviceName)
+	key := blobStreamKey(deviceName, propName, "")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrBlobConnPoolClosed
+	}
+
+	if _, ok := p.assigned[key]; ok {
+		return nil
+	}
+
+	if _, err := p.c.GetDevice(deviceName); err != nil {
+		return err
+	}
+
+	bc := p.conns[0]
+	for _, conn := range p.conns[1:] {
+		if len(conn.props) < len(bc.props) {
+			bc = conn
+		}
+	}
+
+	if err := bc.client.GetProperties(deviceName, propName); err != nil {
+		return err
+	}
+
+	if err := bc.setPolicy(deviceName, propName, BlobEnableOnly); err != nil {
+		return err
+	}
+
+	// Turn BLOBs off on the client's own connection only once the pool's connection has asked for them, so none are
+	// missed in between.
+	bc.client.flush()
+
+	p.c.rwm.Lock()
+	prev := blobPolicyFor(p.c.blobPolicies, deviceName, propName)
+	p.c.blobPooled[key] = true
+	p.c.rwm.Unlock()
+
+	if err := p.c.EnableBlob(deviceName, propName, BlobEnableNever); err != nil {
+		p.c.rwm.Lock()
+		delete(p.c.blobPooled, key)
+		p.c.rwm.Unlock()
+
+		bc.setPolicy(deviceName, propName, BlobEnableNever)
+		return err
+	}
+
+	bc.props = append(bc.props, WatchedDevice{Device: deviceName, Property: propName})
+	p.assigned[key] = bc
+	p.restore[key] = prev
+
+	return nil
+}
+
+// Remove stops receiving the BLOBs of propName on deviceName on the pool, and restores the client's BLOB policy for
+// it.
+func (p *BlobConnPool) Remove(deviceName, propName string) error {
+	deviceName = p.c.resolveDevice(deviceName)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrBlobConnPoolClosed
+	}
+
+	return p.remove(deviceName, propName)
+}
+
+// remove is Remove without the checks. Only call when BlobConnPool.mu is locked.
+func (p *BlobConnPool) remove(deviceName, propName string) error {
+	key := blobStreamKey(deviceName, propName, "")
+
+	bc, ok := p.assigned[key]
+	if !ok {
+		return nil
+	}
+
+	delete(p.assigned, key)
+
+	for i, w := range bc.props {
+		if w.Device == deviceName && w.Property == propName {
+			bc.props = append(bc.props[:i:i], bc.props[i+1:]...)
+			break
+		}
+	}
+
+	p.c.rwm.Lock()
+	delete(p.c.blobPooled, key)
+	p.c.rwm.Unlock()
+
+	err := bc.setPolicy(deviceName, propName, BlobEnableNever)
+
+	if p.c.IsConnected() {
+		if restoreErr := p.c.EnableBlob(deviceName, propName, p.restore[key]); err == nil {
+			err = restoreErr
+		}
+	}
+
+	delete(p.restore, key)
+
+	return err
+}
+
+// Stats returns the state of each of the pool's connections.
+func (p *BlobConnPool) Stats() []BlobConnStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]BlobConnStats, len(p.conns))
+
+	for i, bc := range p.conns {
+		props := make([]WatchedDevice, len(bc.props))
+		for j, w := range bc.props {
+			props[j] = WatchedDevice{Device: p.c.aliasDevice(w.Device), Property: w.Property}
+		}
+
+		bc.mu.Lock()
+		received := bc.received
+		bc.mu.Unlock()
+
+		stats[i] = BlobConnStats{
+			Properties:    props,
+			BytesReceived: received,
+			Connected:     bc.client.IsConnected(),
+		}
+	}
+
+	return stats
+}
+
+// Close removes every property from the pool, restoring the client's BLOB policies, and disconnects the pool's
+// connections.
+func (p *BlobConnPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+
+	p.closed = true
+
+	var first error
+
+	for _, bc := range p.conns {
+		for len(bc.props) > 0 {
+			if err := p.remove(bc.props[0].Device, bc.props[0].Property); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+
+	for _, bc := range p.conns {
+		if err := bc.client.Disconnect(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// intercept applies the BLOBs bc receives to the pool's client, and drops every other message, such as the
+// definitions sent before enableBLOB took effect.
+func (p *BlobConnPool) intercept(bc *blobConn) Interceptor {
+	return func(next Handler) Handler {
+		return func(msg interface{}) {
+			item, ok := msg.(*SetBlobVector)
+			if !ok {
+				return
+			}
+
+			var n int64
+			for _, b := range item.Blobs {
+				n += int64(len(b.Value))
+			}
+
+			bc.mu.Lock()
+			bc.received += n
+			bc.mu.Unlock()
+
+			p.c.receiveBlobVector(item)
+		}
+	}
+}
+
+// setPolicy changes the BLOB policy of the connection for propName on deviceName.
+func (bc *blobConn) setPolicy(deviceName, propName string, value BlobEnable) error {
+	policies := bc.client.Profile().BlobPolicies
+
+	return bc.client.SetBlobPolicies(addBlobPolicy(policies, BlobPolicy{Device: deviceName, Property: propName, Value: value}))
+}
+
+// receiveBlobVector applies a setBLOBVector received on another connection, such as one of a BlobConnPool's.
+func (c *INDIClient) receiveBlobVector(item *SetBlobVector) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	if !c.filterInterest(item) {
+		return
+	}
+
+	c.setBlobVector(item)
+}
+
+// blobPooledFor returns true if the BLOBs of propName on deviceName are received by a BlobConnPool. Only call when
+// INDIClient.rwm is at least reader locked.
+func (c *INDIClient) blobPooledFor(deviceName, propName string) bool {
+	return c.blobPooled[blobStreamKey(deviceName, propName, "")] || c.blobPooled[blobStreamKey(deviceName, "", "")]
+}
@@ -0,0 +1,139 @@
+package indiclient_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+// connectCameras connects a client to simulated cameras with the given names, and waits for their CCD1 properties.
+func connectCameras(t *testing.T, names ...string) *indiclient.INDIClient {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+
+	var devices []simulators.Device
+	for _, name := range names {
+		devices = append(devices, simulators.NewCCD(name))
+	}
+
+	c := indiclient.NewINDIClient(log, simulators.NewServer(devices...), afero.NewMemMapFs(), 100)
+
+	_, err := indiclient.NewBlobConnPool(c, indiclient.BlobConnPoolOptions{})
+	assert.Equal(t, indiclient.ErrInvalidAddress, err, "the client has not connected yet")
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	require.NoError(t, c.GetProperties("", ""))
+
+	for _, name := range names {
+		name := name
+		testutil.WaitFor(t, func() bool { return c.SwitchPropertySet(name, "CONNECTION") })
+		require.NoError(t, c.SetSwitchValue(name, "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn}))
+		testutil.WaitFor(t, func() bool { return c.BlobPropertySet(name, "CCD1") })
+	}
+
+	return c
+}
+
+func Test_BlobConnPool(t *testing.T) {
+	c := connectCameras(t, "Main Camera", "Guide Camera")
+	defer c.Disconnect()
+
+	require.NoError(t, c.EnableBlob("Guide Camera", "", indiclient.BlobEnableAlso))
+
+	pool, err := indiclient.NewBlobConnPool(c, indiclient.BlobConnPoolOptions{})
+	require.NoError(t, err)
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	require.NoError(t, pool.Add("Main Camera", ""))
+	require.NoError(t, pool.Add("Guide Camera", ""))
+	assert.Equal(t, indiclient.ErrDeviceNotFound, pool.Add("Missing Camera", ""))
+
+	// Each camera has a connection of its own.
+	stats := pool.Stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, []indiclient.WatchedDevice{{Device: "Main Camera"}}, stats[0].Properties)
+	assert.Equal(t, []indiclient.WatchedDevice{{Device: "Guide Camera"}}, stats[1].Properties)
+	assert.True(t, stats[0].Connected)
+
+	assert.Equal(t, []indiclient.BlobPolicy{
+		{Device: "Guide Camera", Value: indiclient.BlobEnableNever},
+		{Device: "Main Camera", Value: indiclient.BlobEnableNever},
+	}, c.Profile().BlobPolicies)
+
+	// Frames received by the pool are applied to the client. CaptureFrame does not enable BLOBs on the client again.
+	for _, name := range []string{"Main Camera", "Guide Camera"} {
+		e, err := c.CaptureFrame(ctx, name, 0.01)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), e.Sequence)
+		assert.True(t, c.BlobAvailable(name, "CCD1", "CCD1"))
+	}
+
+	stats = pool.Stats()
+	assert.Greater(t, stats[0].BytesReceived, int64(0))
+	assert.Greater(t, stats[1].BytesReceived, int64(0))
+
+	require.NoError(t, pool.Remove("Guide Camera", ""))
+	assert.Empty(t, pool.Stats()[1].Properties)
+
+	// The client's policy is restored.
+	assert.Equal(t, []indiclient.BlobPolicy{
+		{Device: "Guide Camera", Value: indiclient.BlobEnableAlso},
+		{Device: "Main Camera", Value: indiclient.BlobEnableNever},
+	}, c.Profile().BlobPolicies)
+
+	e, err := c.CaptureFrame(ctx, "Guide Camera", 0.01)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), e.Sequence)
+
+	require.NoError(t, pool.Close())
+	assert.False(t, pool.Stats()[0].Connected)
+	assert.Equal(t, indiclient.ErrBlobConnPoolClosed, pool.Add("Main Camera", ""))
+
+	assert.Equal(t, []indiclient.BlobPolicy{
+		{Device: "Guide Camera", Value: indiclient.BlobEnableAlso},
+		{Device: "Main Camera", Value: indiclient.BlobEnableNever},
+	}, c.Profile().BlobPolicies)
+}
+
+func Test_BlobConnPool_CloseWhileReceiving(t *testing.T) {
+	c := connectCameras(t, "Main Camera")
+	defer c.Disconnect()
+
+	pool, err := indiclient.NewBlobConnPool(c, indiclient.BlobConnPoolOptions{Connections: 1})
+	require.NoError(t, err)
+
+	require.NoError(t, pool.Add("Main Camera", ""))
+
+	// Keep frames arriving on the pool's connection while it is closed.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exposing := make(chan struct{})
+	go func() {
+		defer close(exposing)
+
+		for ctx.Err() == nil {
+			c.SetNumberValue("Main Camera", "CCD_EXPOSURE", []string{"CCD_EXPOSURE_VALUE"}, []string{"0.001"})
+		}
+	}()
+
+	testutil.WaitFor(t, func() bool { return pool.Stats()[0].BytesReceived > 0 })
+
+	require.NoError(t, pool.Close())
+	assert.False(t, pool.Stats()[0].Connected)
+
+	cancel()
+	<-exposing
+}
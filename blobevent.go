@@ -0,0 +1,193 @@
+package indiclient
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BlobEvent describes a single BLOB received from indiserver.
+type BlobEvent struct {
+	Device    string    `json:"device"`
+	Property  string    `json:"property"`
+	Name      string    `json:"name"`
+	FileName  string    `json:"fileName"`
+	Size      int64     `json:"size"`
+	Format    string    `json:"format"`
+	Timestamp time.Time `json:"timestamp"`
+	// Sequence and Duplicate are as in BlobValue. A gap in Sequence means BLOBs were received that this handler did
+	// not see.
+	Sequence  uint64 `json:"sequence"`
+	Duplicate bool   `json:"duplicate"`
+
+	data     []byte
+	analysis *blobAnalysis
+	preview  *blobPreview
+}
+
+// Open returns a reader for the contents of the BLOB. Unlike reading FileName, this is safe even after newer BLOBs
+// have overwritten the file.
+func (e BlobEvent) Open() io.ReadCloser {
+	return ioutil.NopCloser(bytes.NewReader(e.data))
+}
+
+// BlobHandlerOptions controls buffering for a handler registered with OnBlobWithOptions.
+type BlobHandlerOptions struct {
+	// Buffer is the number of BLOBs that can be queued for the handler. Defaults to the client's bufferSize.
+	Buffer int
+	// Policy decides what to do when the buffer is full. Defaults to BlobStreamPolicyDrop.
+	Policy BlobStreamPolicy
+	// Timeout is how long BlobStreamPolicyWait waits for room in the buffer.
+	Timeout time.Duration
+}
+
+// blobHandler runs the function registered with OnBlob on its own goroutine, queueing events so that the client never
+// waits on it for longer than its policy allows. Each queued event holds a copy of its BLOB, so the queue is bounded:
+// a handler that falls behind loses BLOBs rather than growing the client's memory without limit.
+type blobHandler struct {
+	device, prop, name string
+	fn                 func(BlobEvent)
+	opts               BlobHandlerOptions
+
+	events  chan BlobEvent
+	done    chan struct{}
+	once    sync.Once
+	dropped uint64
+}
+
+func (h *blobHandler) matches(e BlobEvent) bool {
+	return (len(h.device) == 0 || h.device == e.Device) &&
+		(len(h.prop) == 0 || h.prop == e.Property) &&
+		(len(h.name) == 0 || h.name == e.Name)
+}
+
+// push queues e for the handler, applying its policy if the buffer is full. It returns false if e was dropped.
+func (h *blobHandler) push(e BlobEvent) bool {
+	select {
+	case h.events <- e:
+		return true
+	case <-h.done:
+		return false
+	default:
+	}
+
+	if h.opts.Policy == BlobStreamPolicyWait && h.opts.Timeout > 0 {
+		t := time.NewTimer(h.opts.Timeout)
+		defer t.Stop()
+
+		select {
+		case h.events <- e:
+			return true
+		case <-h.done:
+			return false
+		case <-t.C:
+		}
+	}
+
+	atomic.AddUint64(&h.dropped, 1)
+
+	return false
+}
+
+func (h *blobHandler) run() {
+	for {
+		select {
+		case <-h.done:
+			return
+		case e := <-h.events:
+			// Both may be ready: do not call fn once the handler is removed.
+			select {
+			case <-h.done:
+				return
+			default:
+			}
+
+			h.fn(e)
+		}
+	}
+}
+
+func (h *blobHandler) close() {
+	h.once.Do(func() { close(h.done) })
+}
+
+// OnBlob registers fn to be called for every BLOB received for the given deviceName, propName, blobName. Any of the
+// names may be empty to match all devices, properties or BLOBs, but propName requires deviceName. fn is called on its
+// own goroutine, one BLOB at a time, in the order they were received. BLOBs are queued for fn with the default
+// BlobHandlerOptions: if fn falls behind by more than the client's bufferSize BLOBs, new ones are dropped, which
+// shows as a gap in BlobEvent.Sequence. Remember to call RemoveBlobHandler with the returned id when you are done.
+func (c *INDIClient) OnBlob(deviceName, propName, blobName string, fn func(BlobEvent)) (id string, err error) {
+	return c.OnBlobWithOptions(deviceName, propName, blobName, fn, BlobHandlerOptions{})
+}
+
+// OnBlobWithOptions is like OnBlob, but allows control over how BLOBs are buffered for fn. Once its buffer is full,
+// opts.Policy decides whether new BLOBs are dropped; with BlobStreamPolicyWait, property processing is paused while
+// waiting, so keep the timeout short.
+func (c *INDIClient) OnBlobWithOptions(deviceName, propName, blobName string, fn func(BlobEvent), opts BlobHandlerOptions) (id string, err error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	if len(propName) > 0 && len(deviceName) == 0 {
+		err = ErrPropertyWithoutDevice
+		return
+	}
+
+	if opts.Buffer <= 0 {
+		opts.Buffer = c.bufferSize
+	}
+
+	if len(opts.Policy) == 0 {
+		opts.Policy = BlobStreamPolicyDrop
+	}
+
+	h := &blobHandler{
+		device: deviceName,
+		prop:   propName,
+		name:   blobName,
+		fn:     fn,
+		opts:   opts,
+		events: make(chan BlobEvent, opts.Buffer),
+		done:   make(chan struct{}),
+	}
+
+	id = uuid.New().String()
+
+	c.blobHandlers.Store(id, h)
+
+	go h.run()
+
+	return
+}
+
+// RemoveBlobHandler stops calling the function registered with OnBlob. BLOBs that have not been handled yet are
+// discarded.
+func (c *INDIClient) RemoveBlobHandler(id string) error {
+	h, ok := c.blobHandlers.Load(id)
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+
+	c.blobHandlers.Delete(id)
+
+	h.(*blobHandler).close()
+
+	return nil
+}
+
+// notifyBlob queues e for all matching handlers registered with OnBlob.
+func (c *INDIClient) notifyBlob(e BlobEvent) {
+	published := e
+	published.Device = c.aliasDevice(e.Device)
+
+	c.blobHandlers.Range(func(key, value interface{}) bool {
+		h := value.(*blobHandler)
+		if h.matches(e) && !h.push(published) {
+			c.log.WithField("handler", key).WithField("dropped", atomic.LoadUint64(&h.dropped)).Warn("blob handler buffer full, dropping blob")
+		}
+		return true
+	})
+}
@@ -0,0 +1,177 @@
+package indiclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPClient fetches BLOBs sent as URLs. *http.Client implements it.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// BlobFetchOptions controls how BLOBs sent as URLs, rather than inline, are fetched. A oneBLOB is sent as a URL if it
+// has a path attribute, as INDIGO sends when asked for BlobEnableURL, or if its text is an http or https URL instead
+// of base64. Paths are fetched from the host and port the client connected to.
+type BlobFetchOptions struct {
+	// Client fetches the BLOBs. nil uses http.DefaultClient.
+	Client HTTPClient
+	// Retries is how many more times a fetch that failed with a network error or a 5xx status is tried.
+	Retries int
+	// RetryDelay is how long to wait before the first retry. It doubles before each retry after that.
+	RetryDelay time.Duration
+}
+
+// DefaultBlobFetchOptions are the options used by NewINDIClient. Use SetBlobFetch to change them.
+var DefaultBlobFetchOptions = BlobFetchOptions{
+	Retries:    2,
+	RetryDelay: 500 * time.Millisecond,
+}
+
+// SetBlobFetch sets how BLOBs sent as URLs are fetched. Fetched BLOBs are stored and delivered to GetBlob, BLOB
+// streams and OnBlob handlers like those sent inline, and count against SetBlobBandwidth.
+func (c *INDIClient) SetBlobFetch(opts BlobFetchOptions) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.blobFetch = opts
+}
+
+// BlobFetch returns the options set with SetBlobFetch.
+func (c *INDIClient) BlobFetch() BlobFetchOptions {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.blobFetch
+}
+
+// blobURL returns the URL val was sent as, or an empty string if it was sent inline.
+func blobURL(val OneBlob, network, address string) (string, error) {
+	if len(val.Path) == 0 {
+		value := strings.TrimSpace(val.Value)
+		if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+			return value, nil
+		}
+
+		return "", nil
+	}
+
+	if strings.HasPrefix(val.Path, "http://") || strings.HasPrefix(val.Path, "https://") {
+		return val.Path, nil
+	}
+
+	if !strings.HasPrefix(network, "tcp") {
+		return "", fmt.Errorf("cannot fetch BLOB over %s", network)
+	}
+
+	return "http://" + address + "/" + strings.TrimPrefix(val.Path, "/"), nil
+}
+
+// fetchBlobURLs downloads the BLOBs in item that were sent as URLs. BLOBs that cannot be fetched are logged and
+// removed from item. It is called before item is dispatched, so the client is not locked while waiting for the
+// server.
+func (c *INDIClient) fetchBlobURLs(item *SetBlobVector) {
+	c.rwm.RLock()
+	opts := c.blobFetch
+	network, address := c.network, c.address
+	c.rwm.RUnlock()
+
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	blobs := item.Blobs[:0]
+
+	for _, val := range item.Blobs {
+		url, err := blobURL(val, network, address)
+		if err == nil && len(url) == 0 {
+			blobs = append(blobs, val)
+			continue
+		}
+
+		if err == nil {
+			val.data, err = c.fetchBlob(opts, url)
+		}
+		if err != nil {
+			c.log.WithField("device", item.Device).WithField("property", item.Name).WithField("blob", val.Name).WithError(err).Warn("error fetching BLOB")
+			continue
+		}
+
+		blobs = append(blobs, val)
+	}
+
+	item.Blobs = blobs
+}
+
+// fetchBlob gets url, retrying as opts allows.
+func (c *INDIClient) fetchBlob(opts BlobFetchOptions, url string) ([]byte, error) {
+	delay := opts.RetryDelay
+
+	for attempt := 0; ; attempt++ {
+		data, retry, err := c.getBlob(opts.Client, url)
+		if err == nil || !retry || attempt >= opts.Retries {
+			return data, err
+		}
+
+		c.log.WithField("url", url).WithError(err).Info("retrying BLOB fetch")
+
+		<-c.Clock().After(delay)
+		delay *= 2
+	}
+}
+
+// getBlob gets url once. retry is true if the error may not happen again.
+func (c *INDIClient) getBlob(client HTTPClient, url string) (data []byte, retry bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode >= 500, fmt.Errorf("fetching BLOB: %s", resp.Status)
+	}
+
+	var buf bytes.Buffer
+	if resp.ContentLength > 0 {
+		buf.Grow(int(resp.ContentLength))
+	}
+
+	// Downloads count against SetBlobBandwidth, like BLOBs sent inline.
+	chunk := make([]byte, blobRateChunk)
+	for {
+		n, err := resp.Body.Read(chunk)
+		buf.Write(chunk[:n])
+		c.blobLimiter.wait(n)
+
+		if err == io.EOF {
+			if buf.Len() == 0 {
+				// Not nil, so an empty BLOB is not mistaken for one sent inline.
+				return []byte{}, false, nil
+			}
+			return buf.Bytes(), false, nil
+		}
+		if err != nil {
+			return nil, true, err
+		}
+	}
+}
+
+// blobData returns the data of val, fetched or decoded from base64 in chunks of chunkSize bytes. Release it with
+// releaseBlobBuffer.
+func blobData(val OneBlob, chunkSize int) (*[]byte, error) {
+	if val.data != nil {
+		return &val.data, nil
+	}
+
+	return decodeBlobChunks(val.Value, chunkSize)
+}
@@ -0,0 +1,84 @@
+package indiclient
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FetchBlob(t *testing.T) {
+	failures := 1
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/blob/0x1.fits":
+			w.Write([]byte("SIMPLE  =                    T"))
+		case "/flaky.fits":
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("flaky"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient()
+	defineBlob(c)
+
+	c.network = "tcp"
+	c.address = strings.TrimPrefix(server.URL, "http://")
+
+	c.SetBlobFetch(BlobFetchOptions{Client: server.Client(), Retries: 1, RetryDelay: time.Millisecond})
+
+	readBlob := func() string {
+		rdr, _, length, err := c.GetBlob("Camera", "CCD1", "CCD1")
+		require.NoError(t, err)
+		defer rdr.Close()
+
+		data, err := ioutil.ReadAll(rdr)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(data)), length)
+
+		return string(data)
+	}
+
+	// A path, as INDIGO sends.
+	item := &SetBlobVector{
+		Device: "Camera",
+		Name:   "CCD1",
+		State:  PropertyStateOk,
+		Blobs:  []OneBlob{{Name: "CCD1", Format: ".fits", Path: "/blob/0x1.fits"}},
+	}
+
+	c.fetchBlobURLs(item)
+	c.setBlobVector(item)
+	assert.Equal(t, "SIMPLE  =                    T", readBlob())
+
+	// A URL instead of base64, retried after a server error.
+	item.Blobs = []OneBlob{{Name: "CCD1", Format: ".fits", Value: "\n" + server.URL + "/flaky.fits\n"}}
+
+	c.fetchBlobURLs(item)
+	c.setBlobVector(item)
+	assert.Equal(t, "flaky", readBlob())
+	assert.Equal(t, 0, failures)
+
+	// Inline BLOBs are left alone.
+	sendBlob(c, "inline")
+	assert.Equal(t, "inline", readBlob())
+
+	// A BLOB that cannot be fetched is dropped, rather than stored empty.
+	item.Blobs = []OneBlob{{Name: "CCD1", Format: ".fits", Path: "/blob/0x2.fits"}}
+
+	c.fetchBlobURLs(item)
+	assert.Empty(t, item.Blobs)
+}
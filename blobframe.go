@@ -0,0 +1,79 @@
+package indiclient
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrBlobFrameHeader is returned by ReadBlobFrame when the stream is not at the start of a frame.
+var ErrBlobFrameHeader = errors.New("invalid blob frame header")
+
+// blobFrameMagic starts the header of every frame in a framed BLOB stream.
+const blobFrameMagic = "INDB"
+
+// blobFrameHeaderSize is the size of a frame header, without the format. It holds the magic, then the size of the
+// data, the sequence, the timestamp in nanoseconds since the Unix epoch, and the length of the format, all big endian.
+const blobFrameHeaderSize = 4 + 8 + 8 + 8 + 2
+
+// BlobFrame is a single BLOB read from a framed stream by ReadBlobFrame.
+type BlobFrame struct {
+	// Sequence is as in BlobValue. A gap in Sequence means BLOBs were dropped because the reader fell behind.
+	Sequence  uint64    `json:"sequence"`
+	Format    string    `json:"format"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      []byte    `json:"-"`
+}
+
+// ReadBlobFrame reads the next frame from r, a stream opened with BlobStreamOptions.Framed. It returns io.EOF if the
+// stream ends between frames, io.ErrUnexpectedEOF if it ends within one, or the error the stream was closed with.
+func ReadBlobFrame(r io.Reader) (BlobFrame, error) {
+	header := make([]byte, blobFrameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return BlobFrame{}, err
+	}
+
+	if string(header[:4]) != blobFrameMagic {
+		return BlobFrame{}, ErrBlobFrameHeader
+	}
+
+	size := binary.BigEndian.Uint64(header[4:])
+	f := BlobFrame{
+		Sequence:  binary.BigEndian.Uint64(header[12:]),
+		Timestamp: time.Unix(0, int64(binary.BigEndian.Uint64(header[20:]))).UTC(),
+	}
+
+	format := make([]byte, binary.BigEndian.Uint16(header[28:]))
+	f.Data = make([]byte, size)
+
+	for _, b := range [][]byte{format, f.Data} {
+		if _, err := io.ReadFull(r, b); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return BlobFrame{}, err
+		}
+	}
+
+	f.Format = string(format)
+
+	return f, nil
+}
+
+// header returns the header written before f in a framed stream.
+func (f BlobFrame) header() []byte {
+	format := f.Format
+	if len(format) > 0xffff {
+		format = format[:0xffff]
+	}
+
+	b := make([]byte, blobFrameHeaderSize, blobFrameHeaderSize+len(format))
+	copy(b, blobFrameMagic)
+	binary.BigEndian.PutUint64(b[4:], uint64(len(f.Data)))
+	binary.BigEndian.PutUint64(b[12:], f.Sequence)
+	binary.BigEndian.PutUint64(b[20:], uint64(f.Timestamp.UnixNano()))
+	binary.BigEndian.PutUint16(b[28:], uint16(len(format)))
+
+	return append(b, format...)
+}
@@ -0,0 +1,136 @@
+package indiclient
+
+import (
+	"bytes"
+	"errors"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// errMappingUnsupported is returned by mapFile on platforms without mmap.
+var errMappingUnsupported = errors.New("memory mapping is not supported on this platform")
+
+// BlobMappingOptions controls whether GetBlob and PeekBlob return memory-mapped readers. See SetBlobMapping.
+type BlobMappingOptions struct {
+	// Enabled turns memory mapping on.
+	Enabled bool `json:"enabled"`
+	// MinSize is the smallest BLOB, in bytes, that is mapped. Smaller BLOBs are read from their file as usual.
+	MinSize int64 `json:"minSize"`
+}
+
+// SetBlobMapping sets whether BLOBs are read through memory-mapped files, for very large frames on machines with
+// little memory. When enabled, GetBlob and PeekBlob return a *MappedBlob, whose contents are paged in from the file by
+// the kernel as they are read, and can be shared with other processes reading the same file, instead of being copied
+// through buffers.
+//
+// Mapping needs BLOBs to be stored on the operating system's file system, i.e. an afero.OsFs, optionally under an
+// afero.BasePathFs, on a platform with mmap. Otherwise the BLOB's file is returned as usual.
+//
+// While mapping is enabled, BLOBs are written to a temporary file that is renamed over the previous one, so a BLOB
+// that is still mapped is never truncated by the next one.
+func (c *INDIClient) SetBlobMapping(opts BlobMappingOptions) {
+	if opts.MinSize < 0 {
+		opts.MinSize = 0
+	}
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.blobMapping = opts
+}
+
+// BlobMapping returns the BLOB mapping options. See SetBlobMapping.
+func (c *INDIClient) BlobMapping() BlobMappingOptions {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.blobMapping
+}
+
+// MappedBlob is a BLOB read through a memory-mapped file. It implements io.ReadCloser, io.ReaderAt and io.Seeker.
+type MappedBlob struct {
+	*bytes.Reader
+
+	data  []byte
+	unmap func([]byte) error
+}
+
+// Bytes returns the contents of the BLOB without copying them, e.g. to decode a frame in place. The slice is read
+// only, and must not be used after Close.
+func (m *MappedBlob) Bytes() []byte {
+	return m.data
+}
+
+// Close unmaps the BLOB.
+func (m *MappedBlob) Close() error {
+	if m.data == nil {
+		return nil
+	}
+
+	data := m.data
+	m.data = nil
+	m.Reader.Reset(nil)
+
+	return m.unmap(data)
+}
+
+// mapBlob returns a MappedBlob of the first size bytes of f, closing f, if f is a file on the operating system's file
+// system. Otherwise it returns false, and f is left open.
+func (c *INDIClient) mapBlob(f afero.File, size int64) (*MappedBlob, bool) {
+	osFile, ok := f.(*os.File)
+	if bp, isBasePath := f.(*afero.BasePathFile); isBasePath {
+		osFile, ok = bp.File.(*os.File)
+	}
+
+	if !ok {
+		return nil, false
+	}
+
+	data, unmap, err := mapFile(osFile, size)
+	if err != nil {
+		c.log.WithField("file", f.Name()).WithError(err).Debug("blob not mapped")
+		return nil, false
+	}
+
+	// The mapping stays valid once the file is closed.
+	f.Close()
+
+	return &MappedBlob{
+		Reader: bytes.NewReader(data),
+		data:   data,
+		unmap:  unmap,
+	}, true
+}
+
+// writeBlobFile writes data to fname. If replace is true, it writes a temporary file and renames it to fname, so
+// readers that still have the previous file open or mapped keep seeing its contents. Returns the name of the file.
+func (c *INDIClient) writeBlobFile(fname string, data []byte, replace bool) (string, error) {
+	name := fname
+	if replace {
+		name = fname + ".part"
+	}
+
+	f, err := c.fs.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return "", err
+	}
+
+	written := f.Name()
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil || !replace {
+		return written, err
+	}
+
+	if err := c.fs.Rename(name, fname); err != nil {
+		c.fs.Remove(name)
+		return "", err
+	}
+
+	return written[:len(written)-len(".part")], nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package indiclient
+
+import "os"
+
+// mapFile is not supported on this platform, so BLOBs are always read from their files.
+func mapFile(f *os.File, size int64) ([]byte, func([]byte) error, error) {
+	return nil, nil, errMappingUnsupported
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package indiclient
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the first size bytes of f read only, and returns them with the function that unmaps them.
+func mapFile(f *os.File, size int64) ([]byte, func([]byte) error, error) {
+	if size <= 0 || int64(int(size)) != size {
+		return nil, nil, syscall.EINVAL
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, syscall.Munmap, nil
+}
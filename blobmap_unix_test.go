@@ -0,0 +1,92 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package indiclient
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BlobMapping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "indiclient")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelInfo)
+	c := NewINDIClient(log, nil, afero.NewBasePathFs(afero.NewOsFs(), dir), 100)
+	c.SetBlobMapping(BlobMappingOptions{Enabled: true, MinSize: 5})
+	assert.Equal(t, BlobMappingOptions{Enabled: true, MinSize: 5}, c.BlobMapping())
+
+	defineBlob(c)
+	sendBlob(c, "1234567890")
+
+	rdr, name, size, err := c.PeekBlob("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+	assert.Equal(t, "Camera_CCD1_CCD1.fits", name)
+	assert.Equal(t, int64(10), size)
+
+	m, ok := rdr.(*MappedBlob)
+	require.True(t, ok, "expected a mapped reader, got %T", rdr)
+	assert.Equal(t, "1234567890", string(m.Bytes()))
+
+	b := make([]byte, 3)
+	_, err = m.ReadAt(b, 4)
+	require.NoError(t, err)
+	assert.Equal(t, "567", string(b))
+
+	// The next BLOB replaces the file without changing the mapped one.
+	sendBlob(c, "abcdefghij")
+	assert.Equal(t, "1234567890", string(m.Bytes()))
+
+	all, err := ioutil.ReadAll(m)
+	require.NoError(t, err)
+	assert.Equal(t, "1234567890", string(all))
+	require.NoError(t, m.Close())
+	assert.Nil(t, m.Bytes())
+	assert.NoError(t, m.Close())
+
+	rdr, _, _, err = c.GetBlob("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+	all, err = ioutil.ReadAll(rdr)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefghij", string(all))
+	rdr.Close()
+
+	exists, err := afero.Exists(afero.NewOsFs(), dir+"/Camera_CCD1_CCD1.fits.part")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// BLOBs smaller than MinSize are read from their file.
+	sendBlob(c, "1234")
+	rdr, _, _, err = c.PeekBlob("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+	_, ok = rdr.(*MappedBlob)
+	assert.False(t, ok)
+	rdr.Close()
+}
+
+func Test_BlobMapping_NotOsFs(t *testing.T) {
+	c := newTestClient()
+	c.SetBlobMapping(BlobMappingOptions{Enabled: true})
+
+	defineBlob(c)
+	sendBlob(c, "1234567890")
+
+	rdr, _, _, err := c.PeekBlob("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	_, ok := rdr.(*MappedBlob)
+	assert.False(t, ok)
+
+	b, err := ioutil.ReadAll(rdr)
+	require.NoError(t, err)
+	assert.Equal(t, "1234567890", string(b))
+}
@@ -0,0 +1,122 @@
+package indiclient
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// BlobNameData is what a template set with SetBlobNameTemplate is executed with to name the file of a BLOB.
+type BlobNameData struct {
+	Device   string
+	Property string
+	Element  string
+	// Format is the format of the BLOB, usually a file extension such as ".fits".
+	Format    string
+	Timestamp time.Time
+	// Sequence is as in BlobValue.
+	Sequence uint64
+	// Filter is the name of the filter selected in the filter wheel the camera names in ACTIVE_DEVICES, or empty if
+	// there is none.
+	Filter string
+	// Exposure is the last exposure time, in seconds, sent to the device's CCD_EXPOSURE, or zero if there was none.
+	Exposure float64
+}
+
+// SetBlobNameTemplate sets the text/template used to name BLOB files, executed with a BlobNameData. For example,
+//
+//	{{.Device}}/{{.Filter}}/{{.Timestamp.Format "20060102-150405"}}_{{printf "%gs" .Exposure}}_{{printf "%04d" .Sequence}}{{.Format}}
+//
+// Directories in the name are created as needed. Names should be unique if more than one BLOB is retained, or
+// retained files overwrite each other; see SetBlobRetention. An empty text restores the default name of device,
+// property and element, with the sequence number when more than one BLOB is retained. If the template fails for a
+// BLOB, the default name is used.
+func (c *INDIClient) SetBlobNameTemplate(text string) error {
+	var tmpl *template.Template
+
+	if len(text) > 0 {
+		var err error
+
+		tmpl, err = template.New("blob").Parse(text)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.blobNameTemplate = tmpl
+
+	return nil
+}
+
+// blobFileName returns the name of the file val is stored in. Reads INDIClient.devices. Only call when
+// INDIClient.rwm is at least reader locked.
+func (c *INDIClient) blobFileName(deviceName, propName string, val BlobValue) string {
+	fname := fmt.Sprintf("%s_%s_%s%s", deviceName, propName, val.Name, val.Format)
+	if c.blobRetention > 1 {
+		fname = fmt.Sprintf("%s_%s_%s_%d%s", deviceName, propName, val.Name, val.Sequence, val.Format)
+	}
+
+	if c.blobNameTemplate == nil {
+		return fname
+	}
+
+	data := BlobNameData{
+		Device:    c.aliasDevice(deviceName),
+		Property:  propName,
+		Element:   val.Name,
+		Format:    val.Format,
+		Timestamp: val.Timestamp,
+		Sequence:  val.Sequence,
+		Filter:    c.activeFilter(deviceName),
+		Exposure:  c.blobExposure[deviceName],
+	}
+
+	buf := &bytes.Buffer{}
+
+	if err := c.blobNameTemplate.Execute(buf, data); err != nil || buf.Len() == 0 {
+		c.log.WithField("file", fname).WithError(err).Warn("error in blob name template, using default name")
+		return fname
+	}
+
+	return buf.String()
+}
+
+// activeFilter returns the name of the filter selected in the filter wheel deviceName names in ACTIVE_DEVICES.
+// Reads INDIClient.devices. Only call when INDIClient.rwm is at least reader locked.
+func (c *INDIClient) activeFilter(deviceName string) string {
+	device, err := c.findDevice(deviceName)
+	if err != nil {
+		return ""
+	}
+
+	active, ok := device.TextProperties["ACTIVE_DEVICES"]
+	if !ok {
+		return ""
+	}
+
+	wheel, err := c.findDevice(active.Values["ACTIVE_FILTER"].Value)
+	if err != nil {
+		return ""
+	}
+
+	slot, ok := wheel.NumberProperties["FILTER_SLOT"]
+	if !ok {
+		return ""
+	}
+
+	n, err := ParseNumber(slot.Values["FILTER_SLOT_VALUE"].Value)
+	if err != nil {
+		return ""
+	}
+
+	names, ok := wheel.TextProperties["FILTER_NAME"]
+	if !ok || n < 1 || int(n) > len(names.Order) {
+		return ""
+	}
+
+	return names.Values[names.Order[int(n)-1]].Value
+}
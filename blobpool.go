@@ -0,0 +1,115 @@
+package indiclient
+
+import (
+	"encoding/base64"
+	"strings"
+	"sync"
+)
+
+// DefaultBlobCopyBufferSize is the default size in bytes of the chunks BLOBs are decoded in. See
+// SetBlobCopyBufferSize.
+const DefaultBlobCopyBufferSize = 64 * 1024
+
+// Decoding a BLOB needs a buffer as large as the BLOB itself. When capturing several frames per second, allocating a
+// new one every time puts a lot of pressure on the garbage collector, so decoded BLOBs go into buffers from
+// blobBufferPool, and the base64 input is copied into chunks from blobChunkPool as it is decoded. A BLOB only gets a
+// buffer of its own when something holds on to it after setBlobVector returns: a blob stream or an OnBlob handler.
+var (
+	blobBufferPool = sync.Pool{New: func() interface{} { return new([]byte) }}
+	blobChunkPool  = sync.Pool{New: func() interface{} { return new([]byte) }}
+)
+
+// SetBlobCopyBufferSize sets the size in bytes of the chunks BLOBs are decoded in. Larger chunks decode slightly
+// faster at the cost of memory held by each decode. n is rounded down to a multiple of 4, the size of a base64
+// quantum, and values below 4 restore DefaultBlobCopyBufferSize.
+func (c *INDIClient) SetBlobCopyBufferSize(n int) {
+	n -= n % 4
+	if n < 4 {
+		n = DefaultBlobCopyBufferSize
+	}
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.blobCopyBufferSize = n
+}
+
+// decodeBlob decodes the base64 value of a BLOB, ignoring whitespace, into a buffer from blobBufferPool. Call
+// releaseBlobBuffer with the returned buffer once the data is no longer needed. Reads INDIClient.blobCopyBufferSize.
+// Only call when INDIClient.rwm is at least reader locked.
+func (c *INDIClient) decodeBlob(encoded string) (*[]byte, error) {
+	return decodeBlobChunks(encoded, c.blobCopyBufferSize)
+}
+
+// decodeBlobChunks is decodeBlob with chunks of chunkSize bytes.
+func decodeBlobChunks(encoded string, chunkSize int) (*[]byte, error) {
+	chunk := blobChunkPool.Get().(*[]byte)
+	defer blobChunkPool.Put(chunk)
+
+	if cap(*chunk) != chunkSize {
+		*chunk = make([]byte, 0, chunkSize)
+	}
+
+	buf := blobBufferPool.Get().(*[]byte)
+
+	out := (*buf)[:0]
+	if n := base64.StdEncoding.DecodedLen(len(encoded)); cap(out) < n {
+		out = make([]byte, 0, n)
+	}
+
+	for len(encoded) > 0 {
+		src := (*chunk)[:0]
+
+		// Fill the chunk with everything up to the next whitespace, until it is full or the input runs out.
+		for len(encoded) > 0 && len(src) < cap(src) {
+			n := cap(src) - len(src)
+			if n > len(encoded) {
+				n = len(encoded)
+			}
+
+			seg, skip := encoded[:n], 0
+			if i := strings.IndexAny(seg, " \t\r\n"); i >= 0 {
+				seg, skip = seg[:i], 1
+			}
+
+			src = append(src, seg...)
+			encoded = encoded[len(seg)+skip:]
+		}
+
+		n, err := base64.StdEncoding.Decode(out[len(out):cap(out)], src)
+		if err != nil {
+			*buf = out
+			releaseBlobBuffer(buf)
+			return nil, err
+		}
+
+		out = out[:len(out)+n]
+	}
+
+	*buf = out
+
+	return buf, nil
+}
+
+// releaseBlobBuffer returns a buffer from decodeBlob to blobBufferPool. It must not be used afterwards.
+func releaseBlobBuffer(buf *[]byte) {
+	blobBufferPool.Put(buf)
+}
+
+// hasBlobConsumers returns true if a blob stream or an OnBlob handler will receive the given BLOB, and so needs a copy
+// of its data that outlives the decode buffer.
+func (c *INDIClient) hasBlobConsumers(deviceName, propName, blobName string) bool {
+	if ss, ok := c.blobStreams.Load(blobStreamKey(deviceName, propName, blobName)); ok && len(ss.(map[string]*blobStream)) > 0 {
+		return true
+	}
+
+	e := BlobEvent{Device: deviceName, Property: propName, Name: blobName}
+
+	found := false
+	c.blobHandlers.Range(func(key, value interface{}) bool {
+		found = value.(*blobHandler).matches(e)
+		return !found
+	})
+
+	return found
+}
@@ -0,0 +1,108 @@
+package indiclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wrapBase64 breaks encoded into lines the way drivers send BLOBs.
+func wrapBase64(encoded string, width int) string {
+	var sb strings.Builder
+	for len(encoded) > width {
+		sb.WriteString(encoded[:width])
+		sb.WriteString("\r\n")
+		encoded = encoded[width:]
+	}
+	sb.WriteString(encoded)
+	return "\n  " + sb.String() + "\n"
+}
+
+func Test_DecodeBlob(t *testing.T) {
+	c := newTestClient()
+
+	data := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	for _, size := range []int{4, 7, 76, 1024, DefaultBlobCopyBufferSize} {
+		c.SetBlobCopyBufferSize(size)
+
+		for _, input := range []string{encoded, wrapBase64(encoded, 76), wrapBase64(encoded, 61)} {
+			buf, err := c.decodeBlob(input)
+			require.NoError(t, err, size)
+			assert.True(t, bytes.Equal(data, *buf), size)
+			releaseBlobBuffer(buf)
+		}
+	}
+
+	_, err := c.decodeBlob("not*base64")
+	assert.Error(t, err)
+}
+
+func Test_SetBlobVector_ConsumersKeepData(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+
+	rdr, _, err := c.GetBlobStreamWithOptions("Camera", "CCD1", "CCD1", BlobStreamOptions{Buffer: 10})
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	events := make(chan BlobEvent, 10)
+	_, err = c.OnBlob("Camera", "CCD1", "CCD1", func(e BlobEvent) {
+		events <- e
+	})
+	require.NoError(t, err)
+
+	// Each BLOB reuses the pooled decode buffer, which must not change what consumers already have.
+	sendBlob(c, "first")
+	sendBlob(c, "other")
+
+	for _, expected := range []string{"first", "other"} {
+		select {
+		case e := <-events:
+			b, _ := ioutil.ReadAll(e.Open())
+			assert.Equal(t, expected, string(b))
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for blob event")
+		}
+
+		b := make([]byte, len(expected))
+		_, err := rdr.Read(b)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(b))
+	}
+}
+
+func BenchmarkSetBlobVector(b *testing.B) {
+	c := newTestClient()
+	defineBlob(c)
+
+	data := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	item := &SetBlobVector{
+		Device: "Camera",
+		Name:   "CCD1",
+		State:  PropertyStateOk,
+		Blobs: []OneBlob{
+			{Name: "CCD1", Format: ".fits", Size: len(data), Value: wrapBase64(base64.StdEncoding.EncodeToString(data), 76)},
+		},
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c.setBlobVector(item)
+	}
+}
@@ -0,0 +1,169 @@
+package indiclient
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ErrBlobQuotaExceeded is logged when a BLOB is not written to the file system because it would not fit in
+// BlobStorageOptions.Quota, even after pruning.
+var ErrBlobQuotaExceeded = errors.New("blob storage quota exceeded")
+
+// BlobWrite describes a BLOB about to be written to the file system, passed to BlobStorageOptions.PreWrite.
+type BlobWrite struct {
+	Device   string `json:"device"`
+	Property string `json:"property"`
+	Name     string `json:"name"`
+	FileName string `json:"fileName"`
+	Size     int64  `json:"size"`
+	// Used is the number of bytes of the BLOB files already on the file system, not counting a file this one
+	// overwrites.
+	Used int64 `json:"used"`
+}
+
+// BlobStorageOptions limits how much space BLOB files take up on the file system. See SetBlobStorage.
+type BlobStorageOptions struct {
+	// Quota is the most bytes of BLOB files kept on the file system, across all devices. When a new BLOB would go
+	// over it, the oldest files are removed until it fits. Zero means no limit.
+	Quota int64
+	// PrunePattern, if set, limits the files removed to make room to those whose base name matches it, as in
+	// filepath.Match. Files that do not match are never removed, so the quota may still be exceeded.
+	PrunePattern string
+	// PreWrite, if set, is called before each BLOB is written, after pruning. Returning an error, for example when
+	// the disk is nearly full, vetoes the write. It is called with the client locked, so it must not call the client.
+	PreWrite func(BlobWrite) error
+}
+
+// SetBlobStorage sets how much space BLOB files may take up on the file system. A BLOB that is not written, because
+// it does not fit in the quota or PreWrite vetoed it, is still delivered to OnBlob handlers and blob streams, with an
+// empty FileName, but cannot be read with GetBlob or PeekBlob.
+func (c *INDIClient) SetBlobStorage(opts BlobStorageOptions) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.blobStorage = opts
+}
+
+// BlobStorageUsed returns the number of bytes of BLOB files on the file system.
+func (c *INDIClient) BlobStorageUsed() int64 {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.blobStorageUsed("")
+}
+
+// blobStorageUsed returns the number of bytes of BLOB files on the file system, not counting the file named except.
+// Only call when INDIClient.rwm is at least reader locked.
+func (c *INDIClient) blobStorageUsed(except string) int64 {
+	var used int64
+
+	for _, retained := range c.blobFiles {
+		for _, b := range retained {
+			if b.Value != except {
+				used += b.Size
+			}
+		}
+	}
+
+	return used
+}
+
+// checkBlobStorage prunes old BLOB files to make room for a new one, and asks BlobStorageOptions.PreWrite whether it
+// may be written. Modifies INDIClient.blobFiles and INDIClient.devices. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) checkBlobStorage(w BlobWrite) error {
+	opts := c.blobStorage
+
+	w.Used = c.blobStorageUsed(w.FileName)
+
+	if opts.Quota > 0 && w.Used+w.Size > opts.Quota {
+		w.Used -= c.pruneBlobs(w.FileName, w.Used+w.Size-opts.Quota)
+
+		if w.Used+w.Size > opts.Quota {
+			return ErrBlobQuotaExceeded
+		}
+	}
+
+	if opts.PreWrite != nil {
+		return opts.PreWrite(w)
+	}
+
+	return nil
+}
+
+// pruneBlobs removes the oldest BLOB files matching BlobStorageOptions.PrunePattern, other than the file named
+// except, until at least n bytes are freed, and returns the number of bytes freed. Modifies INDIClient.blobFiles and
+// INDIClient.devices. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) pruneBlobs(except string, n int64) int64 {
+	type candidate struct {
+		key string
+		val BlobValue
+	}
+
+	candidates := []candidate{}
+
+	for key, retained := range c.blobFiles {
+		for _, b := range retained {
+			if b.Value == except {
+				continue
+			}
+
+			if len(c.blobStorage.PrunePattern) > 0 {
+				if ok, _ := filepath.Match(c.blobStorage.PrunePattern, filepath.Base(b.Value)); !ok {
+					continue
+				}
+			}
+
+			candidates = append(candidates, candidate{key: key, val: b})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].val.Timestamp.Before(candidates[j].val.Timestamp)
+	})
+
+	var freed int64
+
+	for _, cand := range candidates {
+		if freed >= n {
+			break
+		}
+
+		if err := c.fs.Remove(cand.val.Value); err != nil && !os.IsNotExist(err) {
+			c.log.WithField("file", cand.val.Value).WithError(err).Warn("error in c.fs.Remove")
+			continue
+		}
+
+		freed += cand.val.Size
+
+		retained := c.blobFiles[cand.key]
+		for i, b := range retained {
+			if b.Value == cand.val.Value {
+				c.blobFiles[cand.key] = append(retained[:i:i], retained[i+1:]...)
+				break
+			}
+		}
+
+		c.forgetBlobFile(cand.val.Value)
+	}
+
+	return freed
+}
+
+// forgetBlobFile clears the BLOB value stored in the file named fname, if it is still the current value of its
+// element, so it is no longer available. Modifies INDIClient.devices. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) forgetBlobFile(fname string) {
+	for deviceName, device := range c.devices {
+		for propName, prop := range device.BlobProperties {
+			for name, val := range prop.Values {
+				if val.Value == fname {
+					val.Value = ""
+					val.Size = 0
+					prop.Values[name] = val
+					c.publishProperty(deviceName, propName)
+				}
+			}
+		}
+	}
+}
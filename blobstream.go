@@ -0,0 +1,262 @@
+package indiclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BlobStreamPolicy decides what happens to a BLOB when a stream's buffer is full because its reader is too slow.
+type BlobStreamPolicy string
+
+const (
+	// BlobStreamPolicyDrop (default) drops the BLOB immediately if the stream's buffer is full.
+	BlobStreamPolicyDrop = BlobStreamPolicy("drop")
+	// BlobStreamPolicyWait waits up to BlobStreamOptions.Timeout for room in the stream's buffer before dropping the
+	// BLOB. Property processing is paused while waiting, so keep the timeout short.
+	BlobStreamPolicyWait = BlobStreamPolicy("wait")
+)
+
+// BlobStreamOptions controls buffering for a stream created by GetBlobStreamWithOptions.
+type BlobStreamOptions struct {
+	// Buffer is the number of BLOBs that can be queued for the reader. Defaults to the client's bufferSize.
+	Buffer int
+	// Policy decides what to do when the buffer is full. Defaults to BlobStreamPolicyDrop.
+	Policy BlobStreamPolicy
+	// Timeout is how long BlobStreamPolicyWait waits for room in the buffer.
+	Timeout time.Duration
+	// Framed precedes each BLOB with a header giving its size, format, timestamp and sequence, so the reader can split
+	// the stream into BLOBs with ReadBlobFrame. Otherwise BLOBs are written back to back.
+	Framed bool
+}
+
+// blobStream delivers BLOBs to a single reader. Each stream has its own buffer and writer goroutine, so a slow reader
+// only ever holds up itself.
+type blobStream struct {
+	opts    BlobStreamOptions
+	w       *io.PipeWriter
+	frames  chan BlobFrame
+	done    chan struct{}
+	once    sync.Once
+	dropped uint64
+}
+
+func newBlobStream(w *io.PipeWriter, opts BlobStreamOptions) *blobStream {
+	s := &blobStream{
+		opts:   opts,
+		w:      w,
+		frames: make(chan BlobFrame, opts.Buffer),
+		done:   make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+func (s *blobStream) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case frame := <-s.frames:
+			// If the reader has gone away, keep draining until the stream is closed.
+			if s.opts.Framed {
+				s.w.Write(frame.header())
+			}
+			s.w.Write(frame.Data)
+		}
+	}
+}
+
+// enqueue queues frame for the reader, applying the stream's policy if the buffer is full. It returns false if the
+// frame was dropped.
+func (s *blobStream) enqueue(frame BlobFrame) bool {
+	select {
+	case s.frames <- frame:
+		return true
+	case <-s.done:
+		return false
+	default:
+	}
+
+	if s.opts.Policy == BlobStreamPolicyWait && s.opts.Timeout > 0 {
+		t := time.NewTimer(s.opts.Timeout)
+		defer t.Stop()
+
+		select {
+		case s.frames <- frame:
+			return true
+		case <-s.done:
+			return false
+		case <-t.C:
+		}
+	}
+
+	atomic.AddUint64(&s.dropped, 1)
+
+	return false
+}
+
+// close ends the stream. Its reader gets err, or io.EOF if err is nil, once it has read the BLOBs already written.
+func (s *blobStream) close(err error) {
+	s.once.Do(func() {
+		close(s.done)
+		// Unblock a write to a reader that has stopped reading.
+		s.w.CloseWithError(err)
+	})
+}
+
+// GetBlobStreamWithOptions is like GetBlobStream, but allows control over how BLOBs are buffered for the reader.
+// BLOBs are queued in a buffer per stream, so a reader that falls behind never blocks the client or other streams;
+// once its buffer is full, opts.Policy decides whether new BLOBs are dropped.
+func (c *INDIClient) GetBlobStreamWithOptions(deviceName, propName, blobName string, opts BlobStreamOptions) (rdr io.ReadCloser, id string, err error) {
+	rdr, id, _, err = c.addBlobStream(deviceName, propName, blobName, opts)
+	return
+}
+
+// GetBlobStreamContext is like GetBlobStreamWithOptions, but the stream is closed when ctx is done, and its reader
+// gets ctx.Err() once it has read the BLOBs already written. CloseBlobStream may still be called to close it sooner.
+func (c *INDIClient) GetBlobStreamContext(ctx context.Context, deviceName, propName, blobName string, opts BlobStreamOptions) (io.ReadCloser, string, error) {
+	rdr, id, s, err := c.addBlobStream(deviceName, propName, blobName, opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := blobStreamKey(c.resolveDevice(deviceName), propName, blobName)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.removeBlobStream(key, id, ctx.Err())
+		case <-s.done:
+		}
+	}()
+
+	return rdr, id, nil
+}
+
+// addBlobStream opens a stream for GetBlobStreamWithOptions and GetBlobStreamContext.
+func (c *INDIClient) addBlobStream(deviceName, propName, blobName string, opts BlobStreamOptions) (rdr io.ReadCloser, id string, s *blobStream, err error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+	device, err := c.findDevice(deviceName)
+	if err != nil {
+		return
+	}
+
+	prop, ok := device.BlobProperties[propName]
+	if !ok {
+		err = ErrPropertyNotFound
+		return
+	}
+
+	_, ok = prop.Values[blobName]
+	if !ok {
+		err = ErrPropertyValueNotFound
+		return
+	}
+
+	if opts.Buffer <= 0 {
+		opts.Buffer = c.bufferSize
+	}
+
+	if len(opts.Policy) == 0 {
+		opts.Policy = BlobStreamPolicyDrop
+	}
+
+	guid := uuid.New()
+	id = guid.String()
+
+	r, w := io.Pipe()
+
+	rdr = r
+
+	c.blobStreamsMu.Lock()
+	defer c.blobStreamsMu.Unlock()
+
+	key := blobStreamKey(deviceName, propName, blobName)
+
+	// Streams are copied on write, so setBlobVector can range over them without holding blobStreamsMu.
+	streams := map[string]*blobStream{}
+	if ss, ok := c.blobStreams.Load(key); ok {
+		for k, v := range ss.(map[string]*blobStream) {
+			streams[k] = v
+		}
+	}
+
+	s = newBlobStream(w, opts)
+	streams[id] = s
+
+	c.blobStreams.Store(key, streams)
+
+	return
+}
+
+// removeBlobStream closes the stream id with err, and forgets it, if it exists.
+func (c *INDIClient) removeBlobStream(key, id string, err error) {
+	c.blobStreamsMu.Lock()
+	defer c.blobStreamsMu.Unlock()
+
+	ss, ok := c.blobStreams.Load(key)
+	if !ok {
+		return
+	}
+
+	s, ok := ss.(map[string]*blobStream)[id]
+	if !ok {
+		return
+	}
+
+	s.close(err)
+
+	streams := map[string]*blobStream{}
+	for k, v := range ss.(map[string]*blobStream) {
+		if k != id {
+			streams[k] = v
+		}
+	}
+
+	c.blobStreams.Store(key, streams)
+}
+
+// closeBlobStreams closes and forgets every stream with err, when the connection ends.
+func (c *INDIClient) closeBlobStreams(err error) {
+	c.blobStreamsMu.Lock()
+	defer c.blobStreamsMu.Unlock()
+
+	c.blobStreams.Range(func(key, ss interface{}) bool {
+		for _, s := range ss.(map[string]*blobStream) {
+			s.close(err)
+		}
+
+		c.blobStreams.Delete(key)
+
+		return true
+	})
+}
+
+// fanOutBlob queues frame on every stream open for key.
+func (c *INDIClient) fanOutBlob(key string, frame BlobFrame) {
+	ss, ok := c.blobStreams.Load(key)
+	if !ok {
+		return
+	}
+
+	for id, s := range ss.(map[string]*blobStream) {
+		if !s.enqueue(frame) {
+			c.log.WithField("stream", id).WithField("dropped", atomic.LoadUint64(&s.dropped)).Warn("blob stream buffer full, dropping blob")
+		}
+	}
+}
+
+func blobStreamKey(deviceName, propName, blobName string) string {
+	return fmt.Sprintf("%s_%s_%s", deviceName, propName, blobName)
+}
@@ -0,0 +1,217 @@
+package indiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+func defineBlob(c *INDIClient) {
+	c.defBlobVector(&DefBlobVector{
+		Device: "Camera",
+		Name:   "CCD1",
+		State:  PropertyStateIdle,
+		Perm:   PropertyPermissionReadOnly,
+		Blobs:  []DefBlob{{Name: "CCD1"}},
+	})
+}
+
+func sendBlob(c *INDIClient, data string) {
+	c.setBlobVector(&SetBlobVector{
+		Device: "Camera",
+		Name:   "CCD1",
+		State:  PropertyStateOk,
+		Blobs: []OneBlob{
+			{Name: "CCD1", Format: ".fits", Size: len(data), Value: base64.StdEncoding.EncodeToString([]byte(data))},
+		},
+	})
+}
+
+func Test_BlobStream_SlowReaderDoesNotBlock(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+
+	fast, fastID, err := c.GetBlobStreamWithOptions("Camera", "CCD1", "CCD1", BlobStreamOptions{Buffer: 10})
+	require.NoError(t, err)
+
+	// Never read from this one.
+	_, slowID, err := c.GetBlobStreamWithOptions("Camera", "CCD1", "CCD1", BlobStreamOptions{Buffer: 1})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5; i++ {
+			sendBlob(c, "frame")
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("setBlobVector blocked on a slow reader")
+	}
+
+	b := make([]byte, 25)
+	_, err = io.ReadFull(fast, b)
+	require.NoError(t, err)
+	assert.Equal(t, "frameframeframeframeframe", string(b))
+
+	require.NoError(t, c.CloseBlobStream("Camera", "CCD1", "CCD1", fastID))
+	require.NoError(t, c.CloseBlobStream("Camera", "CCD1", "CCD1", slowID))
+
+	_, err = fast.Read(b)
+	assert.Equal(t, io.EOF, err)
+}
+
+func Test_BlobStream_Wait(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+
+	rdr, id, err := c.GetBlobStreamWithOptions("Camera", "CCD1", "CCD1", BlobStreamOptions{
+		Buffer:  1,
+		Policy:  BlobStreamPolicyWait,
+		Timeout: time.Second,
+	})
+	require.NoError(t, err)
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			sendBlob(c, "abc")
+		}
+	}()
+
+	b := make([]byte, 9)
+	_, err = io.ReadFull(rdr, b)
+	require.NoError(t, err)
+	assert.Equal(t, "abcabcabc", string(b))
+
+	require.NoError(t, c.CloseBlobStream("Camera", "CCD1", "CCD1", id))
+}
+
+func Test_BlobStream_Context(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	rdr, _, err := c.GetBlobStreamContext(ctx, "Camera", "CCD1", "CCD1", BlobStreamOptions{})
+	require.NoError(t, err)
+
+	sendBlob(c, "frame")
+
+	b := make([]byte, 5)
+	_, err = io.ReadFull(rdr, b)
+	require.NoError(t, err)
+	assert.Equal(t, "frame", string(b))
+
+	cancel()
+
+	_, err = rdr.Read(b)
+	assert.Equal(t, context.Canceled, err)
+
+	ss, _ := c.blobStreams.Load(blobStreamKey("Camera", "CCD1", "CCD1"))
+	assert.Len(t, ss, 0)
+
+	_, _, err = c.GetBlobStreamContext(ctx, "Camera", "CCD2", "CCD2", BlobStreamOptions{})
+	assert.Equal(t, ErrPropertyNotFound, err)
+}
+
+func Test_BlobStream_ConnectionLost(t *testing.T) {
+	d := queueDialer{conns: make(chan net.Conn, 1)}
+	c := NewINDIClient(logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelInfo), d, afero.NewMemMapFs(), 100)
+
+	server, _ := d.serve()
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+
+	_, err := server.Write([]byte(`<defBLOBVector device="Camera" name="CCD1" state="Idle" perm="ro"><defBLOB name="CCD1"/></defBLOBVector>`))
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return c.BlobPropertySet("Camera", "CCD1") })
+
+	rdr, _, err := c.GetBlobStream("Camera", "CCD1", "CCD1")
+	require.NoError(t, err)
+
+	server.Close()
+
+	_, err = rdr.Read(make([]byte, 5))
+	assert.Equal(t, ErrConnectionLost, err)
+}
+
+func Test_BlobStream_Disconnect(t *testing.T) {
+	d := queueDialer{conns: make(chan net.Conn, 1)}
+	c := NewINDIClient(logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelInfo), d, afero.NewMemMapFs(), 100)
+
+	server, _ := d.serve()
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+
+	_, err := server.Write([]byte(`<defBLOBVector device="Camera" name="CCD1" state="Idle" perm="ro"><defBLOB name="CCD1"/></defBLOBVector>`))
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return c.BlobPropertySet("Camera", "CCD1") })
+
+	rdr, _, err := c.GetBlobStreamContext(context.Background(), "Camera", "CCD1", "CCD1", BlobStreamOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, c.Disconnect())
+
+	_, err = rdr.Read(make([]byte, 5))
+	assert.Equal(t, io.EOF, err)
+}
+
+func Test_BlobStream_Framed(t *testing.T) {
+	c := newTestClient()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.SetClock(NewFakeClock(now))
+	defineBlob(c)
+
+	rdr, id, err := c.GetBlobStreamWithOptions("Camera", "CCD1", "CCD1", BlobStreamOptions{Framed: true})
+	require.NoError(t, err)
+
+	sendBlob(c, "frame")
+	sendBlob(c, "longer frame")
+
+	for i, data := range []string{"frame", "longer frame"} {
+		f, err := ReadBlobFrame(rdr)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(i+1), f.Sequence)
+		assert.Equal(t, ".fits", f.Format)
+		assert.True(t, now.Equal(f.Timestamp))
+		assert.Equal(t, data, string(f.Data))
+	}
+
+	require.NoError(t, c.CloseBlobStream("Camera", "CCD1", "CCD1", id))
+
+	_, err = ReadBlobFrame(rdr)
+	assert.Equal(t, io.EOF, err)
+}
+
+func Test_ReadBlobFrame(t *testing.T) {
+	f := BlobFrame{Sequence: 7, Format: ".jpg", Timestamp: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Data: []byte("data")}
+	b := append(f.header(), f.Data...)
+
+	got, err := ReadBlobFrame(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, f, got)
+
+	_, err = ReadBlobFrame(bytes.NewReader(b[:len(b)-1]))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, err = ReadBlobFrame(bytes.NewReader(b[:10]))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, err = ReadBlobFrame(bytes.NewReader([]byte("not a frame header at all, really")))
+	assert.Equal(t, ErrBlobFrameHeader, err)
+}
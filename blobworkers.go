@@ -0,0 +1,390 @@
+package indiclient
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// BlobWorkerOptions moves decoding and storing BLOBs off the goroutine that handles messages. See SetBlobWorkers.
+type BlobWorkerOptions struct {
+	// Workers is how many BLOB vectors are decoded and stored at once. Zero, the default, handles them on the
+	// goroutine that handles every other message.
+	Workers int `json:"workers"`
+	// Queue is how many BLOB vectors may wait for each worker before handling messages waits too. Zero means 1.
+	Queue int `json:"queue"`
+}
+
+// SetBlobWorkers sets how BLOBs are decoded and stored, and takes effect the next time the client connects.
+//
+// By default, a BLOB is decoded from base64 and written to the file system on the goroutine that handles every
+// message, while the client is locked: when several cameras send frames at once, they are handled one after the other,
+// and every other property update, and every call that reads the client's state, waits for them. With workers, BLOB
+// vectors are handed to a pool of goroutines instead, which only lock the client to update the property once its BLOBs
+// are decoded and stored. The BLOBs of different properties are handled in parallel, and those of the same property in
+// the order they were received.
+//
+// A BLOB property's update, with its Event and BlobEvent, is delivered once its BLOBs are stored, so it may come after
+// messages received later.
+func (c *INDIClient) SetBlobWorkers(opts BlobWorkerOptions) {
+	if opts.Workers < 0 {
+		opts.Workers = 0
+	}
+
+	if opts.Queue < 1 {
+		opts.Queue = 1
+	}
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.blobWorkers = opts
+}
+
+// BlobWorkers returns the BLOB worker options. See SetBlobWorkers.
+func (c *INDIClient) BlobWorkers() BlobWorkerOptions {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.blobWorkers
+}
+
+// blobJob is a setBlobVector on its way from the connection to INDIClient.devices. It is handled in four steps:
+// newBlobJob and prepareBlobs need INDIClient.rwm locked, decodeBlobs and writeBlobs do not.
+type blobJob struct {
+	item      *SetBlobVector
+	timestamp time.Time
+	chunkSize int
+	inflate   bool
+	replace   bool
+	blobs     []*receivedBlob
+}
+
+// receivedBlob is a BLOB of a blobJob.
+type receivedBlob struct {
+	val    OneBlob
+	span   Span
+	buf    *[]byte
+	format string
+	// value is the element's new value, and fname the file it is stored in, empty if it is not stored. Both are set
+	// by prepareBlobs.
+	value BlobValue
+	fname string
+	err   error
+}
+
+// newBlobJob returns a job for the BLOBs of item that belong to a defined element, or nil if the property is not
+// defined. It copies the settings the other steps need. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) newBlobJob(item *SetBlobVector) *blobJob {
+	device, err := c.findDevice(item.Device)
+	if err != nil {
+		c.log.WithField("device", item.Device).WithError(err).Warn("could not find device")
+		return nil
+	}
+
+	prop, ok := device.BlobProperties[item.Name]
+	if !ok {
+		c.log.WithField("device", item.Device).WithField("property", item.Name).Warn("could not find property")
+		return nil
+	}
+
+	job := &blobJob{
+		item:      item,
+		timestamp: c.parseTimestamp(item.Timestamp),
+		chunkSize: c.blobCopyBufferSize,
+		inflate:   c.blobBandwidth.PreferCompressed,
+		replace:   c.blobMapping.Enabled,
+	}
+
+	for _, val := range item.Blobs {
+		if _, ok := prop.Values[val.Name]; ok {
+			job.blobs = append(job.blobs, &receivedBlob{val: val})
+		}
+	}
+
+	return job
+}
+
+// decodeBlobs decodes the job's BLOBs, and drops those that cannot be decoded.
+func (c *INDIClient) decodeBlobs(job *blobJob) {
+	decoded := job.blobs[:0]
+
+	for _, b := range job.blobs {
+		_, b.span = c.startSpan(context.Background(), "ReceiveBlob", map[string]string{
+			SpanAttrDevice:   job.item.Device,
+			SpanAttrProperty: job.item.Name,
+			SpanAttrElements: b.val.Name,
+			SpanAttrFormat:   b.val.Format,
+		})
+
+		buf, err := blobData(b.val, job.chunkSize)
+		if err != nil {
+			c.log.WithError(err).Warn("error in base64 decode")
+			b.span.SetError(err)
+			b.span.End()
+			continue
+		}
+
+		c.stats.blob(len(*buf))
+
+		b.format = b.val.Format
+
+		if job.inflate {
+			if b.format, err = inflateBlob(b.val.Format, buf); err != nil {
+				releaseBlobBuffer(buf)
+				c.log.WithField("blob", b.val.Name).WithError(err).Warn("error in zlib decompress")
+				b.span.SetError(err)
+				b.span.End()
+				continue
+			}
+		}
+
+		b.buf = buf
+		b.span.AddEvent("decoded", map[string]string{SpanAttrSize: strconv.Itoa(len(*buf))})
+
+		decoded = append(decoded, b)
+	}
+
+	job.blobs = decoded
+}
+
+// prepareBlobs numbers the job's BLOBs and chooses the files they are stored in. Modifies INDIClient.blobFiles and
+// INDIClient.devices. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) prepareBlobs(job *blobJob) {
+	device, err := c.findDevice(job.item.Device)
+	if err != nil {
+		return
+	}
+
+	prop, ok := device.BlobProperties[job.item.Name]
+	if !ok {
+		return
+	}
+
+	for _, b := range job.blobs {
+		v, ok := prop.Values[b.val.Name]
+		if !ok {
+			b.err = ErrPropertyValueNotFound
+			continue
+		}
+
+		key := blobStreamKey(job.item.Device, job.item.Name, b.val.Name)
+		c.blobSeq[key]++
+
+		size := int64(len(*b.buf))
+
+		v.Duplicate = v.Sequence > 0 && v.Timestamp.Equal(job.timestamp) && v.Size == size
+		v.Sequence = c.blobSeq[key]
+		v.Format = b.format
+		v.Timestamp = job.timestamp
+
+		b.value = v
+		b.fname = c.blobFile(job.item.Device, job.item.Name, v, size)
+	}
+}
+
+// writeBlobs writes the job's BLOBs to the files chosen by prepareBlobs.
+func (c *INDIClient) writeBlobs(job *blobJob) {
+	for _, b := range job.blobs {
+		if b.err != nil || len(b.fname) == 0 {
+			continue
+		}
+
+		b.fname, b.err = c.writeBlob(b.fname, *b.buf, job.replace)
+	}
+}
+
+// applyBlobJob updates the job's property with its BLOBs, and delivers them to blob streams and OnBlob handlers.
+// Modifies INDIClient.devices. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) applyBlobJob(job *blobJob) {
+	item := job.item
+
+	device, err := c.findDevice(item.Device)
+
+	prop, ok := device.BlobProperties[item.Name]
+	if err == nil && !ok {
+		err = ErrPropertyNotFound
+	}
+
+	if err != nil {
+		// The property was deleted while its BLOBs were being stored.
+		c.log.WithField("device", item.Device).WithField("property", item.Name).WithError(err).Warn("blob vector dropped")
+
+		for _, b := range job.blobs {
+			releaseBlobBuffer(b.buf)
+			b.span.SetError(err)
+			b.span.End()
+		}
+		return
+	}
+
+	prop.State = item.State
+	prop.Timeout = item.Timeout
+
+	prop.LastUpdated = job.timestamp
+	prop.RawTimestamp = item.Timestamp
+
+	// OnBlob handlers are told once the device is published, so they can read the BLOB back straight away.
+	var events []BlobEvent
+
+	for _, b := range job.blobs {
+		if _, ok := prop.Values[b.val.Name]; !ok && b.err == nil {
+			b.err = ErrPropertyValueNotFound
+		}
+
+		if b.err != nil {
+			releaseBlobBuffer(b.buf)
+			c.log.WithField("blob", b.val.Name).WithError(b.err).Warn("error storing blob")
+			b.span.SetError(b.err)
+			b.span.End()
+			continue
+		}
+
+		b.span.AddEvent("stored", nil)
+
+		v := b.value
+		data := *b.buf
+
+		v.Value = b.fname
+		v.Size = int64(len(data))
+
+		if len(b.fname) > 0 {
+			c.retainBlob(item.Device, item.Name, v)
+		}
+
+		key := blobStreamKey(item.Device, item.Name, b.val.Name)
+
+		// Streams and handlers keep the data after this returns, so they need a copy that is not reused.
+		if c.hasBlobConsumers(item.Device, item.Name, b.val.Name) {
+			data = append([]byte(nil), data...)
+		} else {
+			data = nil
+		}
+		releaseBlobBuffer(b.buf)
+
+		if data != nil {
+			c.fanOutBlob(key, BlobFrame{
+				Sequence:  v.Sequence,
+				Format:    v.Format,
+				Timestamp: v.Timestamp,
+				Data:      data,
+			})
+		}
+
+		events = append(events, BlobEvent{
+			Device:    item.Device,
+			Property:  item.Name,
+			Name:      b.val.Name,
+			FileName:  b.fname,
+			Size:      v.Size,
+			Format:    v.Format,
+			Timestamp: v.Timestamp,
+			Sequence:  v.Sequence,
+			Duplicate: v.Duplicate,
+			data:      data,
+			analysis:  c.newBlobAnalysis(v.Format, data),
+			preview:   c.newBlobPreview(v.Format, data),
+		})
+
+		b.span.End()
+
+		// A BLOB that was not stored cannot be read back.
+		if len(b.fname) == 0 {
+			v.Size = 0
+		}
+
+		prop.Values[b.val.Name] = v
+	}
+
+	if len(item.Message) > 0 {
+		prop.Messages = c.appendMessage(item.Device, prop.Messages, MessageJSON{
+			Message:   item.Message,
+			Timestamp: c.now(),
+		})
+	}
+
+	device.BlobProperties[item.Name] = prop
+
+	c.putProperty(item.Device, device, item.Name)
+
+	for _, e := range events {
+		c.notifyBlob(e)
+	}
+
+	c.traceState(item.Device, item.Name, item.State, item.Message)
+	c.checkLease(item.Device, item.Name, item.State, item.Message)
+
+	c.emit(Event{
+		Type:     EventTypeUpdate,
+		Device:   item.Device,
+		Property: item.Name,
+		State:    item.State,
+		Message:  item.Message,
+	})
+}
+
+// blobWorkerPool decodes and stores the BLOB vectors of a connection. The vectors of a property always go to the same
+// worker, so they are applied in the order they were received.
+type blobWorkerPool struct {
+	queues []chan *blobJob
+	// assigned maps properties to workers, as they are first seen. Only used by the goroutine handling messages.
+	assigned map[string]int
+}
+
+// startBlobWorkers starts the workers for session s, or returns nil if there are none. They are part of its loops.
+func (c *INDIClient) startBlobWorkers(s *session) *blobWorkerPool {
+	opts := c.BlobWorkers()
+	if opts.Workers == 0 {
+		return nil
+	}
+
+	pool := &blobWorkerPool{assigned: map[string]int{}}
+
+	s.loops.Add(opts.Workers)
+
+	for i := 0; i < opts.Workers; i++ {
+		queue := make(chan *blobJob, opts.Queue)
+		pool.queues = append(pool.queues, queue)
+
+		go func() {
+			defer s.loops.Done()
+
+			for job := range queue {
+				c.decodeBlobs(job)
+
+				c.rwm.Lock()
+				c.prepareBlobs(job)
+				c.rwm.Unlock()
+
+				c.writeBlobs(job)
+
+				c.rwm.Lock()
+				c.applyBlobJob(job)
+				c.rwm.Unlock()
+			}
+		}()
+	}
+
+	return pool
+}
+
+// queue hands job to its property's worker, waiting if the worker's queue is full. Do not call with INDIClient.rwm
+// locked.
+func (p *blobWorkerPool) queue(job *blobJob) {
+	key := blobStreamKey(job.item.Device, job.item.Name, "")
+
+	i, ok := p.assigned[key]
+	if !ok {
+		i = len(p.assigned) % len(p.queues)
+		p.assigned[key] = i
+	}
+
+	p.queues[i] <- job
+}
+
+// stop stops the workers once they have handled the jobs already queued.
+func (p *blobWorkerPool) stop() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+}
@@ -0,0 +1,128 @@
+package indiclient
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+// blockingFs blocks writing files whose names start with prefix until release is closed.
+type blockingFs struct {
+	afero.Fs
+	prefix  string
+	release chan struct{}
+}
+
+func (fs blockingFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if strings.HasPrefix(name, fs.prefix) {
+		<-fs.release
+	}
+
+	return fs.Fs.OpenFile(name, flag, perm)
+}
+
+func setBlobXML(device, data string) string {
+	return fmt.Sprintf(`<setBLOBVector device="%s" name="CCD1" state="Ok"><oneBLOB name="CCD1" size="%d" format=".fits">%s</oneBLOB></setBLOBVector>`,
+		device, len(data), base64.StdEncoding.EncodeToString([]byte(data)))
+}
+
+func Test_BlobWorkers(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+
+	fs := blockingFs{Fs: afero.NewMemMapFs(), prefix: "Main", release: make(chan struct{})}
+
+	client, server := net.Pipe()
+	go io.Copy(ioutil.Discard, server)
+
+	c := NewINDIClient(log, pipeDialer{conn: client}, fs, 10)
+	c.SetBlobRetention(3)
+	c.SetBlobWorkers(BlobWorkerOptions{Workers: 2, Queue: 4})
+	assert.Equal(t, BlobWorkerOptions{Workers: 2, Queue: 4}, c.BlobWorkers())
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+
+	c.rwm.RLock()
+	s := c.session
+	c.rwm.RUnlock()
+
+	def := `<defBLOBVector device="Main" name="CCD1" state="Idle" perm="ro"><defBLOB name="CCD1"/></defBLOBVector>` +
+		`<defBLOBVector device="Guide" name="CCD1" state="Idle" perm="ro"><defBLOB name="CCD1"/></defBLOBVector>` +
+		`<defNumberVector device="Guide" name="CCD_TEMPERATURE" state="Idle" perm="rw"><defNumber name="CCD_TEMPERATURE_VALUE">0</defNumber></defNumberVector>`
+
+	_, err := server.Write([]byte(def + setBlobXML("Main", "frame 1") + setBlobXML("Main", "frame 2") + setBlobXML("Main", "frame 3") +
+		setBlobXML("Guide", "guide frame") +
+		`<setNumberVector device="Guide" name="CCD_TEMPERATURE" state="Ok"><oneNumber name="CCD_TEMPERATURE_VALUE">-10</oneNumber></setNumberVector>`))
+	require.NoError(t, err)
+
+	// While the main camera's frames wait to be written, other properties are still updated.
+	testutil.WaitFor(t, func() bool { return c.BlobAvailable("Guide", "CCD1", "CCD1") })
+	testutil.WaitFor(t, func() bool {
+		p, err := c.GetNumberProperty("Guide", "CCD_TEMPERATURE")
+		return err == nil && p.State == PropertyStateOk
+	})
+	assert.False(t, c.BlobAvailable("Main", "CCD1", "CCD1"))
+
+	close(fs.release)
+
+	testutil.WaitFor(t, func() bool {
+		blobs, err := c.RetainedBlobs("Main", "CCD1", "CCD1")
+		return err == nil && len(blobs) == 3
+	})
+
+	// The frames of a property are stored in the order they were received.
+	blobs, err := c.RetainedBlobs("Main", "CCD1", "CCD1")
+	require.NoError(t, err)
+
+	for i, b := range blobs {
+		assert.Equal(t, uint64(i+1), b.Sequence)
+
+		data, err := afero.ReadFile(fs, b.Value)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("frame %d", i+1), string(data))
+	}
+
+	require.NoError(t, c.Disconnect())
+
+	// The workers are part of the connection's loops.
+	s.loops.Wait()
+}
+
+func Test_blobWorkerPool_queue(t *testing.T) {
+	c := newTestClient()
+	c.SetBlobWorkers(BlobWorkerOptions{Workers: 2})
+
+	s := &session{}
+	pool := c.startBlobWorkers(s)
+	require.NotNil(t, pool)
+
+	// Stop the workers, so the queued jobs stay in their queues.
+	pool.stop()
+	s.loops.Wait()
+
+	for i := range pool.queues {
+		pool.queues[i] = make(chan *blobJob, 10)
+	}
+
+	for _, device := range []string{"Main", "Guide", "Main", "Guide", "Main"} {
+		pool.queue(&blobJob{item: &SetBlobVector{Device: device, Name: "CCD1"}})
+	}
+
+	assert.Len(t, pool.queues[0], 3)
+	assert.Len(t, pool.queues[1], 2)
+
+	c.SetBlobWorkers(BlobWorkerOptions{})
+	assert.Nil(t, c.startBlobWorkers(&session{}))
+}
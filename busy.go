@@ -0,0 +1,121 @@
+package indiclient
+
+import (
+	"context"
+	"time"
+)
+
+// BusyPolicy decides what the Set*Value methods do when the property they change is Busy.
+type BusyPolicy string
+
+const (
+	// BusyPolicyReject (default) refuses the command with ErrPropertyStateBusy.
+	BusyPolicyReject = BusyPolicy("reject")
+	// BusyPolicySend sends the command anyway, for drivers that queue commands or accept a new target while moving.
+	BusyPolicySend = BusyPolicy("send")
+	// BusyPolicyWait waits until the property is no longer Busy, then sends the command. It is refused with
+	// ErrPropertyStateBusy if the property is still Busy after BusyOptions.Timeout.
+	BusyPolicyWait = BusyPolicy("wait")
+)
+
+// BusyOptions controls what happens when a command is sent to a Busy property. See SetBusyHandling.
+type BusyOptions struct {
+	Policy BusyPolicy `json:"policy"`
+	// Timeout is how long BusyPolicyWait waits. Zero waits as long as the command timeout, or forever if that is zero
+	// too. See SetCommandTimeout.
+	Timeout time.Duration `json:"timeout"`
+}
+
+// SetOptions are the options of a single Set*ValueWithOptions call.
+type SetOptions struct {
+	// Busy overrides the client's BusyOptions for this call, unless its Policy is empty.
+	Busy BusyOptions
+	// Context is passed to the Tracer, so the call's span joins the caller's trace. It does not cancel the call.
+	Context context.Context
+}
+
+// SetBusyHandling changes what the Set*Value methods do when the property they change is Busy. Dry runs never wait:
+// with BusyPolicyWait they check the command as if the property were not Busy.
+func (c *INDIClient) SetBusyHandling(opts BusyOptions) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.busy = opts
+}
+
+// BusyHandling returns the options set with SetBusyHandling.
+func (c *INDIClient) BusyHandling() BusyOptions {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.busy
+}
+
+// SetTextValueWithOptions is like SetTextValue, with options for this call only.
+func (c *INDIClient) SetTextValueWithOptions(deviceName, propName string, textNames, textValues []string, opts SetOptions) error {
+	return c.setTextValue(deviceName, propName, textNames, textValues, false, opts)
+}
+
+// SetNumberValueWithOptions is like SetNumberValue, with options for this call only.
+func (c *INDIClient) SetNumberValueWithOptions(deviceName, propName string, numberNames, numberValues []string, opts SetOptions) error {
+	return c.setNumberValue(deviceName, propName, numberNames, numberValues, false, opts)
+}
+
+// SetSwitchValueWithOptions is like SetSwitchValue, with options for this call only.
+func (c *INDIClient) SetSwitchValueWithOptions(deviceName, propName string, switchNames []string, switchValues []SwitchState, opts SetOptions) error {
+	return c.setSwitchValue(deviceName, propName, switchNames, switchValues, false, opts)
+}
+
+// SetBlobValueWithOptions is like SetBlobValue, with options for this call only.
+func (c *INDIClient) SetBlobValueWithOptions(deviceName, propName, blobName, blobValue, blobFormat string, blobSize int, opts SetOptions) error {
+	return c.setBlobValue(deviceName, propName, blobName, blobValue, blobFormat, blobSize, false, opts)
+}
+
+// busyOptions returns the BusyOptions for a command with opts, waiting first if its policy is BusyPolicyWait. A
+// command to a Busy property must be refused if the returned policy is BusyPolicyReject. It must be called without
+// INDIClient.rwm locked, since it may wait for deviceName's propName to change.
+func (c *INDIClient) busyOptions(deviceName, propName string, opts SetOptions, dryRun bool) BusyOptions {
+	c.rwm.RLock()
+	busy := opts.Busy
+	if len(busy.Policy) == 0 {
+		busy = c.busy
+	}
+	if busy.Timeout == 0 {
+		busy.Timeout = c.commandTimeout
+	}
+	dryRun = dryRun || c.dryRun
+	c.rwm.RUnlock()
+
+	switch busy.Policy {
+	case BusyPolicySend:
+		return busy
+	case BusyPolicyWait:
+		if dryRun {
+			busy.Policy = BusyPolicySend
+			return busy
+		}
+	default:
+		busy.Policy = BusyPolicyReject
+		return busy
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if busy.Timeout > 0 {
+		t := c.Clock().AfterFunc(busy.Timeout, cancel)
+		defer t.Stop()
+	}
+
+	// Once the wait is over, a property that is Busy again is refused.
+	busy.Policy = BusyPolicyReject
+
+	c.waitForValue(ctx, deviceName, propName, func() (bool, error) {
+		c.rwm.RLock()
+		defer c.rwm.RUnlock()
+
+		return c.propertyState(deviceName, propName) != PropertyStateBusy, nil
+	})
+
+	return busy
+}
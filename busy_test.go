@@ -0,0 +1,118 @@
+package indiclient
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+// busyCoords defines the coordinates, and sets them Busy as if a slew were in progress.
+func busyCoords(c *INDIClient) {
+	c.rwm.Lock()
+	defineCoords(c)
+	setCoords(c, "1")
+	c.rwm.Unlock()
+}
+
+func Test_Busy_Reject(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	busyCoords(c)
+
+	err := c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"5"})
+	assert.True(t, errors.Is(err, ErrPropertyStateBusy))
+	assert.Len(t, c.write, 0)
+}
+
+func Test_Busy_Send(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	busyCoords(c)
+
+	answer := func() {
+		<-c.write
+
+		c.rwm.Lock()
+		c.setNumberVector(&SetNumberVector{Device: "Mount", Name: "EQUATORIAL_EOD_COORD", State: PropertyStateOk})
+		c.rwm.Unlock()
+	}
+
+	go answer()
+	require.NoError(t, c.SetNumberValueWithOptions("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"5"}, SetOptions{Busy: BusyOptions{Policy: BusyPolicySend}}))
+
+	c.SetBusyHandling(BusyOptions{Policy: BusyPolicySend})
+	assert.Equal(t, BusyPolicySend, c.BusyHandling().Policy)
+
+	setCoords(c, "1")
+	_, err := c.DryRunNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"5"})
+	require.NoError(t, err)
+
+	go answer()
+	require.NoError(t, c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"5"}))
+
+	// A call can still refuse.
+	setCoords(c, "1")
+	err = c.SetNumberValueWithOptions("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"5"}, SetOptions{Busy: BusyOptions{Policy: BusyPolicyReject}})
+	assert.True(t, errors.Is(err, ErrPropertyStateBusy))
+}
+
+func Test_Busy_Wait(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	busyCoords(c)
+
+	c.SetBusyHandling(BusyOptions{Policy: BusyPolicyWait, Timeout: time.Second})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"5"})
+	}()
+
+	select {
+	case <-c.write:
+		t.Fatal("sent while Busy")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.rwm.Lock()
+	c.setNumberVector(&SetNumberVector{Device: "Mount", Name: "EQUATORIAL_EOD_COORD", State: PropertyStateOk})
+	c.rwm.Unlock()
+
+	cmd := (<-c.write).(NewNumberVector)
+	assert.Equal(t, "5", cmd.Numbers[0].Value)
+
+	c.rwm.Lock()
+	c.setNumberVector(&SetNumberVector{Device: "Mount", Name: "EQUATORIAL_EOD_COORD", State: PropertyStateOk})
+	c.rwm.Unlock()
+
+	require.NoError(t, <-done)
+}
+
+func Test_Busy_WaitTimeout(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	c.SetClock(clock)
+	busyCoords(c)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.SetNumberValueWithOptions("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"5"}, SetOptions{Busy: BusyOptions{Policy: BusyPolicyWait, Timeout: time.Minute}})
+	}()
+
+	testutil.WaitFor(t, func() bool { return clock.Pending() == 1 })
+	clock.Advance(time.Minute)
+
+	select {
+	case err := <-done:
+		assert.True(t, errors.Is(err, ErrPropertyStateBusy))
+	case <-time.After(time.Second):
+		t.Fatal("did not time out")
+	}
+	assert.Len(t, c.write, 0)
+}
@@ -0,0 +1,67 @@
+package indiclient
+
+import (
+	"context"
+)
+
+// CaptureFrame takes an exposure of the given seconds with the camera deviceName, and returns the frame it sends on
+// its CCD1 BLOB. BLOBs are enabled for the camera if they are not already, on the client or a BlobConnPool. Use ctx
+// to limit how long to wait for the frame; if ctx is done first, the exposure is left to complete.
+func (c *INDIClient) CaptureFrame(ctx context.Context, deviceName string, seconds float64) (BlobEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return BlobEvent{}, err
+	}
+
+	deviceName = c.resolveDevice(deviceName)
+
+	frames := make(chan BlobEvent, 1)
+
+	id, err := c.OnBlob(deviceName, "CCD1", "", func(e BlobEvent) {
+		select {
+		case frames <- e:
+		default:
+		}
+	})
+	if err != nil {
+		return BlobEvent{}, err
+	}
+	defer c.RemoveBlobHandler(id)
+
+	c.rwm.RLock()
+	policy := blobPolicyFor(c.blobPolicies, deviceName, "CCD1")
+	pooled := c.blobPooledFor(deviceName, "CCD1")
+	c.rwm.RUnlock()
+
+	if !pooled && policy != BlobEnableAlso && policy != BlobEnableOnly && policy != BlobEnableURL {
+		if err := c.EnableBlob(deviceName, "CCD1", BlobEnableAlso); err != nil {
+			return BlobEvent{}, err
+		}
+	}
+
+	exposed := make(chan error, 1)
+
+	go func() {
+		exposed <- c.setNumber(deviceName, "CCD_EXPOSURE", map[string]float64{"CCD_EXPOSURE_VALUE": seconds}, SetOptions{Context: ctx})
+	}()
+
+	// Drivers may send the frame before or after the exposure property returns to Ok. Wait for both, so the camera is
+	// ready for another exposure when this returns.
+	var frame *BlobEvent
+
+	for frame == nil || exposed != nil {
+		select {
+		case e := <-frames:
+			frame = &e
+			frames = nil
+		case err := <-exposed:
+			if err != nil {
+				return BlobEvent{}, err
+			}
+			exposed = nil
+		case <-ctx.Done():
+			return BlobEvent{}, ctx.Err()
+		}
+	}
+
+	return *frame, nil
+}
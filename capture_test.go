@@ -0,0 +1,58 @@
+package indiclient_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func Test_CaptureFrame(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	server := simulators.NewServer(simulators.NewCCD("CCD Simulator"))
+
+	c := indiclient.NewINDIClient(log, server, afero.NewMemMapFs(), 100)
+
+	err := c.Connect("tcp", "localhost:7624")
+	require.NoError(t, err)
+	defer c.Disconnect()
+
+	err = c.GetProperties("", "")
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return c.SwitchPropertySet("CCD Simulator", "CONNECTION") })
+
+	err = c.SetSwitchValue("CCD Simulator", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return c.BlobPropertySet("CCD Simulator", "CCD1") })
+
+	// BLOBs are not enabled, so CaptureFrame has to enable them.
+	e, err := c.CaptureFrame(context.Background(), "CCD Simulator", 0.01)
+	require.NoError(t, err)
+
+	assert.Equal(t, "CCD1", e.Name)
+	assert.Equal(t, ".fits", e.Format)
+
+	rdr := e.Open()
+	defer rdr.Close()
+
+	b, err := ioutil.ReadAll(rdr)
+	require.NoError(t, err)
+	assert.Equal(t, "SIMPLE  =", string(b[:9]))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = c.CaptureFrame(ctx, "CCD Simulator", 0.01)
+	assert.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,179 @@
+package indiclient
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the client the time and schedules its timers. The client uses it for LastUpdated when a driver sends no
+// timestamp, message and event timestamps, command timeouts, leases, staleness, driver restarts, the definition cache,
+// watchdogs, SyncProperties, throttling of subscriptions, BLOB bandwidth limits and BLOB fetch retries. The observatory
+// and platesolve packages use the client's clock too, for cooling, limits and coordinates. See SetClock.
+type Clock interface {
+	Now() time.Time
+	// After sends the time on the returned channel once d has passed.
+	After(d time.Duration) <-chan time.Time
+	// AfterFunc calls f on its own goroutine once d has passed.
+	AfterFunc(d time.Duration, f func()) ClockTimer
+}
+
+// ClockTimer is a timer started by Clock.AfterFunc.
+type ClockTimer interface {
+	// Stop prevents the timer from firing, and returns false if it has already fired or been stopped.
+	Stop() bool
+}
+
+// SystemClock is the Clock used unless SetClock is called, which uses the time package.
+type SystemClock struct{}
+
+// Now returns time.Now().
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// After returns time.After(d).
+func (SystemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// AfterFunc returns time.AfterFunc(d, f).
+func (SystemClock) AfterFunc(d time.Duration, f func()) ClockTimer { return time.AfterFunc(d, f) }
+
+// FakeClock is a Clock whose time only moves when Advance is called, so tests of timeouts, retries and staleness run
+// instantly and deterministically:
+//
+//	clock := indiclient.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+//	c.SetClock(clock)
+//	c.SetStaleDetection(indiclient.StaleOptions{Threshold: time.Minute})
+//	clock.Advance(2 * time.Minute)
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// fakeTimer is a pending After or AfterFunc of a FakeClock.
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	ch    chan time.Time
+	f     func()
+}
+
+// NewFakeClock returns a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the clock's time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// After returns a channel the time is sent on once Advance has moved the clock d past now.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	t := &fakeTimer{ch: make(chan time.Time, 1)}
+	c.add(t, d)
+
+	return t.ch
+}
+
+// AfterFunc calls f on its own goroutine once Advance has moved the clock d past now.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	t := &fakeTimer{f: f}
+	c.add(t, d)
+
+	return t
+}
+
+// Advance moves the clock forward by d, and fires the timers that are due, earliest first.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+
+	due := []*fakeTimer{}
+	pending := []*fakeTimer{}
+	for _, t := range c.timers {
+		if t.when.After(now) {
+			pending = append(pending, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].when.Before(due[j].when) })
+
+	for _, t := range due {
+		if t.f != nil {
+			go t.f()
+		} else {
+			t.ch <- now
+		}
+	}
+}
+
+// Pending returns the number of timers waiting for the clock to advance, so a test can wait for the code under test
+// to start waiting before calling Advance.
+func (c *FakeClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+func (c *FakeClock) add(t *fakeTimer, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t.clock = c
+	t.when = c.now.Add(d)
+	c.timers = append(c.timers, t)
+}
+
+// Stop removes the timer from its clock.
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	for i, p := range t.clock.timers {
+		if p == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// clockValue wraps a Clock so it can be stored in an atomic.Value, which needs the same concrete type every time.
+type clockValue struct {
+	Clock
+}
+
+// SetClock replaces the clock the client tells the time with, usually with a FakeClock in tests. nil restores the
+// system clock. Set it before Connect; timers already started keep the clock they were started with.
+func (c *INDIClient) SetClock(clock Clock) {
+	if clock == nil {
+		clock = SystemClock{}
+	}
+
+	c.clock.Store(clockValue{clock})
+}
+
+// Clock returns the clock set with SetClock.
+func (c *INDIClient) Clock() Clock {
+	if v, ok := c.clock.Load().(clockValue); ok {
+		return v.Clock
+	}
+
+	return SystemClock{}
+}
+
+// now returns the time on the client's clock. Unlike most state, the clock can be read whether or not
+// INDIClient.rwm is locked.
+func (c *INDIClient) now() time.Time {
+	return c.Clock().Now()
+}
@@ -0,0 +1,245 @@
+package indiclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+var clockStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func Test_FakeClock(t *testing.T) {
+	clock := NewFakeClock(clockStart)
+
+	after := clock.After(time.Minute)
+	fired := make(chan struct{})
+	clock.AfterFunc(2*time.Minute, func() { close(fired) })
+	stopped := clock.AfterFunc(time.Second, func() { t.Error("stopped timer fired") })
+
+	assert.Equal(t, 3, clock.Pending())
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, clockStart.Add(30*time.Second), clock.Now())
+
+	select {
+	case <-after:
+		t.Fatal("fired early")
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, clockStart.Add(90*time.Second), <-after)
+
+	clock.Advance(time.Minute)
+	<-fired
+	assert.Equal(t, 0, clock.Pending())
+}
+
+func Test_Clock_CommandTimeout(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	defineCoords(c)
+
+	clock := NewFakeClock(clockStart)
+	c.SetClock(clock)
+	assert.Equal(t, clock, c.Clock())
+
+	c.SetCommandTimeout(time.Minute)
+
+	done := make(chan error)
+	go func() {
+		done <- c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"})
+	}()
+
+	<-c.write
+
+	// The system clock does not time the command out.
+	select {
+	case <-done:
+		t.Fatal("timed out on the system clock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.Advance(2 * time.Minute)
+	assert.True(t, errors.Is(<-done, ErrCommandTimeout))
+
+	c.SetClock(nil)
+	assert.Equal(t, SystemClock{}, c.Clock())
+}
+
+func Test_Clock_Stale(t *testing.T) {
+	c := newTestClient()
+	clock := NewFakeClock(clockStart)
+	c.SetClock(clock)
+
+	c.rwm.Lock()
+	defineCoords(c)
+	c.deviceActive("Mount")
+	c.rwm.Unlock()
+
+	seen, ok := c.LastSeen("Mount")
+	require.True(t, ok)
+	assert.Equal(t, clockStart, seen)
+
+	prop, err := c.GetNumberProperty("Mount", "EQUATORIAL_EOD_COORD")
+	require.NoError(t, err)
+	assert.Equal(t, clockStart, prop.LastUpdated)
+
+	events, id, err := c.Subscribe(SubscribeOptions{Types: []EventType{EventTypeDeviceStale}})
+	require.NoError(t, err)
+	defer c.Unsubscribe(id)
+
+	c.SetStaleDetection(StaleOptions{Threshold: time.Minute})
+	defer c.SetStaleDetection(StaleOptions{})
+
+	testutil.WaitFor(t, func() bool { return clock.Pending() == 1 })
+	clock.Advance(45 * time.Second)
+	testutil.WaitFor(t, func() bool { return clock.Pending() == 1 })
+	assert.Empty(t, c.StaleDevices(time.Minute))
+
+	clock.Advance(30 * time.Second)
+
+	e := <-events
+	assert.Equal(t, "Mount", e.Device)
+	assert.Equal(t, clockStart.Add(75*time.Second), e.Timestamp)
+	assert.Len(t, c.StaleDevices(time.Minute), 1)
+}
+
+func Test_Clock_Throttle(t *testing.T) {
+	c := newTestClient()
+	clock := NewFakeClock(clockStart)
+	c.SetClock(clock)
+	defineCoords(c)
+
+	ch, id, err := c.Subscribe(SubscribeOptions{MaxRate: 1})
+	require.NoError(t, err)
+	defer c.Unsubscribe(id)
+
+	// The first update goes out at once, and the next ones wait for the clock to move a second on.
+	setCoords(c, "1")
+	assert.Len(t, drain(ch, 50*time.Millisecond), 1)
+
+	setCoords(c, "2")
+	setCoords(c, "3")
+	assert.Equal(t, 1, clock.Pending())
+	assert.Empty(t, drain(ch, 50*time.Millisecond))
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Empty(t, drain(ch, 50*time.Millisecond))
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Len(t, drain(ch, 50*time.Millisecond), 1)
+	assert.Equal(t, 0, clock.Pending())
+}
+
+func Test_Clock_Debounce(t *testing.T) {
+	c := newTestClient()
+	clock := NewFakeClock(clockStart)
+	c.SetClock(clock)
+	defineCoords(c)
+
+	ch, id, err := c.Subscribe(SubscribeOptions{Debounce: time.Second})
+	require.NoError(t, err)
+	defer c.Unsubscribe(id)
+
+	setCoords(c, "1")
+	clock.Advance(600 * time.Millisecond)
+
+	// Another update restarts the wait.
+	setCoords(c, "2")
+	assert.Equal(t, 1, clock.Pending())
+
+	clock.Advance(600 * time.Millisecond)
+	assert.Empty(t, drain(ch, 50*time.Millisecond))
+
+	clock.Advance(400 * time.Millisecond)
+	assert.Len(t, drain(ch, 50*time.Millisecond), 1)
+}
+
+func Test_Clock_FetchBlobRetry(t *testing.T) {
+	failures := 2
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("flaky"))
+	}))
+	defer server.Close()
+
+	c := newTestClient()
+	clock := NewFakeClock(clockStart)
+	c.SetClock(clock)
+
+	opts := BlobFetchOptions{Client: server.Client(), Retries: 2, RetryDelay: time.Minute}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		data, err := c.fetchBlob(opts, server.URL+"/flaky.fits")
+		done <- result{data, err}
+	}()
+
+	// The first retry waits a minute, and the second twice as long.
+	testutil.WaitFor(t, func() bool { return clock.Pending() == 1 })
+	clock.Advance(time.Minute)
+
+	testutil.WaitFor(t, func() bool { return clock.Pending() == 1 })
+	clock.Advance(time.Minute)
+
+	select {
+	case <-done:
+		t.Fatal("retried before the delay doubled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.Advance(time.Minute)
+
+	r := <-done
+	require.NoError(t, r.err)
+	assert.Equal(t, "flaky", string(r.data))
+	assert.Equal(t, 0, failures)
+}
+
+func Test_Clock_BlobBandwidth(t *testing.T) {
+	c := newTestClient()
+	clock := NewFakeClock(clockStart)
+	c.SetClock(clock)
+
+	c.SetBlobBandwidth(BlobBandwidthOptions{MaxRate: 1000})
+
+	// The first second's worth is read at once, and the next 500 bytes wait half a second.
+	c.blobLimiter.wait(1000)
+
+	done := make(chan bool)
+	go func() {
+		c.blobLimiter.wait(500)
+		close(done)
+	}()
+
+	testutil.WaitFor(t, func() bool { return clock.Pending() == 1 })
+
+	select {
+	case <-done:
+		t.Fatal("read before the clock moved")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	<-done
+}
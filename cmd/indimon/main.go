@@ -0,0 +1,163 @@
+// Command indimon is a terminal monitor for indiserver, for headless machines where the KStars INDI control panel is
+// not available. It shows each device's properties by group, with their values colored by state, and a log of the
+// messages sent by the devices.
+//
+// Usage:
+//
+//	indimon [-server localhost:7624] [-messages 8] [-refresh 250ms]
+//
+// Type n or p and Enter to show the next or previous device, a device's number to show it, j or k to scroll, and q to
+// quit.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/goastro/indiclient"
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+)
+
+// Escape sequences that switch to and from the terminal's alternate screen, so the shell is restored on exit.
+const (
+	ansiEnter = "\x1b[?1049h\x1b[?25l"
+	ansiLeave = "\x1b[?25h\x1b[?1049l"
+)
+
+func main() {
+	server := flag.String("server", "localhost:7624", "indiserver address, such as localhost:7624 or unix:///tmp/indiserver")
+	messages := flag.Int("messages", 8, "number of messages shown in the message log")
+	refresh := flag.Duration("refresh", 250*time.Millisecond, "how often the screen is redrawn while values change")
+	width := flag.Int("width", 80, "terminal width, if it cannot be detected")
+	height := flag.Int("height", 24, "terminal height, if it cannot be detected")
+	logFile := flag.String("log", "", "file to write the client's log to")
+	flag.Parse()
+
+	if err := run(*server, *messages, *refresh, *width, *height, *logFile); err != nil {
+		fmt.Fprintln(os.Stderr, "indimon:", err)
+		os.Exit(1)
+	}
+}
+
+func run(server string, messages int, refresh time.Duration, width, height int, logFile string) error {
+	network, address, err := indiclient.ParseAddress(server)
+	if err != nil {
+		return err
+	}
+
+	// The client's log would be drawn over the screen.
+	logOut := ioutil.Discard
+	if len(logFile) > 0 {
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		logOut = f
+	}
+
+	log := logging.NewLogger(logOut, logging.JSONFormatter{}, logging.LogLevelInfo)
+
+	var dialer indiclient.Dialer = indiclient.NetworkDialer{}
+	if network == "unix" {
+		dialer = indiclient.UnixDialer{}
+	}
+
+	client := indiclient.NewINDIClient(log, dialer, afero.NewMemMapFs(), 100)
+
+	events, id, err := client.Subscribe(indiclient.SubscribeOptions{})
+	if err != nil {
+		return err
+	}
+	defer client.Unsubscribe(id)
+
+	if err := client.SetAutoGetProperties(indiclient.AutoGetPropertiesOptions{Enabled: true}); err != nil {
+		return err
+	}
+
+	if err := client.Connect(network, address); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	input := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			input <- scanner.Text()
+		}
+		close(input)
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	out := bufio.NewWriter(os.Stdout)
+
+	fmt.Fprint(out, ansiEnter)
+	defer func() {
+		fmt.Fprint(out, ansiLeave)
+		out.Flush()
+	}()
+
+	m := newMonitor(server, messages)
+
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	draw := func() {
+		m.update(client.Snapshot(), client.IsConnected())
+
+		w, h, ok := terminalSize()
+		if !ok {
+			w, h = width, height
+		}
+
+		m.render(out, w, h)
+		out.Flush()
+	}
+
+	draw()
+
+	// Changes are only drawn on the next tick, so a driver sending many updates does not redraw the screen for each.
+	dirty := false
+
+	for {
+		select {
+		case <-interrupt:
+			return nil
+		case cmd, ok := <-input:
+			if !ok {
+				// Without stdin, indimon runs until it is interrupted.
+				input = nil
+				continue
+			}
+			if !m.command(cmd) {
+				return nil
+			}
+			draw()
+			dirty = false
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if e.Type == indiclient.EventTypeMessage {
+				m.addMessage(e)
+			}
+			dirty = true
+		case <-ticker.C:
+			if dirty || client.IsConnected() != m.connected {
+				draw()
+				dirty = false
+			}
+		}
+	}
+}
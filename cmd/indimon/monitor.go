@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/goastro/indiclient"
+)
+
+// ANSI escape sequences used to draw the screen.
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiReverse = "\x1b[7m"
+	ansiGray    = "\x1b[90m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiHome    = "\x1b[H"
+	ansiClear   = "\x1b[2J"
+)
+
+// logLine is a message shown in the message log.
+type logLine struct {
+	Timestamp time.Time
+	Device    string
+	Message   string
+	Severity  indiclient.MessageSeverity
+}
+
+// monitor holds what is shown on the screen. It is only used by the main loop, so it needs no locking.
+type monitor struct {
+	server    string
+	connected bool
+	devices   map[string]indiclient.Device
+	selected  string
+	scroll    int
+	messages  []logLine
+	// logSize is the number of messages kept and shown in the message log.
+	logSize int
+}
+
+func newMonitor(server string, logSize int) *monitor {
+	return &monitor{
+		server:  server,
+		devices: map[string]indiclient.Device{},
+		logSize: logSize,
+	}
+}
+
+// update replaces the device tree with snapshot, keeping the selected device if it still exists.
+func (m *monitor) update(snapshot map[string]indiclient.Device, connected bool) {
+	m.devices = snapshot
+	m.connected = connected
+
+	if _, ok := m.devices[m.selected]; !ok {
+		m.selected = ""
+		m.scroll = 0
+
+		if names := m.deviceNames(); len(names) > 0 {
+			m.selected = names[0]
+		}
+	}
+}
+
+// addMessage appends a message to the log, dropping the oldest once it holds logSize messages.
+func (m *monitor) addMessage(e indiclient.Event) {
+	m.messages = append(m.messages, logLine{
+		Timestamp: e.Timestamp,
+		Device:    e.Device,
+		Message:   e.Message,
+		Severity:  e.Severity,
+	})
+
+	if len(m.messages) > m.logSize {
+		m.messages = m.messages[len(m.messages)-m.logSize:]
+	}
+}
+
+// deviceNames returns the names of the devices, sorted.
+func (m *monitor) deviceNames() []string {
+	names := make([]string, 0, len(m.devices))
+	for name := range m.devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// command handles a line typed by the user, and returns false if the user asked to quit. "n" and "p" select the next
+// and previous device, a number selects a device by its position, "j" and "k" scroll the properties and "q" quits.
+func (m *monitor) command(cmd string) bool {
+	names := m.deviceNames()
+
+	current := 0
+	for i, name := range names {
+		if name == m.selected {
+			current = i
+		}
+	}
+
+	switch cmd = strings.TrimSpace(cmd); cmd {
+	case "q":
+		return false
+	case "n", "":
+		current++
+	case "p":
+		current--
+	case "j":
+		m.scroll += 10
+		return true
+	case "k":
+		m.scroll -= 10
+		if m.scroll < 0 {
+			m.scroll = 0
+		}
+		return true
+	default:
+		var n int
+		if _, err := fmt.Sscanf(cmd, "%d", &n); err != nil {
+			return true
+		}
+		current = n - 1
+	}
+
+	if len(names) == 0 {
+		return true
+	}
+
+	current = (current%len(names) + len(names)) % len(names)
+
+	if names[current] != m.selected {
+		m.selected = names[current]
+		m.scroll = 0
+	}
+
+	return true
+}
+
+// render draws the whole screen to w, which is width columns by height rows.
+func (m *monitor) render(w io.Writer, width, height int) {
+	status := ansiRed + "disconnected" + ansiReset
+	if m.connected {
+		status = ansiGreen + "connected" + ansiReset
+	}
+
+	fmt.Fprint(w, ansiHome+ansiClear)
+	fmt.Fprintf(w, "%sindimon%s %s %s\r\n", ansiBold, ansiReset, truncate(m.server, width-len("indimon disconnected")-2), status)
+
+	var tabs strings.Builder
+	used := 0
+	for i, name := range m.deviceNames() {
+		tab := fmt.Sprintf(" %d:%s ", i+1, name)
+		if used+len(tab) > width {
+			break
+		}
+		used += len(tab)
+
+		if name == m.selected {
+			tabs.WriteString(ansiReverse + tab + ansiReset)
+		} else {
+			tabs.WriteString(tab)
+		}
+	}
+	fmt.Fprintf(w, "%s\r\n", tabs.String())
+
+	logRows := m.logSize
+	if logRows > height/3 {
+		logRows = height / 3
+	}
+
+	// The header, tabs, log separator and help take a row each.
+	bodyRows := height - logRows - 4
+	if bodyRows < 0 {
+		bodyRows = 0
+	}
+
+	body := m.deviceLines(width)
+
+	if m.scroll > len(body)-bodyRows {
+		m.scroll = len(body) - bodyRows
+	}
+	if m.scroll < 0 {
+		m.scroll = 0
+	}
+
+	for i := 0; i < bodyRows; i++ {
+		if m.scroll+i < len(body) {
+			fmt.Fprint(w, body[m.scroll+i])
+		}
+		fmt.Fprint(w, "\r\n")
+	}
+
+	fmt.Fprintf(w, "%s%s%s\r\n", ansiGray, strings.Repeat("-", width), ansiReset)
+
+	messages := m.messages
+	if len(messages) > logRows {
+		messages = messages[len(messages)-logRows:]
+	}
+
+	for i := 0; i < logRows; i++ {
+		if i < len(messages) {
+			msg := messages[i]
+
+			source := msg.Device
+			if len(source) == 0 {
+				source = "indiserver"
+			}
+
+			line := fmt.Sprintf("%s %s: %s", msg.Timestamp.Format("15:04:05"), source, msg.Message)
+			fmt.Fprint(w, severityColor(msg.Severity)+truncate(line, width)+ansiReset)
+		}
+		fmt.Fprint(w, "\r\n")
+	}
+
+	fmt.Fprint(w, ansiGray+truncate("n/p/<number>: device  j/k: scroll  q: quit, then Enter", width)+ansiReset)
+}
+
+// deviceLines returns the lines showing the groups, properties and values of the selected device.
+func (m *monitor) deviceLines(width int) []string {
+	device, ok := m.devices[m.selected]
+	if !ok {
+		return []string{ansiGray + truncate("waiting for devices...", width) + ansiReset}
+	}
+
+	lines := []string{}
+
+	for _, group := range device.GroupedProperties() {
+		lines = append(lines, ansiBold+truncate("["+group.Name+"]", width)+ansiReset)
+
+		for _, prop := range group.Properties {
+			label := prop.Label
+			if len(label) == 0 {
+				label = prop.Name
+			}
+
+			lines = append(lines, fmt.Sprintf("  %s%s%s", stateColor(prop.State), truncate(fmt.Sprintf("%-5s %s (%s)", prop.State, label, prop.Name), width-2), ansiReset))
+
+			values, _ := device.Elements(prop.Name)
+			for _, v := range values {
+				lines = append(lines, "      "+formatValue(v, width-6))
+			}
+		}
+	}
+
+	return lines
+}
+
+// formatValue formats a single element, truncated to width columns.
+func formatValue(v indiclient.Value, width int) string {
+	label := v.ElementLabel()
+	if len(label) == 0 {
+		label = v.ElementName()
+	}
+
+	value := v.String()
+
+	switch v := v.(type) {
+	case indiclient.NumberValue:
+		if f, err := indiclient.ParseNumber(v.Value); err == nil {
+			value = indiclient.FormatNumber(v.Format, f)
+		}
+	case indiclient.SwitchValue:
+		if v.Value == indiclient.SwitchStateOn {
+			return ansiBold + truncate(fmt.Sprintf("%-24s [x]", label), width) + ansiReset
+		}
+		return truncate(fmt.Sprintf("%-24s [ ]", label), width)
+	case indiclient.LightValue:
+		return stateColor(v.Value) + truncate(fmt.Sprintf("%-24s %s", label, value), width) + ansiReset
+	case indiclient.BlobValue:
+		value = fmt.Sprintf("%s %d bytes", v.Format, v.Size)
+	}
+
+	return truncate(fmt.Sprintf("%-24s %s", label, value), width)
+}
+
+// stateColor returns the escape sequence for the color INDI recommends for state.
+func stateColor(state indiclient.PropertyState) string {
+	switch state {
+	case indiclient.PropertyStateOk:
+		return ansiGreen
+	case indiclient.PropertyStateBusy:
+		return ansiYellow
+	case indiclient.PropertyStateAlert:
+		return ansiRed
+	default:
+		return ansiGray
+	}
+}
+
+// severityColor returns the escape sequence for messages of severity.
+func severityColor(severity indiclient.MessageSeverity) string {
+	switch severity {
+	case indiclient.MessageSeverityError:
+		return ansiRed
+	case indiclient.MessageSeverityWarning:
+		return ansiYellow
+	case indiclient.MessageSeverityDebug:
+		return ansiGray
+	default:
+		return ""
+	}
+}
+
+// truncate shortens s to at most width characters. Control characters are replaced, since drivers sometimes send
+// messages with newlines that would break the layout.
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+
+	return string([]rune(s)[:width])
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goastro/indiclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDevices() map[string]indiclient.Device {
+	return map[string]indiclient.Device{
+		"Mount": {
+			Name: "Mount",
+			NumberProperties: map[string]indiclient.NumberProperty{
+				"EQUATORIAL_EOD_COORD": {
+					Name:   "EQUATORIAL_EOD_COORD",
+					Label:  "Eq. Coordinates",
+					Group:  "Main Control",
+					State:  indiclient.PropertyStateBusy,
+					Values: map[string]indiclient.NumberValue{"RA": {Name: "RA", Label: "RA (hh:mm:ss)", Value: "5.5", Format: "%010.6m"}},
+					Order:  []string{"RA"},
+				},
+			},
+			SwitchProperties: map[string]indiclient.SwitchProperty{
+				"TELESCOPE_PARK": {
+					Name:   "TELESCOPE_PARK",
+					Label:  "Parking",
+					Group:  "Main Control",
+					State:  indiclient.PropertyStateAlert,
+					Values: map[string]indiclient.SwitchValue{"PARK": {Name: "PARK", Label: "Park", Value: indiclient.SwitchStateOn}},
+					Order:  []string{"PARK"},
+				},
+			},
+			PropertyOrder: []string{"EQUATORIAL_EOD_COORD", "TELESCOPE_PARK"},
+		},
+		"Camera": {Name: "Camera"},
+	}
+}
+
+func Test_Monitor_Render(t *testing.T) {
+	m := newMonitor("localhost:7624", 2)
+	m.update(testDevices(), true)
+
+	assert.Equal(t, "Camera", m.selected)
+	assert.True(t, m.command("2"))
+	assert.Equal(t, "Mount", m.selected)
+
+	for _, msg := range []string{"first", "[WARNING] second", "third"} {
+		m.addMessage(indiclient.Event{Type: indiclient.EventTypeMessage, Device: "Mount", Message: msg, Severity: indiclient.MessageSeverityWarning, Timestamp: time.Now()})
+	}
+
+	var out bytes.Buffer
+	m.render(&out, 80, 24)
+	screen := out.String()
+
+	assert.Contains(t, screen, ansiReverse+" 2:Mount ")
+	assert.Contains(t, screen, "[Main Control]")
+	assert.Contains(t, screen, ansiYellow+"Busy  Eq. Coordinates (EQUATORIAL_EOD_COORD)")
+	assert.Contains(t, screen, ansiRed+"Alert Parking (TELESCOPE_PARK)")
+	assert.Contains(t, screen, "RA (hh:mm:ss)")
+	assert.Contains(t, screen, " 5:30:00")
+	assert.Contains(t, screen, ansiBold+"Park")
+	assert.NotContains(t, screen, "first")
+	assert.Contains(t, screen, "Mount: third")
+
+	// Every row fits the terminal.
+	rows := strings.Split(screen, "\r\n")
+	assert.Len(t, rows, 24)
+
+	assert.True(t, m.command("n"))
+	assert.Equal(t, "Camera", m.selected)
+	assert.False(t, m.command("q"))
+}
+
+func Test_Truncate(t *testing.T) {
+	assert.Equal(t, "ab", truncate("abc", 2))
+	assert.Equal(t, "a b", truncate("a\nb", 5))
+	assert.Equal(t, "", truncate("abc", 0))
+}
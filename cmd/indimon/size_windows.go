@@ -0,0 +1,6 @@
+package main
+
+// terminalSize is not supported on Windows, where the size given on the command line is used.
+func terminalSize() (width, height int, ok bool) {
+	return 0, 0, false
+}
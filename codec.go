@@ -0,0 +1,292 @@
+package indiclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrJSONMessage is returned when indiserver sends JSON that is not a message of the INDI JSON mapping. See JSONCodec.
+var ErrJSONMessage = errors.New("not an INDI JSON message")
+
+// Codec translates between INDI's XML and the format indiserver speaks on the wire. The client works in XML
+// throughout, so dry runs, outbound interceptors, raw handlers and ParserLimits see XML whatever the codec.
+type Codec interface {
+	// Encode returns the wire format of the XML of a command.
+	Encode(b []byte) ([]byte, error)
+	// Decoder returns a reader of the XML of the messages read from r. An error reading it ends the connection.
+	Decoder(r io.Reader) io.Reader
+}
+
+// XMLCodec is the default Codec, for indiserver's own XML protocol.
+type XMLCodec struct{}
+
+// Encode returns b.
+func (XMLCodec) Encode(b []byte) ([]byte, error) {
+	return b, nil
+}
+
+// Decoder returns r.
+func (XMLCodec) Decoder(r io.Reader) io.Reader {
+	return r
+}
+
+// JSONCodec is a Codec for gateways that map INDI to JSON. Each message is an object with one member, named after the
+// element, such as
+//
+//	{"setNumberVector":{"device":"Mount","name":"EQUATORIAL_EOD_COORD","state":"Ok","oneNumber":[{"name":"RA","value":"5.5"}]}}
+//
+// Attributes are members with string values; numbers and booleans are accepted from indiserver too. Child elements
+// are arrays of objects named after them, or a single object, and the text of an element is its "value" member.
+// Messages the client sends are separated by newlines.
+type JSONCodec struct{}
+
+// Encode converts the XML element in b to JSON.
+func (JSONCodec) Encode(b []byte) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+
+	var out bytes.Buffer
+
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if se, ok := t.(xml.StartElement); ok {
+			el, err := readXMLElement(d, se)
+			if err != nil {
+				return nil, err
+			}
+
+			out.WriteString(`{`)
+			writeJSONString(&out, se.Name.Local)
+			out.WriteString(`:`)
+			el.writeJSON(&out)
+			out.WriteString("}\n")
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// Decoder returns a reader of the XML of the JSON messages read from r.
+func (JSONCodec) Decoder(r io.Reader) io.Reader {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+
+	return &jsonReader{d: d}
+}
+
+// xmlElement is an element read by JSONCodec.Encode.
+type xmlElement struct {
+	attrs    []xml.Attr
+	text     string
+	names    []string // The names of the children, in the order they first appear.
+	children map[string][]*xmlElement
+}
+
+func readXMLElement(d *xml.Decoder, se xml.StartElement) (*xmlElement, error) {
+	el := &xmlElement{attrs: se.Copy().Attr, children: map[string][]*xmlElement{}}
+
+	var text strings.Builder
+
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tt := t.(type) {
+		case xml.StartElement:
+			child, err := readXMLElement(d, tt)
+			if err != nil {
+				return nil, err
+			}
+
+			name := tt.Name.Local
+			if _, ok := el.children[name]; !ok {
+				el.names = append(el.names, name)
+			}
+			el.children[name] = append(el.children[name], child)
+		case xml.CharData:
+			text.Write(tt)
+		case xml.EndElement:
+			el.text = text.String()
+			return el, nil
+		}
+	}
+}
+
+func (el *xmlElement) writeJSON(out *bytes.Buffer) {
+	out.WriteString(`{`)
+
+	first := true
+	comma := func() {
+		if !first {
+			out.WriteString(`,`)
+		}
+		first = false
+	}
+
+	for _, a := range el.attrs {
+		comma()
+		writeJSONString(out, a.Name.Local)
+		out.WriteString(`:`)
+		writeJSONString(out, a.Value)
+	}
+
+	for _, name := range el.names {
+		comma()
+		writeJSONString(out, name)
+		out.WriteString(`:[`)
+		for i, child := range el.children[name] {
+			if i > 0 {
+				out.WriteString(`,`)
+			}
+			child.writeJSON(out)
+		}
+		out.WriteString(`]`)
+	}
+
+	if len(el.names) == 0 && len(strings.TrimSpace(el.text)) > 0 {
+		comma()
+		out.WriteString(`"value":`)
+		writeJSONString(out, el.text)
+	}
+
+	out.WriteString(`}`)
+}
+
+func writeJSONString(out *bytes.Buffer, s string) {
+	// Marshaling a string cannot fail.
+	b, _ := json.Marshal(s)
+	out.Write(b)
+}
+
+// jsonReader converts the JSON messages read by d to XML, one message at a time.
+type jsonReader struct {
+	d   *json.Decoder
+	buf bytes.Buffer
+}
+
+func (r *jsonReader) Read(p []byte) (int, error) {
+	if r.buf.Len() == 0 {
+		r.buf.Reset()
+
+		if err := r.readMessage(); err != nil {
+			return 0, err
+		}
+	}
+
+	return r.buf.Read(p)
+}
+
+func (r *jsonReader) readMessage() error {
+	if err := expectDelim(r.d, '{'); err != nil {
+		return err
+	}
+
+	t, err := r.d.Token()
+	if err != nil {
+		return err
+	}
+
+	name, ok := t.(string)
+	if !ok {
+		return ErrJSONMessage
+	}
+
+	if err := expectDelim(r.d, '{'); err != nil {
+		return err
+	}
+
+	if err := r.writeElement(&r.buf, name); err != nil {
+		return err
+	}
+	r.buf.WriteByte('\n')
+
+	return expectDelim(r.d, '}')
+}
+
+// writeElement writes the XML of the element name to w. The '{' of its object has already been read.
+func (r *jsonReader) writeElement(w *bytes.Buffer, name string) error {
+	var attrs, children bytes.Buffer
+	var text string
+
+	for r.d.More() {
+		t, err := r.d.Token()
+		if err != nil {
+			return err
+		}
+		key := t.(string)
+
+		t, err = r.d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch v := t.(type) {
+		case nil:
+		case string, json.Number, bool:
+			if key == "value" {
+				text = fmt.Sprint(v)
+				continue
+			}
+
+			fmt.Fprintf(&attrs, ` %s="`, key)
+			xml.EscapeText(&attrs, []byte(fmt.Sprint(v)))
+			attrs.WriteString(`"`)
+		case json.Delim:
+			switch v {
+			case '{':
+				if err := r.writeElement(&children, key); err != nil {
+					return err
+				}
+			case '[':
+				for r.d.More() {
+					if err := expectDelim(r.d, '{'); err != nil {
+						return err
+					}
+					if err := r.writeElement(&children, key); err != nil {
+						return err
+					}
+				}
+				if err := expectDelim(r.d, ']'); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := expectDelim(r.d, '}'); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "<%s%s>", name, attrs.Bytes())
+	xml.EscapeText(w, []byte(text))
+	w.Write(children.Bytes())
+	fmt.Fprintf(w, "</%s>", name)
+
+	return nil
+}
+
+func expectDelim(d *json.Decoder, delim json.Delim) error {
+	t, err := d.Token()
+	if err != nil {
+		return err
+	}
+
+	if t != delim {
+		return ErrJSONMessage
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package indiclient
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+type pipeDialer struct {
+	conn net.Conn
+}
+
+func (d pipeDialer) Dial(network, address string) (io.ReadWriteCloser, error) {
+	return d.conn, nil
+}
+
+func Test_JSONCodec_Encode(t *testing.T) {
+	b, err := xml.Marshal(NewNumberVector{
+		Device:  "Mount",
+		Name:    "EQUATORIAL_EOD_COORD",
+		Numbers: []OneNumber{{Name: "RA", Value: "5.5"}, {Name: "DEC", Value: "-10"}},
+	})
+	require.NoError(t, err)
+
+	out, err := JSONCodec{}.Encode(b)
+	require.NoError(t, err)
+	assert.Equal(t, `{"newNumberVector":{"device":"Mount","name":"EQUATORIAL_EOD_COORD","oneNumber":[{"name":"RA","value":"5.5"},{"name":"DEC","value":"-10"}]}}`+"\n", string(out))
+
+	out, err = JSONCodec{}.Encode([]byte(`<getProperties version="1.7" device="A &quot;B&quot;"></getProperties>`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"getProperties":{"version":"1.7","device":"A \"B\""}}`+"\n", string(out))
+
+	_, err = JSONCodec{}.Encode([]byte(`<getProperties>`))
+	assert.Error(t, err)
+}
+
+func Test_JSONCodec_Decoder(t *testing.T) {
+	messages := `
+{"defNumberVector":{"device":"Mount","name":"EQUATORIAL_EOD_COORD","state":"Idle","perm":"rw","timeout":60,
+ "defNumber":[{"name":"RA","format":"%010.6m","min":0,"max":24,"step":0,"value":"0"},{"name":"DEC","value":"1 < 2"}]}}
+{"message":{"device":"Mount","message":"[INFO] Slewing"}}
+{"setSwitchVector":{"device":"Mount","name":"CONNECTION","state":"Ok","oneSwitch":{"name":"CONNECT","value":"On"}}}
+`
+
+	p := newParser(JSONCodec{}.Decoder(strings.NewReader(messages)), DefaultParserLimits, ParseModeStrict)
+
+	item, err := p.next()
+	require.NoError(t, err)
+	require.IsType(t, &DefNumberVector{}, item)
+	def := item.(*DefNumberVector)
+	assert.Equal(t, "EQUATORIAL_EOD_COORD", def.Name)
+	assert.Equal(t, 60, def.Timeout)
+	require.Len(t, def.Numbers, 2)
+	assert.Equal(t, "24", def.Numbers[0].Max)
+	assert.Equal(t, "1 < 2", def.Numbers[1].Value)
+
+	item, err = p.next()
+	require.NoError(t, err)
+	assert.Equal(t, "[INFO] Slewing", item.(*Message).Message)
+
+	item, err = p.next()
+	require.NoError(t, err)
+	require.IsType(t, &SetSwitchVector{}, item)
+	assert.Equal(t, SwitchStateOn, item.(*SetSwitchVector).Switches[0].Value)
+
+	_, err = p.next()
+	assert.Equal(t, io.EOF, err)
+
+	// Anything else ends the connection, since JSON cannot be resynchronized.
+	p = newParser(JSONCodec{}.Decoder(strings.NewReader(`["message"]`)), DefaultParserLimits, ParseModeStrict)
+	_, err = p.next()
+	assert.Equal(t, ErrJSONMessage, err)
+}
+
+func Test_ConnectWithOptions_Codec(t *testing.T) {
+	conn, server := net.Pipe()
+	defer server.Close()
+
+	c := newTestClient()
+
+	commands := make(chan string, 10)
+	go func() {
+		s := bufio.NewScanner(server)
+		for s.Scan() {
+			commands <- s.Text()
+		}
+	}()
+
+	require.NoError(t, c.ConnectWithOptions("tcp", "localhost:7624", ConnectOptions{Dialer: pipeDialer{conn: conn}, Codec: JSONCodec{}}))
+	defer c.Disconnect()
+
+	assert.Equal(t, `{"getProperties":{"version":"1.7"}}`, <-commands)
+
+	_, err := server.Write([]byte(`{"defSwitchVector":{"device":"Mount","name":"CONNECTION","state":"Idle","perm":"rw","rule":"OneOfMany","defSwitch":[{"name":"CONNECT","value":"Off"},{"name":"DISCONNECT","value":"On"}]}}`))
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return c.SwitchPropertySet("Mount", "CONNECTION") })
+
+	// The reply never comes, so do not wait long for it.
+	c.SetCommandTimeout(100 * time.Millisecond)
+	go c.SetSwitchValue("Mount", "CONNECTION", []string{"CONNECT"}, []SwitchState{SwitchStateOn})
+
+	assert.Equal(t, `{"newSwitchVector":{"device":"Mount","name":"CONNECTION","oneSwitch":[{"name":"CONNECT","value":"On"}]}}`, <-commands)
+}
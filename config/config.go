@@ -0,0 +1,381 @@
+// Package config builds an INDIClient, with its logger, aliases, BLOB policies and hooks, from a configuration file
+// in YAML, TOML or JSON, so programs do not each need flags for the client's many options:
+//
+//	cfg, err := config.Load(afero.NewOsFs(), "indiclient.yaml")
+//	...
+//	c, err := config.New(cfg, nil, afero.NewOsFs())
+//	...
+//	defer c.Close()
+//
+//	err = c.ConnectProfile()
+//
+// A YAML file looks like this; the TOML and JSON forms use the same keys:
+//
+//	server: indi://observatory.local
+//	bufferSize: 200
+//	commandTimeout: 30s
+//	logging:
+//	  level: warn
+//	  file: /var/log/indiclient.log
+//	aliases:
+//	  Main Scope: EQMod Mount
+//	blobPolicies:
+//	  - device: CCD Simulator
+//	    value: Also
+//	hooks:
+//	  - device: Weather Watcher
+//	    property: WEATHER_STATUS
+//	    state: Alert
+//	    command: close-roof.sh
+//
+// Load reads the scalar settings from environment variables named EnvPrefix and the setting in upper snake case,
+// such as INDICLIENT_SERVER and INDICLIENT_LOG_LEVEL, in preference to the file. YAML is parsed with gopkg.in/yaml.v3
+// and TOML with github.com/BurntSushi/toml.
+//
+// Long-running processes such as gateways can change BLOB policies, aliases, rate limits and the access policy
+// without dropping the connection to indiserver, with Client.Reload or, on SIGHUP, Client.ReloadOnSignal:
+//
+//	stop := c.ReloadOnSignal("indiclient.yaml")
+//	defer stop()
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+
+	"github.com/goastro/indiclient"
+)
+
+// EnvPrefix starts the names of the environment variables that override settings in the file.
+const EnvPrefix = "INDICLIENT_"
+
+// DefaultBufferSize is the buffer size used when the file does not set one.
+const DefaultBufferSize = 100
+
+// ErrUnsupportedFormat is returned for a file whose extension is not .yaml, .yml, .toml or .json.
+var ErrUnsupportedFormat = errors.New("unsupported configuration format")
+
+// Config is the configuration of a client. The zero value connects to localhost with the client's defaults.
+type Config struct {
+	// Server is the indiserver address, as accepted by indiclient.ParseAddress.
+	Server string `json:"server"`
+	// Proxy, if set, is the URL of an HTTP proxy to connect through. See indiclient.HTTPProxyDialer.
+	Proxy string `json:"proxy"`
+
+	BufferSize     int                        `json:"bufferSize"`
+	BlobRetention  int                        `json:"blobRetention"`
+	MessageHistory int                        `json:"messageHistory"`
+	CommandTimeout Duration                   `json:"commandTimeout"`
+	ParserLimits   indiclient.ParserLimits    `json:"parserLimits"`
+	BlobPolicies   []indiclient.BlobPolicy    `json:"blobPolicies"`
+	Watched        []indiclient.WatchedDevice `json:"watched"`
+	// Aliases maps device aliases to the driver's device names. See INDIClient.SetDeviceAlias.
+	Aliases map[string]string `json:"aliases"`
+	// AccessPolicy restricts which properties may be written. See INDIClient.SetAccessPolicy.
+	AccessPolicy indiclient.AccessPolicy `json:"accessPolicy"`
+	// BlobBandwidth limits the bandwidth BLOBs use. See INDIClient.SetBlobBandwidth.
+	BlobBandwidth indiclient.BlobBandwidthOptions `json:"blobBandwidth"`
+	// BlobMapping reads large BLOBs through memory-mapped files. See INDIClient.SetBlobMapping.
+	BlobMapping indiclient.BlobMappingOptions `json:"blobMapping"`
+	// BlobWorkers decodes and stores BLOBs off the goroutine that handles messages. See INDIClient.SetBlobWorkers.
+	BlobWorkers indiclient.BlobWorkerOptions `json:"blobWorkers"`
+
+	Logging Logging `json:"logging"`
+
+	Hooks []Hook `json:"hooks"`
+	// HookConcurrency is how many hooks may run at once. See indiclient.HookEngineOptions.
+	HookConcurrency int `json:"hookConcurrency"`
+}
+
+// Logging configures the client's logger.
+type Logging struct {
+	// Level is debug, info, warn or error. It defaults to info.
+	Level string `json:"level"`
+	// File is appended to, if set. The log goes to standard error otherwise.
+	File string `json:"file"`
+}
+
+// Hook is an indiclient.Hook that runs a command.
+type Hook struct {
+	Device   string                   `json:"device"`
+	Property string                   `json:"property"`
+	Element  string                   `json:"element"`
+	State    indiclient.PropertyState `json:"state"`
+	Above    *float64                 `json:"above"`
+	Below    *float64                 `json:"below"`
+	Debounce Duration                 `json:"debounce"`
+	Command  string                   `json:"command"`
+	Timeout  Duration                 `json:"timeout"`
+}
+
+// Duration is a time.Duration written as a string such as "1m30s", or a number of seconds.
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		v, err := time.ParseDuration(s)
+		*d = Duration(v)
+		return err
+	}
+
+	var seconds float64
+	if err := json.Unmarshal(b, &seconds); err != nil {
+		return fmt.Errorf("invalid duration %s", b)
+	}
+
+	*d = Duration(seconds * float64(time.Second))
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Load reads the configuration at path on fs, in the format given by its extension, then applies the overrides in
+// the environment.
+func Load(fs afero.Fs, path string) (Config, error) {
+	b, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg, err := Parse(filepath.Ext(path), b)
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+
+	err = cfg.ApplyEnv(os.LookupEnv)
+
+	return cfg, err
+}
+
+// Parse parses a configuration in format, which is yaml, yml, toml or json with or without a leading dot. Unknown
+// keys are an error, so that misspelled settings are not silently ignored.
+func Parse(format string, data []byte) (Config, error) {
+	cfg := Config{}
+
+	var v interface{}
+	var err error
+
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "yaml", "yml":
+		v, err = parseYAML(data)
+	case "toml":
+		v, err = parseTOML(data)
+	case "json":
+		err = json.Unmarshal(data, &v)
+	default:
+		return cfg, ErrUnsupportedFormat
+	}
+
+	if err != nil {
+		return cfg, err
+	}
+
+	if v == nil {
+		return cfg, nil
+	}
+
+	// YAML and TOML are parsed into maps and slices like encoding/json's, so every format is decoded the same way.
+	b, err := json.Marshal(v)
+	if err != nil {
+		return cfg, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+
+	err = d.Decode(&cfg)
+
+	return cfg, err
+}
+
+func parseYAML(data []byte) (interface{}, error) {
+	var v interface{}
+	err := yaml.Unmarshal(data, &v)
+
+	return v, err
+}
+
+func parseTOML(data []byte) (interface{}, error) {
+	v := map[string]interface{}{}
+	_, err := toml.Decode(string(data), &v)
+
+	return v, err
+}
+
+// ApplyEnv overrides settings with the environment variables found by lookup, such as os.LookupEnv.
+func (cfg *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	strs := map[string]*string{
+		"SERVER":    &cfg.Server,
+		"PROXY":     &cfg.Proxy,
+		"LOG_LEVEL": &cfg.Logging.Level,
+		"LOG_FILE":  &cfg.Logging.File,
+	}
+
+	for name, p := range strs {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			*p = v
+		}
+	}
+
+	ints := map[string]*int{
+		"BUFFER_SIZE":      &cfg.BufferSize,
+		"BLOB_RETENTION":   &cfg.BlobRetention,
+		"MESSAGE_HISTORY":  &cfg.MessageHistory,
+		"HOOK_CONCURRENCY": &cfg.HookConcurrency,
+	}
+
+	for name, p := range ints {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s%s: %w", EnvPrefix, name, err)
+			}
+			*p = i
+		}
+	}
+
+	if v, ok := lookup(EnvPrefix + "COMMAND_TIMEOUT"); ok {
+		b := []byte(strconv.Quote(v))
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			b = []byte(v)
+		}
+
+		if err := cfg.CommandTimeout.UnmarshalJSON(b); err != nil {
+			return fmt.Errorf("%sCOMMAND_TIMEOUT: %w", EnvPrefix, err)
+		}
+	}
+
+	return nil
+}
+
+// Profile returns the indiclient.Profile the client is created from.
+func (cfg Config) Profile() (indiclient.Profile, error) {
+	p := indiclient.Profile{
+		BufferSize:    cfg.BufferSize,
+		BlobRetention: cfg.BlobRetention,
+		ParserLimits:  cfg.ParserLimits,
+		BlobPolicies:  cfg.BlobPolicies,
+		Watched:       cfg.Watched,
+		Aliases:       cfg.Aliases,
+	}
+
+	if p.BufferSize <= 0 {
+		p.BufferSize = DefaultBufferSize
+	}
+
+	server := cfg.Server
+	if len(server) == 0 {
+		server = "localhost:" + indiclient.DefaultPort
+	}
+
+	var err error
+	p.Network, p.Address, err = indiclient.ParseAddress(server)
+
+	return p, err
+}
+
+// Client is an INDIClient created by New, with the logger and hooks it was configured with.
+type Client struct {
+	*indiclient.INDIClient
+
+	Log logging.Logger
+	// Hooks runs the configured hooks, and is nil if there are none.
+	Hooks *indiclient.HookEngine
+
+	fs      afero.Fs
+	logFile io.Closer
+
+	mu      sync.Mutex
+	cfg     Config   // Protected by mu
+	hookIDs []string // Protected by mu
+}
+
+// New creates the client configured by cfg. dialer, if nil, is chosen from Server and Proxy. The client is not
+// connected; call ConnectProfile to connect it and restore its watched devices and BLOB policies. Remember to call
+// Close when you are done with it.
+func New(cfg Config, dialer indiclient.Dialer, fs afero.Fs) (*Client, error) {
+	p, err := cfg.Profile()
+	if err != nil {
+		return nil, err
+	}
+
+	if dialer == nil {
+		switch {
+		case len(cfg.Proxy) > 0:
+			dialer = indiclient.HTTPProxyDialer{Proxy: cfg.Proxy}
+		case p.Network == "unix":
+			dialer = indiclient.UnixDialer{}
+		default:
+			dialer = indiclient.NetworkDialer{}
+		}
+	}
+
+	c := &Client{fs: fs, cfg: cfg}
+
+	var out io.Writer = os.Stderr
+	if len(cfg.Logging.File) > 0 {
+		f, err := fs.OpenFile(cfg.Logging.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		out, c.logFile = f, f
+	}
+
+	c.Log = logging.NewLogger(out, logging.JSONFormatter{}, strings.ToUpper(cfg.Logging.Level))
+
+	// The settings that can change while connected are applied the same way Reload applies them.
+	c.INDIClient = indiclient.FromProfile(c.Log, dialer, fs, indiclient.Profile{
+		Network:      p.Network,
+		Address:      p.Address,
+		BufferSize:   p.BufferSize,
+		ParserLimits: p.ParserLimits,
+		Watched:      p.Watched,
+	})
+
+	c.mu.Lock()
+	err = c.apply(cfg)
+	c.mu.Unlock()
+
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Close stops the hooks, disconnects the client and closes the log file.
+func (c *Client) Close() error {
+	if c.Hooks != nil {
+		c.Hooks.Close()
+	}
+
+	c.Disconnect()
+
+	if c.logFile != nil {
+		return c.logFile.Close()
+	}
+
+	return nil
+}
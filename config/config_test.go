@@ -0,0 +1,257 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/config"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+const yamlConfig = `
+# Observatory client
+server: indi://observatory.local
+bufferSize: 200
+commandTimeout: 30s
+parserLimits:
+  maxMessageSize: 1048576
+logging:
+  level: warn
+aliases:
+  Main Scope: "EQMod Mount"   # the mount's driver name
+  'Guide #2': Guide Camera
+blobPolicies:
+- device: CCD Simulator
+  value: Also
+- device: Guide Camera
+  property: CCD1
+  value: Never
+watched: [{}]
+hooks:
+  - device: Weather Watcher
+    property: WEATHER_STATUS
+    state: Alert
+    command: close-roof.sh
+  - device: CCD Simulator
+    property: CCD_TEMPERATURE
+    element: CCD_TEMPERATURE_VALUE
+    above: 30
+    debounce: 10
+    command: "echo 'too hot'"
+`
+
+const tomlConfig = `
+# Observatory client
+server = "indi://observatory.local"
+bufferSize = 200
+commandTimeout = "30s"
+parserLimits.maxMessageSize = 1_048_576
+watched = [
+  {},
+]
+
+[logging]
+level = "warn"
+
+[aliases]
+"Main Scope" = "EQMod Mount" # the mount's driver name
+'Guide #2' = "Guide Camera"
+
+[[blobPolicies]]
+device = "CCD Simulator"
+value = "Also"
+
+[[blobPolicies]]
+device = "Guide Camera"
+property = "CCD1"
+value = "Never"
+
+[[hooks]]
+device = "Weather Watcher"
+property = "WEATHER_STATUS"
+state = "Alert"
+command = "close-roof.sh"
+
+[[hooks]]
+device = "CCD Simulator"
+property = "CCD_TEMPERATURE"
+element = "CCD_TEMPERATURE_VALUE"
+above = 30
+debounce = 10
+command = "echo 'too hot'"
+`
+
+const jsonConfig = `{
+	"server": "indi://observatory.local",
+	"bufferSize": 200,
+	"commandTimeout": "30s",
+	"parserLimits": {"maxMessageSize": 1048576},
+	"watched": [{}],
+	"logging": {"level": "warn"},
+	"aliases": {"Main Scope": "EQMod Mount", "Guide #2": "Guide Camera"},
+	"blobPolicies": [
+		{"device": "CCD Simulator", "value": "Also"},
+		{"device": "Guide Camera", "property": "CCD1", "value": "Never"}
+	],
+	"hooks": [
+		{"device": "Weather Watcher", "property": "WEATHER_STATUS", "state": "Alert", "command": "close-roof.sh"},
+		{"device": "CCD Simulator", "property": "CCD_TEMPERATURE", "element": "CCD_TEMPERATURE_VALUE", "above": 30, "debounce": 10, "command": "echo 'too hot'"}
+	]
+}`
+
+func Test_Parse(t *testing.T) {
+	above := 30.0
+
+	expected := config.Config{
+		Server:         "indi://observatory.local",
+		BufferSize:     200,
+		CommandTimeout: config.Duration(30 * time.Second),
+		ParserLimits:   indiclient.ParserLimits{MaxMessageSize: 1048576},
+		Watched:        []indiclient.WatchedDevice{{}},
+		Logging:        config.Logging{Level: "warn"},
+		Aliases:        map[string]string{"Main Scope": "EQMod Mount", "Guide #2": "Guide Camera"},
+		BlobPolicies: []indiclient.BlobPolicy{
+			{Device: "CCD Simulator", Value: indiclient.BlobEnableAlso},
+			{Device: "Guide Camera", Property: "CCD1", Value: indiclient.BlobEnableNever},
+		},
+		Hooks: []config.Hook{
+			{Device: "Weather Watcher", Property: "WEATHER_STATUS", State: indiclient.PropertyStateAlert, Command: "close-roof.sh"},
+			{Device: "CCD Simulator", Property: "CCD_TEMPERATURE", Element: "CCD_TEMPERATURE_VALUE", Above: &above,
+				Debounce: config.Duration(10 * time.Second), Command: "echo 'too hot'"},
+		},
+	}
+
+	for format, data := range map[string]string{".yaml": yamlConfig, "toml": tomlConfig, "JSON": jsonConfig} {
+		cfg, err := config.Parse(format, []byte(data))
+		require.NoError(t, err, format)
+		assert.Equal(t, expected, cfg, format)
+	}
+}
+
+func Test_Parse_Errors(t *testing.T) {
+	_, err := config.Parse("yaml", []byte("server: localhost\nbuffersize: [1"))
+	assert.Error(t, err)
+
+	_, err = config.Parse("yaml", []byte("server: localhost\nlogging:\n  level: info\n    file: x"))
+	assert.Error(t, err)
+
+	_, err = config.Parse("yaml", []byte("sever: localhost"))
+	assert.Error(t, err, "unknown keys are an error")
+
+	_, err = config.Parse("toml", []byte("server = localhost"))
+	assert.Error(t, err)
+
+	_, err = config.Parse("toml", []byte("server = \"a\"\nserver = \"b\""))
+	assert.Error(t, err)
+
+	_, err = config.Parse("ini", []byte("server=localhost"))
+	assert.Equal(t, config.ErrUnsupportedFormat, err)
+
+	cfg, err := config.Parse("yaml", []byte("# nothing set\n"))
+	require.NoError(t, err)
+	assert.Equal(t, config.Config{}, cfg)
+}
+
+func Test_ApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"INDICLIENT_SERVER":          "unix:///tmp/indiserver",
+		"INDICLIENT_BUFFER_SIZE":     "50",
+		"INDICLIENT_LOG_LEVEL":       "debug",
+		"INDICLIENT_COMMAND_TIMEOUT": "5",
+	}
+
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	cfg := config.Config{Server: "localhost:7624", BlobRetention: 3}
+	require.NoError(t, cfg.ApplyEnv(lookup))
+
+	assert.Equal(t, "unix:///tmp/indiserver", cfg.Server)
+	assert.Equal(t, 50, cfg.BufferSize)
+	assert.Equal(t, 3, cfg.BlobRetention)
+	assert.Equal(t, "debug", cfg.Logging.Level)
+	assert.Equal(t, config.Duration(5*time.Second), cfg.CommandTimeout)
+
+	p, err := cfg.Profile()
+	require.NoError(t, err)
+	assert.Equal(t, "unix", p.Network)
+	assert.Equal(t, "/tmp/indiserver", p.Address)
+
+	env["INDICLIENT_MESSAGE_HISTORY"] = "lots"
+	assert.Error(t, cfg.ApplyEnv(lookup))
+}
+
+func Test_Load(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	os.Setenv("INDICLIENT_BUFFER_SIZE", "300")
+	defer os.Unsetenv("INDICLIENT_BUFFER_SIZE")
+
+	for path, data := range map[string]string{
+		"/etc/indiclient.yaml": yamlConfig,
+		"/etc/indiclient.yml":  yamlConfig,
+		"/etc/indiclient.toml": tomlConfig,
+		"/etc/indiclient.json": jsonConfig,
+	} {
+		require.NoError(t, afero.WriteFile(fs, path, []byte(data), 0644))
+
+		cfg, err := config.Load(fs, path)
+		require.NoError(t, err, path)
+		assert.Equal(t, 300, cfg.BufferSize, path)
+		assert.Equal(t, "Guide Camera", cfg.Aliases["Guide #2"], path)
+		assert.Equal(t, config.Duration(30*time.Second), cfg.CommandTimeout, path)
+		assert.Len(t, cfg.Hooks, 2, path)
+	}
+
+	_, err := config.Load(fs, "/etc/missing.yaml")
+	assert.Error(t, err)
+
+	require.NoError(t, afero.WriteFile(fs, "/etc/indiclient.ini", []byte("server=localhost"), 0644))
+	_, err = config.Load(fs, "/etc/indiclient.ini")
+	assert.True(t, errors.Is(err, config.ErrUnsupportedFormat))
+}
+
+func Test_New(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	cfg, err := config.Parse("yaml", []byte(`
+server: localhost:7624
+logging:
+  level: error
+  file: /var/log/indiclient.log
+aliases:
+  Main Scope: Telescope Simulator
+hooks:
+  - device: Main Scope
+    property: EQUATORIAL_EOD_COORD
+    command: "true"
+`))
+	require.NoError(t, err)
+
+	c, err := config.New(cfg, simulators.NewServer(simulators.NewTelescope("Telescope Simulator")), fs)
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NotNil(t, c.Hooks)
+	require.NoError(t, c.ConnectProfile())
+
+	testutil.WaitFor(t, func() bool { return c.SwitchPropertySet("Main Scope", "CONNECTION") })
+
+	exists, err := afero.Exists(fs, "/var/log/indiclient.log")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	cfg.Hooks[0].Property = ""
+	_, err = config.New(cfg, simulators.NewServer(), fs)
+	assert.Error(t, err)
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// Reload applies cfg to the client without dropping its connection: BLOB policies, aliases, the access policy, BLOB
+// bandwidth, BLOB mapping, BLOB retention, message history, the command timeout and hooks. Server, Proxy, BufferSize,
+// ParserLimits, Watched, Logging and HookConcurrency only take effect in a new client, and BlobWorkers the next time
+// it connects; a warning is logged if they changed. Every setting is applied even if one fails, and the first error
+// is returned.
+func (c *Client) Reload(cfg Config) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if restart := restartSettings(c.cfg, cfg); len(restart) > 0 {
+		c.Log.WithField("settings", restart).Warn("configuration changes need a new client to take effect")
+	}
+
+	return c.apply(cfg)
+}
+
+// ReloadFile loads the configuration at path, with the overrides in the environment, and reloads it. See Reload.
+func (c *Client) ReloadFile(path string) error {
+	cfg, err := Load(c.fs, path)
+	if err != nil {
+		return err
+	}
+
+	return c.Reload(cfg)
+}
+
+// ReloadOnSignal reloads the configuration at path whenever the process receives one of sigs, SIGHUP if there are
+// none, as long-running daemons do. Errors are logged, and the previous settings stay in effect. Call the returned
+// function to stop.
+func (c *Client) ReloadOnSignal(path string, sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(signals, sigs...)
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				if err := c.ReloadFile(path); err != nil {
+					c.Log.WithField("path", path).WithError(err).Warn("error reloading configuration")
+				} else {
+					c.Log.WithField("path", path).Info("configuration reloaded")
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+// apply applies the settings that can change while connected. Only call when Client.mu is locked.
+func (c *Client) apply(cfg Config) error {
+	var first error
+
+	fail := func(err error) {
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	// Aliases first, so policies can name devices by their new aliases.
+	fail(c.setAliases(cfg.Aliases))
+	fail(c.SetBlobPolicies(cfg.BlobPolicies))
+
+	c.SetAccessPolicy(cfg.AccessPolicy)
+	c.SetBlobBandwidth(cfg.BlobBandwidth)
+	c.SetBlobMapping(cfg.BlobMapping)
+	c.SetBlobWorkers(cfg.BlobWorkers)
+	c.SetBlobRetention(cfg.BlobRetention)
+	c.SetCommandTimeout(time.Duration(cfg.CommandTimeout))
+
+	if cfg.MessageHistory > 0 {
+		c.SetMessageHistory(cfg.MessageHistory)
+	} else {
+		c.SetMessageHistory(indiclient.DefaultMessageHistory)
+	}
+
+	// Hooks are only replaced when they change, so the conditions of unchanged hooks are not reset.
+	if c.Hooks == nil || !reflect.DeepEqual(c.cfg.Hooks, cfg.Hooks) {
+		fail(c.setHooks(cfg))
+	}
+
+	c.cfg = cfg
+
+	return first
+}
+
+// setAliases replaces the client's aliases with aliases.
+func (c *Client) setAliases(aliases map[string]string) error {
+	for alias, deviceName := range c.DeviceAliases() {
+		if aliases[alias] != deviceName {
+			if err := c.RemoveDeviceAlias(alias); err != nil {
+				return err
+			}
+		}
+	}
+
+	for alias, deviceName := range aliases {
+		if err := c.SetDeviceAlias(alias, deviceName); err != nil {
+			return fmt.Errorf("alias %q: %w", alias, err)
+		}
+	}
+
+	return nil
+}
+
+// setHooks replaces the hooks with those of cfg, creating the HookEngine the first time there are any. Only call
+// when Client.mu is locked.
+func (c *Client) setHooks(cfg Config) error {
+	if c.Hooks == nil {
+		if len(cfg.Hooks) == 0 {
+			return nil
+		}
+
+		e, err := indiclient.NewHookEngine(c.INDIClient, indiclient.HookEngineOptions{MaxConcurrent: cfg.HookConcurrency})
+		if err != nil {
+			return err
+		}
+		c.Hooks = e
+	}
+
+	for _, id := range c.hookIDs {
+		c.Hooks.RemoveHook(id)
+	}
+	c.hookIDs = nil
+
+	for i, h := range cfg.Hooks {
+		id, err := c.Hooks.AddHook(indiclient.Hook{
+			Device:   h.Device,
+			Property: h.Property,
+			Element:  h.Element,
+			State:    h.State,
+			Above:    h.Above,
+			Below:    h.Below,
+			Debounce: time.Duration(h.Debounce),
+			Command:  h.Command,
+			Timeout:  time.Duration(h.Timeout),
+		})
+		if err != nil {
+			return fmt.Errorf("hook %d: %w", i, err)
+		}
+
+		c.hookIDs = append(c.hookIDs, id)
+	}
+
+	return nil
+}
+
+// restartSettings returns the names of the settings that differ between old and cfg and that Reload cannot apply.
+func restartSettings(old, cfg Config) []string {
+	var names []string
+
+	for _, s := range []struct {
+		name    string
+		changed bool
+	}{
+		{"server", old.Server != cfg.Server},
+		{"proxy", old.Proxy != cfg.Proxy},
+		{"bufferSize", old.BufferSize != cfg.BufferSize},
+		{"parserLimits", old.ParserLimits != cfg.ParserLimits},
+		{"blobWorkers", old.BlobWorkers != cfg.BlobWorkers},
+		{"watched", !reflect.DeepEqual(old.Watched, cfg.Watched)},
+		{"logging", old.Logging != cfg.Logging},
+		{"hookConcurrency", old.HookConcurrency != cfg.HookConcurrency},
+	} {
+		if s.changed {
+			names = append(names, s.name)
+		}
+	}
+
+	return names
+}
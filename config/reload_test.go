@@ -0,0 +1,94 @@
+package config_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/config"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func Test_Reload(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	focuser := simulators.NewFocuser("Focuser Simulator")
+	focuser.Speed = 100000
+	server := simulators.NewServer(focuser, simulators.NewCCD("CCD Simulator"))
+
+	cfg, err := config.Parse("yaml", []byte(`
+logging:
+  level: error
+aliases:
+  focuser: Focuser Simulator
+accessPolicy:
+  deny:
+    - property: ABS_FOCUS_POSITION
+`))
+	require.NoError(t, err)
+
+	c, err := config.New(cfg, server, fs)
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.ConnectProfile())
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == 2 })
+	require.NoError(t, c.SetSwitchValue("focuser", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn}))
+	testutil.WaitFor(t, func() bool { return c.NumberPropertySet("focuser", "ABS_FOCUS_POSITION") })
+
+	err = c.SetNumber("focuser", "ABS_FOCUS_POSITION", map[string]float64{"FOCUS_ABSOLUTE_POSITION": 1000})
+	assert.True(t, errors.Is(err, indiclient.ErrForbidden))
+
+	require.NoError(t, afero.WriteFile(fs, "/etc/indiclient.toml", []byte(`
+[logging]
+level = "error"
+
+[aliases]
+main-focuser = "Focuser Simulator"
+camera = "CCD Simulator"
+
+[blobBandwidth]
+maxRate = 1_000_000
+
+[blobMapping]
+enabled = true
+minSize = 67_108_864
+
+[[blobPolicies]]
+device = "camera"
+value = "Also"
+
+[[hooks]]
+device = "camera"
+property = "CCD_TEMPERATURE"
+command = "true"
+`), 0644))
+
+	require.NoError(t, c.ReloadFile("/etc/indiclient.toml"))
+
+	assert.True(t, c.IsConnected())
+	assert.Equal(t, map[string]string{"main-focuser": "Focuser Simulator", "camera": "CCD Simulator"}, c.DeviceAliases())
+	assert.Equal(t, indiclient.AccessPolicy{}, c.AccessPolicy())
+	assert.Equal(t, int64(1000000), c.BlobBandwidth().MaxRate)
+	assert.Equal(t, indiclient.BlobMappingOptions{Enabled: true, MinSize: 64 << 20}, c.BlobMapping())
+	assert.Equal(t, []indiclient.BlobPolicy{{Device: "CCD Simulator", Value: indiclient.BlobEnableAlso}}, c.Profile().BlobPolicies)
+	require.NotNil(t, c.Hooks)
+
+	err = c.SetNumber("main-focuser", "ABS_FOCUS_POSITION", map[string]float64{"FOCUS_ABSOLUTE_POSITION": 1000})
+	assert.NoError(t, err)
+
+	// A bad file leaves the settings as they were.
+	require.NoError(t, afero.WriteFile(fs, "/etc/indiclient.toml", []byte("aliases = 3"), 0644))
+	assert.Error(t, c.ReloadFile("/etc/indiclient.toml"))
+	assert.Equal(t, "CCD Simulator", c.DeviceAliases()["camera"])
+
+	// The other settings are applied even if one fails.
+	cfg.Aliases = map[string]string{"": "CCD Simulator"}
+	err = c.Reload(cfg)
+	assert.True(t, errors.Is(err, indiclient.ErrInvalidAlias))
+	assert.Len(t, c.AccessPolicy().Deny, 1)
+}
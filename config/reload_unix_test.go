@@ -0,0 +1,42 @@
+//go:build !windows
+// +build !windows
+
+package config_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/config"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func Test_ReloadOnSignal(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/etc/indiclient.yaml", []byte("logging:\n  level: error\n"), 0644))
+
+	cfg, err := config.Load(fs, "/etc/indiclient.yaml")
+	require.NoError(t, err)
+
+	c, err := config.New(cfg, simulators.NewServer(), fs)
+	require.NoError(t, err)
+	defer c.Close()
+
+	stop := c.ReloadOnSignal("/etc/indiclient.yaml", syscall.SIGUSR1)
+	defer stop()
+
+	require.NoError(t, afero.WriteFile(fs, "/etc/indiclient.yaml", []byte("logging:\n  level: error\naliases:\n  camera: CCD Simulator\n"), 0644))
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+
+	testutil.WaitFor(t, func() bool { return len(c.DeviceAliases()) == 1 })
+	assert.Equal(t, "CCD Simulator", c.DeviceAliases()["camera"])
+
+	stop()
+	stop()
+}
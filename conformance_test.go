@@ -0,0 +1,227 @@
+//go:build integration
+// +build integration
+
+// The conformance tests run the client against a real indiserver with the INDI simulator drivers, to catch protocol
+// regressions that tests with canned XML miss. They need indiserver and the drivers on the PATH (or INDISERVER set to
+// the indiserver binary), and are only built with the integration tag:
+//
+//	go test -tags integration -run Conformance ./...
+
+package indiclient_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+const (
+	conformanceTelescope = "Telescope Simulator"
+	conformanceCCD       = "CCD Simulator"
+	conformanceFocuser   = "Focuser Simulator"
+)
+
+// startIndiserver runs indiserver on a free port with the simulator drivers, and returns its address and a function
+// to stop it.
+func startIndiserver(t *testing.T) (string, func()) {
+	bin := os.Getenv("INDISERVER")
+	if len(bin) == 0 {
+		bin = "indiserver"
+	}
+
+	path, err := exec.LookPath(bin)
+	if err != nil {
+		t.Skipf("indiserver not found: %s", err.Error())
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	l.Close()
+
+	cmd := exec.Command(path, "-p", port, "indi_simulator_telescope", "indi_simulator_ccd", "indi_simulator_focus")
+	cmd.Stdout = ioutil.Discard
+	cmd.Stderr = ioutil.Discard
+
+	require.NoError(t, cmd.Start())
+
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+
+	address := net.JoinHostPort("127.0.0.1", port)
+
+	started := testutil.WaitUntil(10*time.Second, func() bool {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	})
+
+	if !started {
+		stop()
+		t.Fatal("indiserver did not start")
+	}
+
+	return address, stop
+}
+
+// connectConformance starts indiserver and connects a client to it. Call the returned function to disconnect and stop
+// indiserver.
+func connectConformance(t *testing.T) (*indiclient.INDIClient, func()) {
+	address, stopServer := startIndiserver(t)
+
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	c := indiclient.NewINDIClient(log, indiclient.NetworkDialer{}, afero.NewMemMapFs(), 1000)
+
+	stop := func() {
+		c.Disconnect()
+		stopServer()
+	}
+
+	if err := c.Connect("tcp", address); err != nil {
+		stopServer()
+		t.Fatal(err)
+	}
+
+	require.NoError(t, c.GetProperties("", ""))
+
+	for _, d := range []string{conformanceTelescope, conformanceCCD, conformanceFocuser} {
+		name := d
+		if !testutil.WaitUntil(10*time.Second, func() bool { return c.SwitchPropertySet(name, "CONNECTION") }) {
+			stop()
+			t.Fatal("timed out waiting for " + name)
+		}
+	}
+
+	return c, stop
+}
+
+func connectDevice(t *testing.T, c *indiclient.INDIClient, deviceName, propName string) {
+	err := c.SetSwitchValue(deviceName, "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+	require.NoError(t, err)
+
+	if !testutil.WaitUntil(10*time.Second, func() bool {
+		return c.NumberPropertySet(deviceName, propName) || c.BlobPropertySet(deviceName, propName)
+	}) {
+		t.Fatal("timed out waiting for " + deviceName)
+	}
+}
+
+func Test_Conformance_DeviceTree(t *testing.T) {
+	c, stop := connectConformance(t)
+	defer stop()
+
+	assert.ElementsMatch(t, []string{conformanceTelescope, conformanceCCD, conformanceFocuser}, c.Devices())
+
+	for _, d := range c.Devices() {
+		groups, err := c.GroupedProperties(d)
+		require.NoError(t, err)
+		require.NotEmpty(t, groups, d)
+
+		info := groups[0].Properties[0]
+		assert.Equal(t, "CONNECTION", info.Name, d)
+		assert.Equal(t, indiclient.PropertyTypeSwitch, info.Type, d)
+		assert.Equal(t, []indiclient.ElementInfo{
+			{Name: "CONNECT", Label: "Connect"},
+			{Name: "DISCONNECT", Label: "Disconnect"},
+		}, info.Elements, d)
+
+		v, err := c.GetSwitch(d, "CONNECTION", "DISCONNECT")
+		require.NoError(t, err)
+		assert.Equal(t, indiclient.SwitchStateOn, v.Value, d)
+	}
+}
+
+func Test_Conformance_NumberProperties(t *testing.T) {
+	c, stop := connectConformance(t)
+	defer stop()
+
+	connectDevice(t, c, conformanceFocuser, "ABS_FOCUS_POSITION")
+
+	err := c.SetNumberValue(conformanceFocuser, "ABS_FOCUS_POSITION", []string{"FOCUS_ABSOLUTE_POSITION"}, []string{"30000"})
+	require.NoError(t, err)
+
+	v, err := c.GetNumber(conformanceFocuser, "ABS_FOCUS_POSITION", "FOCUS_ABSOLUTE_POSITION")
+	require.NoError(t, err)
+
+	f, err := parseConformanceNumber(v.Value)
+	require.NoError(t, err)
+	assert.Equal(t, float64(30000), f)
+
+	connectDevice(t, c, conformanceTelescope, "EQUATORIAL_EOD_COORD")
+
+	site := indiclient.Site{Latitude: 51.4769, Longitude: 359.9995, Elevation: 46}
+	require.NoError(t, c.SetSite(conformanceTelescope, site))
+
+	got, err := c.GetSite(conformanceTelescope)
+	require.NoError(t, err)
+	assert.InDelta(t, site.Latitude, got.Latitude, 1e-3)
+	assert.InDelta(t, site.Longitude, got.Longitude, 1e-3)
+	assert.InDelta(t, site.Elevation, got.Elevation, 1e-3)
+}
+
+func Test_Conformance_Blob(t *testing.T) {
+	c, stop := connectConformance(t)
+	defer stop()
+
+	connectDevice(t, c, conformanceCCD, "CCD1")
+
+	require.NoError(t, c.EnableBlob(conformanceCCD, "", indiclient.BlobEnableAlso))
+
+	blobs := make(chan indiclient.BlobEvent, 1)
+	_, err := c.OnBlob(conformanceCCD, "CCD1", "CCD1", func(e indiclient.BlobEvent) { blobs <- e })
+	require.NoError(t, err)
+
+	err = c.SetNumberValue(conformanceCCD, "CCD_EXPOSURE", []string{"CCD_EXPOSURE_VALUE"}, []string{"0.1"})
+	require.NoError(t, err)
+
+	select {
+	case e := <-blobs:
+		assert.Equal(t, ".fits", e.Format)
+
+		b, err := ioutil.ReadAll(e.Open())
+		require.NoError(t, err)
+		assert.Equal(t, "SIMPLE  =", string(b[:9]))
+		assert.Equal(t, 0, len(b)%2880)
+	case <-time.After(30 * time.Second):
+		t.Fatal("no BLOB received")
+	}
+}
+
+func Test_Conformance_DisconnectDeletesProperties(t *testing.T) {
+	c, stop := connectConformance(t)
+	defer stop()
+
+	connectDevice(t, c, conformanceFocuser, "ABS_FOCUS_POSITION")
+
+	err := c.SetSwitchValue(conformanceFocuser, "CONNECTION", []string{"DISCONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+	require.NoError(t, err)
+
+	if !testutil.WaitUntil(10*time.Second, func() bool { return !c.NumberPropertySet(conformanceFocuser, "ABS_FOCUS_POSITION") }) {
+		t.Fatal("timed out waiting for properties to be deleted")
+	}
+}
+
+// parseConformanceNumber parses a number as formatted by a driver, which may include padding.
+func parseConformanceNumber(s string) (float64, error) {
+	var f float64
+	_, err := fmt.Sscan(s, &f)
+
+	return f, err
+}
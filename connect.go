@@ -0,0 +1,151 @@
+package indiclient
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ConnectOptions controls what ConnectWithOptions asks indiserver for once it is connected.
+type ConnectOptions struct {
+	// Dialer, if set, replaces the Dialer given to NewINDIClient for this connection and the ones after it, such as an
+	// SSH tunnel to a remote observatory. See HTTPProxyDialer and the sshdialer package.
+	Dialer Dialer
+	// Codec, if set, replaces the wire format for this connection and the ones after it, such as JSONCodec for gateways
+	// that speak a JSON mapping of INDI. XMLCodec is used until it is set.
+	Codec Codec
+	// Timeout, if set, is the longest ConnectWithOptions waits for the connection to be made.
+	Timeout time.Duration
+	// Watch lists the devices, or single properties of devices if Property is set, to request with getProperties.
+	// indiserver then only sends definitions and updates for those, which saves time and memory on servers hosting many
+	// drivers. Empty requests every device.
+	Watch []WatchedDevice
+}
+
+// ConnectWithOptions connects like Connect, using opts.Dialer and opts.Codec if they are set, then asks indiserver for the devices and properties in opts.Watch, or for
+// every device if it is empty. More can be requested later with GetProperties.
+func (c *INDIClient) ConnectWithOptions(network, address string, opts ConnectOptions) error {
+	for _, w := range opts.Watch {
+		if len(w.Property) > 0 && len(w.Device) == 0 {
+			return ErrPropertyWithoutDevice
+		}
+	}
+
+	c.rwm.Lock()
+	if opts.Dialer != nil {
+		c.dialer = opts.Dialer
+	}
+	if opts.Codec != nil {
+		c.codec = opts.Codec
+	}
+	c.rwm.Unlock()
+
+	ctx := context.Background()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	err := c.connect(ctx, network, address)
+	if err != nil {
+		return err
+	}
+
+	return c.requestProperties(opts.Watch)
+}
+
+// AutoGetPropertiesOptions controls the getProperties sent by Connect. See SetAutoGetProperties.
+type AutoGetPropertiesOptions struct {
+	// Enabled makes Connect and ConnectContext send getProperties as soon as they have connected.
+	Enabled bool
+	// Watch lists the devices, or single properties of devices, to ask for, as in ConnectOptions.Watch. Empty asks for
+	// every device.
+	Watch []WatchedDevice
+}
+
+// SetAutoGetProperties makes Connect and ConnectContext send getProperties as soon as they have connected, each time
+// they are called, so definitions start arriving without a separate call to GetProperties. ConnectWithOptions always
+// sends its own getProperties instead. Use SyncProperties to wait for the definitions to arrive.
+func (c *INDIClient) SetAutoGetProperties(opts AutoGetPropertiesOptions) error {
+	for _, w := range opts.Watch {
+		if len(w.Property) > 0 && len(w.Device) == 0 {
+			return ErrPropertyWithoutDevice
+		}
+	}
+
+	opts.Watch = append([]WatchedDevice{}, opts.Watch...)
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.autoGetProperties = opts
+
+	return nil
+}
+
+// AutoGetProperties returns the options set with SetAutoGetProperties.
+func (c *INDIClient) AutoGetProperties() AutoGetPropertiesOptions {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	opts := c.autoGetProperties
+	opts.Watch = append([]WatchedDevice{}, opts.Watch...)
+
+	return opts
+}
+
+// requestProperties sends getProperties for each of watch, or for every device if it is empty.
+func (c *INDIClient) requestProperties(watch []WatchedDevice) error {
+	if len(watch) == 0 {
+		return c.GetProperties("", "")
+	}
+
+	for _, w := range watch {
+		if err := c.GetProperties(w.Device, w.Property); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dialContext dials with d, giving up when ctx is done. A Dialer that is not a ContextDialer is left dialing in the
+// background, and a connection it makes after ctx is done is closed.
+func dialContext(ctx context.Context, d Dialer, network, address string) (io.ReadWriteCloser, error) {
+	if cd, ok := d.(ContextDialer); ok {
+		return cd.DialContext(ctx, network, address)
+	}
+
+	if ctx.Done() == nil {
+		return d.Dial(network, address)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		conn io.ReadWriteCloser
+		err  error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		conn, err := d.Dial(network, address)
+		done <- result{conn: conn, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,151 @@
+package indiclient_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func Test_ConnectWithOptions(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	server := simulators.NewServer(simulators.NewFocuser("Focuser Simulator"), simulators.NewCCD("CCD Simulator"))
+
+	c := indiclient.NewINDIClient(log, server, afero.NewMemMapFs(), 100)
+
+	err := c.ConnectWithOptions("tcp", "localhost:7624", indiclient.ConnectOptions{
+		Watch: []indiclient.WatchedDevice{{Device: "Focuser Simulator", Property: "CONNECTION"}},
+	})
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return c.SwitchPropertySet("Focuser Simulator", "CONNECTION") })
+	assert.Equal(t, []string{"Focuser Simulator"}, c.Devices())
+	assert.Equal(t, []indiclient.WatchedDevice{{Device: "Focuser Simulator", Property: "CONNECTION"}}, c.Profile().Watched)
+
+	c.Disconnect()
+
+	err = c.ConnectWithOptions("tcp", "localhost:7624", indiclient.ConnectOptions{})
+	require.NoError(t, err)
+	defer c.Disconnect()
+
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == 2 })
+}
+
+func Test_ConnectWithOptions_PropertyWithoutDevice(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	c := indiclient.NewINDIClient(log, simulators.NewServer(), afero.NewMemMapFs(), 100)
+
+	err := c.ConnectWithOptions("tcp", "localhost:7624", indiclient.ConnectOptions{
+		Watch: []indiclient.WatchedDevice{{Property: "CONNECTION"}},
+	})
+	assert.Equal(t, indiclient.ErrPropertyWithoutDevice, err)
+	assert.False(t, c.IsConnected())
+}
+
+// blockingDialer dials only once release is closed.
+type blockingDialer struct {
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func (d blockingDialer) Dial(network, address string) (io.ReadWriteCloser, error) {
+	<-d.release
+
+	conn, other := net.Pipe()
+	go func() {
+		// Reads fail once the client closes its end.
+		other.Read(make([]byte, 1))
+		close(d.closed)
+	}()
+
+	return conn, nil
+}
+
+func Test_ConnectContext(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+
+	dialer := blockingDialer{release: make(chan struct{}), closed: make(chan struct{})}
+	c := indiclient.NewINDIClient(log, dialer, afero.NewMemMapFs(), 100)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := c.ConnectContext(ctx, "tcp", "localhost:7624")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.False(t, c.IsConnected())
+
+	// The connection made after giving up is closed.
+	close(dialer.release)
+	select {
+	case <-dialer.closed:
+	case <-time.After(time.Second):
+		t.Fatal("connection was not closed")
+	}
+
+	err = c.ConnectWithOptions("tcp", "localhost:7624", indiclient.ConnectOptions{
+		Dialer:  blockingDialer{release: make(chan struct{}), closed: make(chan struct{})},
+		Timeout: 20 * time.Millisecond,
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func Test_NetworkDialer_DialContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	dialer := indiclient.NetworkDialer{Timeout: time.Second, KeepAlive: -1, DisableNoDelay: true}
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", l.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = dialer.DialContext(ctx, "tcp", l.Addr().String())
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func Test_AutoGetProperties(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	server := simulators.NewServer(simulators.NewFocuser("Focuser Simulator"), simulators.NewCCD("CCD Simulator"))
+
+	c := indiclient.NewINDIClient(log, server, afero.NewMemMapFs(), 100)
+
+	err := c.SetAutoGetProperties(indiclient.AutoGetPropertiesOptions{Enabled: true, Watch: []indiclient.WatchedDevice{{Property: "CONNECTION"}}})
+	assert.Equal(t, indiclient.ErrPropertyWithoutDevice, err)
+
+	opts := indiclient.AutoGetPropertiesOptions{
+		Enabled: true,
+		Watch:   []indiclient.WatchedDevice{{Device: "Focuser Simulator", Property: "CONNECTION"}},
+	}
+	require.NoError(t, c.SetAutoGetProperties(opts))
+	assert.Equal(t, opts, c.AutoGetProperties())
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+
+	testutil.WaitFor(t, func() bool { return c.SwitchPropertySet("Focuser Simulator", "CONNECTION") })
+	assert.Equal(t, []string{"Focuser Simulator"}, c.Devices())
+
+	c.Disconnect()
+
+	// Every reconnect asks again.
+	require.NoError(t, c.SetAutoGetProperties(indiclient.AutoGetPropertiesOptions{Enabled: true}))
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == 2 })
+}
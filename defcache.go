@@ -0,0 +1,259 @@
+package indiclient
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// DefaultDefinitionReconcile is how long after a cached device is first defined again the definitions that were not
+// sent again are removed, unless DefinitionCacheOptions.Reconcile is set.
+const DefaultDefinitionReconcile = 10 * time.Second
+
+// definitionSaveDelay is how long the cache waits for more definitions of a device before saving it, since drivers
+// define many properties at once.
+const definitionSaveDelay = time.Second
+
+// definitionFileMu serializes reads and writes of the definition cache, which several clients may share.
+var definitionFileMu sync.Mutex
+
+// DefinitionCacheOptions controls the cache of property definitions kept across reconnects. See SetDefinitionCache.
+type DefinitionCacheOptions struct {
+	// Dir is the directory on the client's afero.Fs the definitions are saved in, one file per device. Empty disables
+	// the cache.
+	Dir string
+	// Reconcile is how long after a cached device is first defined again its cached properties that were not defined
+	// again are deleted. Zero uses DefaultDefinitionReconcile.
+	Reconcile time.Duration
+}
+
+// cachedDevice is the file a device's definitions are saved in.
+type cachedDevice struct {
+	// Version is the DRIVER_VERSION of DRIVER_INFO when the device was saved.
+	Version string    `json:"version"`
+	Saved   time.Time `json:"saved"`
+	Device  Device    `json:"device"`
+}
+
+// SetDefinitionCache keeps the definitions of every device's properties, such as names, labels, limits, formats and
+// switch rules, in opts.Dir, so that after Connect the devices can be validated against and shown straight away,
+// before indiserver defines them again. The values of cached properties are those last seen, and may be stale.
+//
+// When a cached device is defined again, each definition replaces the cached one. If its DRIVER_VERSION differs from
+// the cached one, the remaining cached properties are deleted at once; otherwise those not defined again within
+// opts.Reconcile are deleted. Deleted properties send EventTypeDelete, as if indiserver had deleted them. Cached
+// devices are loaded on the next call to Connect.
+func (c *INDIClient) SetDefinitionCache(opts DefinitionCacheOptions) {
+	if opts.Reconcile <= 0 {
+		opts.Reconcile = DefaultDefinitionReconcile
+	}
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.defCache = opts
+}
+
+// DefinitionCache returns the options set with SetDefinitionCache.
+func (c *INDIClient) DefinitionCache() DefinitionCacheOptions {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.defCache
+}
+
+// DefinitionCached returns true if the property propName of deviceName was loaded from the definition cache, and
+// indiserver has not defined it again yet.
+func (c *INDIClient) DefinitionCached(deviceName, propName string) bool {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.cachedProps[deviceName][propName]
+}
+
+// definitionFile returns the name of the file deviceName is cached in.
+func (c *INDIClient) definitionFile(deviceName string) string {
+	return filepath.Join(c.defCache.Dir, url.PathEscape(deviceName)+".json")
+}
+
+// loadDefinitions adds the cached devices to the device tree. Modifies INDIClient.devices. Only call when
+// INDIClient.rwm is locked.
+func (c *INDIClient) loadDefinitions() {
+	for _, t := range c.reconciling {
+		t.Stop()
+	}
+
+	c.cachedProps = map[string]map[string]bool{}
+	c.cachedVersions = map[string]string{}
+	c.reconciling = map[string]ClockTimer{}
+
+	if len(c.defCache.Dir) == 0 {
+		return
+	}
+
+	files, err := afero.Glob(c.fs, filepath.Join(c.defCache.Dir, "*.json"))
+	if err != nil {
+		c.log.WithError(err).Warn("error listing definition cache")
+		return
+	}
+
+	for _, f := range files {
+		definitionFileMu.Lock()
+		b, err := afero.ReadFile(c.fs, f)
+		definitionFileMu.Unlock()
+		if err != nil {
+			c.log.WithField("file", f).WithError(err).Warn("error reading definition cache")
+			continue
+		}
+
+		var cached cachedDevice
+		if err := json.Unmarshal(b, &cached); err != nil {
+			c.log.WithField("file", f).WithError(err).Warn("error reading definition cache")
+			continue
+		}
+
+		name := cached.Device.Name
+		if _, ok := c.devices[name]; ok || len(name) == 0 {
+			continue
+		}
+
+		c.putDevice(name, cached.Device)
+		c.cachedVersions[name] = cached.Version
+		c.cachedProps[name] = map[string]bool{}
+
+		for _, p := range cached.Device.PropertyOrder {
+			c.cachedProps[name][p] = true
+
+			c.emit(Event{
+				Type:     EventTypeDefine,
+				Device:   name,
+				Property: p,
+			})
+		}
+	}
+}
+
+// updateDefinitionCache reconciles the cached definitions of deviceName with propName, which has just been defined,
+// and schedules the device to be saved. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) updateDefinitionCache(deviceName, propName string) {
+	if len(c.defCache.Dir) == 0 {
+		return
+	}
+
+	if cached, ok := c.cachedProps[deviceName]; ok {
+		delete(cached, propName)
+
+		if propName == "DRIVER_INFO" && driverVersion(c.devices[deviceName]) != c.cachedVersions[deviceName] {
+			c.pruneCachedDefinitions(deviceName)
+		} else if _, ok := c.reconciling[deviceName]; !ok {
+			var t ClockTimer
+			t = c.Clock().AfterFunc(c.defCache.Reconcile, func() {
+				c.rwm.Lock()
+				defer c.rwm.Unlock()
+
+				// The cache may have been loaded again since.
+				if c.reconciling[deviceName] == t {
+					c.pruneCachedDefinitions(deviceName)
+				}
+			})
+			c.reconciling[deviceName] = t
+		}
+	}
+
+	if c.savingDefinitions[deviceName] {
+		return
+	}
+
+	c.savingDefinitions[deviceName] = true
+
+	c.Clock().AfterFunc(definitionSaveDelay, func() { c.saveDefinitions(deviceName) })
+}
+
+// pruneCachedDefinitions deletes the cached properties of deviceName that have not been defined again. Only call
+// when INDIClient.rwm is locked.
+func (c *INDIClient) pruneCachedDefinitions(deviceName string) {
+	cached, ok := c.cachedProps[deviceName]
+	if !ok {
+		return
+	}
+
+	delete(c.cachedProps, deviceName)
+	delete(c.cachedVersions, deviceName)
+	delete(c.reconciling, deviceName)
+
+	if _, ok := c.devices[deviceName]; !ok {
+		return
+	}
+
+	for p := range cached {
+		c.delProperty(&DelProperty{Device: deviceName, Name: p})
+	}
+}
+
+// saveDefinitions writes the definitions of deviceName to the cache.
+func (c *INDIClient) saveDefinitions(deviceName string) {
+	c.rwm.Lock()
+	delete(c.savingDefinitions, deviceName)
+	dir := c.defCache.Dir
+	file := c.definitionFile(deviceName)
+	device, ok := c.devices[deviceName]
+	if ok {
+		device = device.Copy()
+	}
+	c.rwm.Unlock()
+
+	if !ok || len(dir) == 0 {
+		return
+	}
+
+	// Messages are not definitions, and would only grow the file.
+	device.Messages = []MessageJSON{}
+	for k, p := range device.TextProperties {
+		p.Messages = []MessageJSON{}
+		device.TextProperties[k] = p
+	}
+	for k, p := range device.NumberProperties {
+		p.Messages = []MessageJSON{}
+		device.NumberProperties[k] = p
+	}
+	for k, p := range device.SwitchProperties {
+		p.Messages = []MessageJSON{}
+		device.SwitchProperties[k] = p
+	}
+	for k, p := range device.LightProperties {
+		p.Messages = []MessageJSON{}
+		device.LightProperties[k] = p
+	}
+	for k, p := range device.BlobProperties {
+		p.Messages = []MessageJSON{}
+		device.BlobProperties[k] = p
+	}
+
+	b, err := json.Marshal(cachedDevice{Version: driverVersion(device), Saved: c.now(), Device: device})
+	if err != nil {
+		c.log.WithField("device", deviceName).WithError(err).Warn("error saving definition cache")
+		return
+	}
+
+	definitionFileMu.Lock()
+	err = c.fs.MkdirAll(dir, 0755)
+	if err == nil {
+		err = afero.WriteFile(c.fs, file, b, 0644)
+	}
+	definitionFileMu.Unlock()
+	if err != nil {
+		c.log.WithField("device", deviceName).WithError(err).Warn("error saving definition cache")
+	}
+}
+
+// driverVersion returns the DRIVER_VERSION of d's DRIVER_INFO, or an empty string if it has none.
+func driverVersion(d Device) string {
+	return strings.TrimSpace(d.TextProperties["DRIVER_INFO"].Values["DRIVER_VERSION"].Value)
+}
@@ -0,0 +1,92 @@
+package indiclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+func defineDriverInfo(c *INDIClient, version string) {
+	c.defTextVector(&DefTextVector{
+		Device: "Mount",
+		Name:   "DRIVER_INFO",
+		State:  PropertyStateIdle,
+		Perm:   PropertyPermissionReadOnly,
+		Texts:  []DefText{{Name: "DRIVER_VERSION", Value: version}},
+	})
+}
+
+func Test_DefinitionCache(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	opts := DefinitionCacheOptions{Dir: "definitions", Reconcile: 50 * time.Millisecond}
+
+	newCachedClient := func() *INDIClient {
+		c := newTestClient()
+		c.fs = fs
+		c.SetDefinitionCache(opts)
+
+		c.rwm.Lock()
+		c.loadDefinitions()
+		c.rwm.Unlock()
+
+		return c
+	}
+
+	c := newCachedClient()
+	assert.Empty(t, c.Devices())
+
+	c.rwm.Lock()
+	defineDriverInfo(c, "1.0")
+	defineCoords(c)
+	c.defSwitchVector(&DefSwitchVector{
+		Device:   "Mount",
+		Name:     "TELESCOPE_PARK",
+		State:    PropertyStateIdle,
+		Perm:     PropertyPermissionReadWrite,
+		Rule:     SwitchRuleOneOfMany,
+		Switches: []DefSwitch{{Name: "PARK", Value: SwitchStateOff}, {Name: "UNPARK", Value: SwitchStateOn}},
+	})
+	c.rwm.Unlock()
+
+	c.saveDefinitions("Mount")
+
+	exists, _ := afero.Exists(fs, "definitions/Mount.json")
+	require.True(t, exists)
+
+	// A new connection starts with the cached definitions.
+	c = newCachedClient()
+
+	assert.True(t, c.DefinitionCached("Mount", "EQUATORIAL_EOD_COORD"))
+	prop, err := c.GetSwitchProperty("Mount", "TELESCOPE_PARK")
+	require.NoError(t, err)
+	assert.Equal(t, SwitchRuleOneOfMany, prop.Rule)
+	assert.Equal(t, []string{"PARK", "UNPARK"}, prop.Order)
+
+	// Definitions replace the cached ones, and the rest are deleted once the device has had time to define them.
+	c.rwm.Lock()
+	defineDriverInfo(c, "1.0")
+	defineCoords(c)
+	c.rwm.Unlock()
+
+	assert.False(t, c.DefinitionCached("Mount", "EQUATORIAL_EOD_COORD"))
+	assert.True(t, c.DefinitionCached("Mount", "TELESCOPE_PARK"))
+
+	testutil.WaitFor(t, func() bool { return !c.SwitchPropertySet("Mount", "TELESCOPE_PARK") })
+	assert.False(t, c.DefinitionCached("Mount", "TELESCOPE_PARK"))
+	assert.True(t, c.NumberPropertySet("Mount", "EQUATORIAL_EOD_COORD"))
+
+	// A new driver version drops the cached definitions at once.
+	c = newCachedClient()
+
+	c.rwm.Lock()
+	defineDriverInfo(c, "2.0")
+	c.rwm.Unlock()
+
+	assert.False(t, c.NumberPropertySet("Mount", "EQUATORIAL_EOD_COORD"))
+	assert.True(t, c.TextPropertySet("Mount", "DRIVER_INFO"))
+}
@@ -14,25 +14,29 @@ type Device struct {
 	BlobProperties   map[string]BlobProperty   `json:"blobProperties"`
 	LightProperties  map[string]LightProperty  `json:"lightProperties"`
 	Messages         []MessageJSON             `json:"messages"`
+	PropertyOrder    []string                  `json:"propertyOrder"`
 }
 
 // MessageJSON is a message received from indiserver.
 type MessageJSON struct {
-	Timestamp time.Time `json:"timestamp"`
-	Message   string    `json:"message"`
+	Timestamp time.Time       `json:"timestamp"`
+	Message   string          `json:"message"`
+	Severity  MessageSeverity `json:"severity"`
 }
 
 // TextProperty is a text property on a device.
 type TextProperty struct {
-	Name        string               `json:"name"`
-	Label       string               `json:"label"`
-	Group       string               `json:"group"`
-	State       PropertyState        `json:"state"`
-	Timeout     int                  `json:"timeout"`
-	LastUpdated time.Time            `json:"lastUpdated"`
-	Messages    []MessageJSON        `json:"messages"`
-	Permissions PropertyPermission   `json:"permissions"`
-	Values      map[string]TextValue `json:"values"`
+	Name         string               `json:"name"`
+	Label        string               `json:"label"`
+	Group        string               `json:"group"`
+	State        PropertyState        `json:"state"`
+	Timeout      int                  `json:"timeout"`
+	LastUpdated  time.Time            `json:"lastUpdated"`
+	RawTimestamp string               `json:"rawTimestamp"`
+	Messages     []MessageJSON        `json:"messages"`
+	Permissions  PropertyPermission   `json:"permissions"`
+	Values       map[string]TextValue `json:"values"`
+	Order        []string             `json:"order"`
 }
 
 // TextValue is a text value on a TextProperty.
@@ -44,16 +48,18 @@ type TextValue struct {
 
 // SwitchProperty is a switch property on a device.
 type SwitchProperty struct {
-	Name        string                 `json:"name"`
-	Label       string                 `json:"label"`
-	Group       string                 `json:"group"`
-	State       PropertyState          `json:"state"`
-	Timeout     int                    `json:"timeout"`
-	LastUpdated time.Time              `json:"lastUpdated"`
-	Messages    []MessageJSON          `json:"messages"`
-	Rule        SwitchRule             `json:"rule"`
-	Permissions PropertyPermission     `json:"permissions"`
-	Values      map[string]SwitchValue `json:"values"`
+	Name         string                 `json:"name"`
+	Label        string                 `json:"label"`
+	Group        string                 `json:"group"`
+	State        PropertyState          `json:"state"`
+	Timeout      int                    `json:"timeout"`
+	LastUpdated  time.Time              `json:"lastUpdated"`
+	RawTimestamp string                 `json:"rawTimestamp"`
+	Messages     []MessageJSON          `json:"messages"`
+	Rule         SwitchRule             `json:"rule"`
+	Permissions  PropertyPermission     `json:"permissions"`
+	Values       map[string]SwitchValue `json:"values"`
+	Order        []string               `json:"order"`
 }
 
 // SwitchValue is a switch value on a SwitchProperty.
@@ -65,15 +71,17 @@ type SwitchValue struct {
 
 // NumberProperty is a number property on a device.
 type NumberProperty struct {
-	Name        string                 `json:"name"`
-	Label       string                 `json:"label"`
-	Group       string                 `json:"group"`
-	State       PropertyState          `json:"state"`
-	Timeout     int                    `json:"timeout"`
-	LastUpdated time.Time              `json:"lastUpdated"`
-	Messages    []MessageJSON          `json:"messages"`
-	Permissions PropertyPermission     `json:"permissions"`
-	Values      map[string]NumberValue `json:"values"`
+	Name         string                 `json:"name"`
+	Label        string                 `json:"label"`
+	Group        string                 `json:"group"`
+	State        PropertyState          `json:"state"`
+	Timeout      int                    `json:"timeout"`
+	LastUpdated  time.Time              `json:"lastUpdated"`
+	RawTimestamp string                 `json:"rawTimestamp"`
+	Messages     []MessageJSON          `json:"messages"`
+	Permissions  PropertyPermission     `json:"permissions"`
+	Values       map[string]NumberValue `json:"values"`
+	Order        []string               `json:"order"`
 }
 
 // NumberValue is a number value on a NumberProperty.
@@ -89,13 +97,15 @@ type NumberValue struct {
 
 // LightProperty is a light property on a device. Note that these properties are read-only.
 type LightProperty struct {
-	Name        string                `json:"name"`
-	Label       string                `json:"label"`
-	Group       string                `json:"group"`
-	State       PropertyState         `json:"state"`
-	LastUpdated time.Time             `json:"lastUpdated"`
-	Messages    []MessageJSON         `json:"messages"`
-	Values      map[string]LightValue `json:"values"`
+	Name         string                `json:"name"`
+	Label        string                `json:"label"`
+	Group        string                `json:"group"`
+	State        PropertyState         `json:"state"`
+	LastUpdated  time.Time             `json:"lastUpdated"`
+	RawTimestamp string                `json:"rawTimestamp"`
+	Messages     []MessageJSON         `json:"messages"`
+	Values       map[string]LightValue `json:"values"`
+	Order        []string              `json:"order"`
 }
 
 // LightValue is a light value on a LightProperty.
@@ -107,23 +117,32 @@ type LightValue struct {
 
 // BlobProperty is a blob property on a device.
 type BlobProperty struct {
-	Name        string               `json:"name"`
-	Label       string               `json:"label"`
-	Group       string               `json:"group"`
-	State       PropertyState        `json:"state"`
-	LastUpdated time.Time            `json:"lastUpdated"`
-	Messages    []MessageJSON        `json:"messages"`
-	Permissions PropertyPermission   `json:"permissions"`
-	Timeout     int                  `json:"timeout"`
-	Values      map[string]BlobValue `json:"values"`
-}
-
-// BlobValue is a blob value on a BlobProperty.
+	Name         string               `json:"name"`
+	Label        string               `json:"label"`
+	Group        string               `json:"group"`
+	State        PropertyState        `json:"state"`
+	LastUpdated  time.Time            `json:"lastUpdated"`
+	RawTimestamp string               `json:"rawTimestamp"`
+	Messages     []MessageJSON        `json:"messages"`
+	Permissions  PropertyPermission   `json:"permissions"`
+	Timeout      int                  `json:"timeout"`
+	Values       map[string]BlobValue `json:"values"`
+	Order        []string             `json:"order"`
+}
+
+// BlobValue is a blob value on a BlobProperty. Value is the name of the file the BLOB was saved to.
 type BlobValue struct {
-	Name  string `json:"name"`
-	Label string `json:"label"`
-	Value string `json:"value"`
-	Size  int64  `json:"size"`
+	Name      string    `json:"name"`
+	Label     string    `json:"label"`
+	Value     string    `json:"value"`
+	Size      int64     `json:"size"`
+	Format    string    `json:"format"`
+	Timestamp time.Time `json:"timestamp"`
+	// Sequence numbers the BLOBs received for this element, starting at 1. It keeps counting across reconnects.
+	Sequence uint64 `json:"sequence"`
+	// Duplicate is true if the BLOB has the same timestamp and size as the one before it, which usually means the
+	// driver sent the same frame twice.
+	Duplicate bool `json:"duplicate"`
 }
 
 // Groups retreives a list of all the groups for a device for display purposes. Groups are returned in alphabetical order.
@@ -160,3 +179,243 @@ func (d Device) Groups() []string {
 
 	return groups
 }
+
+// PropertyType is the kind of value held by a property.
+type PropertyType string
+
+const (
+	// PropertyTypeText is a TextProperty.
+	PropertyTypeText = PropertyType("text")
+	// PropertyTypeNumber is a NumberProperty.
+	PropertyTypeNumber = PropertyType("number")
+	// PropertyTypeSwitch is a SwitchProperty.
+	PropertyTypeSwitch = PropertyType("switch")
+	// PropertyTypeLight is a LightProperty.
+	PropertyTypeLight = PropertyType("light")
+	// PropertyTypeBlob is a BlobProperty.
+	PropertyTypeBlob = PropertyType("blob")
+)
+
+// ElementInfo describes a single element of a property.
+type ElementInfo struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+}
+
+// PropertyInfo describes a property for display purposes, without its values.
+type PropertyInfo struct {
+	Name        string             `json:"name"`
+	Label       string             `json:"label"`
+	Group       string             `json:"group"`
+	Type        PropertyType       `json:"type"`
+	State       PropertyState      `json:"state"`
+	Permissions PropertyPermission `json:"permissions"`
+	Elements    []ElementInfo      `json:"elements"`
+}
+
+// PropertyGroup is a group of properties, as shown on a tab of an INDI control panel.
+type PropertyGroup struct {
+	Name       string         `json:"name"`
+	Properties []PropertyInfo `json:"properties"`
+}
+
+// PropertyInfo describes the property name, with its elements in the order the driver defined them.
+func (d Device) PropertyInfo(name string) (PropertyInfo, bool) {
+	if p, ok := d.TextProperties[name]; ok {
+		info := PropertyInfo{Name: p.Name, Label: p.Label, Group: p.Group, Type: PropertyTypeText, State: p.State, Permissions: p.Permissions}
+		for _, n := range p.Order {
+			info.Elements = append(info.Elements, ElementInfo{Name: n, Label: p.Values[n].Label})
+		}
+		return info, true
+	}
+
+	if p, ok := d.NumberProperties[name]; ok {
+		info := PropertyInfo{Name: p.Name, Label: p.Label, Group: p.Group, Type: PropertyTypeNumber, State: p.State, Permissions: p.Permissions}
+		for _, n := range p.Order {
+			info.Elements = append(info.Elements, ElementInfo{Name: n, Label: p.Values[n].Label})
+		}
+		return info, true
+	}
+
+	if p, ok := d.SwitchProperties[name]; ok {
+		info := PropertyInfo{Name: p.Name, Label: p.Label, Group: p.Group, Type: PropertyTypeSwitch, State: p.State, Permissions: p.Permissions}
+		for _, n := range p.Order {
+			info.Elements = append(info.Elements, ElementInfo{Name: n, Label: p.Values[n].Label})
+		}
+		return info, true
+	}
+
+	if p, ok := d.LightProperties[name]; ok {
+		info := PropertyInfo{Name: p.Name, Label: p.Label, Group: p.Group, Type: PropertyTypeLight, State: p.State, Permissions: PropertyPermissionReadOnly}
+		for _, n := range p.Order {
+			info.Elements = append(info.Elements, ElementInfo{Name: n, Label: p.Values[n].Label})
+		}
+		return info, true
+	}
+
+	if p, ok := d.BlobProperties[name]; ok {
+		info := PropertyInfo{Name: p.Name, Label: p.Label, Group: p.Group, Type: PropertyTypeBlob, State: p.State, Permissions: p.Permissions}
+		for _, n := range p.Order {
+			info.Elements = append(info.Elements, ElementInfo{Name: n, Label: p.Values[n].Label})
+		}
+		return info, true
+	}
+
+	return PropertyInfo{}, false
+}
+
+// GroupedProperties returns the device's properties grouped by their Group attribute. Groups appear in the order
+// their first property was defined, and properties within a group appear in the order they were defined, which is
+// the layout the driver intends for a control panel.
+func (d Device) GroupedProperties() []PropertyGroup {
+	groups := []PropertyGroup{}
+	index := map[string]int{}
+
+	for _, name := range d.PropertyOrder {
+		info, ok := d.PropertyInfo(name)
+		if !ok {
+			continue
+		}
+
+		i, ok := index[info.Group]
+		if !ok {
+			i = len(groups)
+			index[info.Group] = i
+			groups = append(groups, PropertyGroup{Name: info.Group})
+		}
+
+		groups[i].Properties = append(groups[i].Properties, info)
+	}
+
+	return groups
+}
+
+func addPropertyOrder(order []string, name string) []string {
+	for _, n := range order {
+		if n == name {
+			return order
+		}
+	}
+
+	return append(order, name)
+}
+
+func removePropertyOrder(order []string, name string) []string {
+	for i, n := range order {
+		if n == name {
+			return append(order[:i:i], order[i+1:]...)
+		}
+	}
+
+	return order
+}
+
+// Copy returns a deep copy of d that shares no maps or slices with it.
+func (d Device) Copy() Device {
+	cp := d
+
+	cp.TextProperties = make(map[string]TextProperty, len(d.TextProperties))
+	for k, v := range d.TextProperties {
+		cp.TextProperties[k] = v.Copy()
+	}
+
+	cp.SwitchProperties = make(map[string]SwitchProperty, len(d.SwitchProperties))
+	for k, v := range d.SwitchProperties {
+		cp.SwitchProperties[k] = v.Copy()
+	}
+
+	cp.NumberProperties = make(map[string]NumberProperty, len(d.NumberProperties))
+	for k, v := range d.NumberProperties {
+		cp.NumberProperties[k] = v.Copy()
+	}
+
+	cp.LightProperties = make(map[string]LightProperty, len(d.LightProperties))
+	for k, v := range d.LightProperties {
+		cp.LightProperties[k] = v.Copy()
+	}
+
+	cp.BlobProperties = make(map[string]BlobProperty, len(d.BlobProperties))
+	for k, v := range d.BlobProperties {
+		cp.BlobProperties[k] = v.Copy()
+	}
+
+	cp.Messages = append([]MessageJSON(nil), d.Messages...)
+	cp.PropertyOrder = append([]string(nil), d.PropertyOrder...)
+
+	return cp
+}
+
+// Copy returns a deep copy of p that shares no maps or slices with it.
+func (p TextProperty) Copy() TextProperty {
+	cp := p
+
+	cp.Values = make(map[string]TextValue, len(p.Values))
+	for k, v := range p.Values {
+		cp.Values[k] = v
+	}
+
+	cp.Messages = append([]MessageJSON(nil), p.Messages...)
+	cp.Order = append([]string(nil), p.Order...)
+
+	return cp
+}
+
+// Copy returns a deep copy of p that shares no maps or slices with it.
+func (p SwitchProperty) Copy() SwitchProperty {
+	cp := p
+
+	cp.Values = make(map[string]SwitchValue, len(p.Values))
+	for k, v := range p.Values {
+		cp.Values[k] = v
+	}
+
+	cp.Messages = append([]MessageJSON(nil), p.Messages...)
+	cp.Order = append([]string(nil), p.Order...)
+
+	return cp
+}
+
+// Copy returns a deep copy of p that shares no maps or slices with it.
+func (p NumberProperty) Copy() NumberProperty {
+	cp := p
+
+	cp.Values = make(map[string]NumberValue, len(p.Values))
+	for k, v := range p.Values {
+		cp.Values[k] = v
+	}
+
+	cp.Messages = append([]MessageJSON(nil), p.Messages...)
+	cp.Order = append([]string(nil), p.Order...)
+
+	return cp
+}
+
+// Copy returns a deep copy of p that shares no maps or slices with it.
+func (p LightProperty) Copy() LightProperty {
+	cp := p
+
+	cp.Values = make(map[string]LightValue, len(p.Values))
+	for k, v := range p.Values {
+		cp.Values[k] = v
+	}
+
+	cp.Messages = append([]MessageJSON(nil), p.Messages...)
+	cp.Order = append([]string(nil), p.Order...)
+
+	return cp
+}
+
+// Copy returns a deep copy of p that shares no maps or slices with it.
+func (p BlobProperty) Copy() BlobProperty {
+	cp := p
+
+	cp.Values = make(map[string]BlobValue, len(p.Values))
+	for k, v := range p.Values {
+		cp.Values[k] = v
+	}
+
+	cp.Messages = append([]MessageJSON(nil), p.Messages...)
+	cp.Order = append([]string(nil), p.Order...)
+
+	return cp
+}
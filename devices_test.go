@@ -33,3 +33,86 @@ func Test_Groups(t *testing.T) {
 	require.NotNil(t, groups)
 	assert.Equal(t, expected, groups)
 }
+
+func Test_GroupedProperties(t *testing.T) {
+	c := newTestClient()
+
+	c.defSwitchVector(&DefSwitchVector{
+		Device: "Mount", Name: "CONNECTION", Label: "Connection", Group: "Main Control",
+		Switches: []DefSwitch{{Name: "CONNECT", Label: "Connect"}, {Name: "DISCONNECT", Label: "Disconnect"}},
+	})
+	c.defTextVector(&DefTextVector{
+		Device: "Mount", Name: "DEVICE_PORT", Label: "Ports", Group: "Options",
+		Texts: []DefText{{Name: "PORT", Label: "Port"}},
+	})
+	c.defNumberVector(&DefNumberVector{
+		Device: "Mount", Name: "EQUATORIAL_EOD_COORD", Label: "Eq. Coordinates", Group: "Main Control",
+		Perm:    PropertyPermissionReadWrite,
+		Numbers: []DefNumber{{Name: "RA", Label: "RA (hh:mm:ss)"}, {Name: "DEC", Label: "DEC (dd:mm:ss)"}},
+	})
+
+	groups, err := c.GroupedProperties("Mount")
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+
+	assert.Equal(t, "Main Control", groups[0].Name)
+	require.Len(t, groups[0].Properties, 2)
+	assert.Equal(t, "CONNECTION", groups[0].Properties[0].Name)
+	assert.Equal(t, PropertyTypeSwitch, groups[0].Properties[0].Type)
+	assert.Equal(t, []ElementInfo{{Name: "CONNECT", Label: "Connect"}, {Name: "DISCONNECT", Label: "Disconnect"}}, groups[0].Properties[0].Elements)
+	assert.Equal(t, "EQUATORIAL_EOD_COORD", groups[0].Properties[1].Name)
+	assert.Equal(t, "Eq. Coordinates", groups[0].Properties[1].Label)
+	assert.Equal(t, []ElementInfo{{Name: "RA", Label: "RA (hh:mm:ss)"}, {Name: "DEC", Label: "DEC (dd:mm:ss)"}}, groups[0].Properties[1].Elements)
+
+	assert.Equal(t, "Options", groups[1].Name)
+	require.Len(t, groups[1].Properties, 1)
+	assert.Equal(t, PropertyTypeText, groups[1].Properties[0].Type)
+
+	c.delProperty(&DelProperty{Device: "Mount", Name: "DEVICE_PORT"})
+
+	groups, err = c.GroupedProperties("Mount")
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+
+	_, err = c.GroupedProperties("Unknown")
+	assert.Equal(t, ErrDeviceNotFound, err)
+}
+
+func Test_Snapshots(t *testing.T) {
+	c := newTestClient()
+
+	c.rwm.Lock()
+	defineCoords(c)
+	c.rwm.Unlock()
+
+	device, err := c.GetDevice("Mount")
+	require.NoError(t, err)
+
+	prop, err := c.GetNumberProperty("Mount", "EQUATORIAL_EOD_COORD")
+	require.NoError(t, err)
+
+	c.rwm.Lock()
+	setCoords(c, "5")
+	c.rwm.Unlock()
+
+	assert.Equal(t, "0", prop.Values["RA"].Value)
+	assert.Equal(t, "0", device.NumberProperties["EQUATORIAL_EOD_COORD"].Values["RA"].Value)
+
+	// Modifying a snapshot doesn't change the client.
+	prop.Values["RA"] = NumberValue{Name: "RA", Value: "10"}
+	device.PropertyOrder[0] = "CHANGED"
+
+	ra, err := c.GetNumber("Mount", "EQUATORIAL_EOD_COORD", "RA")
+	require.NoError(t, err)
+	assert.Equal(t, "5", ra.Value)
+
+	device, err = c.GetDevice("Mount")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"EQUATORIAL_EOD_COORD"}, device.PropertyOrder)
+
+	_, err = c.GetTextProperty("Mount", "EQUATORIAL_EOD_COORD")
+	assert.Equal(t, ErrPropertyNotFound, err)
+
+	_, err = c.GetDevice("Unknown")
+	assert.Equal(t, ErrDeviceNotFound, err)
+}
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+// +build !unix,!windows
+
+package indiclient
+
+// checkAccess is a no-op where there is no access(2), such as js and wasip1. Dialing still fails if the socket cannot
+// be used.
+func checkAccess(path string) error {
+	return nil
+}
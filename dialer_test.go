@@ -0,0 +1,249 @@
+package indiclient_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+)
+
+func Test_ParseAddress(t *testing.T) {
+	testCases := []struct {
+		url     string
+		network string
+		address string
+		err     error
+	}{
+		{url: "localhost:7624", network: "tcp", address: "localhost:7624"},
+		{url: "indi://localhost", network: "tcp", address: "localhost:7624"},
+		{url: "indi://192.168.1.2:7625", network: "tcp", address: "192.168.1.2:7625"},
+		{url: "tcp://observatory.local", network: "tcp", address: "observatory.local:7624"},
+		{url: "unix:///tmp/indiserver", network: "unix", address: "/tmp/indiserver"},
+		{url: "unix://@indiserver", network: "unix", address: "@indiserver"},
+		{url: "http://localhost", err: indiclient.ErrUnsupportedScheme},
+		{url: "unix://", err: indiclient.ErrInvalidAddress},
+	}
+
+	for _, tc := range testCases {
+		network, address, err := indiclient.ParseAddress(tc.url)
+		if tc.err != nil {
+			assert.Equal(t, tc.err, err, tc.url)
+			continue
+		}
+
+		require.NoError(t, err, tc.url)
+		assert.Equal(t, tc.network, network, tc.url)
+		assert.Equal(t, tc.address, address, tc.url)
+	}
+}
+
+func Test_ConnectURL(t *testing.T) {
+	conn := &mockConnection{
+		r: bytes.NewBufferString(""),
+		w: bytes.NewBuffer([]byte{}),
+	}
+
+	dialer := &mockDialer{}
+	dialer.On("Dial", "tcp", "localhost:7624").Return(conn, nil)
+
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelInfo)
+	c := indiclient.NewINDIClient(log, dialer, afero.NewMemMapFs(), 5)
+
+	err := c.Connect("", "indi://localhost")
+	require.NoError(t, err)
+
+	dialer.AssertExpectations(t)
+
+	err = c.Disconnect()
+	require.NoError(t, err)
+}
+
+func Test_UnixDialer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "indiclient")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "indiserver")
+
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer l.Close()
+
+	conn, err := indiclient.UnixDialer{}.Dial("unix", path)
+	require.NoError(t, err)
+	conn.Close()
+
+	_, err = indiclient.UnixDialer{}.Dial("tcp", path)
+	assert.Error(t, err)
+
+	notSocket := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(notSocket, []byte{}, 0600))
+
+	_, err = indiclient.UnixDialer{}.Dial("unix", notSocket)
+	assert.Equal(t, &os.PathError{Op: "dial", Path: notSocket, Err: indiclient.ErrNotSocket}, err)
+}
+
+func Test_UnixDialer_Abstract(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract sockets are only supported on linux")
+	}
+
+	name := fmt.Sprintf("@indiclient-test-%d", os.Getpid())
+
+	l, err := net.Listen("unix", name)
+	require.NoError(t, err)
+	defer l.Close()
+
+	conn, err := indiclient.UnixDialer{}.Dial("unix", name)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func Test_ConnectWithOptions_Dialer(t *testing.T) {
+	conn := &mockConnection{
+		r: bytes.NewBufferString(""),
+		w: bytes.NewBuffer([]byte{}),
+	}
+
+	unused := &mockDialer{}
+
+	dialer := &mockDialer{}
+	dialer.On("Dial", "tcp", "localhost:7624").Return(conn, nil).Twice()
+
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelInfo)
+	c := indiclient.NewINDIClient(log, unused, afero.NewMemMapFs(), 5)
+
+	err := c.ConnectWithOptions("tcp", "localhost:7624", indiclient.ConnectOptions{Dialer: dialer})
+	require.NoError(t, err)
+	require.NoError(t, c.Disconnect())
+
+	// Later connections keep using it.
+	err = c.Connect("tcp", "localhost:7624")
+	require.NoError(t, err)
+	require.NoError(t, c.Disconnect())
+
+	dialer.AssertExpectations(t)
+	unused.AssertExpectations(t)
+}
+
+// serveProxy runs an HTTP proxy that answers CONNECT requests for allowed with a greeting from the target, and refuses
+// the rest.
+func serveProxy(t *testing.T, allowed string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+
+				if req.Method != http.MethodConnect || req.Host != allowed {
+					fmt.Fprint(conn, "HTTP/1.1 403 Forbidden\r\n\r\n")
+					return
+				}
+
+				if user, password, _ := parseProxyAuth(req); user != "astro" || password != "secret" {
+					fmt.Fprint(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+					return
+				}
+
+				// The greeting arrives with the response, as it might from a fast server.
+				fmt.Fprint(conn, "HTTP/1.1 200 Connection established\r\n\r\n<message message=\"hello\"/>")
+			}()
+		}
+	}()
+
+	return l
+}
+
+func parseProxyAuth(req *http.Request) (string, string, bool) {
+	r := &http.Request{Header: http.Header{"Authorization": req.Header["Proxy-Authorization"]}}
+	return r.BasicAuth()
+}
+
+func Test_HTTPProxyDialer(t *testing.T) {
+	l := serveProxy(t, "observatory.local:7624")
+	defer l.Close()
+
+	d := indiclient.HTTPProxyDialer{Proxy: "http://astro:secret@" + l.Addr().String()}
+
+	conn, err := d.Dial("tcp", "observatory.local:7624")
+	require.NoError(t, err)
+
+	greeting, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, `<message message="hello"/>`, string(greeting))
+	conn.Close()
+
+	_, err = d.Dial("tcp", "observatory.local:22")
+	assert.Equal(t, &indiclient.ProxyError{StatusCode: 403, Status: "403 Forbidden"}, err)
+
+	d.Proxy = "http://" + l.Addr().String()
+	_, err = d.Dial("tcp", "observatory.local:7624")
+	assert.Equal(t, &indiclient.ProxyError{StatusCode: 407, Status: "407 Proxy Authentication Required"}, err)
+
+	_, err = d.Dial("unix", "/tmp/indiserver")
+	assert.Equal(t, net.UnknownNetworkError("unix"), err)
+
+	d.Proxy = "socks5://" + l.Addr().String()
+	_, err = d.Dial("tcp", "observatory.local:7624")
+	assert.Equal(t, indiclient.ErrInvalidAddress, err)
+}
+
+func Test_HTTPProxyDialer_Context(t *testing.T) {
+	// A proxy that accepts the connection, but never answers CONNECT.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	var d indiclient.ContextDialer = indiclient.HTTPProxyDialer{Proxy: "http://" + l.Addr().String()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = d.DialContext(ctx, "tcp", "observatory.local:7624")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 5*time.Second, time.Since(start).String())
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	_, err = d.DialContext(ctx, "tcp", "observatory.local:7624")
+	assert.Equal(t, context.Canceled, err)
+}
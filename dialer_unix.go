@@ -0,0 +1,11 @@
+//go:build unix
+// +build unix
+
+package indiclient
+
+import "syscall"
+
+// checkAccess returns an error if the current user cannot read and write path.
+func checkAccess(path string) error {
+	return syscall.Access(path, 0x6)
+}
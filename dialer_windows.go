@@ -0,0 +1,6 @@
+package indiclient
+
+// checkAccess is a no-op on Windows, where AF_UNIX sockets are protected by the file ACLs.
+func checkAccess(path string) error {
+	return nil
+}
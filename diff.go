@@ -0,0 +1,253 @@
+package indiclient
+
+import (
+	"sort"
+	"strconv"
+)
+
+// ChangeType is the kind of difference a Change describes.
+type ChangeType string
+
+const (
+	// ChangeAdded is a device, property or element that is only in the newer snapshot.
+	ChangeAdded = ChangeType("added")
+	// ChangeRemoved is a device, property or element that is only in the older snapshot.
+	ChangeRemoved = ChangeType("removed")
+	// ChangeModified is an attribute of a property or element that differs between the snapshots.
+	ChangeModified = ChangeType("modified")
+)
+
+// Change is a single difference between two snapshots of the device tree, found by Diff. Property is empty for a
+// device that was added or removed, and Element for a change to the property itself. Field names the attribute that
+// was modified: "state", "label", "group" or "permissions" for a property, and "value", "label", "format", "min",
+// "max", "step", "size" or "sequence" for an element. Old and New hold its values, formatted as strings.
+type Change struct {
+	Type     ChangeType   `json:"type"`
+	Device   string       `json:"device"`
+	Property string       `json:"property,omitempty"`
+	Kind     PropertyType `json:"kind,omitempty"`
+	Element  string       `json:"element,omitempty"`
+	Field    string       `json:"field,omitempty"`
+	Old      string       `json:"old,omitempty"`
+	New      string       `json:"new,omitempty"`
+}
+
+// Snapshot returns a snapshot of every device, keyed by name, to compare with Diff.
+func (c *INDIClient) Snapshot() map[string]Device {
+	devices := c.publishedDevices()
+
+	snapshot := make(map[string]Device, len(devices))
+
+	for name, device := range devices {
+		cp := device.Copy()
+		cp.Name = c.aliasDevice(name)
+		snapshot[cp.Name] = cp
+	}
+
+	return snapshot
+}
+
+// Diff compares two snapshots of the device tree, such as those returned by Snapshot, and returns what changed from a
+// to b: devices, properties and elements that were added or removed, and attributes that were modified. A property
+// that changes type is reported as removed and added. Changes are sorted by device, property and element. Messages
+// and timestamps are not compared.
+func Diff(a, b map[string]Device) []Change {
+	changes := []Change{}
+
+	for _, name := range unionKeys(deviceKeys(a), deviceKeys(b)) {
+		da, inA := a[name]
+		db, inB := b[name]
+
+		switch {
+		case !inA:
+			changes = append(changes, Change{Type: ChangeAdded, Device: name})
+		case !inB:
+			changes = append(changes, Change{Type: ChangeRemoved, Device: name})
+		default:
+			changes = append(changes, diffDevice(name, da, db)...)
+		}
+	}
+
+	return changes
+}
+
+// diffProperty is a property flattened to strings, so every kind of property can be compared the same way.
+type diffProperty struct {
+	kind     PropertyType
+	fields   map[string]string
+	elements map[string]map[string]string
+}
+
+// propertyFields are the attributes of a property compared by Diff, in the order they are reported.
+var propertyFields = []string{"state", "label", "group", "permissions"}
+
+// elementFields are the attributes of an element compared by Diff, in the order they are reported.
+var elementFields = []string{"value", "label", "format", "min", "max", "step", "size", "sequence"}
+
+func diffDevice(name string, a, b Device) []Change {
+	changes := []Change{}
+
+	pa, pb := flattenDevice(a), flattenDevice(b)
+
+	for _, prop := range unionKeys(propertyKeys(pa), propertyKeys(pb)) {
+		x, inA := pa[prop]
+		y, inB := pb[prop]
+
+		if inA && inB && x.kind != y.kind {
+			changes = append(changes,
+				Change{Type: ChangeRemoved, Device: name, Property: prop, Kind: x.kind},
+				Change{Type: ChangeAdded, Device: name, Property: prop, Kind: y.kind},
+			)
+			continue
+		}
+
+		switch {
+		case !inA:
+			changes = append(changes, Change{Type: ChangeAdded, Device: name, Property: prop, Kind: y.kind})
+			continue
+		case !inB:
+			changes = append(changes, Change{Type: ChangeRemoved, Device: name, Property: prop, Kind: x.kind})
+			continue
+		}
+
+		changes = append(changes, diffFields(Change{Device: name, Property: prop, Kind: x.kind}, propertyFields, x.fields, y.fields)...)
+
+		for _, el := range unionKeys(elementKeys(x.elements), elementKeys(y.elements)) {
+			ea, inA := x.elements[el]
+			eb, inB := y.elements[el]
+
+			switch {
+			case !inA:
+				changes = append(changes, Change{Type: ChangeAdded, Device: name, Property: prop, Kind: x.kind, Element: el})
+			case !inB:
+				changes = append(changes, Change{Type: ChangeRemoved, Device: name, Property: prop, Kind: x.kind, Element: el})
+			default:
+				changes = append(changes, diffFields(Change{Device: name, Property: prop, Kind: x.kind, Element: el}, elementFields, ea, eb)...)
+			}
+		}
+	}
+
+	return changes
+}
+
+// diffFields returns a ChangeModified based on base for each of fields that differs between a and b.
+func diffFields(base Change, fields []string, a, b map[string]string) []Change {
+	changes := []Change{}
+
+	for _, f := range fields {
+		if a[f] == b[f] {
+			continue
+		}
+
+		c := base
+		c.Type = ChangeModified
+		c.Field = f
+		c.Old = a[f]
+		c.New = b[f]
+
+		changes = append(changes, c)
+	}
+
+	return changes
+}
+
+func flattenDevice(d Device) map[string]diffProperty {
+	props := map[string]diffProperty{}
+
+	property := func(kind PropertyType, state PropertyState, label, group string, perm PropertyPermission) diffProperty {
+		return diffProperty{
+			kind:     kind,
+			fields:   map[string]string{"state": string(state), "label": label, "group": group, "permissions": string(perm)},
+			elements: map[string]map[string]string{},
+		}
+	}
+
+	for name, p := range d.TextProperties {
+		fp := property(PropertyTypeText, p.State, p.Label, p.Group, p.Permissions)
+		for n, v := range p.Values {
+			fp.elements[n] = map[string]string{"value": v.Value, "label": v.Label}
+		}
+		props[name] = fp
+	}
+
+	for name, p := range d.NumberProperties {
+		fp := property(PropertyTypeNumber, p.State, p.Label, p.Group, p.Permissions)
+		for n, v := range p.Values {
+			fp.elements[n] = map[string]string{"value": v.Value, "label": v.Label, "format": v.Format, "min": v.Min, "max": v.Max, "step": v.Step}
+		}
+		props[name] = fp
+	}
+
+	for name, p := range d.SwitchProperties {
+		fp := property(PropertyTypeSwitch, p.State, p.Label, p.Group, p.Permissions)
+		for n, v := range p.Values {
+			fp.elements[n] = map[string]string{"value": string(v.Value), "label": v.Label}
+		}
+		props[name] = fp
+	}
+
+	for name, p := range d.LightProperties {
+		fp := property(PropertyTypeLight, p.State, p.Label, p.Group, PropertyPermissionReadOnly)
+		for n, v := range p.Values {
+			fp.elements[n] = map[string]string{"value": string(v.Value), "label": v.Label}
+		}
+		props[name] = fp
+	}
+
+	for name, p := range d.BlobProperties {
+		fp := property(PropertyTypeBlob, p.State, p.Label, p.Group, p.Permissions)
+		for n, v := range p.Values {
+			fp.elements[n] = map[string]string{
+				"value":    v.Value,
+				"label":    v.Label,
+				"format":   v.Format,
+				"size":     strconv.FormatInt(v.Size, 10),
+				"sequence": strconv.FormatUint(v.Sequence, 10),
+			}
+		}
+		props[name] = fp
+	}
+
+	return props
+}
+
+func deviceKeys(m map[string]Device) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func propertyKeys(m map[string]diffProperty) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func elementKeys(m map[string]map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// unionKeys returns the keys in a or b, sorted and without duplicates.
+func unionKeys(a, b []string) []string {
+	set := map[string]bool{}
+	keys := []string{}
+
+	for _, k := range append(a, b...) {
+		if !set[k] {
+			set[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,60 @@
+package indiclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Diff(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+	defineBlob(c)
+
+	before := c.Snapshot()
+
+	assert.Empty(t, Diff(before, c.Snapshot()))
+
+	setCoords(c, "5.5")
+	c.delProperty(&DelProperty{Device: "Camera"})
+	c.defTextVector(&DefTextVector{
+		Device: "Mount",
+		Name:   "MOUNT_INFO",
+		Texts:  []DefText{{Name: "MODEL", Value: "EQ6"}},
+	})
+
+	after := c.Snapshot()
+
+	assert.Equal(t, []Change{
+		{Type: ChangeRemoved, Device: "Camera"},
+		{Type: ChangeModified, Device: "Mount", Property: "EQUATORIAL_EOD_COORD", Kind: PropertyTypeNumber, Field: "state", Old: "Idle", New: "Busy"},
+		{Type: ChangeModified, Device: "Mount", Property: "EQUATORIAL_EOD_COORD", Kind: PropertyTypeNumber, Element: "RA", Field: "value", Old: "0", New: "5.5"},
+		{Type: ChangeAdded, Device: "Mount", Property: "MOUNT_INFO", Kind: PropertyTypeText},
+	}, Diff(before, after))
+
+	assert.Equal(t, []Change{
+		{Type: ChangeAdded, Device: "Camera"},
+		{Type: ChangeModified, Device: "Mount", Property: "EQUATORIAL_EOD_COORD", Kind: PropertyTypeNumber, Field: "state", Old: "Busy", New: "Idle"},
+		{Type: ChangeModified, Device: "Mount", Property: "EQUATORIAL_EOD_COORD", Kind: PropertyTypeNumber, Element: "RA", Field: "value", Old: "5.5", New: "0"},
+		{Type: ChangeRemoved, Device: "Mount", Property: "MOUNT_INFO", Kind: PropertyTypeText},
+	}, Diff(after, before))
+
+	// Snapshots are copies, and use aliases.
+	assert.NoError(t, c.SetDeviceAlias("mount", "Mount"))
+	setCoords(c, "6")
+
+	aliased := c.Snapshot()
+	assert.Contains(t, aliased, "mount")
+	assert.Equal(t, "5.5", after["Mount"].NumberProperties["EQUATORIAL_EOD_COORD"].Values["RA"].Value)
+
+	// A property that changes type is removed and added again.
+	orig := aliased["mount"]
+	changed := orig.Copy()
+	delete(changed.NumberProperties, "EQUATORIAL_EOD_COORD")
+	changed.TextProperties["EQUATORIAL_EOD_COORD"] = TextProperty{Name: "EQUATORIAL_EOD_COORD"}
+
+	assert.Equal(t, []Change{
+		{Type: ChangeRemoved, Device: "mount", Property: "EQUATORIAL_EOD_COORD", Kind: PropertyTypeNumber},
+		{Type: ChangeAdded, Device: "mount", Property: "EQUATORIAL_EOD_COORD", Kind: PropertyTypeText},
+	}, Diff(map[string]Device{"mount": orig}, map[string]Device{"mount": changed}))
+}
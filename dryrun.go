@@ -0,0 +1,114 @@
+package indiclient
+
+// DryRunError is returned by commands in dry-run mode instead of sending them. The command has passed all the checks
+// it would have been sent after, and through the outbound interceptors, as the write loop would send it. See
+// SetDryRun.
+type DryRunError struct {
+	// XML is the command as the interceptors left it. It is empty if one of them would have dropped it.
+	XML string
+	// Wire is what would have been written to indiserver: XML encoded by the client's Codec, which for the default
+	// XMLCodec is XML itself.
+	Wire []byte
+}
+
+func (e *DryRunError) Error() string {
+	return "indiclient: dry run: " + e.XML
+}
+
+// SetDryRun turns dry-run mode on or off. In dry-run mode, GetProperties, EnableBlob and the Set*Value methods, and
+// everything built on them, check their arguments and the device tree as usual, and the command is checked with its
+// Validate method and passed through the outbound interceptors. Then they return a *DryRunError holding the XML of the
+// command instead of sending it, and the property is not marked busy. Commands downstream clients send
+// through a Repeater are dropped. This shows what the client would tell a driver that seems to be ignoring it.
+func (c *INDIClient) SetDryRun(enabled bool) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.dryRun = enabled
+}
+
+// DryRun returns true if the client is in dry-run mode. See SetDryRun.
+func (c *INDIClient) DryRun() bool {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.dryRun
+}
+
+// DryRunGetProperties returns the XML GetProperties would send, without sending it, regardless of dry-run mode.
+func (c *INDIClient) DryRunGetProperties(deviceName, propName string) (string, error) {
+	return dryRunXML(c.sendGetProperties(deviceName, propName, true))
+}
+
+// DryRunEnableBlob returns the XML EnableBlob would send, without sending it, regardless of dry-run mode.
+func (c *INDIClient) DryRunEnableBlob(deviceName, propName string, val BlobEnable) (string, error) {
+	return dryRunXML(c.enableBlob(deviceName, propName, val, true))
+}
+
+// DryRunTextValue returns the XML SetTextValue would send, without sending it, regardless of dry-run mode.
+func (c *INDIClient) DryRunTextValue(deviceName, propName string, textNames, textValues []string) (string, error) {
+	return dryRunXML(c.setTextValue(deviceName, propName, textNames, textValues, true, SetOptions{}))
+}
+
+// DryRunNumberValue returns the XML SetNumberValue would send, without sending it, regardless of dry-run mode.
+func (c *INDIClient) DryRunNumberValue(deviceName, propName string, numberNames, numberValues []string) (string, error) {
+	return dryRunXML(c.setNumberValue(deviceName, propName, numberNames, numberValues, true, SetOptions{}))
+}
+
+// DryRunSwitchValue returns the XML SetSwitchValue would send, without sending it, regardless of dry-run mode.
+func (c *INDIClient) DryRunSwitchValue(deviceName, propName string, switchNames []string, switchValues []SwitchState) (string, error) {
+	return dryRunXML(c.setSwitchValue(deviceName, propName, switchNames, switchValues, true, SetOptions{}))
+}
+
+// DryRunBlobValue returns the XML SetBlobValue would send, without sending it, regardless of dry-run mode.
+func (c *INDIClient) DryRunBlobValue(deviceName, propName, blobName, blobValue, blobFormat string, blobSize int) (string, error) {
+	return dryRunXML(c.setBlobValue(deviceName, propName, blobName, blobValue, blobFormat, blobSize, true, SetOptions{}))
+}
+
+// newDryRunError validates cmd, and returns a *DryRunError with what the write loop would send for it, or the
+// *ValidationError if it is not valid.
+func (c *INDIClient) newDryRunError(cmd interface{ Validate() error }) error {
+	if err := cmd.Validate(); err != nil {
+		return err
+	}
+
+	return c.dryRunSend(cmd)
+}
+
+// dryRunSend returns a *DryRunError with what the write loop would send for cmd, after the outbound interceptors and
+// the codec.
+func (c *INDIClient) dryRunSend(cmd interface{}) error {
+	c.rwm.RLock()
+	codec := c.codec
+	c.rwm.RUnlock()
+
+	dr := &DryRunError{}
+
+	var err error
+
+	c.outboundHandler(func(msg interface{}) {
+		var b []byte
+
+		if b, err = marshalCommand(msg); err != nil {
+			return
+		}
+
+		dr.XML = string(b)
+		dr.Wire, err = codec.Encode(b)
+	})(cmd)
+
+	if err != nil {
+		return err
+	}
+
+	return dr
+}
+
+// dryRunXML turns the error from a command run in dry-run mode back into its XML.
+func dryRunXML(err error) (string, error) {
+	if dr, ok := err.(*DryRunError); ok {
+		return dr.XML, nil
+	}
+
+	return "", err
+}
@@ -0,0 +1,96 @@
+package indiclient
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DryRun(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+
+	out, err := c.DryRunNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"5.5"})
+	require.NoError(t, err)
+	assert.Equal(t, `<newNumberVector device="Mount" name="EQUATORIAL_EOD_COORD"><oneNumber name="RA">5.5</oneNumber></newNumberVector>`, out)
+
+	// The usual checks still apply.
+	_, err = c.DryRunNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"ALT"}, []string{"5.5"})
+	assert.True(t, errors.Is(err, ErrPropertyValueNotFound))
+
+	// As does Validate.
+	_, err = c.DryRunNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"fast"})
+	assert.IsType(t, &ValidationError{}, err)
+
+	out, err = c.DryRunGetProperties("Mount", "")
+	require.NoError(t, err)
+	assert.Equal(t, `<getProperties version="1.7" device="Mount"></getProperties>`, out)
+
+	// Without a connection, these would block forever if they were sent.
+	c.SetDryRun(true)
+	assert.True(t, c.DryRun())
+
+	err = c.SetNumber("Mount", "EQUATORIAL_EOD_COORD", map[string]float64{"DEC": 10})
+	require.IsType(t, &DryRunError{}, err)
+	assert.Contains(t, err.(*DryRunError).XML, `<oneNumber name="DEC">10</oneNumber>`)
+
+	prop, err := c.GetNumberProperty("Mount", "EQUATORIAL_EOD_COORD")
+	require.NoError(t, err)
+	assert.Equal(t, PropertyStateIdle, prop.State)
+
+	assert.IsType(t, &DryRunError{}, c.GetProperties("", ""))
+}
+
+func Test_DryRun_Outbound(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+
+	c.UseOutbound(func(next Handler) Handler {
+		return func(msg interface{}) {
+			cmd, ok := msg.(NewNumberVector)
+			if !ok {
+				next(msg)
+				return
+			}
+
+			// Drop commands to DEC, and round RA.
+			if cmd.Numbers[0].Name == "DEC" {
+				return
+			}
+
+			cmd.Numbers = []OneNumber{{Name: "RA", Value: "6"}}
+			next(cmd)
+		}
+	})
+
+	out, err := c.DryRunNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"5.5"})
+	require.NoError(t, err)
+	assert.Equal(t, `<newNumberVector device="Mount" name="EQUATORIAL_EOD_COORD"><oneNumber name="RA">6</oneNumber></newNumberVector>`, out)
+
+	out, err = c.DryRunNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"DEC"}, []string{"10"})
+	require.NoError(t, err)
+	assert.Empty(t, out)
+
+	// The wire format is the codec's.
+	c.rwm.Lock()
+	c.codec = JSONCodec{}
+	c.dryRun = true
+	c.rwm.Unlock()
+
+	err = c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"5.5"})
+	require.IsType(t, &DryRunError{}, err)
+
+	dr := err.(*DryRunError)
+	assert.Equal(t, `<newNumberVector device="Mount" name="EQUATORIAL_EOD_COORD"><oneNumber name="RA">6</oneNumber></newNumberVector>`, dr.XML)
+
+	wire, err := JSONCodec{}.Encode([]byte(dr.XML))
+	require.NoError(t, err)
+	assert.Equal(t, string(wire), string(dr.Wire))
+	assert.Contains(t, string(dr.Wire), `"newNumberVector"`)
+
+	err = c.SendRaw([]byte(`<getProperties version="1.7"/>`))
+	require.IsType(t, &DryRunError{}, err)
+	assert.Equal(t, `<getProperties version="1.7"/>`, err.(*DryRunError).XML)
+}
@@ -0,0 +1,222 @@
+package indiclient
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// EquipmentProfile is the desired state of the equipment, such as a camera's gain and binning or a mount's site, so a
+// setup can be restored to a known-good state each night with ApplyEquipment, and checked with VerifyEquipment.
+// Unlike Profile, which configures the client, it describes the devices.
+type EquipmentProfile struct {
+	Name string `json:"name"`
+	// Settings are applied in order, so a device can be connected before its other properties are set.
+	Settings []Setting `json:"settings"`
+}
+
+// Setting is the desired value of some or all of the elements of a property.
+type Setting struct {
+	Device   string `json:"device"`
+	Property string `json:"property"`
+	// Values maps element names to their values, written as in INDI XML: numbers in any format ParseNumber accepts,
+	// switches On or Off, and lights Idle, Ok, Busy or Alert. Lights can be verified but not applied.
+	Values map[string]string `json:"values"`
+	// Tolerance is how far a number may be from its value without drifting.
+	Tolerance float64 `json:"tolerance,omitempty"`
+}
+
+// Drift is an element whose value differs from its Setting.
+type Drift struct {
+	Device   string `json:"device"`
+	Property string `json:"property"`
+	Element  string `json:"element"`
+	Want     string `json:"want"`
+	Got      string `json:"got"`
+	// Missing is true if the device, property or element is not defined, in which case Got is empty.
+	Missing bool `json:"missing"`
+}
+
+// LoadEquipmentProfile reads a profile saved by SaveEquipmentProfile from path on fs.
+func LoadEquipmentProfile(fs afero.Fs, path string) (EquipmentProfile, error) {
+	p := EquipmentProfile{}
+
+	b, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return p, err
+	}
+
+	err = json.Unmarshal(b, &p)
+
+	return p, err
+}
+
+// SaveEquipmentProfile writes p to path on fs as JSON, replacing any existing file.
+func SaveEquipmentProfile(fs afero.Fs, path string, p EquipmentProfile) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return afero.WriteFile(fs, path, b, 0644)
+}
+
+// VerifyEquipment returns the elements whose values differ from p, in the order of its settings, and sorted by
+// element within each setting. It returns an empty slice if the equipment matches p.
+func (c *INDIClient) VerifyEquipment(p EquipmentProfile) []Drift {
+	drift := []Drift{}
+
+	for _, s := range p.Settings {
+		drift = append(drift, c.verifySetting(s)...)
+	}
+
+	return drift
+}
+
+// ApplyEquipment sets the properties of p that have drifted, in order, waiting for each to be Ok as the Set*Value
+// methods do. Settings whose property is not defined yet are waited for, so that the properties a driver defines once
+// its device is connected can follow the setting that connects it. It stops at the first setting that fails, and
+// returns its error, usually a *SetError, or ctx.Err() if ctx is done first. Cancelling ctx does not withdraw a
+// command that has already been sent.
+func (c *INDIClient) ApplyEquipment(ctx context.Context, p EquipmentProfile) error {
+	for _, s := range p.Settings {
+		err := c.waitForValue(ctx, s.Device, s.Property, func() (bool, error) {
+			device, err := c.GetDevice(s.Device)
+			if err != nil {
+				return false, err
+			}
+
+			_, ok := device.PropertyInfo(s.Property)
+			return ok, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(c.verifySetting(s)) == 0 {
+			continue
+		}
+
+		done := make(chan error, 1)
+		go func(s Setting) {
+			done <- c.applySetting(ctx, s)
+		}(s)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// applySetting sends the values of s, with ctx for tracing.
+func (c *INDIClient) applySetting(ctx context.Context, s Setting) error {
+	device, err := c.GetDevice(s.Device)
+	if err != nil {
+		return c.rejected("ApplyEquipment", c.resolveDevice(s.Device), s.Property, "", "", err)
+	}
+
+	info, _ := device.PropertyInfo(s.Property)
+
+	names := settingElements(s)
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = s.Values[name]
+	}
+
+	opts := SetOptions{Context: ctx}
+
+	switch info.Type {
+	case PropertyTypeText:
+		return c.SetTextValueWithOptions(s.Device, s.Property, names, values, opts)
+	case PropertyTypeNumber:
+		return c.SetNumberValueWithOptions(s.Device, s.Property, names, values, opts)
+	case PropertyTypeSwitch:
+		states := make([]SwitchState, len(values))
+		for i, v := range values {
+			switch {
+			case strings.EqualFold(v, string(SwitchStateOn)):
+				states[i] = SwitchStateOn
+			case strings.EqualFold(v, string(SwitchStateOff)):
+				states[i] = SwitchStateOff
+			default:
+				states[i] = SwitchState(v)
+			}
+		}
+		return c.SetSwitchValueWithOptions(s.Device, s.Property, names, states, opts)
+	default:
+		return c.rejected("ApplyEquipment", c.resolveDevice(s.Device), s.Property, "", info.State, ErrPropertyReadOnly)
+	}
+}
+
+// verifySetting returns the elements of s that have drifted.
+func (c *INDIClient) verifySetting(s Setting) []Drift {
+	drift := []Drift{}
+
+	current := map[string]string{}
+	var propType PropertyType
+
+	if device, err := c.GetDevice(s.Device); err == nil {
+		info, _ := device.PropertyInfo(s.Property)
+		propType = info.Type
+
+		values, _ := device.Elements(s.Property)
+		for _, v := range values {
+			current[v.ElementName()] = v.String()
+		}
+	}
+
+	for _, name := range settingElements(s) {
+		want := s.Values[name]
+
+		got, ok := current[name]
+		if !ok {
+			drift = append(drift, Drift{Device: s.Device, Property: s.Property, Element: name, Want: want, Missing: true})
+			continue
+		}
+
+		if !settingMatches(propType, want, got, s.Tolerance) {
+			drift = append(drift, Drift{Device: s.Device, Property: s.Property, Element: name, Want: want, Got: got})
+		}
+	}
+
+	return drift
+}
+
+// settingMatches returns true if got, the value of an element of a property of type propType, is want.
+func settingMatches(propType PropertyType, want, got string, tolerance float64) bool {
+	switch propType {
+	case PropertyTypeNumber:
+		w, errW := ParseNumber(want)
+		g, errG := ParseNumber(got)
+		if errW != nil || errG != nil {
+			return strings.TrimSpace(want) == strings.TrimSpace(got)
+		}
+		return math.Abs(w-g) <= tolerance
+	case PropertyTypeSwitch, PropertyTypeLight:
+		return strings.EqualFold(strings.TrimSpace(want), got)
+	default:
+		return want == got
+	}
+}
+
+// settingElements returns the element names of s, sorted.
+func settingElements(s Setting) []string {
+	names := make([]string, 0, len(s.Values))
+	for name := range s.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
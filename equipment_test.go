@@ -0,0 +1,77 @@
+package indiclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_EquipmentProfile(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	defer close(c.write)
+
+	c.rwm.Lock()
+	defineCoords(c)
+	c.rwm.Unlock()
+	defineFocuser(c)
+	defineWeather(c)
+
+	answerCommands(c, "")
+
+	p := EquipmentProfile{
+		Name: "Nightly",
+		Settings: []Setting{
+			{Device: "Mount", Property: "EQUATORIAL_EOD_COORD", Values: map[string]string{"RA": "1:30", "DEC": "0"}},
+			{Device: "Focuser", Property: "ABS_FOCUS_POSITION", Values: map[string]string{"FOCUS_ABSOLUTE_POSITION": "1000"}, Tolerance: 5},
+			{Device: "Weather", Property: "WEATHER_STATUS", Values: map[string]string{"WEATHER_RAIN_HAZARD": "ok"}},
+		},
+	}
+
+	fs := afero.NewMemMapFs()
+	require.NoError(t, SaveEquipmentProfile(fs, "nightly.json", p))
+	loaded, err := LoadEquipmentProfile(fs, "nightly.json")
+	require.NoError(t, err)
+	assert.Equal(t, p, loaded)
+
+	assert.Equal(t, []Drift{
+		{Device: "Mount", Property: "EQUATORIAL_EOD_COORD", Element: "RA", Want: "1:30", Got: "0"},
+		{Device: "Focuser", Property: "ABS_FOCUS_POSITION", Element: "FOCUS_ABSOLUTE_POSITION", Want: "1000", Got: "0"},
+	}, c.VerifyEquipment(p))
+
+	require.NoError(t, c.ApplyEquipment(context.Background(), p))
+	assert.Empty(t, c.VerifyEquipment(p))
+
+	ra, err := c.GetNumber("Mount", "EQUATORIAL_EOD_COORD", "RA")
+	require.NoError(t, err)
+	assert.Equal(t, "1:30", ra.Value)
+
+	// Within the tolerance.
+	setFocus := func(pos string) {
+		c.rwm.Lock()
+		defer c.rwm.Unlock()
+		c.setNumberVector(&SetNumberVector{Device: "Focuser", Name: "ABS_FOCUS_POSITION", State: PropertyStateOk, Numbers: []OneNumber{{Name: "FOCUS_ABSOLUTE_POSITION", Value: pos}}})
+	}
+	setFocus("1003")
+	assert.Empty(t, c.VerifyEquipment(p))
+	setFocus("1010")
+	assert.Len(t, c.VerifyEquipment(p), 1)
+
+	// Lights cannot be applied.
+	setWeather(c, PropertyStateAlert)
+	err = c.ApplyEquipment(context.Background(), EquipmentProfile{Settings: p.Settings[2:]})
+	assert.IsType(t, &SetError{}, err)
+	assert.Contains(t, err.Error(), ErrPropertyReadOnly.Error())
+
+	// Properties that are not defined are reported, and waited for.
+	missing := EquipmentProfile{Settings: []Setting{{Device: "Camera", Property: "CCD_GAIN", Values: map[string]string{"GAIN": "100"}}}}
+	assert.Equal(t, []Drift{{Device: "Camera", Property: "CCD_GAIN", Element: "GAIN", Want: "100", Missing: true}}, c.VerifyEquipment(missing))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, c.ApplyEquipment(ctx, missing))
+}
@@ -0,0 +1,182 @@
+package indiclient
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrPropertyAlert is wrapped by the *SetError returned when the driver sets the property to Alert in answer to a
+	// command.
+	ErrPropertyAlert = errors.New("property alert")
+
+	// ErrCommandTimeout is wrapped by the *SetError returned when the property is still Busy after the command
+	// timeout. See SetCommandTimeout.
+	ErrCommandTimeout = errors.New("timed out waiting for property")
+
+	// ErrPropertyRedefined is wrapped by the *SetError returned when the driver defines the property again with
+	// different elements or limits while a command is waiting for its answer, as some drivers do when a device
+	// connects.
+	ErrPropertyRedefined = errors.New("property redefined")
+
+	// ErrPropertyDeleted is wrapped by the *SetError returned when the driver deletes the property, or its device,
+	// while a command is waiting for its answer.
+	ErrPropertyDeleted = errors.New("property deleted")
+
+	// ErrDisconnected is wrapped by the *SetError returned when the client disconnects from indiserver while a
+	// command is waiting for its answer.
+	ErrDisconnected = errors.New("disconnected")
+
+	// ErrValueCount is wrapped by the *SetError returned when a Set*Value call has a different number of names and
+	// values.
+	ErrValueCount = errors.New("number of names and values differ")
+)
+
+// SetError is returned by the Set*Value methods, and everything built on them, when a command fails. Use errors.Is
+// to branch on the cause:
+//
+//	var setErr *indiclient.SetError
+//	switch {
+//	case errors.Is(err, indiclient.ErrPropertyAlert):
+//		// The driver refused the command; the error's Message usually says why.
+//	case errors.Is(err, indiclient.ErrCommandTimeout):
+//		// The driver did not answer in time.
+//	case errors.As(err, &setErr) && !setErr.Sent:
+//		// The command was not valid for the device tree, and was never sent.
+//	}
+type SetError struct {
+	// Op is the method that failed, e.g. SetNumberValue.
+	Op       string
+	Device   string
+	Property string
+	// Element is the element the error is about, if any.
+	Element string
+	// State is the state of the property when the command failed, or empty if the property is not defined.
+	State PropertyState
+	// Message is the message the driver sent after the command that best explains the failure, if any: the newest
+	// error for the property or device, or else the newest message for the property.
+	Message string
+	// Severity is the severity of Message. See ClassifyMessage.
+	Severity MessageSeverity
+	// Sent is true if the command was sent to indiserver. It is false when the command failed the checks made
+	// before sending it.
+	Sent bool
+	// Err is the cause: ErrPropertyAlert, ErrCommandTimeout, or one of the errors the command is checked for before
+	// it is sent, such as ErrPropertyNotFound, ErrPropertyValueNotFound, ErrPropertyReadOnly, ErrPropertyStateBusy,
+	// ErrValueCount or ErrForbidden.
+	Err error
+}
+
+func (e *SetError) Error() string {
+	b := strings.Builder{}
+
+	b.WriteString("indiclient: ")
+	b.WriteString(e.Op)
+	b.WriteString(" ")
+	b.WriteString(e.Device)
+
+	if len(e.Property) > 0 {
+		b.WriteString(".")
+		b.WriteString(e.Property)
+	}
+
+	if len(e.Element) > 0 {
+		b.WriteString(".")
+		b.WriteString(e.Element)
+	}
+
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+
+	if len(e.Message) > 0 {
+		b.WriteString(": ")
+		b.WriteString(e.Message)
+	}
+
+	return b.String()
+}
+
+// Unwrap returns the cause of the failure.
+func (e *SetError) Unwrap() error {
+	return e.Err
+}
+
+// SetCommandTimeout sets how long the Set*Value methods wait for the driver to answer a command before returning
+// ErrCommandTimeout. Zero, the default, waits forever. The property is left Busy when a command times out, so the
+// next command is refused with ErrPropertyStateBusy until the driver does answer, unless SetBusyHandling says
+// otherwise.
+func (c *INDIClient) SetCommandTimeout(timeout time.Duration) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.commandTimeout = timeout
+}
+
+// CommandTimeout returns the command timeout. See SetCommandTimeout.
+func (c *INDIClient) CommandTimeout() time.Duration {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.commandTimeout
+}
+
+// rejected returns the *SetError for a command that failed with err before it was sent.
+func (c *INDIClient) rejected(op, deviceName, propName, element string, state PropertyState, err error) *SetError {
+	return &SetError{
+		Op:       op,
+		Device:   c.aliasDevice(deviceName),
+		Property: propName,
+		Element:  element,
+		State:    state,
+		Err:      err,
+	}
+}
+
+// failed returns the *SetError for a sent command that failed with err. Its message is the newest error the driver
+// sent for the property after sent, or for the device if there is none, since drivers often explain an Alert in a
+// device message. Failing that, it is the newest message of any severity for the property.
+func (c *INDIClient) failed(op, deviceName, propName string, state PropertyState, messages []MessageJSON, sent time.Time, err error) *SetError {
+	e := c.rejected(op, deviceName, propName, "", state, err)
+	e.Sent = true
+
+	c.rwm.RLock()
+	deviceMessages := c.devices[deviceName].Messages
+	c.rwm.RUnlock()
+
+	m, ok := newestMessage(messages, sent, MessageSeverityError)
+	if !ok {
+		m, ok = newestMessage(deviceMessages, sent, MessageSeverityError)
+	}
+	if !ok {
+		m, ok = newestMessage(messages, sent, "")
+	}
+
+	if ok {
+		e.Message = m.Message
+		e.Severity = m.Severity
+	}
+
+	return e
+}
+
+// newestMessage returns the newest of messages received after sent with severity, or of any severity if severity is
+// empty.
+func newestMessage(messages []MessageJSON, sent time.Time, severity MessageSeverity) (MessageJSON, bool) {
+	for i := len(messages) - 1; i >= 0 && !messages[i].Timestamp.Before(sent); i-- {
+		if len(severity) == 0 || messages[i].Severity == severity {
+			return messages[i], true
+		}
+	}
+
+	return MessageJSON{}, false
+}
+
+// timedOut returns true if a command sent at sent has waited longer than the command timeout.
+func (c *INDIClient) timedOut(sent time.Time) bool {
+	c.rwm.RLock()
+	timeout := c.commandTimeout
+	c.rwm.RUnlock()
+
+	return timeout > 0 && c.now().Sub(sent) > timeout
+}
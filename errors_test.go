@@ -0,0 +1,207 @@
+package indiclient
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+func Test_SetError_Alert(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	defineCoords(c)
+
+	go func() {
+		<-c.write
+
+		c.rwm.Lock()
+		c.setNumberVector(&SetNumberVector{Device: "Mount", Name: "EQUATORIAL_EOD_COORD", State: PropertyStateAlert, Message: "[ERROR] Mount is parked"})
+		c.rwm.Unlock()
+	}()
+
+	err := c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrPropertyAlert))
+	assert.EqualError(t, err, "indiclient: SetNumberValue Mount.EQUATORIAL_EOD_COORD: property alert: [ERROR] Mount is parked")
+
+	var setErr *SetError
+	require.True(t, errors.As(err, &setErr))
+	assert.Equal(t, "Mount", setErr.Device)
+	assert.Equal(t, "EQUATORIAL_EOD_COORD", setErr.Property)
+	assert.Equal(t, PropertyStateAlert, setErr.State)
+	assert.Equal(t, "[ERROR] Mount is parked", setErr.Message)
+	assert.True(t, setErr.Sent)
+}
+
+func Test_SetError_Alert_Wire(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     string
+		message string
+	}{
+		{"fast", `<setNumberVector device="Mount" name="EQUATORIAL_EOD_COORD" state="Alert" message="[ERROR] Mount is parked"><oneNumber name="RA">0</oneNumber></setNumberVector>`, "[ERROR] Mount is parked"},
+		{"decoder", `<setNumberVector device="Mount" name="EQUATORIAL_EOD_COORD" state="Alert" message="[ERROR] Mount is &quot;parked&quot;"><oneNumber name="RA">0</oneNumber></setNumberVector>`, `[ERROR] Mount is "parked"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := queueDialer{conns: make(chan net.Conn, 1)}
+			c := NewINDIClient(logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError), d, afero.NewMemMapFs(), 100)
+
+			server, commands := d.serve()
+			require.NoError(t, c.Connect("tcp", "localhost:7624"))
+			defer c.Disconnect()
+
+			_, err := server.Write([]byte(`<defNumberVector device="Mount" name="EQUATORIAL_EOD_COORD" state="Idle" perm="rw">` +
+				`<defNumber name="RA" format="%f" min="0" max="24" step="0">0</defNumber></defNumberVector>`))
+			require.NoError(t, err)
+
+			testutil.WaitFor(t, func() bool { return c.NumberPropertySet("Mount", "EQUATORIAL_EOD_COORD") })
+
+			go func() {
+				<-commands
+
+				server.Write([]byte(tt.set))
+			}()
+
+			err = c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"})
+			assert.True(t, errors.Is(err, ErrPropertyAlert))
+			assert.EqualError(t, err, "indiclient: SetNumberValue Mount.EQUATORIAL_EOD_COORD: property alert: "+tt.message)
+
+			var setErr *SetError
+			require.True(t, errors.As(err, &setErr))
+			assert.Equal(t, tt.message, setErr.Message)
+			assert.Equal(t, MessageSeverityError, setErr.Severity)
+		})
+	}
+}
+
+func Test_SetError_Timeout(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	defineCoords(c)
+
+	c.SetCommandTimeout(20 * time.Millisecond)
+	assert.Equal(t, 20*time.Millisecond, c.CommandTimeout())
+
+	err := c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"})
+	assert.True(t, errors.Is(err, ErrCommandTimeout))
+
+	var setErr *SetError
+	require.True(t, errors.As(err, &setErr))
+	assert.Equal(t, PropertyStateBusy, setErr.State)
+	assert.Empty(t, setErr.Message)
+
+	// Still waiting for the driver.
+	err = c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"})
+	assert.True(t, errors.Is(err, ErrPropertyStateBusy))
+}
+
+func Test_SetError_Deleted(t *testing.T) {
+	for _, del := range []*DelProperty{
+		{Device: "Mount", Name: "EQUATORIAL_EOD_COORD"},
+		{Device: "Mount"},
+	} {
+		c := newTestClient()
+		c.write = make(chan interface{}, 10)
+		defineCoords(c)
+
+		go func() {
+			<-c.write
+
+			c.rwm.Lock()
+			c.delProperty(del)
+			c.rwm.Unlock()
+		}()
+
+		err := c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"})
+		assert.True(t, errors.Is(err, ErrPropertyDeleted))
+
+		var setErr *SetError
+		require.True(t, errors.As(err, &setErr))
+		assert.True(t, setErr.Sent)
+	}
+}
+
+func Test_SetError_Disconnected(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	defineCoords(c)
+
+	go func() {
+		<-c.write
+		c.Disconnect()
+	}()
+
+	err := c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"})
+	assert.True(t, errors.Is(err, ErrDisconnected))
+	assert.EqualError(t, err, "indiclient: SetNumberValue Mount.EQUATORIAL_EOD_COORD: disconnected")
+}
+
+func Test_SetError_Rejected(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+
+	tests := []struct {
+		name    string
+		err     error
+		element string
+		cause   error
+	}{
+		{"count", c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA", "DEC"}, []string{"1"}), "", ErrValueCount},
+		{"device", c.SetNumberValue("Focuser", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"}), "", ErrDeviceNotFound},
+		{"property", c.SetTextValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"}), "", ErrPropertyNotFound},
+		{"element", c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"ALT"}, []string{"1"}), "ALT", ErrPropertyValueNotFound},
+		{"SetNumber device", c.SetNumber("Focuser", "EQUATORIAL_EOD_COORD", map[string]float64{"RA": 1}), "", ErrDeviceNotFound},
+		{"SetNumber property", c.SetNumber("Mount", "EQUATORIAL_EOD_COORD_NOW", map[string]float64{"RA": 1}), "", ErrPropertyNotFound},
+		{"SetNumber element", c.SetNumber("Mount", "EQUATORIAL_EOD_COORD", map[string]float64{"ALT": 1}), "ALT", ErrPropertyValueNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.True(t, errors.Is(tt.err, tt.cause))
+
+			var setErr *SetError
+			require.True(t, errors.As(tt.err, &setErr))
+			assert.False(t, setErr.Sent)
+			assert.Equal(t, tt.element, setErr.Element)
+		})
+	}
+}
+
+func Test_SetError_DeviceMessage(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	defineCoords(c)
+
+	c.rwm.Lock()
+	c.message(&Message{Device: "Mount", Message: "[ERROR] An old error"})
+	c.rwm.Unlock()
+
+	go func() {
+		<-c.write
+
+		// Drivers usually log why before setting the property to Alert.
+		c.rwm.Lock()
+		c.message(&Message{Device: "Mount", Message: "[ERROR] Target is below the horizon"})
+		c.message(&Message{Device: "Mount", Message: "[INFO] Tracking stopped"})
+		c.setNumberVector(&SetNumberVector{Device: "Mount", Name: "EQUATORIAL_EOD_COORD", State: PropertyStateAlert, Message: "Slew failed"})
+		c.rwm.Unlock()
+	}()
+
+	err := c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"})
+
+	var setErr *SetError
+	require.True(t, errors.As(err, &setErr))
+	assert.Equal(t, "[ERROR] Target is below the horizon", setErr.Message)
+	assert.Equal(t, MessageSeverityError, setErr.Severity)
+}
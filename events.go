@@ -0,0 +1,296 @@
+package indiclient
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventType represents the kind of change an Event describes.
+type EventType string
+
+const (
+	// EventTypeDefine is sent when a device defines (or redefines) a property.
+	EventTypeDefine = EventType("define")
+	// EventTypeUpdate is sent when a device sends new values for a property.
+	EventTypeUpdate = EventType("update")
+	// EventTypeDelete is sent when a device deletes a property, or the device itself if Property is empty.
+	EventTypeDelete = EventType("delete")
+	// EventTypeMessage is sent when a device sends a message. Device is empty for messages from indiserver itself.
+	EventTypeMessage = EventType("message")
+	// EventTypeError is sent in ParseModeStrict when a message from indiserver cannot be parsed. Error describes
+	// the problem.
+	EventTypeError = EventType("error")
+	// EventTypeUnknownElement is sent in ParseModeCaptureUnknown when indiserver sends an element the client does not
+	// understand. Raw holds its XML.
+	EventTypeUnknownElement = EventType("unknownElement")
+	// EventTypeDriverRestarted is sent when a device is defined again soon after indiserver deleted it, which is what
+	// indiserver does when it restarts a driver that crashed. It is sent before the first property is defined again.
+	EventTypeDriverRestarted = EventType("driverRestarted")
+	// EventTypeLeaseConflict is sent when another client sends a command to a property leased with AcquireLease.
+	EventTypeLeaseConflict = EventType("leaseConflict")
+	// EventTypeDeviceStale is sent when a device has sent nothing for longer than its threshold. See
+	// SetStaleDetection.
+	EventTypeDeviceStale = EventType("deviceStale")
+	// EventTypeDeviceResumed is sent when a stale device sends something again.
+	EventTypeDeviceResumed = EventType("deviceResumed")
+	// EventTypeResync is sent when the client skipped part of the stream from indiserver to get past a malformed
+	// message. Error describes the problem. It is sent in every ParseMode.
+	EventTypeResync = EventType("resync")
+	// EventTypeReconnect is sent when the client reconnects to indiserver because too many messages in a row were
+	// malformed. See SetResync.
+	EventTypeReconnect = EventType("reconnect")
+	// EventTypeSchemaChange is sent after EventTypeDefine when a driver defines a property again with different
+	// elements, labels, group, permissions, rule or number limits, so views built from the old definition can be
+	// rebuilt.
+	EventTypeSchemaChange = EventType("schemaChange")
+)
+
+// Event describes a change to the device tree. Events only tell you that something changed; use GetText, GetNumber, etc.
+// to read the current values, which are always kept up to date regardless of any throttling on the subscription.
+// Severity is the severity of Message, see ClassifyMessage.
+type Event struct {
+	Type      EventType       `json:"type"`
+	Device    string          `json:"device"`
+	Property  string          `json:"property"`
+	State     PropertyState   `json:"state"`
+	Message   string          `json:"message"`
+	Severity  MessageSeverity `json:"severity"`
+	Error     string          `json:"error"`
+	Raw       string          `json:"raw"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// SubscribeOptions controls which events are delivered to a subscription and how often.
+type SubscribeOptions struct {
+	// Device limits the subscription to a single device. Empty means all devices, and messages from indiserver itself.
+	Device string
+	// Property limits the subscription to a single property. Requires Device.
+	Property string
+	// Types limits the subscription to the given event types. Empty means all types.
+	Types []EventType
+	// MaxRate is the maximum number of events per second delivered for each property. Events that arrive faster
+	// than this are coalesced, and the most recent one is delivered once the interval has passed. Zero means unlimited.
+	MaxRate float64
+	// Debounce delays delivery of events for a property until no new events have arrived for this long. Only the
+	// most recent event is delivered. Zero disables debouncing.
+	Debounce time.Duration
+}
+
+// subscription is a single consumer of events created by Subscribe.
+type subscription struct {
+	opts     SubscribeOptions
+	interval time.Duration
+	ch       chan Event
+
+	mu      sync.Mutex
+	closed  bool
+	limiter map[string]*propertyLimiter
+}
+
+// propertyLimiter tracks throttling and debouncing state for a single property of a subscription.
+type propertyLimiter struct {
+	lastSent time.Time
+	pending  *Event
+	timer    ClockTimer
+	// generation counts the timers started, so a callback can tell it has been replaced.
+	generation uint64
+}
+
+// Subscribe creates a new event subscription. Events are delivered on the returned channel, which is buffered with the
+// client's bufferSize. If the channel is full, new events are dropped rather than blocking the client. Remember to
+// call Unsubscribe with the returned id when you are done.
+func (c *INDIClient) Subscribe(opts SubscribeOptions) (events <-chan Event, id string, err error) {
+	if len(opts.Property) > 0 && len(opts.Device) == 0 {
+		err = ErrPropertyWithoutDevice
+		return
+	}
+
+	opts.Device = c.resolveDevice(opts.Device)
+
+	sub := &subscription{
+		opts:    opts,
+		ch:      make(chan Event, c.bufferSize),
+		limiter: map[string]*propertyLimiter{},
+	}
+
+	if opts.MaxRate > 0 {
+		sub.interval = time.Duration(float64(time.Second) / opts.MaxRate)
+	}
+
+	id = uuid.New().String()
+	events = sub.ch
+
+	c.subscriptions.Store(id, sub)
+
+	return
+}
+
+// Unsubscribe stops delivery of events to the subscription created by Subscribe and closes its channel.
+func (c *INDIClient) Unsubscribe(id string) error {
+	s, ok := c.subscriptions.Load(id)
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+
+	c.subscriptions.Delete(id)
+
+	sub := s.(*subscription)
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	for _, l := range sub.limiter {
+		if l.timer != nil {
+			l.timer.Stop()
+		}
+	}
+
+	sub.closed = true
+	close(sub.ch)
+
+	return nil
+}
+
+// emit sends e to all matching subscriptions. It never blocks.
+func (c *INDIClient) emit(e Event) {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = c.now()
+	}
+
+	if len(e.Message) > 0 && len(e.Severity) == 0 {
+		e.Severity, _ = ClassifyMessage(e.Message)
+	}
+
+	// Repeaters speak INDI, so they always see the driver's device names.
+	c.repeaters.Range(func(key, value interface{}) bool {
+		value.(*Repeater).notify(e)
+		return true
+	})
+
+	published := e
+	published.Device = c.aliasDevice(e.Device)
+
+	c.subscriptions.Range(func(key, value interface{}) bool {
+		sub := value.(*subscription)
+		if sub.matches(e) {
+			sub.publish(published, c)
+		}
+		return true
+	})
+}
+
+func (s *subscription) matches(e Event) bool {
+	if len(s.opts.Device) > 0 && s.opts.Device != e.Device {
+		return false
+	}
+
+	if len(s.opts.Types) > 0 {
+		found := false
+		for _, t := range s.opts.Types {
+			if t == e.Type {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	// Deleting an entire device also deletes the property we are watching.
+	if len(s.opts.Property) > 0 && s.opts.Property != e.Property && !(e.Type == EventTypeDelete && len(e.Property) == 0) {
+		return false
+	}
+
+	return true
+}
+
+func (s *subscription) publish(e Event, c *INDIClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	// Definitions, deletions and messages are never coalesced, since each one carries information an update does not.
+	if e.Type != EventTypeUpdate || (s.interval == 0 && s.opts.Debounce == 0) {
+		s.send(e, c)
+		return
+	}
+
+	key := e.Device + "_" + e.Property
+
+	l, ok := s.limiter[key]
+	if !ok {
+		l = &propertyLimiter{}
+		s.limiter[key] = l
+	}
+
+	l.pending = &e
+
+	var wait time.Duration
+
+	if s.opts.Debounce > 0 {
+		wait = s.opts.Debounce
+		if l.timer != nil {
+			l.timer.Stop()
+			l.timer = nil
+		}
+	} else {
+		if l.timer != nil {
+			// A delivery is already scheduled, and it will pick up the latest pending event.
+			return
+		}
+
+		wait = s.interval - c.now().Sub(l.lastSent)
+		if wait <= 0 {
+			s.flush(l, c)
+			return
+		}
+	}
+
+	l.generation++
+	generation := l.generation
+
+	l.timer = c.Clock().AfterFunc(wait, func() { s.expire(l, generation, c) })
+}
+
+// expire delivers the pending event for l when the timer of generation fires, unless it has been replaced since: Stop
+// does not stop a callback that is already waiting for s.mu, and it must not deliver the newer event before its own
+// timer fires.
+func (s *subscription) expire(l *propertyLimiter, generation uint64, c *INDIClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || l.generation != generation {
+		return
+	}
+
+	l.timer = nil
+	s.flush(l, c)
+}
+
+// flush delivers the pending event for l. Only call when s.mu is locked.
+func (s *subscription) flush(l *propertyLimiter, c *INDIClient) {
+	if l.pending == nil {
+		return
+	}
+
+	s.send(*l.pending, c)
+
+	l.pending = nil
+	l.lastSent = c.now()
+}
+
+// send delivers e without blocking. Only call when s.mu is locked.
+func (s *subscription) send(e Event, c *INDIClient) {
+	select {
+	case s.ch <- e:
+	default:
+		c.log.WithField("device", e.Device).WithField("property", e.Property).Warn("subscription buffer full, dropping event")
+	}
+}
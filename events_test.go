@@ -0,0 +1,173 @@
+package indiclient
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient() *INDIClient {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelInfo)
+	return NewINDIClient(log, nil, afero.NewMemMapFs(), 100)
+}
+
+func defineCoords(c *INDIClient) {
+	c.defNumberVector(&DefNumberVector{
+		Device: "Mount",
+		Name:   "EQUATORIAL_EOD_COORD",
+		State:  PropertyStateIdle,
+		Perm:   PropertyPermissionReadWrite,
+		Numbers: []DefNumber{
+			{Name: "RA", Value: "0"},
+			{Name: "DEC", Value: "0"},
+		},
+	})
+}
+
+func setCoords(c *INDIClient, ra string) {
+	c.setNumberVector(&SetNumberVector{
+		Device:  "Mount",
+		Name:    "EQUATORIAL_EOD_COORD",
+		State:   PropertyStateBusy,
+		Numbers: []OneNumber{{Name: "RA", Value: ra}},
+	})
+}
+
+func drain(ch <-chan Event, wait time.Duration) []Event {
+	events := []Event{}
+	timeout := time.After(wait)
+
+	for {
+		select {
+		case e := <-ch:
+			events = append(events, e)
+		case <-timeout:
+			return events
+		}
+	}
+}
+
+func Test_Subscribe_PropertyWithoutDevice(t *testing.T) {
+	c := newTestClient()
+
+	_, _, err := c.Subscribe(SubscribeOptions{Property: "prop1"})
+	assert.Equal(t, ErrPropertyWithoutDevice, err)
+}
+
+func Test_Subscribe_Filter(t *testing.T) {
+	c := newTestClient()
+
+	ch, id, err := c.Subscribe(SubscribeOptions{Device: "Mount", Property: "EQUATORIAL_EOD_COORD"})
+	require.NoError(t, err)
+
+	defineCoords(c)
+	c.defTextVector(&DefTextVector{Device: "Mount", Name: "DEVICE_PORT"})
+	c.defTextVector(&DefTextVector{Device: "Camera", Name: "DEVICE_PORT"})
+	setCoords(c, "1")
+
+	events := drain(ch, 50*time.Millisecond)
+	require.Len(t, events, 2)
+	assert.Equal(t, EventTypeDefine, events[0].Type)
+	assert.Equal(t, EventTypeUpdate, events[1].Type)
+	assert.Equal(t, PropertyStateBusy, events[1].State)
+
+	require.NoError(t, c.Unsubscribe(id))
+	assert.Equal(t, ErrSubscriptionNotFound, c.Unsubscribe(id))
+}
+
+func Test_Subscribe_MaxRate(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+
+	ch, id, err := c.Subscribe(SubscribeOptions{MaxRate: 5})
+	require.NoError(t, err)
+
+	for i := 1; i <= 20; i++ {
+		setCoords(c, "1")
+	}
+	setCoords(c, "2")
+
+	events := drain(ch, 350*time.Millisecond)
+	assert.Len(t, events, 2)
+
+	// Internal state is never throttled.
+	val, err := c.GetNumber("Mount", "EQUATORIAL_EOD_COORD", "RA")
+	require.NoError(t, err)
+	assert.Equal(t, "2", val.Value)
+
+	require.NoError(t, c.Unsubscribe(id))
+}
+
+func Test_Subscribe_Debounce(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+
+	ch, id, err := c.Subscribe(SubscribeOptions{Debounce: 100 * time.Millisecond})
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		setCoords(c, "1")
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	assert.Empty(t, drain(ch, 10*time.Millisecond))
+	assert.Len(t, drain(ch, 200*time.Millisecond), 1)
+
+	require.NoError(t, c.Unsubscribe(id))
+}
+
+func Test_Subscribe_Debounce_StaleTimer(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+
+	ch, id, err := c.Subscribe(SubscribeOptions{Debounce: 100 * time.Millisecond})
+	require.NoError(t, err)
+	defer c.Unsubscribe(id)
+
+	value, ok := c.subscriptions.Load(id)
+	require.True(t, ok)
+	sub := value.(*subscription)
+
+	setCoords(c, "1")
+
+	sub.mu.Lock()
+	l := sub.limiter["Mount_EQUATORIAL_EOD_COORD"]
+	stale := l.generation
+	sub.mu.Unlock()
+
+	setCoords(c, "2")
+
+	// The first timer fired before the second update stopped it, and its callback only runs now.
+	sub.expire(l, stale, c)
+
+	assert.Empty(t, drain(ch, 10*time.Millisecond))
+
+	received := drain(ch, 200*time.Millisecond)
+	require.Len(t, received, 1)
+}
+
+func Test_ServerMessages(t *testing.T) {
+	c := newTestClient()
+
+	events, id, err := c.Subscribe(SubscribeOptions{Types: []EventType{EventTypeMessage}})
+	require.NoError(t, err)
+	defer c.Unsubscribe(id)
+
+	defineCoords(c)
+	c.message(&Message{Message: "Driver indi_lx200generic: Terminated after #0 restarts."})
+
+	received := drain(events, 50*time.Millisecond)
+	require.Len(t, received, 1)
+	assert.Equal(t, EventTypeMessage, received[0].Type)
+	assert.Empty(t, received[0].Device)
+	assert.Equal(t, "Driver indi_lx200generic: Terminated after #0 restarts.", received[0].Message)
+
+	messages := c.ServerMessages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Driver indi_lx200generic: Terminated after #0 restarts.", messages[0].Message)
+}
@@ -3,8 +3,12 @@ module github.com/goastro/indiclient
 go 1.13
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/google/uuid v1.1.1
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/rickbassham/logging v0.0.0-20180515233527-fa7f7e400737
 	github.com/spf13/afero v1.2.2
 	github.com/stretchr/testify v1.4.0
+	golang.org/x/crypto v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
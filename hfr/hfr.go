@@ -0,0 +1,350 @@
+// Package hfr detects stars in camera frames and measures their half-flux radius (HFR) and full width at half maximum
+// (FWHM). Both grow as a star goes out of focus, so the median HFR of a frame is the usual metric for autofocus:
+//
+//	img, err := imaging.Decode(e.Format, data, imaging.RawOptions{})
+//	...
+//	result, err := hfr.Measure(img, hfr.Options{})
+//	fmt.Println(result.HFR, len(result.Stars))
+//
+// Measurements are in pixels.
+package hfr
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/goastro/indiclient/imaging"
+)
+
+// ErrNoStars is returned by Measure when no stars were detected.
+var ErrNoStars = errors.New("no stars detected")
+
+const (
+	// DefaultThreshold is the default detection threshold, in standard deviations of the noise above the background.
+	DefaultThreshold = 5
+	// DefaultMinArea is the default number of pixels above the threshold for a detection to count as a star.
+	DefaultMinArea = 5
+	// DefaultMaxStars is the default number of stars measured, brightest first.
+	DefaultMaxStars = 100
+	// DefaultMaxRadius is the default largest radius, in pixels, a star is measured out to.
+	DefaultMaxRadius = 50
+)
+
+// fwhmPerSigma converts the standard deviation of a Gaussian profile to its FWHM.
+var fwhmPerSigma = 2 * math.Sqrt(2*math.Ln2)
+
+// Options controls star detection. Zero values are replaced by the defaults.
+type Options struct {
+	// Threshold is how many standard deviations of the noise above the background a pixel must be to be part of a star.
+	Threshold float64
+	// MinArea is the number of pixels above the threshold a star must have. Smaller detections are hot pixels or noise.
+	MinArea int
+	// MaxStars is the number of stars measured, brightest first.
+	MaxStars int
+	// MaxRadius is the largest radius, in pixels, a star is measured out to. Stars that would need a larger radius, or
+	// are closer than their radius to the edge of the frame, are skipped.
+	MaxRadius int
+}
+
+func (o Options) withDefaults() Options {
+	if o.Threshold <= 0 {
+		o.Threshold = DefaultThreshold
+	}
+	if o.MinArea <= 0 {
+		o.MinArea = DefaultMinArea
+	}
+	if o.MaxStars <= 0 {
+		o.MaxStars = DefaultMaxStars
+	}
+	if o.MaxRadius <= 0 {
+		o.MaxRadius = DefaultMaxRadius
+	}
+	return o
+}
+
+// Star is a star detected in a frame.
+type Star struct {
+	// X and Y are the flux weighted centroid of the star.
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	// Flux is the total value of the star above the background.
+	Flux float64 `json:"flux"`
+	// Peak is the highest value of the star above the background.
+	Peak float64 `json:"peak"`
+	// HFR is the flux weighted mean distance of the star's pixels from its centroid.
+	HFR float64 `json:"hfr"`
+	// FWHM is the full width at half maximum of a Gaussian with the same second moment as the star.
+	FWHM float64 `json:"fwhm"`
+}
+
+// Result is the measurement of a whole frame.
+type Result struct {
+	// Stars are the measured stars, brightest first.
+	Stars []Star `json:"stars"`
+	// HFR and FWHM are the medians over Stars.
+	HFR  float64 `json:"hfr"`
+	FWHM float64 `json:"fwhm"`
+	// Background is the median value of the frame, and Noise the standard deviation around it.
+	Background float64 `json:"background"`
+	Noise      float64 `json:"noise"`
+}
+
+// Measure detects stars in img and measures them. Returns ErrNoStars if no star was found, along with the background
+// and noise of the frame.
+func Measure(img image.Image, opts Options) (Result, error) {
+	f := newFrame(img)
+
+	result := Result{Stars: []Star{}}
+	result.Background, result.Noise = f.background()
+
+	result.Stars = f.detect(result.Background, result.Noise, opts.withDefaults())
+	if len(result.Stars) == 0 {
+		return result, ErrNoStars
+	}
+
+	hfrs := make([]float64, len(result.Stars))
+	fwhms := make([]float64, len(result.Stars))
+	for i, s := range result.Stars {
+		hfrs[i], fwhms[i] = s.HFR, s.FWHM
+	}
+
+	result.HFR = median(hfrs)
+	result.FWHM = median(fwhms)
+
+	return result, nil
+}
+
+// MeasureBlob decodes a BLOB with imaging.Decode and measures it. raw describes raw video frames, as for
+// imaging.Decode.
+func MeasureBlob(format string, data []byte, raw imaging.RawOptions, opts Options) (Result, error) {
+	img, err := imaging.Decode(format, data, raw)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Measure(img, opts)
+}
+
+// Detect returns the stars in img, brightest first.
+func Detect(img image.Image, opts Options) []Star {
+	f := newFrame(img)
+	bg, noise := f.background()
+	return f.detect(bg, noise, opts.withDefaults())
+}
+
+// frame holds the luminance of each pixel of an image.
+type frame struct {
+	width, height int
+	pix           []float64
+}
+
+func newFrame(img image.Image) *frame {
+	b := img.Bounds()
+	f := &frame{width: b.Dx(), height: b.Dy(), pix: make([]float64, b.Dx()*b.Dy())}
+
+	switch g := img.(type) {
+	case *image.Gray:
+		for y := 0; y < f.height; y++ {
+			for x := 0; x < f.width; x++ {
+				f.pix[y*f.width+x] = float64(g.GrayAt(b.Min.X+x, b.Min.Y+y).Y)
+			}
+		}
+	case *image.Gray16:
+		for y := 0; y < f.height; y++ {
+			for x := 0; x < f.width; x++ {
+				f.pix[y*f.width+x] = float64(g.Gray16At(b.Min.X+x, b.Min.Y+y).Y)
+			}
+		}
+	default:
+		for y := 0; y < f.height; y++ {
+			for x := 0; x < f.width; x++ {
+				f.pix[y*f.width+x] = float64(color.Gray16Model.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray16).Y)
+			}
+		}
+	}
+
+	return f
+}
+
+// maxBackgroundSamples limits how many pixels are sorted to estimate the background of large frames.
+const maxBackgroundSamples = 100000
+
+// background estimates the background level as the median of the frame, and the noise from the median absolute
+// deviation, which are both robust to the stars themselves.
+func (f *frame) background() (bg, noise float64) {
+	if len(f.pix) == 0 {
+		return 0, 0
+	}
+
+	step := len(f.pix)/maxBackgroundSamples + 1
+
+	samples := make([]float64, 0, len(f.pix)/step+1)
+	for i := 0; i < len(f.pix); i += step {
+		samples = append(samples, f.pix[i])
+	}
+
+	bg = median(samples)
+
+	for i, v := range samples {
+		samples[i] = math.Abs(v - bg)
+	}
+
+	// 1.4826 scales the MAD of normally distributed noise to its standard deviation.
+	noise = 1.4826 * median(samples)
+
+	return bg, noise
+}
+
+// detect finds groups of connected pixels above the threshold and measures each as a star.
+func (f *frame) detect(bg, noise float64, opts Options) []Star {
+	// With no noise at all, e.g. in synthetic frames, anything above the background is a star.
+	threshold := bg + math.Max(opts.Threshold*noise, 1)
+
+	visited := make([]bool, len(f.pix))
+	stars := []Star{}
+	stack := []int{}
+
+	for start, v := range f.pix {
+		if visited[start] || v < threshold {
+			continue
+		}
+
+		// Flood fill the pixels of this detection.
+		visited[start] = true
+		stack = append(stack[:0], start)
+
+		area := 0
+		minX, maxX, minY, maxY := f.width, 0, f.height, 0
+
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			area++
+
+			x, y := i%f.width, i/f.width
+			minX, maxX = minInt(minX, x), maxInt(maxX, x)
+			minY, maxY = minInt(minY, y), maxInt(maxY, y)
+
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					xx, yy := x+dx, y+dy
+					if xx < 0 || yy < 0 || xx >= f.width || yy >= f.height {
+						continue
+					}
+
+					j := yy*f.width + xx
+					if !visited[j] && f.pix[j] >= threshold {
+						visited[j] = true
+						stack = append(stack, j)
+					}
+				}
+			}
+		}
+
+		if area < opts.MinArea {
+			continue
+		}
+
+		// Measure out to the full width of the detection, about twice its radius, which takes in the wings of the
+		// profile below the threshold.
+		radius := float64(maxInt(maxX-minX, maxY-minY)+1) + 2
+		if radius > float64(opts.MaxRadius) {
+			continue
+		}
+
+		if s, ok := f.measure(float64(minX+maxX)/2, float64(minY+maxY)/2, radius, bg); ok {
+			stars = append(stars, s)
+		}
+	}
+
+	sort.Slice(stars, func(i, j int) bool { return stars[i].Flux > stars[j].Flux })
+
+	if len(stars) > opts.MaxStars {
+		stars = stars[:opts.MaxStars]
+	}
+
+	return stars
+}
+
+// measure computes the centroid, HFR and FWHM of a star within radius of cx, cy. The centroid is refined once, so the
+// measurement is centered on the star rather than on its detection. Returns false if the star is too close to the
+// edge of the frame.
+func (f *frame) measure(cx, cy, radius, bg float64) (Star, bool) {
+	var s Star
+
+	for pass := 0; pass < 2; pass++ {
+		if cx-radius < 0 || cy-radius < 0 || cx+radius >= float64(f.width) || cy+radius >= float64(f.height) {
+			return s, false
+		}
+
+		var sum, sumX, sumY, sumR, sumR2, peak float64
+
+		for y := int(cy - radius); y <= int(cy+radius); y++ {
+			for x := int(cx - radius); x <= int(cx+radius); x++ {
+				dx, dy := float64(x)-cx, float64(y)-cy
+				r2 := dx*dx + dy*dy
+				if r2 > radius*radius {
+					continue
+				}
+
+				w := f.pix[y*f.width+x] - bg
+				if w <= 0 {
+					continue
+				}
+
+				sum += w
+				sumX += w * float64(x)
+				sumY += w * float64(y)
+				sumR += w * math.Sqrt(r2)
+				sumR2 += w * r2
+				peak = math.Max(peak, w)
+			}
+		}
+
+		if sum <= 0 {
+			return s, false
+		}
+
+		s = Star{X: sumX / sum, Y: sumY / sum, Flux: sum, Peak: peak, HFR: sumR / sum}
+
+		// For a Gaussian, the mean squared distance from the center is twice the variance.
+		s.FWHM = fwhmPerSigma * math.Sqrt(sumR2/sum/2)
+
+		cx, cy = s.X, s.Y
+	}
+
+	return s, true
+}
+
+// median returns the median of values, which it sorts.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sort.Float64s(values)
+
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,94 @@
+package hfr_test
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/hfr"
+	"github.com/goastro/indiclient/imaging"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func frame(width, height int, stars []simulators.Star, sigma float64, rnd *rand.Rand) *image.Gray16 {
+	pixels := simulators.SyntheticFrame(width, height, stars, sigma, rnd)
+
+	img := image.NewGray16(image.Rect(0, 0, width, height))
+	for i, p := range pixels {
+		img.Pix[2*i] = uint8(p >> 8)
+		img.Pix[2*i+1] = uint8(p)
+	}
+
+	return img
+}
+
+func Test_Measure_SingleStar(t *testing.T) {
+	sigma := 2.0
+	img := frame(64, 64, []simulators.Star{{X: 30.3, Y: 33.6, Flux: 20000}}, sigma, nil)
+
+	result, err := hfr.Measure(img, hfr.Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Stars, 1)
+
+	s := result.Stars[0]
+	assert.InDelta(t, 30.3, s.X, 0.05)
+	assert.InDelta(t, 33.6, s.Y, 0.05)
+
+	// For a Gaussian, the flux weighted mean radius is sigma * sqrt(pi / 2).
+	assert.InDelta(t, sigma*math.Sqrt(math.Pi/2), s.HFR, 0.1)
+	assert.InDelta(t, sigma*2.3548, s.FWHM, 0.2)
+	assert.Equal(t, s.HFR, result.HFR)
+	assert.Equal(t, 1000.0, result.Background)
+}
+
+func Test_Measure_Focus(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	stars := simulators.RandomStars(rnd, 20, 320, 240)
+
+	last := 0.0
+	for _, sigma := range []float64{1, 1.5, 2.5, 4} {
+		result, err := hfr.Measure(frame(320, 240, stars, sigma, rnd), hfr.Options{})
+		require.NoError(t, err, sigma)
+
+		// Defocused stars near the edges need a window that does not fit, so fewer are measured.
+		assert.True(t, len(result.Stars) >= 5, "sigma %g found %d stars", sigma, len(result.Stars))
+		assert.InDelta(t, 10, result.Noise, 2, sigma)
+		assert.True(t, result.HFR > last, "sigma %g hfr %g", sigma, result.HFR)
+		last = result.HFR
+	}
+}
+
+func Test_Measure_NoStars(t *testing.T) {
+	result, err := hfr.Measure(frame(64, 64, nil, 1, rand.New(rand.NewSource(1))), hfr.Options{})
+	assert.Equal(t, hfr.ErrNoStars, err)
+	assert.InDelta(t, 1000, result.Background, 2)
+}
+
+func Test_Detect_Options(t *testing.T) {
+	stars := []simulators.Star{{X: 20, Y: 20, Flux: 30000}, {X: 44, Y: 44, Flux: 5000}, {X: 2, Y: 2, Flux: 30000}}
+	img := frame(64, 64, stars, 1.5, nil)
+
+	// The star in the corner is too close to the edge to measure.
+	detected := hfr.Detect(img, hfr.Options{})
+	require.Len(t, detected, 2)
+	assert.InDelta(t, 20, detected[0].X, 0.1)
+
+	detected = hfr.Detect(img, hfr.Options{MaxStars: 1})
+	require.Len(t, detected, 1)
+	assert.InDelta(t, 20, detected[0].X, 0.1)
+}
+
+func Test_MeasureBlob(t *testing.T) {
+	pixels := simulators.SyntheticFrame(64, 64, []simulators.Star{{X: 32, Y: 32, Flux: 20000}}, 2, nil)
+
+	result, err := hfr.MeasureBlob(".fits", simulators.EncodeFITS(64, 64, pixels), imaging.RawOptions{}, hfr.Options{})
+	require.NoError(t, err)
+	assert.Len(t, result.Stars, 1)
+
+	_, err = hfr.MeasureBlob(".ser", nil, imaging.RawOptions{}, hfr.Options{})
+	assert.Equal(t, imaging.ErrUnsupportedFormat, err)
+}
@@ -0,0 +1,99 @@
+package history
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// Series selects a number element to export. An empty Element selects every element of the property.
+type Series struct {
+	Device   string `json:"device"`
+	Property string `json:"property"`
+	Element  string `json:"element"`
+}
+
+// Sample is a single recorded value of a number element.
+type Sample struct {
+	Time     time.Time `json:"time"`
+	Device   string    `json:"device"`
+	Property string    `json:"property"`
+	Element  string    `json:"element"`
+	Value    float64   `json:"value"`
+}
+
+// Samples returns the values recorded in s between from and to for each of series, oldest first. Values that are not
+// numbers, such as those of text elements, are skipped. A zero from or to leaves that end of the range open.
+func Samples(s Store, from, to time.Time, series ...Series) ([]Sample, error) {
+	samples := []Sample{}
+
+	for _, sel := range series {
+		records, err := s.Query(Query{Kind: KindNumber, Device: sel.Device, Property: sel.Property, Element: sel.Element, From: from, To: to})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range records {
+			n, err := indiclient.ParseNumber(r.Value)
+			if err != nil {
+				continue
+			}
+
+			samples = append(samples, Sample{Time: r.Time, Device: r.Device, Property: r.Property, Element: r.Element, Value: n})
+		}
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+
+	return samples, nil
+}
+
+// ExportCSV writes the values recorded in s between from and to for each of series to w as CSV, with a header row of
+// time, device, property, element and value, one row per value. Times are RFC 3339 in UTC, with nanoseconds, which
+// pandas.read_csv(..., parse_dates=["time"]) and Excel both understand; use DataFrame.pivot to get one column per
+// element.
+func ExportCSV(w io.Writer, s Store, from, to time.Time, series ...Series) error {
+	samples, err := Samples(s, from, to, series...)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"time", "device", "property", "element", "value"}); err != nil {
+		return err
+	}
+
+	for _, sample := range samples {
+		err := cw.Write([]string{
+			sample.Time.UTC().Format(time.RFC3339Nano),
+			sample.Device,
+			sample.Property,
+			sample.Element,
+			strconv.FormatFloat(sample.Value, 'g', -1, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// ExportParquet writes the values recorded in s between from and to for each of series to w as a Parquet file, with
+// the same columns as ExportCSV. time is a timestamp in microseconds, UTC, and value a double. The file is written
+// uncompressed, in a single row group.
+func ExportParquet(w io.Writer, s Store, from, to time.Time, series ...Series) error {
+	samples, err := Samples(s, from, to, series...)
+	if err != nil {
+		return err
+	}
+
+	return writeParquet(w, samples)
+}
@@ -0,0 +1,157 @@
+// Package history records the property changes and messages of a session, so they can be queried afterwards:
+//
+//	db, err := sql.Open("sqlite3", "session.db")
+//	...
+//	store, err := history.NewSQLStore(db)
+//	...
+//	r, err := history.NewRecorder(log, c, store)
+//	...
+//	defer r.Close()
+//
+//	// What was the CCD temperature at 02:13?
+//	rec, err := history.ValueAt(store, "CCD Simulator", "CCD_TEMPERATURE", "CCD_TEMPERATURE_VALUE", at)
+//
+// NewReport summarises a night, and ExportCSV and ExportParquet dump number elements for analysis elsewhere.
+//
+// SQLStore works with any database/sql driver for SQLite, which the application imports; the package does not pull
+// one in itself. MemoryStore keeps records in memory, for short sessions and tests.
+package history
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// ErrNoValue is returned by ValueAt when nothing was recorded for the element before the requested time.
+var ErrNoValue = errors.New("no value recorded")
+
+// Kind is the kind of a Record.
+type Kind string
+
+// The kinds of records, one for each kind of property and one for messages.
+const (
+	KindText    = Kind("text")
+	KindNumber  = Kind("number")
+	KindSwitch  = Kind("switch")
+	KindLight   = Kind("light")
+	KindMessage = Kind("message")
+)
+
+// Record is a single value of a property element at a point in time, or a message. Messages have an empty Element,
+// and an empty Property if they were sent for the whole device.
+type Record struct {
+	Time     time.Time                `json:"time"`
+	Kind     Kind                     `json:"kind"`
+	Device   string                   `json:"device"`
+	Property string                   `json:"property"`
+	Element  string                   `json:"element"`
+	Value    string                   `json:"value"`
+	State    indiclient.PropertyState `json:"state"`
+}
+
+// Query selects records. Empty fields match anything.
+type Query struct {
+	Kind     Kind
+	Device   string
+	Property string
+	Element  string
+	// From and To, if set, limit the records to those at or after From and at or before To.
+	From time.Time
+	To   time.Time
+	// Descending returns the newest records first, rather than the oldest.
+	Descending bool
+	// Limit, if set, is the most records returned.
+	Limit int
+}
+
+func (q Query) matches(r Record) bool {
+	return (len(q.Kind) == 0 || q.Kind == r.Kind) &&
+		(len(q.Device) == 0 || q.Device == r.Device) &&
+		(len(q.Property) == 0 || q.Property == r.Property) &&
+		(len(q.Element) == 0 || q.Element == r.Element) &&
+		(q.From.IsZero() || !r.Time.Before(q.From)) &&
+		(q.To.IsZero() || !r.Time.After(q.To))
+}
+
+// Store keeps records.
+type Store interface {
+	// Append adds records to the store.
+	Append(records ...Record) error
+	// Query returns the records selected by q, ordered by time.
+	Query(q Query) ([]Record, error)
+}
+
+// ValueAt returns the value element of property on device had at t, which is the last one recorded at or before t.
+func ValueAt(s Store, device, property, element string, t time.Time) (Record, error) {
+	records, err := s.Query(Query{Device: device, Property: property, Element: element, To: t, Descending: true, Limit: 1})
+	if err != nil {
+		return Record{}, err
+	}
+
+	if len(records) == 0 || records[0].Kind == KindMessage {
+		return Record{}, ErrNoValue
+	}
+
+	return records[0], nil
+}
+
+// MemoryStore is a Store that keeps records in memory. It is safe for concurrent use.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records []Record
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Append adds records to the store.
+func (s *MemoryStore) Append(records ...Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.records)
+	s.records = append(s.records, records...)
+
+	// Records almost always arrive in order, so only sort when they do not.
+	for i := n; i > 0 && i < len(s.records); i++ {
+		if s.records[i].Time.Before(s.records[i-1].Time) {
+			sort.SliceStable(s.records, func(i, j int) bool { return s.records[i].Time.Before(s.records[j].Time) })
+			break
+		}
+	}
+
+	return nil
+}
+
+// Query returns the records selected by q, ordered by time.
+func (s *MemoryStore) Query(q Query) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := []Record{}
+
+	for i := range s.records {
+		r := s.records[i]
+		if q.Descending {
+			r = s.records[len(s.records)-1-i]
+		}
+
+		if !q.matches(r) {
+			continue
+		}
+
+		out = append(out, r)
+
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+	}
+
+	return out, nil
+}
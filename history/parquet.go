@@ -0,0 +1,282 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// This is just enough of Parquet to write a flat table of required columns: one row group, with one uncompressed,
+// PLAIN encoded data page per column. Since every column is required, pages have no repetition or definition levels.
+// The page headers and file metadata are Thrift structs, in its compact protocol. Test_ExportParquet compares the output
+// with testdata/export.parquet, which has been checked with a real Parquet reader.
+
+const parquetMagic = "PAR1"
+
+// Parquet physical types.
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+)
+
+// Parquet converted types. parquetNone marks a column without one.
+const (
+	parquetNone            = -1
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+)
+
+// Parquet encodings, page types and codecs.
+const (
+	parquetPlain        = 0
+	parquetRLE          = 3
+	parquetDataPage     = 0
+	parquetUncompressed = 0
+	parquetRequired     = 0
+)
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+type parquetColumn struct {
+	name      string
+	typ       int
+	converted int
+	data      bytes.Buffer
+	offset    int64
+	size      int64
+}
+
+// writeParquet writes samples to w as a Parquet file with the columns time, device, property, element and value.
+func writeParquet(w io.Writer, samples []Sample) error {
+	columns := []*parquetColumn{
+		{name: "time", typ: parquetInt64, converted: parquetTimestampMicros},
+		{name: "device", typ: parquetByteArray, converted: parquetUTF8},
+		{name: "property", typ: parquetByteArray, converted: parquetUTF8},
+		{name: "element", typ: parquetByteArray, converted: parquetUTF8},
+		{name: "value", typ: parquetDouble, converted: parquetNone},
+	}
+
+	var b [8]byte
+
+	for _, s := range samples {
+		binary.LittleEndian.PutUint64(b[:], uint64(s.Time.UnixNano()/1000))
+		columns[0].data.Write(b[:])
+
+		for i, v := range []string{s.Device, s.Property, s.Element} {
+			binary.LittleEndian.PutUint32(b[:4], uint32(len(v)))
+			columns[i+1].data.Write(b[:4])
+			columns[i+1].data.WriteString(v)
+		}
+
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(s.Value))
+		columns[4].data.Write(b[:])
+	}
+
+	file := &bytes.Buffer{}
+	file.WriteString(parquetMagic)
+
+	var total int64
+
+	for _, col := range columns {
+		col.offset = int64(file.Len())
+
+		// PageHeader
+		page := newThriftWriter()
+		page.field(1, thriftI32)
+		page.int(parquetDataPage)
+		page.field(2, thriftI32)
+		page.int(int64(col.data.Len()))
+		page.field(3, thriftI32)
+		page.int(int64(col.data.Len()))
+		// DataPageHeader
+		page.field(5, thriftStruct)
+		page.field(1, thriftI32)
+		page.int(int64(len(samples)))
+		page.field(2, thriftI32)
+		page.int(parquetPlain)
+		page.field(3, thriftI32)
+		page.int(parquetRLE)
+		page.field(4, thriftI32)
+		page.int(parquetRLE)
+		page.stop()
+		page.stop()
+
+		file.Write(page.Bytes())
+		file.Write(col.data.Bytes())
+
+		col.size = int64(file.Len()) - col.offset
+		total += col.size
+	}
+
+	// FileMetaData
+	meta := newThriftWriter()
+	meta.field(1, thriftI32)
+	meta.int(1)
+
+	meta.field(2, thriftList)
+	meta.list(len(columns)+1, thriftStruct)
+
+	// SchemaElement for the root
+	meta.begin()
+	meta.field(4, thriftBinary)
+	meta.binary("schema")
+	meta.field(5, thriftI32)
+	meta.int(int64(len(columns)))
+	meta.stop()
+
+	for _, col := range columns {
+		// SchemaElement
+		meta.begin()
+		meta.field(1, thriftI32)
+		meta.int(int64(col.typ))
+		meta.field(3, thriftI32)
+		meta.int(parquetRequired)
+		meta.field(4, thriftBinary)
+		meta.binary(col.name)
+		if col.converted != parquetNone {
+			meta.field(6, thriftI32)
+			meta.int(int64(col.converted))
+		}
+		meta.stop()
+	}
+
+	meta.field(3, thriftI64)
+	meta.int(int64(len(samples)))
+
+	meta.field(4, thriftList)
+	meta.list(1, thriftStruct)
+
+	// RowGroup
+	meta.begin()
+	meta.field(1, thriftList)
+	meta.list(len(columns), thriftStruct)
+
+	for _, col := range columns {
+		// ColumnChunk
+		meta.begin()
+		meta.field(2, thriftI64)
+		meta.int(col.offset)
+		// ColumnMetaData
+		meta.field(3, thriftStruct)
+		meta.field(1, thriftI32)
+		meta.int(int64(col.typ))
+		meta.field(2, thriftList)
+		meta.list(2, thriftI32)
+		meta.int(parquetPlain)
+		meta.int(parquetRLE)
+		meta.field(3, thriftList)
+		meta.list(1, thriftBinary)
+		meta.binary(col.name)
+		meta.field(4, thriftI32)
+		meta.int(parquetUncompressed)
+		meta.field(5, thriftI64)
+		meta.int(int64(len(samples)))
+		meta.field(6, thriftI64)
+		meta.int(col.size)
+		meta.field(7, thriftI64)
+		meta.int(col.size)
+		meta.field(9, thriftI64)
+		meta.int(col.offset)
+		meta.stop()
+		meta.stop()
+	}
+
+	meta.field(2, thriftI64)
+	meta.int(total)
+	meta.field(3, thriftI64)
+	meta.int(int64(len(samples)))
+	meta.stop()
+
+	meta.field(6, thriftBinary)
+	meta.binary("github.com/goastro/indiclient/history")
+	meta.stop()
+
+	file.Write(meta.Bytes())
+
+	binary.LittleEndian.PutUint32(b[:4], uint32(meta.Len()))
+	file.Write(b[:4])
+	file.WriteString(parquetMagic)
+
+	_, err := w.Write(file.Bytes())
+
+	return err
+}
+
+// thriftWriter writes Thrift structs in the compact protocol, which encodes each field id as the difference from the
+// previous one in the same struct.
+type thriftWriter struct {
+	bytes.Buffer
+	// ids holds the id of the last field written in each open struct, innermost last.
+	ids []int
+}
+
+// newThriftWriter creates a thriftWriter with the outermost struct open.
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{ids: []int{0}}
+}
+
+// field writes the header of field id, of type typ. A struct field is left open, to be ended with stop.
+func (t *thriftWriter) field(id, typ int) {
+	last := t.ids[len(t.ids)-1]
+
+	if delta := id - last; delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta<<4 | typ))
+	} else {
+		t.WriteByte(byte(typ))
+		t.int(int64(id))
+	}
+
+	t.ids[len(t.ids)-1] = id
+
+	if typ == thriftStruct {
+		t.begin()
+	}
+}
+
+// begin opens a struct that is an element of a list, rather than a field.
+func (t *thriftWriter) begin() {
+	t.ids = append(t.ids, 0)
+}
+
+// stop ends the innermost open struct.
+func (t *thriftWriter) stop() {
+	t.WriteByte(0)
+	t.ids = t.ids[:len(t.ids)-1]
+}
+
+// list writes the header of a list of n elements of type typ.
+func (t *thriftWriter) list(n, typ int) {
+	if n < 15 {
+		t.WriteByte(byte(n<<4 | typ))
+		return
+	}
+
+	t.WriteByte(byte(0xf0 | typ))
+	t.uvarint(uint64(n))
+}
+
+// int writes an i16, i32 or i64, which are all zigzag varints.
+func (t *thriftWriter) int(v int64) {
+	t.uvarint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftWriter) binary(s string) {
+	t.uvarint(uint64(len(s)))
+	t.WriteString(s)
+}
+
+func (t *thriftWriter) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(b[:], v)
+	t.Write(b[:n])
+}
@@ -0,0 +1,179 @@
+package history
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/rickbassham/logging"
+
+	"github.com/goastro/indiclient"
+)
+
+// Recorder records the property changes and messages of every device of a client into a Store. Only elements whose
+// value or property state changed are recorded, so a property that is sent again with the same values takes no space.
+// BLOBs are not recorded.
+type Recorder struct {
+	log   logging.Logger
+	c     *indiclient.INDIClient
+	store Store
+	id    string
+	done  chan struct{}
+
+	mu   sync.Mutex
+	last map[string]Record
+}
+
+// NewRecorder creates a Recorder that records into store until Close is called. Errors from the store are logged and
+// do not stop recording.
+func NewRecorder(log logging.Logger, c *indiclient.INDIClient, store Store) (*Recorder, error) {
+	events, id, err := c.Subscribe(indiclient.SubscribeOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		log:   log,
+		c:     c,
+		store: store,
+		id:    id,
+		done:  make(chan struct{}),
+		last:  map[string]Record{},
+	}
+
+	go r.run(events)
+
+	return r, nil
+}
+
+// Close stops recording, after the events already received have been recorded.
+func (r *Recorder) Close() error {
+	err := r.c.Unsubscribe(r.id)
+
+	<-r.done
+
+	return err
+}
+
+func (r *Recorder) run(events <-chan indiclient.Event) {
+	defer close(r.done)
+
+	for e := range events {
+		records := []Record{}
+
+		switch e.Type {
+		case indiclient.EventTypeDefine, indiclient.EventTypeUpdate:
+			records = r.changed(e)
+		case indiclient.EventTypeDelete:
+			r.forget(e.Device, e.Property)
+		}
+
+		if len(e.Message) > 0 && (e.Type == indiclient.EventTypeMessage || e.Type == indiclient.EventTypeDefine || e.Type == indiclient.EventTypeUpdate) {
+			records = append(records, Record{
+				Time:     e.Timestamp,
+				Kind:     KindMessage,
+				Device:   e.Device,
+				Property: e.Property,
+				Value:    e.Message,
+				State:    e.State,
+			})
+		}
+
+		if len(records) == 0 {
+			continue
+		}
+
+		if err := r.store.Append(records...); err != nil {
+			r.log.WithField("device", e.Device).WithField("property", e.Property).WithError(err).Warn("error in store.Append")
+		}
+	}
+}
+
+// changed returns the records for the elements of the property e is about whose value or state changed since they
+// were last recorded.
+func (r *Recorder) changed(e indiclient.Event) []Record {
+	kind, values, ok := r.read(e.Device, e.Property)
+	if !ok {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records := []Record{}
+
+	for _, el := range values {
+		rec := Record{
+			Time:     e.Timestamp,
+			Kind:     kind,
+			Device:   e.Device,
+			Property: e.Property,
+			Element:  el[0],
+			Value:    el[1],
+			State:    e.State,
+		}
+
+		key := e.Device + "\x00" + e.Property + "\x00" + el[0]
+
+		if prev, ok := r.last[key]; ok && prev.Value == rec.Value && prev.State == rec.State {
+			continue
+		}
+
+		r.last[key] = rec
+		records = append(records, rec)
+	}
+
+	return records
+}
+
+// read returns the kind of the property and the name and value of each of its elements, in order.
+func (r *Recorder) read(device, property string) (Kind, [][2]string, bool) {
+	values := [][2]string{}
+
+	if prop, err := r.c.GetNumberProperty(device, property); err == nil {
+		for _, name := range prop.Order {
+			values = append(values, [2]string{name, prop.Values[name].Value})
+		}
+		return KindNumber, values, true
+	}
+
+	if prop, err := r.c.GetSwitchProperty(device, property); err == nil {
+		for _, name := range prop.Order {
+			values = append(values, [2]string{name, string(prop.Values[name].Value)})
+		}
+		return KindSwitch, values, true
+	}
+
+	if prop, err := r.c.GetTextProperty(device, property); err == nil {
+		for _, name := range prop.Order {
+			values = append(values, [2]string{name, prop.Values[name].Value})
+		}
+		return KindText, values, true
+	}
+
+	if prop, err := r.c.GetLightProperty(device, property); err == nil {
+		for _, name := range prop.Order {
+			values = append(values, [2]string{name, string(prop.Values[name].Value)})
+		}
+		return KindLight, values, true
+	}
+
+	return "", nil, false
+}
+
+// forget drops the last values of a deleted property, or of every property of a deleted device if property is empty,
+// so they are recorded again when redefined.
+func (r *Recorder) forget(device, property string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prefix := device + "\x00"
+	if len(property) > 0 {
+		prefix += property + "\x00"
+	}
+
+	for key := range r.last {
+		if len(device) == 0 || strings.HasPrefix(key, prefix) {
+			delete(r.last, key)
+		}
+	}
+}
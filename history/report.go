@@ -0,0 +1,174 @@
+package history
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// ElementSummary summarises the values recorded for one property element over the time of a Report.
+type ElementSummary struct {
+	Kind     Kind   `json:"kind"`
+	Device   string `json:"device"`
+	Property string `json:"property"`
+	Element  string `json:"element"`
+	// Changes is the number of values recorded.
+	Changes int    `json:"changes"`
+	First   string `json:"first"`
+	Last    string `json:"last"`
+	// Min and Max are the lowest and highest values of number elements, and nil for other kinds.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// Report is a summary of a session, such as a night of observing.
+type Report struct {
+	From     time.Time        `json:"from"`
+	To       time.Time        `json:"to"`
+	Elements []ElementSummary `json:"elements"`
+	// Messages are the messages sent by devices and indiserver, oldest first.
+	Messages []Record `json:"messages"`
+	// Alerts are the records of elements whose property went into the Alert state, oldest first.
+	Alerts []Record `json:"alerts"`
+}
+
+// NewReport summarises the records in s between from and to. Elements are sorted by device, property and element.
+func NewReport(s Store, from, to time.Time) (Report, error) {
+	records, err := s.Query(Query{From: from, To: to})
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{
+		From:     from,
+		To:       to,
+		Elements: []ElementSummary{},
+		Messages: []Record{},
+		Alerts:   []Record{},
+	}
+
+	index := map[string]int{}
+	alerting := map[string]bool{}
+
+	for _, r := range records {
+		if r.Kind == KindMessage {
+			report.Messages = append(report.Messages, r)
+			continue
+		}
+
+		prop := r.Device + "\x00" + r.Property
+		if r.State == indiclient.PropertyStateAlert && !alerting[prop] {
+			report.Alerts = append(report.Alerts, r)
+		}
+		alerting[prop] = r.State == indiclient.PropertyStateAlert
+
+		key := prop + "\x00" + r.Element
+
+		i, ok := index[key]
+		if !ok {
+			i = len(report.Elements)
+			index[key] = i
+
+			report.Elements = append(report.Elements, ElementSummary{
+				Kind:     r.Kind,
+				Device:   r.Device,
+				Property: r.Property,
+				Element:  r.Element,
+				First:    r.Value,
+			})
+		}
+
+		sum := &report.Elements[i]
+		sum.Changes++
+		sum.Last = r.Value
+
+		if r.Kind != KindNumber {
+			continue
+		}
+
+		n, err := indiclient.ParseNumber(r.Value)
+		if err != nil {
+			continue
+		}
+
+		if sum.Min == nil || n < *sum.Min {
+			min := n
+			sum.Min = &min
+		}
+
+		if sum.Max == nil || n > *sum.Max {
+			max := n
+			sum.Max = &max
+		}
+	}
+
+	sort.SliceStable(report.Elements, func(i, j int) bool {
+		a, b := report.Elements[i], report.Elements[j]
+		if a.Device != b.Device {
+			return a.Device < b.Device
+		}
+		if a.Property != b.Property {
+			return a.Property < b.Property
+		}
+		return a.Element < b.Element
+	})
+
+	return report, nil
+}
+
+// WriteText writes the report to w as plain text.
+func (r Report) WriteText(w io.Writer) error {
+	const layout = "2006-01-02 15:04:05"
+
+	if _, err := fmt.Fprintf(w, "Session %s to %s\n", r.From.Format(layout), r.To.Format(layout)); err != nil {
+		return err
+	}
+
+	if len(r.Elements) > 0 {
+		fmt.Fprintf(w, "\nProperties:\n")
+	}
+
+	for _, e := range r.Elements {
+		line := fmt.Sprintf("  %s.%s.%s: %d changes, %s -> %s", e.Device, e.Property, e.Element, e.Changes, e.First, e.Last)
+		if e.Min != nil && e.Max != nil {
+			line += fmt.Sprintf(" (min %g, max %g)", *e.Min, *e.Max)
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	if len(r.Alerts) > 0 {
+		fmt.Fprintf(w, "\nAlerts:\n")
+	}
+
+	for _, a := range r.Alerts {
+		if _, err := fmt.Fprintf(w, "  %s %s.%s\n", a.Time.Format(layout), a.Device, a.Property); err != nil {
+			return err
+		}
+	}
+
+	if len(r.Messages) > 0 {
+		fmt.Fprintf(w, "\nMessages:\n")
+	}
+
+	for _, m := range r.Messages {
+		source := m.Device
+		if len(m.Property) > 0 {
+			source += "." + m.Property
+		}
+		if len(source) == 0 {
+			source = "indiserver"
+		}
+
+		if _, err := fmt.Fprintf(w, "  %s %s: %s\n", m.Time.Format(layout), source, m.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
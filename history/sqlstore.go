@@ -0,0 +1,155 @@
+package history
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+const createSchema = `
+CREATE TABLE IF NOT EXISTS records (
+	time     INTEGER NOT NULL,
+	kind     TEXT    NOT NULL,
+	device   TEXT    NOT NULL,
+	property TEXT    NOT NULL,
+	element  TEXT    NOT NULL,
+	value    TEXT    NOT NULL,
+	state    TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS records_element ON records (device, property, element, time);
+CREATE INDEX IF NOT EXISTS records_time ON records (time);
+`
+
+// SQLStore is a Store that keeps records in a SQLite database, in a table named records. Times are stored as Unix
+// nanoseconds. It is safe for concurrent use.
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore creates a SQLStore in db, creating the records table if it does not exist yet. The caller still owns
+// db, and closes it when done.
+func NewSQLStore(db *sql.DB) (*SQLStore, error) {
+	for _, stmt := range strings.Split(createSchema, ";") {
+		if len(strings.TrimSpace(stmt)) == 0 {
+			continue
+		}
+
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+
+	return &SQLStore{db: db}, nil
+}
+
+// Append adds records to the store, in a single transaction.
+func (s *SQLStore) Append(records ...Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO records (time, kind, device, property, element, value, state) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range records {
+		_, err = stmt.Exec(r.Time.UnixNano(), string(r.Kind), r.Device, r.Property, r.Element, r.Value, string(r.State))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Query returns the records selected by q, ordered by time.
+func (s *SQLStore) Query(q Query) ([]Record, error) {
+	where := []string{}
+	args := []interface{}{}
+
+	add := func(clause string, arg interface{}) {
+		where = append(where, clause)
+		args = append(args, arg)
+	}
+
+	if len(q.Kind) > 0 {
+		add("kind = ?", string(q.Kind))
+	}
+
+	if len(q.Device) > 0 {
+		add("device = ?", q.Device)
+	}
+
+	if len(q.Property) > 0 {
+		add("property = ?", q.Property)
+	}
+
+	if len(q.Element) > 0 {
+		add("element = ?", q.Element)
+	}
+
+	if !q.From.IsZero() {
+		add("time >= ?", q.From.UnixNano())
+	}
+
+	if !q.To.IsZero() {
+		add("time <= ?", q.To.UnixNano())
+	}
+
+	query := "SELECT time, kind, device, property, element, value, state FROM records"
+
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	if q.Descending {
+		query += " ORDER BY time DESC, rowid DESC"
+	} else {
+		query += " ORDER BY time ASC, rowid ASC"
+	}
+
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Record{}
+
+	for rows.Next() {
+		var (
+			nanos       int64
+			kind, state string
+			r           Record
+		)
+
+		err = rows.Scan(&nanos, &kind, &r.Device, &r.Property, &r.Element, &r.Value, &state)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Time = time.Unix(0, nanos)
+		r.Kind = Kind(kind)
+		r.State = indiclient.PropertyState(state)
+
+		out = append(out, r)
+	}
+
+	return out, rows.Err()
+}
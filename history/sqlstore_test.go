@@ -0,0 +1,146 @@
+//go:build cgo
+// +build cgo
+
+package history_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/history"
+)
+
+// openSQLite opens a new SQLite database in a temporary directory. Call the returned function to close and remove it.
+func openSQLite(t *testing.T) (*sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "history")
+	require.NoError(t, err)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "history.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		require.NoError(t, err)
+	}
+
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func Test_SQLStore_Schema(t *testing.T) {
+	db, done := openSQLite(t)
+	defer done()
+
+	_, err := history.NewSQLStore(db)
+	require.NoError(t, err)
+
+	// Opening an existing database keeps the table and its records.
+	_, err = db.Exec("INSERT INTO records (time, kind, device, property, element, value, state) VALUES (1, 'number', 'CCD', 'CCD_TEMPERATURE', 'CCD_TEMPERATURE_VALUE', '20', 'Ok')")
+	require.NoError(t, err)
+
+	s, err := history.NewSQLStore(db)
+	require.NoError(t, err)
+
+	records, err := s.Query(history.Query{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "20", records[0].Value)
+
+	names := []string{}
+
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE tbl_name = 'records' ORDER BY name")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		names = append(names, name)
+	}
+
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"records", "records_element", "records_time"}, names)
+}
+
+func Test_SQLStore(t *testing.T) {
+	db, done := openSQLite(t)
+	defer done()
+
+	s, err := history.NewSQLStore(db)
+	require.NoError(t, err)
+
+	start := time.Date(2020, 1, 1, 2, 0, 0, 0, time.UTC)
+
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+
+	temp := func(minutes int, value string) history.Record {
+		return history.Record{Time: at(minutes), Kind: history.KindNumber, Device: "CCD", Property: "CCD_TEMPERATURE", Element: "CCD_TEMPERATURE_VALUE", Value: value, State: indiclient.PropertyStateOk}
+	}
+
+	require.NoError(t, s.Append())
+
+	// Out of order appends are sorted, and records at the same time keep the order they were appended in.
+	require.NoError(t, s.Append(temp(0, "20"), temp(20, "-10")))
+	require.NoError(t, s.Append(temp(10, "5"), temp(10, "4")))
+	require.NoError(t, s.Append(history.Record{Time: at(15), Kind: history.KindMessage, Device: "CCD", Value: "cooling"}))
+
+	records, err := s.Query(history.Query{Kind: history.KindNumber})
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, "20", records[0].Value)
+	assert.Equal(t, "5", records[1].Value)
+	assert.Equal(t, "4", records[2].Value)
+	assert.Equal(t, "-10", records[3].Value)
+
+	assert.True(t, at(0).Equal(records[0].Time))
+	assert.Equal(t, history.KindNumber, records[0].Kind)
+	assert.Equal(t, "CCD_TEMPERATURE_VALUE", records[0].Element)
+	assert.Equal(t, indiclient.PropertyStateOk, records[0].State)
+
+	// From and To are inclusive.
+	records, err = s.Query(history.Query{From: at(10), To: at(15)})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "5", records[0].Value)
+	assert.Equal(t, "4", records[1].Value)
+	assert.Equal(t, history.KindMessage, records[2].Kind)
+	assert.Equal(t, "cooling", records[2].Value)
+
+	records, err = s.Query(history.Query{From: at(11)})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "-10", records[1].Value)
+
+	records, err = s.Query(history.Query{To: at(9)})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "20", records[0].Value)
+
+	records, err = s.Query(history.Query{Kind: history.KindNumber, Descending: true, Limit: 3})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "-10", records[0].Value)
+	assert.Equal(t, "4", records[1].Value)
+	assert.Equal(t, "5", records[2].Value)
+
+	records, err = s.Query(history.Query{Device: "CCD", Property: "CCD_TEMPERATURE", Element: "CCD_TEMPERATURE_VALUE", Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "20", records[0].Value)
+
+	rec, err := history.ValueAt(s, "CCD", "CCD_TEMPERATURE", "CCD_TEMPERATURE_VALUE", at(13))
+	require.NoError(t, err)
+	assert.Equal(t, "4", rec.Value)
+
+	_, err = history.ValueAt(s, "CCD", "CCD_TEMPERATURE", "CCD_TEMPERATURE_VALUE", at(-1))
+	assert.Equal(t, history.ErrNoValue, err)
+}
@@ -0,0 +1,387 @@
+package indiclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrHookTarget is returned by AddHook when a hook does not name both a device and a property, or has a threshold
+	// without an element.
+	ErrHookTarget = errors.New("hook needs a device, a property, and an element for thresholds")
+	// ErrHookAction is returned by AddHook when a hook has neither a command nor a function, or has both.
+	ErrHookAction = errors.New("hook needs either a command or a function")
+	// ErrHookEngineClosed is returned by AddHook after Close.
+	ErrHookEngineClosed = errors.New("hook engine closed")
+)
+
+// DefaultHookConcurrency is how many hooks run at once, unless set in HookEngineOptions.
+const DefaultHookConcurrency = 1
+
+// Hook runs a shell command or a function when a property changes. With no condition set it runs on every update of
+// the property; with State, Above or Below set it runs when the condition becomes true, and not again until it has
+// been false.
+type Hook struct {
+	Device   string
+	Property string
+	// Element is the number element Above and Below are compared with.
+	Element string
+
+	// State runs the hook when the property goes into this state, e.g. when WEATHER_STATUS goes Alert.
+	State PropertyState
+	// Above runs the hook when Element rises above this value.
+	Above *float64
+	// Below runs the hook when Element falls below this value.
+	Below *float64
+
+	// Debounce delays the hook until the property has not changed for this long, and the hook only runs if its
+	// condition still holds then. Zero runs it straight away.
+	Debounce time.Duration
+
+	// Command is run with sh -c, or cmd /C on Windows. The device, property, state, element and its value are in the
+	// environment variables INDI_DEVICE, INDI_PROPERTY, INDI_STATE, INDI_ELEMENT and INDI_VALUE.
+	Command string
+	// Timeout kills Command if it runs longer than this. Zero means no limit.
+	Timeout time.Duration
+	// Func is called instead of running a command.
+	Func func(HookEvent) error
+}
+
+// HookEvent describes the change that made a hook run.
+type HookEvent struct {
+	HookID   string        `json:"hookId"`
+	Device   string        `json:"device"`
+	Property string        `json:"property"`
+	State    PropertyState `json:"state"`
+	Element  string        `json:"element"`
+	// Value is the value of Element, if the hook has one.
+	Value string    `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// HookEngineOptions controls how a HookEngine runs its hooks.
+type HookEngineOptions struct {
+	// MaxConcurrent is how many hooks may run at once. Zero means DefaultHookConcurrency. Hooks that are triggered
+	// while the limit is reached wait, and start in the order they were triggered.
+	MaxConcurrent int
+	// OnResult, if set, is called after each hook has run with its error, if any, and the combined output of its
+	// command.
+	OnResult func(e HookEvent, output []byte, err error)
+}
+
+// hookState is a hook registered with a HookEngine.
+type hookState struct {
+	hook   Hook
+	device string
+	active bool
+	timer  ClockTimer
+}
+
+// HookEngine runs hooks registered with AddHook when properties change or cross thresholds, such as a script that
+// closes the roof when WEATHER_STATUS goes Alert. Hooks run on their own goroutines, at most MaxConcurrent at a time
+// and in the order they were triggered.
+type HookEngine struct {
+	c    *INDIClient
+	opts HookEngineOptions
+	id   string
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	hooks   map[string]*hookState
+	queue   []HookEvent
+	running int
+}
+
+// NewHookEngine creates a HookEngine for c. Remember to call Close when you are done with it.
+func NewHookEngine(c *INDIClient, opts HookEngineOptions) (*HookEngine, error) {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = DefaultHookConcurrency
+	}
+
+	events, id, err := c.Subscribe(SubscribeOptions{Types: []EventType{EventTypeDefine, EventTypeUpdate}})
+	if err != nil {
+		return nil, err
+	}
+
+	e := &HookEngine{
+		c:     c,
+		opts:  opts,
+		id:    id,
+		hooks: map[string]*hookState{},
+	}
+
+	go e.run(events)
+
+	return e, nil
+}
+
+// AddHook registers h, and returns an id that can be passed to RemoveHook. A condition that already holds when the
+// hook is added does not run it.
+func (e *HookEngine) AddHook(h Hook) (string, error) {
+	if len(h.Device) == 0 || len(h.Property) == 0 || ((h.Above != nil || h.Below != nil) && len(h.Element) == 0) {
+		return "", ErrHookTarget
+	}
+
+	if (len(h.Command) == 0) == (h.Func == nil) {
+		return "", ErrHookAction
+	}
+
+	s := &hookState{
+		hook:   h,
+		device: e.c.resolveDevice(h.Device),
+	}
+	state, value := e.current(s)
+	s.active = s.check(state, value)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return "", ErrHookEngineClosed
+	}
+
+	id := uuid.New().String()
+	e.hooks[id] = s
+
+	return id, nil
+}
+
+// RemoveHook unregisters a hook added by AddHook. If it is waiting to run, it is dropped; if it is running, it
+// finishes.
+func (e *HookEngine) RemoveHook(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	s, ok := e.hooks[id]
+	if !ok {
+		return ErrSubscriptionNotFound
+	}
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+
+	delete(e.hooks, id)
+
+	return nil
+}
+
+// Close stops the engine. Hooks waiting to run are dropped, and Close waits for those already running to finish.
+func (e *HookEngine) Close() error {
+	e.mu.Lock()
+	e.closed = true
+	e.queue = nil
+	for _, s := range e.hooks {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+	}
+	e.hooks = map[string]*hookState{}
+	e.mu.Unlock()
+
+	err := e.c.Unsubscribe(e.id)
+
+	e.wg.Wait()
+
+	return err
+}
+
+func (e *HookEngine) run(events <-chan Event) {
+	for ev := range events {
+		device := e.c.resolveDevice(ev.Device)
+
+		e.mu.Lock()
+		for id, s := range e.hooks {
+			if s.device != device || s.hook.Property != ev.Property {
+				continue
+			}
+
+			if s.hook.Debounce > 0 {
+				if s.timer != nil {
+					s.timer.Stop()
+				}
+
+				id, s := id, s
+				s.timer = e.c.Clock().AfterFunc(s.hook.Debounce, func() {
+					e.mu.Lock()
+					defer e.mu.Unlock()
+
+					if e.hooks[id] == s {
+						e.trigger(id, s, "")
+					}
+				})
+				continue
+			}
+
+			e.trigger(id, s, ev.State)
+		}
+		e.mu.Unlock()
+	}
+}
+
+// trigger queues the hook id if its condition has become true. state is the state of the property sent with the
+// change, since the property may have changed again since; if it is empty the current state is used. Only call when
+// HookEngine.mu is locked.
+func (e *HookEngine) trigger(id string, s *hookState, state PropertyState) {
+	current, value := e.current(s)
+	if len(state) == 0 {
+		state = current
+	}
+
+	active := s.check(state, value)
+	wasActive := s.active
+	s.active = active
+
+	if !active || (wasActive && s.conditional()) {
+		return
+	}
+
+	e.queue = append(e.queue, HookEvent{
+		HookID:   id,
+		Device:   e.c.aliasDevice(s.device),
+		Property: s.hook.Property,
+		State:    state,
+		Element:  s.hook.Element,
+		Value:    value,
+		Time:     e.c.now(),
+	})
+
+	e.startNext()
+}
+
+// startNext starts queued hooks until MaxConcurrent are running. Only call when HookEngine.mu is locked.
+func (e *HookEngine) startNext() {
+	for !e.closed && len(e.queue) > 0 && e.running < e.opts.MaxConcurrent {
+		he := e.queue[0]
+		e.queue = e.queue[1:]
+
+		s, ok := e.hooks[he.HookID]
+		if !ok {
+			continue
+		}
+
+		e.running++
+		e.wg.Add(1)
+
+		go e.execute(s.hook, he)
+	}
+}
+
+// execute runs h, then starts the next queued hook.
+func (e *HookEngine) execute(h Hook, he HookEvent) {
+	defer e.wg.Done()
+
+	var output []byte
+	var err error
+
+	if h.Func != nil {
+		err = h.Func(he)
+	} else {
+		output, err = runHookCommand(h, he)
+	}
+
+	if err != nil {
+		e.c.log.WithField("device", he.Device).WithField("property", he.Property).WithError(err).Warn("hook failed")
+	}
+
+	if e.opts.OnResult != nil {
+		e.opts.OnResult(he, output, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.running--
+	e.startNext()
+}
+
+// runHookCommand runs the command of h in the system shell, and returns its combined output.
+func runHookCommand(h Hook, he HookEvent) ([]byte, error) {
+	ctx := context.Background()
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", h.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", h.Command)
+	}
+
+	cmd.Env = append(os.Environ(),
+		"INDI_DEVICE="+he.Device,
+		"INDI_PROPERTY="+he.Property,
+		"INDI_STATE="+string(he.State),
+		"INDI_ELEMENT="+he.Element,
+		"INDI_VALUE="+he.Value,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return output, fmt.Errorf("hook command %q: %w", h.Command, err)
+	}
+
+	return output, nil
+}
+
+// conditional returns true if the hook only runs when its condition becomes true, rather than on every update.
+func (s *hookState) conditional() bool {
+	return len(s.hook.State) > 0 || s.hook.Above != nil || s.hook.Below != nil
+}
+
+// check returns true if the condition of s holds for the property's state and the value of its element. Hooks without
+// a condition hold whenever the property is defined.
+func (s *hookState) check(state PropertyState, value string) bool {
+	if len(state) == 0 {
+		return false
+	}
+
+	if len(s.hook.State) > 0 && state != s.hook.State {
+		return false
+	}
+
+	if s.hook.Above == nil && s.hook.Below == nil {
+		return true
+	}
+
+	f, err := ParseNumber(value)
+	if err != nil {
+		return false
+	}
+
+	return (s.hook.Above != nil && f > *s.hook.Above) || (s.hook.Below != nil && f < *s.hook.Below)
+}
+
+// current returns the state of the hook's property and the value of its element.
+func (e *HookEngine) current(s *hookState) (PropertyState, string) {
+	e.c.rwm.RLock()
+	defer e.c.rwm.RUnlock()
+
+	state := e.c.propertyState(s.device, s.hook.Property)
+
+	if len(s.hook.Element) == 0 {
+		return state, ""
+	}
+
+	device := e.c.devices[s.device]
+	values, _ := device.Elements(s.hook.Property)
+	for _, v := range values {
+		if v.ElementName() == s.hook.Element {
+			return state, v.String()
+		}
+	}
+
+	return state, ""
+}
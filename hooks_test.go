@@ -0,0 +1,202 @@
+package indiclient
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+func setWindSpeed(c *INDIClient, speed string) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.setNumberVector(&SetNumberVector{
+		Device:  "Weather",
+		Name:    "WEATHER_PARAMETERS",
+		State:   PropertyStateOk,
+		Numbers: []OneNumber{{Name: "WEATHER_WIND_SPEED", Value: speed}},
+	})
+}
+
+func Test_HookEngine(t *testing.T) {
+	c := newTestClient()
+	defineWeather(c)
+
+	e, err := NewHookEngine(c, HookEngineOptions{})
+	require.NoError(t, err)
+	defer e.Close()
+
+	_, err = e.AddHook(Hook{Device: "Weather", Func: func(HookEvent) error { return nil }})
+	assert.Equal(t, ErrHookTarget, err)
+	_, err = e.AddHook(Hook{Device: "Weather", Property: "WEATHER_STATUS"})
+	assert.Equal(t, ErrHookAction, err)
+
+	var mu sync.Mutex
+	runs := []string{}
+	record := func(name string) func(HookEvent) error {
+		return func(he HookEvent) error {
+			mu.Lock()
+			defer mu.Unlock()
+			runs = append(runs, name+"="+he.Value+string(he.State))
+			return nil
+		}
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(runs)
+	}
+
+	_, err = e.AddHook(Hook{Device: "Weather", Property: "WEATHER_STATUS", State: PropertyStateAlert, Func: record("alert")})
+	require.NoError(t, err)
+
+	limit := 20.0
+	_, err = e.AddHook(Hook{Device: "Weather", Property: "WEATHER_PARAMETERS", Element: "WEATHER_WIND_SPEED", Above: &limit, Func: record("wind")})
+	require.NoError(t, err)
+
+	setWeather(c, PropertyStateAlert)
+	testutil.WaitFor(t, func() bool { return count() == 1 })
+
+	// Staying in Alert, or below the threshold, does not run the hooks again.
+	setWeather(c, PropertyStateAlert)
+	setWindSpeed(c, "15")
+	setWindSpeed(c, "25")
+	testutil.WaitFor(t, func() bool { return count() == 2 })
+	setWindSpeed(c, "30")
+
+	setWeather(c, PropertyStateOk)
+	setWeather(c, PropertyStateAlert)
+	testutil.WaitFor(t, func() bool { return count() == 3 })
+
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, []string{"alert=Alert", "wind=25Ok", "alert=Alert"}, runs)
+	mu.Unlock()
+}
+
+func Test_HookEngine_Debounce(t *testing.T) {
+	c := newTestClient()
+	defineWeather(c)
+
+	e, err := NewHookEngine(c, HookEngineOptions{})
+	require.NoError(t, err)
+	defer e.Close()
+
+	ran := make(chan HookEvent, 10)
+	_, err = e.AddHook(Hook{
+		Device:   "Weather",
+		Property: "WEATHER_STATUS",
+		State:    PropertyStateAlert,
+		Debounce: 50 * time.Millisecond,
+		Func:     func(he HookEvent) error { ran <- he; return nil },
+	})
+	require.NoError(t, err)
+
+	// A brief alert is ignored.
+	setWeather(c, PropertyStateAlert)
+	setWeather(c, PropertyStateOk)
+
+	select {
+	case <-ran:
+		t.Fatal("hook ran for a brief alert")
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	setWeather(c, PropertyStateAlert)
+
+	select {
+	case he := <-ran:
+		assert.Equal(t, "WEATHER_STATUS", he.Property)
+	case <-time.After(time.Second):
+		t.Fatal("hook did not run")
+	}
+}
+
+func Test_HookEngine_Concurrency(t *testing.T) {
+	c := newTestClient()
+	defineWeather(c)
+
+	e, err := NewHookEngine(c, HookEngineOptions{MaxConcurrent: 1})
+	require.NoError(t, err)
+	defer e.Close()
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	values := []string{}
+
+	_, err = e.AddHook(Hook{
+		Device:   "Weather",
+		Property: "WEATHER_PARAMETERS",
+		Element:  "WEATHER_WIND_SPEED",
+		Func: func(he HookEvent) error {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			values = append(values, he.Value)
+			mu.Unlock()
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	for _, speed := range []string{"1", "2", "3"} {
+		setWindSpeed(c, speed)
+		// Wait for the engine to read the value before the next update replaces it.
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	testutil.WaitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(values) == 3
+	})
+
+	assert.Equal(t, 1, maxRunning)
+	assert.Equal(t, []string{"1", "2", "3"}, values)
+}
+
+func Test_HookEngine_Command(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	c := newTestClient()
+	defineWeather(c)
+
+	results := make(chan string, 1)
+
+	e, err := NewHookEngine(c, HookEngineOptions{OnResult: func(he HookEvent, output []byte, err error) {
+		assert.NoError(t, err)
+		results <- strings.TrimSpace(string(output))
+	}})
+	require.NoError(t, err)
+	defer e.Close()
+
+	_, err = e.AddHook(Hook{Device: "Weather", Property: "WEATHER_STATUS", State: PropertyStateAlert, Command: `echo "$INDI_DEVICE $INDI_PROPERTY $INDI_STATE"`})
+	require.NoError(t, err)
+
+	setWeather(c, PropertyStateAlert)
+
+	select {
+	case out := <-results:
+		assert.Equal(t, "Weather WEATHER_STATUS Alert", out)
+	case <-time.After(5 * time.Second):
+		t.Fatal("command did not run")
+	}
+}
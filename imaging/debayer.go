@@ -0,0 +1,124 @@
+package imaging
+
+import (
+	"image"
+)
+
+// BayerPattern is the arrangement of color filters in the top left 2x2 pixels of a sensor, as reported by the
+// BAYERPAT FITS keyword.
+type BayerPattern string
+
+const (
+	BayerRGGB = BayerPattern("RGGB")
+	BayerBGGR = BayerPattern("BGGR")
+	BayerGRBG = BayerPattern("GRBG")
+	BayerGBRG = BayerPattern("GBRG")
+)
+
+// Valid returns true if p is one of the four Bayer patterns.
+func (p BayerPattern) Valid() bool {
+	switch p {
+	case BayerRGGB, BayerBGGR, BayerGRBG, BayerGBRG:
+		return true
+	}
+	return false
+}
+
+// bayerMosaic gives the color channel (0 red, 1 green, 2 blue) of each pixel in a 2x2 cell.
+type bayerMosaic [4]int
+
+func (m bayerMosaic) at(x, y int) int {
+	return m[(y&1)*2+x&1]
+}
+
+// offset returns the mosaic of p for a frame whose first pixel is xOff, yOff pixels into the pattern, as given by
+// the XBAYROFF and YBAYROFF FITS keywords.
+func (p BayerPattern) offset(xOff, yOff int) bayerMosaic {
+	var m bayerMosaic
+
+	for i := 0; i < 4; i++ {
+		x, y := (i&1+xOff)&1, (i>>1+yOff)&1
+
+		switch p[y*2+x] {
+		case 'R':
+			m[i] = 0
+		case 'G':
+			m[i] = 1
+		case 'B':
+			m[i] = 2
+		}
+	}
+
+	return m
+}
+
+// Debayer converts a monochrome *image.Gray or *image.Gray16 holding a raw Bayer frame to an *image.RGBA or
+// *image.RGBA64 using bilinear interpolation.
+func Debayer(img image.Image, pattern BayerPattern) (image.Image, error) {
+	if !pattern.Valid() {
+		return nil, ErrInvalidBayerPattern
+	}
+
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	samples := make([]uint16, width*height)
+
+	var bitDepth int
+
+	switch g := img.(type) {
+	case *image.Gray:
+		bitDepth = 8
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				samples[y*width+x] = uint16(g.GrayAt(b.Min.X+x, b.Min.Y+y).Y)
+			}
+		}
+	case *image.Gray16:
+		bitDepth = 16
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				samples[y*width+x] = g.Gray16At(b.Min.X+x, b.Min.Y+y).Y
+			}
+		}
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	return debayer(samples, width, height, bitDepth, pattern.offset(0, 0)), nil
+}
+
+// debayer interpolates the missing colors of each pixel by averaging the pixels of that color in its 3x3
+// neighborhood, which is bilinear interpolation for a Bayer mosaic.
+func debayer(samples []uint16, width, height, bitDepth int, m bayerMosaic) image.Image {
+	return newRGB(width, height, bitDepth, func(x, y int) (uint16, uint16, uint16) {
+		var sum [3]uint32
+		var count [3]uint32
+
+		for dy := -1; dy <= 1; dy++ {
+			yy := y + dy
+			if yy < 0 || yy >= height {
+				continue
+			}
+
+			for dx := -1; dx <= 1; dx++ {
+				xx := x + dx
+				if xx < 0 || xx >= width {
+					continue
+				}
+
+				c := m.at(xx, yy)
+				sum[c] += uint32(samples[yy*width+xx])
+				count[c]++
+			}
+		}
+
+		var rgb [3]uint16
+		for c := range rgb {
+			if count[c] > 0 {
+				rgb[c] = uint16(sum[c] / count[c])
+			}
+		}
+
+		return rgb[0], rgb[1], rgb[2]
+	})
+}
@@ -0,0 +1,246 @@
+package imaging
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	fitsBlockSize = 2880
+	fitsCardSize  = 80
+)
+
+// ErrNotFITS is returned when data does not start with a FITS primary header.
+var ErrNotFITS = errors.New("not a FITS file")
+
+// Header describes a decoded FITS frame.
+type Header struct {
+	Width, Height int
+	// BitDepth is 8 or 16.
+	BitDepth int
+	// Bayer is the color filter pattern of the sensor, from the BAYERPAT keyword, or empty for monochrome and RGB
+	// frames.
+	Bayer BayerPattern
+	// Keywords holds every keyword of the primary header, with string values unquoted and comments removed.
+	Keywords map[string]string
+}
+
+// DecodeFITS decodes the primary image of a FITS file. Monochrome frames decode to *image.Gray or *image.Gray16.
+// Frames with a BAYERPAT keyword are debayered, and frames with three planes are read as RGB, to *image.RGBA or
+// *image.RGBA64. BSCALE and BZERO are applied, and values outside the range of the bit depth are clipped.
+func DecodeFITS(r io.Reader) (image.Image, Header, error) {
+	h, err := ReadFITSHeader(r)
+	if err != nil {
+		return nil, h, err
+	}
+
+	bitpix, _ := strconv.Atoi(h.Keywords["BITPIX"])
+	naxis, _ := strconv.Atoi(h.Keywords["NAXIS"])
+	h.Width, _ = strconv.Atoi(h.Keywords["NAXIS1"])
+	h.Height, _ = strconv.Atoi(h.Keywords["NAXIS2"])
+
+	planes := 1
+	if naxis == 3 {
+		planes, _ = strconv.Atoi(h.Keywords["NAXIS3"])
+	}
+
+	if bitpix != 8 && bitpix != 16 {
+		return nil, h, ErrUnsupportedFormat
+	}
+
+	if (naxis != 2 && naxis != 3) || (planes != 1 && planes != 3) || h.Width <= 0 || h.Height <= 0 {
+		return nil, h, ErrInvalidDimensions
+	}
+
+	h.BitDepth = bitpix
+
+	scale, zero := 1.0, 0.0
+	if v, ok := h.Keywords["BSCALE"]; ok {
+		scale, _ = strconv.ParseFloat(v, 64)
+	}
+	if v, ok := h.Keywords["BZERO"]; ok {
+		zero, _ = strconv.ParseFloat(v, 64)
+	}
+
+	data := make([]byte, h.Width*h.Height*planes*bitpix/8)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrShortFrame
+		}
+		return nil, h, err
+	}
+
+	samples := fitsSamples(data, bitpix, scale, zero)
+
+	if planes == 3 {
+		return rgbPlanes(samples, h.Width, h.Height, bitpix), h, nil
+	}
+
+	if pattern, ok := h.Keywords["BAYERPAT"]; ok && len(pattern) > 0 {
+		h.Bayer = BayerPattern(strings.ToUpper(pattern))
+		if !h.Bayer.Valid() {
+			return nil, h, ErrInvalidBayerPattern
+		}
+
+		xOff, _ := strconv.Atoi(h.Keywords["XBAYROFF"])
+		yOff, _ := strconv.Atoi(h.Keywords["YBAYROFF"])
+
+		return debayer(samples, h.Width, h.Height, bitpix, h.Bayer.offset(xOff, yOff)), h, nil
+	}
+
+	return gray(samples, h.Width, h.Height, bitpix), h, nil
+}
+
+// ReadFITSHeader reads the primary header of a FITS file, leaving r at the start of its data. Only Keywords is set
+// in the returned Header.
+func ReadFITSHeader(r io.Reader) (Header, error) {
+	h := Header{Keywords: map[string]string{}}
+	block := make([]byte, fitsBlockSize)
+
+	for first := true; ; first = false {
+		if _, err := io.ReadFull(r, block); err != nil {
+			if first || err == io.EOF || err == io.ErrUnexpectedEOF {
+				return h, ErrNotFITS
+			}
+			return h, err
+		}
+
+		if first && !strings.HasPrefix(string(block), "SIMPLE  =") {
+			return h, ErrNotFITS
+		}
+
+		for i := 0; i < fitsBlockSize; i += fitsCardSize {
+			card := string(block[i : i+fitsCardSize])
+
+			name := strings.TrimSpace(card[:8])
+			if name == "END" {
+				return h, nil
+			}
+
+			if len(name) == 0 || card[8:10] != "= " {
+				continue
+			}
+
+			h.Keywords[name] = fitsValue(card[10:])
+		}
+	}
+}
+
+// fitsValue returns the value of a card without its comment, unquoting strings.
+func fitsValue(s string) string {
+	s = strings.TrimSpace(s)
+
+	if strings.HasPrefix(s, "'") {
+		var sb strings.Builder
+
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\'' {
+				// A doubled quote is an escaped quote.
+				if i+1 < len(s) && s[i+1] == '\'' {
+					sb.WriteByte('\'')
+					i++
+					continue
+				}
+				break
+			}
+			sb.WriteByte(s[i])
+		}
+
+		return strings.TrimRight(sb.String(), " ")
+	}
+
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[:i]
+	}
+
+	return strings.TrimSpace(s)
+}
+
+// fitsSamples converts big endian FITS data to physical values, clipped to the range of bitpix.
+func fitsSamples(data []byte, bitpix int, scale, zero float64) []uint16 {
+	if bitpix == 8 {
+		samples := make([]uint16, len(data))
+		for i, b := range data {
+			samples[i] = clip(float64(b)*scale+zero, 255)
+		}
+		return samples
+	}
+
+	samples := make([]uint16, len(data)/2)
+	for i := range samples {
+		v := int16(uint16(data[2*i])<<8 | uint16(data[2*i+1]))
+		samples[i] = clip(float64(v)*scale+zero, 65535)
+	}
+
+	return samples
+}
+
+func clip(v, max float64) uint16 {
+	if v < 0 {
+		return 0
+	}
+	if v > max {
+		return uint16(max)
+	}
+	return uint16(v)
+}
+
+func gray(samples []uint16, width, height, bitDepth int) image.Image {
+	rect := image.Rect(0, 0, width, height)
+
+	if bitDepth == 8 {
+		img := image.NewGray(rect)
+		for i, v := range samples[:width*height] {
+			img.Pix[i] = uint8(v)
+		}
+		return img
+	}
+
+	img := image.NewGray16(rect)
+	for i, v := range samples[:width*height] {
+		img.Pix[2*i] = uint8(v >> 8)
+		img.Pix[2*i+1] = uint8(v)
+	}
+	return img
+}
+
+// rgbPlanes builds a color image from three consecutive planes of samples.
+func rgbPlanes(samples []uint16, width, height, bitDepth int) image.Image {
+	n := width * height
+	r, g, b := samples[:n], samples[n:2*n], samples[2*n:3*n]
+
+	return newRGB(width, height, bitDepth, func(x, y int) (uint16, uint16, uint16) {
+		i := y*width + x
+		return r[i], g[i], b[i]
+	})
+}
+
+// newRGB creates an *image.RGBA for 8 bit frames or an *image.RGBA64 for 16 bit frames, with the colors of each
+// pixel from at.
+func newRGB(width, height, bitDepth int, at func(x, y int) (r, g, b uint16)) image.Image {
+	rect := image.Rect(0, 0, width, height)
+
+	if bitDepth == 8 {
+		img := image.NewRGBA(rect)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				r, g, b := at(x, y)
+				img.SetRGBA(x, y, color.RGBA{R: uint8(r), G: uint8(g), B: uint8(b), A: 0xff})
+			}
+		}
+		return img
+	}
+
+	img := image.NewRGBA64(rect)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b := at(x, y)
+			img.SetRGBA64(x, y, color.RGBA64{R: r, G: g, B: b, A: 0xffff})
+		}
+	}
+	return img
+}
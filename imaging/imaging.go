@@ -0,0 +1,54 @@
+// Package imaging decodes the frames cameras send as BLOBs into image.Image, so previews can be displayed without
+// external tools. It handles 8 and 16 bit monochrome, Bayer and RGB FITS files, raw video stream frames, and JPEG
+// stream frames:
+//
+//	rdr, _, _, err := c.GetBlob("CCD Simulator", "CCD1", "CCD1")
+//	...
+//	img, header, err := imaging.DecodeFITS(rdr)
+//
+// Bayer frames are debayered with bilinear interpolation, which is fast enough for live previews but not meant for
+// processing. Rows are kept in the order they are stored, which for INDI cameras is top down.
+//
+// ComputeStats measures decoded frames, and Analyzer plugs it into INDIClient.SetBlobAnalyzer so the stats of every
+// received frame are available from its BlobEvent.
+//
+// Preview renders an auto-stretched 8 bit JPEG or PNG of a decoded frame, and Previewer plugs it into
+// INDIClient.SetBlobPreviewer so every received frame has a preview for web UIs.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedFormat is returned when a frame is in a format that cannot be decoded.
+	ErrUnsupportedFormat = errors.New("unsupported frame format")
+	// ErrShortFrame is returned when a frame has less data than its dimensions require.
+	ErrShortFrame = errors.New("frame data is too short")
+	// ErrInvalidDimensions is returned when the width, height or bit depth of a frame are missing or invalid.
+	ErrInvalidDimensions = errors.New("invalid frame dimensions")
+	// ErrInvalidBayerPattern is returned for a Bayer pattern other than RGGB, BGGR, GRBG or GBRG.
+	ErrInvalidBayerPattern = errors.New("invalid bayer pattern")
+)
+
+// Decode decodes a frame in the given BLOB format, e.g. ".fits", ".stream" or ".stream_jpg". Raw frames have no
+// header, so raw describes their layout; it is ignored for other formats.
+func Decode(format string, data []byte, raw RawOptions) (image.Image, error) {
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+
+	switch format {
+	case "fits", "fit", "fts", "stream_fits":
+		img, _, err := DecodeFITS(bytes.NewReader(data))
+		return img, err
+	case "stream", "raw":
+		return DecodeRaw(data, raw)
+	case "stream_jpg", "jpg", "jpeg":
+		return jpeg.Decode(bytes.NewReader(data))
+	}
+
+	return nil, ErrUnsupportedFormat
+}
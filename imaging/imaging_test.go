@@ -0,0 +1,276 @@
+package imaging_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/imaging"
+	"github.com/goastro/indiclient/simulators"
+)
+
+// fits8 encodes an 8 bit FITS file with the given extra header cards.
+func fits8(axes []int, data []byte, cards ...string) []byte {
+	buf := &bytes.Buffer{}
+
+	header := []string{"SIMPLE  =                    T", "BITPIX  =                    8", fmt.Sprintf("NAXIS   = %20d", len(axes))}
+	for i, n := range axes {
+		header = append(header, fmt.Sprintf("NAXIS%d  = %20d", i+1, n))
+	}
+
+	for _, card := range append(append(header, cards...), "END") {
+		buf.WriteString(fmt.Sprintf("%-80s", card))
+	}
+
+	for buf.Len()%2880 != 0 {
+		buf.WriteByte(' ')
+	}
+
+	buf.Write(data)
+
+	for buf.Len()%2880 != 0 {
+		buf.WriteByte(0)
+	}
+
+	return buf.Bytes()
+}
+
+// mosaic lays out a 4x4 frame of a uniform color with the given pattern.
+func mosaic(pattern string, r, g, b byte) []byte {
+	values := map[byte]byte{'R': r, 'G': g, 'B': b}
+
+	data := make([]byte, 16)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			data[y*4+x] = values[pattern[(y%2)*2+x%2]]
+		}
+	}
+
+	return data
+}
+
+func Test_DecodeFITS_Mono16(t *testing.T) {
+	pixels := simulators.SyntheticFrame(32, 24, nil, 1, nil)
+	pixels[5] = 40000
+
+	data := simulators.EncodeFITS(32, 24, pixels,
+		simulators.Keyword{Name: "EXPTIME", Value: "1.5"},
+		simulators.Keyword{Name: "IMAGETYP", Value: "'Light Frame'", Comment: "Frame type"},
+	)
+
+	img, h, err := imaging.DecodeFITS(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	assert.Equal(t, 32, h.Width)
+	assert.Equal(t, 24, h.Height)
+	assert.Equal(t, 16, h.BitDepth)
+	assert.Equal(t, "1.5", h.Keywords["EXPTIME"])
+	assert.Equal(t, "Light Frame", h.Keywords["IMAGETYP"])
+
+	gray, ok := img.(*image.Gray16)
+	require.True(t, ok)
+	assert.Equal(t, uint16(40000), gray.Gray16At(5, 0).Y)
+	assert.Equal(t, uint16(1000), gray.Gray16At(0, 0).Y)
+}
+
+func Test_DecodeFITS_Bayer(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		cards []string
+	}{
+		{name: "RGGB", data: mosaic("RGGB", 200, 100, 50), cards: []string{"BAYERPAT= 'RGGB    '"}},
+		{name: "BGGR", data: mosaic("BGGR", 200, 100, 50), cards: []string{"BAYERPAT= 'BGGR'"}},
+		{name: "offset", data: mosaic("GRBG", 200, 100, 50), cards: []string{"BAYERPAT= 'RGGB'", "XBAYROFF=                    1"}},
+	}
+
+	for _, tt := range tests {
+		img, h, err := imaging.DecodeFITS(bytes.NewReader(fits8([]int{4, 4}, tt.data, tt.cards...)))
+		require.NoError(t, err, tt.name)
+
+		assert.NotEmpty(t, h.Bayer, tt.name)
+
+		rgba, ok := img.(*image.RGBA)
+		require.True(t, ok, tt.name)
+
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				assert.Equal(t, color.RGBA{R: 200, G: 100, B: 50, A: 255}, rgba.RGBAAt(x, y), tt.name)
+			}
+		}
+	}
+
+	_, _, err := imaging.DecodeFITS(bytes.NewReader(fits8([]int{4, 4}, mosaic("RGGB", 1, 2, 3), "BAYERPAT= 'RGBG'")))
+	assert.Equal(t, imaging.ErrInvalidBayerPattern, err)
+}
+
+func Test_DecodeFITS_RGB(t *testing.T) {
+	data := append(append(bytes.Repeat([]byte{10}, 4), bytes.Repeat([]byte{20}, 4)...), bytes.Repeat([]byte{30}, 4)...)
+
+	img, _, err := imaging.DecodeFITS(bytes.NewReader(fits8([]int{2, 2, 3}, data)))
+	require.NoError(t, err)
+
+	assert.Equal(t, color.RGBA{R: 10, G: 20, B: 30, A: 255}, img.(*image.RGBA).RGBAAt(1, 1))
+}
+
+func Test_DecodeFITS_Errors(t *testing.T) {
+	_, _, err := imaging.DecodeFITS(bytes.NewReader([]byte("not a fits file")))
+	assert.Equal(t, imaging.ErrNotFITS, err)
+
+	full := fits8([]int{4, 4}, make([]byte, 16))
+	_, _, err = imaging.DecodeFITS(bytes.NewReader(full[:2880+8]))
+	assert.Equal(t, imaging.ErrShortFrame, err)
+
+	_, _, err = imaging.DecodeFITS(bytes.NewReader(fits8([]int{4, 4, 2}, make([]byte, 32))))
+	assert.Equal(t, imaging.ErrInvalidDimensions, err)
+}
+
+func Test_DecodeRaw(t *testing.T) {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint16(data[6:], 50000)
+
+	img, err := imaging.DecodeRaw(data, imaging.RawOptions{Width: 2, Height: 2, BitDepth: 16})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(50000), img.(*image.Gray16).Gray16At(1, 1).Y)
+
+	img, err = imaging.DecodeRaw(mosaic("GBRG", 200, 100, 50), imaging.RawOptions{Width: 4, Height: 4, BitDepth: 8, Bayer: imaging.BayerGBRG})
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 200, G: 100, B: 50, A: 255}, img.(*image.RGBA).RGBAAt(2, 3))
+
+	_, err = imaging.DecodeRaw(data, imaging.RawOptions{Width: 4, Height: 4, BitDepth: 8})
+	assert.Equal(t, imaging.ErrShortFrame, err)
+
+	_, err = imaging.DecodeRaw(data, imaging.RawOptions{Width: 2, Height: 2, BitDepth: 12})
+	assert.Equal(t, imaging.ErrInvalidDimensions, err)
+}
+
+func Test_Debayer(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 4, 4))
+	copy(gray.Pix, mosaic("GRBG", 200, 100, 50))
+
+	img, err := imaging.Debayer(gray, imaging.BayerGRBG)
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 200, G: 100, B: 50, A: 255}, img.(*image.RGBA).RGBAAt(0, 0))
+
+	_, err = imaging.Debayer(image.NewRGBA(image.Rect(0, 0, 4, 4)), imaging.BayerGRBG)
+	assert.Equal(t, imaging.ErrUnsupportedFormat, err)
+}
+
+func Test_Decode(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil))
+
+	img, err := imaging.Decode(".stream_jpg", buf.Bytes(), imaging.RawOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 8, 8), img.Bounds())
+
+	img, err = imaging.Decode(".stream", make([]byte, 6), imaging.RawOptions{Width: 3, Height: 2, BitDepth: 8})
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 3, 2), img.Bounds())
+
+	img, err = imaging.Decode(".fits", fits8([]int{2, 2}, make([]byte, 4)), imaging.RawOptions{})
+	require.NoError(t, err)
+	assert.IsType(t, &image.Gray{}, img)
+
+	_, err = imaging.Decode(".ser", nil, imaging.RawOptions{})
+	assert.Equal(t, imaging.ErrUnsupportedFormat, err)
+}
+
+func Test_ComputeStats(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 2, 2))
+	copy(gray.Pix, []byte{10, 20, 30, 255})
+
+	stats := imaging.ComputeStats(gray, 4)
+	assert.Equal(t, 8, stats.BitDepth)
+	assert.Equal(t, 10.0, stats.Min)
+	assert.Equal(t, 255.0, stats.Max)
+	assert.Equal(t, 78.75, stats.Mean)
+	assert.Equal(t, 25.0, stats.Median)
+	assert.InDelta(t, 102.1, stats.StdDev, 0.1)
+	assert.Equal(t, []uint64{3, 0, 0, 1}, stats.Histogram)
+
+	gray16 := image.NewGray16(image.Rect(0, 0, 3, 1))
+	for i, v := range []uint16{1000, 60000, 2000} {
+		gray16.SetGray16(i, 0, color.Gray16{Y: v})
+	}
+
+	stats = imaging.ComputeStats(gray16, 0)
+	assert.Equal(t, 16, stats.BitDepth)
+	assert.Equal(t, 2000.0, stats.Median)
+	assert.Nil(t, stats.Histogram)
+}
+
+func Test_Analyzer(t *testing.T) {
+	pixels := simulators.SyntheticFrame(32, 24, nil, 1, nil)
+
+	stats, err := imaging.Analyzer(16, imaging.RawOptions{})(".fits", simulators.EncodeFITS(32, 24, pixels))
+	require.NoError(t, err)
+	assert.Equal(t, 1000.0, stats.Median)
+	assert.Equal(t, uint64(32*24), stats.Histogram[0])
+
+	_, err = imaging.Analyzer(16, imaging.RawOptions{})(".ser", nil)
+	assert.Equal(t, imaging.ErrUnsupportedFormat, err)
+}
+
+func Test_Stretch(t *testing.T) {
+	// A faint background with a single bright star.
+	gray16 := image.NewGray16(image.Rect(0, 0, 10, 10))
+	for i := 0; i < 100; i++ {
+		gray16.SetGray16(i%10, i/10, color.Gray16{Y: uint16(1000 + i%5)})
+	}
+	gray16.SetGray16(5, 5, color.Gray16{Y: 60000})
+
+	stretched := imaging.Stretch(gray16, 1)
+	require.IsType(t, &image.Gray{}, stretched)
+
+	// The median of the background is stretched to a quarter of full scale.
+	background := stretched.(*image.Gray).GrayAt(2, 0).Y
+	assert.InDelta(t, 64, int(background), 2)
+	assert.Less(t, stretched.(*image.Gray).GrayAt(0, 0).Y, background)
+	assert.Equal(t, uint8(255), stretched.(*image.Gray).GrayAt(5, 5).Y)
+
+	shrunk := imaging.Stretch(gray16, 3)
+	assert.Equal(t, image.Rect(0, 0, 3, 3), shrunk.Bounds())
+
+	rgb := image.NewRGBA64(image.Rect(0, 0, 4, 4))
+	for i := 0; i < 16; i++ {
+		rgb.SetRGBA64(i%4, i/4, color.RGBA64{R: 2000, G: 1000, B: 1000, A: 0xffff})
+	}
+
+	pixel := imaging.Stretch(rgb, 1).(*image.RGBA).RGBAAt(0, 0)
+	assert.Greater(t, pixel.R, pixel.G)
+	assert.Equal(t, pixel.G, pixel.B)
+}
+
+func Test_Previewer(t *testing.T) {
+	pixels := simulators.SyntheticFrame(64, 48, nil, 1, nil)
+	frame := simulators.EncodeFITS(64, 48, pixels)
+
+	preview, err := imaging.Previewer(imaging.PreviewOptions{MaxWidth: 32}, imaging.RawOptions{})(".fits", frame)
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", preview.ContentType)
+	assert.Equal(t, 32, preview.Width)
+	assert.Equal(t, 24, preview.Height)
+
+	_, err = jpeg.Decode(bytes.NewReader(preview.Data))
+	require.NoError(t, err)
+
+	preview, err = imaging.Previewer(imaging.PreviewOptions{Format: imaging.PreviewPNG}, imaging.RawOptions{})(".fits", frame)
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", preview.ContentType)
+
+	img, err := png.Decode(bytes.NewReader(preview.Data))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 64, 48), img.Bounds())
+
+	_, err = imaging.Previewer(imaging.PreviewOptions{}, imaging.RawOptions{})(".ser", nil)
+	assert.Equal(t, imaging.ErrUnsupportedFormat, err)
+}
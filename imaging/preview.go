@@ -0,0 +1,246 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+
+	"github.com/goastro/indiclient"
+)
+
+// PreviewFormat is the image format previews are encoded in.
+type PreviewFormat string
+
+const (
+	// PreviewJPEG encodes previews as JPEG, which is small enough to send for every frame.
+	PreviewJPEG = PreviewFormat("jpeg")
+	// PreviewPNG encodes previews as PNG, which is lossless but larger.
+	PreviewPNG = PreviewFormat("png")
+)
+
+// stretchBackground is where the median of a frame ends up after stretching, as a fraction of full scale.
+const stretchBackground = 0.25
+
+// stretchClip is how many MADs below the median the black point is put.
+const stretchClip = 2.8
+
+// PreviewOptions controls how previews are rendered.
+type PreviewOptions struct {
+	// Format is the format previews are encoded in. Empty means PreviewJPEG.
+	Format PreviewFormat
+	// Quality is the JPEG quality, from 1 to 100. Zero means jpeg.DefaultQuality.
+	Quality int
+	// MaxWidth shrinks frames wider than this by a whole factor, averaging the pixels. Zero keeps them full size.
+	MaxWidth int
+}
+
+// Stretch returns an 8 bit copy of img with an automatic screen stretch: the black point is set just below the
+// background, and a midtones transfer function brightens the background to a quarter of full scale, so faint detail
+// in a linear frame becomes visible. Monochrome frames stretch to *image.Gray, and color frames to *image.RGBA, with
+// the same stretch for each channel so their colors are kept. If factor is greater than one, img is first shrunk by
+// it.
+func Stretch(img image.Image, factor int) image.Image {
+	if factor < 1 {
+		factor = 1
+	}
+
+	b := img.Bounds()
+	width, height := b.Dx()/factor, b.Dy()/factor
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	mono := false
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		mono = true
+	}
+
+	// Each pixel of the shrunk frame is the average of a factor by factor block, as red, green and blue.
+	pixels := make([]uint16, 3*width*height)
+	counts := make([]uint64, 1<<16)
+	var total uint64
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var r, g, bl, n uint64
+
+			for yy := b.Min.Y + y*factor; yy < b.Min.Y+(y+1)*factor && yy < b.Max.Y; yy++ {
+				for xx := b.Min.X + x*factor; xx < b.Min.X+(x+1)*factor && xx < b.Max.X; xx++ {
+					pr, pg, pb := rgb16(img, xx, yy)
+					r += uint64(pr)
+					g += uint64(pg)
+					bl += uint64(pb)
+					n++
+				}
+			}
+
+			if n == 0 {
+				continue
+			}
+
+			i := 3 * (y*width + x)
+			pixels[i], pixels[i+1], pixels[i+2] = uint16(r/n), uint16(g/n), uint16(bl/n)
+
+			counts[luminance(pixels[i], pixels[i+1], pixels[i+2])]++
+			total++
+		}
+	}
+
+	lut := stretchTable(counts, total)
+	rect := image.Rect(0, 0, width, height)
+
+	if mono {
+		out := image.NewGray(rect)
+		for i := range out.Pix {
+			out.Pix[i] = lut[pixels[3*i]]
+		}
+		return out
+	}
+
+	out := image.NewRGBA(rect)
+	for i := 0; i < width*height; i++ {
+		out.Pix[4*i] = lut[pixels[3*i]]
+		out.Pix[4*i+1] = lut[pixels[3*i+1]]
+		out.Pix[4*i+2] = lut[pixels[3*i+2]]
+		out.Pix[4*i+3] = 0xff
+	}
+	return out
+}
+
+// Preview stretches img with Stretch, shrinking it to opts.MaxWidth, and encodes it in opts.Format.
+func Preview(img image.Image, opts PreviewOptions) (*indiclient.BlobPreview, error) {
+	factor := 1
+	if w := img.Bounds().Dx(); opts.MaxWidth > 0 && w > opts.MaxWidth {
+		factor = (w + opts.MaxWidth - 1) / opts.MaxWidth
+	}
+
+	stretched := Stretch(img, factor)
+
+	buf := bytes.Buffer{}
+	preview := &indiclient.BlobPreview{
+		Width:  stretched.Bounds().Dx(),
+		Height: stretched.Bounds().Dy(),
+	}
+
+	switch opts.Format {
+	case PreviewPNG:
+		preview.ContentType = "image/png"
+		if err := png.Encode(&buf, stretched); err != nil {
+			return nil, err
+		}
+	case PreviewJPEG, "":
+		quality := opts.Quality
+		if quality <= 0 {
+			quality = jpeg.DefaultQuality
+		}
+
+		preview.ContentType = "image/jpeg"
+		if err := jpeg.Encode(&buf, stretched, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	preview.Data = buf.Bytes()
+
+	return preview, nil
+}
+
+// Previewer returns an indiclient.BlobPreviewer that decodes frames with Decode and renders them with Preview, for
+// use with INDIClient.SetBlobPreviewer. raw describes raw video frames, as for Decode.
+func Previewer(opts PreviewOptions, raw RawOptions) indiclient.BlobPreviewer {
+	return func(format string, data []byte) (*indiclient.BlobPreview, error) {
+		img, err := Decode(format, data, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		return Preview(img, opts)
+	}
+}
+
+// rgb16 returns the 16 bit red, green and blue of the pixel of img at x, y.
+func rgb16(img image.Image, x, y int) (r, g, b uint16) {
+	switch img := img.(type) {
+	case *image.Gray:
+		v := uint16(img.GrayAt(x, y).Y) * 0x101
+		return v, v, v
+	case *image.Gray16:
+		v := img.Gray16At(x, y).Y
+		return v, v, v
+	}
+
+	c := color.RGBA64Model.Convert(img.At(x, y)).(color.RGBA64)
+	return c.R, c.G, c.B
+}
+
+// luminance returns the luminance of a 16 bit color, weighted as color.GrayModel does.
+func luminance(r, g, b uint16) uint16 {
+	return uint16((19595*uint32(r) + 38470*uint32(g) + 7471*uint32(b) + 1<<15) >> 16)
+}
+
+// stretchTable returns the 8 bit value of every 16 bit value for the stretch of n pixels whose luminances are counted
+// in counts.
+func stretchTable(counts []uint64, n uint64) []uint8 {
+	lut := make([]uint8, len(counts))
+	full := float64(len(counts) - 1)
+
+	if n == 0 {
+		return lut
+	}
+
+	med := median(counts, n)
+
+	// The median absolute deviation, counted the same way, scaled to estimate the standard deviation.
+	deviations := make([]uint64, len(counts))
+	for v, count := range counts {
+		deviations[int(math.Abs(float64(v)-med))] += count
+	}
+	mad := 1.4826 * median(deviations, n)
+
+	hi := 0.0
+	for v, count := range counts {
+		if count > 0 {
+			hi = float64(v)
+		}
+	}
+
+	// A flat frame has no deviation to put the black point below, so it is only brightened.
+	black := math.Max(0, med-stretchClip*mad)
+	if black >= hi {
+		black = 0
+	}
+
+	// Solving mtf(m, median) = stretchBackground for m gives mtf(stretchBackground, median).
+	midtones := 0.5
+	if x := (med - black) / (full - black); x > 0 && x < 1 {
+		midtones = mtf(stretchBackground, x)
+	}
+
+	for v := range lut {
+		x := (float64(v) - black) / (full - black)
+		switch {
+		case x <= 0:
+			lut[v] = 0
+		case x >= 1:
+			lut[v] = 0xff
+		default:
+			lut[v] = uint8(math.Round(255 * mtf(midtones, x)))
+		}
+	}
+
+	return lut
+}
+
+// mtf is the midtones transfer function, which maps 0 to 0, m to 0.5 and 1 to 1.
+func mtf(m, x float64) float64 {
+	return (m - 1) * x / ((2*m-1)*x - m)
+}
@@ -0,0 +1,59 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+// RawOptions describes the layout of a raw frame, which has no header of its own. For video streams the dimensions
+// are those of the CCD_STREAM_FRAME or CCD_FRAME property, and the bit depth is usually 8.
+type RawOptions struct {
+	Width, Height int
+	// BitDepth is 8 or 16.
+	BitDepth int
+	// Bayer is the color filter pattern of the sensor, or empty for monochrome frames.
+	Bayer BayerPattern
+	// ByteOrder is the byte order of 16 bit samples. Defaults to binary.LittleEndian, which is how drivers send the
+	// camera's buffer.
+	ByteOrder binary.ByteOrder
+}
+
+// DecodeRaw decodes a raw frame, one sample per pixel in rows from the top. Monochrome frames decode to *image.Gray
+// or *image.Gray16, and Bayer frames are debayered to *image.RGBA or *image.RGBA64.
+func DecodeRaw(data []byte, opts RawOptions) (image.Image, error) {
+	if opts.Width <= 0 || opts.Height <= 0 || (opts.BitDepth != 8 && opts.BitDepth != 16) {
+		return nil, ErrInvalidDimensions
+	}
+
+	if len(opts.Bayer) > 0 && !opts.Bayer.Valid() {
+		return nil, ErrInvalidBayerPattern
+	}
+
+	n := opts.Width * opts.Height
+	if len(data) < n*opts.BitDepth/8 {
+		return nil, ErrShortFrame
+	}
+
+	samples := make([]uint16, n)
+
+	if opts.BitDepth == 8 {
+		for i := range samples {
+			samples[i] = uint16(data[i])
+		}
+	} else {
+		order := opts.ByteOrder
+		if order == nil {
+			order = binary.LittleEndian
+		}
+
+		for i := range samples {
+			samples[i] = order.Uint16(data[2*i:])
+		}
+	}
+
+	if len(opts.Bayer) > 0 {
+		return debayer(samples, opts.Width, opts.Height, opts.BitDepth, opts.Bayer.offset(0, 0)), nil
+	}
+
+	return gray(samples, opts.Width, opts.Height, opts.BitDepth), nil
+}
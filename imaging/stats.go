@@ -0,0 +1,120 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/goastro/indiclient"
+)
+
+// ComputeStats computes statistics of the pixel values of img. Color images are measured on the luminance of each
+// pixel. If bins is greater than zero, the stats include a histogram with that many bins covering the full range of
+// the bit depth of img.
+func ComputeStats(img image.Image, bins int) indiclient.FrameStats {
+	b := img.Bounds()
+
+	stats := indiclient.FrameStats{Width: b.Dx(), Height: b.Dy(), BitDepth: 8}
+
+	switch img.(type) {
+	case *image.Gray16, *image.RGBA64, *image.NRGBA64:
+		stats.BitDepth = 16
+	}
+
+	// Counting every possible value gives an exact median and the histogram in a single pass over the pixels.
+	counts := make([]uint64, 1<<uint(stats.BitDepth))
+
+	switch g := img.(type) {
+	case *image.Gray:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for _, v := range g.Pix[g.PixOffset(b.Min.X, y):g.PixOffset(b.Max.X, y)] {
+				counts[v]++
+			}
+		}
+	case *image.Gray16:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			row := g.Pix[g.PixOffset(b.Min.X, y):g.PixOffset(b.Max.X, y)]
+			for i := 0; i < len(row); i += 2 {
+				counts[uint16(row[i])<<8|uint16(row[i+1])]++
+			}
+		}
+	default:
+		shift := uint(16 - stats.BitDepth)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				counts[color.Gray16Model.Convert(img.At(x, y)).(color.Gray16).Y>>shift]++
+			}
+		}
+	}
+
+	n := uint64(stats.Width * stats.Height)
+	if n == 0 {
+		return stats
+	}
+
+	var sum, sumSq float64
+	stats.Min = -1
+
+	for v, count := range counts {
+		if count == 0 {
+			continue
+		}
+
+		if stats.Min < 0 {
+			stats.Min = float64(v)
+		}
+		stats.Max = float64(v)
+
+		sum += float64(v) * float64(count)
+		sumSq += float64(v) * float64(v) * float64(count)
+	}
+
+	stats.Mean = sum / float64(n)
+	stats.StdDev = math.Sqrt(math.Max(0, sumSq/float64(n)-stats.Mean*stats.Mean))
+	stats.Median = median(counts, n)
+
+	if bins > 0 {
+		stats.Histogram = make([]uint64, bins)
+		for v, count := range counts {
+			stats.Histogram[v*bins/len(counts)] += count
+		}
+	}
+
+	return stats
+}
+
+// median returns the median of n values counted in counts, averaging the middle two if n is even.
+func median(counts []uint64, n uint64) float64 {
+	lo, hi := -1, -1
+	var seen uint64
+
+	for v, count := range counts {
+		seen += count
+
+		if lo < 0 && seen > (n-1)/2 {
+			lo = v
+		}
+
+		if seen > n/2 {
+			hi = v
+			break
+		}
+	}
+
+	return float64(lo+hi) / 2
+}
+
+// Analyzer returns an indiclient.BlobAnalyzer that decodes frames with Decode and computes their stats with
+// ComputeStats, for use with INDIClient.SetBlobAnalyzer. raw describes raw video frames, as for Decode.
+func Analyzer(bins int, raw RawOptions) indiclient.BlobAnalyzer {
+	return func(format string, data []byte) (*indiclient.FrameStats, error) {
+		img, err := Decode(format, data, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		stats := ComputeStats(img, bins)
+
+		return &stats, nil
+	}
+}
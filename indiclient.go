@@ -14,19 +14,18 @@ package indiclient
 // TODO: Handle device timeouts
 
 import (
-	"encoding/base64"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"net"
-	"os"
-	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/rickbassham/logging"
 	"github.com/spf13/afero"
 )
@@ -50,11 +49,33 @@ var (
 	// ErrPropertyWithoutDevice is returned when an attempt to GetProperties specifies a property but no device.
 	ErrPropertyWithoutDevice = errors.New("property specified without device")
 
-	// ErrInvalidBlobEnable is returned when a value other than Only, Also, Never is specified for BlobEnable.
+	// ErrInvalidBlobEnable is returned when a value other than Only, Also, Never is specified for BlobEnable, or URL
+	// without SetINDIGO.
 	ErrInvalidBlobEnable = errors.New("invalid BlobEnable value")
 
 	// ErrBlobNotFound is returned when an attempt to read a blob value is made but none are found
 	ErrBlobNotFound = errors.New("blob not found")
+
+	// ErrUnsupportedScheme is returned when Connect is given a URL with a scheme other than indi, tcp or unix.
+	ErrUnsupportedScheme = errors.New("unsupported address scheme")
+
+	// ErrInvalidAddress is returned when Connect is given a URL without a host or socket path.
+	ErrInvalidAddress = errors.New("invalid address")
+
+	// ErrNotSocket is returned by UnixDialer when the address is not a UNIX domain socket.
+	ErrNotSocket = errors.New("not a socket")
+
+	// ErrSubscriptionNotFound is returned when Unsubscribe is called with an unknown id.
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+
+	// ErrNotConnected is returned when a call needs a connection to indiserver and the client is not connected.
+	ErrNotConnected = errors.New("not connected")
+
+	// ErrConnectionLost is returned by readers of BLOB streams when the connection to indiserver fails.
+	ErrConnectionLost = errors.New("connection to indiserver lost")
+
+	// ErrRepeaterClosed is returned when Serve is called on a closed Repeater.
+	ErrRepeaterClosed = errors.New("repeater closed")
 )
 
 // PropertyState represents the current state of a property. "Idle", "Ok", "Busy", or "Alert".
@@ -115,6 +136,8 @@ const (
 	BlobEnableAlso = BlobEnable("Also")
 	// BlobEnableOnly represents that the current client should only be sent any BLOB's for a device.
 	BlobEnableOnly = BlobEnable("Only")
+	// BlobEnableURL asks an INDIGO server to send BLOB's as a URL to fetch them from, rather than inline. See SetINDIGO.
+	BlobEnableURL = BlobEnable("URL")
 )
 
 // Dialer allows the client to connect to an INDI server.
@@ -122,35 +145,170 @@ type Dialer interface {
 	Dial(network, address string) (io.ReadWriteCloser, error)
 }
 
+// ContextDialer is a Dialer that can stop dialing when a context is done. ConnectContext uses DialContext if the
+// client's Dialer implements it.
+type ContextDialer interface {
+	Dialer
+	DialContext(ctx context.Context, network, address string) (io.ReadWriteCloser, error)
+}
+
 // NetworkDialer is an implementation of Dialer that uses the built-in net package.
-type NetworkDialer struct{}
+type NetworkDialer struct {
+	// Timeout is the longest a dial may take. Zero means no limit, other than the operating system's.
+	Timeout time.Duration
+	// KeepAlive is the interval between TCP keep-alive probes. Zero uses the net package's default, and a negative
+	// value disables them.
+	KeepAlive time.Duration
+	// DisableNoDelay enables Nagle's algorithm on TCP connections, which the net package disables with TCP_NODELAY.
+	// This sends fewer, larger packets, at the cost of delaying small commands.
+	DisableNoDelay bool
+}
 
 // Dial connects to the address on the named network.
-func (NetworkDialer) Dial(network, address string) (io.ReadWriteCloser, error) {
-	return net.Dial(network, address)
+func (d NetworkDialer) Dial(network, address string) (io.ReadWriteCloser, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network, giving up when ctx is done.
+func (d NetworkDialer) DialContext(ctx context.Context, network, address string) (io.ReadWriteCloser, error) {
+	nd := net.Dialer{Timeout: d.Timeout, KeepAlive: d.KeepAlive}
+
+	conn, err := nd.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok && d.DisableNoDelay {
+		if err := tcp.SetNoDelay(false); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
 }
 
 // INDIClient is the struct used to keep a connection alive to an indiserver.
+//
+// An INDIClient is safe for concurrent use. Devices and properties returned by its methods are snapshots: they are
+// deep copies that share no maps or slices with the client, so they can be read and modified freely while the client
+// continues to receive updates. Call the method again to get the latest state.
 type INDIClient struct {
 	log        logging.Logger
-	dialer     Dialer
+	dialer     Dialer // Protected by rwm
 	fs         afero.Fs
 	bufferSize int
 
-	conn io.ReadWriteCloser
+	parserLimits ParserLimits
+	parseMode    ParseMode
+	resync       ResyncOptions // Protected by rwm
+	busy         BusyOptions   // Protected by rwm
+	stats        connStats
 
-	write chan interface{}
-	read  chan interface{}
+	write chan interface{} // Protected by rwm
 	writeReturn chan error
 
 	rwm         *sync.RWMutex //Protects devices structure
 	devices     map[string]Device
-	blobStreams sync.Map
+	published   atomic.Value // map[string]Device, see publishedDevices
+	serverMessages []MessageJSON // Protected by rwm
+	messageHistory int           // Protected by rwm
+	deviceHistory  map[string]int // Protected by rwm
+	blobStreams   sync.Map
+	blobStreamsMu sync.Mutex
+
+	blobRetention      int                    // Protected by rwm
+	blobFiles          map[string][]BlobValue // Protected by rwm
+	blobSeq            map[string]uint64      // Protected by rwm
+	blobCopyBufferSize int                    // Protected by rwm
+	blobAnalyzer       BlobAnalyzer           // Protected by rwm
+	blobPreviewer      BlobPreviewer          // Protected by rwm
+	blobStorage        BlobStorageOptions     // Protected by rwm
+	blobNameTemplate   *template.Template     // Protected by rwm
+	blobExposure       map[string]float64     // Protected by rwm
+	blobBandwidth      BlobBandwidthOptions   // Protected by rwm
+	blobMapping        BlobMappingOptions     // Protected by rwm
+	blobWorkers        BlobWorkerOptions      // Protected by rwm
+	blobPooled         map[string]bool        // Protected by rwm
+	blobLimiter        *rateLimiter
+
+	protocolVersion string // Protected by rwm
+	serverVersion   string // Protected by rwm
+	dryRun          bool   // Protected by rwm
+
+	commandTimeout time.Duration // Protected by rwm
+
+	accessPolicy AccessPolicy // Protected by rwm
+
+	interest Interest // Protected by rwm
+
+	rawElements []string // Protected by rwm
+
+	translator Translator // Protected by rwm
+
+	codec Codec // Protected by rwm
+
+	indigo INDIGOOptions // Protected by rwm
+
+	blobFetch BlobFetchOptions // Protected by rwm
+
+	defCache          DefinitionCacheOptions     // Protected by rwm
+	cachedProps       map[string]map[string]bool // Protected by rwm
+	cachedVersions    map[string]string          // Protected by rwm
+	reconciling       map[string]ClockTimer      // Protected by rwm
+	savingDefinitions map[string]bool            // Protected by rwm
+
+	autoGetProperties AutoGetPropertiesOptions // Protected by rwm
+
+	deviceSeen   map[string]time.Time // Protected by rwm
+	staleDevices map[string]bool      // Protected by rwm
+	staleOpts    StaleOptions         // Protected by rwm
+	staleStop    chan struct{}        // Protected by rwm
+
+	deletedDevices map[string]time.Time   // Protected by rwm
+	initValues     map[string][]InitValue // Protected by rwm
+	pendingInit    map[string][]InitValue // Protected by rwm
+
+	leases        map[string]*Lease        // Protected by rwm
+	propertyLocks map[string]*propertyLock // Protected by rwm
+
+	subscriptions sync.Map
+	blobHandlers  sync.Map
+	repeaters     sync.Map
+	rawHandlers   sync.Map
+	rawCount      int32        // Number of rawHandlers, accessed atomically
+	clock         atomic.Value // Holds a clockValue, see SetClock
+
+	network      string          // Protected by rwm
+	address      string          // Protected by rwm
+	session      *session        // Protected by rwm
+	blobPolicies []BlobPolicy    // Protected by rwm
+	watched      []WatchedDevice // Protected by rwm
+
+	tracerMu     sync.RWMutex
+	tracer       Tracer
+	transactions sync.Map
+
+	aliasMu sync.RWMutex
+	aliases map[string]string // alias to device name
+	aliasOf map[string]string // device name to alias
+
+	syncMu  sync.Mutex
+	syncing *syncRequest
+
+	interceptorMu sync.RWMutex
+	inbound       []Interceptor
+	outbound      []Interceptor
+
+	auditMu   sync.Mutex
+	audit     []*AuditEntry
+	auditSize int
+	auditUser string
 }
 
 // NewINDIClient creates a client to connect to an INDI server.
 func NewINDIClient(log logging.Logger, dialer Dialer, fs afero.Fs, bufferSize int) *INDIClient {
-	return &INDIClient{
+	c := &INDIClient{
 		log:         log,
 		dialer:      dialer,
 		devices:     make(map[string]Device),
@@ -158,53 +316,145 @@ func NewINDIClient(log logging.Logger, dialer Dialer, fs afero.Fs, bufferSize in
 		fs:          fs,
 		bufferSize:  bufferSize,
 		rwm:         &sync.RWMutex{},
-	}
+
+		parserLimits:       DefaultParserLimits,
+		codec:              XMLCodec{},
+		blobFetch:          DefaultBlobFetchOptions,
+		defCache:           DefinitionCacheOptions{Reconcile: DefaultDefinitionReconcile},
+		cachedProps:        map[string]map[string]bool{},
+		cachedVersions:     map[string]string{},
+		reconciling:        map[string]ClockTimer{},
+		savingDefinitions:  map[string]bool{},
+		deviceSeen:         map[string]time.Time{},
+		staleDevices:       map[string]bool{},
+		blobRetention:      1,
+		blobCopyBufferSize: DefaultBlobCopyBufferSize,
+		blobFiles:          map[string][]BlobValue{},
+		blobSeq:            map[string]uint64{},
+		blobExposure:       map[string]float64{},
+		blobPooled:         map[string]bool{},
+		blobLimiter:        &rateLimiter{},
+		protocolVersion:    DefaultProtocolVersion,
+		auditSize:          DefaultAuditLogSize,
+		messageHistory:     DefaultMessageHistory,
+		deviceHistory:      map[string]int{},
+		aliases:            map[string]string{},
+		aliasOf:            map[string]string{},
+		deletedDevices:     map[string]time.Time{},
+		initValues:         map[string][]InitValue{},
+		pendingInit:        map[string][]InitValue{},
+		leases:             map[string]*Lease{},
+		propertyLocks:      map[string]*propertyLock{},
+	}
+
+	c.published.Store(map[string]Device{})
+	c.blobLimiter.clock = c.Clock
+
+	return c
 }
 
-// Connect dials to create a connection to address. address should be in the format that the provided Dialer expects.
+// Connect dials to create a connection to address. address should be in the format that the provided Dialer expects,
+// or a URL with an indi://, tcp:// or unix:// scheme, in which case network is ignored. See ParseAddress. If
+// SetAutoGetProperties is enabled, it then sends getProperties.
 func (c *INDIClient) Connect(network, address string) error {
-	conn, err := c.dialer.Dial(network, address)
+	return c.ConnectContext(context.Background(), network, address)
+}
+
+// ConnectContext connects like Connect, but gives up dialing when ctx is done, returning ctx.Err(). ctx only bounds
+// dialing; it does not close the connection once it is made.
+func (c *INDIClient) ConnectContext(ctx context.Context, network, address string) error {
+	if err := c.connect(ctx, network, address); err != nil {
+		return err
+	}
+
+	auto := c.AutoGetProperties()
+	if !auto.Enabled {
+		return nil
+	}
+
+	return c.requestProperties(auto.Watch)
+}
+
+// connect connects without sending anything.
+func (c *INDIClient) connect(ctx context.Context, network, address string) error {
+	if strings.Contains(address, "://") {
+		var err error
+		network, address, err = ParseAddress(address)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.rwm.RLock()
+	dialer := c.dialer
+	codec := c.codec
+	c.rwm.RUnlock()
+
+	conn, err := dialContext(ctx, dialer, network, address)
 	if err != nil {
 		return err
 	}
 
 	// Clear out all devices
 	c.rwm.Lock()
+	c.abortTransactions("", "", ErrDisconnected)
 	c.delProperty(&DelProperty{})
+	c.network = network
+	c.address = address
+	c.serverVersion = ""
+	c.deletedDevices = map[string]time.Time{}
+	c.pendingInit = map[string][]InitValue{}
+	c.loadDefinitions()
+	prev := c.session
+	s := newSession(conn, c.bufferSize)
+	c.session = s
+	w := make(chan interface{}, c.bufferSize)
+	c.write = w
 	c.rwm.Unlock()
-	c.conn = conn
 
-	c.read = make(chan interface{}, c.bufferSize)
-	c.write = make(chan interface{}, c.bufferSize) 
+	if prev != nil {
+		prev.close()
+	}
+
+	c.stats.reset(c.now())
 
-	c.startRead()
-	c.startWrite()
+	c.startRead(s, codec)
+	c.startWrite(s, w, codec)
 
 	return nil
 }
 
-// Disconnect clears out all devices from memory, closes the connection, and closes the read and write channels.
+// Disconnect clears out all devices from memory and closes the connection, which stops the goroutines reading and
+// writing it. Open BLOB streams are closed, so their readers get io.EOF, and Set*Value calls waiting for an answer fail
+// with ErrDisconnected. It is safe to call at any time, from any goroutine, and more than once.
 func (c *INDIClient) Disconnect() error {
+	c.rwm.RLock()
+	s := c.session
+	c.rwm.RUnlock()
+
+	return c.disconnect(s, nil)
+}
+
+// disconnect ends s. If s is still the current session, all devices are cleared out, and open BLOB streams are
+// closed with cause. It can be called more than once, from any goroutine.
+func (c *INDIClient) disconnect(s *session, cause error) error {
 	// Clear out all devices
 	c.rwm.Lock()
-	c.delProperty(&DelProperty{})
+	current := s == c.session
+	if current {
+		c.abortTransactions("", "", ErrDisconnected)
+		c.delProperty(&DelProperty{})
+	}
 	c.rwm.Unlock()
 
-	if c.conn == nil {
+	if s == nil {
 		return nil
 	}
 
-	err := c.conn.Close()
-	c.conn = nil
-
-	if c.read != nil {
-		close(c.read)
-		c.read = nil
-	}
+	closed, err := s.close()
 
-	if c.write != nil {
-		close(c.write)
-		c.write = nil
+	if closed && current {
+		c.closeBlobStreams(cause)
 	}
 
 	return err
@@ -212,75 +462,116 @@ func (c *INDIClient) Disconnect() error {
 
 // IsConnected returns true if the client is currently connected to an INDI server. Otherwise, returns false.
 func (c *INDIClient) IsConnected() bool {
-	if c.conn != nil {
-		return true
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.session != nil && !c.session.ended()
+}
+
+// sendCommand queues cmd for the goroutine writing the connection. cmd is dropped if the session ends first.
+func (c *INDIClient) sendCommand(cmd interface{}) {
+	c.rwm.RLock()
+	w := c.write
+	var done chan struct{}
+	if c.session != nil {
+		done = c.session.done
 	}
+	c.rwm.RUnlock()
 
-	return false
+	select {
+	case w <- cmd:
+	case <-done:
+	}
+}
+
+// flushRequest is queued by flush behind the commands already queued. The goroutine writing the connection closes
+// done when it gets to it.
+type flushRequest struct {
+	done chan struct{}
+}
+
+// flush waits until the commands queued so far have been written to the connection, or the session has ended.
+// indiserver does not answer some commands, such as enableBLOB, so this is as close as the client can get to knowing
+// they have taken effect.
+func (c *INDIClient) flush() {
+	c.rwm.RLock()
+	var done chan struct{}
+	if c.session != nil {
+		done = c.session.done
+	}
+	c.rwm.RUnlock()
+
+	req := flushRequest{done: make(chan struct{})}
+	c.sendCommand(req)
+
+	select {
+	case <-req.done:
+	case <-done:
+	}
 }
 
 // Devices returns the current list of INDI devices with their current state.
 func (c *INDIClient) Devices() []string {
-	c.rwm.RLock()
-	defer c.rwm.RUnlock()
 	devices := []string{}
 
-	for key, _ := range c.devices {
-		devices = append(devices, key)
+	for key := range c.publishedDevices() {
+		devices = append(devices, c.aliasDevice(key))
 	}
 	return devices
 }
 
-// GetBlob finds a BLOB with the given deviceName, propName, blobName. Be sure to close rdr when you are done with it.
-func (c *INDIClient) GetBlob(deviceName, propName, blobName string) (rdr io.ReadCloser, fileName string, length int64, err error) {
-	c.rwm.Lock()
-	defer c.rwm.Unlock()
+// ServerMessages returns the messages indiserver sent without a device, such as announcements that a driver has
+// crashed or restarted. Subscribe to EventTypeMessage events with an empty Device to be told about new ones.
+func (c *INDIClient) ServerMessages() []MessageJSON {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
 
-	device, err := c.findDevice(deviceName)
+	return append([]MessageJSON{}, c.serverMessages...)
+}
+
+// GroupedProperties returns the properties of deviceName grouped for display, in the order they were defined by the
+// driver. See Device.GroupedProperties.
+func (c *INDIClient) GroupedProperties(deviceName string) ([]PropertyGroup, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	prop, ok := device.BlobProperties[propName]
-	if !ok {
-		err = ErrPropertyNotFound
-		return
-	}
+	return device.GroupedProperties(), nil
+}
 
-	val, ok := prop.Values[blobName]
-	if !ok {
-		err = ErrPropertyValueNotFound
-		return
-	}
+// GetBlob finds a BLOB with the given deviceName, propName, blobName. Be sure to close rdr when you are done with it.
+// This method only works once per BLOB; BlobAvailable returns false afterwards until a new BLOB is received. Use PeekBlob
+// to read a BLOB without consuming it.
+func (c *INDIClient) GetBlob(deviceName, propName, blobName string) (rdr io.ReadCloser, fileName string, length int64, err error) {
+	deviceName = c.resolveDevice(deviceName)
 
-	if val.Size == 0 || val.Name == "" {
-		err = ErrBlobNotFound
-		return
-	}
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
 
-	rdr, err = c.fs.Open(val.Value)
+	rdr, fileName, length, err = c.openBlob(deviceName, propName, blobName)
 	if err != nil {
 		return
 	}
 
-	fileName = filepath.Base(val.Value)
-
-	length = val.Size
 	// This method should only work once per blob, so the blob value and size are reset
+	val := c.devices[deviceName].BlobProperties[propName].Values[blobName]
 	val.Value = ""
 	val.Size = 0
 
-	device.BlobProperties[propName] = prop
-	
-	c.devices[deviceName] = device
+	c.devices[deviceName].BlobProperties[propName].Values[blobName] = val
+	c.publishProperty(deviceName, propName)
 	return
 }
 
+// BlobAvailable returns true if a BLOB has been received for the given deviceName, propName, blobName, and has not
+// been consumed by GetBlob or ReleaseBlob.
 func (c *INDIClient) BlobAvailable(deviceName, propName, blobName string) bool {
-	c.rwm.RLock()
-	defer c.rwm.RUnlock()
+	deviceName = c.resolveDevice(deviceName)
 
-	device, err := c.findDevice(deviceName)
+	device, err := c.findPublishedDevice(deviceName)
 	if err != nil {
 		return false
 	}
@@ -304,54 +595,16 @@ func (c *INDIClient) BlobAvailable(deviceName, propName, blobName string) bool {
 
 // GetBlobStream finds a BLOB with the given deviceName, propName, blobName. This will return an io.Pipe that can stream the BLOBs that are received from the indiserver.
 // The client will keep track of all open streams and write to them as blobs are received from indiserver. Remember to call CloseBlobStream when you are done. If you don't,
-// all blobs received for that device, property, blob will fail to write once the reader is closed.
+// all blobs received for that device, property, blob will be dropped once the stream's buffer is full. See GetBlobStreamWithOptions to control buffering.
 func (c *INDIClient) GetBlobStream(deviceName, propName, blobName string) (rdr io.ReadCloser, id string, err error) {
-	c.rwm.RLock()
-	defer c.rwm.RUnlock()
-	device, err := c.findDevice(deviceName)
-	if err != nil {
-		return
-	}
-
-	prop, ok := device.BlobProperties[propName]
-	if !ok {
-		err = ErrPropertyNotFound
-		return
-	}
-
-	_, ok = prop.Values[blobName]
-	if !ok {
-		err = ErrPropertyValueNotFound
-		return
-	}
-
-	guid := uuid.New()
-	id = guid.String()
-
-	key := fmt.Sprintf("%s_%s_%s", deviceName, propName, blobName)
-
-	r, w := io.Pipe()
-
-	rdr = r
-
-	writers := map[string]io.Writer{}
-
-	if ws, ok := c.blobStreams.Load(key); ok {
-		writers = ws.(map[string]io.Writer)
-	}
-
-	writers[id] = w
-
-	c.blobStreams.Store(key, writers)
-
-	return
+	return c.GetBlobStreamWithOptions(deviceName, propName, blobName, BlobStreamOptions{})
 }
 
 // CloseBlobStream closes the blob stream created by GetBlobStream.
 func (c *INDIClient) CloseBlobStream(deviceName, propName, blobName string, id string) (err error) {
-	c.rwm.RLock()
-	defer c.rwm.RUnlock()
-	device, err := c.findDevice(deviceName)
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
 	if err != nil {
 		return
 	}
@@ -367,19 +620,8 @@ func (c *INDIClient) CloseBlobStream(deviceName, propName, blobName string, id s
 		err = ErrPropertyValueNotFound
 		return
 	}
-	key := fmt.Sprintf("%s_%s_%s", deviceName, propName, blobName)
-
-	if ws, ok := c.blobStreams.Load(key); ok {
-		writers := ws.(map[string]io.Writer)
-
-		if w, ok := writers[id]; ok {
-			w.(io.WriteCloser).Close()
 
-			delete(writers, id)
-
-			c.blobStreams.Store(key, writers)
-		}
-	}
+	c.removeBlobStream(blobStreamKey(deviceName, propName, blobName), id, nil)
 
 	return
 }
@@ -387,26 +629,47 @@ func (c *INDIClient) CloseBlobStream(deviceName, propName, blobName string, id s
 // GetProperties sends a command to the INDI server to retreive the property definitions for the given deviceName and propName.
 // deviceName and propName are optional.
 func (c *INDIClient) GetProperties(deviceName, propName string) error {
+	return c.sendGetProperties(deviceName, propName, false)
+}
+
+func (c *INDIClient) sendGetProperties(deviceName, propName string, dryRun bool) error {
+	deviceName = c.resolveDevice(deviceName)
+
 	if len(propName) > 0 && len(deviceName) == 0 {
 		return ErrPropertyWithoutDevice
 	}
 
+	c.rwm.RLock()
 	cmd := GetProperties{
-		Version: "1.7",
+		Version: c.clientVersion(),
 		Device:  deviceName,
 		Name:    propName,
 	}
+	dryRun = dryRun || c.dryRun
+	c.rwm.RUnlock()
 
-	c.write <- cmd
+	if dryRun {
+		return c.newDryRunError(cmd)
+	}
+
+	_, span := c.startSpan(context.Background(), "GetProperties", map[string]string{SpanAttrDevice: deviceName, SpanAttrProperty: propName})
+	c.sendCommand(cmd)
+	span.End()
+
+	if len(deviceName) > 0 {
+		c.rwm.Lock()
+		c.watched = addWatchedDevice(c.watched, WatchedDevice{Device: deviceName, Property: propName})
+		c.rwm.Unlock()
+	}
 
 	return nil
 }
 
 // Probes the client to check if a text property is set
 func (c *INDIClient) TextPropertySet(deviceName, propName string) bool {
-	c.rwm.RLock()
-	defer c.rwm.RUnlock()
-	device, err := c.findDevice(deviceName)
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
 	if err != nil {
 		return false
 	}
@@ -422,9 +685,9 @@ func (c *INDIClient) TextPropertySet(deviceName, propName string) bool {
 
 // Probes the client to check if a number property is set
 func (c *INDIClient) NumberPropertySet(deviceName, propName string) bool {
-	c.rwm.RLock()
-	defer c.rwm.RUnlock()
-	device, err := c.findDevice(deviceName)
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
 	if err != nil {
 		return false
 	}
@@ -438,9 +701,9 @@ func (c *INDIClient) NumberPropertySet(deviceName, propName string) bool {
 
 // Probes the client to check if a switch property is set
 func (c *INDIClient) SwitchPropertySet(deviceName, propName string) bool {
-	c.rwm.RLock()
-	defer c.rwm.RUnlock()
-	device, err := c.findDevice(deviceName)
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
 	if err != nil {
 		return false
 	}
@@ -455,9 +718,9 @@ func (c *INDIClient) SwitchPropertySet(deviceName, propName string) bool {
 
 // Probes the client to check if a blob property is set
 func (c *INDIClient) BlobPropertySet(deviceName, propName string) bool {
-	c.rwm.RLock()
-	defer c.rwm.RUnlock()
-	device, err := c.findDevice(deviceName)
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
 	if err != nil {
 		return false
 	}
@@ -472,9 +735,9 @@ func (c *INDIClient) BlobPropertySet(deviceName, propName string) bool {
 
 // GetText finds a TextValue with the given deviceName, propName, TextName.
 func (c *INDIClient) GetText(deviceName, propName, textName string) (TextValue, error){
-	c.rwm.RLock()
-	defer c.rwm.RUnlock()
-	device, err := c.findDevice(deviceName)
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
 	if err != nil {
 		return TextValue{}, ErrDeviceNotFound
 	}
@@ -493,9 +756,9 @@ func (c *INDIClient) GetText(deviceName, propName, textName string) (TextValue,
 
 // GetNumber finds a NumberValue with the given deviceName, propName, NumberName.
 func (c *INDIClient) GetNumber(deviceName, propName, numberName string) (NumberValue, error){
-	c.rwm.RLock()
-	defer c.rwm.RUnlock()
-	device, err := c.findDevice(deviceName)
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
 	if err != nil {
 		return NumberValue{}, ErrDeviceNotFound
 	}
@@ -514,9 +777,9 @@ func (c *INDIClient) GetNumber(deviceName, propName, numberName string) (NumberV
 
 // GetSwitch finds a SwitchValue with the given deviceName, propName, SwitchName.
 func (c *INDIClient) GetSwitch(deviceName, propName, switchName string) (SwitchValue, error){
-	c.rwm.RLock()
-	defer c.rwm.RUnlock()
-	device, err := c.findDevice(deviceName)
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
 	if err != nil {
 		return SwitchValue{}, ErrDeviceNotFound
 	}
@@ -533,15 +796,121 @@ func (c *INDIClient) GetSwitch(deviceName, propName, switchName string) (SwitchV
 	return SwitchValue{}, ErrPropertyValueNotFound
 }
 
+// GetDevice returns a snapshot of the device with the given deviceName and all its properties.
+func (c *INDIClient) GetDevice(deviceName string) (Device, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
+	if err != nil {
+		return Device{}, err
+	}
+
+	device = device.Copy()
+	device.Name = c.aliasDevice(device.Name)
+
+	return device, nil
+}
+
+// GetTextProperty returns a snapshot of the TextProperty with the given deviceName and propName.
+func (c *INDIClient) GetTextProperty(deviceName, propName string) (TextProperty, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
+	if err != nil {
+		return TextProperty{}, err
+	}
+
+	prop, ok := device.TextProperties[propName]
+	if !ok {
+		return TextProperty{}, ErrPropertyNotFound
+	}
+
+	return prop.Copy(), nil
+}
+
+// GetNumberProperty returns a snapshot of the NumberProperty with the given deviceName and propName.
+func (c *INDIClient) GetNumberProperty(deviceName, propName string) (NumberProperty, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
+	if err != nil {
+		return NumberProperty{}, err
+	}
+
+	prop, ok := device.NumberProperties[propName]
+	if !ok {
+		return NumberProperty{}, ErrPropertyNotFound
+	}
+
+	return prop.Copy(), nil
+}
+
+// GetSwitchProperty returns a snapshot of the SwitchProperty with the given deviceName and propName.
+func (c *INDIClient) GetSwitchProperty(deviceName, propName string) (SwitchProperty, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
+	if err != nil {
+		return SwitchProperty{}, err
+	}
+
+	prop, ok := device.SwitchProperties[propName]
+	if !ok {
+		return SwitchProperty{}, ErrPropertyNotFound
+	}
+
+	return prop.Copy(), nil
+}
+
+// GetLightProperty returns a snapshot of the LightProperty with the given deviceName and propName.
+func (c *INDIClient) GetLightProperty(deviceName, propName string) (LightProperty, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
+	if err != nil {
+		return LightProperty{}, err
+	}
+
+	prop, ok := device.LightProperties[propName]
+	if !ok {
+		return LightProperty{}, ErrPropertyNotFound
+	}
+
+	return prop.Copy(), nil
+}
+
+// GetBlobProperty returns a snapshot of the BlobProperty with the given deviceName and propName.
+func (c *INDIClient) GetBlobProperty(deviceName, propName string) (BlobProperty, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
+	if err != nil {
+		return BlobProperty{}, err
+	}
+
+	prop, ok := device.BlobProperties[propName]
+	if !ok {
+		return BlobProperty{}, ErrPropertyNotFound
+	}
+
+	return prop.Copy(), nil
+}
+
 // EnableBlob sends a command to the INDI server to enable/disable BLOBs for the current connection.
 // It is recommended to enable blobs on their own client, and keep the main connection clear of large transfers.
 // By default, BLOBs are NOT enabled.
 func (c *INDIClient) EnableBlob(deviceName, propName string, val BlobEnable) error {
-	if val != BlobEnableAlso && val != BlobEnableNever && val != BlobEnableOnly {
+	return c.enableBlob(deviceName, propName, val, false)
+}
+
+func (c *INDIClient) enableBlob(deviceName, propName string, val BlobEnable, dryRun bool) error {
+	deviceName = c.resolveDevice(deviceName)
+
+	if val != BlobEnableAlso && val != BlobEnableNever && val != BlobEnableOnly && (val != BlobEnableURL || !c.INDIGO().Enabled) {
 		return ErrInvalidBlobEnable
 	}
 
-	_, err := c.findDevice(deviceName)
+	_, err := c.findPublishedDevice(deviceName)
 	if err != nil {
 		return err
 	}
@@ -552,7 +921,21 @@ func (c *INDIClient) EnableBlob(deviceName, propName string, val BlobEnable) err
 		Value:  val,
 	}
 
-	c.write <- cmd
+	c.rwm.RLock()
+	dryRun = dryRun || c.dryRun
+	c.rwm.RUnlock()
+
+	if dryRun {
+		return c.newDryRunError(cmd)
+	}
+
+	_, span := c.startSpan(context.Background(), "EnableBlob", map[string]string{SpanAttrDevice: deviceName, SpanAttrProperty: propName})
+	c.sendCommand(cmd)
+	span.End()
+
+	c.rwm.Lock()
+	c.blobPolicies = addBlobPolicy(c.blobPolicies, BlobPolicy{Device: deviceName, Property: propName, Value: val})
+	c.rwm.Unlock()
 
 	return nil
 }
@@ -560,46 +943,54 @@ func (c *INDIClient) EnableBlob(deviceName, propName string, val BlobEnable) err
 // SetTextValue sends a command to the INDI server to change the value of a textVector.
 // Waits to return until the state of the vector is ok.
 func (c *INDIClient) SetTextValue(deviceName, propName string, textNames, textValues []string) error {
+	return c.setTextValue(deviceName, propName, textNames, textValues, false, SetOptions{})
+}
+
+func (c *INDIClient) setTextValue(deviceName, propName string, textNames, textValues []string, dryRun bool, opts SetOptions) error {
+	deviceName = c.resolveDevice(deviceName)
+
 	if len(textNames) != len(textValues) {
-		return errors.New("len(textNames) must be equal to len(textValues)")
+		return c.rejected("SetTextValue", deviceName, propName, "", "", ErrValueCount)
 	}
+
+	busy := c.busyOptions(deviceName, propName, opts, dryRun)
+
 	c.rwm.Lock()
+	if err := c.checkAccess(deviceName, propName); err != nil {
+		c.rwm.Unlock()
+		return c.rejected("SetTextValue", deviceName, propName, "", "", err)
+	}
+
 	device, err := c.findDevice(deviceName)
 	if err != nil {
 		c.rwm.Unlock()
-		return err
+		return c.rejected("SetTextValue", deviceName, propName, "", "", err)
 	}
 
 	prop, ok := device.TextProperties[propName]
 	if !ok {
 		c.rwm.Unlock()
-		return ErrPropertyNotFound
+		return c.rejected("SetTextValue", deviceName, propName, "", "", ErrPropertyNotFound)
 	}
 
-	if prop.State == PropertyStateBusy {
+	if prop.State == PropertyStateBusy && busy.Policy == BusyPolicyReject {
 		c.rwm.Unlock()
-		return ErrPropertyStateBusy
+		return c.rejected("SetTextValue", deviceName, propName, "", prop.State, ErrPropertyStateBusy)
 	}
 
 	if prop.Permissions == PropertyPermissionReadOnly {
 		c.rwm.Unlock()
-		return ErrPropertyReadOnly
+		return c.rejected("SetTextValue", deviceName, propName, "", prop.State, ErrPropertyReadOnly)
 	}
 
 	for _, textName := range textNames {
 		_, ok = prop.Values[textName]
 		if !ok {
 			c.rwm.Unlock()
-			return ErrPropertyValueNotFound
+			return c.rejected("SetTextValue", deviceName, propName, textName, prop.State, ErrPropertyValueNotFound)
 		}
 	}
 
-	prop.State = PropertyStateBusy
-	
-	device.TextProperties[propName] = prop
-
-	c.devices[deviceName] = device
-
 	texts := []OneText{}
 	for index, name := range textNames {
 		texts = append(texts, OneText{
@@ -614,67 +1005,104 @@ func (c *INDIClient) SetTextValue(deviceName, propName string, textNames, textVa
 		Texts: texts,
 	}
 
+	if dryRun || c.dryRun {
+		c.rwm.Unlock()
+		return c.newDryRunError(cmd)
+	}
+
+	prop.State = PropertyStateBusy
+
+	device.TextProperties[propName] = prop
+
+	c.putProperty(deviceName, device, propName)
+
 	c.rwm.Unlock()
 
-	c.write <- cmd
-	
-	var state PropertyState
+	sent := c.now()
+	tx := c.startTransaction(opts.Context, "SetTextValue", cmd)
+
+	c.sendCommand(cmd)
+	tx.sent()
+
 	for {
 		c.rwm.RLock()
-		state = c.devices[deviceName].TextProperties[propName].State
+		p := c.devices[deviceName].TextProperties[propName]
+		abort := tx.abort
 		c.rwm.RUnlock()
-		if state == PropertyStateOk {
+		if abort != nil {
+			err := c.failed("SetTextValue", deviceName, propName, p.State, p.Messages, sent, abort)
+			c.endTransaction(tx, err)
+			return err
+		}
+		if p.State == PropertyStateOk {
 			break
 		}
-		if state == PropertyStateAlert {
-			return errors.New("Unable to set text property: " + prop.Name)
+		if p.State == PropertyStateAlert {
+			err := c.failed("SetTextValue", deviceName, propName, p.State, p.Messages, sent, ErrPropertyAlert)
+			c.endTransaction(tx, err)
+			return err
+		}
+		if c.timedOut(sent) {
+			err := c.failed("SetTextValue", deviceName, propName, p.State, p.Messages, sent, ErrCommandTimeout)
+			c.endTransaction(tx, err)
+			return err
 		}
 	}
 
+	c.endTransaction(tx, nil)
+
 	return nil
 }
 
 // SetNumberValue sends a command to the INDI server to change the value of a numberVector.
 func (c *INDIClient) SetNumberValue(deviceName, propName string, numberNames, numberValues []string) error {
+	return c.setNumberValue(deviceName, propName, numberNames, numberValues, false, SetOptions{})
+}
+
+func (c *INDIClient) setNumberValue(deviceName, propName string, numberNames, numberValues []string, dryRun bool, opts SetOptions) error {
+	deviceName = c.resolveDevice(deviceName)
+
 	if len(numberNames) != len(numberValues) {
-		return errors.New("len(numberNames) must be equal to len(numberValues)")
+		return c.rejected("SetNumberValue", deviceName, propName, "", "", ErrValueCount)
 	}
+
+	busy := c.busyOptions(deviceName, propName, opts, dryRun)
+
 	c.rwm.Lock()
+	if err := c.checkAccess(deviceName, propName); err != nil {
+		c.rwm.Unlock()
+		return c.rejected("SetNumberValue", deviceName, propName, "", "", err)
+	}
+
 	device, err := c.findDevice(deviceName)
 	if err != nil {
 		c.rwm.Unlock()
-		return err
+		return c.rejected("SetNumberValue", deviceName, propName, "", "", err)
 	}
 
 	prop, ok := device.NumberProperties[propName]
 	if !ok {
 		c.rwm.Unlock()
-		return ErrPropertyNotFound
+		return c.rejected("SetNumberValue", deviceName, propName, "", "", ErrPropertyNotFound)
 	}
 
-	if prop.State == PropertyStateBusy {
+	if prop.State == PropertyStateBusy && busy.Policy == BusyPolicyReject {
 		c.rwm.Unlock()
-		return ErrPropertyStateBusy
+		return c.rejected("SetNumberValue", deviceName, propName, "", prop.State, ErrPropertyStateBusy)
 	}
 
 	if prop.Permissions == PropertyPermissionReadOnly {
 		c.rwm.Unlock()
-		return ErrPropertyReadOnly
+		return c.rejected("SetNumberValue", deviceName, propName, "", prop.State, ErrPropertyReadOnly)
 	}
 	for _, numberName := range numberNames {
 		_, ok = prop.Values[numberName]
 		if !ok {
 			c.rwm.Unlock()
-			return ErrPropertyValueNotFound
+			return c.rejected("SetNumberValue", deviceName, propName, numberName, prop.State, ErrPropertyValueNotFound)
 		}
 	}
 
-	prop.State = PropertyStateBusy
-
-	device.NumberProperties[propName] = prop
-
-	c.devices[deviceName] = device
-
 	numbers := []OneNumber{}
 	for index, name := range numberNames {
 		numbers = append(numbers, OneNumber{
@@ -688,21 +1116,65 @@ func (c *INDIClient) SetNumberValue(deviceName, propName string, numberNames, nu
 		Name:   propName,
 		Numbers: numbers,
 	}
+
+	if dryRun || c.dryRun {
+		c.rwm.Unlock()
+		return c.newDryRunError(cmd)
+	}
+
+	prop.State = PropertyStateBusy
+
+	device.NumberProperties[propName] = prop
+
+	// Remembered for naming the BLOB files of the exposure.
+	if propName == "CCD_EXPOSURE" {
+		for index, name := range numberNames {
+			if name != "CCD_EXPOSURE_VALUE" {
+				continue
+			}
+
+			if v, err := ParseNumber(numberValues[index]); err == nil {
+				c.blobExposure[deviceName] = v
+			}
+		}
+	}
+
+	c.putProperty(deviceName, device, propName)
+
 	c.rwm.Unlock()
-	c.write <- cmd
-	var state PropertyState
+	sent := c.now()
+	tx := c.startTransaction(opts.Context, "SetNumberValue", cmd)
+
+	c.sendCommand(cmd)
+	tx.sent()
+
 	for {
 		c.rwm.RLock()
-		state = c.devices[deviceName].NumberProperties[propName].State
+		p := c.devices[deviceName].NumberProperties[propName]
+		abort := tx.abort
 		c.rwm.RUnlock()
-		if state == PropertyStateOk {
+		if abort != nil {
+			err := c.failed("SetNumberValue", deviceName, propName, p.State, p.Messages, sent, abort)
+			c.endTransaction(tx, err)
+			return err
+		}
+		if p.State == PropertyStateOk {
 			break
 		}
-		if state == PropertyStateAlert {
-			return errors.New("Unable to set number property: " + prop.Name)
+		if p.State == PropertyStateAlert {
+			err := c.failed("SetNumberValue", deviceName, propName, p.State, p.Messages, sent, ErrPropertyAlert)
+			c.endTransaction(tx, err)
+			return err
+		}
+		if c.timedOut(sent) {
+			err := c.failed("SetNumberValue", deviceName, propName, p.State, p.Messages, sent, ErrCommandTimeout)
+			c.endTransaction(tx, err)
+			return err
 		}
 	}
 
+	c.endTransaction(tx, nil)
+
 	return nil
 }
 
@@ -710,45 +1182,54 @@ func (c *INDIClient) SetNumberValue(deviceName, propName string, numberNames, nu
 // Note that you will ususally set the desired property on SwitchStateOn, and let the device
 // decide how to switch the other values off.
 func (c *INDIClient) SetSwitchValue(deviceName, propName string, switchNames []string, switchValues []SwitchState) error {
+	return c.setSwitchValue(deviceName, propName, switchNames, switchValues, false, SetOptions{})
+}
+
+func (c *INDIClient) setSwitchValue(deviceName, propName string, switchNames []string, switchValues []SwitchState, dryRun bool, opts SetOptions) error {
+	deviceName = c.resolveDevice(deviceName)
+
 	if len(switchNames) != len(switchValues) {
-		return errors.New("len(switchNames) must be equal to len(switchValues)")
+		return c.rejected("SetSwitchValue", deviceName, propName, "", "", ErrValueCount)
 	}
+
+	busy := c.busyOptions(deviceName, propName, opts, dryRun)
+
 	c.rwm.Lock()
+	if err := c.checkAccess(deviceName, propName); err != nil {
+		c.rwm.Unlock()
+		return c.rejected("SetSwitchValue", deviceName, propName, "", "", err)
+	}
+
 	device, err := c.findDevice(deviceName)
 	if err != nil {
-		return err
+		c.rwm.Unlock()
+		return c.rejected("SetSwitchValue", deviceName, propName, "", "", err)
 	}
 
 	prop, ok := device.SwitchProperties[propName]
 	if !ok {
 		c.rwm.Unlock()
-		return ErrPropertyNotFound
+		return c.rejected("SetSwitchValue", deviceName, propName, "", "", ErrPropertyNotFound)
 	}
 
-	if prop.State == PropertyStateBusy {
+	if prop.State == PropertyStateBusy && busy.Policy == BusyPolicyReject {
 		c.rwm.Unlock()
-		return ErrPropertyStateBusy
+		return c.rejected("SetSwitchValue", deviceName, propName, "", prop.State, ErrPropertyStateBusy)
 	}
 
 	if prop.Permissions == PropertyPermissionReadOnly {
 		c.rwm.Unlock()
-		return ErrPropertyReadOnly
+		return c.rejected("SetSwitchValue", deviceName, propName, "", prop.State, ErrPropertyReadOnly)
 	}
 
 	for _, switchName := range switchNames {
 		_, ok = prop.Values[switchName]
 		if !ok {
 			c.rwm.Unlock()
-			return ErrPropertyValueNotFound
+			return c.rejected("SetSwitchValue", deviceName, propName, switchName, prop.State, ErrPropertyValueNotFound)
 		}
 	}
 
-	prop.State = PropertyStateBusy
-
-	device.SwitchProperties[propName] = prop
-
-	c.devices[deviceName] = device
-
 	switches := []OneSwitch{}
 	for index, name := range switchNames {
 		switches = append(switches, OneSwitch{
@@ -761,63 +1242,100 @@ func (c *INDIClient) SetSwitchValue(deviceName, propName string, switchNames []s
 		Name:   propName,
 		Switches: switches,
 	}
+
+	if dryRun || c.dryRun {
+		c.rwm.Unlock()
+		return c.newDryRunError(cmd)
+	}
+
+	prop.State = PropertyStateBusy
+
+	device.SwitchProperties[propName] = prop
+
+	c.putProperty(deviceName, device, propName)
+
 	c.rwm.Unlock()
-	c.write <- cmd
+	sent := c.now()
+	tx := c.startTransaction(opts.Context, "SetSwitchValue", cmd)
+
+	c.sendCommand(cmd)
+	tx.sent()
 
-	var state PropertyState
 	for {
 		c.rwm.RLock()
-		state = c.devices[deviceName].SwitchProperties[propName].State
+		p := c.devices[deviceName].SwitchProperties[propName]
+		abort := tx.abort
 		c.rwm.RUnlock()
-		if state == PropertyStateOk {
+		if abort != nil {
+			err := c.failed("SetSwitchValue", deviceName, propName, p.State, p.Messages, sent, abort)
+			c.endTransaction(tx, err)
+			return err
+		}
+		if p.State == PropertyStateOk {
 			break
 		}
-		if state == PropertyStateAlert {
-			return errors.New("unable to set switch property: " + prop.Name)
+		if p.State == PropertyStateAlert {
+			err := c.failed("SetSwitchValue", deviceName, propName, p.State, p.Messages, sent, ErrPropertyAlert)
+			c.endTransaction(tx, err)
+			return err
+		}
+		if c.timedOut(sent) {
+			err := c.failed("SetSwitchValue", deviceName, propName, p.State, p.Messages, sent, ErrCommandTimeout)
+			c.endTransaction(tx, err)
+			return err
 		}
 	}
 
+	c.endTransaction(tx, nil)
+
 	return nil
 }
 
 
 // SetBlobValue sends a command to the INDI server to change the value of a blobVector.
 func (c *INDIClient) SetBlobValue(deviceName, propName, blobName, blobValue, blobFormat string, blobSize int) error {
+	return c.setBlobValue(deviceName, propName, blobName, blobValue, blobFormat, blobSize, false, SetOptions{})
+}
+
+func (c *INDIClient) setBlobValue(deviceName, propName, blobName, blobValue, blobFormat string, blobSize int, dryRun bool, opts SetOptions) error {
+	deviceName = c.resolveDevice(deviceName)
+
+	busy := c.busyOptions(deviceName, propName, opts, dryRun)
+
 	c.rwm.Lock()
+	if err := c.checkAccess(deviceName, propName); err != nil {
+		c.rwm.Unlock()
+		return c.rejected("SetBlobValue", deviceName, propName, "", "", err)
+	}
+
 	device, err := c.findDevice(deviceName)
 	if err != nil {
 		c.rwm.Unlock()
-		return err
+		return c.rejected("SetBlobValue", deviceName, propName, "", "", err)
 	}
 
 	prop, ok := device.BlobProperties[propName]
 	if !ok {
 		c.rwm.Unlock()
-		return ErrPropertyNotFound
+		return c.rejected("SetBlobValue", deviceName, propName, "", "", ErrPropertyNotFound)
 	}
 
-	if prop.State == PropertyStateBusy {
+	if prop.State == PropertyStateBusy && busy.Policy == BusyPolicyReject {
 		c.rwm.Unlock()
-		return ErrPropertyStateBusy
+		return c.rejected("SetBlobValue", deviceName, propName, "", prop.State, ErrPropertyStateBusy)
 	}
 
 	if prop.Permissions == PropertyPermissionReadOnly {
 		c.rwm.Unlock()
-		return ErrPropertyReadOnly
+		return c.rejected("SetBlobValue", deviceName, propName, "", prop.State, ErrPropertyReadOnly)
 	}
 
 	_, ok = prop.Values[blobName]
 	if !ok {
 		c.rwm.Unlock()
-		return ErrPropertyValueNotFound
+		return c.rejected("SetBlobValue", deviceName, propName, blobName, prop.State, ErrPropertyValueNotFound)
 	}
 
-	prop.State = PropertyStateBusy
-
-	device.BlobProperties[propName] = prop
-
-	c.devices[deviceName] = device
-	
 	cmd := NewBlobVector{
 		Device: deviceName,
 		Name:   propName,
@@ -831,22 +1349,51 @@ func (c *INDIClient) SetBlobValue(deviceName, propName, blobName, blobValue, blo
 		},
 	}
 
+	if dryRun || c.dryRun {
+		c.rwm.Unlock()
+		return c.newDryRunError(cmd)
+	}
+
+	prop.State = PropertyStateBusy
+
+	device.BlobProperties[propName] = prop
+
+	c.putProperty(deviceName, device, propName)
+
 	c.rwm.Unlock()
-	c.write <- cmd
+	sent := c.now()
+	tx := c.startTransaction(opts.Context, "SetBlobValue", cmd)
+
+	c.sendCommand(cmd)
+	tx.sent()
 
-	var state PropertyState
 	for {
 		c.rwm.RLock()
-		state = c.devices[deviceName].BlobProperties[propName].State
+		p := c.devices[deviceName].BlobProperties[propName]
+		abort := tx.abort
 		c.rwm.RUnlock()
-		if state == PropertyStateOk {
+		if abort != nil {
+			err := c.failed("SetBlobValue", deviceName, propName, p.State, p.Messages, sent, abort)
+			c.endTransaction(tx, err)
+			return err
+		}
+		if p.State == PropertyStateOk {
 			break
 		}
-		if state == PropertyStateAlert {
-			return errors.New("unable to set blob property: " + prop.Name)
+		if p.State == PropertyStateAlert {
+			err := c.failed("SetBlobValue", deviceName, propName, p.State, p.Messages, sent, ErrPropertyAlert)
+			c.endTransaction(tx, err)
+			return err
+		}
+		if c.timedOut(sent) {
+			err := c.failed("SetBlobValue", deviceName, propName, p.State, p.Messages, sent, ErrCommandTimeout)
+			c.endTransaction(tx, err)
+			return err
 		}
 	}
 
+	c.endTransaction(tx, nil)
+
 	return nil
 }
 
@@ -889,25 +1436,33 @@ type indiMessageHandler interface {
 	setBlobVector(item *SetBlobVector)
 	message(item *Message)
 	delProperty(item *DelProperty)
+	getProperties(item *GetProperties)
+	parseError(item *ParseError)
 }
 
 
 // Modifies INDIClient.devices. Only call when INDIClient.rwm is locked.
 func (c *INDIClient) defTextVector(item *DefTextVector) {
+	c.checkRestart(item.Device)
+
 	device := c.findOrCreateDevice(item.Device)
+	old, existed := device.TextProperties[item.Name]
 
 	prop := TextProperty{
-		Name:        item.Name,
-		Label:       item.Label,
-		Group:       item.Group,
-		Permissions: item.Perm,
-		State:       item.State,
-		Values:      map[string]TextValue{},
-		LastUpdated: time.Now(),
-		Messages:    []MessageJSON{},
+		Name:         item.Name,
+		Label:        item.Label,
+		Group:        item.Group,
+		Permissions:  item.Perm.normalize(),
+		State:        item.State,
+		Values:       map[string]TextValue{},
+		LastUpdated:  c.parseTimestamp(item.Timestamp),
+		RawTimestamp: item.Timestamp,
+		Messages:     []MessageJSON{},
 	}
 
 	for _, val := range item.Texts {
+		prop.Order = append(prop.Order, val.Name)
+
 		prop.Values[val.Name] = TextValue{
 			Label: val.Label,
 			Name:  val.Name,
@@ -915,35 +1470,60 @@ func (c *INDIClient) defTextVector(item *DefTextVector) {
 		}
 	}
 
+	// Keep the messages of an earlier definition.
+	prop.Messages = append(prop.Messages, old.Messages...)
+
 	if len(item.Message) > 0 {
-		prop.Messages = append(prop.Messages, MessageJSON{
+		prop.Messages = c.appendMessage(item.Device, prop.Messages, MessageJSON{
 			Message:   item.Message,
-			Timestamp: time.Now(),
+			Timestamp: c.now(),
 		})
 	}
 
 	device.TextProperties[item.Name] = prop
+	device.PropertyOrder = addPropertyOrder(device.PropertyOrder, item.Name)
+
+	c.putProperty(item.Device, device, item.Name)
+
+	c.emit(Event{
+		Type:     EventTypeDefine,
+		Device:   item.Device,
+		Property: item.Name,
+		State:    item.State,
+		Message:  item.Message,
+	})
+
+	if existed {
+		c.redefined(item.Device, item.Name, schemaOf(old), schemaOf(prop))
+	}
 
-	c.devices[item.Device] = device
+	c.updateDefinitionCache(item.Device, item.Name)
+	c.applyInitValues(item.Device)
 }
 
 // Modifies INDIClient.devices. Only call when INDIClient.rwm is locked.
 func (c *INDIClient) defSwitchVector(item *DefSwitchVector) {
+	c.checkRestart(item.Device)
+
 	device := c.findOrCreateDevice(item.Device)
+	old, existed := device.SwitchProperties[item.Name]
 
 	prop := SwitchProperty{
-		Name:        item.Name,
-		Label:       item.Label,
-		Group:       item.Group,
-		Permissions: item.Perm,
-		Rule:        item.Rule,
-		State:       item.State,
-		Values:      map[string]SwitchValue{},
-		LastUpdated: time.Now(),
-		Messages:    []MessageJSON{},
+		Name:         item.Name,
+		Label:        item.Label,
+		Group:        item.Group,
+		Permissions:  item.Perm.normalize(),
+		Rule:         item.Rule,
+		State:        item.State,
+		Values:       map[string]SwitchValue{},
+		LastUpdated:  c.parseTimestamp(item.Timestamp),
+		RawTimestamp: item.Timestamp,
+		Messages:     []MessageJSON{},
 	}
 
 	for _, val := range item.Switches {
+		prop.Order = append(prop.Order, val.Name)
+
 		prop.Values[val.Name] = SwitchValue{
 			Label: val.Label,
 			Name:  val.Name,
@@ -951,34 +1531,60 @@ func (c *INDIClient) defSwitchVector(item *DefSwitchVector) {
 		}
 	}
 
+	// Keep the messages of an earlier definition.
+	prop.Messages = append(prop.Messages, old.Messages...)
+
 	if len(item.Message) > 0 {
-		prop.Messages = append(prop.Messages, MessageJSON{
+		prop.Messages = c.appendMessage(item.Device, prop.Messages, MessageJSON{
 			Message:   item.Message,
-			Timestamp: time.Now(),
+			Timestamp: c.now(),
 		})
 	}
 
 	device.SwitchProperties[item.Name] = prop
+	device.PropertyOrder = addPropertyOrder(device.PropertyOrder, item.Name)
+
+	c.putProperty(item.Device, device, item.Name)
+
+	c.emit(Event{
+		Type:     EventTypeDefine,
+		Device:   item.Device,
+		Property: item.Name,
+		State:    item.State,
+		Message:  item.Message,
+	})
+
+	if existed {
+		c.redefined(item.Device, item.Name, schemaOf(old), schemaOf(prop))
+	}
 
-	c.devices[item.Device] = device
+	c.updateDefinitionCache(item.Device, item.Name)
+	c.applyInitValues(item.Device)
+	c.preferCompression(item.Device)
 }
 
 // Modifies INDIClient.devices. Only call when INDIClient.rwm is locked.
 func (c *INDIClient) defNumberVector(item *DefNumberVector) {
+	c.checkRestart(item.Device)
+
 	device := c.findOrCreateDevice(item.Device)
+	old, existed := device.NumberProperties[item.Name]
 
 	prop := NumberProperty{
-		Name:        item.Name,
-		Label:       item.Label,
-		Group:       item.Group,
-		Permissions: item.Perm,
-		State:       item.State,
-		Values:      map[string]NumberValue{},
-		LastUpdated: time.Now(),
-		Messages:    []MessageJSON{},
+		Name:         item.Name,
+		Label:        item.Label,
+		Group:        item.Group,
+		Permissions:  item.Perm.normalize(),
+		State:        item.State,
+		Values:       map[string]NumberValue{},
+		LastUpdated:  c.parseTimestamp(item.Timestamp),
+		RawTimestamp: item.Timestamp,
+		Messages:     []MessageJSON{},
 	}
 
 	for _, val := range item.Numbers {
+		prop.Order = append(prop.Order, val.Name)
+
 		prop.Values[val.Name] = NumberValue{
 			Label:  val.Label,
 			Name:   val.Name,
@@ -990,33 +1596,58 @@ func (c *INDIClient) defNumberVector(item *DefNumberVector) {
 		}
 	}
 
+	// Keep the messages of an earlier definition.
+	prop.Messages = append(prop.Messages, old.Messages...)
+
 	if len(item.Message) > 0 {
-		prop.Messages = append(prop.Messages, MessageJSON{
+		prop.Messages = c.appendMessage(item.Device, prop.Messages, MessageJSON{
 			Message:   item.Message,
-			Timestamp: time.Now(),
+			Timestamp: c.now(),
 		})
 	}
 
 	device.NumberProperties[item.Name] = prop
+	device.PropertyOrder = addPropertyOrder(device.PropertyOrder, item.Name)
+
+	c.putProperty(item.Device, device, item.Name)
+
+	c.emit(Event{
+		Type:     EventTypeDefine,
+		Device:   item.Device,
+		Property: item.Name,
+		State:    item.State,
+		Message:  item.Message,
+	})
+
+	if existed {
+		c.redefined(item.Device, item.Name, schemaOf(old), schemaOf(prop))
+	}
 
-	c.devices[item.Device] = device
+	c.updateDefinitionCache(item.Device, item.Name)
+	c.applyInitValues(item.Device)
 }
 
 // Modifies INDIClient.devices. Only call when INDIClient.rwm is locked.
 func (c *INDIClient) defLightVector(item *DefLightVector) {
+	c.checkRestart(item.Device)
+
 	device := c.findOrCreateDevice(item.Device)
+	old, existed := device.LightProperties[item.Name]
 
 	prop := LightProperty{
-		Name:        item.Name,
-		Label:       item.Label,
-		Group:       item.Group,
-		State:       item.State,
-		Values:      map[string]LightValue{},
-		LastUpdated: time.Now(),
-		Messages:    []MessageJSON{},
+		Name:         item.Name,
+		Label:        item.Label,
+		Group:        item.Group,
+		State:        item.State,
+		Values:       map[string]LightValue{},
+		LastUpdated:  c.parseTimestamp(item.Timestamp),
+		RawTimestamp: item.Timestamp,
+		Messages:     []MessageJSON{},
 	}
 
 	for _, val := range item.Lights {
+		prop.Order = append(prop.Order, val.Name)
+
 		prop.Values[val.Name] = LightValue{
 			Label: val.Label,
 			Name:  val.Name,
@@ -1024,49 +1655,101 @@ func (c *INDIClient) defLightVector(item *DefLightVector) {
 		}
 	}
 
+	// Keep the messages of an earlier definition.
+	prop.Messages = append(prop.Messages, old.Messages...)
+
 	if len(item.Message) > 0 {
-		prop.Messages = append(prop.Messages, MessageJSON{
+		prop.Messages = c.appendMessage(item.Device, prop.Messages, MessageJSON{
 			Message:   item.Message,
-			Timestamp: time.Now(),
+			Timestamp: c.now(),
 		})
 	}
 
 	device.LightProperties[item.Name] = prop
+	device.PropertyOrder = addPropertyOrder(device.PropertyOrder, item.Name)
+
+	c.putProperty(item.Device, device, item.Name)
+
+	c.emit(Event{
+		Type:     EventTypeDefine,
+		Device:   item.Device,
+		Property: item.Name,
+		State:    item.State,
+		Message:  item.Message,
+	})
+
+	if existed {
+		c.redefined(item.Device, item.Name, schemaOf(old), schemaOf(prop))
+	}
 
-	c.devices[item.Device] = device
+	c.updateDefinitionCache(item.Device, item.Name)
+	c.applyInitValues(item.Device)
 }
 
 // Modifies INDIClient.devices. Only call when INDIClient.rwm is locked.
 func (c *INDIClient) defBlobVector(item *DefBlobVector) {
+	c.checkRestart(item.Device)
+
 	device := c.findOrCreateDevice(item.Device)
+	old, existed := device.BlobProperties[item.Name]
 
 	prop := BlobProperty{
-		Name:        item.Name,
-		Label:       item.Label,
-		Group:       item.Group,
-		State:       item.State,
-		Values:      map[string]BlobValue{},
-		LastUpdated: time.Now(),
-		Messages:    []MessageJSON{},
+		Name:         item.Name,
+		Label:        item.Label,
+		Group:        item.Group,
+		Permissions:  item.Perm.normalize(),
+		State:        item.State,
+		Values:       map[string]BlobValue{},
+		LastUpdated:  c.parseTimestamp(item.Timestamp),
+		RawTimestamp: item.Timestamp,
+		Messages:     []MessageJSON{},
 	}
 
 	for _, val := range item.Blobs {
+		prop.Order = append(prop.Order, val.Name)
+
+		// BLOBs already received are kept, since a definition carries no data.
+		if v, ok := old.Values[val.Name]; ok {
+			v.Label = val.Label
+			prop.Values[val.Name] = v
+			continue
+		}
+
 		prop.Values[val.Name] = BlobValue{
 			Label: val.Label,
 			Name:  val.Name,
 		}
 	}
 
+	// Keep the messages of an earlier definition.
+	prop.Messages = append(prop.Messages, old.Messages...)
+
 	if len(item.Message) > 0 {
-		prop.Messages = append(prop.Messages, MessageJSON{
+		prop.Messages = c.appendMessage(item.Device, prop.Messages, MessageJSON{
 			Message:   item.Message,
-			Timestamp: time.Now(),
+			Timestamp: c.now(),
 		})
 	}
 
 	device.BlobProperties[item.Name] = prop
+	device.PropertyOrder = addPropertyOrder(device.PropertyOrder, item.Name)
+
+	c.putProperty(item.Device, device, item.Name)
+
+	c.emit(Event{
+		Type:     EventTypeDefine,
+		Device:   item.Device,
+		Property: item.Name,
+		State:    item.State,
+		Message:  item.Message,
+	})
+
+	if existed {
+		c.redefined(item.Device, item.Name, schemaOf(old), schemaOf(prop))
+	}
 
-	c.devices[item.Device] = device
+	c.updateDefinitionCache(item.Device, item.Name)
+	c.applyInitValues(item.Device)
 }
 
 // Modifies INDIClient.devices. Only call when INDIClient.rwm is locked.
@@ -1088,17 +1771,8 @@ func (c *INDIClient) setSwitchVector(item *SetSwitchVector) {
 	prop.State = item.State
 	prop.Timeout = item.Timeout
 
-	if len(item.Timestamp) == 0 {
-		prop.LastUpdated = time.Now()
-	} else {
-		var err error
-		prop.LastUpdated, err = time.ParseInLocation("2006-01-02T15:04:05.9", item.Timestamp, time.UTC)
-
-		if err != nil {
-			c.log.WithField("timestamp", item.Timestamp).WithError(err).Warn("error in time.ParseInLocation")
-			prop.LastUpdated = time.Now()
-		}
-	}
+	prop.LastUpdated = c.parseTimestamp(item.Timestamp)
+	prop.RawTimestamp = item.Timestamp
 
 	for _, val := range item.Switches {
 		v, ok := prop.Values[val.Name]
@@ -1112,15 +1786,26 @@ func (c *INDIClient) setSwitchVector(item *SetSwitchVector) {
 	}
 
 	if len(item.Message) > 0 {
-		prop.Messages = append(prop.Messages, MessageJSON{
+		prop.Messages = c.appendMessage(item.Device, prop.Messages, MessageJSON{
 			Message:   item.Message,
-			Timestamp: time.Now(),
+			Timestamp: c.now(),
 		})
 	}
 
 	device.SwitchProperties[item.Name] = prop
 
-	c.devices[item.Device] = device
+	c.putProperty(item.Device, device, item.Name)
+
+	c.traceState(item.Device, item.Name, item.State, item.Message)
+	c.checkLease(item.Device, item.Name, item.State, item.Message)
+
+	c.emit(Event{
+		Type:     EventTypeUpdate,
+		Device:   item.Device,
+		Property: item.Name,
+		State:    item.State,
+		Message:  item.Message,
+	})
 }
 
 // Modifies INDIClient.devices. Only call when INDIClient.rwm is locked.
@@ -1142,17 +1827,8 @@ func (c *INDIClient) setTextVector(item *SetTextVector) {
 	prop.State = item.State
 	prop.Timeout = item.Timeout
 
-	if len(item.Timestamp) == 0 {
-		prop.LastUpdated = time.Now()
-	} else {
-		var err error
-		prop.LastUpdated, err = time.ParseInLocation("2006-01-02T15:04:05.9", item.Timestamp, time.UTC)
-
-		if err != nil {
-			c.log.WithField("timestamp", item.Timestamp).WithError(err).Warn("error in time.ParseInLocation")
-			prop.LastUpdated = time.Now()
-		}
-	}
+	prop.LastUpdated = c.parseTimestamp(item.Timestamp)
+	prop.RawTimestamp = item.Timestamp
 
 	for _, val := range item.Texts {
 		v, ok := prop.Values[val.Name]
@@ -1166,15 +1842,26 @@ func (c *INDIClient) setTextVector(item *SetTextVector) {
 	}
 
 	if len(item.Message) > 0 {
-		prop.Messages = append(prop.Messages, MessageJSON{
+		prop.Messages = c.appendMessage(item.Device, prop.Messages, MessageJSON{
 			Message:   item.Message,
-			Timestamp: time.Now(),
+			Timestamp: c.now(),
 		})
 	}
 
 	device.TextProperties[item.Name] = prop
 
-	c.devices[item.Device] = device
+	c.putProperty(item.Device, device, item.Name)
+
+	c.traceState(item.Device, item.Name, item.State, item.Message)
+	c.checkLease(item.Device, item.Name, item.State, item.Message)
+
+	c.emit(Event{
+		Type:     EventTypeUpdate,
+		Device:   item.Device,
+		Property: item.Name,
+		State:    item.State,
+		Message:  item.Message,
+	})
 }
 
 // Modifies INDIClient.devices. Only call when INDIClient.rwm is locked.
@@ -1196,17 +1883,8 @@ func (c *INDIClient) setNumberVector(item *SetNumberVector) {
 	prop.State = item.State
 	prop.Timeout = item.Timeout
 
-	if len(item.Timestamp) == 0 {
-		prop.LastUpdated = time.Now()
-	} else {
-		var err error
-		prop.LastUpdated, err = time.ParseInLocation("2006-01-02T15:04:05.9", item.Timestamp, time.UTC)
-
-		if err != nil {
-			c.log.WithField("timestamp", item.Timestamp).WithError(err).Warn("error in time.ParseInLocation")
-			prop.LastUpdated = time.Now()
-		}
-	}
+	prop.LastUpdated = c.parseTimestamp(item.Timestamp)
+	prop.RawTimestamp = item.Timestamp
 
 	for _, val := range item.Numbers {
 		v, ok := prop.Values[val.Name]
@@ -1221,15 +1899,26 @@ func (c *INDIClient) setNumberVector(item *SetNumberVector) {
 
 	if len(item.Message) > 0 {
 		fmt.Println(item.Message)
-		prop.Messages = append(prop.Messages, MessageJSON{
+		prop.Messages = c.appendMessage(item.Device, prop.Messages, MessageJSON{
 			Message:   item.Message,
-			Timestamp: time.Now(),
+			Timestamp: c.now(),
 		})
 	}
 
 	device.NumberProperties[item.Name] = prop
 
-	c.devices[item.Device] = device
+	c.putProperty(item.Device, device, item.Name)
+
+	c.traceState(item.Device, item.Name, item.State, item.Message)
+	c.checkLease(item.Device, item.Name, item.State, item.Message)
+
+	c.emit(Event{
+		Type:     EventTypeUpdate,
+		Device:   item.Device,
+		Property: item.Name,
+		State:    item.State,
+		Message:  item.Message,
+	})
 }
 
 // Modifies INDIClient.devices. Only call when INDIClient.rwm is locked.
@@ -1250,17 +1939,8 @@ func (c *INDIClient) setLightVector(item *SetLightVector) {
 
 	prop.State = item.State
 
-	if len(item.Timestamp) == 0 {
-		prop.LastUpdated = time.Now()
-	} else {
-		var err error
-		prop.LastUpdated, err = time.ParseInLocation("2006-01-02T15:04:05.9", item.Timestamp, time.UTC)
-
-		if err != nil {
-			c.log.WithField("timestamp", item.Timestamp).WithError(err).Warn("error in time.ParseInLocation")
-			prop.LastUpdated = time.Now()
-		}
-	}
+	prop.LastUpdated = c.parseTimestamp(item.Timestamp)
+	prop.RawTimestamp = item.Timestamp
 
 	for _, val := range item.Lights {
 		v, ok := prop.Values[val.Name]
@@ -1274,133 +1954,99 @@ func (c *INDIClient) setLightVector(item *SetLightVector) {
 	}
 
 	if len(item.Message) > 0 {
-		prop.Messages = append(prop.Messages, MessageJSON{
+		prop.Messages = c.appendMessage(item.Device, prop.Messages, MessageJSON{
 			Message:   item.Message,
-			Timestamp: time.Now(),
+			Timestamp: c.now(),
 		})
 	}
 
 	device.LightProperties[item.Name] = prop
 
-	c.devices[item.Device] = device
+	c.putProperty(item.Device, device, item.Name)
+
+	c.traceState(item.Device, item.Name, item.State, item.Message)
+	c.checkLease(item.Device, item.Name, item.State, item.Message)
+
+	c.emit(Event{
+		Type:     EventTypeUpdate,
+		Device:   item.Device,
+		Property: item.Name,
+		State:    item.State,
+		Message:  item.Message,
+	})
 }
 
 
-// Modifies INDIClient.devices. Only call when INDIClient.rwm is locked.
+// setBlobVector decodes, stores and applies item on the calling goroutine. See SetBlobWorkers. Modifies
+// INDIClient.devices. Only call when INDIClient.rwm is locked.
 func (c *INDIClient) setBlobVector(item *SetBlobVector) {
-	device, err := c.findDevice(item.Device)
-	if err != nil {
-		c.log.WithField("device", item.Device).WithError(err).Warn("could not find device")
-		return
-	}
-
-	var prop BlobProperty
-	if p, ok := device.BlobProperties[item.Name]; ok {
-		prop = p
-	} else {
-		c.log.WithField("device", item.Device).WithField("property", item.Name).Warn("could not find property")
+	job := c.newBlobJob(item)
+	if job == nil {
 		return
 	}
 
-	prop.State = item.State
-	prop.Timeout = item.Timeout
-
-	if len(item.Timestamp) == 0 {
-		prop.LastUpdated = time.Now()
-	} else {
-		var err error
-		prop.LastUpdated, err = time.ParseInLocation("2006-01-02T15:04:05.9", item.Timestamp, time.UTC)
-
-		if err != nil {
-			c.log.WithField("timestamp", item.Timestamp).WithError(err).Warn("error in time.ParseInLocation")
-			prop.LastUpdated = time.Now()
-		}
-	}
-
-	for _, val := range item.Blobs {
-		v, ok := prop.Values[val.Name]
-		if !ok {
-			continue
-		}
-
-		fname := fmt.Sprintf("%s_%s_%s%s", item.Device, item.Name, val.Name, val.Format)
-
-		f, err := c.fs.OpenFile(fname, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-		if err != nil {
-			c.log.WithField("file", fname).WithError(err).Warn("error in c.fs.OpenFile")
-			continue
-		}
-
-		var writers []io.Writer
-
-		if ws, ok := c.blobStreams.Load(fmt.Sprintf("%s_%s_%s", item.Device, item.Name, val.Name)); ok {
-			wss := ws.(map[string]io.Writer)
-
-			for _, w := range wss {
-				writers = append(writers, w)
-			}
-		}
-
-		writers = append(writers, f)
-
-		val.Value = strings.TrimSpace(val.Value)
-		r := base64.NewDecoder(base64.StdEncoding, strings.NewReader(val.Value))
-
-		dest := io.MultiWriter(writers...)
-
-		written, err := io.Copy(dest, r)
-		if err != nil {
-			c.log.WithError(err).Warn("error in io.Copy")
-			continue
-		}
-
-		v.Value = f.Name()
-		v.Size = written
-
-		f.Close()
-
-		prop.Values[val.Name] = v
-	}
+	c.decodeBlobs(job)
+	c.prepareBlobs(job)
+	c.writeBlobs(job)
+	c.applyBlobJob(job)
+}
 
-	if len(item.Message) > 0 {
-		prop.Messages = append(prop.Messages, MessageJSON{
+func (c *INDIClient) message(item *Message) {
+	if len(item.Device) == 0 {
+		c.serverMessages = c.appendMessage("", c.serverMessages, MessageJSON{
 			Message:   item.Message,
-			Timestamp: time.Now(),
+			Timestamp: c.now(),
 		})
-	}
-
-	device.BlobProperties[item.Name] = prop
 
-	c.devices[item.Device] = device
-}
+		c.emit(Event{
+			Type:    EventTypeMessage,
+			Message: item.Message,
+		})
+		return
+	}
 
-func (c *INDIClient) message(item *Message) {
 	device, err := c.findDevice(item.Device)
 	if err != nil {
 		c.log.WithField("device", item.Device).WithError(err).Warn("could not find device")
 		return
 	}
 
-	device.Messages = append(device.Messages, MessageJSON{
+	device.Messages = c.appendMessage(item.Device, device.Messages, MessageJSON{
 		Message:   item.Message,
-		Timestamp: time.Now(),
+		Timestamp: c.now(),
 	})
 
-	c.devices[item.Device] = device
+	c.putDevice(item.Device, device)
+
+	c.emit(Event{
+		Type:    EventTypeMessage,
+		Device:  item.Device,
+		Message: item.Message,
+	})
 }
 
 // Modifies INDIClient.devices must only be called in locked environment
 func (c *INDIClient) delProperty(item *DelProperty) {
 	if len(item.Device) == 0 {
 		for key, _ := range c.devices {
-			delete(c.devices, key)
+			c.removeDevice(key)
 			return
 		}
 		return
 	}
 
+	c.abortTransactions(item.Device, item.Name, ErrPropertyDeleted)
+
 	if len(item.Name) == 0 {
-		delete(c.devices, item.Device)
+		c.removeDevice(item.Device)
+		c.deviceDeleted(item.Device)
+		c.forgetDevice(item.Device)
+
+		c.emit(Event{
+			Type:    EventTypeDelete,
+			Device:  item.Device,
+			Message: item.Message,
+		})
 		return
 	}
 
@@ -1411,17 +2057,44 @@ func (c *INDIClient) delProperty(item *DelProperty) {
 	delete(device.SwitchProperties, item.Name)
 	delete(device.LightProperties, item.Name)
 	delete(device.BlobProperties, item.Name)
+	device.PropertyOrder = removePropertyOrder(device.PropertyOrder, item.Name)
 
-	c.devices[item.Device] = device
+	c.putProperty(item.Device, device, item.Name)
+
+	c.emit(Event{
+		Type:     EventTypeDelete,
+		Device:   item.Device,
+		Property: item.Name,
+		Message:  item.Message,
+	})
 }
 
-func (c *INDIClient) startRead() {
+func (c *INDIClient) startRead(s *session, codec Codec) {
+	s.loops.Add(2)
+
+	workers := c.startBlobWorkers(s)
+
 	go func(r <-chan interface{}, log logging.Logger, lock *sync.RWMutex, handler indiMessageHandler) {
-		for i := range r {
-			log.WithField("item", i).Debug("got message")
+		defer s.loops.Done()
+
+		if workers != nil {
+			defer workers.stop()
+		}
+
+		dispatch := func(msg interface{}) {
+			var job *blobJob
 
 			lock.Lock()
-			switch item := i.(type) {
+			if deviceName, _, ok := messageTarget(msg); ok {
+				c.deviceActive(deviceName)
+			}
+
+			if !c.filterInterest(msg) {
+				lock.Unlock()
+				return
+			}
+
+			switch item := msg.(type) {
 			case *DefTextVector:
 				handler.defTextVector(item)
 			case *DefSwitchVector:
@@ -1441,113 +2114,171 @@ func (c *INDIClient) startRead() {
 			case *SetLightVector:
 				handler.setLightVector(item)
 			case *SetBlobVector:
-				handler.setBlobVector(item)
+				if workers != nil {
+					job = c.newBlobJob(item)
+				} else {
+					handler.setBlobVector(item)
+				}
 			case *Message:
 				handler.message(item)
 			case *DelProperty:
 				handler.delProperty(item)
+			case *GetProperties:
+				handler.getProperties(item)
+			case *ParseError:
+				handler.parseError(item)
 			default:
 				log.WithField("type", fmt.Sprintf("%T", item)).Warn("unknown type")
 			}
 			lock.Unlock()
+
+			// Queued after unlocking, as the worker may be waiting for the lock.
+			if job != nil {
+				workers.queue(job)
+			}
+		}
+
+		for i := range r {
+			if req, ok := i.(reconnectRequest); ok {
+				// Reconnecting closes r, so it cannot happen on this goroutine. It is part of this connection's loops, so Run
+				// sees the new connection once they have finished.
+				s.loops.Add(1)
+				go func(err *ParseError) {
+					defer s.loops.Done()
+					c.reconnect(s, err)
+				}(req.err)
+				continue
+			}
+
+			log.WithField("item", i).Debug("got message")
+
+			c.inboundHandler(dispatch)(i)
+
+			releaseMessage(i)
 		}
-	}(c.read, c.log, c.rwm, c)
+	}(s.read, c.log, c.rwm, c)
 
 	go func(conn io.Reader, r chan<- interface{}, log logging.Logger) {
-		decoder := xml.NewDecoder(conn)
+		defer s.loops.Done()
+		// Only this goroutine sends on r, so only it may close it.
+		defer close(r)
+
+		p := newParser(conn, c.parserLimits, c.parseMode)
+		p.lr.limiter = c.blobLimiter
+		p.capture = &c.rawCount
+
+		// failures counts malformed messages in a row, for ResyncOptions.ReconnectAfter.
+		failures := 0
 
-		var inElement string
 		for {
-			t, err := decoder.Token()
+			item, err := p.next()
 			if err != nil {
-				if strings.Contains(err.Error(), "use of closed network connection") {
+				if perr, ok := err.(*ParseError); ok {
+					c.notifyRaw(p.raw, perr)
+
+					if perr.Err == ErrUnknownElement {
+						log.WithField("element", perr.Element).Error("unknown element")
+					} else {
+						log.WithField("element", perr.Element).WithError(perr.Err).Error("error parsing message, skipping to next message")
+						failures++
+						c.stats.decodeError()
+					}
+
+					if p.mode != ParseModeLenient || perr.Skipped > 0 {
+						// Deliver in order with the messages around it.
+						r <- perr
+					}
+
+					if c.tooManyFailures(failures) {
+						log.WithField("failures", failures).Warn("too many malformed messages, reconnecting")
+						// Reconnect once the messages already read have been handled.
+						r <- reconnectRequest{err: perr}
+						return
+					}
+					continue
+				}
+
+				closed := strings.Contains(err.Error(), "use of closed network connection") || err == io.ErrClosedPipe
+				if closed && s.ended() {
 					// We've disconnected.
 					return
 				}
 
-				log.WithError(err).Warn("error in decoder.Token")
+				log.WithError(err).Warn("error reading from connection")
 
-				if err == io.EOF {
-					c.Disconnect()
-					return
-				}
-				continue
+				c.disconnect(s, ErrConnectionLost)
+				return
 			}
 
-			var item interface{}
-
-			switch se := t.(type) {
-			case xml.StartElement:
-				log.WithField("startElement", se.Name.Local).Debug("read start element")
-
-				var inner interface{}
-				inElement = se.Name.Local
-				switch inElement {
-				case "defSwitchVector":
-					inner = &DefSwitchVector{}
-				case "defTextVector":
-					inner = &DefTextVector{}
-				case "defNumberVector":
-					inner = &DefNumberVector{}
-				case "defLightVector":
-					inner = &DefLightVector{}
-				case "defBLOBVector":
-					inner = &DefBlobVector{}
-				case "setSwitchVector":
-					inner = &SetSwitchVector{}
-				case "setTextVector":
-					inner = &SetTextVector{}
-				case "setNumberVector":
-					inner = &SetNumberVector{}
-				case "setLightVector":
-					inner = &SetLightVector{}
-				case "setBLOBVector":
-					inner = &SetBlobVector{}
-				case "message":
-					inner = &Message{}
-				case "delProperty":
-					inner = &DelProperty{}
-				default:
-					log.WithField("element", inElement).Error("unknown element")
-				}
+			log.WithField("item", fmt.Sprintf("%T", item)).Debug("read message")
 
-				if inner != nil {
-					err = decoder.DecodeElement(&inner, &se)
-					if err != nil {
-						log.WithField("element", inElement).WithError(err).Error("error in decoder.DecodeElement")
-						continue
-					}
+			failures = 0
+			c.stats.received(item)
 
-					item = inner
-				}
+			if sb, ok := item.(*SetBlobVector); ok {
+				c.fetchBlobURLs(sb)
 			}
 
-			if item != nil {
-				r <- item
-			}
+			c.notifyRaw(p.raw, item)
+
+			r <- item
 		}
-	}(c.conn, c.read, c.log)
+	}(codec.Decoder(c.stats.reader(s.conn)), s.read, c.log)
 }
 
-func (c *INDIClient) startWrite() {
-	go func(conn io.Writer, w chan interface{}, log logging.Logger, lock *sync.RWMutex, handler indiMessageHandler) {
-		for item := range w {
+func (c *INDIClient) startWrite(s *session, w <-chan interface{}, codec Codec) {
+	s.loops.Add(1)
+
+	go func(conn io.Writer, log logging.Logger, lock *sync.RWMutex, handler indiMessageHandler) {
+		defer s.loops.Done()
+
+		send := func(msg interface{}) {
 			lock.Lock()
-			b, err := xml.Marshal(item)
+			defer lock.Unlock()
+
+			b, err := marshalCommand(msg)
 			if err != nil {
 				log.WithError(err).Error("error in xml.Marshal")
-				lock.Unlock()
-				continue
+				return
 			}
 
 			log.WithField("cmd", string(b)).Debug("sending command")
-			_, err = conn.Write(b)
+
+			b, err = codec.Encode(b)
+			if err != nil {
+				log.WithError(err).Error("error encoding command")
+				return
+			}
+
+			n, err := conn.Write(b)
 			if err != nil {
 				log.WithError(err).Error("error in conn.Write")
-				lock.Unlock()
-				continue
 			}
-			lock.Unlock()
+
+			c.stats.sent(msg, n)
+		}
+
+		for {
+			select {
+			case item := <-w:
+				if req, ok := item.(flushRequest); ok {
+					close(req.done)
+					continue
+				}
+
+				c.outboundHandler(send)(item)
+			case <-s.done:
+				return
+			}
 		}
-	}(c.conn, c.write, c.log, c.rwm, c)
+	}(s.conn, c.log, c.rwm, c)
+}
+
+// marshalCommand returns the XML the write loop sends for msg: a RawCommand as it is, and anything else marshalled.
+func marshalCommand(msg interface{}) ([]byte, error) {
+	if raw, ok := msg.(RawCommand); ok {
+		return raw.XML, nil
+	}
+
+	return xml.Marshal(msg)
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -35,12 +36,15 @@ func (m *mockDialer) Dial(network, address string) (io.ReadWriteCloser, error) {
 }
 
 type mockConnection struct {
-	w *bytes.Buffer
-	r *bytes.Buffer
+	mu sync.Mutex
+	w  *bytes.Buffer
+	r  *bytes.Buffer
 }
 
 func (m *mockConnection) Read(p []byte) (n int, err error) {
+	m.mu.Lock()
 	n, err = m.r.Read(p)
+	m.mu.Unlock()
 
 	if err == io.EOF {
 		for {
@@ -53,9 +57,20 @@ func (m *mockConnection) Read(p []byte) (n int, err error) {
 }
 
 func (m *mockConnection) Write(p []byte) (n int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	return m.w.Write(p)
 }
 
+// written returns what the client has written so far.
+func (m *mockConnection) written() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.w.String()
+}
+
 func (m *mockConnection) Close() error {
 	return nil
 }
@@ -162,7 +177,7 @@ func Test_GetProperties(t *testing.T) {
 
 	time.Sleep(1 * time.Second) // Wait for the client to write the xml
 
-	result := w.String()
+	result := conn.written()
 
 	assert.Equal(t, "<getProperties version=\"1.7\"></getProperties>", result)
 
@@ -294,7 +309,7 @@ func Test_EnableBlob_Success(t *testing.T) {
 
 	time.Sleep(1 * time.Second) // Wait for the client to write the xml
 
-	result := w.String()
+	result := conn.written()
 
 	assert.Equal(t, "<enableBLOB device=\"device1\" name=\"\">Also</enableBLOB>", result)
 
@@ -528,11 +543,11 @@ func Example_singleClient() {
 	// Print the names of all the devices we found.
 	devices := client.Devices()
 	for _, device := range devices {
-		println(device.Name)
+		println(device)
 	}
 
 	// Connect to our ASI224MC camera.
-	err = client.SetSwitchValue("ZWO CCD ASI224MC", "CONNECTION", "CONNECT", indiclient.SwitchStateOn)
+	err = client.SetSwitchValue("ZWO CCD ASI224MC", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
 	if err != nil {
 		panic(err.Error())
 	}
@@ -544,7 +559,7 @@ func Example_singleClient() {
 	}
 
 	// Take a 10 second exposure.
-	err = client.SetNumberValue("ZWO CCD ASI224MC", "CCD_EXPOSURE", "CCD_EXPOSURE_VALUE", "10")
+	err = client.SetNumberValue("ZWO CCD ASI224MC", "CCD_EXPOSURE", []string{"CCD_EXPOSURE_VALUE"}, []string{"10"})
 	if err != nil {
 		panic(err.Error())
 	}
@@ -596,11 +611,11 @@ func Example_multipleClients() {
 	// Print the names of all the devices we found.
 	devices := client.Devices()
 	for _, device := range devices {
-		println(device.Name)
+		println(device)
 	}
 
 	// Connect to our ASI224MC camera.
-	err = client.SetSwitchValue("ZWO CCD ASI224MC", "CONNECTION", "CONNECT", indiclient.SwitchStateOn)
+	err = client.SetSwitchValue("ZWO CCD ASI224MC", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
 	if err != nil {
 		panic(err.Error())
 	}
@@ -631,7 +646,7 @@ func Example_multipleClients() {
 	}
 
 	// Take a 10 second exposure. We send this on the control client.
-	err = client.SetNumberValue("ZWO CCD ASI224MC", "CCD_EXPOSURE", "CCD_EXPOSURE_VALUE", "10")
+	err = client.SetNumberValue("ZWO CCD ASI224MC", "CCD_EXPOSURE", []string{"CCD_EXPOSURE_VALUE"}, []string{"10"})
 	if err != nil {
 		panic(err.Error())
 	}
@@ -690,7 +705,7 @@ func ExampleINDIClient_SetSwitchValue_connect() {
 	time.Sleep(2 * time.Second)
 
 	// Connect to our ASI224MC camera.
-	err = client.SetSwitchValue("ZWO CCD ASI224MC", "CONNECTION", "CONNECT", indiclient.SwitchStateOn)
+	err = client.SetSwitchValue("ZWO CCD ASI224MC", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
 	if err != nil {
 		panic(err.Error())
 	}
@@ -699,7 +714,7 @@ func ExampleINDIClient_SetSwitchValue_connect() {
 	time.Sleep(2 * time.Second)
 
 	// Notice that we are not setting "CONNECT" to SwitchStateOff, but instead setting "DISCONNECT" to SwitchStateOn.
-	err = client.SetSwitchValue("ZWO CCD ASI224MC", "CONNECTION", "DISCONNECT", indiclient.SwitchStateOn)
+	err = client.SetSwitchValue("ZWO CCD ASI224MC", "CONNECTION", []string{"DISCONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
 	if err != nil {
 		panic(err.Error())
 	}
@@ -0,0 +1,809 @@
+// Package indidriver implements the device side of the INDI protocol, so INDI drivers can be written in Go using the
+// same XML types as indiclient.
+//
+// A Driver hosts one or more devices. Define their properties, register handlers for the commands clients send, and
+// serve the driver over stdio as indiserver expects:
+//
+//	d := indidriver.New(log)
+//	d.DefineSwitch(indiclient.DefSwitchVector{Device: "My Focuser", Name: "CONNECTION", ...})
+//	d.OnNewSwitch("My Focuser", "CONNECTION", func(cmd indiclient.NewSwitchVector) {
+//		d.SetSwitch(indiclient.SetSwitchVector{Device: "My Focuser", Name: "CONNECTION", State: indiclient.PropertyStateOk, ...})
+//	})
+//	err := d.ServeStdio()
+//
+// Drivers can also be served over TCP with ServeListener, for clients that connect to them directly.
+package indidriver
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rickbassham/logging"
+
+	"github.com/goastro/indiclient"
+)
+
+var (
+	// ErrPropertyExists is returned when a property is defined twice with different types.
+	ErrPropertyExists = errors.New("property already defined with a different type")
+)
+
+// Driver hosts INDI devices. It stores the current definition and values of every property, so it can answer
+// getProperties at any time, and sends changes to all connected clients. A Driver is safe for concurrent use.
+type Driver struct {
+	log logging.Logger
+
+	mu       sync.Mutex
+	props    []interface{} // def*Vector pointers, in the order they were defined
+	handlers map[string]func(cmd interface{})
+	sessions map[*session]bool
+}
+
+// New creates a Driver with no properties.
+func New(log logging.Logger) *Driver {
+	return &Driver{
+		log:      log,
+		handlers: map[string]func(cmd interface{}){},
+		sessions: map[*session]bool{},
+	}
+}
+
+// DefineText defines (or redefines) a text property and sends it to connected clients.
+func (d *Driver) DefineText(v indiclient.DefTextVector) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+
+	v.Texts = append([]indiclient.DefText{}, v.Texts...)
+
+	return d.define(v.Device, v.Name, &v, &v.Timestamp)
+}
+
+// DefineNumber defines (or redefines) a number property and sends it to connected clients.
+func (d *Driver) DefineNumber(v indiclient.DefNumberVector) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+
+	v.Numbers = append([]indiclient.DefNumber{}, v.Numbers...)
+
+	return d.define(v.Device, v.Name, &v, &v.Timestamp)
+}
+
+// DefineSwitch defines (or redefines) a switch property and sends it to connected clients.
+func (d *Driver) DefineSwitch(v indiclient.DefSwitchVector) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+
+	v.Switches = append([]indiclient.DefSwitch{}, v.Switches...)
+
+	return d.define(v.Device, v.Name, &v, &v.Timestamp)
+}
+
+// DefineLight defines (or redefines) a light property and sends it to connected clients.
+func (d *Driver) DefineLight(v indiclient.DefLightVector) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+
+	v.Lights = append([]indiclient.DefLight{}, v.Lights...)
+
+	return d.define(v.Device, v.Name, &v, &v.Timestamp)
+}
+
+// DefineBlob defines (or redefines) a BLOB property and sends it to connected clients.
+func (d *Driver) DefineBlob(v indiclient.DefBlobVector) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+
+	v.Blobs = append([]indiclient.DefBlob{}, v.Blobs...)
+
+	return d.define(v.Device, v.Name, &v, &v.Timestamp)
+}
+
+func (d *Driver) define(device, name string, def interface{}, ts *string) error {
+	if len(*ts) == 0 {
+		*ts = timestamp()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if i := d.find(device, name); i >= 0 {
+		if !sameType(d.props[i], def) {
+			return ErrPropertyExists
+		}
+		d.props[i] = def
+	} else {
+		d.props = append(d.props, def)
+	}
+
+	d.broadcast(device, def, false)
+
+	return nil
+}
+
+// SetText sends new values for a text property to connected clients. Only the elements in v are changed.
+func (d *Driver) SetText(v indiclient.SetTextVector) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	def, err := d.findDef(v.Device, v.Name)
+	if err != nil {
+		return err
+	}
+
+	prop, ok := def.(*indiclient.DefTextVector)
+	if !ok {
+		return indiclient.ErrPropertyNotFound
+	}
+
+	updated := *prop
+	updated.Texts = append([]indiclient.DefText{}, prop.Texts...)
+
+	for _, t := range v.Texts {
+		i := elementIndex(len(updated.Texts), func(i int) string { return updated.Texts[i].Name }, t.Name)
+		if i < 0 {
+			return indiclient.ErrPropertyValueNotFound
+		}
+		updated.Texts[i].Value = t.Value
+	}
+
+	setCommon(&v.State, &v.Timestamp, &updated.State, &updated.Timestamp)
+	updated.Timeout = v.Timeout
+	*prop = updated
+
+	d.broadcast(v.Device, &v, false)
+
+	return nil
+}
+
+// SetNumber sends new values for a number property to connected clients. Only the elements in v are changed.
+func (d *Driver) SetNumber(v indiclient.SetNumberVector) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	def, err := d.findDef(v.Device, v.Name)
+	if err != nil {
+		return err
+	}
+
+	prop, ok := def.(*indiclient.DefNumberVector)
+	if !ok {
+		return indiclient.ErrPropertyNotFound
+	}
+
+	updated := *prop
+	updated.Numbers = append([]indiclient.DefNumber{}, prop.Numbers...)
+
+	for _, n := range v.Numbers {
+		i := elementIndex(len(updated.Numbers), func(i int) string { return updated.Numbers[i].Name }, n.Name)
+		if i < 0 {
+			return indiclient.ErrPropertyValueNotFound
+		}
+		updated.Numbers[i].Value = n.Value
+	}
+
+	setCommon(&v.State, &v.Timestamp, &updated.State, &updated.Timestamp)
+	updated.Timeout = v.Timeout
+	*prop = updated
+
+	d.broadcast(v.Device, &v, false)
+
+	return nil
+}
+
+// SetSwitch sends new values for a switch property to connected clients. Only the elements in v are changed.
+func (d *Driver) SetSwitch(v indiclient.SetSwitchVector) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	def, err := d.findDef(v.Device, v.Name)
+	if err != nil {
+		return err
+	}
+
+	prop, ok := def.(*indiclient.DefSwitchVector)
+	if !ok {
+		return indiclient.ErrPropertyNotFound
+	}
+
+	updated := *prop
+	updated.Switches = append([]indiclient.DefSwitch{}, prop.Switches...)
+
+	for _, s := range v.Switches {
+		i := elementIndex(len(updated.Switches), func(i int) string { return updated.Switches[i].Name }, s.Name)
+		if i < 0 {
+			return indiclient.ErrPropertyValueNotFound
+		}
+		updated.Switches[i].Value = s.Value
+	}
+
+	setCommon(&v.State, &v.Timestamp, &updated.State, &updated.Timestamp)
+	updated.Timeout = v.Timeout
+	*prop = updated
+
+	d.broadcast(v.Device, &v, false)
+
+	return nil
+}
+
+// SetLight sends new values for a light property to connected clients. Only the elements in v are changed.
+func (d *Driver) SetLight(v indiclient.SetLightVector) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	def, err := d.findDef(v.Device, v.Name)
+	if err != nil {
+		return err
+	}
+
+	prop, ok := def.(*indiclient.DefLightVector)
+	if !ok {
+		return indiclient.ErrPropertyNotFound
+	}
+
+	updated := *prop
+	updated.Lights = append([]indiclient.DefLight{}, prop.Lights...)
+
+	for _, l := range v.Lights {
+		i := elementIndex(len(updated.Lights), func(i int) string { return updated.Lights[i].Name }, l.Name)
+		if i < 0 {
+			return indiclient.ErrPropertyValueNotFound
+		}
+		updated.Lights[i].Value = l.Value
+	}
+
+	setCommon(&v.State, &v.Timestamp, &updated.State, &updated.Timestamp)
+	*prop = updated
+
+	d.broadcast(v.Device, &v, false)
+
+	return nil
+}
+
+// SetBlob sends BLOBs to the clients that enabled them with enableBLOB. Use Blob to encode each OneBlob.
+func (d *Driver) SetBlob(v indiclient.SetBlobVector) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	def, err := d.findDef(v.Device, v.Name)
+	if err != nil {
+		return err
+	}
+
+	prop, ok := def.(*indiclient.DefBlobVector)
+	if !ok {
+		return indiclient.ErrPropertyNotFound
+	}
+
+	for _, b := range v.Blobs {
+		i := elementIndex(len(prop.Blobs), func(i int) string { return prop.Blobs[i].Name }, b.Name)
+		if i < 0 {
+			return indiclient.ErrPropertyValueNotFound
+		}
+	}
+
+	setCommon(&v.State, &v.Timestamp, &prop.State, &prop.Timestamp)
+	prop.Timeout = v.Timeout
+
+	d.broadcast(v.Device, &v, true)
+
+	return nil
+}
+
+// Blob encodes data as a OneBlob for SetBlob. format is the file name suffix, e.g. ".fits".
+func Blob(name, format string, data []byte) indiclient.OneBlob {
+	return indiclient.OneBlob{
+		Name:   name,
+		Size:   len(data),
+		Format: format,
+		Value:  base64.StdEncoding.EncodeToString(data),
+	}
+}
+
+// Message sends a message from device to connected clients. An empty device sends a message from the driver itself.
+func (d *Driver) Message(device, message string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.broadcast(device, &indiclient.Message{
+		Device:    device,
+		Timestamp: timestamp(),
+		Message:   message,
+	}, false)
+}
+
+// Delete removes a property, or every property of device if name is empty, and tells connected clients.
+func (d *Driver) Delete(device, name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	props := d.props[:0]
+	for _, p := range d.props {
+		dev, n := propertyName(p)
+		if dev == device && (len(name) == 0 || n == name) {
+			continue
+		}
+		props = append(props, p)
+	}
+	d.props = props
+
+	d.broadcast(device, &indiclient.DelProperty{
+		Device:    device,
+		Name:      name,
+		Timestamp: timestamp(),
+	}, false)
+}
+
+// OnNewText registers fn to be called when a client sends newTextVector for device.name. Handlers are called one at a
+// time on the goroutine reading from the client's connection, so they should not block for long.
+func (d *Driver) OnNewText(device, name string, fn func(cmd indiclient.NewTextVector)) {
+	d.handle(device, name, func(cmd interface{}) {
+		if v, ok := cmd.(*indiclient.NewTextVector); ok {
+			fn(*v)
+		}
+	})
+}
+
+// OnNewNumber registers fn to be called when a client sends newNumberVector for device.name. Use indiclient.ParseNumber
+// to read the values, which may be sexagesimal.
+func (d *Driver) OnNewNumber(device, name string, fn func(cmd indiclient.NewNumberVector)) {
+	d.handle(device, name, func(cmd interface{}) {
+		if v, ok := cmd.(*indiclient.NewNumberVector); ok {
+			fn(*v)
+		}
+	})
+}
+
+// OnNewSwitch registers fn to be called when a client sends newSwitchVector for device.name.
+func (d *Driver) OnNewSwitch(device, name string, fn func(cmd indiclient.NewSwitchVector)) {
+	d.handle(device, name, func(cmd interface{}) {
+		if v, ok := cmd.(*indiclient.NewSwitchVector); ok {
+			fn(*v)
+		}
+	})
+}
+
+// OnNewBlob registers fn to be called when a client sends newBLOBVector for device.name. The values are still base64
+// encoded.
+func (d *Driver) OnNewBlob(device, name string, fn func(cmd indiclient.NewBlobVector)) {
+	d.handle(device, name, func(cmd interface{}) {
+		if v, ok := cmd.(*indiclient.NewBlobVector); ok {
+			fn(*v)
+		}
+	})
+}
+
+func (d *Driver) handle(device, name string, fn func(cmd interface{})) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.handlers[handlerKey(device, name)] = fn
+}
+
+// ServeStdio serves the driver on stdin and stdout, as indiserver runs drivers. It returns when stdin is closed.
+// BLOBs are always sent, since indiserver never sends its drivers enableBLOB, and decides itself which clients get
+// them.
+func (d *Driver) ServeStdio() error {
+	return d.serve(stdio{in: os.Stdin, out: os.Stdout}, indiclient.BlobEnableAlso)
+}
+
+// ServeListener serves every connection accepted on l until l is closed.
+func (d *Driver) ServeListener(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			if err := d.Serve(conn); err != nil {
+				d.log.WithError(err).Warn("error serving connection")
+			}
+		}()
+	}
+}
+
+// Serve serves the driver on a single connection. It returns when the connection is closed, returning nil if the
+// other end closed it. Like indiserver, it only sends BLOBs once the client has asked for them with enableBLOB.
+func (d *Driver) Serve(rw io.ReadWriteCloser) error {
+	return d.serve(rw, indiclient.BlobEnableNever)
+}
+
+// serve serves the driver on rw, sending BLOBs as blobMode until the other end sends enableBLOB.
+func (d *Driver) serve(rw io.ReadWriteCloser, blobMode indiclient.BlobEnable) error {
+	s := &session{
+		driver:   d,
+		rw:       rw,
+		blobs:    map[string]indiclient.BlobEnable{},
+		blobMode: blobMode,
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	d.mu.Lock()
+	d.sessions[s] = true
+	d.mu.Unlock()
+
+	go s.writeLoop()
+
+	err := s.readLoop()
+
+	s.close()
+
+	if err == io.EOF {
+		return nil
+	}
+
+	return err
+}
+
+func (d *Driver) dispatch(s *session, cmd interface{}) {
+	switch item := cmd.(type) {
+	case *indiclient.GetProperties:
+		d.getProperties(s, item)
+		return
+	case *indiclient.EnableBlob:
+		s.mu.Lock()
+		s.blobs[blobKey(item.Device, item.Name)] = indiclient.BlobEnable(strings.TrimSpace(string(item.Value)))
+		s.mu.Unlock()
+		return
+	}
+
+	device, name := commandName(cmd)
+
+	d.mu.Lock()
+	fn, ok := d.handlers[handlerKey(device, name)]
+	d.mu.Unlock()
+
+	if !ok {
+		d.log.WithField("device", device).WithField("property", name).Warn("no handler for command")
+		return
+	}
+
+	fn(cmd)
+}
+
+func (d *Driver) getProperties(s *session, item *indiclient.GetProperties) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, p := range d.props {
+		device, name := propertyName(p)
+
+		if len(item.Device) > 0 && item.Device != device {
+			continue
+		}
+
+		if len(item.Name) > 0 && item.Name != name {
+			continue
+		}
+
+		s.send(device, name, p, false)
+	}
+}
+
+// Only call when Driver.mu is locked.
+func (d *Driver) broadcast(device string, item interface{}, isBlob bool) {
+	_, name := propertyName(item)
+
+	for s := range d.sessions {
+		s.send(device, name, item, isBlob)
+	}
+}
+
+// Only call when Driver.mu is locked.
+func (d *Driver) find(device, name string) int {
+	for i, p := range d.props {
+		dev, n := propertyName(p)
+		if dev == device && n == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Only call when Driver.mu is locked.
+func (d *Driver) findDef(device, name string) (interface{}, error) {
+	i := d.find(device, name)
+	if i < 0 {
+		return nil, indiclient.ErrPropertyNotFound
+	}
+
+	return d.props[i], nil
+}
+
+func (d *Driver) remove(s *session) {
+	d.mu.Lock()
+	delete(d.sessions, s)
+	d.mu.Unlock()
+}
+
+// maxQueue is the number of elements that can be waiting for a client before it is disconnected.
+const maxQueue = 10000
+
+// session is a single client connection, or indiserver itself when serving over stdio. Outgoing elements are queued
+// so that the driver never blocks on a slow client.
+type session struct {
+	driver *Driver
+	rw     io.ReadWriteCloser
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []interface{}
+	closed bool
+	blobs  map[string]indiclient.BlobEnable
+	// blobMode applies to the BLOBs of devices the other end has not sent enableBLOB for.
+	blobMode indiclient.BlobEnable
+}
+
+func (s *session) send(device, name string, item interface{}, isBlob bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	mode, ok := s.blobs[blobKey(device, name)]
+	if !ok {
+		mode, ok = s.blobs[blobKey(device, "")]
+	}
+
+	if !ok {
+		mode = s.blobMode
+	}
+
+	if isBlob && mode != indiclient.BlobEnableAlso && mode != indiclient.BlobEnableOnly {
+		return
+	}
+
+	if !isBlob && mode == indiclient.BlobEnableOnly {
+		return
+	}
+
+	if len(s.queue) >= maxQueue {
+		// The client has stopped reading. Disconnect it, as indiserver does, rather than queue without limit. close
+		// takes Driver.mu, which our callers hold, so it has to run on its own goroutine.
+		s.driver.log.WithField("queued", len(s.queue)).Warn("client is not reading, disconnecting it")
+
+		s.closed = true
+		s.queue = nil
+		s.cond.Signal()
+
+		go s.close()
+
+		return
+	}
+
+	s.queue = append(s.queue, item)
+	s.cond.Signal()
+}
+
+func (s *session) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Signal()
+	s.mu.Unlock()
+
+	s.driver.remove(s)
+	s.rw.Close()
+}
+
+func (s *session) writeLoop() {
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+
+		item := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		b, err := xml.Marshal(item)
+		if err != nil {
+			s.driver.log.WithError(err).Error("error in xml.Marshal")
+			continue
+		}
+
+		if _, err := s.rw.Write(b); err != nil {
+			s.driver.log.WithError(err).Warn("error in Write")
+			s.close()
+			return
+		}
+	}
+}
+
+func (s *session) readLoop() error {
+	decoder := xml.NewDecoder(s.rw)
+
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		se, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		var cmd interface{}
+
+		switch se.Name.Local {
+		case "getProperties":
+			cmd = &indiclient.GetProperties{}
+		case "enableBLOB":
+			cmd = &indiclient.EnableBlob{}
+		case "newTextVector":
+			cmd = &indiclient.NewTextVector{}
+		case "newNumberVector":
+			cmd = &indiclient.NewNumberVector{}
+		case "newSwitchVector":
+			cmd = &indiclient.NewSwitchVector{}
+		case "newBLOBVector":
+			cmd = &indiclient.NewBlobVector{}
+		default:
+			decoder.Skip()
+			continue
+		}
+
+		if err := decoder.DecodeElement(cmd, &se); err != nil {
+			s.driver.log.WithField("element", se.Name.Local).WithError(err).Warn("error decoding command")
+			continue
+		}
+
+		s.driver.dispatch(s, cmd)
+	}
+}
+
+// stdio joins stdin and stdout into a single connection.
+type stdio struct {
+	in  io.Reader
+	out io.Writer
+}
+
+func (s stdio) Read(p []byte) (int, error)  { return s.in.Read(p) }
+func (s stdio) Write(p []byte) (int, error) { return s.out.Write(p) }
+func (stdio) Close() error                  { return nil }
+
+// setCommon fills in the state and timestamp of a set*Vector from the stored definition if they are empty, and
+// stores them otherwise.
+func setCommon(state *indiclient.PropertyState, ts *string, defState *indiclient.PropertyState, defTs *string) {
+	if len(*state) == 0 {
+		*state = *defState
+	}
+
+	if len(*ts) == 0 {
+		*ts = timestamp()
+	}
+
+	*defState = *state
+	*defTs = *ts
+}
+
+func elementIndex(n int, name func(i int) string, want string) int {
+	for i := 0; i < n; i++ {
+		if name(i) == want {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func sameType(a, b interface{}) bool {
+	switch a.(type) {
+	case *indiclient.DefTextVector:
+		_, ok := b.(*indiclient.DefTextVector)
+		return ok
+	case *indiclient.DefNumberVector:
+		_, ok := b.(*indiclient.DefNumberVector)
+		return ok
+	case *indiclient.DefSwitchVector:
+		_, ok := b.(*indiclient.DefSwitchVector)
+		return ok
+	case *indiclient.DefLightVector:
+		_, ok := b.(*indiclient.DefLightVector)
+		return ok
+	case *indiclient.DefBlobVector:
+		_, ok := b.(*indiclient.DefBlobVector)
+		return ok
+	}
+
+	return false
+}
+
+func propertyName(item interface{}) (device, name string) {
+	switch v := item.(type) {
+	case *indiclient.DefTextVector:
+		return v.Device, v.Name
+	case *indiclient.DefNumberVector:
+		return v.Device, v.Name
+	case *indiclient.DefSwitchVector:
+		return v.Device, v.Name
+	case *indiclient.DefLightVector:
+		return v.Device, v.Name
+	case *indiclient.DefBlobVector:
+		return v.Device, v.Name
+	case *indiclient.SetTextVector:
+		return v.Device, v.Name
+	case *indiclient.SetNumberVector:
+		return v.Device, v.Name
+	case *indiclient.SetSwitchVector:
+		return v.Device, v.Name
+	case *indiclient.SetLightVector:
+		return v.Device, v.Name
+	case *indiclient.SetBlobVector:
+		return v.Device, v.Name
+	case *indiclient.DelProperty:
+		return v.Device, v.Name
+	case *indiclient.Message:
+		return v.Device, ""
+	}
+
+	return "", ""
+}
+
+func commandName(cmd interface{}) (device, name string) {
+	switch v := cmd.(type) {
+	case *indiclient.NewTextVector:
+		return v.Device, v.Name
+	case *indiclient.NewNumberVector:
+		return v.Device, v.Name
+	case *indiclient.NewSwitchVector:
+		return v.Device, v.Name
+	case *indiclient.NewBlobVector:
+		return v.Device, v.Name
+	}
+
+	return "", ""
+}
+
+func handlerKey(device, name string) string {
+	return device + "." + name
+}
+
+func blobKey(device, name string) string {
+	return device + "." + name
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05")
+}
@@ -0,0 +1,266 @@
+package indidriver_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/indidriver"
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+// driverDialer connects clients to a Driver over an in-memory pipe.
+type driverDialer struct {
+	d *indidriver.Driver
+}
+
+func (dd driverDialer) Dial(network, address string) (io.ReadWriteCloser, error) {
+	client, server := net.Pipe()
+	go dd.d.Serve(server)
+
+	return client, nil
+}
+
+func newDriver(t *testing.T) (*indidriver.Driver, *indiclient.INDIClient) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	d := indidriver.New(log)
+
+	require.NoError(t, d.DefineSwitch(indiclient.DefSwitchVector{
+		Device: "Dome", Name: "DOME_SHUTTER", Label: "Shutter", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Rule: indiclient.SwitchRuleOneOfMany,
+		Switches: []indiclient.DefSwitch{
+			{Name: "SHUTTER_OPEN", Label: "Open", Value: indiclient.SwitchStateOff},
+			{Name: "SHUTTER_CLOSE", Label: "Close", Value: indiclient.SwitchStateOn},
+		},
+	}))
+
+	require.NoError(t, d.DefineBlob(indiclient.DefBlobVector{
+		Device: "Dome", Name: "SNAPSHOT", Label: "Snapshot", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadOnly,
+		Blobs: []indiclient.DefBlob{{Name: "IMAGE", Label: "Image"}},
+	}))
+
+	d.OnNewSwitch("Dome", "DOME_SHUTTER", func(cmd indiclient.NewSwitchVector) {
+		set := indiclient.SetSwitchVector{Device: "Dome", Name: "DOME_SHUTTER", State: indiclient.PropertyStateOk}
+		for _, s := range cmd.Switches {
+			set.Switches = append(set.Switches, indiclient.OneSwitch{Name: s.Name, Value: s.Value})
+		}
+		require.NoError(t, d.SetSwitch(set))
+	})
+
+	c := indiclient.NewINDIClient(log, driverDialer{d}, afero.NewMemMapFs(), 100)
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	require.NoError(t, c.GetProperties("", ""))
+
+	testutil.WaitFor(t, func() bool {
+		return c.SwitchPropertySet("Dome", "DOME_SHUTTER") && c.BlobPropertySet("Dome", "SNAPSHOT")
+	})
+
+	return d, c
+}
+
+func Test_Driver_Commands(t *testing.T) {
+	_, c := newDriver(t)
+	defer c.Disconnect()
+
+	err := c.SelectSwitch("Dome", "DOME_SHUTTER", "SHUTTER_OPEN")
+	require.NoError(t, err)
+
+	v, err := c.GetSwitch("Dome", "DOME_SHUTTER", "SHUTTER_OPEN")
+	require.NoError(t, err)
+	assert.Equal(t, indiclient.SwitchStateOn, v.Value)
+
+	// New clients see the current values.
+	c.Disconnect()
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	require.NoError(t, c.GetProperties("Dome", ""))
+
+	testutil.WaitFor(t, func() bool { return c.SwitchPropertySet("Dome", "DOME_SHUTTER") })
+
+	v, err = c.GetSwitch("Dome", "DOME_SHUTTER", "SHUTTER_OPEN")
+	require.NoError(t, err)
+	assert.Equal(t, indiclient.SwitchStateOn, v.Value)
+}
+
+func Test_Driver_Blob(t *testing.T) {
+	d, c := newDriver(t)
+	defer c.Disconnect()
+
+	require.NoError(t, c.EnableBlob("Dome", "", indiclient.BlobEnableAlso))
+
+	blobs := make(chan indiclient.BlobEvent, 1)
+	_, err := c.OnBlob("Dome", "SNAPSHOT", "IMAGE", func(e indiclient.BlobEvent) { blobs <- e })
+	require.NoError(t, err)
+
+	data := []byte("not really a jpeg")
+
+	// enableBLOB may still be in flight, so keep sending until one arrives.
+	testutil.WaitFor(t, func() bool {
+		err := d.SetBlob(indiclient.SetBlobVector{
+			Device: "Dome", Name: "SNAPSHOT", State: indiclient.PropertyStateOk,
+			Blobs: []indiclient.OneBlob{indidriver.Blob("IMAGE", ".jpg", data)},
+		})
+		require.NoError(t, err)
+
+		select {
+		case e := <-blobs:
+			b, _ := ioutil.ReadAll(e.Open())
+			return e.Format == ".jpg" && bytes.Equal(data, b)
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	})
+}
+
+func Test_Driver_ServeStdio_Blob(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	d := indidriver.New(log)
+
+	require.NoError(t, d.DefineBlob(indiclient.DefBlobVector{
+		Device: "Dome", Name: "SNAPSHOT", State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadOnly,
+		Blobs: []indiclient.DefBlob{{Name: "IMAGE"}},
+	}))
+
+	// indiserver talks to the driver over its stdin and stdout, and never sends it enableBLOB.
+	stdinR, stdinW, err := os.Pipe()
+	require.NoError(t, err)
+	stdoutR, stdoutW, err := os.Pipe()
+	require.NoError(t, err)
+	defer stdoutR.Close()
+
+	stdin, stdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdinR, stdoutW
+
+	done := make(chan error, 1)
+	go func() { done <- d.ServeStdio() }()
+
+	defer func() {
+		stdinW.Close()
+		<-done
+		os.Stdin, os.Stdout = stdin, stdout
+		stdoutW.Close()
+	}()
+
+	// Once the session has started, it answers getProperties.
+	_, err = stdinW.Write([]byte(`<getProperties version="1.7"/>`))
+	require.NoError(t, err)
+
+	require.NoError(t, stdoutR.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	var wire []byte
+	buf := make([]byte, 4096)
+
+	for !bytes.Contains(wire, []byte("</defBLOBVector>")) {
+		n, err := stdoutR.Read(buf)
+		require.NoError(t, err)
+		wire = append(wire, buf[:n]...)
+	}
+
+	require.NoError(t, d.SetBlob(indiclient.SetBlobVector{
+		Device: "Dome", Name: "SNAPSHOT", State: indiclient.PropertyStateOk,
+		Blobs: []indiclient.OneBlob{indidriver.Blob("IMAGE", ".jpg", []byte("not really a jpeg"))},
+	}))
+
+	for !bytes.Contains(wire, []byte("</setBLOBVector>")) {
+		n, err := stdoutR.Read(buf)
+		require.NoError(t, err)
+		wire = append(wire, buf[:n]...)
+	}
+
+	assert.Contains(t, string(wire), `format=".jpg"`)
+}
+
+func Test_Driver_Message(t *testing.T) {
+	d, c := newDriver(t)
+	defer c.Disconnect()
+
+	events, id, err := c.Subscribe(indiclient.SubscribeOptions{Device: "Dome", Property: "DOME_SHUTTER", Types: []indiclient.EventType{indiclient.EventTypeUpdate}})
+	require.NoError(t, err)
+	defer c.Unsubscribe(id)
+
+	// A raw connection shows what the driver puts on the wire.
+	client, server := net.Pipe()
+	defer client.Close()
+	go d.Serve(server)
+
+	_, err = client.Write([]byte(`<getProperties version="1.7" device="Dome" name="DOME_SHUTTER"/>`))
+	require.NoError(t, err)
+
+	require.NoError(t, d.SetSwitch(indiclient.SetSwitchVector{
+		Device: "Dome", Name: "DOME_SHUTTER", State: indiclient.PropertyStateBusy, Message: "Shutter opening",
+		Switches: []indiclient.OneSwitch{{Name: "SHUTTER_OPEN", Value: indiclient.SwitchStateOn}},
+	}))
+
+	var wire []byte
+	buf := make([]byte, 4096)
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	for !bytes.Contains(wire, []byte("</setSwitchVector>")) {
+		n, err := client.Read(buf)
+		require.NoError(t, err)
+		wire = append(wire, buf[:n]...)
+	}
+
+	assert.Contains(t, string(wire), ` message="Shutter opening"`)
+	assert.NotContains(t, string(wire), "<message>")
+
+	select {
+	case e := <-events:
+		assert.Equal(t, "Shutter opening", e.Message)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the update")
+	}
+}
+
+func Test_Driver_SlowClient(t *testing.T) {
+	d, c := newDriver(t)
+	defer c.Disconnect()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go d.Serve(server)
+
+	// Ask for the properties over and over without reading the answers, until the driver hangs up.
+	var err error
+	for i := 0; i < 100000 && err == nil; i++ {
+		_, err = io.WriteString(client, `<getProperties version="1.7"/>`)
+	}
+
+	assert.Error(t, err, "a client that never reads should be disconnected")
+}
+
+func Test_Driver_Errors(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	d := indidriver.New(log)
+
+	text, err := indiclient.DefineText("D", "X", "X", "Main", indiclient.PropertyPermissionReadWrite, indiclient.DefText{Name: "A"})
+	require.NoError(t, err)
+
+	missing := text
+	missing.Device = ""
+	assert.True(t, errors.Is(d.DefineText(missing), indiclient.ErrMissingAttribute))
+
+	empty := text
+	empty.Texts = nil
+	assert.True(t, errors.Is(d.DefineText(empty), indiclient.ErrNoElements))
+
+	require.NoError(t, d.DefineText(text))
+
+	light, err := indiclient.DefineLight("D", "X", "X", "Main", indiclient.DefLight{Name: "A", Value: indiclient.PropertyStateIdle})
+	require.NoError(t, err)
+	assert.Equal(t, indidriver.ErrPropertyExists, d.DefineLight(light))
+
+	assert.Equal(t, indiclient.ErrPropertyNotFound, d.SetNumber(indiclient.SetNumberVector{Device: "D", Name: "X", Numbers: []indiclient.OneNumber{{Name: "A", Value: "1"}}}))
+	assert.Equal(t, indiclient.ErrPropertyValueNotFound, d.SetText(indiclient.SetTextVector{Device: "D", Name: "X", Texts: []indiclient.OneText{{Name: "B"}}}))
+}
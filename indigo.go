@@ -0,0 +1,39 @@
+package indiclient
+
+// INDIGOProtocolVersion is the version of the protocol INDIGO servers speak with clients that ask for its extensions,
+// such as BlobEnableURL.
+const INDIGOProtocolVersion = "2.0"
+
+// INDIGOOptions controls compatibility with INDIGO servers, which speak a superset of INDI.
+type INDIGOOptions struct {
+	// Enabled makes the client ask for INDIGOProtocolVersion in getProperties, unless SetProtocolVersion set another
+	// version, and allows BlobEnableURL. The BLOBs are fetched as set with SetBlobFetch.
+	Enabled bool
+}
+
+// SetINDIGO sets the options for INDIGO servers. The protocol version takes effect on the next call to GetProperties.
+// JSONCodec can be used with INDIGO servers that speak JSON, but INDIGO's WebSocket transport is not supported.
+func (c *INDIClient) SetINDIGO(opts INDIGOOptions) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.indigo = opts
+}
+
+// INDIGO returns the options set with SetINDIGO.
+func (c *INDIClient) INDIGO() INDIGOOptions {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.indigo
+}
+
+// clientVersion returns the version of the protocol to send in getProperties. Only call when INDIClient.rwm is at
+// least reader locked.
+func (c *INDIClient) clientVersion() string {
+	if c.indigo.Enabled && c.protocolVersion == DefaultProtocolVersion {
+		return INDIGOProtocolVersion
+	}
+
+	return c.protocolVersion
+}
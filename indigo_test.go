@@ -0,0 +1,38 @@
+package indiclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_INDIGO_Version(t *testing.T) {
+	c := newTestClient()
+
+	c.SetINDIGO(INDIGOOptions{Enabled: true})
+	assert.True(t, c.INDIGO().Enabled)
+	assert.Equal(t, INDIGOProtocolVersion, c.ClientProtocolVersion())
+
+	out, err := c.DryRunGetProperties("", "")
+	require.NoError(t, err)
+	assert.Equal(t, `<getProperties version="2.0"></getProperties>`, out)
+
+	// An explicit version wins.
+	c.SetProtocolVersion("1.9")
+	assert.Equal(t, "1.9", c.ClientProtocolVersion())
+}
+
+func Test_INDIGO_BlobEnableURL(t *testing.T) {
+	c := newTestClient()
+	defineBlob(c)
+
+	_, err := c.DryRunEnableBlob("Camera", "CCD1", BlobEnableURL)
+	assert.Equal(t, ErrInvalidBlobEnable, err)
+
+	c.SetINDIGO(INDIGOOptions{Enabled: true})
+
+	out, err := c.DryRunEnableBlob("Camera", "CCD1", BlobEnableURL)
+	require.NoError(t, err)
+	assert.Equal(t, `<enableBLOB device="Camera" name="CCD1">URL</enableBLOB>`, out)
+}
@@ -0,0 +1,58 @@
+package indiclient
+
+// Handler handles a single message passing through the client. Inbound, it is one of the pointer types the parser
+// produces, such as *DefNumberVector, *SetNumberVector, *Message or *ParseError. Outbound, it is one of the command
+// types, such as GetProperties, EnableBlob, NewNumberVector or RawCommand, by value.
+type Handler func(msg interface{})
+
+// Interceptor wraps the next Handler in a chain. It may inspect or log msg, pass a changed or entirely different
+// message to next, or not call next at all to drop it.
+//
+// Inbound messages may be reused once the chain returns, so an interceptor must not hold on to them; copy what it
+// needs instead. Dropping an outbound new*Vector leaves the Set*Value call that sent it waiting for the device to
+// answer, so return an error from the caller instead where possible.
+type Interceptor func(next Handler) Handler
+
+// UseInbound adds interceptors to the chain every message from indiserver passes through before it updates the
+// device tree. The first interceptor added sees each message first. Interceptors run on the client's read goroutine,
+// one message at a time, without the client locked, so they may call its methods to read the device tree.
+func (c *INDIClient) UseInbound(interceptors ...Interceptor) {
+	c.interceptorMu.Lock()
+	defer c.interceptorMu.Unlock()
+
+	c.inbound = append(c.inbound, interceptors...)
+}
+
+// UseOutbound adds interceptors to the chain every command to indiserver passes through before it is written to the
+// connection. The first interceptor added sees each command first. Interceptors run on the client's write goroutine,
+// one command at a time, without the client locked.
+func (c *INDIClient) UseOutbound(interceptors ...Interceptor) {
+	c.interceptorMu.Lock()
+	defer c.interceptorMu.Unlock()
+
+	c.outbound = append(c.outbound, interceptors...)
+}
+
+// inboundHandler returns h wrapped in the inbound interceptors.
+func (c *INDIClient) inboundHandler(h Handler) Handler {
+	c.interceptorMu.RLock()
+	defer c.interceptorMu.RUnlock()
+
+	return chainInterceptors(c.inbound, h)
+}
+
+// outboundHandler returns h wrapped in the outbound interceptors.
+func (c *INDIClient) outboundHandler(h Handler) Handler {
+	c.interceptorMu.RLock()
+	defer c.interceptorMu.RUnlock()
+
+	return chainInterceptors(c.outbound, h)
+}
+
+func chainInterceptors(interceptors []Interceptor, h Handler) Handler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		h = interceptors[i](h)
+	}
+
+	return h
+}
@@ -0,0 +1,100 @@
+package indiclient_test
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func Test_Interceptors(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	server := simulators.NewServer(simulators.NewFocuser("Focuser Simulator"))
+
+	c := indiclient.NewINDIClient(log, server, afero.NewMemMapFs(), 100)
+
+	var mu sync.Mutex
+	order := []string{}
+	sent := []string{}
+
+	record := func(name string) indiclient.Interceptor {
+		return func(next indiclient.Handler) indiclient.Handler {
+			return func(msg interface{}) {
+				if _, ok := msg.(*indiclient.DefSwitchVector); ok {
+					mu.Lock()
+					order = append(order, name)
+					mu.Unlock()
+				}
+				next(msg)
+			}
+		}
+	}
+
+	c.UseInbound(record("first"), record("second"))
+
+	// Hide FOCUS_MAX, as a policy might.
+	c.UseInbound(func(next indiclient.Handler) indiclient.Handler {
+		return func(msg interface{}) {
+			if def, ok := msg.(*indiclient.DefNumberVector); ok && def.Name == "FOCUS_MAX" {
+				return
+			}
+			next(msg)
+		}
+	})
+
+	// Move every focuser target out by 10 steps, and record what is sent.
+	c.UseOutbound(func(next indiclient.Handler) indiclient.Handler {
+		return func(msg interface{}) {
+			if cmd, ok := msg.(indiclient.NewNumberVector); ok && cmd.Name == "ABS_FOCUS_POSITION" {
+				cmd.Numbers = []indiclient.OneNumber{{Name: "FOCUS_ABSOLUTE_POSITION", Value: "50110"}}
+				msg = cmd
+			}
+
+			mu.Lock()
+			sent = append(sent, fmt.Sprintf("%T", msg))
+			mu.Unlock()
+
+			next(msg)
+		}
+	})
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+
+	require.NoError(t, c.GetProperties("", ""))
+
+	testutil.WaitFor(t, func() bool { return c.SwitchPropertySet("Focuser Simulator", "CONNECTION") })
+
+	err := c.SetSwitchValue("Focuser Simulator", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return c.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION") })
+
+	err = c.SetNumberValue("Focuser Simulator", "ABS_FOCUS_POSITION", []string{"FOCUS_ABSOLUTE_POSITION"}, []string{"50100"})
+	require.NoError(t, err)
+
+	// FOCUS_ABORT_MOTION is defined after FOCUS_MAX.
+	testutil.WaitFor(t, func() bool { return c.SwitchPropertySet("Focuser Simulator", "FOCUS_ABORT_MOTION") })
+	assert.False(t, c.NumberPropertySet("Focuser Simulator", "FOCUS_MAX"))
+
+	v, err := c.GetNumber("Focuser Simulator", "ABS_FOCUS_POSITION", "FOCUS_ABSOLUTE_POSITION")
+	require.NoError(t, err)
+	assert.Equal(t, "50110", v.Value)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.True(t, len(order) >= 2)
+	assert.Equal(t, []string{"first", "second"}, order[:2])
+	assert.Equal(t, "indiclient.GetProperties", sent[0])
+	assert.Contains(t, sent, "indiclient.NewNumberVector")
+}
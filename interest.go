@@ -0,0 +1,255 @@
+package indiclient
+
+// InterestMode is what the client does with properties outside its interest. See SetInterest.
+type InterestMode int
+
+const (
+	// InterestIgnore drops definitions and updates of other properties, as if the driver had never sent them. Messages
+	// from devices without any property of interest are dropped too.
+	InterestIgnore InterestMode = iota
+	// InterestDefinitionsOnly keeps the definitions of other properties, and their state, but not the values of their
+	// elements. Events are still sent for them, so a UI can list every property, and show its state.
+	InterestDefinitionsOnly
+)
+
+// Interest is the set of devices and properties the client keeps the values of. See SetInterest.
+type Interest struct {
+	// Properties lists devices, or single properties of devices if Property is set. Empty means every property.
+	Properties []WatchedDevice `json:"properties"`
+	// Mode is what to do with the other properties.
+	Mode InterestMode `json:"mode"`
+}
+
+// SetInterest limits the device tree to the devices and properties in interest.Properties, which keeps the memory the
+// client uses small on embedded systems. Unlike ConnectOptions.Watch, which asks indiserver to send less, interest
+// filters what indiserver sends on the client, so it also works for drivers that define other devices' properties,
+// and for snooping. Properties already in the tree that are outside the interest are removed, or have their values
+// cleared, at once.
+func (c *INDIClient) SetInterest(interest Interest) error {
+	properties := make([]WatchedDevice, 0, len(interest.Properties))
+
+	for _, w := range interest.Properties {
+		if len(w.Property) > 0 && len(w.Device) == 0 {
+			return ErrPropertyWithoutDevice
+		}
+
+		properties = append(properties, WatchedDevice{Device: c.resolveDevice(w.Device), Property: w.Property})
+	}
+
+	interest.Properties = properties
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.interest = interest
+
+	for name, device := range c.devices {
+		c.pruneDevice(name, device)
+	}
+
+	return nil
+}
+
+// Interest returns the interest set with SetInterest.
+func (c *INDIClient) Interest() Interest {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	interest := c.interest
+	interest.Properties = make([]WatchedDevice, 0, len(c.interest.Properties))
+
+	for _, w := range c.interest.Properties {
+		interest.Properties = append(interest.Properties, WatchedDevice{Device: c.aliasDevice(w.Device), Property: w.Property})
+	}
+
+	return interest
+}
+
+// interested returns true if the client keeps the values of propName on deviceName, or of any of its properties if
+// propName is empty. Only call when INDIClient.rwm is at least reader locked.
+func (c *INDIClient) interested(deviceName, propName string) bool {
+	if len(c.interest.Properties) == 0 {
+		return true
+	}
+
+	for _, w := range c.interest.Properties {
+		if w.Device == deviceName && (len(w.Property) == 0 || len(propName) == 0 || w.Property == propName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// messageTarget returns the device and property of a def*, set* or message from indiserver, or false for anything
+// else. The property of a message is empty.
+func messageTarget(msg interface{}) (deviceName, propName string, ok bool) {
+	switch item := msg.(type) {
+	case *DefTextVector:
+		return item.Device, item.Name, true
+	case *DefNumberVector:
+		return item.Device, item.Name, true
+	case *DefSwitchVector:
+		return item.Device, item.Name, true
+	case *DefLightVector:
+		return item.Device, item.Name, true
+	case *DefBlobVector:
+		return item.Device, item.Name, true
+	case *SetTextVector:
+		return item.Device, item.Name, true
+	case *SetNumberVector:
+		return item.Device, item.Name, true
+	case *SetSwitchVector:
+		return item.Device, item.Name, true
+	case *SetLightVector:
+		return item.Device, item.Name, true
+	case *SetBlobVector:
+		return item.Device, item.Name, true
+	case *Message:
+		return item.Device, "", true
+	}
+
+	return "", "", false
+}
+
+// filterInterest applies the interest to a message from indiserver. It returns false if the message should be
+// dropped, and clears the values of vectors that are only kept for their definitions. Only call when INDIClient.rwm
+// is locked.
+func (c *INDIClient) filterInterest(msg interface{}) bool {
+	if len(c.interest.Properties) == 0 {
+		return true
+	}
+
+	if item, ok := msg.(*Message); ok {
+		return len(item.Device) == 0 || c.interest.Mode != InterestIgnore || c.interested(item.Device, "")
+	}
+
+	deviceName, propName, ok := messageTarget(msg)
+	if !ok {
+		return true
+	}
+
+	if c.interested(deviceName, propName) {
+		return true
+	}
+
+	if c.interest.Mode == InterestIgnore {
+		return false
+	}
+
+	switch item := msg.(type) {
+	case *DefTextVector:
+		for i := range item.Texts {
+			item.Texts[i].Value = ""
+		}
+	case *DefNumberVector:
+		for i := range item.Numbers {
+			item.Numbers[i].Value = ""
+		}
+	case *DefSwitchVector:
+		for i := range item.Switches {
+			item.Switches[i].Value = ""
+		}
+	case *DefLightVector:
+		for i := range item.Lights {
+			item.Lights[i].Value = ""
+		}
+	case *SetTextVector:
+		item.Texts = item.Texts[:0]
+	case *SetNumberVector:
+		item.Numbers = item.Numbers[:0]
+	case *SetSwitchVector:
+		item.Switches = item.Switches[:0]
+	case *SetLightVector:
+		item.Lights = item.Lights[:0]
+	case *SetBlobVector:
+		item.Blobs = item.Blobs[:0]
+	}
+
+	return true
+}
+
+// pruneDevice removes the properties of device outside the interest, or clears their values. Modifies
+// INDIClient.devices. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) pruneDevice(deviceName string, device Device) {
+	if c.interest.Mode == InterestIgnore && !c.interested(deviceName, "") {
+		c.removeDevice(deviceName)
+		return
+	}
+
+	ignore := c.interest.Mode == InterestIgnore
+
+	for name, p := range device.TextProperties {
+		if c.interested(deviceName, name) {
+			continue
+		}
+		if ignore {
+			delete(device.TextProperties, name)
+			continue
+		}
+		for k, v := range p.Values {
+			v.Value = ""
+			p.Values[k] = v
+		}
+	}
+
+	for name, p := range device.NumberProperties {
+		if c.interested(deviceName, name) {
+			continue
+		}
+		if ignore {
+			delete(device.NumberProperties, name)
+			continue
+		}
+		for k, v := range p.Values {
+			v.Value = ""
+			p.Values[k] = v
+		}
+	}
+
+	for name, p := range device.SwitchProperties {
+		if c.interested(deviceName, name) {
+			continue
+		}
+		if ignore {
+			delete(device.SwitchProperties, name)
+			continue
+		}
+		for k, v := range p.Values {
+			v.Value = ""
+			p.Values[k] = v
+		}
+	}
+
+	for name, p := range device.LightProperties {
+		if c.interested(deviceName, name) {
+			continue
+		}
+		if ignore {
+			delete(device.LightProperties, name)
+			continue
+		}
+		for k, v := range p.Values {
+			v.Value = ""
+			p.Values[k] = v
+		}
+	}
+
+	for name := range device.BlobProperties {
+		if ignore && !c.interested(deviceName, name) {
+			delete(device.BlobProperties, name)
+		}
+	}
+
+	if ignore {
+		order := device.PropertyOrder[:0]
+		for _, name := range device.PropertyOrder {
+			if c.interested(deviceName, name) {
+				order = append(order, name)
+			}
+		}
+		device.PropertyOrder = order
+	}
+
+	c.putDevice(deviceName, device)
+}
@@ -0,0 +1,90 @@
+package indiclient_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func connectFocuser(t *testing.T, c *indiclient.INDIClient) {
+	require.NoError(t, c.ConnectWithOptions("tcp", "localhost:7624", indiclient.ConnectOptions{}))
+	testutil.WaitFor(t, func() bool { return c.SwitchPropertySet("Focuser Simulator", "CONNECTION") })
+
+	err := c.SetSwitchValue("Focuser Simulator", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+	require.NoError(t, err)
+
+	require.NoError(t, c.GetProperties("Focuser Simulator", ""))
+	testutil.WaitFor(t, func() bool { return c.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION") })
+}
+
+func Test_Interest_Ignore(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	server := simulators.NewServer(simulators.NewFocuser("Focuser Simulator"), simulators.NewCCD("CCD Simulator"))
+
+	c := indiclient.NewINDIClient(log, server, afero.NewMemMapFs(), 100)
+
+	err := c.SetInterest(indiclient.Interest{Properties: []indiclient.WatchedDevice{{Property: "CONNECTION"}}})
+	assert.Equal(t, indiclient.ErrPropertyWithoutDevice, err)
+
+	require.NoError(t, c.SetInterest(indiclient.Interest{
+		Properties: []indiclient.WatchedDevice{
+			{Device: "Focuser Simulator", Property: "CONNECTION"},
+			{Device: "Focuser Simulator", Property: "ABS_FOCUS_POSITION"},
+		},
+	}))
+
+	connectFocuser(t, c)
+	defer c.Disconnect()
+
+	assert.Equal(t, []string{"Focuser Simulator"}, c.Devices())
+
+	device, err := c.GetDevice("Focuser Simulator")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CONNECTION", "ABS_FOCUS_POSITION"}, device.PropertyOrder)
+
+	value, err := c.GetNumber("Focuser Simulator", "ABS_FOCUS_POSITION", "FOCUS_ABSOLUTE_POSITION")
+	require.NoError(t, err)
+	assert.Equal(t, "50000", value.Value)
+
+	// Narrowing the interest prunes the tree at once.
+	require.NoError(t, c.SetInterest(indiclient.Interest{
+		Properties: []indiclient.WatchedDevice{{Device: "Focuser Simulator", Property: "CONNECTION"}},
+	}))
+
+	assert.False(t, c.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION"))
+	assert.True(t, c.SwitchPropertySet("Focuser Simulator", "CONNECTION"))
+}
+
+func Test_Interest_DefinitionsOnly(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	server := simulators.NewServer(simulators.NewFocuser("Focuser Simulator"))
+
+	c := indiclient.NewINDIClient(log, server, afero.NewMemMapFs(), 100)
+
+	interest := indiclient.Interest{
+		Properties: []indiclient.WatchedDevice{{Device: "Focuser Simulator", Property: "CONNECTION"}},
+		Mode:       indiclient.InterestDefinitionsOnly,
+	}
+	require.NoError(t, c.SetInterest(interest))
+	assert.Equal(t, interest, c.Interest())
+
+	connectFocuser(t, c)
+	defer c.Disconnect()
+
+	// Defined, but without values.
+	value, err := c.GetNumber("Focuser Simulator", "ABS_FOCUS_POSITION", "FOCUS_ABSOLUTE_POSITION")
+	require.NoError(t, err)
+	assert.Empty(t, value.Value)
+
+	prop, err := c.GetSwitchProperty("Focuser Simulator", "CONNECTION")
+	require.NoError(t, err)
+	assert.Equal(t, indiclient.SwitchStateOn, prop.Values["CONNECT"].Value)
+}
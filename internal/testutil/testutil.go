@@ -0,0 +1,30 @@
+// Package testutil holds helpers shared by the tests of indiclient and its subpackages.
+package testutil
+
+import (
+	"testing"
+	"time"
+)
+
+// WaitFor polls cond until it returns true, failing t if it has not after 5 seconds.
+func WaitFor(t testing.TB, cond func() bool) {
+	t.Helper()
+
+	if !WaitUntil(5*time.Second, cond) {
+		t.Fatal("timed out waiting for condition")
+	}
+}
+
+// WaitUntil polls cond until it returns true, or returns false after timeout.
+func WaitUntil(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return true
+}
@@ -0,0 +1,106 @@
+package indiclient
+
+// LabelKey identifies what a Translator is asked to label. Property is empty for the label of a device, and Element
+// is empty for the label of a property.
+type LabelKey struct {
+	Device   string
+	Property string
+	Element  string
+}
+
+// Translator returns the label to display for key, such as a localized label for a standard property like
+// CONNECTION. label is the label the driver sent, or the name of the device. Return an empty string to display label.
+// Translators are called without the client locked, and may be called from several goroutines at once.
+type Translator func(key LabelKey, label string) string
+
+// Label is the label of a device, property or element, as the driver sent it and as it should be displayed.
+type Label struct {
+	Raw     string `json:"raw"`
+	Display string `json:"display"`
+}
+
+// SetTranslator sets the Translator used by DeviceLabel, PropertyLabel and ElementLabel. nil removes it, and labels
+// are displayed as the driver sent them.
+func (c *INDIClient) SetTranslator(t Translator) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.translator = t
+}
+
+// DeviceLabel returns the label of the device deviceName. Devices have no label in INDI, so Raw is its name, or
+// alias.
+func (c *INDIClient) DeviceLabel(deviceName string) (Label, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.RLock()
+	device, err := c.findDevice(deviceName)
+	t := c.translator
+	c.rwm.RUnlock()
+
+	if err != nil {
+		return Label{}, ErrDeviceNotFound
+	}
+
+	return translate(t, LabelKey{Device: device.Name}, device.Name), nil
+}
+
+// PropertyLabel returns the label of the property propName on deviceName, of any type.
+func (c *INDIClient) PropertyLabel(deviceName, propName string) (Label, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.RLock()
+	device, err := c.findDevice(deviceName)
+	info, ok := device.PropertyInfo(propName)
+	t := c.translator
+	c.rwm.RUnlock()
+
+	if err != nil {
+		return Label{}, ErrDeviceNotFound
+	}
+
+	if !ok {
+		return Label{}, ErrPropertyNotFound
+	}
+
+	return translate(t, LabelKey{Device: device.Name, Property: propName}, info.Label), nil
+}
+
+// ElementLabel returns the label of the element elementName of the property propName on deviceName, of any type.
+func (c *INDIClient) ElementLabel(deviceName, propName, elementName string) (Label, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.RLock()
+	device, err := c.findDevice(deviceName)
+	info, ok := device.PropertyInfo(propName)
+	t := c.translator
+	c.rwm.RUnlock()
+
+	if err != nil {
+		return Label{}, ErrDeviceNotFound
+	}
+
+	if !ok {
+		return Label{}, ErrPropertyNotFound
+	}
+
+	for _, e := range info.Elements {
+		if e.Name == elementName {
+			return translate(t, LabelKey{Device: device.Name, Property: propName, Element: elementName}, e.Label), nil
+		}
+	}
+
+	return Label{}, ErrPropertyValueNotFound
+}
+
+func translate(t Translator, key LabelKey, raw string) Label {
+	l := Label{Raw: raw, Display: raw}
+
+	if t != nil {
+		if display := t(key, raw); len(display) > 0 {
+			l.Display = display
+		}
+	}
+
+	return l
+}
@@ -0,0 +1,62 @@
+package indiclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Labels(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+
+	c.defSwitchVector(&DefSwitchVector{
+		Device:   "Mount",
+		Name:     "CONNECTION",
+		Label:    "Connection",
+		State:    PropertyStateIdle,
+		Perm:     PropertyPermissionReadWrite,
+		Rule:     SwitchRuleOneOfMany,
+		Switches: []DefSwitch{{Name: "CONNECT", Label: "Connect", Value: SwitchStateOff}},
+	})
+
+	// Without a translator, labels are displayed as the driver sent them.
+	label, err := c.PropertyLabel("Mount", "CONNECTION")
+	require.NoError(t, err)
+	assert.Equal(t, Label{Raw: "Connection", Display: "Connection"}, label)
+
+	german := map[LabelKey]string{
+		{Device: "Mount"}:                                             "Montierung",
+		{Device: "Mount", Property: "CONNECTION"}:                     "Verbindung",
+		{Device: "Mount", Property: "CONNECTION", Element: "CONNECT"}: "Verbinden",
+	}
+
+	c.SetTranslator(func(key LabelKey, label string) string { return german[key] })
+
+	label, err = c.DeviceLabel("Mount")
+	require.NoError(t, err)
+	assert.Equal(t, Label{Raw: "Mount", Display: "Montierung"}, label)
+
+	label, err = c.PropertyLabel("Mount", "CONNECTION")
+	require.NoError(t, err)
+	assert.Equal(t, Label{Raw: "Connection", Display: "Verbindung"}, label)
+
+	label, err = c.ElementLabel("Mount", "CONNECTION", "CONNECT")
+	require.NoError(t, err)
+	assert.Equal(t, Label{Raw: "Connect", Display: "Verbinden"}, label)
+
+	// Unknown to the translator.
+	label, err = c.ElementLabel("Mount", "EQUATORIAL_EOD_COORD", "RA")
+	require.NoError(t, err)
+	assert.Equal(t, label.Raw, label.Display)
+
+	_, err = c.DeviceLabel("Camera")
+	assert.Equal(t, ErrDeviceNotFound, err)
+
+	_, err = c.PropertyLabel("Mount", "MISSING")
+	assert.Equal(t, ErrPropertyNotFound, err)
+
+	_, err = c.ElementLabel("Mount", "CONNECTION", "DISCONNECT")
+	assert.Equal(t, ErrPropertyValueNotFound, err)
+}
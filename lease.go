@@ -0,0 +1,212 @@
+package indiclient
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrLeaseHeld is returned by AcquireLease when the property is already leased.
+	ErrLeaseHeld = errors.New("property is leased")
+
+	// ErrLeaseNotFound is returned when a lease does not exist, or has expired.
+	ErrLeaseNotFound = errors.New("lease not found")
+)
+
+// Lease is a claim by part of an application on a property, such as a focus routine on ABS_FOCUS_POSITION, taken with
+// AcquireLease. Leases are only known to this client: they keep the parts of an application that share a client from
+// writing the same property at once, and report when another client, such as KStars, changes a leased property.
+type Lease struct {
+	ID       string `json:"id"`
+	Device   string `json:"device"`
+	Property string `json:"property"`
+	// Owner is a free form description of who holds the lease, for logs and UIs.
+	Owner    string    `json:"owner"`
+	Acquired time.Time `json:"acquired"`
+	// Expires is when the lease lapses unless renewed, or zero if it does not.
+	Expires time.Time `json:"expires"`
+	// Conflicts is the number of times another client changed the property while the lease was held.
+	Conflicts int `json:"conflicts"`
+
+	// lastState is the last state reported for the property, to spot it going Busy.
+	lastState PropertyState
+}
+
+func (l *Lease) expired(now time.Time) bool {
+	return !l.Expires.IsZero() && now.After(l.Expires)
+}
+
+// AcquireLease leases propName of deviceName to owner for ttl, or until released if ttl is zero. It returns
+// ErrLeaseHeld if the property is already leased.
+//
+// While the lease is held, an EventTypeLeaseConflict event is sent each time the property goes Busy with no command
+// from this client in flight, which means another client has sent it a command. Changes another client makes without
+// the property going Busy cannot be told apart from the driver's own updates, so they are not reported. Leases do not
+// stop this client's own Set* calls.
+func (c *INDIClient) AcquireLease(deviceName, propName, owner string, ttl time.Duration) (Lease, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	if len(deviceName) == 0 {
+		return Lease{}, ErrDeviceNotFound
+	}
+
+	if len(propName) == 0 {
+		return Lease{}, ErrPropertyNotFound
+	}
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	now := c.now()
+	key := transactionKey(deviceName, propName)
+
+	if l, ok := c.leases[key]; ok && !l.expired(now) {
+		return Lease{}, ErrLeaseHeld
+	}
+
+	l := &Lease{
+		ID:        uuid.New().String(),
+		Device:    deviceName,
+		Property:  propName,
+		Owner:     owner,
+		Acquired:  now,
+		lastState: c.propertyState(deviceName, propName),
+	}
+
+	if ttl > 0 {
+		l.Expires = now.Add(ttl)
+	}
+
+	c.leases[key] = l
+
+	return c.leaseCopy(l), nil
+}
+
+// RenewLease extends the lease id to ttl from now, or indefinitely if ttl is zero. A lease that has expired cannot be
+// renewed.
+func (c *INDIClient) RenewLease(id string, ttl time.Duration) (Lease, error) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	now := c.now()
+
+	l := c.findLease(id)
+	if l == nil || l.expired(now) {
+		return Lease{}, ErrLeaseNotFound
+	}
+
+	l.Expires = time.Time{}
+	if ttl > 0 {
+		l.Expires = now.Add(ttl)
+	}
+
+	return c.leaseCopy(l), nil
+}
+
+// ReleaseLease releases the lease id, so the property can be leased again.
+func (c *INDIClient) ReleaseLease(id string) error {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	l := c.findLease(id)
+	if l == nil {
+		return ErrLeaseNotFound
+	}
+
+	delete(c.leases, transactionKey(l.Device, l.Property))
+
+	return nil
+}
+
+// Leases returns the leases currently held.
+func (c *INDIClient) Leases() []Lease {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	now := c.now()
+	leases := []Lease{}
+
+	for _, l := range c.leases {
+		if !l.expired(now) {
+			leases = append(leases, c.leaseCopy(l))
+		}
+	}
+
+	return leases
+}
+
+// findLease returns the lease id, or nil. Only call when INDIClient.rwm is at least reader locked.
+func (c *INDIClient) findLease(id string) *Lease {
+	for _, l := range c.leases {
+		if l.ID == id {
+			return l
+		}
+	}
+
+	return nil
+}
+
+// leaseCopy returns a copy of l as the caller sees it, with the device alias.
+func (c *INDIClient) leaseCopy(l *Lease) Lease {
+	cp := *l
+	cp.Device = c.aliasDevice(l.Device)
+	cp.lastState = ""
+
+	return cp
+}
+
+// checkLease sends an EventTypeLeaseConflict event if a leased property has gone Busy without a command from this
+// client in flight. Modifies INDIClient.leases. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) checkLease(deviceName, propName string, state PropertyState, message string) {
+	key := transactionKey(deviceName, propName)
+
+	l, ok := c.leases[key]
+	if !ok {
+		return
+	}
+
+	if l.expired(c.now()) {
+		delete(c.leases, key)
+		return
+	}
+
+	wasBusy := l.lastState == PropertyStateBusy
+	l.lastState = state
+
+	if state != PropertyStateBusy || wasBusy {
+		return
+	}
+
+	if _, ours := c.transactions.Load(key); ours {
+		return
+	}
+
+	l.Conflicts++
+
+	c.log.WithField("device", deviceName).WithField("property", propName).WithField("owner", l.Owner).Warn("leased property changed by another client")
+
+	c.emit(Event{
+		Type:     EventTypeLeaseConflict,
+		Device:   deviceName,
+		Property: propName,
+		State:    state,
+		Message:  message,
+	})
+}
+
+// propertyState returns the state of propName of deviceName, or an empty state if it is not defined. Only call when
+// INDIClient.rwm is at least reader locked.
+func (c *INDIClient) propertyState(deviceName, propName string) PropertyState {
+	device, ok := c.devices[deviceName]
+	if !ok {
+		return ""
+	}
+
+	if info, ok := device.PropertyInfo(propName); ok {
+		return info.State
+	}
+
+	return ""
+}
@@ -0,0 +1,99 @@
+package indiclient_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func Test_Lease(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	server := simulators.NewServer(simulators.NewFocuser("Focuser Simulator"))
+
+	connect := func() *indiclient.INDIClient {
+		c := indiclient.NewINDIClient(log, server, afero.NewMemMapFs(), 100)
+		require.NoError(t, c.ConnectWithOptions("tcp", "localhost:7624", indiclient.ConnectOptions{}))
+		testutil.WaitFor(t, func() bool { return c.SwitchPropertySet("Focuser Simulator", "CONNECTION") })
+		return c
+	}
+
+	ours := connect()
+	defer ours.Disconnect()
+
+	theirs := connect()
+	defer theirs.Disconnect()
+
+	err := ours.SetSwitchValue("Focuser Simulator", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+	require.NoError(t, err)
+
+	require.NoError(t, ours.GetProperties("Focuser Simulator", ""))
+	require.NoError(t, theirs.GetProperties("Focuser Simulator", ""))
+	testutil.WaitFor(t, func() bool {
+		return ours.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION") && theirs.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION")
+	})
+
+	lease, err := ours.AcquireLease("Focuser Simulator", "ABS_FOCUS_POSITION", "autofocus", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "autofocus", lease.Owner)
+
+	_, err = ours.AcquireLease("Focuser Simulator", "ABS_FOCUS_POSITION", "someone else", 0)
+	assert.Equal(t, indiclient.ErrLeaseHeld, err)
+
+	events, id, err := ours.Subscribe(indiclient.SubscribeOptions{Types: []indiclient.EventType{indiclient.EventTypeLeaseConflict}})
+	require.NoError(t, err)
+	defer ours.Unsubscribe(id)
+
+	// Our own moves are not conflicts.
+	err = ours.SetNumberValue("Focuser Simulator", "ABS_FOCUS_POSITION", []string{"FOCUS_ABSOLUTE_POSITION"}, []string{"50500"})
+	require.NoError(t, err)
+
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected conflict %v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Theirs are.
+	err = theirs.SetNumberValue("Focuser Simulator", "ABS_FOCUS_POSITION", []string{"FOCUS_ABSOLUTE_POSITION"}, []string{"51000"})
+	require.NoError(t, err)
+
+	select {
+	case e := <-events:
+		assert.Equal(t, "Focuser Simulator", e.Device)
+		assert.Equal(t, "ABS_FOCUS_POSITION", e.Property)
+		assert.Equal(t, indiclient.PropertyStateBusy, e.State)
+	case <-time.After(time.Second):
+		t.Fatal("no conflict event")
+	}
+
+	leases := ours.Leases()
+	require.Len(t, leases, 1)
+	assert.Equal(t, lease.ID, leases[0].ID)
+	assert.Equal(t, 1, leases[0].Conflicts)
+
+	renewed, err := ours.RenewLease(lease.ID, 0)
+	require.NoError(t, err)
+	assert.True(t, renewed.Expires.IsZero())
+
+	require.NoError(t, ours.ReleaseLease(lease.ID))
+	assert.Equal(t, indiclient.ErrLeaseNotFound, ours.ReleaseLease(lease.ID))
+	assert.Empty(t, ours.Leases())
+
+	// Expired leases can be taken again.
+	_, err = ours.AcquireLease("Focuser Simulator", "ABS_FOCUS_POSITION", "autofocus", time.Millisecond)
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = ours.AcquireLease("Focuser Simulator", "ABS_FOCUS_POSITION", "guiding", 0)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,383 @@
+// Package livestack is an experimental live stacker for electronically assisted astronomy. Each frame a camera sends
+// is aligned to the first by the translation that best matches their stars, added to a running average, and a
+// stretched preview of the stack is published after every frame:
+//
+//	ls, err := livestack.Start(c, "CCD Simulator", livestack.Options{
+//		OnUpdate: func(u livestack.Update) {
+//			if u.Err == nil {
+//				ioutil.WriteFile("stack.jpg", u.Preview.Data, 0644)
+//			}
+//		},
+//	})
+//	...
+//	defer ls.Close()
+//
+// Only translation is corrected, to the nearest pixel, so field rotation from an alt-az mount slowly blurs the edges
+// of a long stack. Frames that cannot be aligned are skipped.
+package livestack
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"sync"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/hfr"
+	"github.com/goastro/indiclient/imaging"
+)
+
+var (
+	// ErrNotAligned is returned when too few stars of a frame match the stars of the reference frame.
+	ErrNotAligned = errors.New("frame could not be aligned")
+	// ErrSizeMismatch is returned when a frame is not the same size as the reference frame.
+	ErrSizeMismatch = errors.New("frame size differs from reference")
+)
+
+const (
+	// DefaultTolerance is the default distance, in pixels, within which an aligned star matches a reference star.
+	DefaultTolerance = 2
+	// DefaultMinMatches is the default number of stars that must match for a frame to be aligned.
+	DefaultMinMatches = 3
+	// DefaultAlignStars is the default number of the brightest stars used for alignment.
+	DefaultAlignStars = 20
+	// DefaultBlob is the BLOB frames are read from, unless set in Options.
+	DefaultBlob = "CCD1"
+)
+
+// Options controls how frames are stacked. Zero values are replaced by the defaults.
+type Options struct {
+	// Property and Blob are the BLOB frames are read from by Start. Both default to DefaultBlob.
+	Property string
+	Blob     string
+	// Raw describes raw video frames, as for imaging.Decode.
+	Raw imaging.RawOptions
+	// Stars controls star detection, as for hfr.Detect.
+	Stars hfr.Options
+	// AlignStars is how many of the brightest stars of each frame are used for alignment.
+	AlignStars int
+	// Tolerance is the distance, in pixels, within which an aligned star matches a reference star.
+	Tolerance float64
+	// MinMatches is how many stars must match for a frame to be aligned.
+	MinMatches int
+	// Preview controls the preview published after each frame.
+	Preview imaging.PreviewOptions
+	// OnUpdate is called by Start after each frame, whether it was stacked or not.
+	OnUpdate func(Update)
+}
+
+func (o Options) withDefaults() Options {
+	if len(o.Property) == 0 {
+		o.Property = DefaultBlob
+	}
+	if len(o.Blob) == 0 {
+		o.Blob = DefaultBlob
+	}
+	if o.AlignStars <= 0 {
+		o.AlignStars = DefaultAlignStars
+	}
+	if o.Tolerance <= 0 {
+		o.Tolerance = DefaultTolerance
+	}
+	if o.MinMatches <= 0 {
+		o.MinMatches = DefaultMinMatches
+	}
+	return o
+}
+
+// Frame describes how a frame was stacked.
+type Frame struct {
+	// DX and DY are the shift, in pixels, that aligned the frame with the reference frame.
+	DX int `json:"dx"`
+	DY int `json:"dy"`
+	// Stars is the number of stars detected in the frame, and Matched how many of them matched the reference.
+	Stars   int `json:"stars"`
+	Matched int `json:"matched"`
+}
+
+// Update is published after each frame received by Start.
+type Update struct {
+	// Frame describes the frame, if it was stacked.
+	Frame Frame `json:"frame"`
+	// Frames is the number of frames in the stack, and Rejected the number that could not be stacked.
+	Frames   int `json:"frames"`
+	Rejected int `json:"rejected"`
+	// Preview is a preview of the stack, or nil if it is still empty.
+	Preview *indiclient.BlobPreview `json:"preview"`
+	// Err is why the frame was not stacked, or why the preview could not be rendered.
+	Err error `json:"-"`
+}
+
+// Stack averages aligned frames. It is safe for concurrent use.
+type Stack struct {
+	opts Options
+
+	mu            sync.Mutex
+	width, height int
+	channels      int
+	reference     []hfr.Star
+	sum           []float64
+	count         []uint32
+	frames        int
+}
+
+// NewStack returns an empty stack. The first frame added becomes the reference the others are aligned with.
+func NewStack(opts Options) *Stack {
+	return &Stack{opts: opts.withDefaults()}
+}
+
+// Add aligns img with the reference frame and adds it to the stack. Returns ErrNotAligned if too few of its stars
+// match the reference, and ErrSizeMismatch if it is not the same size. The first frame needs at least MinMatches
+// stars to become the reference.
+func (s *Stack) Add(img image.Image) (Frame, error) {
+	stars := hfr.Detect(img, s.opts.Stars)
+	if len(stars) > s.opts.AlignStars {
+		stars = stars[:s.opts.AlignStars]
+	}
+
+	f := Frame{Stars: len(stars)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := img.Bounds()
+
+	if s.frames == 0 {
+		if len(stars) < s.opts.MinMatches {
+			return f, ErrNotAligned
+		}
+
+		s.width, s.height = b.Dx(), b.Dy()
+		s.channels = 3
+		switch img.(type) {
+		case *image.Gray, *image.Gray16:
+			s.channels = 1
+		}
+		s.reference = stars
+		s.sum = make([]float64, s.channels*s.width*s.height)
+		s.count = make([]uint32, s.width*s.height)
+		f.Matched = len(stars)
+	} else {
+		if b.Dx() != s.width || b.Dy() != s.height {
+			return f, ErrSizeMismatch
+		}
+
+		var dx, dy float64
+		dx, dy, f.Matched = align(s.reference, stars, s.opts.Tolerance)
+		if f.Matched < s.opts.MinMatches {
+			return f, ErrNotAligned
+		}
+
+		f.DX, f.DY = int(math.Round(dx)), int(math.Round(dy))
+	}
+
+	s.accumulate(img, f.DX, f.DY)
+	s.frames++
+
+	return f, nil
+}
+
+// accumulate adds img to the stack, moving each pixel by dx, dy. Pixels moved off the frame are dropped. Only call
+// when Stack.mu is locked.
+func (s *Stack) accumulate(img image.Image, dx, dy int) {
+	b := img.Bounds()
+
+	for y := 0; y < s.height; y++ {
+		ty := y + dy
+		if ty < 0 || ty >= s.height {
+			continue
+		}
+
+		for x := 0; x < s.width; x++ {
+			tx := x + dx
+			if tx < 0 || tx >= s.width {
+				continue
+			}
+
+			i := ty*s.width + tx
+			c := color.RGBA64Model.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.RGBA64)
+
+			if s.channels == 1 {
+				s.sum[i] += float64(c.R)
+			} else {
+				s.sum[3*i] += float64(c.R)
+				s.sum[3*i+1] += float64(c.G)
+				s.sum[3*i+2] += float64(c.B)
+			}
+			s.count[i]++
+		}
+	}
+}
+
+// Frames returns the number of frames in the stack.
+func (s *Stack) Frames() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.frames
+}
+
+// Image returns the average of the stacked frames, as an *image.Gray16 for monochrome frames or an *image.RGBA64 for
+// color frames. Each pixel is averaged over the frames that covered it after alignment. Returns nil if the stack is
+// empty.
+func (s *Stack) Image() image.Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.frames == 0 {
+		return nil
+	}
+
+	rect := image.Rect(0, 0, s.width, s.height)
+
+	if s.channels == 1 {
+		img := image.NewGray16(rect)
+		for i, n := range s.count {
+			if n > 0 {
+				img.SetGray16(i%s.width, i/s.width, color.Gray16{Y: uint16(s.sum[i]/float64(n) + 0.5)})
+			}
+		}
+		return img
+	}
+
+	img := image.NewRGBA64(rect)
+	for i, n := range s.count {
+		c := color.RGBA64{A: 0xffff}
+		if n > 0 {
+			c.R = uint16(s.sum[3*i]/float64(n) + 0.5)
+			c.G = uint16(s.sum[3*i+1]/float64(n) + 0.5)
+			c.B = uint16(s.sum[3*i+2]/float64(n) + 0.5)
+		}
+		img.SetRGBA64(i%s.width, i/s.width, c)
+	}
+	return img
+}
+
+// Reset empties the stack, so the next frame added becomes the new reference.
+func (s *Stack) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.frames = 0
+	s.reference = nil
+	s.sum = nil
+	s.count = nil
+}
+
+// align returns the shift that moves the most of stars onto reference, averaged over the stars it matches, and how
+// many that is. Every pairing of a star with a reference star proposes a shift, and the one that matches the most
+// stars within tolerance wins.
+func align(reference, stars []hfr.Star, tolerance float64) (dx, dy float64, matched int) {
+	for _, r := range reference {
+		for _, f := range stars {
+			cx, cy := r.X-f.X, r.Y-f.Y
+
+			var sx, sy float64
+			n := 0
+
+			for _, star := range stars {
+				if m, ok := nearest(reference, star.X+cx, star.Y+cy, tolerance); ok {
+					sx += m.X - star.X
+					sy += m.Y - star.Y
+					n++
+				}
+			}
+
+			if n > matched {
+				dx, dy, matched = sx/float64(n), sy/float64(n), n
+			}
+		}
+	}
+
+	return dx, dy, matched
+}
+
+// nearest returns the star of stars closest to x, y, if it is within tolerance.
+func nearest(stars []hfr.Star, x, y, tolerance float64) (hfr.Star, bool) {
+	best, found := hfr.Star{}, false
+	bestDist := tolerance
+
+	for _, s := range stars {
+		if d := math.Hypot(s.X-x, s.Y-y); d <= bestDist {
+			best, bestDist, found = s, d, true
+		}
+	}
+
+	return best, found
+}
+
+// LiveStack stacks the frames a camera sends as they arrive. See Start.
+type LiveStack struct {
+	c     *indiclient.INDIClient
+	opts  Options
+	stack *Stack
+	id    string
+
+	mu       sync.Mutex
+	rejected int
+}
+
+// Start stacks every frame received from camera on Options.Property and Options.Blob, calling Options.OnUpdate with
+// a preview of the stack after each one. Frames are stacked on their own goroutine, one at a time, in the order they
+// were received. Remember to call Close when you are done.
+func Start(c *indiclient.INDIClient, camera string, opts Options) (*LiveStack, error) {
+	opts = opts.withDefaults()
+
+	ls := &LiveStack{c: c, opts: opts, stack: NewStack(opts)}
+
+	id, err := c.OnBlob(camera, opts.Property, opts.Blob, ls.add)
+	if err != nil {
+		return nil, err
+	}
+
+	ls.id = id
+
+	return ls, nil
+}
+
+// Stack returns the stack the frames are added to, e.g. to Reset it when the mount moves to another target.
+func (ls *LiveStack) Stack() *Stack {
+	return ls.stack
+}
+
+// Close stops stacking. Frames that have not been stacked yet are dropped.
+func (ls *LiveStack) Close() error {
+	return ls.c.RemoveBlobHandler(ls.id)
+}
+
+func (ls *LiveStack) add(e indiclient.BlobEvent) {
+	u := Update{}
+
+	data, err := ioutil.ReadAll(e.Open())
+	if err == nil {
+		var img image.Image
+		img, err = imaging.Decode(e.Format, data, ls.opts.Raw)
+		if err == nil {
+			u.Frame, err = ls.stack.Add(img)
+		}
+	}
+
+	ls.mu.Lock()
+	if err != nil {
+		ls.rejected++
+	}
+	u.Rejected = ls.rejected
+	ls.mu.Unlock()
+
+	u.Err = err
+	u.Frames = ls.stack.Frames()
+
+	if stacked := ls.stack.Image(); stacked != nil {
+		preview, perr := imaging.Preview(stacked, ls.opts.Preview)
+		if u.Err == nil {
+			u.Err = perr
+		}
+		u.Preview = preview
+	}
+
+	if ls.opts.OnUpdate != nil {
+		ls.opts.OnUpdate(u)
+	}
+}
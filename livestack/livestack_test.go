@@ -0,0 +1,141 @@
+package livestack_test
+
+import (
+	"context"
+	"image"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/hfr"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/livestack"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func frame(width, height int, stars []simulators.Star, rnd *rand.Rand) *image.Gray16 {
+	pixels := simulators.SyntheticFrame(width, height, stars, 1.5, rnd)
+
+	img := image.NewGray16(image.Rect(0, 0, width, height))
+	for i, p := range pixels {
+		img.Pix[2*i] = uint8(p >> 8)
+		img.Pix[2*i+1] = uint8(p)
+	}
+
+	return img
+}
+
+// shifted returns stars moved by dx, dy.
+func shifted(stars []simulators.Star, dx, dy float64) []simulators.Star {
+	moved := make([]simulators.Star, len(stars))
+	for i, s := range stars {
+		moved[i] = simulators.Star{X: s.X + dx, Y: s.Y + dy, Flux: s.Flux}
+	}
+	return moved
+}
+
+func Test_Stack_Align(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	stars := []simulators.Star{
+		{X: 20, Y: 20, Flux: 20000},
+		{X: 70, Y: 25, Flux: 15000},
+		{X: 40, Y: 60, Flux: 10000},
+		{X: 72, Y: 55, Flux: 8000},
+	}
+
+	s := livestack.NewStack(livestack.Options{})
+
+	f, err := s.Add(frame(100, 80, stars, rnd))
+	require.NoError(t, err)
+	assert.Equal(t, 4, f.Matched)
+
+	f, err = s.Add(frame(100, 80, shifted(stars, -3, 2), rnd))
+	require.NoError(t, err)
+	assert.Equal(t, 3, f.DX)
+	assert.Equal(t, -2, f.DY)
+	assert.Equal(t, 4, f.Matched)
+
+	_, err = s.Add(frame(100, 80, nil, rnd))
+	assert.Equal(t, livestack.ErrNotAligned, err)
+
+	_, err = s.Add(frame(50, 80, stars, rnd))
+	assert.Equal(t, livestack.ErrSizeMismatch, err)
+
+	assert.Equal(t, 2, s.Frames())
+
+	// The aligned frames add up, so the stars stay where they are in the reference.
+	result, err := hfr.Measure(s.Image(), hfr.Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Stars, 4)
+	assert.InDelta(t, 20, result.Stars[0].X, 0.5)
+	assert.InDelta(t, 20, result.Stars[0].Y, 0.5)
+
+	s.Reset()
+	assert.Equal(t, 0, s.Frames())
+	assert.Nil(t, s.Image())
+}
+
+func Test_Stack_Noise(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	stars := simulators.RandomStars(rnd, 10, 100, 80)
+
+	single, err := hfr.Measure(frame(100, 80, stars, rnd), hfr.Options{})
+	require.NoError(t, err)
+
+	s := livestack.NewStack(livestack.Options{})
+	for i := 0; i < 16; i++ {
+		_, err := s.Add(frame(100, 80, stars, rnd))
+		require.NoError(t, err)
+	}
+
+	stacked, err := hfr.Measure(s.Image(), hfr.Options{})
+	require.NoError(t, err)
+	assert.Less(t, stacked.Noise, single.Noise/2)
+}
+
+func Test_Start(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	ccd := simulators.NewCCD("CCD Simulator")
+	c := indiclient.NewINDIClient(log, simulators.NewServer(ccd), afero.NewMemMapFs(), 100)
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+	require.NoError(t, c.GetProperties("", ""))
+
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == 1 })
+	require.NoError(t, c.SetSwitchValue("CCD Simulator", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn}))
+	testutil.WaitFor(t, func() bool { return c.BlobPropertySet("CCD Simulator", "CCD1") })
+
+	updates := make(chan livestack.Update, 10)
+	ls, err := livestack.Start(c, "CCD Simulator", livestack.Options{
+		OnUpdate: func(u livestack.Update) { updates <- u },
+	})
+	require.NoError(t, err)
+	defer ls.Close()
+
+	for i := 1; i <= 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := c.CaptureFrame(ctx, "CCD Simulator", 0.01)
+		cancel()
+		require.NoError(t, err)
+
+		select {
+		case u := <-updates:
+			require.NoError(t, u.Err)
+			assert.Equal(t, i, u.Frames)
+			require.NotNil(t, u.Preview)
+			assert.Equal(t, "image/jpeg", u.Preview.ContentType)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for update")
+		}
+	}
+
+	assert.Equal(t, 2, ls.Stack().Frames())
+}
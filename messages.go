@@ -0,0 +1,298 @@
+package indiclient
+
+import (
+	"strings"
+)
+
+// MessageSeverity is how serious a message from a driver is, as classified by ClassifyMessage.
+type MessageSeverity string
+
+const (
+	// MessageSeverityDebug is for driver debug output.
+	MessageSeverityDebug = MessageSeverity("debug")
+	// MessageSeverityInfo is for messages without a severity prefix.
+	MessageSeverityInfo = MessageSeverity("info")
+	// MessageSeverityWarning is for warnings.
+	MessageSeverityWarning = MessageSeverity("warning")
+	// MessageSeverityError is for errors, which usually explain why a property went to Alert.
+	MessageSeverityError = MessageSeverity("error")
+)
+
+// messagePrefixes maps the severity prefixes drivers put on their messages to a severity. libindi's logger writes
+// them in brackets, e.g. "[ERROR] Failed to open camera", and other drivers as a word and a colon, e.g.
+// "Error: no response".
+var messagePrefixes = map[string]MessageSeverity{
+	"error":   MessageSeverityError,
+	"err":     MessageSeverityError,
+	"warning": MessageSeverityWarning,
+	"warn":    MessageSeverityWarning,
+	"info":    MessageSeverityInfo,
+	"session": MessageSeverityInfo,
+	"debug":   MessageSeverityDebug,
+	"scope":   MessageSeverityDebug,
+}
+
+// ClassifyMessage returns the severity of a message from a driver, parsed from its prefix, and the message without
+// the prefix. A leading timestamp, as some drivers write, is skipped. Messages without a known prefix are
+// MessageSeverityInfo, and returned unchanged.
+func ClassifyMessage(message string) (MessageSeverity, string) {
+	text := strings.TrimSpace(message)
+
+	// e.g. "2021-06-01T22:13:05: [ERROR] ..."
+	if len(text) > 21 && text[4] == '-' && text[10] == 'T' && text[19] == ':' {
+		text = strings.TrimSpace(text[20:])
+	}
+
+	var prefix, rest string
+
+	if strings.HasPrefix(text, "[") {
+		end := strings.Index(text, "]")
+		if end < 0 {
+			return MessageSeverityInfo, message
+		}
+
+		prefix, rest = text[1:end], text[end+1:]
+	} else {
+		end := strings.Index(text, ":")
+		if end < 0 {
+			return MessageSeverityInfo, message
+		}
+
+		prefix, rest = text[:end], text[end+1:]
+	}
+
+	severity, ok := messagePrefixes[strings.ToLower(strings.TrimSpace(prefix))]
+	if !ok {
+		return MessageSeverityInfo, message
+	}
+
+	return severity, strings.TrimSpace(rest)
+}
+
+// DefaultMessageHistory is the number of messages kept for each property and device by NewINDIClient.
+const DefaultMessageHistory = 100
+
+// SetMessageHistory sets how many messages are kept for each property, each device, and for indiserver itself. Older
+// messages are discarded as new ones arrive. Zero disables message retention entirely, which saves memory with chatty
+// drivers on small machines; messages are still delivered as events. Devices given their own limit with
+// SetDeviceMessageHistory keep it.
+func (c *INDIClient) SetMessageHistory(n int) {
+	if n < 0 {
+		n = 0
+	}
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.messageHistory = n
+
+	for name := range c.devices {
+		c.trimDeviceMessages(name)
+	}
+
+	c.serverMessages = trimMessages(c.serverMessages, n)
+}
+
+// SetDeviceMessageHistory sets how many messages are kept for deviceName and each of its properties, instead of the
+// limit set with SetMessageHistory, e.g. to keep more from a mount than from a chatty camera driver. A negative n
+// removes the device's own limit.
+func (c *INDIClient) SetDeviceMessageHistory(deviceName string, n int) {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	if n < 0 {
+		delete(c.deviceHistory, deviceName)
+	} else {
+		c.deviceHistory[deviceName] = n
+	}
+
+	if _, ok := c.devices[deviceName]; ok {
+		c.trimDeviceMessages(deviceName)
+	}
+}
+
+// ClearMessages discards the messages kept for deviceName and all of its properties. An empty deviceName clears the
+// messages from indiserver itself.
+func (c *INDIClient) ClearMessages(deviceName string) error {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	if len(deviceName) == 0 {
+		c.serverMessages = nil
+		return nil
+	}
+
+	deviceName = c.resolveDevice(deviceName)
+
+	if _, err := c.findDevice(deviceName); err != nil {
+		return err
+	}
+
+	c.trimDeviceMessagesTo(deviceName, 0)
+
+	return nil
+}
+
+// MessageFilter selects the messages returned by DeviceMessages and FilterMessages.
+type MessageFilter struct {
+	// MinSeverity drops messages less serious than it. Empty keeps them all.
+	MinSeverity MessageSeverity
+	// Limit keeps only the newest Limit messages that pass MinSeverity. Zero keeps them all.
+	Limit int
+}
+
+// severityRank orders severities from least to most serious.
+var severityRank = map[MessageSeverity]int{
+	MessageSeverityDebug:   0,
+	MessageSeverityInfo:    1,
+	MessageSeverityWarning: 2,
+	MessageSeverityError:   3,
+}
+
+// FilterMessages returns the messages that pass f, oldest first. Messages without a severity are classified with
+// ClassifyMessage.
+func FilterMessages(messages []MessageJSON, f MessageFilter) []MessageJSON {
+	filtered := []MessageJSON{}
+
+	for _, m := range messages {
+		severity := m.Severity
+		if len(severity) == 0 {
+			severity, _ = ClassifyMessage(m.Message)
+		}
+
+		if len(f.MinSeverity) > 0 && severityRank[severity] < severityRank[f.MinSeverity] {
+			continue
+		}
+
+		filtered = append(filtered, m)
+	}
+
+	if f.Limit > 0 && len(filtered) > f.Limit {
+		filtered = filtered[len(filtered)-f.Limit:]
+	}
+
+	return filtered
+}
+
+// DeviceMessages returns the messages kept for deviceName that pass f, oldest first. An empty deviceName returns the
+// messages from indiserver itself.
+func (c *INDIClient) DeviceMessages(deviceName string, f MessageFilter) ([]MessageJSON, error) {
+	if len(deviceName) == 0 {
+		c.rwm.RLock()
+		defer c.rwm.RUnlock()
+
+		return FilterMessages(c.serverMessages, f), nil
+	}
+
+	device, err := c.findPublishedDevice(c.resolveDevice(deviceName))
+	if err != nil {
+		return nil, err
+	}
+
+	return FilterMessages(device.Messages, f), nil
+}
+
+// GetPropertyMessages returns the messages kept for propName on deviceName, oldest first.
+func (c *INDIClient) GetPropertyMessages(deviceName, propName string) ([]MessageJSON, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	device, err := c.findPublishedDevice(deviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []MessageJSON
+
+	if p, ok := device.TextProperties[propName]; ok {
+		messages = p.Messages
+	} else if p, ok := device.NumberProperties[propName]; ok {
+		messages = p.Messages
+	} else if p, ok := device.SwitchProperties[propName]; ok {
+		messages = p.Messages
+	} else if p, ok := device.LightProperties[propName]; ok {
+		messages = p.Messages
+	} else if p, ok := device.BlobProperties[propName]; ok {
+		messages = p.Messages
+	} else {
+		return nil, ErrPropertyNotFound
+	}
+
+	return append([]MessageJSON{}, messages...), nil
+}
+
+// appendMessage adds m to messages of deviceName, keeping at most the device's message history of them. An empty
+// deviceName is for messages from indiserver itself. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) appendMessage(deviceName string, messages []MessageJSON, m MessageJSON) []MessageJSON {
+	n := c.historyFor(deviceName)
+	if n == 0 {
+		return messages
+	}
+
+	if len(m.Severity) == 0 {
+		m.Severity, _ = ClassifyMessage(m.Message)
+	}
+
+	return trimMessages(append(messages, m), n)
+}
+
+// historyFor returns how many messages are kept for deviceName. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) historyFor(deviceName string) int {
+	if n, ok := c.deviceHistory[deviceName]; ok && len(deviceName) > 0 {
+		return n
+	}
+
+	return c.messageHistory
+}
+
+// trimDeviceMessages trims the messages of deviceName and its properties to its message history. Only call when
+// INDIClient.rwm is locked.
+func (c *INDIClient) trimDeviceMessages(deviceName string) {
+	c.trimDeviceMessagesTo(deviceName, c.historyFor(deviceName))
+}
+
+// trimDeviceMessagesTo trims the messages of deviceName and its properties to n. Only call when INDIClient.rwm is
+// locked.
+func (c *INDIClient) trimDeviceMessagesTo(deviceName string, n int) {
+	device := c.devices[deviceName]
+
+	device.Messages = trimMessages(device.Messages, n)
+
+	for k, p := range device.TextProperties {
+		p.Messages = trimMessages(p.Messages, n)
+		device.TextProperties[k] = p
+	}
+
+	for k, p := range device.NumberProperties {
+		p.Messages = trimMessages(p.Messages, n)
+		device.NumberProperties[k] = p
+	}
+
+	for k, p := range device.SwitchProperties {
+		p.Messages = trimMessages(p.Messages, n)
+		device.SwitchProperties[k] = p
+	}
+
+	for k, p := range device.LightProperties {
+		p.Messages = trimMessages(p.Messages, n)
+		device.LightProperties[k] = p
+	}
+
+	for k, p := range device.BlobProperties {
+		p.Messages = trimMessages(p.Messages, n)
+		device.BlobProperties[k] = p
+	}
+
+	c.putDevice(deviceName, device)
+}
+
+// trimMessages drops the oldest messages so at most n are left. The result never shares its backing array with a
+// longer slice, so the dropped messages can be collected.
+func trimMessages(messages []MessageJSON, n int) []MessageJSON {
+	if len(messages) <= n {
+		return messages
+	}
+
+	return append([]MessageJSON{}, messages[len(messages)-n:]...)
+}
@@ -0,0 +1,223 @@
+package indiclient
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MessageHistory(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	c := NewINDIClient(log, nil, afero.NewMemMapFs(), 10)
+
+	c.defTextVector(&DefTextVector{Device: "Mount", Name: "STATUS", State: PropertyStateOk, Texts: []DefText{{Name: "TEXT"}}})
+
+	c.SetMessageHistory(3)
+
+	for i := 0; i < 5; i++ {
+		c.setTextVector(&SetTextVector{Device: "Mount", Name: "STATUS", State: PropertyStateOk, Message: fmt.Sprintf("message %d", i), Texts: []OneText{{Name: "TEXT"}}})
+		c.message(&Message{Device: "Mount", Message: fmt.Sprintf("device message %d", i)})
+	}
+
+	messages, err := c.GetPropertyMessages("Mount", "STATUS")
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.Equal(t, "message 2", messages[0].Message)
+	assert.Equal(t, "message 4", messages[2].Message)
+
+	device, err := c.GetDevice("Mount")
+	require.NoError(t, err)
+	assert.Len(t, device.Messages, 3)
+
+	c.SetMessageHistory(1)
+
+	messages, err = c.GetPropertyMessages("Mount", "STATUS")
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "message 4", messages[0].Message)
+
+	c.SetMessageHistory(0)
+	c.setTextVector(&SetTextVector{Device: "Mount", Name: "STATUS", State: PropertyStateOk, Message: "dropped", Texts: []OneText{{Name: "TEXT"}}})
+
+	messages, err = c.GetPropertyMessages("Mount", "STATUS")
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+
+	_, err = c.GetPropertyMessages("Mount", "MISSING")
+	assert.Equal(t, ErrPropertyNotFound, err)
+}
+
+func Test_DeviceMessageHistory(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	c := NewINDIClient(log, nil, afero.NewMemMapFs(), 10)
+
+	c.defTextVector(&DefTextVector{Device: "Mount", Name: "STATUS", State: PropertyStateOk, Texts: []DefText{{Name: "TEXT"}}})
+	c.defTextVector(&DefTextVector{Device: "Camera", Name: "STATUS", State: PropertyStateOk, Texts: []DefText{{Name: "TEXT"}}})
+
+	c.SetMessageHistory(2)
+	c.SetDeviceMessageHistory("Mount", 4)
+
+	for i := 0; i < 5; i++ {
+		c.message(&Message{Device: "Mount", Message: fmt.Sprintf("mount %d", i)})
+		c.message(&Message{Device: "Camera", Message: fmt.Sprintf("camera %d", i)})
+		c.message(&Message{Message: fmt.Sprintf("server %d", i)})
+	}
+
+	messages, err := c.DeviceMessages("Mount", MessageFilter{})
+	require.NoError(t, err)
+	assert.Len(t, messages, 4)
+
+	messages, err = c.DeviceMessages("Camera", MessageFilter{})
+	require.NoError(t, err)
+	assert.Len(t, messages, 2)
+
+	messages, err = c.DeviceMessages("", MessageFilter{})
+	require.NoError(t, err)
+	assert.Len(t, messages, 2)
+
+	c.SetDeviceMessageHistory("Mount", 1)
+
+	messages, err = c.DeviceMessages("Mount", MessageFilter{})
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "mount 4", messages[0].Message)
+
+	require.NoError(t, c.ClearMessages("Mount"))
+
+	messages, err = c.DeviceMessages("Mount", MessageFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+
+	require.NoError(t, c.ClearMessages(""))
+	assert.Empty(t, c.ServerMessages())
+
+	assert.Equal(t, ErrDeviceNotFound, c.ClearMessages("Missing"))
+
+	_, err = c.DeviceMessages("Missing", MessageFilter{})
+	assert.Equal(t, ErrDeviceNotFound, err)
+}
+
+func Test_ClearMessages_Properties(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	c := NewINDIClient(log, nil, afero.NewMemMapFs(), 10)
+
+	c.defTextVector(&DefTextVector{Device: "Mount", Name: "STATUS", State: PropertyStateOk, Texts: []DefText{{Name: "TEXT"}}})
+	c.setTextVector(&SetTextVector{Device: "Mount", Name: "STATUS", State: PropertyStateOk, Message: "parked", Texts: []OneText{{Name: "TEXT"}}})
+
+	messages, err := c.GetPropertyMessages("Mount", "STATUS")
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+
+	require.NoError(t, c.ClearMessages("Mount"))
+
+	messages, err = c.GetPropertyMessages("Mount", "STATUS")
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+
+	c.setTextVector(&SetTextVector{Device: "Mount", Name: "STATUS", State: PropertyStateOk, Message: "unparked", Texts: []OneText{{Name: "TEXT"}}})
+
+	messages, err = c.GetPropertyMessages("Mount", "STATUS")
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "unparked", messages[0].Message)
+}
+
+func Test_FilterMessages(t *testing.T) {
+	messages := []MessageJSON{
+		{Message: "[DEBUG] CMD <:GR#>"},
+		{Message: "Telescope is parked", Severity: MessageSeverityInfo},
+		{Message: "[WARNING] Slew limit reached"},
+		{Message: "no response", Severity: MessageSeverityError},
+		{Message: "[ERROR] Failed to open port"},
+	}
+
+	assert.Len(t, FilterMessages(messages, MessageFilter{}), 5)
+	assert.Len(t, FilterMessages(messages, MessageFilter{MinSeverity: MessageSeverityInfo}), 4)
+
+	filtered := FilterMessages(messages, MessageFilter{MinSeverity: MessageSeverityWarning, Limit: 2})
+	require.Len(t, filtered, 2)
+	assert.Equal(t, "no response", filtered[0].Message)
+	assert.Equal(t, "[ERROR] Failed to open port", filtered[1].Message)
+
+	assert.Empty(t, FilterMessages(nil, MessageFilter{}))
+}
+
+func Test_ClassifyMessage(t *testing.T) {
+	tests := []struct {
+		message  string
+		severity MessageSeverity
+		text     string
+	}{
+		{"[ERROR] Failed to open camera", MessageSeverityError, "Failed to open camera"},
+		{"[WARNING] Cooler power at 100%", MessageSeverityWarning, "Cooler power at 100%"},
+		{"[INFO] Exposure done, downloading image...", MessageSeverityInfo, "Exposure done, downloading image..."},
+		{"[DEBUG] CMD <:GR#>", MessageSeverityDebug, "CMD <:GR#>"},
+		{"[SCOPE] CMD <:GR#>", MessageSeverityDebug, "CMD <:GR#>"},
+		{"2021-06-01T22:13:05: [ERROR] Failed to open camera", MessageSeverityError, "Failed to open camera"},
+		{"Error: no response from mount", MessageSeverityError, "no response from mount"},
+		{"warning: slew limit reached", MessageSeverityWarning, "slew limit reached"},
+		{"Telescope is parked", MessageSeverityInfo, "Telescope is parked"},
+		{"Exposure done: 5s", MessageSeverityInfo, "Exposure done: 5s"},
+		{"[Camera] exposing", MessageSeverityInfo, "[Camera] exposing"},
+		{"[ERROR", MessageSeverityInfo, "[ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			severity, text := ClassifyMessage(tt.message)
+			assert.Equal(t, tt.severity, severity)
+			assert.Equal(t, tt.text, text)
+		})
+	}
+}
+
+func Test_MessageSeverity(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+
+	events, id, err := c.Subscribe(SubscribeOptions{Types: []EventType{EventTypeMessage}})
+	require.NoError(t, err)
+	defer c.Unsubscribe(id)
+
+	c.message(&Message{Device: "Mount", Message: "[WARNING] Mount is near the meridian"})
+
+	device, err := c.GetDevice("Mount")
+	require.NoError(t, err)
+	require.Len(t, device.Messages, 1)
+	assert.Equal(t, MessageSeverityWarning, device.Messages[0].Severity)
+
+	received := drain(events, 50*time.Millisecond)
+	require.Len(t, received, 1)
+	assert.Equal(t, MessageSeverityWarning, received[0].Severity)
+}
+
+func Test_DeviceMessages_ReadWithoutLock(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+	c.message(&Message{Device: "Mount", Message: "slewing"})
+
+	// The message handler holds the lock while it applies an update.
+	c.rwm.Lock()
+
+	done := make(chan []MessageJSON)
+	go func() {
+		messages, _ := c.DeviceMessages("Mount", MessageFilter{})
+		done <- messages
+	}()
+
+	select {
+	case messages := <-done:
+		require.Len(t, messages, 1)
+		assert.Equal(t, "slewing", messages[0].Message)
+	case <-time.After(5 * time.Second):
+		t.Fatal("DeviceMessages waited for the lock")
+	}
+
+	c.rwm.Unlock()
+}
@@ -0,0 +1,169 @@
+package indiclient
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidNumber is returned when the value of a number element cannot be parsed.
+var ErrInvalidNumber = errors.New("invalid number")
+
+// ParseNumber parses the value of a number element, which may be a decimal number or sexagesimal, such as
+// "-33:52:10.5" or "-33 52 10.5".
+func ParseNumber(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == ':' || r == ' ' })
+	if len(parts) == 0 || len(parts) > 3 {
+		return 0, ErrInvalidNumber
+	}
+
+	negative := strings.HasPrefix(s, "-")
+
+	result := 0.0
+	scale := 1.0
+
+	for _, p := range parts {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return 0, ErrInvalidNumber
+		}
+
+		result += math.Abs(f) / scale
+		scale *= 60
+	}
+
+	if negative {
+		result = -result
+	}
+
+	return result, nil
+}
+
+// FormatNumber formats value the way an INDI driver would with the printf style format of a number element. In
+// addition to the usual verbs, INDI supports %<w>.<f>m for sexagesimal values, where <w> is the total width and <f>
+// selects the precision: 3 for d:mm, 5 for d:mm.m, 6 for d:mm:ss, 8 for d:mm:ss.s and 9 for d:mm:ss.ss. Leading
+// padding is removed. If format is empty or not understood, the value is formatted with %g.
+func FormatNumber(format string, value float64) string {
+	format = strings.TrimSpace(format)
+
+	if len(format) < 2 || format[0] != '%' {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+
+	switch format[len(format)-1] {
+	case 'm':
+		var w, f int
+		if _, err := fmt.Sscanf(format, "%%%d.%dm", &w, &f); err != nil {
+			return strconv.FormatFloat(value, 'g', -1, 64)
+		}
+		return strings.TrimSpace(formatSexagesimal(value, w-f, f))
+	case 'd', 'i':
+		return strings.TrimSpace(fmt.Sprintf(format[:len(format)-1]+"d", int64(math.Round(value))))
+	case 'f', 'F', 'e', 'E', 'g', 'G':
+		return strings.TrimSpace(fmt.Sprintf(format, value))
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// formatSexagesimal is a port of fs_sexa from INDI's indicom.c. w is the width of the whole number part.
+func formatSexagesimal(value float64, w, f int) string {
+	var fracbase uint64
+
+	switch f {
+	case 9:
+		fracbase = 360000
+	case 8:
+		fracbase = 36000
+	case 6:
+		fracbase = 3600
+	case 5:
+		fracbase = 600
+	default:
+		fracbase = 60
+	}
+
+	negative := value < 0
+	if negative {
+		value = -value
+	}
+
+	n := uint64(value*float64(fracbase) + 0.5)
+	d := n / fracbase
+	frac := n % fracbase
+
+	var out string
+	if negative && d == 0 {
+		out = fmt.Sprintf("%*s-0", w-2, "")
+	} else if negative {
+		out = fmt.Sprintf("%*d", w, -int64(d))
+	} else {
+		out = fmt.Sprintf("%*d", w, d)
+	}
+
+	switch fracbase {
+	case 60:
+		out += fmt.Sprintf(":%02d", frac)
+	case 600:
+		out += fmt.Sprintf(":%02d.%1d", frac/10, frac%10)
+	case 3600:
+		out += fmt.Sprintf(":%02d:%02d", frac/60, frac%60)
+	case 36000:
+		s := frac % 600
+		out += fmt.Sprintf(":%02d:%02d.%1d", frac/600, s/10, s%10)
+	case 360000:
+		s := frac % 6000
+		out += fmt.Sprintf(":%02d:%02d.%02d", frac/6000, s/100, s%100)
+	}
+
+	return out
+}
+
+// SetNumber sends a command to the INDI server to change the values of a numberVector. Each value is formatted with
+// its element's Format (see FormatNumber), so drivers receive the encoding they expect. Waits to return until the
+// state of the vector is ok. Like SetNumberValue, it fails with a *SetError.
+func (c *INDIClient) SetNumber(deviceName, propName string, values map[string]float64) error {
+	return c.setNumber(deviceName, propName, values, SetOptions{})
+}
+
+func (c *INDIClient) setNumber(deviceName, propName string, values map[string]float64, opts SetOptions) error {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.RLock()
+	device, err := c.findDevice(deviceName)
+	if err != nil {
+		c.rwm.RUnlock()
+		return c.rejected("SetNumber", deviceName, propName, "", "", err)
+	}
+
+	prop, ok := device.NumberProperties[propName]
+	if !ok {
+		c.rwm.RUnlock()
+		return c.rejected("SetNumber", deviceName, propName, "", "", ErrPropertyNotFound)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	formatted := make([]string, len(names))
+	for i, name := range names {
+		v, ok := prop.Values[name]
+		if !ok {
+			c.rwm.RUnlock()
+			return c.rejected("SetNumber", deviceName, propName, name, prop.State, ErrPropertyValueNotFound)
+		}
+
+		formatted[i] = FormatNumber(v.Format, values[name])
+	}
+	c.rwm.RUnlock()
+
+	return c.SetNumberValueWithOptions(deviceName, propName, names, formatted, opts)
+}
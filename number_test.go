@@ -0,0 +1,55 @@
+package indiclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseNumber(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected float64
+		err      error
+	}{
+		{in: "45.5", expected: 45.5},
+		{in: " 45:30:00 ", expected: 45.5},
+		{in: "-33:52:12", expected: -(33 + 52.0/60 + 12.0/3600)},
+		{in: "-0:30", expected: -0.5},
+		{in: "10 15 36", expected: 10.26},
+		{in: "", err: ErrInvalidNumber},
+		{in: "12:ab", err: ErrInvalidNumber},
+	}
+
+	for _, tt := range tests {
+		f, err := ParseNumber(tt.in)
+		assert.Equal(t, tt.err, err, tt.in)
+		assert.InDelta(t, tt.expected, f, 1e-9, tt.in)
+	}
+}
+
+func Test_FormatNumber(t *testing.T) {
+	tests := []struct {
+		format   string
+		value    float64
+		expected string
+	}{
+		{format: "%010.6m", value: 12.5, expected: "12:30:00"},
+		{format: "%010.6m", value: -33.87, expected: "-33:52:12"},
+		{format: "%9.6m", value: -0.5, expected: "-0:30:00"},
+		{format: "%8.3m", value: 1.75, expected: "1:45"},
+		{format: "%8.5m", value: 1.755, expected: "1:45.3"},
+		{format: "%11.8m", value: 10.123, expected: "10:07:22.8"},
+		{format: "%12.9m", value: 10.5, expected: "10:30:00.00"},
+		{format: "%.f", value: 50500.4, expected: "50500"},
+		{format: "%5.2f", value: 1.234, expected: "1.23"},
+		{format: "%g", value: 46, expected: "46"},
+		{format: "%d", value: 3.6, expected: "4"},
+		{format: "", value: 12.5, expected: "12.5"},
+		{format: "%s", value: 12.5, expected: "12.5"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, FormatNumber(tt.format, tt.value), tt.format)
+	}
+}
@@ -0,0 +1,81 @@
+package indiclient
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrNumberArrayLength is returned by SetNumberArray when it is given more values than the array has elements.
+var ErrNumberArrayLength = errors.New("too many values for number array")
+
+// Some drivers number the elements of a vector to group them into arrays, such as the positions of the stars a guide
+// camera detected in STAR_X_1, STAR_X_2... STAR_X_N. The NumberArray methods read and write such a family as a slice,
+// where prefix is the name of its elements without their number, such as "STAR_X_". Elements are numbered from 1, and
+// the size of an array is the number of elements, as defined by the driver, from 1 until the first missing number.
+
+// NumberArrayLen returns the number of elements in the array prefix of propName on deviceName.
+func (c *INDIClient) NumberArrayLen(deviceName, propName, prefix string) (int, error) {
+	prop, err := c.GetNumberProperty(deviceName, propName)
+	if err != nil {
+		return 0, err
+	}
+
+	return numberArrayLen(prop, prefix), nil
+}
+
+// GetNumberArray returns the values of the elements in the array prefix of propName on deviceName, in order. It
+// returns an empty slice if the property has no such elements.
+func (c *INDIClient) GetNumberArray(deviceName, propName, prefix string) ([]float64, error) {
+	prop, err := c.GetNumberProperty(deviceName, propName)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]float64, numberArrayLen(prop, prefix))
+
+	for i := range values {
+		values[i], err = ParseNumber(prop.Values[numberArrayElement(prefix, i)].Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// SetNumberArray sends a command to the INDI server to change the first len(values) elements in the array prefix of
+// propName on deviceName, formatted as SetNumber does. It returns ErrNumberArrayLength if the array has fewer
+// elements than values. Waits to return until the state of the vector is ok.
+func (c *INDIClient) SetNumberArray(deviceName, propName, prefix string, values []float64) error {
+	prop, err := c.GetNumberProperty(deviceName, propName)
+	if err != nil {
+		return err
+	}
+
+	if len(values) > numberArrayLen(prop, prefix) {
+		return ErrNumberArrayLength
+	}
+
+	named := make(map[string]float64, len(values))
+	for i, v := range values {
+		named[numberArrayElement(prefix, i)] = v
+	}
+
+	return c.SetNumber(deviceName, propName, named)
+}
+
+// numberArrayLen returns the number of elements in the array prefix of prop.
+func numberArrayLen(prop NumberProperty, prefix string) int {
+	n := 0
+	for {
+		if _, ok := prop.Values[numberArrayElement(prefix, n)]; !ok {
+			return n
+		}
+		n++
+	}
+}
+
+// numberArrayElement returns the name of the element at index i, counting from zero, of the array prefix.
+func numberArrayElement(prefix string, i int) string {
+	return prefix + strconv.Itoa(i+1)
+}
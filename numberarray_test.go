@@ -0,0 +1,55 @@
+package indiclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NumberArray(t *testing.T) {
+	c := newTestClient()
+	c.defNumberVector(&DefNumberVector{
+		Device: "Guide Camera",
+		Name:   "GUIDE_STARS",
+		State:  PropertyStateIdle,
+		Perm:   PropertyPermissionReadWrite,
+		Numbers: []DefNumber{
+			{Name: "STAR_X_1", Value: "10.5", Format: "%.2f"},
+			{Name: "STAR_Y_1", Value: "20"},
+			{Name: "STAR_X_2", Value: "30", Format: "%.2f"},
+			{Name: "STAR_Y_2", Value: "40"},
+			{Name: "STAR_X_3", Value: "50", Format: "%.2f"},
+			// Not part of STAR_Y_, which stops at the first missing number.
+			{Name: "STAR_Y_4", Value: "60"},
+		},
+	})
+
+	n, err := c.NumberArrayLen("Guide Camera", "GUIDE_STARS", "STAR_X_")
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	xs, err := c.GetNumberArray("Guide Camera", "GUIDE_STARS", "STAR_X_")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{10.5, 30, 50}, xs)
+
+	ys, err := c.GetNumberArray("Guide Camera", "GUIDE_STARS", "STAR_Y_")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{20, 40}, ys)
+
+	none, err := c.GetNumberArray("Guide Camera", "GUIDE_STARS", "HFR_")
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	_, err = c.GetNumberArray("Guide Camera", "STARS", "STAR_X_")
+	assert.Equal(t, ErrPropertyNotFound, err)
+
+	assert.Equal(t, ErrNumberArrayLength, c.SetNumberArray("Guide Camera", "GUIDE_STARS", "STAR_Y_", []float64{1, 2, 3}))
+
+	// Without a connection, this would block forever if it was sent.
+	c.SetDryRun(true)
+
+	err = c.SetNumberArray("Guide Camera", "GUIDE_STARS", "STAR_X_", []float64{1, 2})
+	require.IsType(t, &DryRunError{}, err)
+	assert.Equal(t, `<newNumberVector device="Guide Camera" name="GUIDE_STARS"><oneNumber name="STAR_X_1">1.00</oneNumber><oneNumber name="STAR_X_2">2.00</oneNumber></newNumberVector>`, err.(*DryRunError).XML)
+}
@@ -0,0 +1,169 @@
+package observatory
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// ErrCoolerSaturated is returned by TemperatureController.RampTo when the cooler power reaches
+// CoolingOptions.MaxCoolerPower, so the sensor cannot be cooled any further without the temperature becoming unstable.
+var ErrCoolerSaturated = errors.New("cooler is saturated")
+
+const (
+	// DefaultCoolingRate is the default rate the setpoint changes at, in degrees Celsius per minute.
+	DefaultCoolingRate = 2.0
+	// DefaultCoolingInterval is the default time between steps of the setpoint.
+	DefaultCoolingInterval = 10 * time.Second
+	// DefaultCoolingTolerance is the default distance from the setpoint, in degrees Celsius, the temperature is
+	// stable within.
+	DefaultCoolingTolerance = 0.5
+	// DefaultCoolingSettle is the default time the temperature must stay within the tolerance to be stable.
+	DefaultCoolingSettle = time.Minute
+)
+
+// CoolingOptions controls how a TemperatureController changes the temperature of a camera.
+type CoolingOptions struct {
+	// Rate is how fast the setpoint changes, in degrees Celsius per minute. Defaults to DefaultCoolingRate.
+	Rate float64 `json:"rate"`
+	// Interval is the time between steps of the setpoint, and between readings of the temperature while waiting for
+	// it to be stable. Defaults to DefaultCoolingInterval.
+	Interval time.Duration `json:"interval"`
+	// Tolerance is how close to the setpoint the temperature must be to be stable, in degrees Celsius. Defaults to
+	// DefaultCoolingTolerance.
+	Tolerance float64 `json:"tolerance"`
+	// Settle is how long the temperature must stay within Tolerance to be stable. Defaults to DefaultCoolingSettle.
+	Settle time.Duration `json:"settle"`
+	// MaxCoolerPower, if set, is the cooler power, in percent, at which RampTo stops cooling and returns
+	// ErrCoolerSaturated. Warming is never stopped.
+	MaxCoolerPower float64 `json:"maxCoolerPower"`
+}
+
+// TemperatureController changes the temperature of a camera gradually, stepping CCD_TEMPERATURE towards the target
+// rather than setting it at once, which protects the sensor from thermal shock.
+type TemperatureController struct {
+	camera *Camera
+	opts   CoolingOptions
+}
+
+// NewTemperatureController creates a TemperatureController for camera. Zero options are replaced by their defaults.
+func NewTemperatureController(camera *Camera, opts CoolingOptions) *TemperatureController {
+	if opts.Rate <= 0 {
+		opts.Rate = DefaultCoolingRate
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultCoolingInterval
+	}
+
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = DefaultCoolingTolerance
+	}
+
+	if opts.Settle <= 0 {
+		opts.Settle = DefaultCoolingSettle
+	}
+
+	return &TemperatureController{camera: camera, opts: opts}
+}
+
+// RampTo steps the setpoint from the current temperature to celsius at CoolingOptions.Rate, then waits until the
+// temperature is stable. See WaitStable. If ctx is cancelled, the setpoint is left where it was.
+func (tc *TemperatureController) RampTo(ctx context.Context, celsius float64) error {
+	setpoint, err := tc.camera.Temperature()
+	if err != nil {
+		return err
+	}
+
+	clock := tc.camera.c.Clock()
+	step := tc.opts.Rate * tc.opts.Interval.Minutes()
+
+	for setpoint != celsius {
+		start := clock.Now()
+
+		if celsius < setpoint {
+			if tc.saturated() {
+				return ErrCoolerSaturated
+			}
+
+			setpoint = math.Max(celsius, setpoint-step)
+		} else {
+			setpoint = math.Min(celsius, setpoint+step)
+		}
+
+		if err := tc.camera.SetTemperature(ctx, setpoint); err != nil {
+			return err
+		}
+
+		if setpoint == celsius {
+			break
+		}
+
+		if err := wait(ctx, clock, tc.opts.Interval-clock.Now().Sub(start)); err != nil {
+			return err
+		}
+	}
+
+	return tc.WaitStable(ctx, celsius)
+}
+
+// WaitStable waits until the temperature has stayed within CoolingOptions.Tolerance of celsius for
+// CoolingOptions.Settle.
+func (tc *TemperatureController) WaitStable(ctx context.Context, celsius float64) error {
+	clock := tc.camera.c.Clock()
+
+	var since time.Time
+
+	for {
+		temp, err := tc.camera.Temperature()
+		if err != nil {
+			return err
+		}
+
+		if math.Abs(temp-celsius) > tc.opts.Tolerance {
+			since = time.Time{}
+		} else if since.IsZero() {
+			since = clock.Now()
+		}
+
+		if !since.IsZero() && clock.Now().Sub(since) >= tc.opts.Settle {
+			return nil
+		}
+
+		if err := wait(ctx, clock, tc.opts.Interval); err != nil {
+			return err
+		}
+	}
+}
+
+// saturated returns true if the cooler power has reached CoolingOptions.MaxCoolerPower. Cameras that do not report
+// their cooler power are never saturated.
+func (tc *TemperatureController) saturated() bool {
+	if tc.opts.MaxCoolerPower <= 0 {
+		return false
+	}
+
+	power, err := tc.camera.CoolerPower()
+	if err != nil {
+		return false
+	}
+
+	return power >= tc.opts.MaxCoolerPower
+}
+
+// wait waits for d on clock, returning early if ctx is cancelled.
+func wait(ctx context.Context, clock indiclient.Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	select {
+	case <-clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
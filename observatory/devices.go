@@ -0,0 +1,350 @@
+package observatory
+
+import (
+	"context"
+	"errors"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/astro"
+)
+
+// ErrFilterNotFound is returned by FilterWheel.SetFilter when the wheel has no filter with the given name.
+var ErrFilterNotFound = errors.New("filter not found")
+
+// Telescope controls a mount through the standard INDI telescope properties. Coordinates are JNow, with RA in hours
+// and Dec in degrees, as in EQUATORIAL_EOD_COORD.
+type Telescope struct {
+	c    *indiclient.INDIClient
+	name string
+}
+
+// NewTelescope creates a Telescope for the mount deviceName.
+func NewTelescope(c *indiclient.INDIClient, deviceName string) *Telescope {
+	return &Telescope{c: c, name: deviceName}
+}
+
+// Name returns the device name.
+func (t *Telescope) Name() string {
+	return t.name
+}
+
+// Park parks the mount, waiting until it is parked.
+func (t *Telescope) Park(ctx context.Context) error {
+	return do(ctx, func() error {
+		return t.c.SelectSwitch(t.name, "TELESCOPE_PARK", "PARK")
+	})
+}
+
+// Unpark unparks the mount.
+func (t *Telescope) Unpark(ctx context.Context) error {
+	return do(ctx, func() error {
+		return t.c.SelectSwitch(t.name, "TELESCOPE_PARK", "UNPARK")
+	})
+}
+
+// Parked returns true if the mount is parked.
+func (t *Telescope) Parked() (bool, error) {
+	return switchOn(t.c, t.name, "TELESCOPE_PARK", "PARK")
+}
+
+// Coordinates returns where the mount is pointing.
+func (t *Telescope) Coordinates() (ra, dec float64, err error) {
+	ra, err = number(t.c, t.name, "EQUATORIAL_EOD_COORD", "RA")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	dec, err = number(t.c, t.name, "EQUATORIAL_EOD_COORD", "DEC")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return ra, dec, nil
+}
+
+// SlewTo slews the mount to ra and dec and tracks there, waiting until the slew is complete. If ctx is cancelled,
+// the slew is left to finish; call Abort to stop it.
+func (t *Telescope) SlewTo(ctx context.Context, ra, dec float64) error {
+	return t.setCoordinates(ctx, "TRACK", ra, dec)
+}
+
+// SlewToJ2000 slews the mount to J2000 coordinates, such as those from a catalog or a plate solver, precessing them
+// to JNow first. See SlewTo.
+func (t *Telescope) SlewToJ2000(ctx context.Context, ra, dec float64) error {
+	ra, dec = astro.ToJNow(ra, dec, t.c.Clock().Now())
+	return t.SlewTo(ctx, ra, dec)
+}
+
+// AltAz returns the altitude and azimuth the mount is pointing at from site, without refraction.
+func (t *Telescope) AltAz(site indiclient.Site) (alt, az float64, err error) {
+	ra, dec, err := t.Coordinates()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	alt, az = astro.AltAz(ra, dec, site, t.c.Clock().Now())
+
+	return alt, az, nil
+}
+
+// Sync tells the mount it is pointing at ra and dec, without moving it.
+func (t *Telescope) Sync(ctx context.Context, ra, dec float64) error {
+	err := t.setCoordinates(ctx, "SYNC", ra, dec)
+	if err != nil {
+		return err
+	}
+
+	// Leave the mount tracking, so the next command is a slew rather than another sync.
+	return do(ctx, func() error {
+		return t.c.SelectSwitch(t.name, "ON_COORD_SET", "TRACK")
+	})
+}
+
+func (t *Telescope) setCoordinates(ctx context.Context, action string, ra, dec float64) error {
+	return do(ctx, func() error {
+		if err := t.c.SelectSwitch(t.name, "ON_COORD_SET", action); err != nil {
+			return err
+		}
+
+		return t.c.SetNumber(t.name, "EQUATORIAL_EOD_COORD", map[string]float64{"RA": ra, "DEC": dec})
+	})
+}
+
+// Abort stops any motion of the mount.
+func (t *Telescope) Abort() error {
+	return t.c.SelectSwitch(t.name, "TELESCOPE_ABORT_MOTION", "ABORT")
+}
+
+// Camera controls a camera through the standard INDI CCD properties.
+type Camera struct {
+	c    *indiclient.INDIClient
+	name string
+}
+
+// NewCamera creates a Camera for the camera deviceName.
+func NewCamera(c *indiclient.INDIClient, deviceName string) *Camera {
+	return &Camera{c: c, name: deviceName}
+}
+
+// Name returns the device name.
+func (cam *Camera) Name() string {
+	return cam.name
+}
+
+// Expose takes an exposure and returns the frame. See INDIClient.CaptureFrame.
+func (cam *Camera) Expose(ctx context.Context, seconds float64) (indiclient.BlobEvent, error) {
+	return cam.c.CaptureFrame(ctx, cam.name, seconds)
+}
+
+// SetTemperature sets the cooler setpoint, in degrees Celsius, waiting until the sensor reaches it.
+func (cam *Camera) SetTemperature(ctx context.Context, celsius float64) error {
+	return do(ctx, func() error {
+		return cam.c.SetNumber(cam.name, "CCD_TEMPERATURE", map[string]float64{"CCD_TEMPERATURE_VALUE": celsius})
+	})
+}
+
+// Temperature returns the sensor temperature, in degrees Celsius.
+func (cam *Camera) Temperature() (float64, error) {
+	return number(cam.c, cam.name, "CCD_TEMPERATURE", "CCD_TEMPERATURE_VALUE")
+}
+
+// CoolerPower returns the power of the cooler, in percent.
+func (cam *Camera) CoolerPower() (float64, error) {
+	return number(cam.c, cam.name, "CCD_COOLER_POWER", "CCD_COOLER_VALUE")
+}
+
+// FilterWheel controls a filter wheel through FILTER_SLOT and FILTER_NAME.
+type FilterWheel struct {
+	c    *indiclient.INDIClient
+	name string
+}
+
+// NewFilterWheel creates a FilterWheel for the filter wheel deviceName.
+func NewFilterWheel(c *indiclient.INDIClient, deviceName string) *FilterWheel {
+	return &FilterWheel{c: c, name: deviceName}
+}
+
+// Name returns the device name.
+func (w *FilterWheel) Name() string {
+	return w.name
+}
+
+// Filters returns the names of the filters, in slot order.
+func (w *FilterWheel) Filters() ([]string, error) {
+	prop, err := w.c.GetTextProperty(w.name, "FILTER_NAME")
+	if err != nil {
+		return nil, err
+	}
+
+	filters := make([]string, 0, len(prop.Order))
+	for _, name := range prop.Order {
+		filters = append(filters, prop.Values[name].Value)
+	}
+
+	return filters, nil
+}
+
+// Filter returns the name of the selected filter.
+func (w *FilterWheel) Filter() (string, error) {
+	slot, err := number(w.c, w.name, "FILTER_SLOT", "FILTER_SLOT_VALUE")
+	if err != nil {
+		return "", err
+	}
+
+	filters, err := w.Filters()
+	if err != nil {
+		return "", err
+	}
+
+	if slot < 1 || int(slot) > len(filters) {
+		return "", ErrFilterNotFound
+	}
+
+	return filters[int(slot)-1], nil
+}
+
+// SetFilter moves the wheel to the filter named filter, waiting until it is in place.
+func (w *FilterWheel) SetFilter(ctx context.Context, filter string) error {
+	filters, err := w.Filters()
+	if err != nil {
+		return err
+	}
+
+	for i, f := range filters {
+		if f == filter {
+			return w.SetSlot(ctx, i+1)
+		}
+	}
+
+	return ErrFilterNotFound
+}
+
+// SetSlot moves the wheel to slot, counting from 1, waiting until it is in place.
+func (w *FilterWheel) SetSlot(ctx context.Context, slot int) error {
+	return do(ctx, func() error {
+		return w.c.SetNumber(w.name, "FILTER_SLOT", map[string]float64{"FILTER_SLOT_VALUE": float64(slot)})
+	})
+}
+
+// Focuser controls an absolute focuser through ABS_FOCUS_POSITION.
+type Focuser struct {
+	c    *indiclient.INDIClient
+	name string
+}
+
+// NewFocuser creates a Focuser for the focuser deviceName.
+func NewFocuser(c *indiclient.INDIClient, deviceName string) *Focuser {
+	return &Focuser{c: c, name: deviceName}
+}
+
+// Name returns the device name.
+func (f *Focuser) Name() string {
+	return f.name
+}
+
+// Position returns the focuser position, in steps.
+func (f *Focuser) Position() (float64, error) {
+	return number(f.c, f.name, "ABS_FOCUS_POSITION", "FOCUS_ABSOLUTE_POSITION")
+}
+
+// MoveTo moves the focuser to position, waiting until it gets there.
+func (f *Focuser) MoveTo(ctx context.Context, position float64) error {
+	return do(ctx, func() error {
+		return f.c.SetNumber(f.name, "ABS_FOCUS_POSITION", map[string]float64{"FOCUS_ABSOLUTE_POSITION": position})
+	})
+}
+
+// Dome controls a dome or roll-off roof through DOME_SHUTTER and DOME_PARK.
+type Dome struct {
+	c    *indiclient.INDIClient
+	name string
+}
+
+// NewDome creates a Dome for the dome deviceName.
+func NewDome(c *indiclient.INDIClient, deviceName string) *Dome {
+	return &Dome{c: c, name: deviceName}
+}
+
+// Name returns the device name.
+func (d *Dome) Name() string {
+	return d.name
+}
+
+// Open opens the shutter, waiting until it is open.
+func (d *Dome) Open(ctx context.Context) error {
+	return do(ctx, func() error {
+		return d.c.SelectSwitch(d.name, "DOME_SHUTTER", "SHUTTER_OPEN")
+	})
+}
+
+// Close closes the shutter, waiting until it is closed.
+func (d *Dome) Close(ctx context.Context) error {
+	return do(ctx, func() error {
+		return d.c.SelectSwitch(d.name, "DOME_SHUTTER", "SHUTTER_CLOSE")
+	})
+}
+
+// ShutterOpen returns true if the shutter is open.
+func (d *Dome) ShutterOpen() (bool, error) {
+	return switchOn(d.c, d.name, "DOME_SHUTTER", "SHUTTER_OPEN")
+}
+
+// Park parks the dome. Domes without DOME_PARK, such as most roll-off roofs, are left as they are.
+func (d *Dome) Park(ctx context.Context) error {
+	return d.park(ctx, "PARK")
+}
+
+// Unpark unparks the dome. Domes without DOME_PARK are left as they are.
+func (d *Dome) Unpark(ctx context.Context) error {
+	return d.park(ctx, "UNPARK")
+}
+
+func (d *Dome) park(ctx context.Context, action string) error {
+	if !d.c.SwitchPropertySet(d.name, "DOME_PARK") {
+		return nil
+	}
+
+	return do(ctx, func() error {
+		return d.c.SelectSwitch(d.name, "DOME_PARK", action)
+	})
+}
+
+// number returns the value of a number element.
+func number(c *indiclient.INDIClient, deviceName, propName, numberName string) (float64, error) {
+	v, err := c.GetNumber(deviceName, propName, numberName)
+	if err != nil {
+		return 0, err
+	}
+
+	return indiclient.ParseNumber(v.Value)
+}
+
+// switchOn returns true if a switch element is on.
+func switchOn(c *indiclient.INDIClient, deviceName, propName, switchName string) (bool, error) {
+	v, err := c.GetSwitch(deviceName, propName, switchName)
+	if err != nil {
+		return false, err
+	}
+
+	return v.Value == indiclient.SwitchStateOn, nil
+}
+
+// do runs fn, which blocks until a command completes, returning early if ctx is cancelled.
+func do(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
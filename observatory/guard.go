@@ -0,0 +1,330 @@
+package observatory
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/astro"
+)
+
+var (
+	// ErrBelowHorizon is reported by Limits.Check when a position is below the horizon profile or the minimum
+	// altitude.
+	ErrBelowHorizon = errors.New("position is below the horizon limit")
+	// ErrForbiddenZone is reported by Limits.Check when a position is in one of the forbidden zones.
+	ErrForbiddenZone = errors.New("position is in a forbidden zone")
+	// ErrInvalidHorizon is returned by LoadHorizon when a line of the file is not an azimuth and an altitude.
+	ErrInvalidHorizon = errors.New("invalid horizon file")
+)
+
+// HorizonPoint is the lowest altitude the mount may point at in the direction of Azimuth, both in degrees. Azimuth
+// is measured from north through east.
+type HorizonPoint struct {
+	Azimuth  float64 `json:"azimuth"`
+	Altitude float64 `json:"altitude"`
+}
+
+// Horizon is a horizon profile, such as the outline of trees and buildings around the site. Between points the
+// altitude is interpolated linearly, wrapping around at north.
+type Horizon []HorizonPoint
+
+// LoadHorizon reads a horizon profile saved at path on fs as lines of azimuth and altitude separated by spaces, the
+// format most planetarium and sequencing programs export. Blank lines and lines starting with # are ignored.
+func LoadHorizon(fs afero.Fs, path string) (Horizon, error) {
+	b, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	h := Horizon{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, ErrInvalidHorizon
+		}
+
+		az, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, ErrInvalidHorizon
+		}
+
+		alt, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, ErrInvalidHorizon
+		}
+
+		h = append(h, HorizonPoint{Azimuth: az, Altitude: alt})
+	}
+
+	return h, scanner.Err()
+}
+
+// Altitude returns the altitude of the horizon at az. An empty horizon is at -90 degrees everywhere.
+func (h Horizon) Altitude(az float64) float64 {
+	n := len(h)
+	if n == 0 {
+		return -90
+	}
+
+	points := make(Horizon, n)
+	for i, p := range h {
+		points[i] = HorizonPoint{Azimuth: normalizeAzimuth(p.Azimuth), Altitude: p.Altitude}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Azimuth < points[j].Azimuth })
+
+	az = normalizeAzimuth(az)
+
+	i := sort.Search(n, func(i int) bool { return points[i].Azimuth > az })
+
+	prev, next := points[(i+n-1)%n], points[i%n]
+	prevAz, nextAz := prev.Azimuth, next.Azimuth
+
+	// Wrap around at north.
+	if i == 0 {
+		prevAz -= 360
+	}
+	if i == n {
+		nextAz += 360
+	}
+
+	if nextAz == prevAz {
+		return prev.Altitude
+	}
+
+	return prev.Altitude + (az-prevAz)/(nextAz-prevAz)*(next.Altitude-prev.Altitude)
+}
+
+func normalizeAzimuth(az float64) float64 {
+	for az < 0 {
+		az += 360
+	}
+	for az >= 360 {
+		az -= 360
+	}
+	return az
+}
+
+// Zone is a range of hour angle, in hours from -12 to 12, and declination, in degrees, the mount must not enter, such
+// as where the camera would hit the pier or a tripod leg.
+type Zone struct {
+	MinHourAngle float64 `json:"minHourAngle"`
+	MaxHourAngle float64 `json:"maxHourAngle"`
+	MinDec       float64 `json:"minDec"`
+	MaxDec       float64 `json:"maxDec"`
+}
+
+// Contains returns true if ha and dec are inside z.
+func (z Zone) Contains(ha, dec float64) bool {
+	return ha >= z.MinHourAngle && ha <= z.MaxHourAngle && dec >= z.MinDec && dec <= z.MaxDec
+}
+
+// Limits are where the mount may point.
+type Limits struct {
+	// MinAltitude is the lowest altitude, in degrees, the mount may point at in any direction.
+	MinAltitude float64 `json:"minAltitude"`
+	// Horizon further limits the altitude by direction.
+	Horizon Horizon `json:"horizon,omitempty"`
+	// Zones are forbidden regardless of altitude.
+	Zones []Zone `json:"zones,omitempty"`
+}
+
+// Check returns ErrBelowHorizon or ErrForbiddenZone if ra and dec, JNow, are outside the limits as seen from site at
+// t, and nil otherwise. Refraction is ignored.
+func (l Limits) Check(ra, dec float64, site indiclient.Site, t time.Time) error {
+	alt, az := astro.AltAz(ra, dec, site, t)
+
+	if alt < l.MinAltitude || alt < l.Horizon.Altitude(az) {
+		return ErrBelowHorizon
+	}
+
+	ha := astro.HourAngle(ra, site, t)
+
+	for _, z := range l.Zones {
+		if z.Contains(ha, dec) {
+			return ErrForbiddenZone
+		}
+	}
+
+	return nil
+}
+
+// Violation describes the mount entering a position outside its limits.
+type Violation struct {
+	// Err is ErrBelowHorizon or ErrForbiddenZone.
+	Err error
+	// RA and Dec are where the mount was, JNow, and Altitude, Azimuth and HourAngle the same position seen from the
+	// site.
+	RA        float64
+	Dec       float64
+	Altitude  float64
+	Azimuth   float64
+	HourAngle float64
+	Time      time.Time
+	// AbortErr is the error from sending TELESCOPE_ABORT_MOTION, if any.
+	AbortErr error
+}
+
+// Guard watches the coordinates of a mount, and aborts its motion when it enters a position outside its limits. The
+// site is read from the mount's GEOGRAPHIC_COORD. The mount is only stopped as it enters a forbidden position, so a
+// slew back out is allowed; it may move within forbidden positions again once it has been back inside its limits.
+// Positions are not checked while the mount is parked or parking, since park positions are often below the horizon.
+type Guard struct {
+	log       logging.Logger
+	c         *indiclient.INDIClient
+	telescope *Telescope
+	limits    Limits
+	id        string
+
+	mu        sync.Mutex
+	violating bool
+	handlers  map[string]func(Violation)
+}
+
+// NewGuard creates a Guard for the mount deviceName. The device does not need to be defined yet. Remember to call
+// Close when you are done with it.
+func NewGuard(log logging.Logger, c *indiclient.INDIClient, deviceName string, limits Limits) (*Guard, error) {
+	events, id, err := c.Subscribe(indiclient.SubscribeOptions{Device: deviceName})
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Guard{
+		log:       log.WithField("device", deviceName),
+		c:         c,
+		telescope: NewTelescope(c, deviceName),
+		limits:    limits,
+		id:        id,
+		handlers:  map[string]func(Violation){},
+	}
+
+	go g.run(events)
+
+	return g, nil
+}
+
+// OnViolation registers fn to be called each time the mount enters a position outside its limits, after its motion
+// has been aborted. Handlers are called one at a time on the guard's goroutine. Use RemoveHandler with the returned
+// id to unregister it.
+func (g *Guard) OnViolation(fn func(Violation)) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id := uuid.New().String()
+	g.handlers[id] = fn
+
+	return id
+}
+
+// RemoveHandler unregisters a handler added by OnViolation.
+func (g *Guard) RemoveHandler(id string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.handlers[id]; !ok {
+		return indiclient.ErrSubscriptionNotFound
+	}
+
+	delete(g.handlers, id)
+
+	return nil
+}
+
+// Close stops the guard. Handlers are not called after Close returns.
+func (g *Guard) Close() error {
+	g.mu.Lock()
+	g.handlers = map[string]func(Violation){}
+	g.mu.Unlock()
+
+	return g.c.Unsubscribe(g.id)
+}
+
+func (g *Guard) run(events <-chan indiclient.Event) {
+	for e := range events {
+		if e.Property != "EQUATORIAL_EOD_COORD" || (e.Type != indiclient.EventTypeDefine && e.Type != indiclient.EventTypeUpdate) {
+			continue
+		}
+
+		g.check()
+	}
+}
+
+func (g *Guard) check() {
+	if g.parking() {
+		g.mu.Lock()
+		g.violating = false
+		g.mu.Unlock()
+		return
+	}
+
+	ra, dec, err := g.telescope.Coordinates()
+	if err != nil {
+		return
+	}
+
+	site, err := g.c.GetSite(g.telescope.Name())
+	if err != nil {
+		g.log.WithError(err).Warn("could not read site, limits not checked")
+		return
+	}
+
+	now := g.c.Clock().Now()
+	err = g.limits.Check(ra, dec, site, now)
+
+	g.mu.Lock()
+	entered := err != nil && !g.violating
+	g.violating = err != nil
+	g.mu.Unlock()
+
+	if !entered {
+		return
+	}
+
+	v := Violation{Err: err, RA: ra, Dec: dec, HourAngle: astro.HourAngle(ra, site, now), Time: now}
+	v.Altitude, v.Azimuth = astro.AltAz(ra, dec, site, now)
+
+	g.log.WithError(err).WithField("ra", ra).WithField("dec", dec).Warn("mount outside limits, aborting motion")
+
+	v.AbortErr = g.telescope.Abort()
+	if v.AbortErr != nil {
+		g.log.WithError(v.AbortErr).Error("could not abort motion")
+	}
+
+	g.mu.Lock()
+	handlers := []func(Violation){}
+	for _, fn := range g.handlers {
+		handlers = append(handlers, fn)
+	}
+	g.mu.Unlock()
+
+	for _, fn := range handlers {
+		fn(v)
+	}
+}
+
+// parking returns true if the mount is parked or parking.
+func (g *Guard) parking() bool {
+	prop, err := g.c.GetSwitchProperty(g.telescope.Name(), "TELESCOPE_PARK")
+	if err != nil {
+		return false
+	}
+
+	return prop.State == indiclient.PropertyStateBusy || prop.Values["PARK"].Value == indiclient.SwitchStateOn
+}
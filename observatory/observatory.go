@@ -0,0 +1,237 @@
+// Package observatory automates a whole observatory: the mount, camera, filter wheel, focuser, dome and safety
+// monitor configured in a file, with one call to open up at dusk and one to close down at dawn:
+//
+//	cfg, err := observatory.LoadConfig(fs, "observatory.json")
+//	...
+//	o, err := observatory.New(log, c, cfg)
+//	...
+//	defer o.Close()
+//
+//	err = o.StartupSequence(ctx)
+//	...
+//	err = o.ShutdownSequence(ctx)
+//
+// Each device is optional; the sequences skip the steps for devices that are not configured. The device wrappers can
+// also be used on their own.
+package observatory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+
+	"github.com/goastro/indiclient"
+)
+
+// ErrUnsafe is returned by StartupSequence when the safety monitor reports that conditions are unsafe.
+var ErrUnsafe = errors.New("conditions are unsafe")
+
+// Config names the devices of an observatory, and how the camera is cooled.
+type Config struct {
+	Telescope     string `json:"telescope"`
+	Camera        string `json:"camera"`
+	FilterWheel   string `json:"filterWheel"`
+	Focuser       string `json:"focuser"`
+	Dome          string `json:"dome"`
+	SafetyMonitor string `json:"safetyMonitor"`
+	// CoolingTemperature, if set, is the setpoint StartupSequence cools the camera to, in degrees Celsius.
+	CoolingTemperature *float64 `json:"coolingTemperature,omitempty"`
+	// WarmTemperature, if set, is the setpoint ShutdownSequence warms the camera to, in degrees Celsius, so the
+	// sensor does not see a sudden change in temperature when the camera is turned off.
+	WarmTemperature *float64 `json:"warmTemperature,omitempty"`
+	// Cooling, if set, makes the sequences change the camera temperature gradually with a TemperatureController,
+	// rather than setting it at once.
+	Cooling *CoolingOptions `json:"cooling,omitempty"`
+	// Limits, if set, are where the telescope may point. A Guard aborts its motion when it leaves them.
+	Limits *Limits `json:"limits,omitempty"`
+}
+
+// LoadConfig reads a Config saved as JSON at path on fs.
+func LoadConfig(fs afero.Fs, path string) (Config, error) {
+	cfg := Config{}
+
+	b, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = json.Unmarshal(b, &cfg)
+
+	return cfg, err
+}
+
+// Observatory is the set of devices of an observatory. Devices that are not configured are nil.
+type Observatory struct {
+	Telescope     *Telescope
+	Camera        *Camera
+	FilterWheel   *FilterWheel
+	Focuser       *Focuser
+	Dome          *Dome
+	SafetyMonitor *indiclient.SafetyMonitor
+	// Guard watches the telescope's limits, if there is a telescope and Config.Limits is set.
+	Guard *Guard
+
+	log logging.Logger
+	cfg Config
+}
+
+// New creates an Observatory for the devices in cfg. The devices do not need to be defined yet. Remember to call
+// Close when you are done with it.
+func New(log logging.Logger, c *indiclient.INDIClient, cfg Config) (*Observatory, error) {
+	o := &Observatory{log: log, cfg: cfg}
+
+	if len(cfg.Telescope) > 0 {
+		o.Telescope = NewTelescope(c, cfg.Telescope)
+	}
+
+	if len(cfg.Camera) > 0 {
+		o.Camera = NewCamera(c, cfg.Camera)
+	}
+
+	if len(cfg.FilterWheel) > 0 {
+		o.FilterWheel = NewFilterWheel(c, cfg.FilterWheel)
+	}
+
+	if len(cfg.Focuser) > 0 {
+		o.Focuser = NewFocuser(c, cfg.Focuser)
+	}
+
+	if len(cfg.Dome) > 0 {
+		o.Dome = NewDome(c, cfg.Dome)
+	}
+
+	if len(cfg.SafetyMonitor) > 0 {
+		m, err := indiclient.NewSafetyMonitor(c, cfg.SafetyMonitor)
+		if err != nil {
+			return nil, err
+		}
+		o.SafetyMonitor = m
+	}
+
+	if o.Telescope != nil && cfg.Limits != nil {
+		g, err := NewGuard(log, c, cfg.Telescope, *cfg.Limits)
+		if err != nil {
+			o.Close()
+			return nil, err
+		}
+		o.Guard = g
+	}
+
+	return o, nil
+}
+
+// Close stops the safety monitor and the guard.
+func (o *Observatory) Close() error {
+	var first error
+
+	if o.SafetyMonitor != nil {
+		first = o.SafetyMonitor.Close()
+	}
+
+	if o.Guard != nil {
+		if err := o.Guard.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// StartupSequence opens the observatory: it checks the safety monitor, unparks the dome and opens its shutter,
+// unparks the mount, and cools the camera to Config.CoolingTemperature. It stops at the first step that fails.
+func (o *Observatory) StartupSequence(ctx context.Context) error {
+	if o.SafetyMonitor != nil && !o.SafetyMonitor.IsSafe() {
+		return ErrUnsafe
+	}
+
+	steps := []step{}
+
+	if o.Dome != nil {
+		steps = append(steps,
+			step{"unpark dome", o.Dome.Unpark},
+			step{"open dome", o.Dome.Open},
+		)
+	}
+
+	if o.Telescope != nil {
+		steps = append(steps, step{"unpark telescope", o.Telescope.Unpark})
+	}
+
+	if o.Camera != nil && o.cfg.CoolingTemperature != nil {
+		steps = append(steps, step{"cool camera", o.setTemperature(*o.cfg.CoolingTemperature)})
+	}
+
+	for _, s := range steps {
+		if err := o.run(ctx, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ShutdownSequence closes the observatory: it warms the camera to Config.WarmTemperature, parks the mount, closes
+// the dome's shutter and parks the dome. A step that fails does not stop the rest, since a parked mount and closed
+// dome matter more than a warm camera; the first error is returned.
+func (o *Observatory) ShutdownSequence(ctx context.Context) error {
+	steps := []step{}
+
+	if o.Camera != nil && o.cfg.WarmTemperature != nil {
+		steps = append(steps, step{"warm camera", o.setTemperature(*o.cfg.WarmTemperature)})
+	}
+
+	if o.Telescope != nil {
+		steps = append(steps, step{"park telescope", o.Telescope.Park})
+	}
+
+	if o.Dome != nil {
+		steps = append(steps,
+			step{"close dome", o.Dome.Close},
+			step{"park dome", o.Dome.Park},
+		)
+	}
+
+	var first error
+
+	for _, s := range steps {
+		if err := o.run(ctx, s); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// step is one step of a sequence.
+type step struct {
+	name string
+	fn   func(context.Context) error
+}
+
+func (o *Observatory) run(ctx context.Context, s step) error {
+	log := o.log.WithField("step", s.name)
+
+	log.Info("starting step")
+
+	if err := s.fn(ctx); err != nil {
+		log.WithError(err).Warn("error in step")
+		return err
+	}
+
+	log.Info("step complete")
+
+	return nil
+}
+
+func (o *Observatory) setTemperature(celsius float64) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if o.cfg.Cooling != nil {
+			return NewTemperatureController(o.Camera, *o.cfg.Cooling).RampTo(ctx, celsius)
+		}
+
+		return o.Camera.SetTemperature(ctx, celsius)
+	}
+}
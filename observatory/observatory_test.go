@@ -0,0 +1,332 @@
+package observatory_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/astro"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/observatory"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func connect(t *testing.T, devices ...simulators.Device) *indiclient.INDIClient {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	c := indiclient.NewINDIClient(log, simulators.NewServer(devices...), afero.NewMemMapFs(), 100)
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	require.NoError(t, c.GetProperties("", ""))
+
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == len(devices) })
+
+	for _, d := range devices {
+		err := c.SetSwitchValue(d.Name(), "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+		require.NoError(t, err)
+	}
+
+	testutil.WaitFor(t, func() bool {
+		return c.NumberPropertySet("CCD Simulator", "CCD_TEMPERATURE") && c.SwitchPropertySet("Dome Simulator", "DOME_PARK") &&
+			c.SwitchPropertySet("Telescope Simulator", "TELESCOPE_PARK") && c.TextPropertySet("Filter Simulator", "FILTER_NAME") &&
+			c.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION")
+	})
+
+	return c
+}
+
+func Test_LoadConfig(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	err := afero.WriteFile(fs, "observatory.json", []byte(`{
+		"telescope": "Telescope Simulator",
+		"camera": "CCD Simulator",
+		"dome": "Dome Simulator",
+		"coolingTemperature": -10
+	}`), 0644)
+	require.NoError(t, err)
+
+	cfg, err := observatory.LoadConfig(fs, "observatory.json")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Telescope Simulator", cfg.Telescope)
+	assert.Equal(t, "CCD Simulator", cfg.Camera)
+	assert.Equal(t, "Dome Simulator", cfg.Dome)
+	require.NotNil(t, cfg.CoolingTemperature)
+	assert.Equal(t, -10.0, *cfg.CoolingTemperature)
+	assert.Nil(t, cfg.WarmTemperature)
+
+	_, err = observatory.LoadConfig(fs, "missing.json")
+	assert.Error(t, err)
+}
+
+func Test_Observatory_Sequences(t *testing.T) {
+	telescope := simulators.NewTelescope("Telescope Simulator")
+	ccd := simulators.NewCCD("CCD Simulator")
+	ccd.CoolingRate = 200
+	dome := simulators.NewDome("Dome Simulator")
+	wheel := simulators.NewFilterWheel("Filter Simulator", "Red", "Green", "Blue")
+	focuser := simulators.NewFocuser("Focuser Simulator")
+	focuser.Speed = 50000
+
+	c := connect(t, telescope, ccd, dome, wheel, focuser)
+	defer c.Disconnect()
+
+	cold, warm := -10.0, 10.0
+
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	o, err := observatory.New(log, c, observatory.Config{
+		Telescope:          "Telescope Simulator",
+		Camera:             "CCD Simulator",
+		FilterWheel:        "Filter Simulator",
+		Focuser:            "Focuser Simulator",
+		Dome:               "Dome Simulator",
+		CoolingTemperature: &cold,
+		WarmTemperature:    &warm,
+	})
+	require.NoError(t, err)
+	defer o.Close()
+
+	assert.Nil(t, o.SafetyMonitor)
+
+	ctx := context.Background()
+
+	require.NoError(t, o.Telescope.Park(ctx))
+
+	parked, err := o.Telescope.Parked()
+	require.NoError(t, err)
+	assert.True(t, parked)
+
+	require.NoError(t, o.StartupSequence(ctx))
+
+	assert.True(t, dome.ShutterOpen())
+	assert.False(t, dome.Parked())
+
+	parked, err = o.Telescope.Parked()
+	require.NoError(t, err)
+	assert.False(t, parked)
+
+	temp, err := o.Camera.Temperature()
+	require.NoError(t, err)
+	assert.Equal(t, cold, temp)
+
+	require.NoError(t, o.FilterWheel.SetFilter(ctx, "Blue"))
+	assert.Equal(t, "Blue", wheel.Filter())
+	assert.Equal(t, observatory.ErrFilterNotFound, o.FilterWheel.SetFilter(ctx, "Ha"))
+
+	require.NoError(t, o.Focuser.MoveTo(ctx, 51000))
+	assert.Equal(t, 51000.0, focuser.Position())
+
+	require.NoError(t, o.ShutdownSequence(ctx))
+
+	assert.False(t, dome.ShutterOpen())
+	assert.True(t, dome.Parked())
+
+	parked, err = o.Telescope.Parked()
+	require.NoError(t, err)
+	assert.True(t, parked)
+
+	temp, err = o.Camera.Temperature()
+	require.NoError(t, err)
+	assert.Equal(t, warm, temp)
+}
+
+func Test_Observatory_Unsafe(t *testing.T) {
+	c := connect(t,
+		simulators.NewTelescope("Telescope Simulator"), simulators.NewCCD("CCD Simulator"),
+		simulators.NewDome("Dome Simulator"), simulators.NewFilterWheel("Filter Simulator"),
+		simulators.NewFocuser("Focuser Simulator"),
+	)
+	defer c.Disconnect()
+
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+
+	// A safety monitor that has not reported any status is unsafe.
+	o, err := observatory.New(log, c, observatory.Config{
+		Dome:          "Dome Simulator",
+		SafetyMonitor: "Weather Simulator",
+	})
+	require.NoError(t, err)
+	defer o.Close()
+
+	assert.Equal(t, observatory.ErrUnsafe, o.StartupSequence(context.Background()))
+
+	open, err := o.Dome.ShutterOpen()
+	require.NoError(t, err)
+	assert.False(t, open)
+}
+
+func Test_Dome_Parked(t *testing.T) {
+	c := connect(t,
+		simulators.NewTelescope("Telescope Simulator"), simulators.NewCCD("CCD Simulator"),
+		simulators.NewDome("Dome Simulator"), simulators.NewFilterWheel("Filter Simulator"),
+		simulators.NewFocuser("Focuser Simulator"),
+	)
+	defer c.Disconnect()
+
+	d := observatory.NewDome(c, "Dome Simulator")
+
+	// The simulated dome refuses to open while parked.
+	assert.Error(t, d.Open(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, d.Unpark(ctx))
+}
+
+func Test_Telescope_SlewToJ2000(t *testing.T) {
+	telescope := simulators.NewTelescope("Telescope Simulator")
+	telescope.SlewRate = 1000
+
+	c := connect(t,
+		telescope, simulators.NewCCD("CCD Simulator"),
+		simulators.NewDome("Dome Simulator"), simulators.NewFilterWheel("Filter Simulator"),
+		simulators.NewFocuser("Focuser Simulator"),
+	)
+	defer c.Disconnect()
+
+	scope := observatory.NewTelescope(c, "Telescope Simulator")
+
+	require.NoError(t, scope.SlewToJ2000(context.Background(), 5.588, -5.39))
+
+	ra, dec, err := scope.Coordinates()
+	require.NoError(t, err)
+
+	wantRA, wantDec := astro.ToJNow(5.588, -5.39, time.Now())
+	assert.InDelta(t, wantRA, ra, 1e-4)
+	assert.InDelta(t, wantDec, dec, 1e-3)
+
+	site := indiclient.Site{Latitude: 51.4769}
+
+	alt, az, err := scope.AltAz(site)
+	require.NoError(t, err)
+
+	wantAlt, wantAz := astro.AltAz(ra, dec, site, time.Now())
+	assert.InDelta(t, wantAlt, alt, 0.01)
+	assert.InDelta(t, wantAz, az, 0.01)
+}
+
+func Test_Horizon_Altitude(t *testing.T) {
+	h := observatory.Horizon{{Azimuth: 90, Altitude: 20}, {Azimuth: 0, Altitude: 10}, {Azimuth: 270, Altitude: 30}}
+
+	assert.InDelta(t, 10, h.Altitude(0), 1e-9)
+	assert.InDelta(t, 15, h.Altitude(45), 1e-9)
+	assert.InDelta(t, 25, h.Altitude(180), 1e-9)
+	// Wraps around at north.
+	assert.InDelta(t, 20, h.Altitude(315), 1e-9)
+	assert.InDelta(t, 20, h.Altitude(-45), 1e-9)
+
+	assert.Equal(t, -90.0, observatory.Horizon{}.Altitude(123))
+}
+
+func Test_LoadHorizon(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(fs, "horizon.hrz", []byte("# trees\n0 10\n\n180  25.5\n"), 0644))
+
+	h, err := observatory.LoadHorizon(fs, "horizon.hrz")
+	require.NoError(t, err)
+	assert.Equal(t, observatory.Horizon{{Azimuth: 0, Altitude: 10}, {Azimuth: 180, Altitude: 25.5}}, h)
+
+	require.NoError(t, afero.WriteFile(fs, "bad.hrz", []byte("0 10 20\n"), 0644))
+
+	_, err = observatory.LoadHorizon(fs, "bad.hrz")
+	assert.Equal(t, observatory.ErrInvalidHorizon, err)
+}
+
+func Test_Limits_Check(t *testing.T) {
+	site := indiclient.Site{Latitude: 51.4769}
+	now := time.Date(2026, 10, 15, 22, 0, 0, 0, time.UTC)
+
+	limits := observatory.Limits{
+		MinAltitude: 10,
+		Horizon:     observatory.Horizon{{Azimuth: 0, Altitude: 0}, {Azimuth: 180, Altitude: 40}},
+		Zones:       []observatory.Zone{{MinHourAngle: -1, MaxHourAngle: 1, MinDec: 80, MaxDec: 90}},
+	}
+
+	ra, dec := astro.RADec(30, 90, site, now)
+	assert.NoError(t, limits.Check(ra, dec, site, now))
+
+	ra, dec = astro.RADec(5, 0, site, now)
+	assert.Equal(t, observatory.ErrBelowHorizon, limits.Check(ra, dec, site, now))
+
+	ra, dec = astro.RADec(30, 180, site, now)
+	assert.Equal(t, observatory.ErrBelowHorizon, limits.Check(ra, dec, site, now))
+
+	ra = astro.LocalSiderealTime(now, site.Longitude)
+	assert.Equal(t, observatory.ErrForbiddenZone, limits.Check(ra, 85, site, now))
+}
+
+func Test_TemperatureController(t *testing.T) {
+	ccd := simulators.NewCCD("CCD Simulator")
+	ccd.CoolingRate = 200
+
+	c := connect(t,
+		simulators.NewTelescope("Telescope Simulator"), ccd,
+		simulators.NewDome("Dome Simulator"), simulators.NewFilterWheel("Filter Simulator"),
+		simulators.NewFocuser("Focuser Simulator"),
+	)
+	defer c.Disconnect()
+
+	start := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+	clock := indiclient.NewFakeClock(start)
+	c.SetClock(clock)
+
+	cam := observatory.NewCamera(c, "CCD Simulator")
+
+	tc := observatory.NewTemperatureController(cam, observatory.CoolingOptions{
+		Rate:     6,
+		Interval: 10 * time.Second,
+		Settle:   time.Minute,
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- tc.RampTo(context.Background(), 0) }()
+
+	// Each time the controller waits, move the clock on by an interval.
+	for ramping := true; ramping; {
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+			ramping = false
+		case <-time.After(time.Millisecond):
+			if clock.Pending() > 0 {
+				clock.Advance(10 * time.Second)
+			}
+		}
+	}
+
+	// 20 degrees at 1 degree every 10 seconds, rather than at once, then a minute to settle.
+	assert.True(t, clock.Now().Sub(start) >= 250*time.Second)
+
+	temp, err := cam.Temperature()
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, temp)
+
+	c.SetClock(nil)
+
+	// The simulated cooler power is twice the difference from the 20 degree ambient temperature.
+	tc = observatory.NewTemperatureController(cam, observatory.CoolingOptions{
+		Rate:           600,
+		Interval:       50 * time.Millisecond,
+		MaxCoolerPower: 60,
+	})
+
+	assert.Equal(t, observatory.ErrCoolerSaturated, tc.RampTo(context.Background(), -20))
+
+	temp, err = cam.Temperature()
+	require.NoError(t, err)
+	assert.True(t, temp <= -10 && temp > -20)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, tc.RampTo(ctx, 10))
+}
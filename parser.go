@@ -0,0 +1,586 @@
+package indiclient
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+var (
+	// ErrMessageTooLarge is returned when a message from indiserver exceeds ParserLimits.MaxMessageSize.
+	ErrMessageTooLarge = errors.New("message too large")
+
+	// ErrElementTooLarge is returned when the text of an element exceeds ParserLimits.MaxElementSize.
+	ErrElementTooLarge = errors.New("element too large")
+
+	// ErrTooManyAttributes is returned when an element has more attributes than ParserLimits.MaxAttributes.
+	ErrTooManyAttributes = errors.New("too many attributes")
+
+	// ErrUnknownElement is returned when indiserver sends an element the client does not understand.
+	ErrUnknownElement = errors.New("unknown element")
+
+	// ErrParserStuck is returned when the parser fails to parse a message without consuming any input, which would
+	// otherwise make the read loop fail on the same input forever. The connection is closed.
+	ErrParserStuck = errors.New("parser made no progress")
+)
+
+// ParserLimits protects the client from malformed or malicious output from drivers. A message that exceeds any limit
+// is discarded, and the client skips ahead to the next message.
+type ParserLimits struct {
+	// MaxMessageSize is the maximum size in bytes of a single message, including BLOB data. Zero means no limit.
+	MaxMessageSize int64 `json:"maxMessageSize"`
+	// MaxElementSize is the maximum size in bytes of the text of a single element. BLOB data is only limited by
+	// MaxMessageSize. Zero means no limit.
+	MaxElementSize int `json:"maxElementSize"`
+	// MaxAttributes is the maximum number of attributes on a single element. Zero means no limit.
+	MaxAttributes int `json:"maxAttributes"`
+}
+
+// DefaultParserLimits are the limits used by NewINDIClient. They allow for BLOBs from large sensors. Use
+// SetParserLimits to change them.
+var DefaultParserLimits = ParserLimits{
+	MaxMessageSize: 1 << 30,
+	MaxElementSize: 1 << 20,
+	MaxAttributes:  64,
+}
+
+// ParseMode controls how the client reacts to messages it cannot parse or does not understand. Modes can be combined,
+// e.g. ParseModeStrict | ParseModeCaptureUnknown.
+type ParseMode int
+
+const (
+	// ParseModeLenient (default) logs messages that cannot be parsed and carries on.
+	ParseModeLenient ParseMode = 0
+	// ParseModeStrict also sends an EventTypeError event to subscribers for every message that cannot be parsed,
+	// including unknown elements.
+	ParseModeStrict ParseMode = 1 << iota
+	// ParseModeCaptureUnknown sends an EventTypeUnknownElement event with the raw XML of each element the client does
+	// not understand, so applications can handle vendor extensions themselves.
+	ParseModeCaptureUnknown
+)
+
+// ParseError is returned by the parser when a message could not be parsed. The message is skipped, and reading
+// continues with the next one.
+type ParseError struct {
+	// Element is the name of the element that failed to parse, if it is known.
+	Element string
+	// Device and Property are the device and name attributes of the element, if they are known.
+	Device   string
+	Property string
+	// Raw is the XML of an unknown element, if it was captured.
+	Raw []byte
+	// Skipped is the number of bytes the parser discarded after the error to find the start of the next message. It
+	// is zero unless the error left the parser out of step with the stream.
+	Skipped int64
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	if len(e.Element) == 0 {
+		return fmt.Sprintf("indiclient: parse error: %s", e.Err.Error())
+	}
+
+	return fmt.Sprintf("indiclient: parse error in %s: %s", e.Element, e.Err.Error())
+}
+
+// newMessage returns a pointer to the type used to decode the top level element name, or nil if it is not one the
+// client understands.
+func newMessage(name string) interface{} {
+	switch name {
+	case "defSwitchVector":
+		return &DefSwitchVector{}
+	case "defTextVector":
+		return &DefTextVector{}
+	case "defNumberVector":
+		return &DefNumberVector{}
+	case "defLightVector":
+		return &DefLightVector{}
+	case "defBLOBVector":
+		return &DefBlobVector{}
+	case "setSwitchVector":
+		return getSetSwitchVector()
+	case "setTextVector":
+		return &SetTextVector{}
+	case "setNumberVector":
+		return getSetNumberVector()
+	case "setLightVector":
+		return &SetLightVector{}
+	case "setBLOBVector":
+		return &SetBlobVector{}
+	case "message":
+		return &Message{}
+	case "delProperty":
+		return &DelProperty{}
+	case "getProperties":
+		return &GetProperties{}
+	}
+
+	return nil
+}
+
+// topLevelElements are the elements the parser looks for when resynchronizing after an error.
+var topLevelElements = [][]byte{
+	[]byte("defSwitchVector"), []byte("defTextVector"), []byte("defNumberVector"), []byte("defLightVector"),
+	[]byte("defBLOBVector"), []byte("setSwitchVector"), []byte("setTextVector"), []byte("setNumberVector"),
+	[]byte("setLightVector"), []byte("setBLOBVector"), []byte("message"), []byte("delProperty"),
+	[]byte("getProperties"),
+}
+
+// limitReader counts the bytes read by the decoder for the current message, and fails once there are too many. It
+// implements io.ByteReader so the decoder never reads ahead of the message it is working on.
+type limitReader struct {
+	br      *bufio.Reader
+	max     int64
+	n       int64
+	prefix  []byte
+	ioError error
+
+	// limiter, if set, limits the rate BLOB data is read at while throttle is set. unpaid counts the bytes read since
+	// the last wait on it.
+	limiter  *rateLimiter
+	throttle bool
+	unpaid   int
+
+	// raw collects the bytes read while record is set.
+	record bool
+	raw    []byte
+}
+
+func (l *limitReader) ReadByte() (byte, error) {
+	if len(l.prefix) > 0 {
+		b := l.prefix[0]
+		l.prefix = l.prefix[1:]
+		if l.record {
+			l.raw = append(l.raw, b)
+		}
+		return b, nil
+	}
+
+	if l.max > 0 && l.n >= l.max {
+		return 0, ErrMessageTooLarge
+	}
+
+	b, err := l.br.ReadByte()
+	if err != nil {
+		l.ioError = err
+		return 0, err
+	}
+
+	l.n++
+
+	if l.record {
+		l.raw = append(l.raw, b)
+	}
+
+	if l.throttle {
+		l.unpaid++
+		if l.unpaid >= blobRateChunk {
+			l.limiter.wait(l.unpaid)
+			l.unpaid = 0
+		}
+	}
+
+	return b, nil
+}
+
+// startRecording starts recording the raw bytes of the next message if record is set, or stops recording. The
+// decoder may already have read the '<' of the next message, and whitespace before it, while reading the end of the
+// previous one, so whatever follows the last '>' recorded is kept.
+func (l *limitReader) startRecording(record bool) {
+	l.record = record
+
+	if !record {
+		l.raw = l.raw[:0]
+		return
+	}
+
+	if end := bytes.LastIndexByte(l.raw, '>'); end >= 0 {
+		l.raw = append(l.raw[:0], l.raw[end+1:]...)
+	}
+}
+
+// recorded returns a copy of the bytes recorded for the current message, without surrounding whitespace.
+func (l *limitReader) recorded() []byte {
+	if !l.record {
+		return nil
+	}
+
+	return append([]byte{}, bytes.TrimSpace(l.raw)...)
+}
+
+// setThrottle starts or stops limiting the rate of reads, for the BLOB data in setBLOBVector messages.
+func (l *limitReader) setThrottle(throttle bool) {
+	if !throttle && l.unpaid > 0 {
+		l.limiter.wait(l.unpaid)
+		l.unpaid = 0
+	}
+
+	l.throttle = throttle && l.limiter != nil
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	b, err := l.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	p[0] = b
+
+	return 1, nil
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// parser reads INDI messages from indiserver, enforcing ParserLimits and recovering from malformed XML.
+type parser struct {
+	in      *countingReader
+	lr      *limitReader
+	decoder *xml.Decoder
+	limits  ParserLimits
+	mode    ParseMode
+
+	// tokens and replay are reused for every message decoded by encoding/xml.
+	tokens       []xml.Token
+	replay       *tokenReader
+	tokenDecoder *xml.Decoder
+
+	// interned holds strings reused by the fast path. See intern.
+	interned map[string]string
+
+	// capture, if set and positive, makes next record the raw XML of each message in raw.
+	capture *int32
+	raw     []byte
+}
+
+func newParser(r io.Reader, limits ParserLimits, mode ParseMode) *parser {
+	in := &countingReader{r: r}
+
+	p := &parser{
+		in: in,
+		lr: &limitReader{
+			br:  bufio.NewReader(in),
+			max: limits.MaxMessageSize,
+		},
+		limits:   limits,
+		mode:     mode,
+		replay:   &tokenReader{},
+		interned: map[string]string{},
+	}
+
+	p.decoder = xml.NewDecoder(p.lr)
+	p.tokenDecoder = xml.NewTokenDecoder(p.replay)
+
+	return p
+}
+
+// next returns the next message. Errors reading from r are returned as is, and mean the connection is unusable. A
+// message that cannot be parsed results in a *ParseError; the parser has already skipped ahead to the next message,
+// so it is safe to call next again.
+func (p *parser) next() (interface{}, error) {
+	start := p.offset()
+
+	item, err := p.parse()
+	if _, ok := err.(*ParseError); ok && p.offset() == start {
+		return nil, ErrParserStuck
+	}
+
+	return item, err
+}
+
+// offset returns the number of bytes of input the parser has consumed.
+func (p *parser) offset() int64 {
+	return p.in.n - int64(p.lr.br.Buffered()) - int64(len(p.lr.prefix))
+}
+
+// parse does the work of next.
+func (p *parser) parse() (interface{}, error) {
+	for {
+		p.lr.n = 0
+		p.raw = nil
+		p.lr.startRecording(p.capture != nil && atomic.LoadInt32(p.capture) > 0)
+
+		if item := p.nextFast(); item != nil {
+			return item, nil
+		}
+
+		t, err := p.decoder.Token()
+		if err != nil {
+			p.raw = p.lr.recorded()
+			return nil, p.recover("", err)
+		}
+
+		se, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		p.lr.setThrottle(se.Name.Local == "setBLOBVector")
+		tokens, err := p.readElement(se)
+		p.lr.setThrottle(false)
+		p.raw = p.lr.recorded()
+		if err != nil {
+			perr := p.recover(se.Name.Local, err)
+			if pe, ok := perr.(*ParseError); ok {
+				pe.Device, pe.Property = attr(se, "device"), attr(se, "name")
+			}
+			return nil, perr
+		}
+
+		item := newMessage(se.Name.Local)
+		if item == nil {
+			perr := &ParseError{Element: se.Name.Local, Device: attr(se, "device"), Property: attr(se, "name"), Err: ErrUnknownElement}
+			if p.mode&ParseModeCaptureUnknown != 0 {
+				perr.Raw = encodeTokens(tokens)
+			}
+			return nil, perr
+		}
+
+		p.replay.tokens = tokens
+		if err := p.tokenDecoder.Decode(item); err != nil {
+			// The token decoder may be left part way through the element.
+			p.tokenDecoder = xml.NewTokenDecoder(p.replay)
+			releaseMessage(item)
+			return nil, &ParseError{Element: se.Name.Local, Device: attr(se, "device"), Property: attr(se, "name"), Err: err}
+		}
+
+		return item, nil
+	}
+}
+
+// readElement reads the rest of the element started by start, checking each token against the parser's limits. The
+// returned tokens include start, since a decoder will not accept an end element it has not seen the start of.
+func (p *parser) readElement(start xml.StartElement) ([]xml.Token, error) {
+	if err := p.checkAttributes(start); err != nil {
+		return nil, err
+	}
+
+	tokens := append(p.tokens[:0], start.Copy())
+	names := []string{start.Name.Local}
+
+	for len(names) > 0 {
+		t, err := p.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tt := t.(type) {
+		case xml.StartElement:
+			if err := p.checkAttributes(tt); err != nil {
+				return nil, err
+			}
+			names = append(names, tt.Name.Local)
+		case xml.EndElement:
+			names = names[:len(names)-1]
+		case xml.CharData:
+			if p.limits.MaxElementSize > 0 && len(tt) > p.limits.MaxElementSize && names[len(names)-1] != "oneBLOB" {
+				return nil, ErrElementTooLarge
+			}
+		}
+
+		tokens = append(tokens, xml.CopyToken(t))
+	}
+
+	p.tokens = tokens
+
+	return tokens, nil
+}
+
+func (p *parser) checkAttributes(se xml.StartElement) error {
+	if p.limits.MaxAttributes > 0 && len(se.Attr) > p.limits.MaxAttributes {
+		return ErrTooManyAttributes
+	}
+
+	return nil
+}
+
+// recover decides whether err is fatal. If it is not, it resynchronizes the parser with the start of the next
+// message and returns a *ParseError.
+func (p *parser) recover(element string, err error) error {
+	if p.lr.ioError != nil {
+		return p.lr.ioError
+	}
+
+	if err == io.EOF {
+		return err
+	}
+
+	start := p.offset()
+
+	if rerr := p.resync(); rerr != nil {
+		return rerr
+	}
+
+	return &ParseError{Element: element, Skipped: p.offset() - start, Err: err}
+}
+
+// resync discards input up to the start of the next top level element, and starts a fresh decoder there, since an
+// xml.Decoder cannot continue after a syntax error.
+func (p *parser) resync() error {
+	br := p.lr.br
+
+	for {
+		if _, err := br.ReadSlice('<'); err != nil {
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			p.lr.ioError = err
+			return err
+		}
+
+		peek, err := br.Peek(len("setSwitchVector") + 1)
+		if err != nil && len(peek) == 0 {
+			p.lr.ioError = err
+			return err
+		}
+
+		if isTopLevelStart(peek) {
+			break
+		}
+	}
+
+	p.lr.n = 0
+	p.lr.prefix = []byte("<")
+	p.decoder = xml.NewDecoder(p.lr)
+
+	return nil
+}
+
+// isTopLevelStart returns true if b, the bytes following a '<', start one of the top level elements.
+func isTopLevelStart(b []byte) bool {
+	for _, name := range topLevelElements {
+		if !bytes.HasPrefix(b, name) {
+			continue
+		}
+
+		if len(b) == len(name) {
+			return true
+		}
+
+		switch b[len(name)] {
+		case ' ', '\t', '\r', '\n', '>', '/':
+			return true
+		}
+	}
+
+	return false
+}
+
+func attr(se xml.StartElement, name string) string {
+	for _, a := range se.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+
+	return ""
+}
+
+// encodeTokens turns tokens collected by readElement back into XML. The result is equivalent to, but not necessarily
+// byte for byte the same as, what indiserver sent.
+func encodeTokens(tokens []xml.Token) []byte {
+	buf := &bytes.Buffer{}
+	e := xml.NewEncoder(buf)
+
+	for _, t := range tokens {
+		if err := e.EncodeToken(t); err != nil {
+			break
+		}
+	}
+
+	e.Flush()
+
+	return buf.Bytes()
+}
+
+// tokenReader replays tokens collected by readElement.
+type tokenReader struct {
+	tokens []xml.Token
+}
+
+func (t *tokenReader) Token() (xml.Token, error) {
+	if len(t.tokens) == 0 {
+		return nil, io.EOF
+	}
+
+	tok := t.tokens[0]
+	t.tokens = t.tokens[1:]
+
+	return tok, nil
+}
+
+// parseError reports a message that could not be parsed to subscribers, according to the parse mode. Only call when
+// INDIClient.rwm is locked.
+func (c *INDIClient) parseError(item *ParseError) {
+	if c.parseMode&ParseModeStrict != 0 {
+		c.emit(Event{
+			Type:     EventTypeError,
+			Device:   item.Device,
+			Property: item.Property,
+			Error:    item.Error(),
+		})
+	}
+
+	if item.Err == ErrUnknownElement && len(item.Raw) > 0 {
+		c.emit(Event{
+			Type:     EventTypeUnknownElement,
+			Device:   item.Device,
+			Property: item.Property,
+			Raw:      string(item.Raw),
+		})
+	}
+
+	if item.Skipped > 0 {
+		c.emit(Event{
+			Type:     EventTypeResync,
+			Device:   item.Device,
+			Property: item.Property,
+			Error:    item.Error(),
+		})
+	}
+}
+
+// SetParseMode changes how the client reacts to messages it cannot parse. It takes effect on the next call to Connect.
+func (c *INDIClient) SetParseMode(mode ParseMode) {
+	c.parseMode = mode
+}
+
+// SetParserLimits changes the limits applied to messages from indiserver. It takes effect on the next call to Connect.
+func (c *INDIClient) SetParserLimits(limits ParserLimits) {
+	c.parserLimits = limits
+}
+
+// ErrNoMessage is returned by ParseMessage when data does not hold a complete message.
+var ErrNoMessage = errors.New("no message")
+
+// ParseMessage parses the first INDI message in data, as indiserver sends it, without a connection. It returns a
+// pointer to one of the message types, such as *DefNumberVector or *Message, a *ParseError if the message is
+// malformed or not one the client understands, or ErrNoMessage if data ends before a message does. The limits are
+// DefaultParserLimits. It is meant for tools that read recorded traffic, and for fuzzing the parser.
+func ParseMessage(data []byte) (interface{}, error) {
+	p := newParser(bytes.NewReader(data), DefaultParserLimits, ParseModeCaptureUnknown)
+
+	item, err := p.next()
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, ErrNoMessage
+	}
+
+	return item, err
+}
@@ -0,0 +1,72 @@
+package indiclient
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+const benchSetNumberVector = `<setNumberVector device="Telescope Simulator" name="EQUATORIAL_EOD_COORD" state="Busy" timeout="60" timestamp="2020-03-14T01:02:03">
+    <oneNumber name="RA">
+      5.5861111111111111605
+    </oneNumber>
+    <oneNumber name="DEC">
+      -5.3911111111111114658
+    </oneNumber>
+</setNumberVector>
+`
+
+const benchSetSwitchVector = `<setSwitchVector device="Telescope Simulator" name="TELESCOPE_TRACK_STATE" state="Ok" timeout="60" timestamp="2020-03-14T01:02:03">
+    <oneSwitch name="TRACK_ON">
+On
+    </oneSwitch>
+    <oneSwitch name="TRACK_OFF">
+Off
+    </oneSwitch>
+</setSwitchVector>
+`
+
+const benchDefTextVector = `<defTextVector device="Telescope Simulator" name="DRIVER_INFO" label="Driver Info" group="General Info" state="Idle" perm="ro" timeout="60" timestamp="2020-03-14T01:02:03">
+    <defText name="DRIVER_NAME" label="Name">
+Telescope Simulator
+    </defText>
+    <defText name="DRIVER_EXEC" label="Exec">
+indi_simulator_telescope
+    </defText>
+</defTextVector>
+`
+
+func benchmarkParser(b *testing.B, message string) {
+	input := bytes.Repeat([]byte(message), 1000)
+
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		p := newParser(bytes.NewReader(input), DefaultParserLimits, ParseModeLenient)
+
+		for {
+			item, err := p.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+			releaseMessage(item)
+		}
+	}
+}
+
+func BenchmarkParser_SetNumberVector(b *testing.B) {
+	benchmarkParser(b, benchSetNumberVector)
+}
+
+func BenchmarkParser_SetSwitchVector(b *testing.B) {
+	benchmarkParser(b, benchSetSwitchVector)
+}
+
+func BenchmarkParser_DefTextVector(b *testing.B) {
+	benchmarkParser(b, benchDefTextVector)
+}
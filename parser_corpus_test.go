@@ -0,0 +1,56 @@
+package indiclient
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadCorpus reads the sample messages in testdata/corpus, which seed the fuzz tests.
+func loadCorpus(t testing.TB) [][]byte {
+	files, err := filepath.Glob(filepath.Join("testdata", "corpus", "*.xml"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	corpus := [][]byte{}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		require.NoError(t, err)
+		corpus = append(corpus, b)
+	}
+
+	return corpus
+}
+
+func Test_ParseMessage(t *testing.T) {
+	item, err := ParseMessage([]byte(`<message device="Mount" message="hello"/>`))
+	require.NoError(t, err)
+	require.IsType(t, &Message{}, item)
+	assert.Equal(t, "hello", item.(*Message).Message)
+
+	item, err = ParseMessage([]byte(`<setNumberVector device="Mount" name="EQUATORIAL_EOD_COORD" state="Ok"><oneNumber name="RA">5.6</oneNumber></setNumberVector>`))
+	require.NoError(t, err)
+	require.IsType(t, &SetNumberVector{}, item)
+	assert.Equal(t, "5.6", item.(*SetNumberVector).Numbers[0].Value)
+
+	_, err = ParseMessage([]byte(`<setNumberVector device="Mount" name="EQUATORIAL_EOD_COORD">`))
+	assert.Equal(t, ErrNoMessage, err)
+
+	_, err = ParseMessage(nil)
+	assert.Equal(t, ErrNoMessage, err)
+
+	_, err = ParseMessage([]byte(`<vendorExtension device="Mount"/>`))
+	require.IsType(t, &ParseError{}, err)
+	assert.Equal(t, ErrUnknownElement, err.(*ParseError).Err)
+}
+
+func Test_ParseMessage_Corpus(t *testing.T) {
+	for _, data := range loadCorpus(t) {
+		// The corpus has malformed messages too; none may panic.
+		item, err := ParseMessage(data)
+		assert.True(t, item != nil || err != nil)
+	}
+}
@@ -0,0 +1,402 @@
+package indiclient
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Mounts and focusers stream setNumberVector and setSwitchVector at high rates, and decoding them with encoding/xml
+// costs dozens of allocations per message. The fast path below decodes these two messages straight from the bytes
+// buffered by the parser, without reflection, into pooled structs. It only handles the plain XML drivers actually
+// send: anything unusual (entities, comments, CDATA, carriage returns, child elements other than the values, or a
+// message that has not been fully received yet) falls back to encoding/xml, which remains the reference behavior.
+
+var (
+	setNumberVectorPool = sync.Pool{New: func() interface{} { return &SetNumberVector{} }}
+	setSwitchVectorPool = sync.Pool{New: func() interface{} { return &SetSwitchVector{} }}
+)
+
+// getSetNumberVector returns an empty SetNumberVector from the pool, keeping the capacity of its Numbers.
+func getSetNumberVector() *SetNumberVector {
+	v := setNumberVectorPool.Get().(*SetNumberVector)
+	*v = SetNumberVector{Numbers: v.Numbers[:0]}
+	return v
+}
+
+// getSetSwitchVector returns an empty SetSwitchVector from the pool, keeping the capacity of its Switches.
+func getSetSwitchVector() *SetSwitchVector {
+	v := setSwitchVectorPool.Get().(*SetSwitchVector)
+	*v = SetSwitchVector{Switches: v.Switches[:0]}
+	return v
+}
+
+// releaseMessage returns item to its pool once it has been handled. item must not be used afterwards.
+func releaseMessage(item interface{}) {
+	switch v := item.(type) {
+	case *SetNumberVector:
+		setNumberVectorPool.Put(v)
+	case *SetSwitchVector:
+		setSwitchVectorPool.Put(v)
+	}
+}
+
+var (
+	fastSetNumberVector = []byte("setNumberVector")
+	fastSetSwitchVector = []byte("setSwitchVector")
+	fastOneNumber       = []byte("oneNumber")
+	fastOneSwitch       = []byte("oneSwitch")
+
+	// The XMLName fields encoding/xml would set.
+	setNumberVectorName = xml.Name{Local: "setNumberVector"}
+	setSwitchVectorName = xml.Name{Local: "setSwitchVector"}
+	oneNumberName       = xml.Name{Local: "oneNumber"}
+	oneSwitchName       = xml.Name{Local: "oneSwitch"}
+)
+
+// nextFast tries to decode the next message with the fast path. It returns nil if the next message is not one the
+// fast path handles, in which case no input has been consumed except whitespace between messages.
+func (p *parser) nextFast() interface{} {
+	br := p.lr.br
+
+	if len(p.lr.prefix) > 0 {
+		return nil
+	}
+
+	// Wait for the next message to start arriving, then look at what has been buffered so far.
+	if _, err := br.Peek(1); err != nil {
+		return nil
+	}
+
+	buf, _ := br.Peek(br.Buffered())
+
+	start := 0
+	for start < len(buf) && isSpace(buf[start]) {
+		start++
+	}
+
+	if start > 0 {
+		br.Discard(start)
+		buf = buf[start:]
+	}
+
+	if len(buf) < 2 || buf[0] != '<' {
+		return nil
+	}
+
+	var name, element []byte
+
+	switch {
+	case bytes.HasPrefix(buf[1:], fastSetNumberVector):
+		name, element = fastSetNumberVector, fastOneNumber
+	case bytes.HasPrefix(buf[1:], fastSetSwitchVector):
+		name, element = fastSetSwitchVector, fastOneSwitch
+	default:
+		return nil
+	}
+
+	for {
+		var item interface{}
+		var n int
+
+		if bytes.Equal(name, fastSetNumberVector) {
+			v := getSetNumberVector()
+			if n = p.fastVector(buf, name, element, v); n == 0 {
+				setNumberVectorPool.Put(v)
+			} else {
+				item = v
+			}
+		} else {
+			v := getSetSwitchVector()
+			if n = p.fastVector(buf, name, element, v); n == 0 {
+				setSwitchVectorPool.Put(v)
+			} else {
+				item = v
+			}
+		}
+
+		if item != nil {
+			if p.lr.record {
+				p.raw = append([]byte{}, buf[:n]...)
+			}
+			br.Discard(n)
+			return item
+		}
+
+		// If the end of the message has not arrived yet, wait for more of it as long as it fits in the buffer.
+		if !p.incomplete(buf, name) || len(buf) >= br.Size() {
+			return nil
+		}
+
+		if _, err := br.Peek(len(buf) + 1); err != nil {
+			return nil
+		}
+		buf, _ = br.Peek(br.Buffered())
+	}
+}
+
+// incomplete returns true if buf does not contain the end tag of the message it starts with.
+func (p *parser) incomplete(buf, name []byte) bool {
+	end := bytes.Index(buf, []byte("</"))
+	for end >= 0 {
+		if bytes.HasPrefix(buf[end+2:], name) {
+			return false
+		}
+
+		next := bytes.Index(buf[end+2:], []byte("</"))
+		if next < 0 {
+			break
+		}
+		end += 2 + next
+	}
+
+	return true
+}
+
+// fastVector decodes a set*Vector named name, whose elements are named element, from the start of buf into v. It
+// returns the length of the message, or 0 if the fast path cannot decode it.
+func (p *parser) fastVector(buf, name, element []byte, v interface{}) int {
+	if p.limits.MaxMessageSize > 0 && int64(len(buf)) > p.limits.MaxMessageSize {
+		buf = buf[:p.limits.MaxMessageSize]
+	}
+
+	s := fastScanner{buf: buf, pos: 1 + len(name), maxAttributes: p.limits.MaxAttributes}
+
+	var device, propName, state, timeout, timestamp, message string
+
+	ok := s.attributes(func(k, val []byte) bool {
+		switch string(k) {
+		case "device":
+			device = p.intern(val)
+		case "name":
+			propName = p.intern(val)
+		case "state":
+			state = p.intern(val)
+		case "timeout":
+			timeout = p.intern(val)
+		case "timestamp":
+			timestamp = string(val)
+		case "message":
+			message = string(val)
+		}
+		return true
+	})
+	if !ok || !s.consume('>') {
+		return 0
+	}
+
+	t, err := strconv.ParseInt(strings.TrimSpace(timeout), 10, 64)
+	if err != nil && len(timeout) > 0 {
+		return 0
+	}
+
+	switch vv := v.(type) {
+	case *SetNumberVector:
+		vv.XMLName = setNumberVectorName
+		vv.Device, vv.Name, vv.State, vv.Timeout, vv.Timestamp = device, propName, PropertyState(state), int(t), timestamp
+		vv.Message = message
+	case *SetSwitchVector:
+		vv.XMLName = setSwitchVectorName
+		vv.Device, vv.Name, vv.State, vv.Timeout, vv.Timestamp = device, propName, PropertyState(state), int(t), timestamp
+		vv.Message = message
+	}
+
+	for {
+		s.skipSpace()
+
+		if s.endTag(name) {
+			return s.pos
+		}
+
+		if !s.startTag(element) {
+			return 0
+		}
+
+		var elementName string
+		ok := s.attributes(func(k, val []byte) bool {
+			if string(k) == "name" {
+				elementName = p.intern(val)
+			}
+			return true
+		})
+		if !ok || !s.consume('>') {
+			return 0
+		}
+
+		text, ok := s.text()
+		if !ok || (p.limits.MaxElementSize > 0 && len(text) > p.limits.MaxElementSize) {
+			return 0
+		}
+
+		if !s.endTag(element) {
+			return 0
+		}
+
+		switch vv := v.(type) {
+		case *SetNumberVector:
+			vv.Numbers = append(vv.Numbers, OneNumber{XMLName: oneNumberName, Name: elementName, Value: string(text)})
+		case *SetSwitchVector:
+			vv.Switches = append(vv.Switches, OneSwitch{XMLName: oneSwitchName, Name: elementName, Value: SwitchState(p.intern(text))})
+		}
+	}
+}
+
+// maxInterned is the most strings the parser will intern. Device, property and element names are few, so this is only
+// reached by drivers that put changing values in them.
+const maxInterned = 4096
+
+// intern returns b as a string, reusing the same string for repeated names and states so that decoding them does not
+// allocate.
+func (p *parser) intern(b []byte) string {
+	if s, ok := p.interned[string(b)]; ok {
+		return s
+	}
+
+	s := string(b)
+
+	if len(p.interned) < maxInterned {
+		p.interned[s] = s
+	}
+
+	return s
+}
+
+// fastScanner reads the simple subset of XML handled by the fast path. Every method returns false, or leaves pos
+// alone, when it sees something outside that subset.
+type fastScanner struct {
+	buf           []byte
+	pos           int
+	maxAttributes int
+}
+
+func (s *fastScanner) skipSpace() {
+	for s.pos < len(s.buf) && isSpace(s.buf[s.pos]) {
+		s.pos++
+	}
+}
+
+func (s *fastScanner) consume(b byte) bool {
+	if s.pos < len(s.buf) && s.buf[s.pos] == b {
+		s.pos++
+		return true
+	}
+	return false
+}
+
+// startTag consumes "<name" followed by whitespace or '>'.
+func (s *fastScanner) startTag(name []byte) bool {
+	rest := s.buf[s.pos:]
+	if len(rest) < len(name)+2 || rest[0] != '<' || !bytes.HasPrefix(rest[1:], name) {
+		return false
+	}
+
+	if c := rest[len(name)+1]; !isSpace(c) && c != '>' {
+		return false
+	}
+
+	s.pos += len(name) + 1
+	return true
+}
+
+// endTag consumes "</name>", allowing whitespace before the '>'.
+func (s *fastScanner) endTag(name []byte) bool {
+	rest := s.buf[s.pos:]
+	if len(rest) < len(name)+3 || rest[0] != '<' || rest[1] != '/' || !bytes.HasPrefix(rest[2:], name) {
+		return false
+	}
+
+	pos := s.pos
+	s.pos += len(name) + 2
+	s.skipSpace()
+
+	if !s.consume('>') {
+		s.pos = pos
+		return false
+	}
+
+	return true
+}
+
+// attributes calls fn for each attribute up to the closing '>' of a start tag, which is not consumed.
+func (s *fastScanner) attributes(fn func(k, v []byte) bool) bool {
+	count := 0
+
+	for {
+		s.skipSpace()
+
+		if s.pos >= len(s.buf) {
+			return false
+		}
+
+		if s.buf[s.pos] == '>' {
+			return true
+		}
+
+		start := s.pos
+		for s.pos < len(s.buf) && isNameByte(s.buf[s.pos]) {
+			s.pos++
+		}
+		if s.pos == start {
+			return false
+		}
+		k := s.buf[start:s.pos]
+
+		s.skipSpace()
+		if !s.consume('=') {
+			return false
+		}
+		s.skipSpace()
+
+		if s.pos >= len(s.buf) || (s.buf[s.pos] != '"' && s.buf[s.pos] != '\'') {
+			return false
+		}
+		quote := s.buf[s.pos]
+		s.pos++
+
+		end := bytes.IndexByte(s.buf[s.pos:], quote)
+		if end < 0 {
+			return false
+		}
+		v := s.buf[s.pos : s.pos+end]
+		if bytes.IndexAny(v, "<&\r") >= 0 {
+			return false
+		}
+		s.pos += end + 1
+
+		count++
+		if s.maxAttributes > 0 && count > s.maxAttributes {
+			return false
+		}
+
+		if !fn(k, v) {
+			return false
+		}
+	}
+}
+
+// text consumes character data up to the next '<'.
+func (s *fastScanner) text() ([]byte, bool) {
+	end := bytes.IndexByte(s.buf[s.pos:], '<')
+	if end < 0 {
+		return nil, false
+	}
+
+	t := s.buf[s.pos : s.pos+end]
+	if bytes.IndexAny(t, "&\r>") >= 0 {
+		return nil, false
+	}
+
+	s.pos += end
+	return t, true
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// isNameByte accepts the characters drivers use in attribute names. Namespace prefixes are left to encoding/xml.
+func isNameByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '_' || b == '-' || b == '.'
+}
@@ -0,0 +1,47 @@
+//go:build go1.18
+// +build go1.18
+
+package indiclient
+
+import (
+	"bytes"
+	"testing"
+)
+
+func FuzzParseMessage(f *testing.F) {
+	for _, seed := range loadCorpus(f) {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		item, err := ParseMessage(data)
+		if err == nil && item == nil {
+			t.Fatal("no message and no error")
+		}
+	})
+}
+
+func FuzzParser(f *testing.F) {
+	corpus := loadCorpus(f)
+	for _, seed := range corpus {
+		f.Add(append(append([]byte{}, seed...), corpus[0]...))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p := newParser(bytes.NewReader(data), DefaultParserLimits, ParseModeStrict|ParseModeCaptureUnknown)
+
+		// Every message, good or bad, uses up at least one byte, so the read loop cannot spin.
+		for i := 0; i <= len(data); i++ {
+			if _, err := p.next(); err != nil {
+				if err == ErrParserStuck {
+					t.Fatal(err)
+				}
+				if _, ok := err.(*ParseError); !ok {
+					return
+				}
+			}
+		}
+
+		t.Fatalf("parser did not finish %d bytes", len(data))
+	})
+}
@@ -0,0 +1,14 @@
+//go:build gofuzz
+// +build gofuzz
+
+package indiclient
+
+// Fuzz is the entry point for go-fuzz. Seed its corpus with testdata/corpus.
+func Fuzz(data []byte) int {
+	item, err := ParseMessage(data)
+	if err != nil || item == nil {
+		return 0
+	}
+
+	return 1
+}
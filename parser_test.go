@@ -0,0 +1,200 @@
+package indiclient
+
+import (
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validMessage = `<message device="Camera" message="hello"/>`
+
+func parseAll(input string, limits ParserLimits) ([]interface{}, []error) {
+	p := newParser(strings.NewReader(input), limits, ParseModeLenient)
+
+	items := []interface{}{}
+	errs := []error{}
+
+	for {
+		item, err := p.next()
+		if err == io.EOF {
+			return items, errs
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		items = append(items, item)
+	}
+}
+
+func Test_Parser_Valid(t *testing.T) {
+	items, errs := parseAll(`<defTextVector device="Camera" name="DEVICE_PORT"><defText name="PORT">/dev/ttyUSB0</defText></defTextVector>`+validMessage, DefaultParserLimits)
+
+	require.Empty(t, errs)
+	require.Len(t, items, 2)
+
+	def := items[0].(*DefTextVector)
+	assert.Equal(t, "DEVICE_PORT", def.Name)
+	assert.Equal(t, "/dev/ttyUSB0", def.Texts[0].Value)
+
+	assert.Equal(t, "hello", items[1].(*Message).Message)
+}
+
+func Test_Parser_MalformedRecovers(t *testing.T) {
+	items, errs := parseAll(`<setNumberVector device="Mount" name="EQUATORIAL_EOD_COORD"><oneNumber name="RA">1</oneNumber><<garbage & stuff`+validMessage, DefaultParserLimits)
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, "setNumberVector", errs[0].(*ParseError).Element)
+
+	require.Len(t, items, 1)
+	assert.Equal(t, "hello", items[0].(*Message).Message)
+}
+
+func Test_Parser_UnknownElement(t *testing.T) {
+	items, errs := parseAll(`<pingRequest uid="1"><inner/></pingRequest>`+validMessage, DefaultParserLimits)
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, &ParseError{Element: "pingRequest", Err: ErrUnknownElement}, errs[0])
+	require.Len(t, items, 1)
+}
+
+func Test_Parser_TooManyAttributes(t *testing.T) {
+	items, errs := parseAll(`<message device="Camera" a="1" b="2" c="3" message="too many"/>`+validMessage, ParserLimits{MaxAttributes: 3})
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, ErrTooManyAttributes, errs[0].(*ParseError).Err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "hello", items[0].(*Message).Message)
+}
+
+func Test_Parser_ElementTooLarge(t *testing.T) {
+	long := strings.Repeat("x", 100)
+
+	items, errs := parseAll(`<setTextVector device="Camera" name="P"><oneText name="T">`+long+`</oneText></setTextVector>`+
+		`<setBLOBVector device="Camera" name="CCD1"><oneBLOB name="CCD1" size="1" format=".fits">`+long+`</oneBLOB></setBLOBVector>`,
+		ParserLimits{MaxElementSize: 50})
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, ErrElementTooLarge, errs[0].(*ParseError).Err)
+
+	// BLOB data is only limited by MaxMessageSize.
+	require.Len(t, items, 1)
+	assert.IsType(t, &SetBlobVector{}, items[0])
+}
+
+func Test_Parser_MessageTooLarge(t *testing.T) {
+	items, errs := parseAll(`<setBLOBVector device="Camera" name="CCD1"><oneBLOB name="CCD1" size="1" format=".fits">`+strings.Repeat("x", 1000)+`</oneBLOB></setBLOBVector>`+validMessage,
+		ParserLimits{MaxMessageSize: 200})
+
+	require.Len(t, errs, 1)
+	assert.Equal(t, ErrMessageTooLarge, errs[0].(*ParseError).Err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "hello", items[0].(*Message).Message)
+}
+
+func Test_Parser_CaptureUnknown(t *testing.T) {
+	p := newParser(strings.NewReader(`<vendorVector device="Dome" name="SHUTTER_EXTRA"><vendorItem name="A">1</vendorItem></vendorVector>`), DefaultParserLimits, ParseModeCaptureUnknown)
+
+	_, err := p.next()
+	require.IsType(t, &ParseError{}, err)
+
+	perr := err.(*ParseError)
+	assert.Equal(t, ErrUnknownElement, perr.Err)
+	assert.Equal(t, "Dome", perr.Device)
+	assert.Equal(t, "SHUTTER_EXTRA", perr.Property)
+	assert.Equal(t, `<vendorVector device="Dome" name="SHUTTER_EXTRA"><vendorItem name="A">1</vendorItem></vendorVector>`, string(perr.Raw))
+}
+
+func Test_ParseError_Events(t *testing.T) {
+	c := newTestClient()
+	c.SetParseMode(ParseModeStrict | ParseModeCaptureUnknown)
+
+	events, id, err := c.Subscribe(SubscribeOptions{Device: "Dome"})
+	require.NoError(t, err)
+	defer c.Unsubscribe(id)
+
+	c.parseError(&ParseError{Element: "vendorVector", Device: "Dome", Err: ErrUnknownElement, Raw: []byte("<vendorVector/>")})
+
+	received := drain(events, 50*time.Millisecond)
+	require.Len(t, received, 2)
+
+	assert.Equal(t, EventTypeError, received[0].Type)
+	assert.Equal(t, "indiclient: parse error in vendorVector: unknown element", received[0].Error)
+
+	assert.Equal(t, EventTypeUnknownElement, received[1].Type)
+	assert.Equal(t, "<vendorVector/>", received[1].Raw)
+}
+
+func Test_Parser_FastPathMatchesDecoder(t *testing.T) {
+	inputs := []string{
+		benchSetNumberVector,
+		benchSetSwitchVector,
+		`<setNumberVector device='Focuser' name='ABS_FOCUS_POSITION' state='Ok'><oneNumber name='FOCUS_ABSOLUTE_POSITION'>500</oneNumber></setNumberVector>`,
+		`<setNumberVector device="Focuser" name="FOCUS_TEMPERATURE" timeout=" 5 " extra="ignored"><oneNumber name="TEMPERATURE" >12.5</oneNumber ></setNumberVector >`,
+		`<setNumberVector device="Mount" name="EQUATORIAL_EOD_COORD" state="Alert" message="[ERROR] Slew failed"><oneNumber name="RA">5.6</oneNumber></setNumberVector>`,
+		`<setSwitchVector device="Mount" name="TELESCOPE_PARK" state="Ok" message='Telescope parked.'><oneSwitch name="PARK">On</oneSwitch></setSwitchVector>`,
+		`<setNumberVector device="Mount" name="X" message="Slew &quot;failed&quot;"><oneNumber name="A">1</oneNumber></setNumberVector>`,
+		// These fall back to encoding/xml.
+		`<setNumberVector device="Foc&amp;user" name="X"><oneNumber name="A">1</oneNumber></setNumberVector>`,
+		`<setNumberVector device="Focuser" name="X"><message>moving</message><oneNumber name="A">1</oneNumber></setNumberVector>`,
+		"<setNumberVector device=\"Focuser\" name=\"X\"><oneNumber name=\"A\">1\r\n</oneNumber></setNumberVector>",
+		`<setSwitchVector device="Mount" name="X"><!-- comment --><oneSwitch name="A">On</oneSwitch></setSwitchVector>`,
+		`<setSwitchVector device="Mount" name="X"/>`,
+	}
+
+	for _, input := range inputs {
+		items, errs := parseAll(input+validMessage+input, DefaultParserLimits)
+		require.Empty(t, errs, input)
+		require.Len(t, items, 3, input)
+
+		expected := newMessage(strings.TrimLeft(input, "<")[:len("setNumberVector")])
+		require.NoError(t, xml.Unmarshal([]byte(input), expected), input)
+
+		if strings.Contains(input, "message=") {
+			require.NotEmpty(t, reflect.ValueOf(expected).Elem().FieldByName("Message").String(), input)
+		}
+
+		assert.Equal(t, expected, items[0], input)
+		assert.Equal(t, expected, items[2], input)
+	}
+}
+
+func Test_Parser_FastPathSplitReads(t *testing.T) {
+	input := strings.Repeat(benchSetNumberVector, 50)
+
+	// Deliver the input a few bytes at a time, so messages are split across reads.
+	p := newParser(iotest.OneByteReader(strings.NewReader(input)), DefaultParserLimits, ParseModeLenient)
+
+	for i := 0; i < 50; i++ {
+		item, err := p.next()
+		require.NoError(t, err)
+
+		v, ok := item.(*SetNumberVector)
+		require.True(t, ok)
+		require.Len(t, v.Numbers, 2)
+		assert.Equal(t, "RA", v.Numbers[0].Name)
+	}
+
+	_, err := p.next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func Test_Parser_FastPathLimits(t *testing.T) {
+	// A message follows the one that fails, since the parser resyncs to it after the error.
+	_, errs := parseAll(benchSetNumberVector+validMessage, ParserLimits{MaxAttributes: 2})
+	require.Len(t, errs, 1)
+	assert.Equal(t, ErrTooManyAttributes, errs[0].(*ParseError).Err)
+
+	_, errs = parseAll(benchSetNumberVector+validMessage, ParserLimits{MaxElementSize: 10})
+	require.Len(t, errs, 1)
+	assert.Equal(t, ErrElementTooLarge, errs[0].(*ParseError).Err)
+}
@@ -0,0 +1,508 @@
+// Package phd2 exposes guiding done through an INDIClient with the PHD2 event server protocol, so tools that monitor
+// or drive PHD2, such as imaging schedulers and guiding graphs, can follow a guider driven by this client:
+//
+//	b, err := phd2.NewBridge(c, phd2.Options{Guider: "Telescope Simulator"})
+//	...
+//	go b.ListenAndServe(phd2.DefaultAddr)
+//	defer b.Close()
+//
+//	b.StartGuiding()
+//	b.Dither(1.5, -0.8)
+//	b.SettleBegin()
+//	...
+//	b.SettleDone(nil)
+//
+// Guide pulses sent to the guider's TELESCOPE_TIMED_GUIDE_NS and TELESCOPE_TIMED_GUIDE_WE properties, by this client
+// or any other, are published as GuideStep events. The guiding state, dithers and settling are not visible to the
+// INDI server, so whatever does the guiding reports them with the methods of Bridge.
+//
+// Each event is a JSON object on its own line, ending with CRLF. Clients may send JSON-RPC requests on the same
+// connection; get_app_state, get_connected and get_paused are answered, and other methods return an error.
+package phd2
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// ErrBridgeClosed is returned by Serve after Close.
+var ErrBridgeClosed = errors.New("phd2 bridge closed")
+
+const (
+	// DefaultAddr is the address PHD2 serves its first instance's events on.
+	DefaultAddr = ":4400"
+	// Version is the PHD2 version reported to clients. Clients use it to decide which events and methods to expect.
+	Version = "2.6.11"
+
+	// writeTimeout is how long a client may take to accept an event before it is dropped, so a stalled client cannot
+	// hold up the others.
+	writeTimeout = 5 * time.Second
+
+	guideNS = "TELESCOPE_TIMED_GUIDE_NS"
+	guideWE = "TELESCOPE_TIMED_GUIDE_WE"
+)
+
+// AppState is the state of the guider, as PHD2 reports it.
+type AppState string
+
+const (
+	// AppStateStopped is when the guider is neither looping nor guiding.
+	AppStateStopped = AppState("Stopped")
+	// AppStateSelected is when a guide star is selected but not being guided on.
+	AppStateSelected = AppState("Selected")
+	// AppStateCalibrating is while the guider is calibrating.
+	AppStateCalibrating = AppState("Calibrating")
+	// AppStateGuiding is while the guider is guiding.
+	AppStateGuiding = AppState("Guiding")
+	// AppStateLostLock is when the guide star has been lost while guiding.
+	AppStateLostLock = AppState("LostLock")
+	// AppStatePaused is when guiding is paused.
+	AppStatePaused = AppState("Paused")
+	// AppStateLooping is when the guide camera is taking exposures without guiding.
+	AppStateLooping = AppState("Looping")
+)
+
+// Options controls a Bridge.
+type Options struct {
+	// Guider is the device guide pulses are sent to, usually the mount or an ST4 guide port.
+	Guider string
+	// Host is reported as the host in every event. Defaults to the host name.
+	Host string
+	// Instance is the PHD2 instance number reported in every event. Defaults to 1.
+	Instance int
+}
+
+// GuideStep is a single guiding correction. Distances are in guide camera pixels, and durations in milliseconds.
+// Directions are North or South, and East or West.
+type GuideStep struct {
+	Frame            int     `json:"Frame"`
+	Time             float64 `json:"Time"`
+	Mount            string  `json:"Mount"`
+	DX               float64 `json:"dx"`
+	DY               float64 `json:"dy"`
+	RADistanceRaw    float64 `json:"RADistanceRaw"`
+	DECDistanceRaw   float64 `json:"DECDistanceRaw"`
+	RADistanceGuide  float64 `json:"RADistanceGuide"`
+	DECDistanceGuide float64 `json:"DECDistanceGuide"`
+	RADuration       int     `json:"RADuration,omitempty"`
+	RADirection      string  `json:"RADirection,omitempty"`
+	DECDuration      int     `json:"DECDuration,omitempty"`
+	DECDirection     string  `json:"DECDirection,omitempty"`
+	StarMass         float64 `json:"StarMass,omitempty"`
+	SNR              float64 `json:"SNR,omitempty"`
+	HFD              float64 `json:"HFD,omitempty"`
+}
+
+// Bridge publishes guiding events to clients connected with the PHD2 event server protocol.
+type Bridge struct {
+	c    *indiclient.INDIClient
+	opts Options
+	id   string
+	wg   sync.WaitGroup
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	state     AppState
+	frame     int
+	started   time.Time
+}
+
+// NewBridge creates a Bridge that publishes the guide pulses sent to opts.Guider. Serve it with Serve or
+// ListenAndServe, and remember to call Close when you are done with it.
+func NewBridge(c *indiclient.INDIClient, opts Options) (*Bridge, error) {
+	if len(opts.Host) == 0 {
+		opts.Host, _ = os.Hostname()
+	}
+	if opts.Instance <= 0 {
+		opts.Instance = 1
+	}
+
+	b := &Bridge{
+		c:         c,
+		opts:      opts,
+		listeners: map[net.Listener]struct{}{},
+		conns:     map[net.Conn]struct{}{},
+		state:     AppStateStopped,
+	}
+
+	if len(opts.Guider) > 0 {
+		events, id, err := c.Subscribe(indiclient.SubscribeOptions{Device: opts.Guider, Types: []indiclient.EventType{indiclient.EventTypeUpdate}})
+		if err != nil {
+			return nil, err
+		}
+
+		b.id = id
+
+		b.wg.Add(1)
+		go b.watch(events)
+	}
+
+	return b, nil
+}
+
+// ListenAndServe listens on addr, usually DefaultAddr, and serves clients until Close is called.
+func (b *Bridge) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return b.Serve(ln)
+}
+
+// Serve accepts clients on ln until Close is called, and then returns ErrBridgeClosed. Each client is sent the
+// Version and AppState events as soon as it connects.
+func (b *Bridge) Serve(ln net.Listener) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		ln.Close()
+		return ErrBridgeClosed
+	}
+	b.listeners[ln] = struct{}{}
+	b.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			b.mu.Lock()
+			closed := b.closed
+			delete(b.listeners, ln)
+			b.mu.Unlock()
+
+			if closed {
+				return ErrBridgeClosed
+			}
+			return err
+		}
+
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			conn.Close()
+			return ErrBridgeClosed
+		}
+
+		b.conns[conn] = struct{}{}
+		b.send(conn, b.event("Version", map[string]interface{}{
+			"PHDVersion":     Version,
+			"PHDSubver":      "",
+			"OverlapSupport": true,
+			"MsgVersion":     1,
+		}))
+		b.send(conn, b.event("AppState", map[string]interface{}{"State": b.state}))
+		b.mu.Unlock()
+
+		b.wg.Add(1)
+		go b.read(conn)
+	}
+}
+
+// Close disconnects every client, stops Serve, and stops following the guider.
+func (b *Bridge) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	for ln := range b.listeners {
+		ln.Close()
+	}
+	for conn := range b.conns {
+		conn.Close()
+	}
+	b.mu.Unlock()
+
+	var err error
+	if len(b.id) > 0 {
+		err = b.c.Unsubscribe(b.id)
+	}
+
+	b.wg.Wait()
+
+	return err
+}
+
+// State returns the state last reported to clients.
+func (b *Bridge) State() AppState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// SetState reports a change of state that has no event of its own, such as AppStateLooping or AppStateCalibrating.
+func (b *Bridge) SetState(state AppState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = state
+	b.publish(b.event("AppState", map[string]interface{}{"State": state}))
+}
+
+// StartGuiding reports that guiding has started. Guide steps are numbered, and timed, from here.
+func (b *Bridge) StartGuiding() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = AppStateGuiding
+	b.frame = 0
+	b.started = b.c.Clock().Now()
+	b.publish(b.event("StartGuiding", nil))
+}
+
+// StopGuiding reports that guiding has stopped.
+func (b *Bridge) StopGuiding() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = AppStateStopped
+	b.publish(b.event("GuidingStopped", nil))
+}
+
+// Pause reports that guiding is paused.
+func (b *Bridge) Pause() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = AppStatePaused
+	b.publish(b.event("Paused", nil))
+}
+
+// Resume reports that guiding has resumed after Pause.
+func (b *Bridge) Resume() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = AppStateGuiding
+	b.publish(b.event("Resumed", nil))
+}
+
+// Dither reports that the lock position was moved by dx, dy guide camera pixels.
+func (b *Bridge) Dither(dx, dy float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.publish(b.event("GuidingDithered", map[string]interface{}{"dx": dx, "dy": dy}))
+}
+
+// SettleBegin reports that the guider has started waiting to settle, usually after a dither.
+func (b *Bridge) SettleBegin() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.publish(b.event("SettleBegin", nil))
+}
+
+// Settling reports progress while settling: the distance in pixels from the lock position, how long settling has
+// taken, and how long the distance must stay within tolerance.
+func (b *Bridge) Settling(distance float64, elapsed, settleTime time.Duration, starLocked bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.publish(b.event("Settling", map[string]interface{}{
+		"Distance":   distance,
+		"Time":       elapsed.Seconds(),
+		"SettleTime": settleTime.Seconds(),
+		"StarLocked": starLocked,
+	}))
+}
+
+// SettleDone reports that settling has finished, successfully if err is nil.
+func (b *Bridge) SettleDone(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	fields := map[string]interface{}{"Status": 0}
+	if err != nil {
+		fields["Status"] = 1
+		fields["Error"] = err.Error()
+	}
+
+	b.publish(b.event("SettleDone", fields))
+}
+
+// StarLost reports that the guide star was lost.
+func (b *Bridge) StarLost() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == AppStateGuiding {
+		b.state = AppStateLostLock
+	}
+
+	b.publish(b.event("StarLost", map[string]interface{}{"Frame": b.frame, "Time": b.elapsed()}))
+}
+
+// GuideStep reports a guiding correction measured by the guider. If step.Frame is zero it is numbered after the last
+// step, and if step.Time is zero it is timed from StartGuiding.
+func (b *Bridge) GuideStep(step GuideStep) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.guideStep(step)
+}
+
+// guideStep numbers, times and publishes step. Only call when Bridge.mu is locked.
+func (b *Bridge) guideStep(step GuideStep) {
+	if step.Frame == 0 {
+		b.frame++
+		step.Frame = b.frame
+	} else {
+		b.frame = step.Frame
+	}
+
+	if step.Time == 0 {
+		step.Time = b.elapsed()
+	}
+
+	if len(step.Mount) == 0 {
+		step.Mount = b.opts.Guider
+	}
+
+	if b.state == AppStateLostLock {
+		b.state = AppStateGuiding
+	}
+
+	fields := map[string]interface{}{}
+	raw, _ := json.Marshal(step)
+	_ = json.Unmarshal(raw, &fields)
+
+	b.publish(b.event("GuideStep", fields))
+}
+
+// elapsed returns the seconds since StartGuiding. Only call when Bridge.mu is locked.
+func (b *Bridge) elapsed() float64 {
+	if b.started.IsZero() {
+		return 0
+	}
+
+	return b.c.Clock().Now().Sub(b.started).Seconds()
+}
+
+// watch publishes a GuideStep for every guide pulse the guider starts.
+func (b *Bridge) watch(events <-chan indiclient.Event) {
+	defer b.wg.Done()
+
+	for e := range events {
+		if e.State != indiclient.PropertyStateBusy || (e.Property != guideNS && e.Property != guideWE) {
+			continue
+		}
+
+		prop, err := b.c.GetNumberProperty(b.opts.Guider, e.Property)
+		if err != nil {
+			continue
+		}
+
+		step := GuideStep{}
+
+		for name, v := range prop.Values {
+			ms, err := indiclient.ParseNumber(v.Value)
+			if err != nil || ms <= 0 {
+				continue
+			}
+
+			switch name {
+			case "TIMED_GUIDE_N":
+				step.DECDuration, step.DECDirection = int(ms), "North"
+			case "TIMED_GUIDE_S":
+				step.DECDuration, step.DECDirection = int(ms), "South"
+			case "TIMED_GUIDE_E":
+				step.RADuration, step.RADirection = int(ms), "East"
+			case "TIMED_GUIDE_W":
+				step.RADuration, step.RADirection = int(ms), "West"
+			}
+		}
+
+		if step.RADuration == 0 && step.DECDuration == 0 {
+			continue
+		}
+
+		b.GuideStep(step)
+	}
+}
+
+// rpcRequest is a JSON-RPC request sent by a client.
+type rpcRequest struct {
+	Method string          `json:"method"`
+	ID     json.RawMessage `json:"id"`
+}
+
+// read answers the JSON-RPC requests of a client until it disconnects.
+func (b *Bridge) read(conn net.Conn) {
+	defer b.wg.Done()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		req := rpcRequest{}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || len(req.Method) == 0 {
+			continue
+		}
+
+		reply := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+
+		b.mu.Lock()
+		switch req.Method {
+		case "get_app_state":
+			reply["result"] = b.state
+		case "get_connected":
+			_, err := b.c.GetDevice(b.opts.Guider)
+			reply["result"] = err == nil
+		case "get_paused":
+			reply["result"] = b.state == AppStatePaused
+		default:
+			reply["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+		}
+		b.send(conn, reply)
+		b.mu.Unlock()
+	}
+
+	b.mu.Lock()
+	delete(b.conns, conn)
+	b.mu.Unlock()
+
+	conn.Close()
+}
+
+// event returns the event name with fields, and the fields PHD2 puts in every event.
+func (b *Bridge) event(name string, fields map[string]interface{}) map[string]interface{} {
+	e := map[string]interface{}{}
+	for k, v := range fields {
+		e[k] = v
+	}
+
+	e["Event"] = name
+	e["Timestamp"] = float64(b.c.Clock().Now().UnixNano()) / 1e9
+	e["Host"] = b.opts.Host
+	e["Inst"] = b.opts.Instance
+
+	return e
+}
+
+// publish sends msg to every client. Only call when Bridge.mu is locked.
+func (b *Bridge) publish(msg map[string]interface{}) {
+	for conn := range b.conns {
+		b.send(conn, msg)
+	}
+}
+
+// send writes msg to conn as a line of JSON, and drops the client if that fails. Only call when Bridge.mu is locked.
+func (b *Bridge) send(conn net.Conn, msg map[string]interface{}) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	if _, err := conn.Write(append(data, '\r', '\n')); err != nil {
+		delete(b.conns, conn)
+		conn.Close()
+	}
+}
@@ -0,0 +1,130 @@
+package phd2_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/phd2"
+	"github.com/goastro/indiclient/simulators"
+)
+
+// next returns the next event or reply sent to a client.
+func next(t *testing.T, conn net.Conn, scanner *bufio.Scanner) map[string]interface{} {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	require.True(t, scanner.Scan(), "no message from bridge")
+
+	msg := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &msg))
+
+	return msg
+}
+
+func Test_Bridge(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	telescope := simulators.NewTelescope("Telescope Simulator")
+	c := indiclient.NewINDIClient(log, simulators.NewServer(telescope), afero.NewMemMapFs(), 100)
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+	require.NoError(t, c.GetProperties("", ""))
+
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == 1 })
+	require.NoError(t, c.SetSwitchValue("Telescope Simulator", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn}))
+	testutil.WaitFor(t, func() bool { return c.NumberPropertySet("Telescope Simulator", "TELESCOPE_TIMED_GUIDE_WE") })
+
+	b, err := phd2.NewBridge(c, phd2.Options{Guider: "Telescope Simulator", Host: "observatory"})
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() { served <- b.Serve(ln) }()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+
+	msg := next(t, conn, scanner)
+	assert.Equal(t, "Version", msg["Event"])
+	assert.Equal(t, phd2.Version, msg["PHDVersion"])
+	assert.Equal(t, "observatory", msg["Host"])
+	assert.Equal(t, 1.0, msg["Inst"])
+
+	msg = next(t, conn, scanner)
+	assert.Equal(t, "AppState", msg["Event"])
+	assert.Equal(t, "Stopped", msg["State"])
+
+	b.StartGuiding()
+	assert.Equal(t, "StartGuiding", next(t, conn, scanner)["Event"])
+
+	err = c.SetNumberValue("Telescope Simulator", "TELESCOPE_TIMED_GUIDE_WE", []string{"TIMED_GUIDE_W", "TIMED_GUIDE_E"}, []string{"0", "150"})
+	require.NoError(t, err)
+
+	msg = next(t, conn, scanner)
+	assert.Equal(t, "GuideStep", msg["Event"])
+	assert.Equal(t, 1.0, msg["Frame"])
+	assert.Equal(t, "Telescope Simulator", msg["Mount"])
+	assert.Equal(t, 150.0, msg["RADuration"])
+	assert.Equal(t, "East", msg["RADirection"])
+	assert.NotContains(t, msg, "DECDuration")
+
+	b.Dither(1.5, -0.5)
+	msg = next(t, conn, scanner)
+	assert.Equal(t, "GuidingDithered", msg["Event"])
+	assert.Equal(t, 1.5, msg["dx"])
+
+	b.SettleBegin()
+	assert.Equal(t, "SettleBegin", next(t, conn, scanner)["Event"])
+
+	b.Settling(0.8, 2*time.Second, 10*time.Second, true)
+	msg = next(t, conn, scanner)
+	assert.Equal(t, "Settling", msg["Event"])
+	assert.Equal(t, 10.0, msg["SettleTime"])
+
+	b.SettleDone(errors.New("timed out"))
+	msg = next(t, conn, scanner)
+	assert.Equal(t, "SettleDone", msg["Event"])
+	assert.Equal(t, 1.0, msg["Status"])
+	assert.Equal(t, "timed out", msg["Error"])
+
+	_, err = conn.Write([]byte(`{"method":"get_app_state","id":7}` + "\r\n"))
+	require.NoError(t, err)
+
+	msg = next(t, conn, scanner)
+	assert.Equal(t, "Guiding", msg["result"])
+	assert.Equal(t, 7.0, msg["id"])
+
+	_, err = conn.Write([]byte(`{"method":"dither","id":8}` + "\r\n"))
+	require.NoError(t, err)
+
+	msg = next(t, conn, scanner)
+	assert.Contains(t, msg, "error")
+
+	b.StopGuiding()
+	assert.Equal(t, "GuidingStopped", next(t, conn, scanner)["Event"])
+	assert.Equal(t, phd2.AppStateStopped, b.State())
+
+	require.NoError(t, b.Close())
+
+	select {
+	case err := <-served:
+		assert.Equal(t, phd2.ErrBridgeClosed, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Serve to return")
+	}
+}
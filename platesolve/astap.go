@@ -0,0 +1,116 @@
+package platesolve
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/goastro/indiclient/imaging"
+)
+
+// ASTAP solves frames with the command line of ASTAP, the Astrometric STAcking Program. A star database must be
+// installed. Without a PixelScale hint, ASTAP takes the field of view from the FOCALLEN and XPIXSZ keywords of FITS
+// frames.
+type ASTAP struct {
+	// Path is the astap executable. Defaults to astap on the PATH.
+	Path string
+	// Args are added to the arguments of every run, e.g. "-z", "2" to downsample.
+	Args []string
+}
+
+// Solve runs astap on the image at path.
+func (a ASTAP) Solve(ctx context.Context, path string, hint Hint) (Solution, error) {
+	dir, err := ioutil.TempDir("", "astap")
+	if err != nil {
+		return Solution{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "solution")
+
+	args := []string{"-f", path, "-o", out}
+
+	if hint.Radius > 0 {
+		// ASTAP takes the declination as the distance from the south celestial pole.
+		args = append(args,
+			"-ra", formatFloat(hint.RA),
+			"-spd", formatFloat(hint.Dec+90),
+			"-r", formatFloat(hint.Radius),
+		)
+	} else {
+		args = append(args, "-r", "180")
+	}
+
+	if hint.PixelScale > 0 {
+		// ASTAP takes the height of the field of view rather than the pixel scale, which it reports back instead.
+		if height := fitsHeight(path); height > 0 {
+			args = append(args, "-fov", formatFloat(hint.PixelScale*float64(height)/3600))
+		}
+	}
+
+	args = append(args, a.Args...)
+
+	err = run(ctx, a.Path, "astap", args)
+
+	// astap exits with an error when it finds no solution, but still writes the .ini file saying so.
+	keywords, iniErr := readINI(out + ".ini")
+	if iniErr != nil {
+		if err != nil {
+			return Solution{}, err
+		}
+		return Solution{}, iniErr
+	}
+
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return Solution{}, err
+	}
+
+	if keywords["PLTSOLVD"] != "T" {
+		return Solution{}, ErrNotSolved
+	}
+
+	return fromWCS(keywords)
+}
+
+// readINI reads the key=value lines of the .ini file astap writes.
+func readINI(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keywords := map[string]string{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) == 2 {
+			keywords[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	return keywords, scanner.Err()
+}
+
+// fitsHeight returns the height in pixels of the FITS file at path, or 0 if it is not a FITS file.
+func fitsHeight(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	h, err := imaging.ReadFITSHeader(f)
+	if err != nil {
+		return 0
+	}
+
+	height, _ := strconv.Atoi(h.Keywords["NAXIS2"])
+	return height
+}
@@ -0,0 +1,89 @@
+package platesolve
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/goastro/indiclient/imaging"
+)
+
+// AstrometryNet solves frames with solve-field, the local solver of astrometry.net. The index files for the field
+// of view of the camera must be installed.
+type AstrometryNet struct {
+	// Path is the solve-field executable. Defaults to solve-field on the PATH.
+	Path string
+	// Args are added to the arguments of every run, e.g. "--downsample", "2".
+	Args []string
+}
+
+// Solve runs solve-field on the image at path.
+func (a AstrometryNet) Solve(ctx context.Context, path string, hint Hint) (Solution, error) {
+	dir, err := ioutil.TempDir("", "solve-field")
+	if err != nil {
+		return Solution{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"--overwrite", "--no-plots", "--new-fits", "none", "--dir", dir, "--out", "solution"}
+
+	if hint.Radius > 0 {
+		args = append(args,
+			"--ra", formatFloat(hint.RA*15),
+			"--dec", formatFloat(hint.Dec),
+			"--radius", formatFloat(hint.Radius),
+		)
+	}
+
+	if hint.PixelScale > 0 {
+		args = append(args,
+			"--scale-units", "arcsecperpix",
+			"--scale-low", formatFloat(hint.PixelScale*0.9),
+			"--scale-high", formatFloat(hint.PixelScale*1.1),
+		)
+	}
+
+	args = append(args, a.Args...)
+	args = append(args, path)
+
+	if err := run(ctx, a.Path, "solve-field", args); err != nil {
+		return Solution{}, err
+	}
+
+	// solve-field succeeds whether or not it found a solution, and only writes the .wcs file if it did.
+	f, err := os.Open(filepath.Join(dir, "solution.wcs"))
+	if os.IsNotExist(err) {
+		return Solution{}, ErrNotSolved
+	} else if err != nil {
+		return Solution{}, err
+	}
+	defer f.Close()
+
+	h, err := imaging.ReadFITSHeader(f)
+	if err != nil {
+		return Solution{}, err
+	}
+
+	return fromWCS(h.Keywords)
+}
+
+// run runs the executable path, or name on the PATH if path is empty, killing it if ctx is cancelled.
+func run(ctx context.Context, path, name string, args []string) error {
+	if path == "" {
+		path = name
+	}
+
+	err := exec.CommandContext(ctx, path, args...).Run()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,207 @@
+// Package platesolve finds where a camera is pointing by matching the stars in a frame against a star catalog, using
+// an external plate solver, and syncs the mount to it:
+//
+//	solution, err := platesolve.SolveAndSync(ctx, c, platesolve.ASTAP{}, platesolve.Options{
+//		Mount:    "Telescope Simulator",
+//		Camera:   "CCD Simulator",
+//		Exposure: 5,
+//		Radius:   10,
+//	})
+//
+// Solvers work on image files, so any solver with a command line can be adapted with the Solver interface. RA is in
+// hours and Dec in degrees throughout. Solutions are in J2000; mounts are synced in JNow, the epoch INDI drivers use
+// for EQUATORIAL_EOD_COORD.
+package platesolve
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/astro"
+)
+
+var (
+	// ErrNotSolved is returned when a solver could not find a solution for a frame.
+	ErrNotSolved = errors.New("frame could not be solved")
+	// ErrFrameTimeout is returned when a frame does not arrive within Options.FrameTimeout beyond the exposure time.
+	ErrFrameTimeout = errors.New("timed out waiting for frame")
+)
+
+// DefaultFrameTimeout is how long SolveAndSync waits for a frame beyond the exposure time.
+const DefaultFrameTimeout = 30 * time.Second
+
+// Hint narrows the search of a solver, which makes solving much faster. Zero values leave that part of the search
+// open.
+type Hint struct {
+	// RA and Dec are the J2000 coordinates the frame is expected to be centered near.
+	RA  float64 `json:"ra"`
+	Dec float64 `json:"dec"`
+	// Radius is how far from RA and Dec to search, in degrees. If zero, RA and Dec are ignored and the whole sky is
+	// searched.
+	Radius float64 `json:"radius"`
+	// PixelScale is the expected size of a pixel on the sky, in arcseconds.
+	PixelScale float64 `json:"pixelScale"`
+}
+
+// Solution is where a solved frame is pointing.
+type Solution struct {
+	// RA and Dec are the J2000 coordinates of the center of the frame.
+	RA  float64 `json:"ra"`
+	Dec float64 `json:"dec"`
+	// Rotation is the position angle of the frame's up (+Y) direction, in degrees east of north, from 0 to 360.
+	Rotation float64 `json:"rotation"`
+	// PixelScale is the size of a pixel on the sky, in arcseconds.
+	PixelScale float64 `json:"pixelScale"`
+}
+
+// Solver solves the image file at path.
+type Solver interface {
+	// Solve returns ErrNotSolved if the solver ran but found no solution. Cancelling ctx stops the solver.
+	Solve(ctx context.Context, path string, hint Hint) (Solution, error)
+}
+
+// Options controls SolveAndSync.
+type Options struct {
+	// Mount and Camera are the device names.
+	Mount  string
+	Camera string
+	// Exposure is the exposure time of the frame, in seconds.
+	Exposure float64
+	// Radius, if set, limits the search to this many degrees around where the mount reports it is pointing.
+	Radius float64
+	// PixelScale, if set, is passed to the solver as the expected pixel scale, in arcseconds.
+	PixelScale float64
+	// FrameTimeout is how long to wait for a frame beyond the exposure time. Defaults to DefaultFrameTimeout.
+	FrameTimeout time.Duration
+}
+
+// SolveAndSync takes a frame with the camera, solves it, and syncs the mount to the solution, so that the mount
+// reports where it is actually pointing. The frame is written to a temporary file for the solver, which is removed
+// afterwards.
+func SolveAndSync(ctx context.Context, c *indiclient.INDIClient, solver Solver, opts Options) (Solution, error) {
+	if opts.FrameTimeout <= 0 {
+		opts.FrameTimeout = DefaultFrameTimeout
+	}
+
+	hint := Hint{PixelScale: opts.PixelScale}
+
+	if opts.Radius > 0 {
+		ra, dec, err := mountPosition(c, opts.Mount)
+		if err != nil {
+			return Solution{}, err
+		}
+
+		hint.RA, hint.Dec = astro.ToJ2000(ra, dec, c.Clock().Now())
+		hint.Radius = opts.Radius
+	}
+
+	path, err := capture(ctx, c, opts)
+	if err != nil {
+		return Solution{}, err
+	}
+	defer os.Remove(path)
+
+	solution, err := solver.Solve(ctx, path, hint)
+	if err != nil {
+		return solution, err
+	}
+
+	return solution, Sync(c, opts.Mount, solution.RA, solution.Dec)
+}
+
+// Sync tells the mount it is pointing at the J2000 coordinates ra and dec, without moving it. The mount's
+// ON_COORD_SET is left as it was found.
+func Sync(c *indiclient.INDIClient, mount string, ra, dec float64) error {
+	prop, err := c.GetSwitchProperty(mount, "ON_COORD_SET")
+	if err != nil {
+		return err
+	}
+
+	previous := ""
+	for _, name := range prop.Order {
+		if prop.Values[name].Value == indiclient.SwitchStateOn {
+			previous = name
+		}
+	}
+
+	if err := c.SelectSwitch(mount, "ON_COORD_SET", "SYNC"); err != nil {
+		return err
+	}
+
+	ra, dec = astro.ToJNow(ra, dec, c.Clock().Now())
+
+	err = c.SetNumber(mount, "EQUATORIAL_EOD_COORD", map[string]float64{"RA": ra, "DEC": dec})
+
+	if previous != "" && previous != "SYNC" {
+		if restoreErr := c.SelectSwitch(mount, "ON_COORD_SET", previous); err == nil {
+			err = restoreErr
+		}
+	}
+
+	return err
+}
+
+// mountPosition returns the JNow coordinates the mount reports.
+func mountPosition(c *indiclient.INDIClient, mount string) (ra, dec float64, err error) {
+	for name, f := range map[string]*float64{"RA": &ra, "DEC": &dec} {
+		val, err := c.GetNumber(mount, "EQUATORIAL_EOD_COORD", name)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		*f, err = indiclient.ParseNumber(val.Value)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return ra, dec, nil
+}
+
+// capture takes a frame and writes it to a temporary file, returning its path.
+func capture(ctx context.Context, c *indiclient.INDIClient, opts Options) (string, error) {
+	timeout := time.Duration(opts.Exposure*float64(time.Second)) + opts.FrameTimeout
+
+	frameCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	e, err := c.CaptureFrame(frameCtx, opts.Camera, opts.Exposure)
+	if err != nil {
+		if err == context.DeadlineExceeded && ctx.Err() == nil {
+			err = ErrFrameTimeout
+		}
+		return "", err
+	}
+
+	// Solvers tell the file type from its extension; stream_fits and similar are plain FITS files.
+	ext := e.Format
+	if i := strings.LastIndex(ext, "_"); i >= 0 {
+		ext = "." + ext[i+1:]
+	}
+
+	f, err := ioutil.TempFile("", "platesolve-*"+ext)
+	if err != nil {
+		return "", err
+	}
+
+	rdr := e.Open()
+	_, err = io.Copy(f, rdr)
+	rdr.Close()
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
@@ -0,0 +1,239 @@
+package platesolve_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/astro"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/platesolve"
+	"github.com/goastro/indiclient/simulators"
+)
+
+// fakeSolver writes a shell script to dir that records its arguments to args.txt and copies fixture to the output
+// file the real solver would write, named by the value of outFlag plus ext, or to nowhere if fixture is empty.
+func fakeSolver(t *testing.T, dir, name, outFlag, ext, fixture string, exitCode int) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake solvers are shell scripts")
+	}
+
+	fixturePath := filepath.Join(dir, name+".fixture")
+	require.NoError(t, ioutil.WriteFile(fixturePath, []byte(fixture), 0644))
+
+	script := `#!/bin/sh
+echo "$@" > "` + filepath.Join(dir, "args.txt") + `"
+while [ $# -gt 0 ]; do
+	case "$1" in
+		--dir) dir="$2/" ;;
+		` + outFlag + `) out="$2" ;;
+	esac
+	shift
+done
+if [ -s "` + fixturePath + `" ]; then
+	cp "` + fixturePath + `" "$dir$out` + ext + `"
+fi
+exit ` + string(rune('0'+exitCode)) + `
+`
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(script), 0755))
+
+	return path
+}
+
+func readArgs(t *testing.T, dir string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "args.txt"))
+	require.NoError(t, err)
+	return strings.TrimSpace(string(b))
+}
+
+func wcsHeader(keywords ...simulators.Keyword) string {
+	return string(simulators.EncodeFITS(0, 0, nil, keywords...))
+}
+
+func Test_AstrometryNet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "platesolve")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// A frame rotated by 90 degrees, with the reference pixel in the corner, as solve-field writes it.
+	path := fakeSolver(t, dir, "solve-field", "--out", ".wcs", wcsHeader(
+		simulators.Keyword{Name: "IMAGEW", Value: "100"},
+		simulators.Keyword{Name: "IMAGEH", Value: "80"},
+		simulators.Keyword{Name: "CRPIX1", Value: "1"},
+		simulators.Keyword{Name: "CRPIX2", Value: "1"},
+		simulators.Keyword{Name: "CRVAL1", Value: "150"},
+		simulators.Keyword{Name: "CRVAL2", Value: "20"},
+		simulators.Keyword{Name: "CD1_1", Value: "0"},
+		simulators.Keyword{Name: "CD1_2", Value: "0.0005"},
+		simulators.Keyword{Name: "CD2_1", Value: "0.0005"},
+		simulators.Keyword{Name: "CD2_2", Value: "0"},
+	), 0)
+
+	solver := platesolve.AstrometryNet{Path: path}
+
+	solution, err := solver.Solve(context.Background(), "frame.fits", platesolve.Hint{RA: 10, Dec: 20, Radius: 5, PixelScale: 1.8})
+	require.NoError(t, err)
+
+	assert.InDelta(t, 150.021/15, solution.RA, 0.001/15)
+	assert.InDelta(t, 20.0247, solution.Dec, 0.001)
+	assert.InDelta(t, 90, solution.Rotation, 1e-9)
+	assert.InDelta(t, 1.8, solution.PixelScale, 1e-9)
+
+	args := readArgs(t, dir)
+	assert.Contains(t, args, "--ra 150 --dec 20 --radius 5")
+	assert.Contains(t, args, "--scale-units arcsecperpix --scale-low 1.62 --scale-high 1.98")
+	assert.True(t, strings.HasSuffix(args, "frame.fits"), args)
+}
+
+func Test_AstrometryNet_NotSolved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "platesolve")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := fakeSolver(t, dir, "solve-field", "--out", ".wcs", "", 0)
+
+	_, err = platesolve.AstrometryNet{Path: path}.Solve(context.Background(), "frame.fits", platesolve.Hint{})
+	assert.Equal(t, platesolve.ErrNotSolved, err)
+
+	args := readArgs(t, dir)
+	assert.NotContains(t, args, "--ra")
+	assert.NotContains(t, args, "--scale-units")
+}
+
+func Test_ASTAP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "platesolve")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := fakeSolver(t, dir, "astap", "-o", ".ini", strings.Join([]string{
+		"PLTSOLVD=T",
+		"CRPIX1=50.5",
+		"CRPIX2=40.5",
+		"CRVAL1=150",
+		"CRVAL2=-20",
+		"CDELT1=-0.0005",
+		"CDELT2=0.0005",
+		"CROTA2=30",
+		"CMDLINE=astap",
+	}, "\n"), 0)
+
+	solution, err := platesolve.ASTAP{Path: path}.Solve(context.Background(), "frame.fits", platesolve.Hint{RA: 10, Dec: -20, Radius: 5})
+	require.NoError(t, err)
+
+	assert.InDelta(t, 10, solution.RA, 1e-9)
+	assert.InDelta(t, -20, solution.Dec, 1e-9)
+	assert.InDelta(t, 330, solution.Rotation, 1e-9)
+	assert.InDelta(t, 1.8, solution.PixelScale, 1e-9)
+
+	assert.Contains(t, readArgs(t, dir), "-ra 10 -spd 70 -r 5")
+}
+
+func Test_ASTAP_NotSolved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "platesolve")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := fakeSolver(t, dir, "astap", "-o", ".ini", "PLTSOLVD=F\nERROR=No solution found!", 1)
+
+	_, err = platesolve.ASTAP{Path: path}.Solve(context.Background(), "frame.fits", platesolve.Hint{})
+	assert.Equal(t, platesolve.ErrNotSolved, err)
+
+	assert.Contains(t, readArgs(t, dir), "-r 180")
+}
+
+func Test_ASTAP_Failed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "platesolve")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// A solver that fails without writing a result returns its own error.
+	path := fakeSolver(t, dir, "astap", "-o", ".ini", "", 2)
+
+	_, err = platesolve.ASTAP{Path: path}.Solve(context.Background(), "frame.fits", platesolve.Hint{})
+	assert.Error(t, err)
+	assert.NotEqual(t, platesolve.ErrNotSolved, err)
+}
+
+func Test_SolveAndSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "platesolve")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := fakeSolver(t, dir, "astap", "-o", ".ini", strings.Join([]string{
+		"PLTSOLVD=T",
+		"CRVAL1=150",
+		"CRVAL2=20",
+		"CD1_1=-0.0005",
+		"CD1_2=0",
+		"CD2_1=0",
+		"CD2_2=0.0005",
+	}, "\n"), 0)
+
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	devices := []simulators.Device{simulators.NewTelescope("Telescope Simulator"), simulators.NewCCD("CCD Simulator")}
+	c := indiclient.NewINDIClient(log, simulators.NewServer(devices...), afero.NewMemMapFs(), 100)
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+	require.NoError(t, c.GetProperties("", ""))
+
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == len(devices) })
+
+	for _, d := range devices {
+		err := c.SetSwitchValue(d.Name(), "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+		require.NoError(t, err)
+	}
+
+	testutil.WaitFor(t, func() bool {
+		return c.BlobPropertySet("CCD Simulator", "CCD1") && c.NumberPropertySet("Telescope Simulator", "EQUATORIAL_EOD_COORD")
+	})
+
+	solution, err := platesolve.SolveAndSync(context.Background(), c, platesolve.ASTAP{Path: path}, platesolve.Options{
+		Mount:    "Telescope Simulator",
+		Camera:   "CCD Simulator",
+		Exposure: 0.01,
+		Radius:   10,
+	})
+	require.NoError(t, err)
+
+	assert.InDelta(t, 10, solution.RA, 1e-9)
+	assert.InDelta(t, 20, solution.Dec, 1e-9)
+
+	// The hint is the mount position, which starts at the pole, and the frame is a FITS file.
+	args := readArgs(t, dir)
+	assert.Regexp(t, `-spd 179\.\d+ -r 10`, args)
+	assert.Regexp(t, `platesolve-\d+\.fits`, args)
+
+	wantRA, wantDec := astro.ToJNow(10, 20, time.Now())
+
+	ra, err := c.GetNumber("Telescope Simulator", "EQUATORIAL_EOD_COORD", "RA")
+	require.NoError(t, err)
+	dec, err := c.GetNumber("Telescope Simulator", "EQUATORIAL_EOD_COORD", "DEC")
+	require.NoError(t, err)
+
+	assert.InDelta(t, wantRA, mustParse(t, ra.Value), 1e-4)
+	assert.InDelta(t, wantDec, mustParse(t, dec.Value), 1e-3)
+
+	track, err := c.GetSwitch("Telescope Simulator", "ON_COORD_SET", "TRACK")
+	require.NoError(t, err)
+	assert.Equal(t, indiclient.SwitchStateOn, track.Value)
+}
+
+func mustParse(t *testing.T, s string) float64 {
+	f, err := indiclient.ParseNumber(s)
+	require.NoError(t, err)
+	return f
+}
@@ -0,0 +1,105 @@
+package platesolve
+
+import (
+	"math"
+	"strconv"
+)
+
+// fromWCS converts the world coordinate system keywords a solver writes to a Solution for the center of the frame.
+// The CD matrix is used if present, otherwise CDELT and CROTA2. The frame size is read from IMAGEW and IMAGEH, or
+// NAXIS1 and NAXIS2; if neither is present the reference pixel is taken as the center.
+func fromWCS(keywords map[string]string) (Solution, error) {
+	value := func(names ...string) (float64, bool) {
+		for _, name := range names {
+			if s, ok := keywords[name]; ok {
+				if v, err := strconv.ParseFloat(s, 64); err == nil {
+					return v, true
+				}
+			}
+		}
+		return 0, false
+	}
+
+	ra0, okRA := value("CRVAL1")
+	dec0, okDec := value("CRVAL2")
+	if !okRA || !okDec {
+		return Solution{}, ErrNotSolved
+	}
+
+	var cd [2][2]float64
+
+	if cd11, ok := value("CD1_1"); ok {
+		cd[0][0] = cd11
+		cd[0][1], _ = value("CD1_2")
+		cd[1][0], _ = value("CD2_1")
+		cd[1][1], _ = value("CD2_2")
+	} else {
+		cdelt1, ok1 := value("CDELT1")
+		cdelt2, ok2 := value("CDELT2")
+		if !ok1 || !ok2 {
+			return Solution{}, ErrNotSolved
+		}
+
+		crota, _ := value("CROTA2")
+		s, c := math.Sincos(crota * math.Pi / 180)
+
+		cd = [2][2]float64{
+			{cdelt1 * c, -cdelt2 * s},
+			{cdelt1 * s, cdelt2 * c},
+		}
+	}
+
+	det := cd[0][0]*cd[1][1] - cd[0][1]*cd[1][0]
+	if det == 0 {
+		return Solution{}, ErrNotSolved
+	}
+
+	solution := Solution{
+		RA:         ra0,
+		Dec:        dec0,
+		PixelScale: math.Sqrt(math.Abs(det)) * 3600,
+	}
+
+	// The +Y axis points along the second column of the CD matrix, with the first axis increasing to the east.
+	solution.Rotation = math.Atan2(cd[0][1], cd[1][1]) * 180 / math.Pi
+	if solution.Rotation < 0 {
+		solution.Rotation += 360
+	}
+
+	width, okW := value("IMAGEW", "NAXIS1")
+	height, okH := value("IMAGEH", "NAXIS2")
+	crpix1, ok1 := value("CRPIX1")
+	crpix2, ok2 := value("CRPIX2")
+
+	if okW && okH && ok1 && ok2 {
+		// FITS pixel coordinates start at 1, so the center of the frame is at (n+1)/2.
+		dx, dy := (width+1)/2-crpix1, (height+1)/2-crpix2
+
+		xi := (cd[0][0]*dx + cd[0][1]*dy) * math.Pi / 180
+		eta := (cd[1][0]*dx + cd[1][1]*dy) * math.Pi / 180
+
+		solution.RA, solution.Dec = deproject(ra0, dec0, xi, eta)
+	}
+
+	solution.RA /= 15
+
+	return solution, nil
+}
+
+// deproject returns the coordinates, in degrees, of the point at standard coordinates xi and eta, in radians, of a
+// gnomonic (TAN) projection centered on ra0 and dec0, in degrees.
+func deproject(ra0, dec0, xi, eta float64) (ra, dec float64) {
+	a0, d0 := ra0*math.Pi/180, dec0*math.Pi/180
+
+	denom := math.Cos(d0) - eta*math.Sin(d0)
+
+	ra = (a0 + math.Atan2(xi, denom)) * 180 / math.Pi
+	dec = math.Atan2(math.Sin(d0)+eta*math.Cos(d0), math.Hypot(xi, denom)) * 180 / math.Pi
+
+	ra = math.Mod(ra, 360)
+	if ra < 0 {
+		ra += 360
+	}
+
+	return ra, dec
+}
@@ -0,0 +1,70 @@
+package indiclient
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNoBlobPreviewer is returned by BlobEvent.Preview when no previewer was set with SetBlobPreviewer.
+var ErrNoBlobPreviewer = errors.New("no blob previewer")
+
+// BlobPreview is a small 8 bit image of a camera frame, stretched so faint detail is visible, for web UIs and other
+// clients that cannot show FITS or raw frames themselves.
+type BlobPreview struct {
+	// ContentType is the MIME type of Data, e.g. image/jpeg or image/png.
+	ContentType string `json:"contentType"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Data        []byte `json:"data"`
+}
+
+// BlobPreviewer renders a preview of a BLOB with the given format and contents. See the imaging package for an
+// implementation that handles FITS and raw frames.
+type BlobPreviewer func(format string, data []byte) (*BlobPreview, error)
+
+// SetBlobPreviewer sets the previewer used by BlobEvent.Preview for BLOBs received from now on. A nil fn disables
+// previews.
+func (c *INDIClient) SetBlobPreviewer(fn BlobPreviewer) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.blobPreviewer = fn
+}
+
+// blobPreview renders a preview at most once for a BLOB, however many handlers ask for it.
+type blobPreview struct {
+	fn     BlobPreviewer
+	format string
+	data   []byte
+
+	once    sync.Once
+	preview *BlobPreview
+	err     error
+}
+
+// newBlobPreview returns the preview for a BLOB, or nil if there is no previewer. Reads INDIClient.blobPreviewer.
+// Only call when INDIClient.rwm is at least reader locked.
+func (c *INDIClient) newBlobPreview(format string, data []byte) *blobPreview {
+	if c.blobPreviewer == nil {
+		return nil
+	}
+
+	return &blobPreview{fn: c.blobPreviewer, format: format, data: data}
+}
+
+// Preview returns a preview of the frame, rendered by the previewer set with SetBlobPreviewer. Like Stats, it is
+// rendered the first time any handler asks for it, and shared with every other handler of the same BLOB. Returns
+// ErrNoBlobPreviewer if there was no previewer when the BLOB was received. The returned BlobPreview is shared, so do
+// not modify it.
+func (e BlobEvent) Preview() (*BlobPreview, error) {
+	p := e.preview
+	if p == nil {
+		return nil, ErrNoBlobPreviewer
+	}
+
+	p.once.Do(func() {
+		p.preview, p.err = p.fn(p.format, p.data)
+	})
+
+	return p.preview, p.err
+}
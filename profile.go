@@ -0,0 +1,237 @@
+package indiclient
+
+import (
+	"encoding/json"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+)
+
+// Profile is a saved client configuration: where to connect, which devices to watch, and how BLOBs are delivered.
+// Use INDIClient.Profile to capture the configuration of a running client, SaveProfile and LoadProfile to persist it,
+// and FromProfile and ConnectProfile to restore it.
+type Profile struct {
+	Network       string          `json:"network"`
+	Address       string          `json:"address"`
+	BufferSize    int             `json:"bufferSize"`
+	BlobRetention int             `json:"blobRetention"`
+	ParserLimits  ParserLimits    `json:"parserLimits"`
+	BlobPolicies  []BlobPolicy    `json:"blobPolicies"`
+	Watched       []WatchedDevice `json:"watched"`
+	// Aliases maps device aliases to the driver's device names. See SetDeviceAlias.
+	Aliases map[string]string `json:"aliases"`
+}
+
+// BlobPolicy is an enableBLOB setting for a device, or a single property if Property is set.
+type BlobPolicy struct {
+	Device   string     `json:"device"`
+	Property string     `json:"property"`
+	Value    BlobEnable `json:"value"`
+}
+
+// WatchedDevice is a device, or a single property if Property is set, that the client asked indiserver to send
+// definitions and updates for.
+type WatchedDevice struct {
+	Device   string `json:"device"`
+	Property string `json:"property"`
+}
+
+// LoadProfile reads a profile saved by SaveProfile from path on fs.
+func LoadProfile(fs afero.Fs, path string) (Profile, error) {
+	p := Profile{}
+
+	b, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return p, err
+	}
+
+	err = json.Unmarshal(b, &p)
+
+	return p, err
+}
+
+// SaveProfile writes p to path on fs as JSON, replacing any existing file.
+func SaveProfile(fs afero.Fs, path string, p Profile) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return afero.WriteFile(fs, path, b, 0644)
+}
+
+// FromProfile creates a client configured by p. The client is not connected; call ConnectProfile to connect to the
+// profile's address and restore its watched devices and BLOB policies.
+func FromProfile(log logging.Logger, dialer Dialer, fs afero.Fs, p Profile) *INDIClient {
+	bufferSize := p.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = 100
+	}
+
+	c := NewINDIClient(log, dialer, fs, bufferSize)
+
+	c.network = p.Network
+	c.address = p.Address
+	c.blobPolicies = append([]BlobPolicy{}, p.BlobPolicies...)
+	c.watched = append([]WatchedDevice{}, p.Watched...)
+
+	if p.BlobRetention > 0 {
+		c.blobRetention = p.BlobRetention
+	}
+
+	if p.ParserLimits != (ParserLimits{}) {
+		c.parserLimits = p.ParserLimits
+	}
+
+	for alias, deviceName := range p.Aliases {
+		if err := c.SetDeviceAlias(alias, deviceName); err != nil {
+			log.WithField("alias", alias).WithError(err).Warn("error in SetDeviceAlias")
+		}
+	}
+
+	return c
+}
+
+// Profile returns the current configuration of the client. The address is the one last passed to Connect, watched
+// devices are those passed to GetProperties, and BLOB policies are those passed to EnableBlob.
+func (c *INDIClient) Profile() Profile {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return Profile{
+		Network:       c.network,
+		Address:       c.address,
+		BufferSize:    c.bufferSize,
+		BlobRetention: c.blobRetention,
+		ParserLimits:  c.parserLimits,
+		BlobPolicies:  append([]BlobPolicy{}, c.blobPolicies...),
+		Watched:       append([]WatchedDevice{}, c.watched...),
+		Aliases:       c.DeviceAliases(),
+	}
+}
+
+// ConnectProfile connects to the address of the client's profile, then asks indiserver for the watched devices (or
+// all devices if there are none) and sends the BLOB policies. Unlike EnableBlob, the policies are sent without waiting
+// for the devices to be defined.
+func (c *INDIClient) ConnectProfile() error {
+	p := c.Profile()
+
+	if len(p.Address) == 0 {
+		return ErrInvalidAddress
+	}
+
+	err := c.ConnectWithOptions(p.Network, p.Address, ConnectOptions{Watch: p.Watched})
+	if err != nil {
+		return err
+	}
+
+	for _, b := range p.BlobPolicies {
+		c.sendCommand(EnableBlob{
+			Device: b.Device,
+			Name:   b.Property,
+			Value:  b.Value,
+		})
+	}
+
+	return nil
+}
+
+// SetBlobPolicies replaces the BLOB policies with policies, e.g. when a configuration is reloaded. If the client is
+// connected, enableBLOB is sent for each policy that changed, and Never for each device or property that no longer
+// has one. Like ConnectProfile, it does not wait for the devices to be defined.
+func (c *INDIClient) SetBlobPolicies(policies []BlobPolicy) error {
+	var next []BlobPolicy
+
+	for _, b := range policies {
+		if b.Value != BlobEnableAlso && b.Value != BlobEnableNever && b.Value != BlobEnableOnly && (b.Value != BlobEnableURL || !c.INDIGO().Enabled) {
+			return ErrInvalidBlobEnable
+		}
+
+		b.Device = c.resolveDevice(b.Device)
+		next = addBlobPolicy(next, b)
+	}
+
+	c.rwm.Lock()
+	prev := c.blobPolicies
+	c.blobPolicies = next
+	c.rwm.Unlock()
+
+	if !c.IsConnected() {
+		return nil
+	}
+
+	var cmds []EnableBlob
+
+	for _, p := range prev {
+		if !hasBlobPolicy(next, p.Device, p.Property) {
+			cmds = append(cmds, EnableBlob{Device: p.Device, Name: p.Property, Value: BlobEnableNever})
+		}
+	}
+
+	for _, b := range next {
+		if !hasBlobPolicy(prev, b.Device, b.Property) || blobPolicyFor(prev, b.Device, b.Property) != b.Value {
+			cmds = append(cmds, EnableBlob{Device: b.Device, Name: b.Property, Value: b.Value})
+		}
+	}
+
+	for _, cmd := range cmds {
+		c.sendCommand(cmd)
+	}
+
+	return nil
+}
+
+// hasBlobPolicy returns true if policies has a policy for exactly deviceName and propName.
+func hasBlobPolicy(policies []BlobPolicy, deviceName, propName string) bool {
+	for _, p := range policies {
+		if p.Device == deviceName && p.Property == propName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addBlobPolicy replaces any existing policy for the same device and property with b.
+func addBlobPolicy(policies []BlobPolicy, b BlobPolicy) []BlobPolicy {
+	for i, p := range policies {
+		if p.Device == b.Device && p.Property == b.Property {
+			policies[i] = b
+			return policies
+		}
+	}
+
+	return append(policies, b)
+}
+
+// blobPolicyFor returns the enableBLOB setting in effect for propName of deviceName: the policy for the property if
+// there is one, otherwise the policy for the whole device, otherwise BlobEnableNever, which is indiserver's default.
+func blobPolicyFor(policies []BlobPolicy, deviceName, propName string) BlobEnable {
+	value := BlobEnableNever
+
+	for _, p := range policies {
+		if p.Device != deviceName {
+			continue
+		}
+
+		if p.Property == propName {
+			return p.Value
+		}
+
+		if len(p.Property) == 0 {
+			value = p.Value
+		}
+	}
+
+	return value
+}
+
+func addWatchedDevice(watched []WatchedDevice, w WatchedDevice) []WatchedDevice {
+	for _, v := range watched {
+		if v == w {
+			return watched
+		}
+	}
+
+	return append(watched, w)
+}
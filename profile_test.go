@@ -0,0 +1,115 @@
+package indiclient_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func Test_Profile_RoundTrip(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	fs := afero.NewMemMapFs()
+	server := simulators.NewServer(simulators.NewFocuser("Focuser Simulator"), simulators.NewCCD("CCD Simulator"))
+
+	c := indiclient.NewINDIClient(log, server, fs, 100)
+	c.SetBlobRetention(3)
+
+	err := c.Connect("tcp", "localhost:7624")
+	require.NoError(t, err)
+
+	err = c.GetProperties("CCD Simulator", "")
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == 1 })
+
+	err = c.EnableBlob("CCD Simulator", "", indiclient.BlobEnableAlso)
+	require.NoError(t, err)
+
+	c.Disconnect()
+
+	p := c.Profile()
+	assert.Equal(t, "tcp", p.Network)
+	assert.Equal(t, "localhost:7624", p.Address)
+	assert.Equal(t, 3, p.BlobRetention)
+	assert.Equal(t, []indiclient.WatchedDevice{{Device: "CCD Simulator"}}, p.Watched)
+	assert.Equal(t, []indiclient.BlobPolicy{{Device: "CCD Simulator", Value: indiclient.BlobEnableAlso}}, p.BlobPolicies)
+
+	err = indiclient.SaveProfile(fs, "profile.json", p)
+	require.NoError(t, err)
+
+	loaded, err := indiclient.LoadProfile(fs, "profile.json")
+	require.NoError(t, err)
+	assert.Equal(t, p, loaded)
+
+	c = indiclient.FromProfile(log, server, fs, loaded)
+	assert.Equal(t, p, c.Profile())
+
+	err = c.ConnectProfile()
+	require.NoError(t, err)
+	defer c.Disconnect()
+
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == 1 })
+	assert.Equal(t, []string{"CCD Simulator"}, c.Devices())
+}
+
+func Test_ConnectProfile_NoAddress(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+
+	c := indiclient.FromProfile(log, indiclient.NetworkDialer{}, afero.NewMemMapFs(), indiclient.Profile{})
+
+	err := c.ConnectProfile()
+	assert.Equal(t, indiclient.ErrInvalidAddress, err)
+}
+
+func Test_SetBlobPolicies(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	c := indiclient.NewINDIClient(log, simulators.NewServer(simulators.NewCCD("CCD Simulator")), afero.NewMemMapFs(), 100)
+
+	err := c.SetBlobPolicies([]indiclient.BlobPolicy{{Device: "CCD Simulator", Value: "Sometimes"}})
+	assert.Equal(t, indiclient.ErrInvalidBlobEnable, err)
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+	require.NoError(t, c.GetProperties("", ""))
+
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == 1 })
+	require.NoError(t, c.SetSwitchValue("CCD Simulator", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn}))
+	testutil.WaitFor(t, func() bool { return c.BlobPropertySet("CCD Simulator", "CCD1") })
+
+	frames := make(chan indiclient.BlobEvent, 10)
+	_, err = c.OnBlob("CCD Simulator", "CCD1", "", func(e indiclient.BlobEvent) { frames <- e })
+	require.NoError(t, err)
+
+	policies := []indiclient.BlobPolicy{{Device: "CCD Simulator", Value: indiclient.BlobEnableAlso}}
+	require.NoError(t, c.SetBlobPolicies(policies))
+	assert.Equal(t, policies, c.Profile().BlobPolicies)
+
+	require.NoError(t, c.SetNumber("CCD Simulator", "CCD_EXPOSURE", map[string]float64{"CCD_EXPOSURE_VALUE": 0.01}))
+
+	select {
+	case <-frames:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for frame")
+	}
+
+	// Removing the policy turns BLOBs off again.
+	require.NoError(t, c.SetBlobPolicies(nil))
+	assert.Empty(t, c.Profile().BlobPolicies)
+
+	require.NoError(t, c.SetNumber("CCD Simulator", "CCD_EXPOSURE", map[string]float64{"CCD_EXPOSURE_VALUE": 0.01}))
+
+	select {
+	case <-frames:
+		t.Fatal("frame received with BLOBs turned off")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
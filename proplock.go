@@ -0,0 +1,88 @@
+package indiclient
+
+import (
+	"context"
+	"sync"
+)
+
+// PropertyHandle is the hold on a property given by AcquireProperty. Call Release once the operation is done.
+type PropertyHandle struct {
+	Device   string `json:"device"`
+	Property string `json:"property"`
+
+	c    *INDIClient
+	key  string
+	once sync.Once
+}
+
+// propertyLock serializes the holders of a property's handle. sem holds a value while the handle is held, and refs
+// counts the holder and the callers waiting for it, so the lock can be dropped once nobody uses it.
+type propertyLock struct {
+	sem  chan struct{}
+	refs int
+}
+
+// AcquireProperty waits until no other part of the application holds propName of deviceName, then returns a handle
+// that holds it until released. It returns ctx's error if ctx is done first.
+//
+// Use it around a composite operation on a vector, such as an exposure sequence setting CCD_FRAME, CCD_BINNING and
+// CCD_EXPOSURE in turn, so two goroutines sharing the client do not interleave their writes. Like leases, these locks
+// are only known to this client, and they do not stop its Set* calls: every writer of the property must acquire it.
+// Unlike AcquireLease, AcquireProperty waits for the property instead of failing.
+func (c *INDIClient) AcquireProperty(ctx context.Context, deviceName, propName string) (*PropertyHandle, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	if len(deviceName) == 0 {
+		return nil, ErrDeviceNotFound
+	}
+
+	if len(propName) == 0 {
+		return nil, ErrPropertyNotFound
+	}
+
+	key := transactionKey(deviceName, propName)
+
+	c.rwm.Lock()
+	l, ok := c.propertyLocks[key]
+	if !ok {
+		l = &propertyLock{sem: make(chan struct{}, 1)}
+		c.propertyLocks[key] = l
+	}
+	l.refs++
+	c.rwm.Unlock()
+
+	select {
+	case l.sem <- struct{}{}:
+		return &PropertyHandle{Device: c.aliasDevice(deviceName), Property: propName, c: c, key: key}, nil
+	case <-ctx.Done():
+		c.unrefPropertyLock(key)
+		return nil, ctx.Err()
+	}
+}
+
+// Release releases the property for the next caller of AcquireProperty. Releasing a handle more than once does
+// nothing.
+func (h *PropertyHandle) Release() {
+	h.once.Do(func() {
+		h.c.rwm.RLock()
+		l := h.c.propertyLocks[h.key]
+		h.c.rwm.RUnlock()
+
+		<-l.sem
+
+		h.c.unrefPropertyLock(h.key)
+	})
+}
+
+// unrefPropertyLock drops a reference to the lock key, and forgets it once it has none.
+func (c *INDIClient) unrefPropertyLock(key string) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	l := c.propertyLocks[key]
+
+	l.refs--
+	if l.refs == 0 {
+		delete(c.propertyLocks, key)
+	}
+}
@@ -0,0 +1,66 @@
+package indiclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AcquireProperty(t *testing.T) {
+	c := newTestClient()
+
+	h, err := c.AcquireProperty(context.Background(), "CCD Simulator", "CCD_EXPOSURE")
+	require.NoError(t, err)
+	assert.Equal(t, "CCD Simulator", h.Device)
+	assert.Equal(t, "CCD_EXPOSURE", h.Property)
+
+	// Other properties are not held.
+	other, err := c.AcquireProperty(context.Background(), "CCD Simulator", "CCD_FRAME")
+	require.NoError(t, err)
+	other.Release()
+
+	// A second caller waits until the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = c.AcquireProperty(ctx, "CCD Simulator", "CCD_EXPOSURE")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// ...or until the handle is released.
+	acquired := make(chan *PropertyHandle)
+	go func() {
+		h, err := c.AcquireProperty(context.Background(), "CCD Simulator", "CCD_EXPOSURE")
+		assert.NoError(t, err)
+		acquired <- h
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("property acquired while held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	h.Release()
+	h.Release()
+
+	select {
+	case next := <-acquired:
+		next.Release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("property not acquired after release")
+	}
+
+	// Locks are forgotten once nobody holds or waits for them.
+	c.rwm.RLock()
+	assert.Empty(t, c.propertyLocks)
+	c.rwm.RUnlock()
+
+	_, err = c.AcquireProperty(context.Background(), "", "CCD_EXPOSURE")
+	assert.Equal(t, ErrDeviceNotFound, err)
+
+	_, err = c.AcquireProperty(context.Background(), "CCD Simulator", "")
+	assert.Equal(t, ErrPropertyNotFound, err)
+}
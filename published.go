@@ -0,0 +1,204 @@
+package indiclient
+
+// The Get* accessors are called often, e.g. by user interfaces polling every property, while the goroutine handling
+// messages holds INDIClient.rwm for every update it applies. So that they never wait for each other, the accessors read
+// an immutable copy of INDIClient.devices instead: every change is published by copying what changed and swapping in
+// a new map holding it, which readers load atomically. Devices that did not change are shared between successive
+// maps, as are the properties of a device that did not change when one of its properties is updated, and nothing in a
+// published map is ever modified.
+
+// publishedDevices returns the devices as of the last change, keyed by their driver's names. The map and the devices
+// in it are shared, and must not be modified; copy what is returned to callers. It does not need INDIClient.rwm.
+func (c *INDIClient) publishedDevices() map[string]Device {
+	return c.published.Load().(map[string]Device)
+}
+
+// findPublishedDevice is findDevice for the published devices. It does not need INDIClient.rwm.
+func (c *INDIClient) findPublishedDevice(name string) (Device, error) {
+	if d, ok := c.publishedDevices()[name]; ok {
+		return d, nil
+	}
+
+	return Device{}, ErrDeviceNotFound
+}
+
+// publishDevice publishes the current state of deviceName in INDIClient.devices, or its removal. Call it after every
+// change to a device that is not made with putDevice, putProperty or removeDevice, or publishProperty if only one
+// property changed. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) publishDevice(deviceName string) {
+	device, ok := c.devices[deviceName]
+	if ok {
+		device = device.Copy()
+	}
+
+	c.publish(deviceName, device, ok)
+}
+
+// publishProperty publishes the current state of propName on deviceName, or its deletion, along with the device's
+// messages and property order. Its other properties are not copied but shared with the device last published; only
+// the map holding propName is rebuilt. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) publishProperty(deviceName, propName string) {
+	prev, ok := c.publishedDevices()[deviceName]
+	device, live := c.devices[deviceName]
+
+	if !ok || !live {
+		c.publishDevice(deviceName)
+		return
+	}
+
+	next := prev
+	next.Name = device.Name
+	next.TextProperties = publishTextProperty(prev.TextProperties, device.TextProperties, propName)
+	next.SwitchProperties = publishSwitchProperty(prev.SwitchProperties, device.SwitchProperties, propName)
+	next.NumberProperties = publishNumberProperty(prev.NumberProperties, device.NumberProperties, propName)
+	next.LightProperties = publishLightProperty(prev.LightProperties, device.LightProperties, propName)
+	next.BlobProperties = publishBlobProperty(prev.BlobProperties, device.BlobProperties, propName)
+	next.Messages = append([]MessageJSON(nil), device.Messages...)
+	next.PropertyOrder = append([]string(nil), device.PropertyOrder...)
+
+	c.publish(deviceName, next, true)
+}
+
+// publish swaps in a new map of published devices holding device as deviceName, or without deviceName if ok is false.
+// device must not be modified afterwards. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) publish(deviceName string, device Device, ok bool) {
+	prev := c.publishedDevices()
+
+	next := make(map[string]Device, len(c.devices))
+	for name, d := range prev {
+		if name != deviceName {
+			next[name] = d
+		}
+	}
+
+	if ok {
+		next[deviceName] = device
+	}
+
+	c.published.Store(next)
+}
+
+// The publish*Property functions return the properties of a kind for a published device: published, the properties
+// last published, with propName copied from live, or removed if it is no longer in live. published itself is returned
+// if propName is in neither, since nothing in it changed.
+
+func publishTextProperty(published, live map[string]TextProperty, propName string) map[string]TextProperty {
+	p, ok := live[propName]
+	if _, was := published[propName]; !ok && !was {
+		return published
+	}
+
+	next := make(map[string]TextProperty, len(live))
+	for name, prop := range published {
+		if name != propName {
+			next[name] = prop
+		}
+	}
+
+	if ok {
+		next[propName] = p.Copy()
+	}
+
+	return next
+}
+
+func publishSwitchProperty(published, live map[string]SwitchProperty, propName string) map[string]SwitchProperty {
+	p, ok := live[propName]
+	if _, was := published[propName]; !ok && !was {
+		return published
+	}
+
+	next := make(map[string]SwitchProperty, len(live))
+	for name, prop := range published {
+		if name != propName {
+			next[name] = prop
+		}
+	}
+
+	if ok {
+		next[propName] = p.Copy()
+	}
+
+	return next
+}
+
+func publishNumberProperty(published, live map[string]NumberProperty, propName string) map[string]NumberProperty {
+	p, ok := live[propName]
+	if _, was := published[propName]; !ok && !was {
+		return published
+	}
+
+	next := make(map[string]NumberProperty, len(live))
+	for name, prop := range published {
+		if name != propName {
+			next[name] = prop
+		}
+	}
+
+	if ok {
+		next[propName] = p.Copy()
+	}
+
+	return next
+}
+
+func publishLightProperty(published, live map[string]LightProperty, propName string) map[string]LightProperty {
+	p, ok := live[propName]
+	if _, was := published[propName]; !ok && !was {
+		return published
+	}
+
+	next := make(map[string]LightProperty, len(live))
+	for name, prop := range published {
+		if name != propName {
+			next[name] = prop
+		}
+	}
+
+	if ok {
+		next[propName] = p.Copy()
+	}
+
+	return next
+}
+
+func publishBlobProperty(published, live map[string]BlobProperty, propName string) map[string]BlobProperty {
+	p, ok := live[propName]
+	if _, was := published[propName]; !ok && !was {
+		return published
+	}
+
+	next := make(map[string]BlobProperty, len(live))
+	for name, prop := range published {
+		if name != propName {
+			next[name] = prop
+		}
+	}
+
+	if ok {
+		next[propName] = p.Copy()
+	}
+
+	return next
+}
+
+// putDevice stores device as deviceName, and publishes it. Modifies INDIClient.devices. Only call when
+// INDIClient.rwm is locked.
+func (c *INDIClient) putDevice(deviceName string, device Device) {
+	c.devices[deviceName] = device
+	c.publishDevice(deviceName)
+}
+
+// putProperty stores device as deviceName, and publishes propName, the only property changed on it. Modifies
+// INDIClient.devices. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) putProperty(deviceName string, device Device, propName string) {
+	c.devices[deviceName] = device
+	c.publishProperty(deviceName, propName)
+}
+
+// removeDevice removes deviceName, and publishes its removal. Modifies INDIClient.devices. Only call when
+// INDIClient.rwm is locked.
+func (c *INDIClient) removeDevice(deviceName string) {
+	delete(c.devices, deviceName)
+	c.publishDevice(deviceName)
+}
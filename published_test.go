@@ -0,0 +1,189 @@
+package indiclient
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PublishedDevices_ReadWithoutLock(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+	setCoords(c, "5")
+
+	// The message handler holds the lock while it applies an update.
+	c.rwm.Lock()
+
+	done := make(chan NumberValue)
+	go func() {
+		val, _ := c.GetNumber("Mount", "EQUATORIAL_EOD_COORD", "RA")
+		done <- val
+	}()
+
+	select {
+	case val := <-done:
+		assert.Equal(t, "5", val.Value)
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetNumber waited for the lock")
+	}
+
+	c.rwm.Unlock()
+
+	assert.Equal(t, []string{"Mount"}, c.Devices())
+	assert.True(t, c.NumberPropertySet("Mount", "EQUATORIAL_EOD_COORD"))
+}
+
+func Test_PublishedDevices_Immutable(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+
+	before, err := c.GetDevice("Mount")
+	require.NoError(t, err)
+
+	published := c.publishedDevices()
+
+	setCoords(c, "5")
+
+	// A published map is never modified; updates publish a new one.
+	assert.Equal(t, "0", published["Mount"].NumberProperties["EQUATORIAL_EOD_COORD"].Values["RA"].Value)
+	assert.Equal(t, "0", before.NumberProperties["EQUATORIAL_EOD_COORD"].Values["RA"].Value)
+
+	prop, err := c.GetNumberProperty("Mount", "EQUATORIAL_EOD_COORD")
+	require.NoError(t, err)
+	assert.Equal(t, "5", prop.Values["RA"].Value)
+
+	// Callers get copies, which they may modify.
+	prop.Values["RA"] = NumberValue{Name: "RA", Value: "10"}
+
+	val, err := c.GetNumber("Mount", "EQUATORIAL_EOD_COORD", "RA")
+	require.NoError(t, err)
+	assert.Equal(t, "5", val.Value)
+
+	c.delProperty(&DelProperty{Device: "Mount"})
+
+	_, err = c.GetDevice("Mount")
+	assert.Equal(t, ErrDeviceNotFound, err)
+	assert.Empty(t, c.Devices())
+}
+
+func Test_PublishedDevices_SharesUnchangedProperties(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+	c.defTextVector(&DefTextVector{
+		Device: "Mount",
+		Name:   "DRIVER_INFO",
+		State:  PropertyStateIdle,
+		Perm:   PropertyPermissionReadOnly,
+		Texts:  []DefText{{Name: "DRIVER_NAME", Value: "Mount"}},
+	})
+
+	before := c.publishedDevices()["Mount"]
+
+	setCoords(c, "5")
+
+	after := c.publishedDevices()["Mount"]
+
+	// Only the updated property is copied.
+	assert.Equal(t, reflect.ValueOf(before.TextProperties).Pointer(), reflect.ValueOf(after.TextProperties).Pointer())
+	assert.NotEqual(t, reflect.ValueOf(before.NumberProperties).Pointer(), reflect.ValueOf(after.NumberProperties).Pointer())
+	assert.Equal(t, "0", before.NumberProperties["EQUATORIAL_EOD_COORD"].Values["RA"].Value)
+	assert.Equal(t, "5", after.NumberProperties["EQUATORIAL_EOD_COORD"].Values["RA"].Value)
+	assert.Equal(t, []string{"EQUATORIAL_EOD_COORD", "DRIVER_INFO"}, after.PropertyOrder)
+
+	c.delProperty(&DelProperty{Device: "Mount", Name: "DRIVER_INFO"})
+
+	assert.False(t, c.TextPropertySet("Mount", "DRIVER_INFO"))
+	assert.Contains(t, before.TextProperties, "DRIVER_INFO")
+	assert.Equal(t, []string{"EQUATORIAL_EOD_COORD"}, c.publishedDevices()["Mount"].PropertyOrder)
+}
+
+func Test_PublishedDevices_Concurrent(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				prop, err := c.GetNumberProperty("Mount", "EQUATORIAL_EOD_COORD")
+				if assert.NoError(t, err) {
+					assert.Len(t, prop.Values, 2)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 1000; i++ {
+		c.rwm.Lock()
+		setCoords(c, "5")
+		c.rwm.Unlock()
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+func BenchmarkGetNumber_WhileUpdating(b *testing.B) {
+	c := newTestClient()
+	defineCoords(c)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			c.rwm.Lock()
+			setCoords(c, "5")
+			c.rwm.Unlock()
+		}
+	}()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c.GetNumber("Mount", "EQUATORIAL_EOD_COORD", "RA")
+	}
+}
+
+func BenchmarkSetNumberVector_ManyProperties(b *testing.B) {
+	c := newTestClient()
+	defineCoords(c)
+
+	for i := 0; i < 200; i++ {
+		c.defNumberVector(&DefNumberVector{
+			Device:  "Mount",
+			Name:    fmt.Sprintf("PROPERTY_%d", i),
+			State:   PropertyStateIdle,
+			Perm:    PropertyPermissionReadOnly,
+			Numbers: []DefNumber{{Name: "VALUE", Value: "0"}},
+		})
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		setCoords(c, "5")
+	}
+}
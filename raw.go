@@ -0,0 +1,58 @@
+package indiclient
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RawMessage is an element received from indiserver, with the message it was parsed into. See OnRawMessage.
+type RawMessage struct {
+	// XML is the element exactly as indiserver sent it, without the whitespace around it. For a message that could
+	// not be parsed, it is what was read before the error was found.
+	XML []byte
+	// Message is what XML was parsed into: one of the pointer types the parser produces, such as *DefNumberVector, or
+	// a *ParseError. Like messages passed to interceptors, it may be reused once the handler returns.
+	Message   interface{}
+	Timestamp time.Time
+}
+
+// OnRawMessage calls fn with every element received from indiserver, for tools such as protocol analyzers, or tests
+// that record a session to compare with later, without a second connection. fn is called on the client's read
+// goroutine, before the message reaches the inbound interceptors and the device tree, so it must return quickly.
+// Keeping the raw XML has a cost, so it is only done while there are handlers; it starts with the next message.
+func (c *INDIClient) OnRawMessage(fn func(RawMessage)) string {
+	id := uuid.New().String()
+
+	c.rawHandlers.Store(id, fn)
+	atomic.AddInt32(&c.rawCount, 1)
+
+	return id
+}
+
+// RemoveRawHandler stops calling the function registered with OnRawMessage.
+func (c *INDIClient) RemoveRawHandler(id string) error {
+	if _, ok := c.rawHandlers.Load(id); !ok {
+		return ErrSubscriptionNotFound
+	}
+
+	c.rawHandlers.Delete(id)
+	atomic.AddInt32(&c.rawCount, -1)
+
+	return nil
+}
+
+// notifyRaw calls the handlers registered with OnRawMessage, if the raw XML of msg was kept.
+func (c *INDIClient) notifyRaw(xml []byte, msg interface{}) {
+	if xml == nil {
+		return
+	}
+
+	m := RawMessage{XML: xml, Message: msg, Timestamp: c.now()}
+
+	c.rawHandlers.Range(func(key, value interface{}) bool {
+		value.(func(RawMessage))(m)
+		return true
+	})
+}
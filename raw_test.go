@@ -0,0 +1,69 @@
+package indiclient
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Parser_Raw(t *testing.T) {
+	messages := []string{
+		`<setNumberVector device="Mount" name="EQUATORIAL_EOD_COORD" state="Ok"><oneNumber name="RA">1</oneNumber></setNumberVector>`,
+		`<message device="Mount" message="[INFO] Slewing"/>`,
+		`<defTextVector device="Mount" name="INFO"><defText name="NAME">Mount &amp; Co</defText></defTextVector>`,
+		`<setSwitchVector device="Mount" name="CONNECTION" state="Ok"><oneSwitch name="CONNECT">On</oneSwitch></setSwitchVector>`,
+		`<setNumberVector device="Mount" name="BROKEN"><oneNumber name="RA">1</oneNumber></setTextVector>`,
+		`<delProperty device="Mount" name="INFO"/>`,
+	}
+
+	capture := int32(1)
+
+	p := newParser(strings.NewReader(strings.Join(messages, "\n  ")), DefaultParserLimits, ParseModeStrict)
+	p.capture = &capture
+
+	for _, expected := range messages {
+		_, err := p.next()
+		if strings.Contains(expected, "BROKEN") {
+			require.Error(t, err)
+			assert.Equal(t, `<setNumberVector device="Mount" name="BROKEN"><oneNumber name="RA">1</oneNumber></setTextVector>`, string(p.raw))
+			continue
+		}
+
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(p.raw))
+	}
+
+	// Nothing is kept without handlers.
+	capture = 0
+
+	p = newParser(strings.NewReader(strings.Join(messages[:3], "")), DefaultParserLimits, ParseModeLenient)
+	p.capture = &capture
+
+	for range messages[:3] {
+		_, err := p.next()
+		require.NoError(t, err)
+		assert.Nil(t, p.raw)
+	}
+}
+
+func Test_OnRawMessage(t *testing.T) {
+	c := newTestClient()
+
+	received := []RawMessage{}
+	id := c.OnRawMessage(func(m RawMessage) { received = append(received, m) })
+	assert.Equal(t, int32(1), c.rawCount)
+
+	msg := &Message{Device: "Mount", Message: "hello"}
+	c.notifyRaw([]byte(`<message device="Mount" message="hello"/>`), msg)
+	c.notifyRaw(nil, msg)
+
+	require.Len(t, received, 1)
+	assert.Equal(t, `<message device="Mount" message="hello"/>`, string(received[0].XML))
+	assert.Equal(t, msg, received[0].Message)
+
+	require.NoError(t, c.RemoveRawHandler(id))
+	assert.Equal(t, ErrSubscriptionNotFound, c.RemoveRawHandler(id))
+	assert.Equal(t, int32(0), c.rawCount)
+}
@@ -0,0 +1,72 @@
+package indiclient
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// propertySchema is the part of a property's definition that does not change with its values.
+type propertySchema struct {
+	Label    string
+	Group    string
+	Perm     PropertyPermission
+	Rule     SwitchRule
+	Elements []string
+}
+
+// schemaOf returns the schema of prop, one of the *Property types.
+func schemaOf(prop interface{}) propertySchema {
+	switch p := prop.(type) {
+	case TextProperty:
+		s := propertySchema{Label: p.Label, Group: p.Group, Perm: p.Permissions}
+		for _, name := range p.Order {
+			s.Elements = append(s.Elements, fmt.Sprintf("%s|%s", name, p.Values[name].Label))
+		}
+		return s
+	case NumberProperty:
+		s := propertySchema{Label: p.Label, Group: p.Group, Perm: p.Permissions}
+		for _, name := range p.Order {
+			v := p.Values[name]
+			s.Elements = append(s.Elements, fmt.Sprintf("%s|%s|%s|%s|%s|%s", name, v.Label, v.Format, v.Min, v.Max, v.Step))
+		}
+		return s
+	case SwitchProperty:
+		s := propertySchema{Label: p.Label, Group: p.Group, Perm: p.Permissions, Rule: p.Rule}
+		for _, name := range p.Order {
+			s.Elements = append(s.Elements, fmt.Sprintf("%s|%s", name, p.Values[name].Label))
+		}
+		return s
+	case LightProperty:
+		s := propertySchema{Label: p.Label, Group: p.Group}
+		for _, name := range p.Order {
+			s.Elements = append(s.Elements, fmt.Sprintf("%s|%s", name, p.Values[name].Label))
+		}
+		return s
+	case BlobProperty:
+		s := propertySchema{Label: p.Label, Group: p.Group, Perm: p.Permissions}
+		for _, name := range p.Order {
+			s.Elements = append(s.Elements, fmt.Sprintf("%s|%s", name, p.Values[name].Label))
+		}
+		return s
+	default:
+		return propertySchema{}
+	}
+}
+
+// redefined handles a driver defining deviceName.propName again. Definitions sent in answer to getProperties repeat
+// the schema, and are ignored. If the schema changed, a command waiting for the property fails with
+// ErrPropertyRedefined, since it may name elements that no longer exist, and EventTypeSchemaChange is sent. Only call
+// when INDIClient.rwm is locked.
+func (c *INDIClient) redefined(deviceName, propName string, old, new propertySchema) {
+	if reflect.DeepEqual(old, new) {
+		return
+	}
+
+	c.abortTransactions(deviceName, propName, ErrPropertyRedefined)
+
+	c.emit(Event{
+		Type:     EventTypeSchemaChange,
+		Device:   deviceName,
+		Property: propName,
+	})
+}
@@ -0,0 +1,128 @@
+package indiclient
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Redefine_KeepsMessages(t *testing.T) {
+	c := newTestClient()
+
+	defineCoords(c)
+	c.setNumberVector(&SetNumberVector{Device: "Mount", Name: "EQUATORIAL_EOD_COORD", State: PropertyStateOk, Message: "slewed"})
+
+	c.defNumberVector(&DefNumberVector{
+		Device:  "Mount",
+		Name:    "EQUATORIAL_EOD_COORD",
+		State:   PropertyStateIdle,
+		Perm:    PropertyPermissionReadWrite,
+		Message: "connected",
+		Numbers: []DefNumber{{Name: "RA", Value: "5"}, {Name: "DEC", Value: "10"}},
+	})
+
+	prop, err := c.GetNumber("Mount", "EQUATORIAL_EOD_COORD", "RA")
+	require.NoError(t, err)
+	assert.Equal(t, "5", prop.Value)
+
+	device, err := c.GetDevice("Mount")
+	require.NoError(t, err)
+
+	messages := device.NumberProperties["EQUATORIAL_EOD_COORD"].Messages
+	require.Len(t, messages, 2)
+	assert.Equal(t, "slewed", messages[0].Message)
+	assert.Equal(t, "connected", messages[1].Message)
+}
+
+func Test_Redefine_SchemaChange(t *testing.T) {
+	c := newTestClient()
+
+	ch, _, err := c.Subscribe(SubscribeOptions{Device: "Mount"})
+	require.NoError(t, err)
+
+	defineCoords(c)
+	defineCoords(c)
+
+	events := drain(ch, 50*time.Millisecond)
+	require.Len(t, events, 2)
+	assert.Equal(t, EventTypeDefine, events[1].Type)
+
+	c.defNumberVector(&DefNumberVector{
+		Device:  "Mount",
+		Name:    "EQUATORIAL_EOD_COORD",
+		State:   PropertyStateIdle,
+		Perm:    PropertyPermissionReadWrite,
+		Numbers: []DefNumber{{Name: "RA", Value: "0", Max: "24"}, {Name: "DEC", Value: "0"}},
+	})
+
+	events = drain(ch, 50*time.Millisecond)
+	require.Len(t, events, 2)
+	assert.Equal(t, EventTypeDefine, events[0].Type)
+	assert.Equal(t, EventTypeSchemaChange, events[1].Type)
+	assert.Equal(t, "EQUATORIAL_EOD_COORD", events[1].Property)
+}
+
+func Test_Redefine_KeepsBlobs(t *testing.T) {
+	c := newTestClient()
+
+	defineBlob(c)
+	sendBlob(c, "frame")
+	defineBlob(c)
+
+	device, err := c.GetDevice("Camera")
+	require.NoError(t, err)
+
+	v := device.BlobProperties["CCD1"].Values["CCD1"]
+	assert.Equal(t, int64(5), v.Size)
+	assert.Equal(t, uint64(1), v.Sequence)
+}
+
+func Test_Redefine_WakesWaiter(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+
+	c.rwm.Lock()
+	defineCoords(c)
+	c.rwm.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"5"})
+	}()
+
+	<-c.write
+
+	// The same definition again, as in answer to getProperties, does not stop the command.
+	c.rwm.Lock()
+	defineCoords(c)
+	c.rwm.Unlock()
+
+	select {
+	case err := <-done:
+		t.Fatalf("SetNumberValue returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.rwm.Lock()
+	c.defNumberVector(&DefNumberVector{
+		Device:  "Mount",
+		Name:    "EQUATORIAL_EOD_COORD",
+		State:   PropertyStateIdle,
+		Perm:    PropertyPermissionReadWrite,
+		Numbers: []DefNumber{{Name: "RA_HOURS", Value: "0"}, {Name: "DEC", Value: "0"}},
+	})
+	c.rwm.Unlock()
+
+	select {
+	case err := <-done:
+		var setErr *SetError
+		require.True(t, errors.As(err, &setErr))
+		assert.True(t, errors.Is(err, ErrPropertyRedefined))
+		assert.True(t, setErr.Sent)
+	case <-time.After(time.Second):
+		t.Fatal("SetNumberValue was not woken")
+	}
+}
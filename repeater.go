@@ -0,0 +1,549 @@
+package indiclient
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Repeater serves the devices cached by an INDIClient to downstream INDI clients, so that many local clients can share
+// a single connection to a remote indiserver. Downstream clients receive def*Vectors from the cache in answer to
+// getProperties, and set*Vectors, delProperty and message elements as the upstream state changes. Their new*Vector
+// commands are forwarded upstream unchanged.
+//
+// The repeater only knows about what the client has cached, so call GetProperties on the client before serving, and
+// EnableBlob for any BLOBs downstream clients should receive.
+type Repeater struct {
+	c      *INDIClient
+	id     string
+	blobID string
+
+	mu        sync.Mutex
+	conns     map[*repeaterConn]bool
+	listeners []net.Listener
+	closed    bool
+}
+
+// NewRepeater creates a Repeater serving the devices of c. Remember to call Close when you are done.
+func NewRepeater(c *INDIClient) (*Repeater, error) {
+	r := &Repeater{
+		c:     c,
+		id:    uuid.New().String(),
+		conns: map[*repeaterConn]bool{},
+	}
+
+	blobID, err := c.OnBlob("", "", "", r.blob)
+	if err != nil {
+		return nil, err
+	}
+
+	r.blobID = blobID
+
+	c.repeaters.Store(r.id, r)
+
+	return r, nil
+}
+
+// Serve accepts downstream connections on l until l is closed or the repeater is closed.
+func (r *Repeater) Serve(l net.Listener) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrRepeaterClosed
+	}
+	r.listeners = append(r.listeners, l)
+	r.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			r.mu.Lock()
+			closed := r.closed
+			r.mu.Unlock()
+
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		r.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a single downstream connection. It returns immediately; conn is closed when the downstream client
+// disconnects or the repeater is closed.
+func (r *Repeater) ServeConn(conn io.ReadWriteCloser) {
+	rc := &repeaterConn{
+		r:     r,
+		rw:    conn,
+		blobs: map[string]BlobEnable{},
+	}
+	rc.cond = sync.NewCond(&rc.mu)
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		conn.Close()
+		return
+	}
+	r.conns[rc] = true
+	r.mu.Unlock()
+
+	go rc.readLoop()
+	go rc.writeLoop()
+}
+
+// Close stops the repeater, closing all listeners passed to Serve and all downstream connections.
+func (r *Repeater) Close() error {
+	r.c.repeaters.Delete(r.id)
+	r.c.RemoveBlobHandler(r.blobID)
+
+	r.mu.Lock()
+	r.closed = true
+	listeners := r.listeners
+	conns := r.conns
+	r.listeners = nil
+	r.conns = map[*repeaterConn]bool{}
+	r.mu.Unlock()
+
+	for _, l := range listeners {
+		l.Close()
+	}
+
+	for rc := range conns {
+		rc.close()
+	}
+
+	return nil
+}
+
+func (r *Repeater) remove(rc *repeaterConn) {
+	r.mu.Lock()
+	delete(r.conns, rc)
+	r.mu.Unlock()
+}
+
+func (r *Repeater) send(device, prop string, item interface{}, isBlob bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for rc := range r.conns {
+		rc.send(device, prop, item, isBlob)
+	}
+}
+
+// notify is called by INDIClient.emit for every event. Only call when INDIClient.rwm is locked.
+func (r *Repeater) notify(e Event) {
+	switch e.Type {
+	case EventTypeDefine:
+		device, ok := r.c.devices[e.Device]
+		if !ok {
+			return
+		}
+
+		if item := defVector(device, e.Property); item != nil {
+			r.send(e.Device, e.Property, item, false)
+		}
+	case EventTypeUpdate:
+		device, ok := r.c.devices[e.Device]
+		if !ok {
+			return
+		}
+
+		// BLOBs are sent with their contents by blob.
+		if item := setVector(device, e.Property, e.Message); item != nil {
+			r.send(e.Device, e.Property, item, false)
+		}
+	case EventTypeDelete:
+		r.send(e.Device, e.Property, &DelProperty{
+			Device:    e.Device,
+			Name:      e.Property,
+			Timestamp: formatTimestamp(e.Timestamp),
+			Message:   e.Message,
+		}, false)
+	case EventTypeMessage:
+		r.send(e.Device, "", &Message{
+			Device:    e.Device,
+			Timestamp: formatTimestamp(e.Timestamp),
+			Message:   e.Message,
+		}, false)
+	}
+}
+
+// blob forwards a BLOB received upstream to the downstream clients that enabled it.
+func (r *Repeater) blob(e BlobEvent) {
+	// BLOB events use aliases, but downstream clients expect the driver's device names.
+	e.Device = r.c.resolveDevice(e.Device)
+
+	b, err := ioutil.ReadAll(e.Open())
+	if err != nil {
+		return
+	}
+
+	state := PropertyStateOk
+	if prop, err := r.c.GetBlobProperty(e.Device, e.Property); err == nil {
+		state = prop.State
+	}
+
+	r.send(e.Device, e.Property, &SetBlobVector{
+		Device:    e.Device,
+		Name:      e.Property,
+		State:     state,
+		Timestamp: formatTimestamp(e.Timestamp),
+		Blobs: []OneBlob{
+			{
+				Name:   e.Name,
+				Size:   int(e.Size),
+				Format: e.Format,
+				Value:  base64.StdEncoding.EncodeToString(b),
+			},
+		},
+	}, true)
+}
+
+// maxRepeaterQueue is the number of elements that can be waiting for a downstream client before it is disconnected.
+const maxRepeaterQueue = 10000
+
+// repeaterConn is a single downstream connection. Outgoing elements are queued so that the client never blocks on a
+// slow downstream client.
+type repeaterConn struct {
+	r  *Repeater
+	rw io.ReadWriteCloser
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []interface{}
+	closed  bool
+	watched []GetProperties
+	blobs   map[string]BlobEnable
+}
+
+// watches returns true if the downstream client asked for the properties of device with getProperties.
+// Only call when repeaterConn.mu is locked.
+func (rc *repeaterConn) watches(device, prop string) bool {
+	for _, w := range rc.watched {
+		if len(w.Device) > 0 && len(device) > 0 && w.Device != device {
+			continue
+		}
+
+		if len(w.Name) > 0 && len(prop) > 0 && w.Name != prop {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func (rc *repeaterConn) send(device, prop string, item interface{}, isBlob bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.closed || !rc.watches(device, prop) {
+		return
+	}
+
+	mode, ok := rc.blobs[blobStreamKey(device, prop, "")]
+	if !ok {
+		mode = rc.blobs[blobStreamKey(device, "", "")]
+	}
+
+	if isBlob && mode != BlobEnableAlso && mode != BlobEnableOnly {
+		return
+	}
+
+	if !isBlob && mode == BlobEnableOnly {
+		return
+	}
+
+	if len(rc.queue) >= maxRepeaterQueue {
+		// The downstream client has stopped reading. Disconnect it, as indiserver does, rather than queue without
+		// limit. close takes the locks held by our callers, so it has to run on its own goroutine.
+		rc.r.c.log.WithField("queued", len(rc.queue)).Warn("downstream client is not reading, disconnecting it")
+
+		rc.closed = true
+		rc.queue = nil
+		rc.cond.Signal()
+
+		go rc.close()
+
+		return
+	}
+
+	rc.queue = append(rc.queue, item)
+	rc.cond.Signal()
+}
+
+func (rc *repeaterConn) close() {
+	rc.mu.Lock()
+	rc.closed = true
+	rc.cond.Signal()
+	rc.mu.Unlock()
+
+	rc.r.remove(rc)
+	rc.rw.Close()
+}
+
+func (rc *repeaterConn) writeLoop() {
+	for {
+		rc.mu.Lock()
+		for len(rc.queue) == 0 && !rc.closed {
+			rc.cond.Wait()
+		}
+
+		if rc.closed {
+			rc.mu.Unlock()
+			return
+		}
+
+		item := rc.queue[0]
+		rc.queue = rc.queue[1:]
+		rc.mu.Unlock()
+
+		b, err := xml.Marshal(item)
+		if err != nil {
+			rc.r.c.log.WithError(err).Error("error in xml.Marshal")
+			continue
+		}
+
+		if _, err := rc.rw.Write(b); err != nil {
+			rc.close()
+			return
+		}
+	}
+}
+
+func (rc *repeaterConn) readLoop() {
+	defer rc.close()
+
+	decoder := xml.NewDecoder(rc.rw)
+
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			return
+		}
+
+		se, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		var cmd interface{}
+
+		switch se.Name.Local {
+		case "getProperties":
+			cmd = &GetProperties{}
+		case "enableBLOB":
+			cmd = &EnableBlob{}
+		case "newTextVector":
+			cmd = &NewTextVector{}
+		case "newNumberVector":
+			cmd = &NewNumberVector{}
+		case "newSwitchVector":
+			cmd = &NewSwitchVector{}
+		case "newBLOBVector":
+			cmd = &NewBlobVector{}
+		default:
+			decoder.Skip()
+			continue
+		}
+
+		if err := decoder.DecodeElement(cmd, &se); err != nil {
+			rc.r.c.log.WithField("element", se.Name.Local).WithError(err).Warn("error decoding downstream command")
+			continue
+		}
+
+		rc.dispatch(cmd)
+	}
+}
+
+func (rc *repeaterConn) dispatch(cmd interface{}) {
+	switch item := cmd.(type) {
+	case *GetProperties:
+		rc.getProperties(item)
+	case *EnableBlob:
+		rc.enableBlob(item)
+	case *NewTextVector:
+		rc.forward(item.Device, item.Name, *item)
+	case *NewNumberVector:
+		rc.forward(item.Device, item.Name, *item)
+	case *NewSwitchVector:
+		rc.forward(item.Device, item.Name, *item)
+	case *NewBlobVector:
+		rc.forward(item.Device, item.Name, *item)
+	}
+}
+
+// getProperties starts sending updates for the requested properties, and answers with their definitions from the
+// cache.
+func (rc *repeaterConn) getProperties(item *GetProperties) {
+	c := rc.r.c
+
+	// Hold rwm so no update is sent before the definitions.
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	rc.mu.Lock()
+	rc.watched = append(rc.watched, GetProperties{Device: item.Device, Name: item.Name})
+	rc.mu.Unlock()
+
+	for name, device := range c.devices {
+		if len(item.Device) > 0 && item.Device != name {
+			continue
+		}
+
+		for _, propName := range device.PropertyOrder {
+			if len(item.Name) > 0 && item.Name != propName {
+				continue
+			}
+
+			if def := defVector(device, propName); def != nil {
+				rc.send(name, propName, def, false)
+			}
+		}
+	}
+}
+
+// enableBlob records which BLOBs the downstream client wants, and enables them upstream if needed.
+func (rc *repeaterConn) enableBlob(item *EnableBlob) {
+	val := BlobEnable(strings.TrimSpace(string(item.Value)))
+
+	rc.mu.Lock()
+	rc.blobs[blobStreamKey(item.Device, item.Name, "")] = val
+	rc.mu.Unlock()
+
+	if val == BlobEnableNever || !rc.r.c.IsConnected() {
+		return
+	}
+
+	// Other downstream clients may still want BLOBs, so never disable them upstream.
+	if err := rc.r.c.EnableBlob(item.Device, item.Name, BlobEnableAlso); err != nil {
+		rc.r.c.log.WithField("device", item.Device).WithError(err).Warn("error enabling BLOBs upstream")
+	}
+}
+
+// forward sends a new*Vector command for propName on deviceName upstream, if the access policy allows it.
+func (rc *repeaterConn) forward(deviceName, propName string, cmd interface{}) {
+	c := rc.r.c
+
+	if !c.IsConnected() || c.DryRun() {
+		return
+	}
+
+	c.rwm.RLock()
+	err := c.checkAccess(c.resolveDevice(deviceName), propName)
+	c.rwm.RUnlock()
+
+	if err != nil {
+		c.log.WithField("device", deviceName).WithField("property", propName).WithError(err).Warn("dropping downstream command")
+		return
+	}
+
+	c.sendCommand(cmd)
+}
+
+// defVector builds the def*Vector for propName on device, or returns nil if there is no such property.
+func defVector(device Device, propName string) interface{} {
+	if p, ok := device.TextProperties[propName]; ok {
+		def := &DefTextVector{Device: device.Name, Name: p.Name, Label: p.Label, Group: p.Group, State: p.State, Perm: p.Permissions, Timeout: p.Timeout, Timestamp: formatTimestamp(p.LastUpdated)}
+		for _, name := range p.Order {
+			v := p.Values[name]
+			def.Texts = append(def.Texts, DefText{Name: v.Name, Label: v.Label, Value: v.Value})
+		}
+		return def
+	}
+
+	if p, ok := device.NumberProperties[propName]; ok {
+		def := &DefNumberVector{Device: device.Name, Name: p.Name, Label: p.Label, Group: p.Group, State: p.State, Perm: p.Permissions, Timeout: p.Timeout, Timestamp: formatTimestamp(p.LastUpdated)}
+		for _, name := range p.Order {
+			v := p.Values[name]
+			def.Numbers = append(def.Numbers, DefNumber{Name: v.Name, Label: v.Label, Format: v.Format, Min: v.Min, Max: v.Max, Step: v.Step, Value: v.Value})
+		}
+		return def
+	}
+
+	if p, ok := device.SwitchProperties[propName]; ok {
+		def := &DefSwitchVector{Device: device.Name, Name: p.Name, Label: p.Label, Group: p.Group, State: p.State, Perm: p.Permissions, Rule: p.Rule, Timeout: p.Timeout, Timestamp: formatTimestamp(p.LastUpdated)}
+		for _, name := range p.Order {
+			v := p.Values[name]
+			def.Switches = append(def.Switches, DefSwitch{Name: v.Name, Label: v.Label, Value: v.Value})
+		}
+		return def
+	}
+
+	if p, ok := device.LightProperties[propName]; ok {
+		def := &DefLightVector{Device: device.Name, Name: p.Name, Label: p.Label, Group: p.Group, State: p.State, Timestamp: formatTimestamp(p.LastUpdated)}
+		for _, name := range p.Order {
+			v := p.Values[name]
+			def.Lights = append(def.Lights, DefLight{Name: v.Name, Label: v.Label, Value: v.Value})
+		}
+		return def
+	}
+
+	if p, ok := device.BlobProperties[propName]; ok {
+		def := &DefBlobVector{Device: device.Name, Name: p.Name, Label: p.Label, Group: p.Group, State: p.State, Perm: p.Permissions, Timeout: p.Timeout, Timestamp: formatTimestamp(p.LastUpdated)}
+		for _, name := range p.Order {
+			v := p.Values[name]
+			def.Blobs = append(def.Blobs, DefBlob{Name: v.Name, Label: v.Label})
+		}
+		return def
+	}
+
+	return nil
+}
+
+// setVector builds the set*Vector with the current values of propName on device, or returns nil if there is no such
+// property or it is a BLOB.
+func setVector(device Device, propName, message string) interface{} {
+	if p, ok := device.TextProperties[propName]; ok {
+		set := &SetTextVector{Device: device.Name, Name: p.Name, State: p.State, Timeout: p.Timeout, Timestamp: formatTimestamp(p.LastUpdated), Message: message}
+		for _, name := range p.Order {
+			set.Texts = append(set.Texts, OneText{Name: name, Value: p.Values[name].Value})
+		}
+		return set
+	}
+
+	if p, ok := device.NumberProperties[propName]; ok {
+		set := &SetNumberVector{Device: device.Name, Name: p.Name, State: p.State, Timeout: p.Timeout, Timestamp: formatTimestamp(p.LastUpdated), Message: message}
+		for _, name := range p.Order {
+			set.Numbers = append(set.Numbers, OneNumber{Name: name, Value: p.Values[name].Value})
+		}
+		return set
+	}
+
+	if p, ok := device.SwitchProperties[propName]; ok {
+		set := &SetSwitchVector{Device: device.Name, Name: p.Name, State: p.State, Timeout: p.Timeout, Timestamp: formatTimestamp(p.LastUpdated), Message: message}
+		for _, name := range p.Order {
+			set.Switches = append(set.Switches, OneSwitch{Name: name, Value: p.Values[name].Value})
+		}
+		return set
+	}
+
+	if p, ok := device.LightProperties[propName]; ok {
+		set := &SetLightVector{Device: device.Name, Name: p.Name, State: p.State, Timestamp: formatTimestamp(p.LastUpdated), Message: message}
+		for _, name := range p.Order {
+			set.Lights = append(set.Lights, OneLight{Name: name, Value: p.Values[name].Value})
+		}
+		return set
+	}
+
+	return nil
+}
+
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	return t.UTC().Format("2006-01-02T15:04:05")
+}
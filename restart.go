@@ -0,0 +1,138 @@
+package indiclient
+
+import (
+	"time"
+)
+
+// DriverRestartWindow is how soon after indiserver deletes a device it must be defined again to count as a driver
+// restart. indiserver deletes the devices of a driver that crashes, and restarts it straight away.
+const DriverRestartWindow = 30 * time.Second
+
+// InitValue is a value SetInitValues re-applies to a device after its driver restarts. Values are strings, as for
+// SetTextValue and SetNumberValue; switch values are "On" or "Off".
+type InitValue struct {
+	Property string   `json:"property"`
+	Names    []string `json:"names"`
+	Values   []string `json:"values"`
+}
+
+// SetInitValues registers values to send to deviceName each time its driver restarts, such as CONNECTION and the
+// settings the driver loses when it crashes. Each value is sent once its property has been defined again, in order,
+// so a value for CONNECTION comes before values for properties the driver only defines once connected. Values that
+// fail, for example because the property is busy, are logged and not retried. Passing no values removes them.
+func (c *INDIClient) SetInitValues(deviceName string, values ...InitValue) {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	if len(values) == 0 {
+		delete(c.initValues, deviceName)
+		delete(c.pendingInit, deviceName)
+		return
+	}
+
+	c.initValues[deviceName] = append([]InitValue{}, values...)
+}
+
+// InitValues returns the values registered for deviceName with SetInitValues.
+func (c *INDIClient) InitValues(deviceName string) []InitValue {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return append([]InitValue{}, c.initValues[deviceName]...)
+}
+
+// deviceDeleted records when indiserver deleted deviceName, to recognise a restart if it is defined again. Modifies
+// INDIClient.deletedDevices. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) deviceDeleted(deviceName string) {
+	c.deletedDevices[deviceName] = c.now()
+	delete(c.pendingInit, deviceName)
+}
+
+// checkRestart sends an EventTypeDriverRestarted event if deviceName is being defined again soon after indiserver
+// deleted it, and queues its init values. Call before the property is defined. Modifies INDIClient.deletedDevices and
+// INDIClient.pendingInit. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) checkRestart(deviceName string) {
+	deleted, ok := c.deletedDevices[deviceName]
+	if !ok {
+		return
+	}
+
+	delete(c.deletedDevices, deviceName)
+
+	if c.now().Sub(deleted) > DriverRestartWindow {
+		return
+	}
+
+	c.log.WithField("device", deviceName).Warn("driver restarted")
+
+	if values, ok := c.initValues[deviceName]; ok {
+		c.pendingInit[deviceName] = append([]InitValue{}, values...)
+	}
+
+	c.emit(Event{
+		Type:   EventTypeDriverRestarted,
+		Device: deviceName,
+	})
+}
+
+// applyInitValues sends the queued init values of deviceName whose properties are defined, in order, stopping at the
+// first whose property is not defined yet. They are sent on another goroutine, since sending takes the lock. Modifies
+// INDIClient.pendingInit. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) applyInitValues(deviceName string) {
+	pending := c.pendingInit[deviceName]
+	if len(pending) == 0 {
+		return
+	}
+
+	device, ok := c.devices[deviceName]
+	if !ok {
+		return
+	}
+
+	ready := []func() error{}
+
+	for len(pending) > 0 {
+		v := pending[0]
+
+		if _, ok := device.SwitchProperties[v.Property]; ok {
+			states := make([]SwitchState, len(v.Values))
+			for i, s := range v.Values {
+				states[i] = SwitchState(s)
+			}
+
+			ready = append(ready, func() error { return c.SetSwitchValue(deviceName, v.Property, v.Names, states) })
+		} else if _, ok := device.NumberProperties[v.Property]; ok {
+			ready = append(ready, func() error { return c.SetNumberValue(deviceName, v.Property, v.Names, v.Values) })
+		} else if _, ok := device.TextProperties[v.Property]; ok {
+			ready = append(ready, func() error { return c.SetTextValue(deviceName, v.Property, v.Names, v.Values) })
+		} else {
+			break
+		}
+
+		pending = pending[1:]
+	}
+
+	if len(pending) == 0 {
+		delete(c.pendingInit, deviceName)
+	} else {
+		c.pendingInit[deviceName] = pending
+	}
+
+	if len(ready) == 0 {
+		return
+	}
+
+	log := c.log.WithField("device", deviceName)
+
+	go func() {
+		for _, set := range ready {
+			if err := set(); err != nil {
+				log.WithError(err).Warn("could not re-apply init value")
+			}
+		}
+	}()
+}
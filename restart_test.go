@@ -0,0 +1,87 @@
+package indiclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DriverRestart(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+
+	handle := func(fn func()) {
+		c.rwm.Lock()
+		defer c.rwm.Unlock()
+		fn()
+	}
+
+	defineConnection := func() {
+		c.defSwitchVector(&DefSwitchVector{
+			Device:   "Mount",
+			Name:     "CONNECTION",
+			State:    PropertyStateIdle,
+			Perm:     PropertyPermissionReadWrite,
+			Rule:     SwitchRuleOneOfMany,
+			Switches: []DefSwitch{{Name: "CONNECT", Value: SwitchStateOff}, {Name: "DISCONNECT", Value: SwitchStateOn}},
+		})
+	}
+
+	c.SetInitValues("Mount",
+		InitValue{Property: "CONNECTION", Names: []string{"CONNECT"}, Values: []string{"On"}},
+		InitValue{Property: "EQUATORIAL_EOD_COORD", Names: []string{"RA"}, Values: []string{"5"}},
+	)
+	assert.Len(t, c.InitValues("Mount"), 2)
+
+	events, id, err := c.Subscribe(SubscribeOptions{Types: []EventType{EventTypeDriverRestarted}})
+	require.NoError(t, err)
+	defer c.Unsubscribe(id)
+
+	// The first definition is not a restart.
+	handle(defineConnection)
+	handle(func() { defineCoords(c) })
+
+	assert.Empty(t, drain(events, 50*time.Millisecond))
+	assert.Empty(t, c.write)
+
+	// Nor is deleting a single property.
+	handle(func() { c.delProperty(&DelProperty{Device: "Mount", Name: "EQUATORIAL_EOD_COORD"}) })
+	handle(func() { defineCoords(c) })
+
+	assert.Empty(t, drain(events, 50*time.Millisecond))
+
+	// indiserver deletes the device when the driver crashes, and the new driver defines it again.
+	handle(func() { c.delProperty(&DelProperty{Device: "Mount"}) })
+	handle(defineConnection)
+
+	received := drain(events, 50*time.Millisecond)
+	require.Len(t, received, 1)
+	assert.Equal(t, EventTypeDriverRestarted, received[0].Type)
+	assert.Equal(t, "Mount", received[0].Device)
+
+	select {
+	case cmd := <-c.write:
+		assert.Equal(t, NewSwitchVector{Device: "Mount", Name: "CONNECTION", Switches: []OneSwitch{{Name: "CONNECT", Value: SwitchStateOn}}}, cmd)
+	case <-time.After(time.Second):
+		t.Fatal("CONNECTION was not re-applied")
+	}
+
+	// The coordinates wait for the driver to connect and define them.
+	handle(func() {
+		c.setSwitchVector(&SetSwitchVector{Device: "Mount", Name: "CONNECTION", State: PropertyStateOk, Switches: []OneSwitch{{Name: "CONNECT", Value: SwitchStateOn}}})
+	})
+	handle(func() { defineCoords(c) })
+
+	select {
+	case cmd := <-c.write:
+		assert.Equal(t, NewNumberVector{Device: "Mount", Name: "EQUATORIAL_EOD_COORD", Numbers: []OneNumber{{Name: "RA", Value: "5"}}}, cmd)
+	case <-time.After(time.Second):
+		t.Fatal("EQUATORIAL_EOD_COORD was not re-applied")
+	}
+
+	handle(func() {
+		c.setNumberVector(&SetNumberVector{Device: "Mount", Name: "EQUATORIAL_EOD_COORD", State: PropertyStateOk, Numbers: []OneNumber{{Name: "RA", Value: "5"}}})
+	})
+}
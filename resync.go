@@ -0,0 +1,71 @@
+package indiclient
+
+// ResyncOptions controls how the client recovers from malformed messages. A malformed message is always skipped: the
+// client discards input up to the start of the next message and sends EventTypeResync. If the stream is badly
+// corrupted, reconnecting may recover sooner than skipping message after message.
+type ResyncOptions struct {
+	// ReconnectAfter is how many malformed messages in a row make the client disconnect, connect again as
+	// ConnectProfile does, and send EventTypeReconnect. Unknown elements do not count. Zero never reconnects.
+	ReconnectAfter int
+}
+
+// SetResync changes how the client recovers from malformed messages. It takes effect straight away.
+func (c *INDIClient) SetResync(opts ResyncOptions) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.resync = opts
+}
+
+// Resync returns the options set with SetResync.
+func (c *INDIClient) Resync() ResyncOptions {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.resync
+}
+
+// tooManyFailures returns true if failures malformed messages in a row should make the client reconnect.
+func (c *INDIClient) tooManyFailures(failures int) bool {
+	opts := c.Resync()
+
+	return opts.ReconnectAfter > 0 && failures >= opts.ReconnectAfter
+}
+
+// reconnectRequest is sent by the goroutine reading the connection, after too many malformed messages, to the
+// goroutine handling them. err is the last of them.
+type reconnectRequest struct {
+	err *ParseError
+}
+
+// reconnect ends s and connects again to the same address, because of too many malformed messages. It does nothing
+// if s has already been replaced or ended, e.g. by Disconnect.
+func (c *INDIClient) reconnect(s *session, perr *ParseError) {
+	c.rwm.RLock()
+	current := s == c.session && !s.ended()
+	c.rwm.RUnlock()
+
+	if !current {
+		return
+	}
+
+	c.disconnect(s, nil)
+
+	c.rwm.Lock()
+	c.emit(Event{
+		Type:  EventTypeReconnect,
+		Error: perr.Error(),
+	})
+	c.rwm.Unlock()
+
+	if err := c.ConnectProfile(); err != nil {
+		c.log.WithError(err).Error("error reconnecting")
+
+		c.rwm.Lock()
+		c.emit(Event{
+			Type:  EventTypeError,
+			Error: err.Error(),
+		})
+		c.rwm.Unlock()
+	}
+}
@@ -0,0 +1,118 @@
+package indiclient
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queueDialer returns the next connection from conns each time it is dialed.
+type queueDialer struct {
+	conns chan net.Conn
+}
+
+func (d queueDialer) Dial(network, address string) (io.ReadWriteCloser, error) {
+	return <-d.conns, nil
+}
+
+// serve returns the server end of a new pipe whose client end d returns, and what the client writes to it.
+func (d queueDialer) serve() (net.Conn, <-chan string) {
+	client, server := net.Pipe()
+	d.conns <- client
+
+	commands := make(chan string, 10)
+	go func() {
+		b := make([]byte, 1024)
+		for {
+			n, err := server.Read(b)
+			if err != nil {
+				return
+			}
+			commands <- string(b[:n])
+		}
+	}()
+
+	return server, commands
+}
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}
+	}
+}
+
+const malformedMessage = `<setNumberVector device="Mount" name="EQUATORIAL_EOD_COORD"><oneNumber name="RA">1</oneNumber></setNumberVector junk>`
+
+func Test_Resync(t *testing.T) {
+	d := queueDialer{conns: make(chan net.Conn, 2)}
+	c := NewINDIClient(logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelInfo), d, afero.NewMemMapFs(), 100)
+
+	events, _, err := c.Subscribe(SubscribeOptions{Types: []EventType{EventTypeResync, EventTypeMessage}})
+	require.NoError(t, err)
+
+	server, _ := d.serve()
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+
+	_, err = server.Write([]byte(malformedMessage + `<message message="after"/>`))
+	require.NoError(t, err)
+
+	e := nextEvent(t, events)
+	assert.Equal(t, EventTypeResync, e.Type)
+	assert.Contains(t, e.Error, "setNumberVector")
+
+	e = nextEvent(t, events)
+	assert.Equal(t, EventTypeMessage, e.Type)
+	assert.Equal(t, "after", e.Message)
+}
+
+func Test_Resync_ReconnectAfter(t *testing.T) {
+	d := queueDialer{conns: make(chan net.Conn, 2)}
+	c := NewINDIClient(logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelInfo), d, afero.NewMemMapFs(), 100)
+	c.SetResync(ResyncOptions{ReconnectAfter: 2})
+
+	events, _, err := c.Subscribe(SubscribeOptions{Types: []EventType{EventTypeResync, EventTypeReconnect}})
+	require.NoError(t, err)
+
+	server, _ := d.serve()
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+
+	_, second := d.serve()
+
+	// The parser only reports a malformed message once it has found the start of the next one. A good message in
+	// between resets the count.
+	_, err = server.Write([]byte(malformedMessage + `<message message="ok"/>` + malformedMessage + `<message message="ok"/>`))
+	require.NoError(t, err)
+
+	assert.Equal(t, EventTypeResync, nextEvent(t, events).Type)
+	assert.Equal(t, EventTypeResync, nextEvent(t, events).Type)
+	assert.Len(t, d.conns, 1)
+
+	go server.Write([]byte(malformedMessage + malformedMessage + `<message message="ok"/>`))
+
+	assert.Equal(t, EventTypeResync, nextEvent(t, events).Type)
+	assert.Equal(t, EventTypeResync, nextEvent(t, events).Type)
+	assert.Equal(t, EventTypeReconnect, nextEvent(t, events).Type)
+
+	select {
+	case cmd := <-second:
+		assert.Equal(t, `<getProperties version="1.7"></getProperties>`, cmd)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the client to reconnect")
+	}
+
+	assert.Len(t, d.conns, 0)
+	assert.True(t, c.IsConnected())
+}
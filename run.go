@@ -0,0 +1,126 @@
+package indiclient
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// session is a single connection to indiserver, made by Connect and ended by Disconnect.
+type session struct {
+	// loops counts the goroutines that read and dispatch messages from, and write commands to, the connection.
+	loops sync.WaitGroup
+
+	conn io.ReadWriteCloser
+	// read carries messages from the goroutine reading conn, which closes it when it stops, to the goroutine
+	// dispatching them.
+	read chan interface{}
+	// done is closed when the session ends, which stops the goroutine writing conn.
+	done chan struct{}
+	once sync.Once
+}
+
+func newSession(conn io.ReadWriteCloser, bufferSize int) *session {
+	return &session{
+		conn: conn,
+		read: make(chan interface{}, bufferSize),
+		done: make(chan struct{}),
+	}
+}
+
+// close ends the session by closing conn and done. Only the first call does anything; it returns true, and the error
+// from closing conn.
+func (s *session) close() (bool, error) {
+	closed := false
+	var err error
+
+	s.once.Do(func() {
+		closed = true
+		err = s.conn.Close()
+		close(s.done)
+	})
+
+	return closed, err
+}
+
+// ended returns true once the session has been closed.
+func (s *session) ended() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run connects with ConnectProfile, unless the client is already connected, then runs until ctx is done, when it
+// disconnects and returns ctx.Err(), or until the connection is lost, when it returns ErrConnectionLost. Either way,
+// the goroutines reading and writing the connection have finished when it returns. Reconnections made by the client
+// itself, such as for ResyncOptions.ReconnectAfter, do not end it.
+//
+// Run lets the caller own the client's lifecycle, e.g. with errgroup:
+//
+//	g, ctx := errgroup.WithContext(ctx)
+//	g.Go(func() error { return c.Run(ctx) })
+//	g.Go(func() error { return capture(ctx, c) })
+//	err := g.Wait()
+//
+// Only call Run once at a time.
+func (c *INDIClient) Run(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if !c.IsConnected() {
+		if err := c.ConnectProfile(); err != nil {
+			return err
+		}
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-ctx.Done():
+			c.Disconnect()
+		case <-stop:
+		}
+	}()
+
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+
+	c.rwm.RLock()
+	s := c.session
+	c.rwm.RUnlock()
+
+	for {
+		s.loops.Wait()
+
+		err := ctx.Err()
+		if err != nil {
+			// The client may have reconnected while it was disconnecting.
+			c.Disconnect()
+		}
+
+		c.rwm.RLock()
+		next := c.session
+		c.rwm.RUnlock()
+
+		if next != s && (err != nil || c.IsConnected()) {
+			s = next
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return ErrConnectionLost
+	}
+}
@@ -0,0 +1,168 @@
+package indiclient
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+func Test_Run(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+
+	client, server := net.Pipe()
+	go io.Copy(ioutil.Discard, server)
+
+	c := FromProfile(log, pipeDialer{conn: client}, afero.NewMemMapFs(), Profile{Network: "tcp", Address: "localhost:7624"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+
+	var s *session
+	testutil.WaitFor(t, func() bool {
+		c.rwm.RLock()
+		defer c.rwm.RUnlock()
+		s = c.session
+		return s != nil
+	})
+
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Run to return")
+	}
+
+	assert.False(t, c.IsConnected())
+
+	// The connection's goroutines have all finished.
+	s.loops.Wait()
+
+	assert.Equal(t, context.Canceled, c.Run(ctx))
+}
+
+func Test_Run_ConnectionLost(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+
+	client, server := net.Pipe()
+	c := NewINDIClient(log, pipeDialer{conn: client}, afero.NewMemMapFs(), 10)
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+
+	done := make(chan error, 1)
+	go func() { done <- c.Run(context.Background()) }()
+
+	_, err := server.Write([]byte(`<message message="hello"/>`))
+	require.NoError(t, err)
+	require.NoError(t, server.Close())
+
+	select {
+	case err := <-done:
+		assert.Equal(t, ErrConnectionLost, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Run to return")
+	}
+
+	assert.False(t, c.IsConnected())
+	assert.Len(t, c.ServerMessages(), 1)
+}
+
+func Test_Run_NoAddress(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	c := NewINDIClient(log, NetworkDialer{}, afero.NewMemMapFs(), 10)
+
+	assert.Equal(t, ErrInvalidAddress, c.Run(context.Background()))
+}
+
+func Test_Disconnect_Concurrent(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+
+	client, server := net.Pipe()
+	go io.Copy(ioutil.Discard, server)
+
+	c := NewINDIClient(log, pipeDialer{conn: client}, afero.NewMemMapFs(), 1)
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+
+	c.rwm.RLock()
+	s := c.session
+	c.rwm.RUnlock()
+
+	// Keep the goroutine reading the connection busy, so it is still sending messages when the session ends.
+	go func() {
+		for {
+			if _, err := server.Write([]byte(`<message message="hello"/>`)); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(t, c.Disconnect())
+			// Commands sent once the session has ended are dropped.
+			assert.NoError(t, c.GetProperties("", ""))
+		}()
+	}
+
+	cancel()
+	server.Close()
+	wg.Wait()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for Run to return")
+	}
+
+	s.loops.Wait()
+	assert.False(t, c.IsConnected())
+}
+
+func Test_Disconnect_OldSession(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+
+	d := queueDialer{conns: make(chan net.Conn, 2)}
+	c := NewINDIClient(log, d, afero.NewMemMapFs(), 10)
+
+	d.serve()
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+
+	c.rwm.RLock()
+	old := c.session
+	c.rwm.RUnlock()
+
+	// Connecting again ends the previous session.
+	d.serve()
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+
+	old.loops.Wait()
+	assert.True(t, old.ended())
+
+	// Its goroutines ending late does not disconnect the new one.
+	require.NoError(t, c.disconnect(old, ErrConnectionLost))
+	assert.True(t, c.IsConnected())
+}
@@ -0,0 +1,141 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/observatory"
+)
+
+// Status is the outcome of a slot.
+type Status string
+
+const (
+	// StatusCompleted means the sequencer ran until it finished or its slot ended.
+	StatusCompleted Status = "completed"
+	// StatusFailed means the sequencer returned an error.
+	StatusFailed Status = "failed"
+	// StatusSkipped means the slot had already ended when Run reached it.
+	StatusSkipped Status = "skipped"
+	// StatusCancelled means the context passed to Run was cancelled during the slot.
+	StatusCancelled Status = "cancelled"
+)
+
+// LogEntry records the execution of a slot.
+type LogEntry struct {
+	Target string `json:"target"`
+	Status Status `json:"status"`
+	// Start and End are when the sequencer actually started and returned.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Error string    `json:"error,omitempty"`
+}
+
+// Sequencer observes a target.
+type Sequencer interface {
+	// Observe observes target until it is done, or until ctx is done at the end of the target's slot.
+	Observe(ctx context.Context, target Target) error
+}
+
+// Run executes plan with seq, waiting for the start of each slot and stopping the sequencer at its end. Slots that
+// have already ended are skipped. onEntry, if set, is called as each slot finishes, and the full log is returned.
+// Cancelling ctx stops the run.
+//
+// clock tells the time and times the waits, usually the client's INDIClient.Clock so a FakeClock drives the whole run
+// in tests. nil uses indiclient.SystemClock.
+func Run(ctx context.Context, clock indiclient.Clock, plan Plan, seq Sequencer, onEntry func(LogEntry)) ([]LogEntry, error) {
+	if clock == nil {
+		clock = indiclient.SystemClock{}
+	}
+
+	log := []LogEntry{}
+
+	add := func(e LogEntry) {
+		log = append(log, e)
+		if onEntry != nil {
+			onEntry(e)
+		}
+	}
+
+	for _, slot := range plan.Slots {
+		now := clock.Now()
+
+		if wait := slot.Start.Sub(now); wait > 0 {
+			select {
+			case <-clock.After(wait):
+			case <-ctx.Done():
+				return log, ctx.Err()
+			}
+
+			now = clock.Now()
+		}
+
+		if !now.Before(slot.End) {
+			add(LogEntry{Target: slot.Target.Name, Status: StatusSkipped, Start: now, End: now})
+			continue
+		}
+
+		e := LogEntry{Target: slot.Target.Name, Start: now}
+
+		// The slot ends on clock rather than with context.WithDeadline, which would always use the system clock.
+		slotCtx, cancel := context.WithCancel(ctx)
+		end := clock.AfterFunc(slot.End.Sub(e.Start), cancel)
+		err := seq.Observe(slotCtx, slot.Target)
+		end.Stop()
+		ended := slotCtx.Err() != nil
+		cancel()
+
+		e.End = clock.Now()
+
+		switch {
+		case ctx.Err() != nil:
+			e.Status = StatusCancelled
+		case err == nil || ended && err == context.Canceled:
+			e.Status = StatusCompleted
+		default:
+			e.Status = StatusFailed
+			e.Error = err.Error()
+		}
+
+		add(e)
+
+		if ctx.Err() != nil {
+			return log, ctx.Err()
+		}
+	}
+
+	return log, nil
+}
+
+// ObservatorySequencer observes targets with an observatory: it slews the telescope to the target, selects its filter,
+// and takes frames until the slot ends.
+type ObservatorySequencer struct {
+	Observatory *observatory.Observatory
+	// OnFrame, if set, is called with each frame, e.g. to save it.
+	OnFrame func(Target, indiclient.BlobEvent)
+}
+
+// Observe slews to target and takes frames of target.Exposure seconds until ctx is done.
+func (s ObservatorySequencer) Observe(ctx context.Context, target Target) error {
+	if err := s.Observatory.Telescope.SlewToJ2000(ctx, target.RA, target.Dec); err != nil {
+		return err
+	}
+
+	if len(target.Filter) > 0 && s.Observatory.FilterWheel != nil {
+		if err := s.Observatory.FilterWheel.SetFilter(ctx, target.Filter); err != nil {
+			return err
+		}
+	}
+
+	for {
+		e, err := s.Observatory.Camera.Expose(ctx, target.Exposure)
+		if err != nil {
+			return err
+		}
+
+		if s.OnFrame != nil {
+			s.OnFrame(target, e)
+		}
+	}
+}
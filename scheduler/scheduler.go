@@ -0,0 +1,255 @@
+// Package scheduler plans a night of observing from a list of targets, and runs the plan:
+//
+//	dusk, dawn, err := scheduler.Night(site, time.Now(), scheduler.AstronomicalTwilight)
+//	...
+//	plan, err := scheduler.NewPlan(targets, site, dusk, dawn, scheduler.Options{})
+//	...
+//	log, err := scheduler.Run(ctx, c.Clock(), plan, scheduler.ObservatorySequencer{Observatory: o}, nil)
+//
+// Each target is observed once, for its Duration, while it is above its minimum altitude and far enough from the
+// moon. Targets are scheduled in order of priority, and among targets of the same priority the one that sets first is
+// observed first.
+package scheduler
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/astro"
+)
+
+var (
+	// ErrNoNight is returned by Night when the sun does not get below the requested altitude, e.g. near midsummer at
+	// high latitudes.
+	ErrNoNight = errors.New("the sun does not set that far")
+	// ErrInvalidTarget is returned by NewPlan for a target without a name or duration, or with a duplicate name.
+	ErrInvalidTarget = errors.New("invalid target")
+)
+
+const (
+	// CivilTwilight, NauticalTwilight and AstronomicalTwilight are the altitudes of the sun, in degrees, at which
+	// each twilight ends.
+	CivilTwilight        = -6
+	NauticalTwilight     = -12
+	AstronomicalTwilight = -18
+
+	// DefaultStep is the default interval at which constraints are checked.
+	DefaultStep = 5 * time.Minute
+)
+
+// Target is an object to observe.
+type Target struct {
+	// Name identifies the target, and must be unique within a plan.
+	Name string `json:"name"`
+	// RA and Dec are the J2000 coordinates of the target, in hours and degrees.
+	RA  float64 `json:"ra"`
+	Dec float64 `json:"dec"`
+	// Priority orders targets that are visible at the same time, highest first.
+	Priority int `json:"priority"`
+	// Duration is how long to observe the target.
+	Duration time.Duration `json:"duration"`
+	// MinAltitude is the lowest altitude, in degrees, the target may be observed at.
+	MinAltitude float64 `json:"minAltitude"`
+	// MinMoonSeparation is the smallest angle, in degrees, between the target and the moon it may be observed at.
+	MinMoonSeparation float64 `json:"minMoonSeparation"`
+	// Exposure is the exposure time of each frame, in seconds, and Filter the filter to use, if any. They are used by
+	// the sequencer.
+	Exposure float64 `json:"exposure"`
+	Filter   string  `json:"filter,omitempty"`
+}
+
+// Window is a period of time.
+type Window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Slot is a target scheduled for a window.
+type Slot struct {
+	Target Target `json:"target"`
+	Window
+}
+
+// Plan is the schedule for a night.
+type Plan struct {
+	Window
+	// Slots are the scheduled targets, in the order they are observed.
+	Slots []Slot `json:"slots"`
+	// Visibility holds the windows during which each target meets its constraints, by target name.
+	Visibility map[string][]Window `json:"visibility"`
+	// Unscheduled names the targets that could not be fit into the plan.
+	Unscheduled []string `json:"unscheduled"`
+}
+
+// Options controls planning.
+type Options struct {
+	// Step is the interval at which constraints are checked, and by which the plan advances when nothing is visible.
+	// Defaults to DefaultStep.
+	Step time.Duration
+}
+
+// Night returns the start and end of the night that follows noon, local solar time, on the date of day at site: the
+// times the sun goes below sunAltitude and comes back above it. Use one of the twilight constants for sunAltitude.
+func Night(site indiclient.Site, day time.Time, sunAltitude float64) (start, end time.Time, err error) {
+	// Local solar noon is when the sun is south, which is earlier in UTC the further east the site is.
+	longitude := site.Longitude
+	if longitude > 180 {
+		longitude -= 360
+	}
+
+	y, m, d := day.Date()
+	noon := time.Date(y, m, d, 12, 0, 0, 0, time.UTC).Add(-time.Duration(longitude / 15 * float64(time.Hour)))
+
+	sunAlt := func(t time.Time) float64 {
+		ra, dec := astro.SunPosition(t)
+		alt, _ := astro.AltAz(ra, dec, site, t)
+		return alt
+	}
+
+	for t := noon; t.Before(noon.Add(24 * time.Hour)); t = t.Add(time.Minute) {
+		dark := sunAlt(t) < sunAltitude
+
+		if dark && start.IsZero() {
+			start = t
+		} else if !dark && !start.IsZero() {
+			return start, t, nil
+		}
+	}
+
+	if start.IsZero() {
+		return start, end, ErrNoNight
+	}
+
+	// Dark until the next noon, as happens near midwinter at high latitudes.
+	return start, noon.Add(24 * time.Hour), nil
+}
+
+// Visibility returns the windows between start and end during which target is above its minimum altitude and far
+// enough from the moon, checked every step.
+func Visibility(target Target, site indiclient.Site, start, end time.Time, step time.Duration) []Window {
+	if step <= 0 {
+		step = DefaultStep
+	}
+
+	windows := []Window{}
+
+	var current *Window
+
+	for t := start; !t.After(end); t = t.Add(step) {
+		if visible(target, site, t) {
+			if current == nil {
+				current = &Window{Start: t}
+			}
+			current.End = t
+		} else if current != nil {
+			windows = append(windows, *current)
+			current = nil
+		}
+	}
+
+	if current != nil {
+		windows = append(windows, *current)
+	}
+
+	return windows
+}
+
+func visible(target Target, site indiclient.Site, t time.Time) bool {
+	ra, dec := astro.ToJNow(target.RA, target.Dec, t)
+
+	if alt, _ := astro.AltAz(ra, dec, site, t); alt < target.MinAltitude {
+		return false
+	}
+
+	if target.MinMoonSeparation <= 0 {
+		return true
+	}
+
+	moonRA, moonDec := astro.MoonPosition(t)
+
+	return astro.Separation(ra, dec, moonRA, moonDec) >= target.MinMoonSeparation
+}
+
+// NewPlan schedules targets between start and end at site. At each point in time, the highest priority target that
+// stays visible for its whole Duration is scheduled next; if none is, the plan moves on by Options.Step.
+func NewPlan(targets []Target, site indiclient.Site, start, end time.Time, opts Options) (Plan, error) {
+	if opts.Step <= 0 {
+		opts.Step = DefaultStep
+	}
+
+	plan := Plan{
+		Window:      Window{Start: start, End: end},
+		Slots:       []Slot{},
+		Visibility:  map[string][]Window{},
+		Unscheduled: []string{},
+	}
+
+	for _, target := range targets {
+		if len(target.Name) == 0 || target.Duration <= 0 {
+			return plan, ErrInvalidTarget
+		}
+
+		if _, ok := plan.Visibility[target.Name]; ok {
+			return plan, ErrInvalidTarget
+		}
+
+		plan.Visibility[target.Name] = Visibility(target, site, start, end, opts.Step)
+	}
+
+	remaining := append([]Target{}, targets...)
+
+	// Highest priority first, then the one whose visibility ends soonest, so targets that are about to set are not
+	// lost to ones that will still be up later.
+	sort.SliceStable(remaining, func(i, j int) bool {
+		if remaining[i].Priority != remaining[j].Priority {
+			return remaining[i].Priority > remaining[j].Priority
+		}
+		return lastVisible(plan.Visibility[remaining[i].Name]).Before(lastVisible(plan.Visibility[remaining[j].Name]))
+	})
+
+	for t := start; t.Before(end) && len(remaining) > 0; {
+		scheduled := false
+
+		for i, target := range remaining {
+			if !within(plan.Visibility[target.Name], t, t.Add(target.Duration)) {
+				continue
+			}
+
+			plan.Slots = append(plan.Slots, Slot{Target: target, Window: Window{Start: t, End: t.Add(target.Duration)}})
+			remaining = append(remaining[:i], remaining[i+1:]...)
+
+			t = t.Add(target.Duration)
+			scheduled = true
+			break
+		}
+
+		if !scheduled {
+			t = t.Add(opts.Step)
+		}
+	}
+
+	for _, target := range remaining {
+		plan.Unscheduled = append(plan.Unscheduled, target.Name)
+	}
+
+	return plan, nil
+}
+
+// within returns true if one of windows covers start to end.
+func within(windows []Window, start, end time.Time) bool {
+	for _, w := range windows {
+		if !start.Before(w.Start) && !end.After(w.End) {
+			return true
+		}
+	}
+	return false
+}
+
+func lastVisible(windows []Window) time.Time {
+	if len(windows) == 0 {
+		return time.Time{}
+	}
+	return windows[len(windows)-1].End
+}
@@ -0,0 +1,336 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/astro"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/observatory"
+	"github.com/goastro/indiclient/scheduler"
+	"github.com/goastro/indiclient/simulators"
+)
+
+var greenwich = indiclient.Site{Latitude: 51.4769, Longitude: 0}
+
+func Test_Night(t *testing.T) {
+	dusk, dawn, err := scheduler.Night(greenwich, time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC), scheduler.AstronomicalTwilight)
+	require.NoError(t, err)
+
+	// Astronomical twilight in London in mid January ends a little after 18:00 and starts again a little before 06:10.
+	assert.WithinDuration(t, time.Date(2026, 1, 15, 18, 10, 0, 0, time.UTC), dusk, 20*time.Minute)
+	assert.WithinDuration(t, time.Date(2026, 1, 16, 6, 0, 0, 0, time.UTC), dawn, 20*time.Minute)
+
+	// Civil twilight is shorter.
+	civilDusk, civilDawn, err := scheduler.Night(greenwich, time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC), scheduler.CivilTwilight)
+	require.NoError(t, err)
+	assert.True(t, civilDusk.Before(dusk))
+	assert.True(t, civilDawn.After(dawn))
+
+	// The sun does not get 18 degrees below the horizon in midsummer at 60 degrees north.
+	_, _, err = scheduler.Night(indiclient.Site{Latitude: 60, Longitude: 10}, time.Date(2026, 6, 21, 0, 0, 0, 0, time.UTC), scheduler.AstronomicalTwilight)
+	assert.Equal(t, scheduler.ErrNoNight, err)
+}
+
+func Test_Visibility(t *testing.T) {
+	start := time.Date(2026, 1, 15, 18, 0, 0, 0, time.UTC)
+	end := start.Add(12 * time.Hour)
+
+	// Near the pole, always up.
+	circumpolar := scheduler.Target{Name: "circumpolar", RA: 2.5, Dec: 89, MinAltitude: 30}
+	assert.Equal(t, []scheduler.Window{{Start: start, End: end}}, scheduler.Visibility(circumpolar, greenwich, start, end, 0))
+
+	// Far south, never up.
+	southern := scheduler.Target{Name: "southern", RA: 2.5, Dec: -80}
+	assert.Empty(t, scheduler.Visibility(southern, greenwich, start, end, 0))
+
+	// Orion culminates around 22:00 in mid January, so it is above 25 degrees for a few hours either side.
+	orion := scheduler.Target{Name: "M42", RA: 5.588, Dec: -5.39, MinAltitude: 25}
+	windows := scheduler.Visibility(orion, greenwich, start, end, 0)
+	require.Len(t, windows, 1)
+	assert.True(t, windows[0].Start.After(start))
+	assert.True(t, windows[0].End.Before(end))
+	assert.WithinDuration(t, time.Date(2026, 1, 15, 21, 55, 0, 0, time.UTC), windows[0].Start.Add(windows[0].End.Sub(windows[0].Start)/2), 20*time.Minute)
+}
+
+func Test_Visibility_Moon(t *testing.T) {
+	site := indiclient.Site{Latitude: 0}
+	start := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	moonRA, moonDec := astro.MoonPosition(start)
+	ra, dec := astro.ToJ2000(moonRA, moonDec, start)
+
+	// A target next to the moon is visible without a moon constraint, but not with one. The moon moves about half a
+	// degree an hour, so it stays near the target for the hour checked.
+	target := scheduler.Target{Name: "near moon", RA: ra, Dec: dec, MinAltitude: -90, Duration: time.Hour}
+
+	assert.Len(t, scheduler.Visibility(target, site, start, start.Add(time.Hour), 0), 1)
+
+	target.MinMoonSeparation = 20
+	assert.Empty(t, scheduler.Visibility(target, site, start, start.Add(time.Hour), 0))
+}
+
+func Test_NewPlan(t *testing.T) {
+	start := time.Date(2026, 1, 15, 18, 0, 0, 0, time.UTC)
+	end := start.Add(12 * time.Hour)
+
+	targets := []scheduler.Target{
+		{Name: "low", RA: 2.5, Dec: 89, Priority: 1, Duration: 2 * time.Hour},
+		{Name: "high", RA: 2.5, Dec: 89, Priority: 2, Duration: time.Hour},
+		{Name: "southern", RA: 2.5, Dec: -80, Priority: 3, Duration: time.Hour},
+		{Name: "M42", RA: 5.588, Dec: -5.39, MinAltitude: 25, Priority: 1, Duration: time.Hour},
+	}
+
+	plan, err := scheduler.NewPlan(targets, greenwich, start, end, scheduler.Options{})
+	require.NoError(t, err)
+
+	require.Len(t, plan.Slots, 3)
+
+	// The higher priority target goes first, then the circumpolar one of the same priority as M42, which is not up
+	// yet, then M42 once it has risen.
+	assert.Equal(t, "high", plan.Slots[0].Target.Name)
+	assert.Equal(t, start, plan.Slots[0].Start)
+	assert.Equal(t, "low", plan.Slots[1].Target.Name)
+	assert.Equal(t, plan.Slots[0].End, plan.Slots[1].Start)
+	assert.Equal(t, "M42", plan.Slots[2].Target.Name)
+	assert.False(t, plan.Slots[2].Start.Before(plan.Visibility["M42"][0].Start))
+
+	assert.Equal(t, []string{"southern"}, plan.Unscheduled)
+	assert.Empty(t, plan.Visibility["southern"])
+
+	_, err = scheduler.NewPlan([]scheduler.Target{{Name: "a", Duration: time.Hour}, {Name: "a", Duration: time.Hour}}, greenwich, start, end, scheduler.Options{})
+	assert.Equal(t, scheduler.ErrInvalidTarget, err)
+
+	_, err = scheduler.NewPlan([]scheduler.Target{{Name: "a"}}, greenwich, start, end, scheduler.Options{})
+	assert.Equal(t, scheduler.ErrInvalidTarget, err)
+}
+
+func Test_NewPlan_SettingFirst(t *testing.T) {
+	start := time.Date(2026, 1, 15, 18, 0, 0, 0, time.UTC)
+	end := start.Add(12 * time.Hour)
+
+	// Both are up at dusk, but the western one sets soon, so it is observed first.
+	plan, err := scheduler.NewPlan([]scheduler.Target{
+		{Name: "circumpolar", RA: 2.5, Dec: 89, MinAltitude: 20, Duration: time.Hour},
+		{Name: "western", RA: 22, Dec: 10, MinAltitude: 20, Duration: time.Hour},
+	}, greenwich, start, end, scheduler.Options{})
+	require.NoError(t, err)
+
+	require.Len(t, plan.Slots, 2)
+	assert.Equal(t, "western", plan.Slots[0].Target.Name)
+	assert.Equal(t, "circumpolar", plan.Slots[1].Target.Name)
+}
+
+type fakeSequencer struct {
+	mu       sync.Mutex
+	observed []string
+	err      error
+}
+
+func (s *fakeSequencer) Observe(ctx context.Context, target scheduler.Target) error {
+	s.mu.Lock()
+	s.observed = append(s.observed, target.Name)
+	s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type runResult struct {
+	log []scheduler.LogEntry
+	err error
+}
+
+// runAsync calls scheduler.Run in the background, so the test can advance the clock, and sends its result once it
+// returns.
+func runAsync(ctx context.Context, clock indiclient.Clock, plan scheduler.Plan, seq scheduler.Sequencer, onEntry func(scheduler.LogEntry)) <-chan runResult {
+	done := make(chan runResult, 1)
+
+	go func() {
+		log, err := scheduler.Run(ctx, clock, plan, seq, onEntry)
+		done <- runResult{log: log, err: err}
+	}()
+
+	return done
+}
+
+func Test_Run(t *testing.T) {
+	now := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+	clock := indiclient.NewFakeClock(now)
+
+	slot := func(name string, start, end time.Duration) scheduler.Slot {
+		return scheduler.Slot{
+			Target: scheduler.Target{Name: name},
+			Window: scheduler.Window{Start: now.Add(start), End: now.Add(end)},
+		}
+	}
+
+	plan := scheduler.Plan{Slots: []scheduler.Slot{
+		slot("missed", -time.Hour, -time.Minute),
+		slot("first", 0, 50*time.Minute),
+		slot("second", time.Hour, 2*time.Hour),
+	}}
+
+	seq := &fakeSequencer{}
+	entries := []scheduler.LogEntry{}
+
+	done := runAsync(context.Background(), clock, plan, seq, func(e scheduler.LogEntry) { entries = append(entries, e) })
+
+	// The end of the first slot, the start of the second, and the end of the second.
+	for _, d := range []time.Duration{50 * time.Minute, 10 * time.Minute, time.Hour} {
+		testutil.WaitFor(t, func() bool { return clock.Pending() == 1 })
+		clock.Advance(d)
+	}
+
+	res := <-done
+	require.NoError(t, res.err)
+
+	log := res.log
+	assert.Equal(t, log, entries)
+	require.Len(t, log, 3)
+
+	assert.Equal(t, scheduler.StatusSkipped, log[0].Status)
+	assert.Equal(t, scheduler.StatusCompleted, log[1].Status)
+	assert.Equal(t, scheduler.StatusCompleted, log[2].Status)
+
+	assert.Equal(t, now, log[1].Start)
+	assert.Equal(t, now.Add(50*time.Minute), log[1].End)
+
+	// The second slot waits for its start time.
+	assert.Equal(t, now.Add(time.Hour), log[2].Start)
+	assert.Equal(t, now.Add(2*time.Hour), log[2].End)
+	assert.Equal(t, []string{"first", "second"}, seq.observed)
+}
+
+func Test_Run_Late(t *testing.T) {
+	now := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+	clock := indiclient.NewFakeClock(now)
+
+	plan := scheduler.Plan{Slots: []scheduler.Slot{
+		{Target: scheduler.Target{Name: "a"}, Window: scheduler.Window{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)}},
+	}}
+
+	done := runAsync(context.Background(), clock, plan, &fakeSequencer{}, nil)
+
+	// The clock jumps past the whole slot while Run waits for it to start.
+	testutil.WaitFor(t, func() bool { return clock.Pending() == 1 })
+	clock.Advance(3 * time.Hour)
+
+	res := <-done
+	require.NoError(t, res.err)
+	require.Len(t, res.log, 1)
+	assert.Equal(t, scheduler.StatusSkipped, res.log[0].Status)
+}
+
+func Test_Run_Failed(t *testing.T) {
+	now := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+
+	plan := scheduler.Plan{Slots: []scheduler.Slot{
+		{Target: scheduler.Target{Name: "a"}, Window: scheduler.Window{Start: now, End: now.Add(time.Second)}},
+	}}
+
+	log, err := scheduler.Run(context.Background(), indiclient.NewFakeClock(now), plan, &fakeSequencer{err: errors.New("camera on fire")}, nil)
+	require.NoError(t, err)
+
+	require.Len(t, log, 1)
+	assert.Equal(t, scheduler.StatusFailed, log[0].Status)
+	assert.Equal(t, "camera on fire", log[0].Error)
+}
+
+func Test_Run_Cancel(t *testing.T) {
+	now := time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+	clock := indiclient.NewFakeClock(now)
+
+	plan := scheduler.Plan{Slots: []scheduler.Slot{
+		{Target: scheduler.Target{Name: "a"}, Window: scheduler.Window{Start: now, End: now.Add(time.Hour)}},
+		{Target: scheduler.Target{Name: "b"}, Window: scheduler.Window{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)}},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := runAsync(ctx, clock, plan, &fakeSequencer{}, nil)
+
+	testutil.WaitFor(t, func() bool { return clock.Pending() == 1 })
+	cancel()
+
+	res := <-done
+	assert.Equal(t, context.Canceled, res.err)
+
+	require.Len(t, res.log, 1)
+	assert.Equal(t, scheduler.StatusCancelled, res.log[0].Status)
+}
+
+func Test_ObservatorySequencer(t *testing.T) {
+	telescope := simulators.NewTelescope("Telescope Simulator")
+	telescope.SlewRate = 1000
+	ccd := simulators.NewCCD("CCD Simulator")
+	wheel := simulators.NewFilterWheel("Filter Simulator", "L", "R", "G", "B")
+
+	devices := []simulators.Device{telescope, ccd, wheel}
+
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	c := indiclient.NewINDIClient(log, simulators.NewServer(devices...), afero.NewMemMapFs(), 100)
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+	require.NoError(t, c.GetProperties("", ""))
+
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == len(devices) })
+
+	for _, d := range devices {
+		err := c.SetSwitchValue(d.Name(), "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+		require.NoError(t, err)
+	}
+
+	testutil.WaitFor(t, func() bool {
+		return c.BlobPropertySet("CCD Simulator", "CCD1") && c.NumberPropertySet("Telescope Simulator", "EQUATORIAL_EOD_COORD") &&
+			c.TextPropertySet("Filter Simulator", "FILTER_NAME")
+	})
+
+	o, err := observatory.New(log, c, observatory.Config{
+		Telescope:   "Telescope Simulator",
+		Camera:      "CCD Simulator",
+		FilterWheel: "Filter Simulator",
+	})
+	require.NoError(t, err)
+	defer o.Close()
+
+	frames := 0
+	seq := scheduler.ObservatorySequencer{
+		Observatory: o,
+		OnFrame:     func(scheduler.Target, indiclient.BlobEvent) { frames++ },
+	}
+
+	target := scheduler.Target{Name: "M42", RA: 5.588, Dec: -5.39, Exposure: 0.01, Filter: "G"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err = seq.Observe(ctx, target)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	assert.True(t, frames > 0)
+	assert.Equal(t, "G", wheel.Filter())
+
+	ra, dec, err := o.Telescope.Coordinates()
+	require.NoError(t, err)
+
+	wantRA, wantDec := astro.ToJNow(target.RA, target.Dec, time.Now())
+	assert.InDelta(t, wantRA, ra, 1e-4)
+	assert.InDelta(t, wantDec, dec, 1e-3)
+}
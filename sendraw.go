@@ -0,0 +1,153 @@
+package indiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrRawRoot is returned by SendRaw when the XML is not a single element.
+	ErrRawRoot = errors.New("raw XML must be a single element")
+
+	// ErrRawElement is returned by SendRaw when the root element is not allowed. See SetRawElements.
+	ErrRawElement = errors.New("root element not allowed")
+)
+
+// DefaultRawElements are the root elements SendRaw allows until SetRawElements is called: the commands a client sends
+// in INDI 1.7.
+var DefaultRawElements = []string{
+	"getProperties", "enableBLOB", "newTextVector", "newNumberVector", "newSwitchVector", "newBLOBVector",
+}
+
+// RawCommand is XML sent by SendRaw. Outbound interceptors see it by value, like the other commands.
+type RawCommand struct {
+	XML []byte
+}
+
+// SetRawElements sets the root elements SendRaw allows, such as a vendor's own commands. nil restores
+// DefaultRawElements.
+func (c *INDIClient) SetRawElements(names []string) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	if names == nil {
+		c.rawElements = nil
+		return
+	}
+
+	c.rawElements = append([]string{}, names...)
+}
+
+// RawElements returns the root elements SendRaw allows.
+func (c *INDIClient) RawElements() []string {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	if c.rawElements == nil {
+		return append([]string{}, DefaultRawElements...)
+	}
+
+	return append([]string{}, c.rawElements...)
+}
+
+// SendRaw sends b to indiserver as is, for vendor specific or experimental extensions of INDI that the client does
+// not support. b must be a single well formed element, whose name is allowed by SetRawElements. Elements with device
+// and name attributes, such as new*Vector, are checked against the access policy too.
+//
+// Unlike the Set*Value methods, SendRaw does not mark properties busy, or wait for the driver to answer. In dry-run
+// mode it returns a *DryRunError instead of sending b.
+func (c *INDIClient) SendRaw(b []byte) error {
+	start, err := checkRawXML(b)
+	if err != nil {
+		return err
+	}
+
+	if !containsString(c.RawElements(), start.Name.Local) {
+		return &ValidationError{Element: start.Name.Local, Field: "element", Err: ErrRawElement}
+	}
+
+	deviceName, propName := attr(start, "device"), attr(start, "name")
+
+	c.rwm.RLock()
+	dryRun := c.dryRun
+	if len(deviceName) > 0 && len(propName) > 0 {
+		err = c.checkAccess(deviceName, propName)
+	}
+	c.rwm.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		return c.dryRunSend(RawCommand{XML: append([]byte(nil), b...)})
+	}
+
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+
+	_, span := c.startSpan(context.Background(), "SendRaw", map[string]string{SpanAttrDevice: deviceName, SpanAttrProperty: propName})
+	c.sendCommand(RawCommand{XML: append([]byte(nil), b...)})
+	span.End()
+
+	return nil
+}
+
+// checkRawXML returns the root element of b, or an error if b is not a single well formed element.
+func checkRawXML(b []byte) (xml.StartElement, error) {
+	var root xml.StartElement
+
+	d := xml.NewDecoder(bytes.NewReader(b))
+	depth := 0
+	roots := 0
+
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return root, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				root = t.Copy()
+				roots++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 && len(strings.TrimSpace(string(t))) > 0 {
+				return root, ErrRawRoot
+			}
+		case xml.ProcInst, xml.Directive:
+			if depth == 0 {
+				return root, ErrRawRoot
+			}
+		}
+	}
+
+	if roots != 1 {
+		return root, ErrRawRoot
+	}
+
+	return root, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,76 @@
+package indiclient
+
+import (
+	"encoding/xml"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SendRaw(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+
+	raw := `<newNumberVector device="Mount" name="EQUATORIAL_EOD_COORD"><oneNumber name="RA">5</oneNumber></newNumberVector>`
+
+	assert.Equal(t, ErrNotConnected, c.SendRaw([]byte(raw)))
+
+	conn, other := net.Pipe()
+	defer other.Close()
+
+	c.session = newSession(conn, 10)
+	c.write = make(chan interface{}, 10)
+
+	require.NoError(t, c.SendRaw([]byte(raw)))
+	require.Len(t, c.write, 1)
+	assert.Equal(t, RawCommand{XML: []byte(raw)}, <-c.write)
+
+	// Nothing is marked busy.
+	prop, err := c.GetNumberProperty("Mount", "EQUATORIAL_EOD_COORD")
+	require.NoError(t, err)
+	assert.Equal(t, PropertyStateIdle, prop.State)
+
+	// Malformed XML.
+	var syntax *xml.SyntaxError
+	assert.True(t, errors.As(c.SendRaw([]byte(`<newNumberVector device="Mount">`)), &syntax))
+
+	// More or less than one element.
+	assert.Equal(t, ErrRawRoot, c.SendRaw([]byte(`<getProperties version="1.7"/><getProperties version="1.7"/>`)))
+	assert.Equal(t, ErrRawRoot, c.SendRaw([]byte(`getProperties`)))
+	assert.Equal(t, ErrRawRoot, c.SendRaw([]byte(` `)))
+
+	// Only allowed elements.
+	err = c.SendRaw([]byte(`<pingRequest uid="1"/>`))
+	require.IsType(t, &ValidationError{}, err)
+	assert.Equal(t, "pingRequest", err.(*ValidationError).Element)
+	assert.True(t, errors.Is(err, ErrRawElement))
+
+	c.SetRawElements(append(DefaultRawElements, "pingRequest"))
+	require.NoError(t, c.SendRaw([]byte(`<pingRequest uid="1"/>`)))
+	assert.Equal(t, RawCommand{XML: []byte(`<pingRequest uid="1"/>`)}, <-c.write)
+
+	c.SetRawElements([]string{})
+	assert.Empty(t, c.RawElements())
+	assert.True(t, errors.Is(c.SendRaw([]byte(raw)), ErrRawElement))
+
+	c.SetRawElements(nil)
+	assert.Equal(t, DefaultRawElements, c.RawElements())
+
+	// The access policy applies.
+	c.SetAccessPolicy(AccessPolicy{Deny: []AccessRule{{Device: "Mount", Property: "EQUATORIAL_EOD_COORD"}}})
+	assert.Equal(t, ErrForbidden, c.SendRaw([]byte(raw)))
+	require.NoError(t, c.SendRaw([]byte(`<getProperties version="1.7" device="Mount"/>`)))
+	<-c.write
+
+	c.SetAccessPolicy(AccessPolicy{})
+
+	// As does dry run.
+	c.SetDryRun(true)
+	err = c.SendRaw([]byte(raw))
+	require.IsType(t, &DryRunError{}, err)
+	assert.Equal(t, raw, err.(*DryRunError).XML)
+	assert.Len(t, c.write, 0)
+}
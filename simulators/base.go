@@ -0,0 +1,325 @@
+package simulators
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/goastro/indiclient"
+)
+
+// base implements the parts common to every simulated device: the CONNECTION property, property storage, and
+// sending updates to the server. Property values are stored in their def*Vector form, so they can be returned
+// directly by Properties.
+type base struct {
+	mu         sync.Mutex
+	name       string
+	server     *Server
+	connected  bool
+	connection *indiclient.DefSwitchVector
+	props      []interface{}
+}
+
+func newBase(name string) base {
+	return base{
+		name: name,
+		connection: &indiclient.DefSwitchVector{
+			Device: name,
+			Name:   "CONNECTION",
+			Label:  "Connection",
+			Group:  "Main Control",
+			State:  indiclient.PropertyStateIdle,
+			Perm:   indiclient.PropertyPermissionReadWrite,
+			Rule:   indiclient.SwitchRuleOneOfMany,
+			Switches: []indiclient.DefSwitch{
+				{Name: "CONNECT", Label: "Connect", Value: indiclient.SwitchStateOff},
+				{Name: "DISCONNECT", Label: "Disconnect", Value: indiclient.SwitchStateOn},
+			},
+		},
+	}
+}
+
+// Name returns the INDI device name.
+func (b *base) Name() string {
+	return b.name
+}
+
+// Attach is called by NewServer so the device can send updates to connected clients.
+func (b *base) Attach(s *Server) {
+	b.server = s
+}
+
+// Properties returns copies of the def*Vector elements describing the current properties of the device.
+func (b *base) Properties() []interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	props := []interface{}{snapshot(b.connection)}
+
+	if b.connected {
+		for _, p := range b.props {
+			props = append(props, snapshot(p))
+		}
+	}
+
+	return props
+}
+
+// Connected returns true if a client has connected the device.
+func (b *base) Connected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.connected
+}
+
+// handleConnection processes commands for the CONNECTION property, and returns true if cmd was one. Only call when
+// b.mu is locked.
+func (b *base) handleConnection(cmd interface{}) bool {
+	item, ok := cmd.(*indiclient.NewSwitchVector)
+	if !ok || item.Name != "CONNECTION" {
+		return false
+	}
+
+	applySwitches(b.connection, item)
+
+	connect := switchOn(b.connection, "CONNECT")
+	if connect != b.connected {
+		b.connected = connect
+
+		for _, p := range b.props {
+			if connect {
+				b.send(p)
+			} else {
+				b.send(&indiclient.DelProperty{
+					Device:    b.name,
+					Name:      propertyName(p),
+					Timestamp: timestamp(),
+				})
+			}
+		}
+	}
+
+	b.connection.State = indiclient.PropertyStateOk
+	b.sendSwitch(b.connection, "")
+
+	return true
+}
+
+// send delivers item to all clients connected to the server.
+func (b *base) send(item interface{}) {
+	if b.server != nil {
+		b.server.Send(b.name, item)
+	}
+}
+
+// message sends a message element for the device.
+func (b *base) message(format string, args ...interface{}) {
+	b.send(&indiclient.Message{
+		Device:    b.name,
+		Timestamp: timestamp(),
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+func (b *base) sendNumber(v *indiclient.DefNumberVector, message string) {
+	item := &indiclient.SetNumberVector{
+		Device:    v.Device,
+		Name:      v.Name,
+		State:     v.State,
+		Timeout:   v.Timeout,
+		Timestamp: timestamp(),
+		Message:   message,
+	}
+
+	for _, n := range v.Numbers {
+		item.Numbers = append(item.Numbers, indiclient.OneNumber{Name: n.Name, Value: n.Value})
+	}
+
+	b.send(item)
+}
+
+func (b *base) sendSwitch(v *indiclient.DefSwitchVector, message string) {
+	item := &indiclient.SetSwitchVector{
+		Device:    v.Device,
+		Name:      v.Name,
+		State:     v.State,
+		Timeout:   v.Timeout,
+		Timestamp: timestamp(),
+		Message:   message,
+	}
+
+	for _, s := range v.Switches {
+		item.Switches = append(item.Switches, indiclient.OneSwitch{Name: s.Name, Value: s.Value})
+	}
+
+	b.send(item)
+}
+
+func (b *base) sendText(v *indiclient.DefTextVector, message string) {
+	item := &indiclient.SetTextVector{
+		Device:    v.Device,
+		Name:      v.Name,
+		State:     v.State,
+		Timeout:   v.Timeout,
+		Timestamp: timestamp(),
+		Message:   message,
+	}
+
+	for _, t := range v.Texts {
+		item.Texts = append(item.Texts, indiclient.OneText{Name: t.Name, Value: t.Value})
+	}
+
+	b.send(item)
+}
+
+func (b *base) sendLight(v *indiclient.DefLightVector, message string) {
+	item := &indiclient.SetLightVector{
+		Device:    v.Device,
+		Name:      v.Name,
+		State:     v.State,
+		Timestamp: timestamp(),
+		Message:   message,
+	}
+
+	for _, l := range v.Lights {
+		item.Lights = append(item.Lights, indiclient.OneLight{Name: l.Name, Value: l.Value})
+	}
+
+	b.send(item)
+}
+
+// snapshot returns a copy of the def*Vector p that the device's later changes do not affect. Only call when b.mu is
+// locked.
+func snapshot(p interface{}) interface{} {
+	switch v := p.(type) {
+	case *indiclient.DefTextVector:
+		c := *v
+		c.Texts = append([]indiclient.DefText(nil), v.Texts...)
+		return &c
+	case *indiclient.DefNumberVector:
+		c := *v
+		c.Numbers = append([]indiclient.DefNumber(nil), v.Numbers...)
+		return &c
+	case *indiclient.DefSwitchVector:
+		c := *v
+		c.Switches = append([]indiclient.DefSwitch(nil), v.Switches...)
+		return &c
+	case *indiclient.DefLightVector:
+		c := *v
+		c.Lights = append([]indiclient.DefLight(nil), v.Lights...)
+		return &c
+	case *indiclient.DefBlobVector:
+		c := *v
+		c.Blobs = append([]indiclient.DefBlob(nil), v.Blobs...)
+		return &c
+	}
+
+	return p
+}
+
+func propertyName(p interface{}) string {
+	switch v := p.(type) {
+	case *indiclient.DefTextVector:
+		return v.Name
+	case *indiclient.DefNumberVector:
+		return v.Name
+	case *indiclient.DefSwitchVector:
+		return v.Name
+	case *indiclient.DefLightVector:
+		return v.Name
+	case *indiclient.DefBlobVector:
+		return v.Name
+	}
+
+	return ""
+}
+
+func number(v *indiclient.DefNumberVector, name string) float64 {
+	for _, n := range v.Numbers {
+		if n.Name == name {
+			f, _ := indiclient.ParseNumber(n.Value)
+			return f
+		}
+	}
+
+	return 0
+}
+
+func setNumber(v *indiclient.DefNumberVector, name string, value float64) {
+	for i, n := range v.Numbers {
+		if n.Name == name {
+			v.Numbers[i].Value = strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+}
+
+// applyNumbers copies the values in cmd to v, clamped to each element's min and max. Values may be sexagesimal.
+func applyNumbers(v *indiclient.DefNumberVector, cmd *indiclient.NewNumberVector) {
+	for _, one := range cmd.Numbers {
+		for i, n := range v.Numbers {
+			if n.Name != one.Name {
+				continue
+			}
+
+			f, err := indiclient.ParseNumber(one.Value)
+			if err != nil {
+				continue
+			}
+
+			min, errMin := strconv.ParseFloat(n.Min, 64)
+			max, errMax := strconv.ParseFloat(n.Max, 64)
+			if errMin == nil && errMax == nil && min < max {
+				if f < min {
+					f = min
+				}
+				if f > max {
+					f = max
+				}
+			}
+
+			v.Numbers[i].Value = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	}
+}
+
+func switchOn(v *indiclient.DefSwitchVector, name string) bool {
+	for _, s := range v.Switches {
+		if s.Name == name {
+			return indiclient.SwitchState(trim(string(s.Value))) == indiclient.SwitchStateOn
+		}
+	}
+
+	return false
+}
+
+// applySwitches copies the values in cmd to v, enforcing the vector's rule.
+func applySwitches(v *indiclient.DefSwitchVector, cmd *indiclient.NewSwitchVector) {
+	for _, one := range cmd.Switches {
+		value := indiclient.SwitchState(trim(string(one.Value)))
+
+		for i, s := range v.Switches {
+			if s.Name == one.Name {
+				v.Switches[i].Value = value
+			} else if value == indiclient.SwitchStateOn && v.Rule != indiclient.SwitchRuleAnyOfMany {
+				v.Switches[i].Value = indiclient.SwitchStateOff
+			}
+		}
+	}
+}
+
+// selected returns the name of the first switch in v that is on.
+func selected(v *indiclient.DefSwitchVector) string {
+	for _, s := range v.Switches {
+		if indiclient.SwitchState(trim(string(s.Value))) == indiclient.SwitchStateOn {
+			return s.Name
+		}
+	}
+
+	return ""
+}
+
+func trim(s string) string {
+	return strings.TrimSpace(s)
+}
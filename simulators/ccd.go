@@ -0,0 +1,385 @@
+package simulators
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// CCD is a simulated camera. Exposures produce synthetic FITS star fields delivered on the CCD1 BLOB property. If
+// Focuser is set, stars are defocused in proportion to its distance from BestFocus, so autofocus routines can be
+// tested against it.
+type CCD struct {
+	base
+
+	// Width and Height are the sensor dimensions in pixels.
+	Width, Height int
+	// Focuser, if set, controls how sharp the stars are.
+	Focuser *Focuser
+	// BestFocus is the Focuser position that gives the sharpest stars.
+	BestFocus float64
+	// FocusScale is the number of focuser steps away from BestFocus that doubles the star size.
+	FocusScale float64
+	// CoolingRate is how fast the sensor temperature changes, in degrees Celsius per second.
+	CoolingRate float64
+	// Ambient is the temperature of the sensor when the cooler is off, in degrees Celsius.
+	Ambient float64
+	// FrameInterval is the time between frames while CCD_VIDEO_STREAM is on.
+	FrameInterval time.Duration
+
+	exposure    *indiclient.DefNumberVector
+	abort       *indiclient.DefSwitchVector
+	frameType   *indiclient.DefSwitchVector
+	info        *indiclient.DefNumberVector
+	temperature *indiclient.DefNumberVector
+	coolerPower *indiclient.DefNumberVector
+	blob        *indiclient.DefBlobVector
+	video       *indiclient.DefSwitchVector
+
+	stars    []Star
+	rnd      *rand.Rand
+	timer    *time.Timer
+	cooler   chan struct{}
+	streamer chan struct{}
+}
+
+// NewCCD creates a simulated camera named name with a 320x240 sensor.
+func NewCCD(name string) *CCD {
+	c := &CCD{
+		base:          newBase(name),
+		Width:         320,
+		Height:        240,
+		BestFocus:     50000,
+		FocusScale:    2000,
+		CoolingRate:   2,
+		Ambient:       20,
+		FrameInterval: 50 * time.Millisecond,
+		rnd:           rand.New(rand.NewSource(1)),
+	}
+
+	c.exposure = &indiclient.DefNumberVector{
+		Device: name, Name: "CCD_EXPOSURE", Label: "Expose", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Timeout: 60,
+		Numbers: []indiclient.DefNumber{
+			{Name: "CCD_EXPOSURE_VALUE", Label: "Duration (s)", Format: "%5.2f", Min: "0", Max: "3600", Step: "1", Value: "1"},
+		},
+	}
+
+	c.abort = &indiclient.DefSwitchVector{
+		Device: name, Name: "CCD_ABORT_EXPOSURE", Label: "Abort", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Rule: indiclient.SwitchRuleAtMostOne,
+		Switches: []indiclient.DefSwitch{
+			{Name: "ABORT", Label: "Abort", Value: indiclient.SwitchStateOff},
+		},
+	}
+
+	c.frameType = &indiclient.DefSwitchVector{
+		Device: name, Name: "CCD_FRAME_TYPE", Label: "Type", Group: "Image Settings",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Rule: indiclient.SwitchRuleOneOfMany,
+		Switches: []indiclient.DefSwitch{
+			{Name: "FRAME_LIGHT", Label: "Light", Value: indiclient.SwitchStateOn},
+			{Name: "FRAME_BIAS", Label: "Bias", Value: indiclient.SwitchStateOff},
+			{Name: "FRAME_DARK", Label: "Dark", Value: indiclient.SwitchStateOff},
+			{Name: "FRAME_FLAT", Label: "Flat", Value: indiclient.SwitchStateOff},
+		},
+	}
+
+	c.info = &indiclient.DefNumberVector{
+		Device: name, Name: "CCD_INFO", Label: "CCD Information", Group: "Image Info",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadOnly,
+		Numbers: []indiclient.DefNumber{
+			{Name: "CCD_MAX_X", Label: "Max. Width", Format: "%.f", Min: "1", Max: "16000", Value: "320"},
+			{Name: "CCD_MAX_Y", Label: "Max. Height", Format: "%.f", Min: "1", Max: "16000", Value: "240"},
+			{Name: "CCD_PIXEL_SIZE", Label: "Pixel size (um)", Format: "%.2f", Min: "1", Max: "40", Value: "5.2"},
+			{Name: "CCD_BITSPERPIXEL", Label: "Bits per pixel", Format: "%.f", Min: "8", Max: "64", Value: "16"},
+		},
+	}
+
+	c.temperature = &indiclient.DefNumberVector{
+		Device: name, Name: "CCD_TEMPERATURE", Label: "Temperature", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Timeout: 600,
+		Numbers: []indiclient.DefNumber{
+			{Name: "CCD_TEMPERATURE_VALUE", Label: "Temperature (C)", Format: "%5.2f", Min: "-50", Max: "50", Step: "0", Value: "20"},
+		},
+	}
+
+	c.coolerPower = &indiclient.DefNumberVector{
+		Device: name, Name: "CCD_COOLER_POWER", Label: "Cooling Power", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadOnly,
+		Numbers: []indiclient.DefNumber{
+			{Name: "CCD_COOLER_VALUE", Label: "Cooling Power (%)", Format: "%.1f", Min: "0", Max: "100", Step: "1", Value: "0"},
+		},
+	}
+
+	c.blob = &indiclient.DefBlobVector{
+		Device: name, Name: "CCD1", Label: "Image Data", Group: "Image Info",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadOnly,
+		Blobs: []indiclient.DefBlob{
+			{Name: "CCD1", Label: "Image"},
+		},
+	}
+
+	c.video = &indiclient.DefSwitchVector{
+		Device: name, Name: "CCD_VIDEO_STREAM", Label: "Video Stream", Group: "Streaming",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Rule: indiclient.SwitchRuleOneOfMany,
+		Switches: []indiclient.DefSwitch{
+			{Name: "STREAM_ON", Label: "Stream On", Value: indiclient.SwitchStateOff},
+			{Name: "STREAM_OFF", Label: "Stream Off", Value: indiclient.SwitchStateOn},
+		},
+	}
+
+	c.props = []interface{}{c.exposure, c.abort, c.frameType, c.info, c.temperature, c.coolerPower, c.blob, c.video}
+
+	return c
+}
+
+// Handle processes a new*Vector command sent by a client.
+func (c *CCD) Handle(cmd interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.handleConnection(cmd) || !c.connected {
+		return
+	}
+
+	switch item := cmd.(type) {
+	case *indiclient.NewNumberVector:
+		switch item.Name {
+		case "CCD_EXPOSURE":
+			c.expose(item)
+		case "CCD_TEMPERATURE":
+			c.cool(item)
+		}
+	case *indiclient.NewSwitchVector:
+		switch item.Name {
+		case "CCD_FRAME_TYPE":
+			applySwitches(c.frameType, item)
+			c.frameType.State = indiclient.PropertyStateOk
+			c.sendSwitch(c.frameType, "")
+		case "CCD_ABORT_EXPOSURE":
+			if c.timer != nil {
+				c.timer.Stop()
+				c.timer = nil
+			}
+			c.exposure.State = indiclient.PropertyStateAlert
+			c.sendNumber(c.exposure, "Exposure aborted.")
+			c.abort.State = indiclient.PropertyStateOk
+			c.sendSwitch(c.abort, "")
+		case "CCD_VIDEO_STREAM":
+			applySwitches(c.video, item)
+			c.stream(switchOn(c.video, "STREAM_ON"))
+			c.video.State = indiclient.PropertyStateOk
+			c.sendSwitch(c.video, "")
+		}
+	}
+}
+
+// stream starts or stops sending video frames. Frames are 8-bit raw star fields in the ".stream" format. Only call
+// when c.mu is locked.
+func (c *CCD) stream(on bool) {
+	if c.streamer != nil {
+		close(c.streamer)
+		c.streamer = nil
+	}
+
+	if !on {
+		return
+	}
+
+	stop := make(chan struct{})
+	c.streamer = stop
+
+	go func() {
+		ticker := time.NewTicker(c.FrameInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			sigma := c.sigma()
+
+			c.mu.Lock()
+
+			select {
+			case <-stop:
+				c.mu.Unlock()
+				return
+			default:
+			}
+
+			if len(c.stars) == 0 {
+				c.stars = RandomStars(c.rnd, 30, c.Width, c.Height)
+			}
+
+			pixels := SyntheticFrame(c.Width, c.Height, c.stars, sigma, c.rnd)
+
+			data := make([]byte, len(pixels))
+			for i, p := range pixels {
+				data[i] = byte(p >> 8)
+			}
+
+			c.send(&indiclient.SetBlobVector{
+				Device:    c.name,
+				Name:      c.blob.Name,
+				State:     indiclient.PropertyStateOk,
+				Timestamp: timestamp(),
+				Blobs: []indiclient.OneBlob{
+					{
+						Name:   "CCD1",
+						Size:   len(data),
+						Format: ".stream",
+						Value:  base64.StdEncoding.EncodeToString(data),
+					},
+				},
+			})
+
+			c.mu.Unlock()
+		}
+	}()
+}
+
+// Only call when c.mu is locked.
+func (c *CCD) expose(item *indiclient.NewNumberVector) {
+	if c.exposure.State == indiclient.PropertyStateBusy {
+		c.message("Exposure already in progress.")
+		return
+	}
+
+	applyNumbers(c.exposure, item)
+	duration := number(c.exposure, "CCD_EXPOSURE_VALUE")
+
+	c.exposure.State = indiclient.PropertyStateBusy
+	c.sendNumber(c.exposure, fmt.Sprintf("Taking a %g seconds frame...", duration))
+
+	c.timer = time.AfterFunc(time.Duration(duration*float64(time.Second)), func() {
+		sigma := c.sigma()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.timer == nil {
+			// Aborted.
+			return
+		}
+		c.timer = nil
+
+		frameType := selected(c.frameType)
+
+		stars := c.stars
+		if len(stars) == 0 {
+			stars = RandomStars(c.rnd, 30, c.Width, c.Height)
+			c.stars = stars
+		}
+
+		if frameType == "FRAME_BIAS" || frameType == "FRAME_DARK" {
+			stars = nil
+		}
+
+		pixels := SyntheticFrame(c.Width, c.Height, stars, sigma, c.rnd)
+		data := EncodeFITS(c.Width, c.Height, pixels,
+			Keyword{Name: "EXPTIME", Value: fmt.Sprintf("%g", duration), Comment: "Total Exposure Time (s)"},
+			Keyword{Name: "CCD-TEMP", Value: fmt.Sprintf("%g", number(c.temperature, "CCD_TEMPERATURE_VALUE")), Comment: "CCD Temperature (Celsius)"},
+			Keyword{Name: "IMAGETYP", Value: fmt.Sprintf("'%s'", frameType), Comment: "Frame type"},
+			Keyword{Name: "INSTRUME", Value: fmt.Sprintf("'%s'", c.name), Comment: "CCD Name"},
+		)
+
+		c.blob.State = indiclient.PropertyStateOk
+		c.send(&indiclient.SetBlobVector{
+			Device:    c.name,
+			Name:      c.blob.Name,
+			State:     indiclient.PropertyStateOk,
+			Timestamp: timestamp(),
+			Blobs: []indiclient.OneBlob{
+				{
+					Name:   "CCD1",
+					Size:   len(data),
+					Format: ".fits",
+					Value:  base64.StdEncoding.EncodeToString(data),
+				},
+			},
+		})
+
+		setNumber(c.exposure, "CCD_EXPOSURE_VALUE", 0)
+		c.exposure.State = indiclient.PropertyStateOk
+		c.sendNumber(c.exposure, "Exposure done, downloading image...")
+	})
+}
+
+// sigma returns the star size in pixels for the current focuser position.
+func (c *CCD) sigma() float64 {
+	if c.Focuser == nil || c.FocusScale <= 0 {
+		return 1.5
+	}
+
+	return 1.5 * (1 + math.Abs(c.Focuser.Position()-c.BestFocus)/c.FocusScale)
+}
+
+// Only call when c.mu is locked.
+func (c *CCD) cool(item *indiclient.NewNumberVector) {
+	target := &indiclient.DefNumberVector{Numbers: []indiclient.DefNumber{
+		{Name: "CCD_TEMPERATURE_VALUE", Min: "-50", Max: "50"},
+	}}
+	applyNumbers(target, item)
+	setpoint := number(target, "CCD_TEMPERATURE_VALUE")
+
+	if c.cooler != nil {
+		close(c.cooler)
+	}
+
+	stop := make(chan struct{})
+	c.cooler = stop
+
+	c.temperature.State = indiclient.PropertyStateBusy
+	c.sendNumber(c.temperature, "")
+
+	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			c.mu.Lock()
+
+			select {
+			case <-stop:
+				c.mu.Unlock()
+				return
+			default:
+			}
+
+			temp := approach(number(c.temperature, "CCD_TEMPERATURE_VALUE"), setpoint, c.CoolingRate/10)
+			setNumber(c.temperature, "CCD_TEMPERATURE_VALUE", temp)
+
+			power := math.Max(0, math.Min(100, (c.Ambient-temp)*2))
+			setNumber(c.coolerPower, "CCD_COOLER_VALUE", power)
+			c.coolerPower.State = indiclient.PropertyStateOk
+			c.sendNumber(c.coolerPower, "")
+
+			done := temp == setpoint
+			if done {
+				c.cooler = nil
+				c.temperature.State = indiclient.PropertyStateOk
+			}
+
+			c.sendNumber(c.temperature, "")
+			c.mu.Unlock()
+
+			if done {
+				return
+			}
+		}
+	}()
+}
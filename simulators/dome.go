@@ -0,0 +1,112 @@
+package simulators
+
+import (
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// Dome is a simulated dome with a shutter. Opening or closing the shutter takes ShutterTime, and parking or unparking
+// takes ParkTime. Like many real domes, the shutter cannot be opened while the dome is parked.
+type Dome struct {
+	base
+
+	// ShutterTime is how long the shutter takes to open or close.
+	ShutterTime time.Duration
+	// ParkTime is how long the dome takes to park or unpark.
+	ParkTime time.Duration
+
+	shutter *indiclient.DefSwitchVector
+	park    *indiclient.DefSwitchVector
+}
+
+// NewDome creates a simulated dome named name, parked with the shutter closed.
+func NewDome(name string) *Dome {
+	d := &Dome{
+		base:        newBase(name),
+		ShutterTime: 50 * time.Millisecond,
+		ParkTime:    50 * time.Millisecond,
+	}
+
+	d.shutter = &indiclient.DefSwitchVector{
+		Device: name, Name: "DOME_SHUTTER", Label: "Shutter", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Rule: indiclient.SwitchRuleOneOfMany, Timeout: 60,
+		Switches: []indiclient.DefSwitch{
+			{Name: "SHUTTER_OPEN", Label: "Open", Value: indiclient.SwitchStateOff},
+			{Name: "SHUTTER_CLOSE", Label: "Close", Value: indiclient.SwitchStateOn},
+		},
+	}
+
+	d.park = &indiclient.DefSwitchVector{
+		Device: name, Name: "DOME_PARK", Label: "Parking", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Rule: indiclient.SwitchRuleOneOfMany, Timeout: 60,
+		Switches: []indiclient.DefSwitch{
+			{Name: "PARK", Label: "Park(ed)", Value: indiclient.SwitchStateOn},
+			{Name: "UNPARK", Label: "UnPark(ed)", Value: indiclient.SwitchStateOff},
+		},
+	}
+
+	d.props = []interface{}{d.shutter, d.park}
+
+	return d
+}
+
+// ShutterOpen returns true if the shutter is open.
+func (d *Dome) ShutterOpen() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return switchOn(d.shutter, "SHUTTER_OPEN") && d.shutter.State == indiclient.PropertyStateOk
+}
+
+// Parked returns true if the dome is parked.
+func (d *Dome) Parked() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return switchOn(d.park, "PARK")
+}
+
+// Handle processes a new*Vector command sent by a client.
+func (d *Dome) Handle(cmd interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.handleConnection(cmd) || !d.connected {
+		return
+	}
+
+	item, ok := cmd.(*indiclient.NewSwitchVector)
+	if !ok {
+		return
+	}
+
+	switch item.Name {
+	case "DOME_SHUTTER":
+		if switchOn(d.park, "PARK") {
+			d.shutter.State = indiclient.PropertyStateAlert
+			d.sendSwitch(d.shutter, "Dome is parked.")
+			return
+		}
+
+		d.move(d.shutter, item, d.ShutterTime, "Shutter operation complete.")
+	case "DOME_PARK":
+		d.move(d.park, item, d.ParkTime, "Dome parking operation complete.")
+	}
+}
+
+// move applies item to v, which is Busy for duration before becoming Ok. Only call when d.mu is locked.
+func (d *Dome) move(v *indiclient.DefSwitchVector, item *indiclient.NewSwitchVector, duration time.Duration, message string) {
+	applySwitches(v, item)
+
+	v.State = indiclient.PropertyStateBusy
+	d.sendSwitch(v, "")
+
+	time.AfterFunc(duration, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		v.State = indiclient.PropertyStateOk
+		d.sendSwitch(v, message)
+	})
+}
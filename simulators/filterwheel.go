@@ -0,0 +1,121 @@
+package simulators
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// FilterWheel is a simulated filter wheel. Changing FILTER_SLOT takes ChangeTime per slot moved.
+type FilterWheel struct {
+	base
+
+	// ChangeTime is how long it takes to move the wheel by one slot.
+	ChangeTime time.Duration
+
+	slot  *indiclient.DefNumberVector
+	names *indiclient.DefTextVector
+}
+
+// NewFilterWheel creates a simulated filter wheel named name holding filters, with the first filter selected.
+func NewFilterWheel(name string, filters ...string) *FilterWheel {
+	if len(filters) == 0 {
+		filters = []string{"Red", "Green", "Blue", "Luminance", "Ha"}
+	}
+
+	w := &FilterWheel{
+		base:       newBase(name),
+		ChangeTime: 20 * time.Millisecond,
+	}
+
+	w.slot = &indiclient.DefNumberVector{
+		Device: name, Name: "FILTER_SLOT", Label: "Filter Slot", Group: "Filter Wheel",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Timeout: 60,
+		Numbers: []indiclient.DefNumber{
+			{Name: "FILTER_SLOT_VALUE", Label: "Filter", Format: "%3.0f", Min: "1", Max: fmt.Sprint(len(filters)), Step: "1", Value: "1"},
+		},
+	}
+
+	w.names = &indiclient.DefTextVector{
+		Device: name, Name: "FILTER_NAME", Label: "Filter", Group: "Filter Wheel",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite,
+	}
+
+	for i, f := range filters {
+		w.names.Texts = append(w.names.Texts, indiclient.DefText{
+			Name:  fmt.Sprintf("FILTER_SLOT_NAME_%d", i+1),
+			Label: fmt.Sprintf("Filter#%d", i+1),
+			Value: f,
+		})
+	}
+
+	w.props = []interface{}{w.slot, w.names}
+
+	return w
+}
+
+// Filter returns the name of the currently selected filter.
+func (w *FilterWheel) Filter() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	slot := int(number(w.slot, "FILTER_SLOT_VALUE"))
+	if slot < 1 || slot > len(w.names.Texts) {
+		return ""
+	}
+
+	return w.names.Texts[slot-1].Value
+}
+
+// Handle processes a new*Vector command sent by a client.
+func (w *FilterWheel) Handle(cmd interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.handleConnection(cmd) || !w.connected {
+		return
+	}
+
+	switch item := cmd.(type) {
+	case *indiclient.NewNumberVector:
+		if item.Name != "FILTER_SLOT" {
+			return
+		}
+
+		from := number(w.slot, "FILTER_SLOT_VALUE")
+		applyNumbers(w.slot, item)
+		to := number(w.slot, "FILTER_SLOT_VALUE")
+
+		moves := to - from
+		if moves < 0 {
+			moves = -moves
+		}
+
+		w.slot.State = indiclient.PropertyStateBusy
+		w.sendNumber(w.slot, "")
+
+		time.AfterFunc(time.Duration(moves)*w.ChangeTime, func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+
+			w.slot.State = indiclient.PropertyStateOk
+			w.sendNumber(w.slot, "")
+		})
+	case *indiclient.NewTextVector:
+		if item.Name != "FILTER_NAME" {
+			return
+		}
+
+		for _, one := range item.Texts {
+			for i, text := range w.names.Texts {
+				if text.Name == one.Name {
+					w.names.Texts[i].Value = trim(one.Value)
+				}
+			}
+		}
+
+		w.names.State = indiclient.PropertyStateOk
+		w.sendText(w.names, "")
+	}
+}
@@ -0,0 +1,139 @@
+package simulators
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+const fitsBlockSize = 2880
+
+// Star is a point source rendered by SyntheticFrame.
+type Star struct {
+	// X and Y are the pixel coordinates of the center of the star.
+	X, Y float64
+	// Flux is the peak value of the star above the background.
+	Flux float64
+}
+
+// Keyword is a FITS header card. Value must already be formatted as FITS expects, so strings must be quoted.
+type Keyword struct {
+	Name    string
+	Value   string
+	Comment string
+}
+
+// RandomStars creates n stars at random positions within a width x height frame.
+func RandomStars(rnd *rand.Rand, n, width, height int) []Star {
+	stars := make([]Star, n)
+
+	for i := range stars {
+		stars[i] = Star{
+			X:    8 + rnd.Float64()*float64(width-16),
+			Y:    8 + rnd.Float64()*float64(height-16),
+			Flux: 2000 + rnd.Float64()*30000,
+		}
+	}
+
+	return stars
+}
+
+// SyntheticFrame renders stars as Gaussian profiles with the given sigma (in pixels) on a background of 1000 ADU
+// with Gaussian read noise. If rnd is nil the frame has no noise.
+func SyntheticFrame(width, height int, stars []Star, sigma float64, rnd *rand.Rand) []uint16 {
+	pixels := make([]float64, width*height)
+
+	for i := range pixels {
+		pixels[i] = 1000
+		if rnd != nil {
+			pixels[i] += rnd.NormFloat64() * 10
+		}
+	}
+
+	if sigma <= 0 {
+		sigma = 0.5
+	}
+
+	radius := int(math.Ceil(sigma * 5))
+	twoSigma2 := 2 * sigma * sigma
+
+	for _, s := range stars {
+		cx, cy := int(s.X), int(s.Y)
+
+		for y := cy - radius; y <= cy+radius; y++ {
+			if y < 0 || y >= height {
+				continue
+			}
+
+			for x := cx - radius; x <= cx+radius; x++ {
+				if x < 0 || x >= width {
+					continue
+				}
+
+				dx := float64(x) - s.X
+				dy := float64(y) - s.Y
+
+				pixels[y*width+x] += s.Flux * math.Exp(-(dx*dx+dy*dy)/twoSigma2)
+			}
+		}
+	}
+
+	frame := make([]uint16, len(pixels))
+
+	for i, p := range pixels {
+		frame[i] = uint16(math.Max(0, math.Min(65535, p)))
+	}
+
+	return frame
+}
+
+// EncodeFITS encodes a 16 bit monochrome image as a FITS file, adding keywords to the primary header.
+func EncodeFITS(width, height int, pixels []uint16, keywords ...Keyword) []byte {
+	buf := &bytes.Buffer{}
+
+	cards := []Keyword{
+		{Name: "SIMPLE", Value: "T", Comment: "file conforms to FITS standard"},
+		{Name: "BITPIX", Value: "16", Comment: "number of bits per data pixel"},
+		{Name: "NAXIS", Value: "2", Comment: "number of data axes"},
+		{Name: "NAXIS1", Value: fmt.Sprint(width), Comment: "length of data axis 1"},
+		{Name: "NAXIS2", Value: fmt.Sprint(height), Comment: "length of data axis 2"},
+		{Name: "BZERO", Value: "32768", Comment: "offset data range to that of unsigned short"},
+		{Name: "BSCALE", Value: "1", Comment: "default scaling factor"},
+	}
+
+	for _, k := range append(cards, keywords...) {
+		buf.WriteString(fitsCard(k))
+	}
+
+	buf.WriteString(fmt.Sprintf("%-80s", "END"))
+	pad(buf, ' ')
+
+	for _, p := range pixels {
+		binary.Write(buf, binary.BigEndian, int16(int32(p)-32768))
+	}
+	pad(buf, 0)
+
+	return buf.Bytes()
+}
+
+func fitsCard(k Keyword) string {
+	card := fmt.Sprintf("%-8s= %20s", strings.ToUpper(k.Name), k.Value)
+	if len(k.Comment) > 0 {
+		card += " / " + k.Comment
+	}
+
+	if len(card) > 80 {
+		card = card[:80]
+	}
+
+	return fmt.Sprintf("%-80s", card)
+}
+
+func pad(buf *bytes.Buffer, b byte) {
+	for buf.Len()%fitsBlockSize != 0 {
+		buf.WriteByte(b)
+	}
+}
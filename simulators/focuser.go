@@ -0,0 +1,160 @@
+package simulators
+
+import (
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// Focuser is a simulated absolute focuser. Moves progress at Speed steps per second, sending an ABS_FOCUS_POSITION
+// update every UpdateInterval.
+type Focuser struct {
+	base
+
+	// Speed is the focuser speed in steps per second.
+	Speed float64
+	// UpdateInterval is how often the position is sent while moving.
+	UpdateInterval time.Duration
+
+	position *indiclient.DefNumberVector
+	max      *indiclient.DefNumberVector
+	abort    *indiclient.DefSwitchVector
+
+	stop chan struct{}
+}
+
+// NewFocuser creates a simulated focuser named name, positioned half way through its travel.
+func NewFocuser(name string) *Focuser {
+	f := &Focuser{
+		base:           newBase(name),
+		Speed:          5000,
+		UpdateInterval: 50 * time.Millisecond,
+	}
+
+	f.position = &indiclient.DefNumberVector{
+		Device: name, Name: "ABS_FOCUS_POSITION", Label: "Absolute Position", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Timeout: 60,
+		Numbers: []indiclient.DefNumber{
+			{Name: "FOCUS_ABSOLUTE_POSITION", Label: "Steps", Format: "%.f", Min: "0", Max: "100000", Step: "1000", Value: "50000"},
+		},
+	}
+
+	f.max = &indiclient.DefNumberVector{
+		Device: name, Name: "FOCUS_MAX", Label: "Max. Position", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite,
+		Numbers: []indiclient.DefNumber{
+			{Name: "FOCUS_MAX_VALUE", Label: "Steps", Format: "%.f", Min: "1000", Max: "1000000", Step: "1000", Value: "100000"},
+		},
+	}
+
+	f.abort = &indiclient.DefSwitchVector{
+		Device: name, Name: "FOCUS_ABORT_MOTION", Label: "Abort Motion", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Rule: indiclient.SwitchRuleAtMostOne,
+		Switches: []indiclient.DefSwitch{
+			{Name: "ABORT", Label: "Abort", Value: indiclient.SwitchStateOff},
+		},
+	}
+
+	f.props = []interface{}{f.position, f.max, f.abort}
+
+	return f
+}
+
+// Position returns the current focuser position.
+func (f *Focuser) Position() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return number(f.position, "FOCUS_ABSOLUTE_POSITION")
+}
+
+// Handle processes a new*Vector command sent by a client.
+func (f *Focuser) Handle(cmd interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.handleConnection(cmd) || !f.connected {
+		return
+	}
+
+	switch item := cmd.(type) {
+	case *indiclient.NewNumberVector:
+		switch item.Name {
+		case "ABS_FOCUS_POSITION":
+			target := &indiclient.DefNumberVector{Numbers: []indiclient.DefNumber{
+				{Name: "FOCUS_ABSOLUTE_POSITION", Min: "0", Max: f.max.Numbers[0].Value},
+			}}
+			applyNumbers(target, item)
+			f.move(number(target, "FOCUS_ABSOLUTE_POSITION"))
+		case "FOCUS_MAX":
+			applyNumbers(f.max, item)
+			f.position.Numbers[0].Max = f.max.Numbers[0].Value
+			f.max.State = indiclient.PropertyStateOk
+			f.sendNumber(f.max, "")
+		}
+	case *indiclient.NewSwitchVector:
+		if item.Name == "FOCUS_ABORT_MOTION" {
+			f.stopMove()
+			f.position.State = indiclient.PropertyStateIdle
+			f.sendNumber(f.position, "")
+			f.abort.State = indiclient.PropertyStateOk
+			f.sendSwitch(f.abort, "Focuser aborted.")
+		}
+	}
+}
+
+// Only call when f.mu is locked.
+func (f *Focuser) move(target float64) {
+	f.stopMove()
+
+	stop := make(chan struct{})
+	f.stop = stop
+
+	f.position.State = indiclient.PropertyStateBusy
+	f.sendNumber(f.position, "")
+
+	go func() {
+		ticker := time.NewTicker(f.UpdateInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			f.mu.Lock()
+
+			select {
+			case <-stop:
+				f.mu.Unlock()
+				return
+			default:
+			}
+
+			pos := approach(number(f.position, "FOCUS_ABSOLUTE_POSITION"), target, f.Speed*f.UpdateInterval.Seconds())
+			setNumber(f.position, "FOCUS_ABSOLUTE_POSITION", pos)
+
+			if pos == target {
+				f.stop = nil
+				f.position.State = indiclient.PropertyStateOk
+			}
+
+			f.sendNumber(f.position, "")
+			f.mu.Unlock()
+
+			if pos == target {
+				return
+			}
+		}
+	}()
+}
+
+// Only call when f.mu is locked.
+func (f *Focuser) stopMove() {
+	if f.stop != nil {
+		close(f.stop)
+		f.stop = nil
+	}
+}
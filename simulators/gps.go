@@ -0,0 +1,107 @@
+package simulators
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// GPS is a simulated GPS receiver. It reports a fixed location on GEOGRAPHIC_COORD, and the current time on TIME_UTC,
+// which is refreshed each time GPS_REFRESH is switched on.
+type GPS struct {
+	base
+
+	offset  float64
+	site    *indiclient.DefNumberVector
+	timeUTC *indiclient.DefTextVector
+	refresh *indiclient.DefSwitchVector
+}
+
+// NewGPS creates a simulated GPS receiver named name, located at lat and long (degrees east, 0 to 360) and elev
+// meters.
+func NewGPS(name string, lat, long, elev float64) *GPS {
+	g := &GPS{
+		base: newBase(name),
+	}
+
+	g.site = &indiclient.DefNumberVector{
+		Device: name, Name: "GEOGRAPHIC_COORD", Label: "Location", Group: "Site Management",
+		State: indiclient.PropertyStateOk, Perm: indiclient.PropertyPermissionReadOnly,
+		Numbers: []indiclient.DefNumber{
+			{Name: "LAT", Label: "Lat (dd:mm:ss)", Format: "%010.6m", Min: "-90", Max: "90", Step: "0"},
+			{Name: "LONG", Label: "Lon (dd:mm:ss)", Format: "%010.6m", Min: "0", Max: "360", Step: "0"},
+			{Name: "ELEV", Label: "Elevation (m)", Format: "%g", Min: "-200", Max: "10000", Step: "0"},
+		},
+	}
+
+	setNumber(g.site, "LAT", lat)
+	setNumber(g.site, "LONG", long)
+	setNumber(g.site, "ELEV", elev)
+
+	g.timeUTC = &indiclient.DefTextVector{
+		Device: name, Name: "TIME_UTC", Label: "UTC", Group: "Site Management",
+		State: indiclient.PropertyStateOk, Perm: indiclient.PropertyPermissionReadOnly,
+		Texts: []indiclient.DefText{
+			{Name: "UTC", Label: "UTC Time"},
+			{Name: "OFFSET", Label: "UTC Offset"},
+		},
+	}
+
+	g.refresh = &indiclient.DefSwitchVector{
+		Device: name, Name: "GPS_REFRESH", Label: "Refresh", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Rule: indiclient.SwitchRuleAtMostOne,
+		Switches: []indiclient.DefSwitch{
+			{Name: "REFRESH", Label: "GPS", Value: indiclient.SwitchStateOff},
+		},
+	}
+
+	g.updateTime()
+
+	g.props = []interface{}{g.site, g.timeUTC, g.refresh}
+
+	return g
+}
+
+// SetOffset sets the UTC offset of the site in hours, reported in the OFFSET element of TIME_UTC.
+func (g *GPS) SetOffset(hours float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.offset = hours
+	g.updateTime()
+}
+
+// Handle processes a new*Vector command sent by a client.
+func (g *GPS) Handle(cmd interface{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.handleConnection(cmd) || !g.connected {
+		return
+	}
+
+	item, ok := cmd.(*indiclient.NewSwitchVector)
+	if !ok || item.Name != "GPS_REFRESH" {
+		return
+	}
+
+	g.updateTime()
+	g.sendText(g.timeUTC, "")
+	g.sendNumber(g.site, "")
+
+	g.refresh.State = indiclient.PropertyStateOk
+	g.sendSwitch(g.refresh, "")
+}
+
+// Only call when g.mu is locked, or before the device is attached.
+func (g *GPS) updateTime() {
+	for i, t := range g.timeUTC.Texts {
+		switch t.Name {
+		case "UTC":
+			g.timeUTC.Texts[i].Value = time.Now().UTC().Format("2006-01-02T15:04:05")
+		case "OFFSET":
+			g.timeUTC.Texts[i].Value = fmt.Sprintf("%.2f", g.offset)
+		}
+	}
+}
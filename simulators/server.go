@@ -0,0 +1,294 @@
+// Package simulators provides an in-process INDI server with simulated devices, so applications and tests can exercise
+// indiclient end to end without real hardware or a running indiserver.
+//
+// A Server implements indiclient.Dialer, so it can be handed straight to indiclient.NewINDIClient:
+//
+//	server := simulators.NewServer(simulators.NewTelescope("Telescope Simulator"), simulators.NewCCD("CCD Simulator"))
+//	client := indiclient.NewINDIClient(log, server, fs, 10)
+//	err := client.Connect("tcp", "localhost:7624")
+//
+// Like real drivers, the simulated devices only define CONNECTION until a client connects them, after which the rest
+// of their properties are defined. Disconnecting deletes them again.
+package simulators
+
+import (
+	"encoding/xml"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// Device is a simulated INDI device that can be served by a Server.
+type Device interface {
+	// Name returns the INDI device name.
+	Name() string
+	// Attach is called by NewServer so the device can send updates to connected clients.
+	Attach(s *Server)
+	// Properties returns the def*Vector elements describing the current properties of the device.
+	Properties() []interface{}
+	// Handle processes a new*Vector command sent by a client.
+	Handle(cmd interface{})
+}
+
+// Server is an in-process INDI server. It implements indiclient.Dialer; each call to Dial creates a new client
+// connection, and the network and address are ignored.
+type Server struct {
+	mu      sync.Mutex
+	devices []Device
+	conns   map[*conn]bool
+}
+
+// NewServer creates a Server hosting the given devices.
+func NewServer(devices ...Device) *Server {
+	s := &Server{
+		devices: devices,
+		conns:   map[*conn]bool{},
+	}
+
+	for _, d := range devices {
+		d.Attach(s)
+	}
+
+	return s
+}
+
+// Dial creates a new connection to the server.
+func (s *Server) Dial(network, address string) (io.ReadWriteCloser, error) {
+	client, server := net.Pipe()
+
+	c := &conn{
+		server: s,
+		rw:     server,
+		blobs:  map[string]indiclient.BlobEnable{},
+	}
+	c.cond = sync.NewCond(&c.mu)
+
+	s.mu.Lock()
+	s.conns[c] = true
+	s.mu.Unlock()
+
+	go c.readLoop()
+	go c.writeLoop()
+
+	return client, nil
+}
+
+// Send delivers item to every connected client. item should be one of the set*Vector, def*Vector, message or
+// delProperty types from indiclient. setBLOBVector elements are only delivered to clients that enabled BLOBs for
+// device, and clients that asked for BLOBs only receive nothing else for device.
+//
+// item is marshalled before Send returns, so the caller may change it afterwards.
+func (s *Server) Send(device string, item interface{}) {
+	_, isBlob := item.(*indiclient.SetBlobVector)
+
+	b, err := xml.Marshal(item)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.conns {
+		c.send(device, b, isBlob)
+	}
+}
+
+func (s *Server) findDevice(name string) Device {
+	for _, d := range s.devices {
+		if d.Name() == name {
+			return d
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) remove(c *conn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
+
+// maxQueue is the number of elements that can be waiting for a client before it is disconnected.
+const maxQueue = 10000
+
+// conn is a single client connection to a Server. Outgoing elements are queued so that the devices never block on a
+// slow client.
+type conn struct {
+	server *Server
+	rw     io.ReadWriteCloser
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  [][]byte
+	closed bool
+	blobs  map[string]indiclient.BlobEnable
+}
+
+func (c *conn) send(device string, b []byte, isBlob bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	mode := c.blobs[device]
+	if len(mode) == 0 {
+		mode = c.blobs[""]
+	}
+
+	if isBlob && mode != indiclient.BlobEnableAlso && mode != indiclient.BlobEnableOnly {
+		return
+	}
+
+	if !isBlob && mode == indiclient.BlobEnableOnly {
+		return
+	}
+
+	if len(c.queue) >= maxQueue {
+		// The client has stopped reading, so disconnect it rather than queue without limit. close takes Server.mu,
+		// which our callers may hold, so it has to run on its own goroutine.
+		c.closed = true
+		c.queue = nil
+		c.cond.Signal()
+
+		go c.close()
+
+		return
+	}
+
+	c.queue = append(c.queue, b)
+	c.cond.Signal()
+}
+
+func (c *conn) close() {
+	c.mu.Lock()
+	c.closed = true
+	c.cond.Signal()
+	c.mu.Unlock()
+
+	c.server.remove(c)
+	c.rw.Close()
+}
+
+func (c *conn) writeLoop() {
+	for {
+		c.mu.Lock()
+		for len(c.queue) == 0 && !c.closed {
+			c.cond.Wait()
+		}
+
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+
+		b := c.queue[0]
+		c.queue = c.queue[1:]
+		c.mu.Unlock()
+
+		if _, err := c.rw.Write(b); err != nil {
+			c.close()
+			return
+		}
+	}
+}
+
+func (c *conn) readLoop() {
+	defer c.close()
+
+	decoder := xml.NewDecoder(c.rw)
+
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			return
+		}
+
+		se, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		var cmd interface{}
+
+		switch se.Name.Local {
+		case "getProperties":
+			cmd = &indiclient.GetProperties{}
+		case "enableBLOB":
+			cmd = &indiclient.EnableBlob{}
+		case "newTextVector":
+			cmd = &indiclient.NewTextVector{}
+		case "newNumberVector":
+			cmd = &indiclient.NewNumberVector{}
+		case "newSwitchVector":
+			cmd = &indiclient.NewSwitchVector{}
+		case "newBLOBVector":
+			cmd = &indiclient.NewBlobVector{}
+		default:
+			decoder.Skip()
+			continue
+		}
+
+		if err := decoder.DecodeElement(cmd, &se); err != nil {
+			continue
+		}
+
+		c.dispatch(cmd)
+	}
+}
+
+func (c *conn) dispatch(cmd interface{}) {
+	switch item := cmd.(type) {
+	case *indiclient.GetProperties:
+		c.getProperties(item)
+	case *indiclient.EnableBlob:
+		c.mu.Lock()
+		c.blobs[item.Device] = indiclient.BlobEnable(trim(string(item.Value)))
+		c.mu.Unlock()
+	case *indiclient.NewTextVector:
+		c.handle(item.Device, item)
+	case *indiclient.NewNumberVector:
+		c.handle(item.Device, item)
+	case *indiclient.NewSwitchVector:
+		c.handle(item.Device, item)
+	case *indiclient.NewBlobVector:
+		c.handle(item.Device, item)
+	}
+}
+
+func (c *conn) handle(device string, cmd interface{}) {
+	if d := c.server.findDevice(device); d != nil {
+		d.Handle(cmd)
+	}
+}
+
+func (c *conn) getProperties(item *indiclient.GetProperties) {
+	for _, d := range c.server.devices {
+		if len(item.Device) > 0 && item.Device != d.Name() {
+			continue
+		}
+
+		for _, p := range d.Properties() {
+			if len(item.Name) > 0 && item.Name != propertyName(p) {
+				continue
+			}
+
+			b, err := xml.Marshal(p)
+			if err != nil {
+				continue
+			}
+
+			c.send(d.Name(), b, false)
+		}
+	}
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05")
+}
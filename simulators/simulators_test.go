@@ -0,0 +1,553 @@
+package simulators_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+func connect(t *testing.T, devices ...simulators.Device) *indiclient.INDIClient {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	server := simulators.NewServer(devices...)
+
+	c := indiclient.NewINDIClient(log, server, afero.NewMemMapFs(), 100)
+
+	err := c.Connect("tcp", "localhost:7624")
+	require.NoError(t, err)
+
+	err = c.GetProperties("", "")
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return len(c.Devices()) == len(devices) })
+
+	for _, d := range devices {
+		err = c.SetSwitchValue(d.Name(), "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+		require.NoError(t, err)
+	}
+
+	return c
+}
+
+func Test_CCD_Exposure(t *testing.T) {
+	c := connect(t, simulators.NewCCD("CCD Simulator"))
+	defer c.Disconnect()
+
+	testutil.WaitFor(t, func() bool { return c.BlobPropertySet("CCD Simulator", "CCD1") })
+
+	err := c.EnableBlob("CCD Simulator", "", indiclient.BlobEnableAlso)
+	require.NoError(t, err)
+
+	err = c.SetNumberValue("CCD Simulator", "CCD_EXPOSURE", []string{"CCD_EXPOSURE_VALUE"}, []string{"0.1"})
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return c.BlobAvailable("CCD Simulator", "CCD1", "CCD1") })
+
+	rdr, fileName, length, err := c.GetBlob("CCD Simulator", "CCD1", "CCD1")
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	assert.Equal(t, "CCD Simulator_CCD1_CCD1.fits", fileName)
+	assert.Equal(t, int64(0), length%2880)
+
+	b, err := ioutil.ReadAll(rdr)
+	require.NoError(t, err)
+	assert.Equal(t, "SIMPLE  =", string(b[:9]))
+}
+
+func Test_Telescope_Slew(t *testing.T) {
+	c := connect(t, simulators.NewTelescope("Telescope Simulator"))
+	defer c.Disconnect()
+
+	testutil.WaitFor(t, func() bool { return c.NumberPropertySet("Telescope Simulator", "EQUATORIAL_EOD_COORD") })
+
+	err := c.SetNumberValue("Telescope Simulator", "EQUATORIAL_EOD_COORD", []string{"RA", "DEC"}, []string{"1", "80"})
+	require.NoError(t, err)
+
+	ra, err := c.GetNumber("Telescope Simulator", "EQUATORIAL_EOD_COORD", "RA")
+	require.NoError(t, err)
+	assert.Equal(t, "1", ra.Value)
+
+	dec, err := c.GetNumber("Telescope Simulator", "EQUATORIAL_EOD_COORD", "DEC")
+	require.NoError(t, err)
+	assert.Equal(t, "80", dec.Value)
+}
+
+func Test_Focuser_FilterWheel(t *testing.T) {
+	focuser := simulators.NewFocuser("Focuser Simulator")
+	wheel := simulators.NewFilterWheel("Filter Simulator", "L", "R", "G", "B")
+
+	c := connect(t, focuser, wheel)
+	defer c.Disconnect()
+
+	testutil.WaitFor(t, func() bool {
+		return c.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION") && c.NumberPropertySet("Filter Simulator", "FILTER_SLOT")
+	})
+
+	err := c.SetNumberValue("Focuser Simulator", "ABS_FOCUS_POSITION", []string{"FOCUS_ABSOLUTE_POSITION"}, []string{"50500"})
+	require.NoError(t, err)
+	assert.Equal(t, float64(50500), focuser.Position())
+
+	err = c.SetNumberValue("Filter Simulator", "FILTER_SLOT", []string{"FILTER_SLOT_VALUE"}, []string{"3"})
+	require.NoError(t, err)
+	assert.Equal(t, "G", wheel.Filter())
+}
+
+func Test_Dome(t *testing.T) {
+	dome := simulators.NewDome("Dome Simulator")
+
+	c := connect(t, dome)
+	defer c.Disconnect()
+
+	testutil.WaitFor(t, func() bool { return c.SwitchPropertySet("Dome Simulator", "DOME_SHUTTER") })
+
+	assert.True(t, dome.Parked())
+
+	err := c.SelectSwitch("Dome Simulator", "DOME_SHUTTER", "SHUTTER_OPEN")
+	assert.Error(t, err)
+	assert.False(t, dome.ShutterOpen())
+
+	err = c.SelectSwitch("Dome Simulator", "DOME_PARK", "UNPARK")
+	require.NoError(t, err)
+	assert.False(t, dome.Parked())
+
+	err = c.SelectSwitch("Dome Simulator", "DOME_SHUTTER", "SHUTTER_OPEN")
+	require.NoError(t, err)
+	assert.True(t, dome.ShutterOpen())
+}
+
+func Test_Disconnect_DeletesProperties(t *testing.T) {
+	c := connect(t, simulators.NewFocuser("Focuser Simulator"))
+	defer c.Disconnect()
+
+	testutil.WaitFor(t, func() bool { return c.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION") })
+
+	err := c.SetSwitchValue("Focuser Simulator", "CONNECTION", []string{"DISCONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return !c.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION") })
+}
+
+func Test_Properties_Copies(t *testing.T) {
+	f := simulators.NewFocuser("Focuser Simulator")
+
+	props := f.Properties()
+	require.Len(t, props, 1)
+
+	// Properties are marshalled after the device's lock is released, so changing them must not change the device.
+	conn := props[0].(*indiclient.DefSwitchVector)
+	conn.Switches[0].Value = indiclient.SwitchStateOn
+
+	assert.Equal(t, indiclient.SwitchStateOff, f.Properties()[0].(*indiclient.DefSwitchVector).Switches[0].Value)
+}
+
+func Test_EncodeFITS(t *testing.T) {
+	pixels := simulators.SyntheticFrame(10, 10, []simulators.Star{{X: 5, Y: 5, Flux: 1000}}, 1, nil)
+	assert.Equal(t, uint16(2000), pixels[55])
+
+	b := simulators.EncodeFITS(10, 10, pixels)
+	assert.Len(t, b, 2*2880)
+}
+
+func Test_SetSiteFromGPS(t *testing.T) {
+	gps := simulators.NewGPS("GPS Simulator", 51.4769, -0.0005, 46)
+	gps.SetOffset(-5)
+
+	c := connect(t, gps, simulators.NewTelescope("Telescope Simulator"))
+	defer c.Disconnect()
+
+	testutil.WaitFor(t, func() bool {
+		return c.NumberPropertySet("GPS Simulator", "GEOGRAPHIC_COORD") && c.TextPropertySet("Telescope Simulator", "TIME_UTC")
+	})
+
+	now := time.Now()
+
+	err := c.SetSiteFromGPS("GPS Simulator", "Telescope Simulator")
+	require.NoError(t, err)
+
+	site, err := c.GetSite("Telescope Simulator")
+	require.NoError(t, err)
+	assert.InDelta(t, 51.4769, site.Latitude, 1e-9)
+	assert.InDelta(t, 359.9995, site.Longitude, 1e-9)
+	assert.InDelta(t, 46, site.Elevation, 1e-9)
+
+	mountTime, err := c.GetTime("Telescope Simulator")
+	require.NoError(t, err)
+	assert.WithinDuration(t, now, mountTime, 2*time.Second)
+
+	_, offset := mountTime.Zone()
+	assert.Equal(t, -5*3600, offset)
+}
+
+func Test_SetNumber_Sexagesimal(t *testing.T) {
+	c := connect(t, simulators.NewTelescope("Telescope Simulator"))
+	defer c.Disconnect()
+
+	testutil.WaitFor(t, func() bool { return c.NumberPropertySet("Telescope Simulator", "GEOGRAPHIC_COORD") })
+
+	err := c.SetNumber("Telescope Simulator", "GEOGRAPHIC_COORD", map[string]float64{"LAT": -33.87, "LONG": 151.21})
+	require.NoError(t, err)
+
+	site, err := c.GetSite("Telescope Simulator")
+	require.NoError(t, err)
+	assert.InDelta(t, -33.87, site.Latitude, 1e-9)
+	assert.InDelta(t, 151.21, site.Longitude, 1e-9)
+}
+
+// repeaterDialer connects clients to a Repeater over an in-memory pipe.
+type repeaterDialer struct {
+	r *indiclient.Repeater
+}
+
+func (d repeaterDialer) Dial(network, address string) (io.ReadWriteCloser, error) {
+	client, server := net.Pipe()
+	d.r.ServeConn(server)
+
+	return client, nil
+}
+
+func Test_Repeater(t *testing.T) {
+	focuser := simulators.NewFocuser("Focuser Simulator")
+
+	upstream := connect(t, focuser, simulators.NewCCD("CCD Simulator"))
+	defer upstream.Disconnect()
+
+	testutil.WaitFor(t, func() bool {
+		return upstream.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION") && upstream.BlobPropertySet("CCD Simulator", "CCD1")
+	})
+
+	r, err := indiclient.NewRepeater(upstream)
+	require.NoError(t, err)
+	defer r.Close()
+
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	downstream := indiclient.NewINDIClient(log, repeaterDialer{r}, afero.NewMemMapFs(), 100)
+
+	require.NoError(t, downstream.Connect("tcp", "localhost:7624"))
+	defer downstream.Disconnect()
+
+	require.NoError(t, downstream.GetProperties("", ""))
+
+	testutil.WaitFor(t, func() bool {
+		return downstream.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION") && downstream.BlobPropertySet("CCD Simulator", "CCD1")
+	})
+
+	groups, err := downstream.GroupedProperties("Focuser Simulator")
+	require.NoError(t, err)
+	upstreamGroups, err := upstream.GroupedProperties("Focuser Simulator")
+	require.NoError(t, err)
+	assert.Equal(t, upstreamGroups, groups)
+
+	err = downstream.SetNumberValue("Focuser Simulator", "ABS_FOCUS_POSITION", []string{"FOCUS_ABSOLUTE_POSITION"}, []string{"42000"})
+	require.NoError(t, err)
+	assert.Equal(t, float64(42000), focuser.Position())
+
+	v, err := downstream.GetNumber("Focuser Simulator", "ABS_FOCUS_POSITION", "FOCUS_ABSOLUTE_POSITION")
+	require.NoError(t, err)
+	f, err := indiclient.ParseNumber(v.Value)
+	require.NoError(t, err)
+	assert.Equal(t, float64(42000), f)
+
+	require.NoError(t, downstream.EnableBlob("CCD Simulator", "", indiclient.BlobEnableAlso))
+
+	err = downstream.SetNumberValue("CCD Simulator", "CCD_EXPOSURE", []string{"CCD_EXPOSURE_VALUE"}, []string{"0.1"})
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return downstream.BlobAvailable("CCD Simulator", "CCD1", "CCD1") })
+
+	rdr, _, _, err := downstream.GetBlob("CCD Simulator", "CCD1", "CCD1")
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	b, err := ioutil.ReadAll(rdr)
+	require.NoError(t, err)
+	assert.Equal(t, "SIMPLE  =", string(b[:9]))
+}
+
+func Test_Repeater_Messages(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	server := simulators.NewServer(simulators.NewCCD("CCD Simulator"))
+
+	upstream := indiclient.NewINDIClient(log, server, afero.NewMemMapFs(), 100)
+	require.NoError(t, upstream.Connect("tcp", "localhost:7624"))
+	defer upstream.Disconnect()
+
+	require.NoError(t, upstream.GetProperties("", ""))
+
+	testutil.WaitFor(t, func() bool { return len(upstream.Devices()) == 1 })
+
+	err := upstream.SetSwitchValue("CCD Simulator", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return upstream.NumberPropertySet("CCD Simulator", "CCD_EXPOSURE") })
+
+	r, err := indiclient.NewRepeater(upstream)
+	require.NoError(t, err)
+	defer r.Close()
+
+	downstream := indiclient.NewINDIClient(log, repeaterDialer{r}, afero.NewMemMapFs(), 100)
+	require.NoError(t, downstream.Connect("tcp", "localhost:7624"))
+	defer downstream.Disconnect()
+
+	require.NoError(t, downstream.GetProperties("", ""))
+
+	testutil.WaitFor(t, func() bool { return downstream.NumberPropertySet("CCD Simulator", "CCD_EXPOSURE") })
+
+	// Raw connections show what the simulator and the repeater put on the wire.
+	serverWire, err := server.Dial("tcp", "localhost:7624")
+	require.NoError(t, err)
+	defer serverWire.Close()
+
+	repeaterWire, err := repeaterDialer{r}.Dial("tcp", "localhost:7624")
+	require.NoError(t, err)
+	defer repeaterWire.Close()
+
+	_, err = repeaterWire.Write([]byte(`<getProperties version="1.7" device="CCD Simulator" name="CCD_EXPOSURE"/>`))
+	require.NoError(t, err)
+	readUntil(t, repeaterWire.(net.Conn), "</defNumberVector>")
+
+	opts := indiclient.SubscribeOptions{Device: "CCD Simulator", Property: "CCD_EXPOSURE", Types: []indiclient.EventType{indiclient.EventTypeUpdate}}
+
+	events, id, err := downstream.Subscribe(opts)
+	require.NoError(t, err)
+	defer downstream.Unsubscribe(id)
+
+	err = downstream.SetNumberValue("CCD Simulator", "CCD_EXPOSURE", []string{"CCD_EXPOSURE_VALUE"}, []string{"0.1"})
+	require.NoError(t, err)
+
+	for _, wire := range []io.ReadWriteCloser{serverWire, repeaterWire} {
+		b := readUntil(t, wire.(net.Conn), "Taking a 0.1 seconds frame...")
+		assert.Contains(t, b, ` message="Taking a 0.1 seconds frame..."`)
+		assert.NotContains(t, b, "<message>")
+	}
+
+	testutil.WaitFor(t, func() bool {
+		select {
+		case e := <-events:
+			return e.Message == "Taking a 0.1 seconds frame..."
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	})
+}
+
+// readUntil reads from conn until want has been received, and returns everything read.
+func readUntil(t *testing.T, conn net.Conn, want string) string {
+	var b []byte
+	buf := make([]byte, 4096)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	for !strings.Contains(string(b), want) {
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		b = append(b, buf[:n]...)
+	}
+
+	return string(b)
+}
+
+func Test_SyncProperties(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	server := simulators.NewServer(simulators.NewFocuser("Focuser Simulator"), simulators.NewTelescope("Telescope Simulator"))
+
+	c := indiclient.NewINDIClient(log, server, afero.NewMemMapFs(), 100)
+
+	_, err := c.SyncProperties(context.Background(), 0)
+	assert.Equal(t, indiclient.ErrNotConnected, err)
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+
+	summaries := make(chan indiclient.SyncSummary, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			summary, err := c.SyncProperties(context.Background(), 50*time.Millisecond)
+			assert.NoError(t, err)
+			summaries <- summary
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		summary := <-summaries
+		assert.Equal(t, map[string][]string{
+			"Focuser Simulator":   {"CONNECTION"},
+			"Telescope Simulator": {"CONNECTION"},
+		}, summary.Devices)
+		assert.Equal(t, 2, summary.Properties)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = c.SyncProperties(ctx, time.Second)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func Test_SyncProperties_Clock(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	c := indiclient.NewINDIClient(log, simulators.NewServer(simulators.NewFocuser("Focuser Simulator")), afero.NewMemMapFs(), 100)
+
+	clock := indiclient.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	c.SetClock(clock)
+
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+
+	done := make(chan indiclient.SyncSummary, 1)
+	go func() {
+		summary, err := c.SyncProperties(context.Background(), time.Minute)
+		assert.NoError(t, err)
+		done <- summary
+	}()
+
+	// The settle time passes on the client's clock, a tenth at a time.
+	testutil.WaitFor(t, func() bool { return clock.Pending() == 1 && len(c.Devices()) == 1 })
+	for i := 0; i < 9; i++ {
+		clock.Advance(6 * time.Second)
+		testutil.WaitFor(t, func() bool { return clock.Pending() == 1 })
+	}
+
+	select {
+	case <-done:
+		t.Fatal("settled early")
+	default:
+	}
+
+	clock.Advance(6 * time.Second)
+
+	summary := <-done
+	assert.Equal(t, map[string][]string{"Focuser Simulator": {"CONNECTION"}}, summary.Devices)
+	assert.Equal(t, time.Minute, summary.Elapsed)
+}
+
+func Test_DeviceAlias(t *testing.T) {
+	focuser := simulators.NewFocuser("Focuser Simulator")
+
+	c := connect(t, focuser)
+	defer c.Disconnect()
+
+	testutil.WaitFor(t, func() bool { return c.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION") })
+
+	require.NoError(t, c.SetDeviceAlias("main-focuser", "Focuser Simulator"))
+	assert.Equal(t, []string{"main-focuser"}, c.Devices())
+
+	d, err := c.GetDevice("main-focuser")
+	require.NoError(t, err)
+	assert.Equal(t, "main-focuser", d.Name)
+
+	events, id, err := c.Subscribe(indiclient.SubscribeOptions{Device: "main-focuser", Property: "ABS_FOCUS_POSITION"})
+	require.NoError(t, err)
+	defer c.Unsubscribe(id)
+
+	err = c.SetNumberValue("main-focuser", "ABS_FOCUS_POSITION", []string{"FOCUS_ABSOLUTE_POSITION"}, []string{"51000"})
+	require.NoError(t, err)
+	assert.Equal(t, float64(51000), focuser.Position())
+
+	e := <-events
+	assert.Equal(t, "main-focuser", e.Device)
+
+	// The driver's name still works.
+	assert.True(t, c.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION"))
+
+	assert.Equal(t, map[string]string{"main-focuser": "Focuser Simulator"}, c.Profile().Aliases)
+
+	require.NoError(t, c.RemoveDeviceAlias("main-focuser"))
+	assert.Equal(t, []string{"Focuser Simulator"}, c.Devices())
+}
+
+func Test_VideoStream(t *testing.T) {
+	ccd := simulators.NewCCD("CCD Simulator")
+	ccd.FrameInterval = 10 * time.Millisecond
+
+	c := connect(t, ccd)
+	defer c.Disconnect()
+
+	testutil.WaitFor(t, func() bool { return c.BlobPropertySet("CCD Simulator", "CCD1") })
+	testutil.WaitFor(t, func() bool {
+		_, err := c.GetSwitchProperty("CCD Simulator", indiclient.VideoStreamProperty)
+		return err == nil
+	})
+
+	s, err := c.StartVideoStreamWithOptions("CCD Simulator", indiclient.VideoStreamOptions{Buffer: 2})
+	require.NoError(t, err)
+
+	var last uint64
+	for i := 0; i < 3; i++ {
+		select {
+		case f := <-s.Frames():
+			assert.True(t, f.Sequence > last)
+			last = f.Sequence
+			assert.Equal(t, ".stream", f.Format)
+			assert.Len(t, f.Data, 320*240)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for frame")
+		}
+	}
+
+	// Stop reading, so the buffer fills up and frames are dropped.
+	testutil.WaitFor(t, func() bool { return s.Stats().Dropped > 0 })
+
+	require.NoError(t, s.Stop())
+
+	stats := s.Stats()
+	assert.Equal(t, stats.Received, stats.Delivered+stats.Dropped)
+
+	for range s.Frames() {
+	}
+
+	prop, err := c.GetSwitchProperty("CCD Simulator", indiclient.VideoStreamProperty)
+	require.NoError(t, err)
+	assert.Equal(t, indiclient.SwitchStateOn, prop.Values[indiclient.VideoStreamOff].Value)
+}
+
+// flood asks for the properties over and over without reading the answers, until the other end hangs up.
+func flood(wire io.Writer) error {
+	for i := 0; i < 100000; i++ {
+		if _, err := io.WriteString(wire, `<getProperties version="1.7"/>`); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func Test_Server_SlowClient(t *testing.T) {
+	server := simulators.NewServer(simulators.NewCCD("CCD Simulator"))
+
+	wire, err := server.Dial("tcp", "localhost:7624")
+	require.NoError(t, err)
+	defer wire.Close()
+
+	assert.Error(t, flood(wire), "a client that never reads should be disconnected")
+}
+
+func Test_Repeater_SlowClient(t *testing.T) {
+	upstream := connect(t, simulators.NewCCD("CCD Simulator"))
+	defer upstream.Disconnect()
+
+	testutil.WaitFor(t, func() bool { return upstream.NumberPropertySet("CCD Simulator", "CCD_EXPOSURE") })
+
+	r, err := indiclient.NewRepeater(upstream)
+	require.NoError(t, err)
+	defer r.Close()
+
+	wire, err := repeaterDialer{r}.Dial("tcp", "localhost:7624")
+	require.NoError(t, err)
+	defer wire.Close()
+
+	assert.Error(t, flood(wire), "a client that never reads should be disconnected")
+}
@@ -0,0 +1,325 @@
+package simulators
+
+import (
+	"math"
+	"time"
+
+	"github.com/goastro/indiclient"
+)
+
+// Telescope is a simulated equatorial mount. Slews move the reported coordinates towards the target at SlewRate,
+// sending an EQUATORIAL_EOD_COORD update every UpdateInterval, the same way real mount drivers stream positions. Guide
+// pulses on TELESCOPE_TIMED_GUIDE_NS and TELESCOPE_TIMED_GUIDE_WE keep the property Busy for the pulse duration, and
+// do not move the mount.
+type Telescope struct {
+	base
+
+	// SlewRate is the slew speed in degrees per second.
+	SlewRate float64
+	// UpdateInterval is how often coordinates are sent while slewing.
+	UpdateInterval time.Duration
+
+	coords   *indiclient.DefNumberVector
+	coordSet *indiclient.DefSwitchVector
+	abort    *indiclient.DefSwitchVector
+	park     *indiclient.DefSwitchVector
+	site     *indiclient.DefNumberVector
+	timeUTC  *indiclient.DefTextVector
+	guideNS  *indiclient.DefNumberVector
+	guideWE  *indiclient.DefNumberVector
+
+	stop chan struct{}
+}
+
+// NewTelescope creates a simulated telescope named name, pointing at the celestial pole and unparked.
+func NewTelescope(name string) *Telescope {
+	t := &Telescope{
+		base:           newBase(name),
+		SlewRate:       30,
+		UpdateInterval: 50 * time.Millisecond,
+	}
+
+	t.coords = &indiclient.DefNumberVector{
+		Device: name, Name: "EQUATORIAL_EOD_COORD", Label: "Eq. Coordinates", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Timeout: 60,
+		Numbers: []indiclient.DefNumber{
+			{Name: "RA", Label: "RA (hh:mm:ss)", Format: "%010.6m", Min: "0", Max: "24", Step: "0", Value: "0"},
+			{Name: "DEC", Label: "DEC (dd:mm:ss)", Format: "%010.6m", Min: "-90", Max: "90", Step: "0", Value: "90"},
+		},
+	}
+
+	t.coordSet = &indiclient.DefSwitchVector{
+		Device: name, Name: "ON_COORD_SET", Label: "On Set", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Rule: indiclient.SwitchRuleOneOfMany,
+		Switches: []indiclient.DefSwitch{
+			{Name: "TRACK", Label: "Track", Value: indiclient.SwitchStateOn},
+			{Name: "SLEW", Label: "Slew", Value: indiclient.SwitchStateOff},
+			{Name: "SYNC", Label: "Sync", Value: indiclient.SwitchStateOff},
+		},
+	}
+
+	t.abort = &indiclient.DefSwitchVector{
+		Device: name, Name: "TELESCOPE_ABORT_MOTION", Label: "Abort Motion", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Rule: indiclient.SwitchRuleAtMostOne,
+		Switches: []indiclient.DefSwitch{
+			{Name: "ABORT", Label: "Abort", Value: indiclient.SwitchStateOff},
+		},
+	}
+
+	t.park = &indiclient.DefSwitchVector{
+		Device: name, Name: "TELESCOPE_PARK", Label: "Parking", Group: "Main Control",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite, Rule: indiclient.SwitchRuleOneOfMany,
+		Switches: []indiclient.DefSwitch{
+			{Name: "PARK", Label: "Park(ed)", Value: indiclient.SwitchStateOff},
+			{Name: "UNPARK", Label: "UnPark(ed)", Value: indiclient.SwitchStateOn},
+		},
+	}
+
+	t.site = &indiclient.DefNumberVector{
+		Device: name, Name: "GEOGRAPHIC_COORD", Label: "Location", Group: "Site Management",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite,
+		Numbers: []indiclient.DefNumber{
+			{Name: "LAT", Label: "Lat (dd:mm:ss)", Format: "%010.6m", Min: "-90", Max: "90", Step: "0", Value: "0"},
+			{Name: "LONG", Label: "Lon (dd:mm:ss)", Format: "%010.6m", Min: "0", Max: "360", Step: "0", Value: "0"},
+			{Name: "ELEV", Label: "Elevation (m)", Format: "%g", Min: "-200", Max: "10000", Step: "0", Value: "0"},
+		},
+	}
+
+	t.timeUTC = &indiclient.DefTextVector{
+		Device: name, Name: "TIME_UTC", Label: "UTC", Group: "Site Management",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite,
+		Texts: []indiclient.DefText{
+			{Name: "UTC", Label: "UTC Time", Value: time.Now().UTC().Format("2006-01-02T15:04:05")},
+			{Name: "OFFSET", Label: "UTC Offset", Value: "0.00"},
+		},
+	}
+
+	t.guideNS = &indiclient.DefNumberVector{
+		Device: name, Name: "TELESCOPE_TIMED_GUIDE_NS", Label: "Guide N/S", Group: "Guide",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite,
+		Numbers: []indiclient.DefNumber{
+			{Name: "TIMED_GUIDE_N", Label: "North (ms)", Format: "%.f", Min: "0", Max: "60000", Step: "100", Value: "0"},
+			{Name: "TIMED_GUIDE_S", Label: "South (ms)", Format: "%.f", Min: "0", Max: "60000", Step: "100", Value: "0"},
+		},
+	}
+
+	t.guideWE = &indiclient.DefNumberVector{
+		Device: name, Name: "TELESCOPE_TIMED_GUIDE_WE", Label: "Guide E/W", Group: "Guide",
+		State: indiclient.PropertyStateIdle, Perm: indiclient.PropertyPermissionReadWrite,
+		Numbers: []indiclient.DefNumber{
+			{Name: "TIMED_GUIDE_W", Label: "West (ms)", Format: "%.f", Min: "0", Max: "60000", Step: "100", Value: "0"},
+			{Name: "TIMED_GUIDE_E", Label: "East (ms)", Format: "%.f", Min: "0", Max: "60000", Step: "100", Value: "0"},
+		},
+	}
+
+	t.props = []interface{}{t.coords, t.coordSet, t.abort, t.park, t.site, t.timeUTC, t.guideNS, t.guideWE}
+
+	return t
+}
+
+// Handle processes a new*Vector command sent by a client.
+func (t *Telescope) Handle(cmd interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.handleConnection(cmd) || !t.connected {
+		return
+	}
+
+	switch item := cmd.(type) {
+	case *indiclient.NewNumberVector:
+		switch item.Name {
+		case "EQUATORIAL_EOD_COORD":
+			t.goTo(item)
+		case "GEOGRAPHIC_COORD":
+			applyNumbers(t.site, item)
+			t.site.State = indiclient.PropertyStateOk
+			t.sendNumber(t.site, "")
+		case "TELESCOPE_TIMED_GUIDE_NS":
+			t.pulse(t.guideNS, item)
+		case "TELESCOPE_TIMED_GUIDE_WE":
+			t.pulse(t.guideWE, item)
+		}
+	case *indiclient.NewSwitchVector:
+		switch item.Name {
+		case "ON_COORD_SET":
+			applySwitches(t.coordSet, item)
+			t.coordSet.State = indiclient.PropertyStateOk
+			t.sendSwitch(t.coordSet, "")
+		case "TELESCOPE_ABORT_MOTION":
+			t.stopSlew()
+			t.coords.State = indiclient.PropertyStateIdle
+			t.sendNumber(t.coords, "")
+			if t.park.State == indiclient.PropertyStateBusy {
+				t.park.State = indiclient.PropertyStateAlert
+				t.sendSwitch(t.park, "Parking aborted.")
+			}
+			t.abort.State = indiclient.PropertyStateOk
+			t.sendSwitch(t.abort, "Telescope motion aborted.")
+		case "TELESCOPE_PARK":
+			t.doPark(item)
+		}
+	case *indiclient.NewTextVector:
+		if item.Name == "TIME_UTC" {
+			for _, one := range item.Texts {
+				for i, text := range t.timeUTC.Texts {
+					if text.Name == one.Name {
+						t.timeUTC.Texts[i].Value = trim(one.Value)
+					}
+				}
+			}
+			t.timeUTC.State = indiclient.PropertyStateOk
+			t.sendText(t.timeUTC, "")
+		}
+	}
+}
+
+// Only call when t.mu is locked.
+func (t *Telescope) goTo(item *indiclient.NewNumberVector) {
+	if switchOn(t.park, "PARK") {
+		t.coords.State = indiclient.PropertyStateAlert
+		t.sendNumber(t.coords, "Telescope is parked.")
+		return
+	}
+
+	target := &indiclient.DefNumberVector{Numbers: []indiclient.DefNumber{
+		{Name: "RA", Min: "0", Max: "24", Value: t.coords.Numbers[0].Value},
+		{Name: "DEC", Min: "-90", Max: "90", Value: t.coords.Numbers[1].Value},
+	}}
+	applyNumbers(target, item)
+
+	if selected(t.coordSet) == "SYNC" {
+		t.stopSlew()
+		applyNumbers(t.coords, item)
+		t.coords.State = indiclient.PropertyStateOk
+		t.sendNumber(t.coords, "Sync successful.")
+		return
+	}
+
+	t.slew(number(target, "RA"), number(target, "DEC"), func() {
+		t.coords.State = indiclient.PropertyStateOk
+		t.sendNumber(t.coords, "Slew complete, tracking...")
+	})
+}
+
+// pulse keeps v Busy for the longest of the pulse durations in item, then zeroes them. Only call when t.mu is locked.
+func (t *Telescope) pulse(v *indiclient.DefNumberVector, item *indiclient.NewNumberVector) {
+	applyNumbers(v, item)
+
+	duration := 0.0
+	for _, n := range v.Numbers {
+		duration = math.Max(duration, number(v, n.Name))
+	}
+
+	v.State = indiclient.PropertyStateBusy
+	t.sendNumber(v, "")
+
+	time.AfterFunc(time.Duration(duration*float64(time.Millisecond)), func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		for _, n := range v.Numbers {
+			setNumber(v, n.Name, 0)
+		}
+
+		v.State = indiclient.PropertyStateOk
+		t.sendNumber(v, "")
+	})
+}
+
+// Only call when t.mu is locked.
+func (t *Telescope) doPark(item *indiclient.NewSwitchVector) {
+	applySwitches(t.park, item)
+
+	if !switchOn(t.park, "PARK") {
+		t.park.State = indiclient.PropertyStateOk
+		t.sendSwitch(t.park, "Telescope unparked.")
+		return
+	}
+
+	t.park.State = indiclient.PropertyStateBusy
+	t.sendSwitch(t.park, "Parking telescope in progress...")
+
+	t.slew(0, 90, func() {
+		t.coords.State = indiclient.PropertyStateIdle
+		t.sendNumber(t.coords, "")
+		t.park.State = indiclient.PropertyStateOk
+		t.sendSwitch(t.park, "Telescope parked.")
+	})
+}
+
+// slew starts moving towards ra, dec, calling done with t.mu locked when the target is reached. Only call when t.mu
+// is locked.
+func (t *Telescope) slew(ra, dec float64, done func()) {
+	t.stopSlew()
+
+	stop := make(chan struct{})
+	t.stop = stop
+
+	t.coords.State = indiclient.PropertyStateBusy
+	t.sendNumber(t.coords, "Slewing...")
+
+	go func() {
+		ticker := time.NewTicker(t.UpdateInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			t.mu.Lock()
+
+			select {
+			case <-stop:
+				t.mu.Unlock()
+				return
+			default:
+			}
+
+			step := t.SlewRate * t.UpdateInterval.Seconds()
+
+			curRA := number(t.coords, "RA")
+			curDec := number(t.coords, "DEC")
+
+			newRA := approach(curRA, ra, step/15)
+			newDec := approach(curDec, dec, step)
+
+			setNumber(t.coords, "RA", newRA)
+			setNumber(t.coords, "DEC", newDec)
+
+			if newRA == ra && newDec == dec {
+				t.stop = nil
+				done()
+				t.mu.Unlock()
+				return
+			}
+
+			t.sendNumber(t.coords, "")
+			t.mu.Unlock()
+		}
+	}()
+}
+
+// Only call when t.mu is locked.
+func (t *Telescope) stopSlew() {
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
+
+// approach moves cur towards target by at most step.
+func approach(cur, target, step float64) float64 {
+	if math.Abs(target-cur) <= step {
+		return target
+	}
+
+	if target > cur {
+		return cur + step
+	}
+
+	return cur - step
+}
@@ -0,0 +1,132 @@
+package indiclient
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Site is the location of an observatory, as reported by GEOGRAPHIC_COORD.
+type Site struct {
+	// Latitude is in degrees, positive north.
+	Latitude float64 `json:"latitude"`
+	// Longitude is in degrees east, from 0 to 360, as INDI expects.
+	Longitude float64 `json:"longitude"`
+	// Elevation is in meters above sea level.
+	Elevation float64 `json:"elevation"`
+}
+
+// GetSite reads GEOGRAPHIC_COORD from deviceName, which is usually a GPS or a mount.
+func (c *INDIClient) GetSite(deviceName string) (Site, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	site := Site{}
+
+	for name, f := range map[string]*float64{"LAT": &site.Latitude, "LONG": &site.Longitude, "ELEV": &site.Elevation} {
+		val, err := c.GetNumber(deviceName, "GEOGRAPHIC_COORD", name)
+		if err != nil {
+			return Site{}, err
+		}
+
+		*f, err = ParseNumber(val.Value)
+		if err != nil {
+			return Site{}, err
+		}
+	}
+
+	return site, nil
+}
+
+// SetSite sends site to GEOGRAPHIC_COORD on deviceName. Longitudes west of Greenwich may be given as negative numbers;
+// they are converted to the 0 to 360 range INDI uses. Waits to return until the state of the vector is ok.
+func (c *INDIClient) SetSite(deviceName string, site Site) error {
+	deviceName = c.resolveDevice(deviceName)
+
+	long := math.Mod(site.Longitude, 360)
+	if long < 0 {
+		long += 360
+	}
+
+	return c.SetNumberValue(deviceName, "GEOGRAPHIC_COORD", []string{"LAT", "LONG", "ELEV"}, []string{
+		strconv.FormatFloat(site.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(long, 'f', -1, 64),
+		strconv.FormatFloat(site.Elevation, 'f', -1, 64),
+	})
+}
+
+// GetTime reads TIME_UTC from deviceName. The returned time is in a fixed time zone with the device's UTC offset.
+func (c *INDIClient) GetTime(deviceName string) (time.Time, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	utc, err := c.GetText(deviceName, "TIME_UTC", "UTC")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, err := time.ParseInLocation("2006-01-02T15:04:05.999999999", strings.TrimSpace(utc.Value), time.UTC)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	offset, err := c.GetText(deviceName, "TIME_UTC", "OFFSET")
+	if err == ErrPropertyValueNotFound {
+		return t, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	hours, err := strconv.ParseFloat(strings.TrimSpace(offset.Value), 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	seconds := int(math.Round(hours * 3600))
+
+	return t.In(time.FixedZone(formatOffset(seconds), seconds)), nil
+}
+
+// SetTime sends t to TIME_UTC on deviceName. The UTC offset is taken from t's location, so use t.In to choose the
+// site's time zone. Waits to return until the state of the vector is ok.
+func (c *INDIClient) SetTime(deviceName string, t time.Time) error {
+	deviceName = c.resolveDevice(deviceName)
+
+	_, seconds := t.Zone()
+
+	return c.SetTextValue(deviceName, "TIME_UTC", []string{"UTC", "OFFSET"}, []string{
+		t.UTC().Format("2006-01-02T15:04:05"),
+		fmt.Sprintf("%.2f", float64(seconds)/3600),
+	})
+}
+
+// SetSiteFromGPS reads the location and time from gpsName, and sends them to mountName.
+func (c *INDIClient) SetSiteFromGPS(gpsName, mountName string) error {
+	site, err := c.GetSite(gpsName)
+	if err != nil {
+		return err
+	}
+
+	t, err := c.GetTime(gpsName)
+	if err != nil {
+		return err
+	}
+
+	err = c.SetSite(mountName, site)
+	if err != nil {
+		return err
+	}
+
+	return c.SetTime(mountName, t)
+}
+
+// formatOffset names a fixed time zone, e.g. "UTC-05:30".
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+
+	return fmt.Sprintf("UTC%s%02d:%02d", sign, seconds/3600, seconds%3600/60)
+}
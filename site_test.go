@@ -0,0 +1,12 @@
+package indiclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_formatOffset(t *testing.T) {
+	assert.Equal(t, "UTC+05:45", formatOffset(5*3600+45*60))
+	assert.Equal(t, "UTC-03:30", formatOffset(-(3*3600 + 30*60)))
+}
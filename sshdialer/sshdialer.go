@@ -0,0 +1,80 @@
+// Package sshdialer connects an INDIClient to indiserver through an SSH server, such as the computer at a remote
+// observatory, without running a separate tunnel:
+//
+//	signer, err := ssh.ParsePrivateKey(key)
+//	hostKeys, err := knownhosts.New("/home/astro/.ssh/known_hosts")
+//
+//	err = c.ConnectWithOptions("tcp", "localhost:7624", indiclient.ConnectOptions{
+//		Dialer: &sshdialer.Dialer{
+//			Address: "observatory.example.com",
+//			Config: &ssh.ClientConfig{
+//				User:            "astro",
+//				Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+//				HostKeyCallback: hostKeys,
+//			},
+//		},
+//	})
+//
+// The address given to Connect is dialed by the SSH server, so localhost:7624 is indiserver on the observatory
+// computer. unix addresses work too, with servers that support OpenSSH's streamlocal forwarding.
+package sshdialer
+
+import (
+	"io"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultPort is the port of the SSH server when Dialer.Address does not have one.
+const DefaultPort = "22"
+
+// Dialer is an implementation of indiclient.Dialer that connects through an SSH server. Each Dial opens its own SSH
+// connection, which is closed with the connection to indiserver.
+type Dialer struct {
+	// Address is the host of the SSH server, with an optional port.
+	Address string
+	// Config authenticates the client and the server. Its HostKeyCallback must be set.
+	Config *ssh.ClientConfig
+}
+
+// Dial connects to the SSH server, then asks it to connect to address on network, which must be "tcp" or "unix".
+func (d *Dialer) Dial(network, address string) (io.ReadWriteCloser, error) {
+	if network != "tcp" && network != "unix" {
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	server := d.Address
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, DefaultPort)
+	}
+
+	client, err := ssh.Dial("tcp", server, d.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := client.Dial(network, address)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &tunnelConn{Conn: conn, client: client}, nil
+}
+
+// tunnelConn is a connection through an SSH server, which closes the SSH connection when it is closed.
+type tunnelConn struct {
+	net.Conn
+	client *ssh.Client
+}
+
+func (c *tunnelConn) Close() error {
+	err := c.Conn.Close()
+
+	if cerr := c.client.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
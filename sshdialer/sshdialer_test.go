@@ -0,0 +1,152 @@
+package sshdialer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveSSH runs an SSH server on a random port that accepts user astro with password secret, and forwards
+// direct-tcpip channels.
+func serveSSH(t *testing.T) (net.Listener, ssh.PublicKey) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == "astro" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+
+				for newChannel := range chans {
+					var target struct {
+						Host     string
+						Port     uint32
+						OrigHost string
+						OrigPort uint32
+					}
+
+					if newChannel.ChannelType() != "direct-tcpip" || ssh.Unmarshal(newChannel.ExtraData(), &target) != nil {
+						newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+						continue
+					}
+
+					upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.FormatUint(uint64(target.Port), 10)))
+					if err != nil {
+						newChannel.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+
+					ch, chReqs, err := newChannel.Accept()
+					if err != nil {
+						upstream.Close()
+						continue
+					}
+					go ssh.DiscardRequests(chReqs)
+
+					go func() {
+						io.Copy(ch, upstream)
+						ch.Close()
+					}()
+					go func() {
+						io.Copy(upstream, ch)
+						upstream.Close()
+					}()
+				}
+			}()
+		}
+	}()
+
+	return l, signer.PublicKey()
+}
+
+// serveEcho runs a TCP server on a random port that echoes what it receives.
+func serveEcho(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	return l
+}
+
+func Test_Dialer(t *testing.T) {
+	server, hostKey := serveSSH(t)
+	defer server.Close()
+
+	l := serveEcho(t)
+	defer l.Close()
+
+	echo := l.Addr().String()
+
+	d := &Dialer{
+		Address: server.Addr().String(),
+		Config: &ssh.ClientConfig{
+			User:            "astro",
+			Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+			HostKeyCallback: ssh.FixedHostKey(hostKey),
+		},
+	}
+
+	conn, err := d.Dial("tcp", echo)
+	require.NoError(t, err)
+
+	_, err = conn.Write([]byte("<getProperties version=\"1.7\"/>"))
+	require.NoError(t, err)
+
+	buf := make([]byte, 30)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "<getProperties version=\"1.7\"/>", string(buf))
+
+	assert.NoError(t, conn.Close())
+
+	_, err = d.Dial("udp", echo)
+	assert.Equal(t, net.UnknownNetworkError("udp"), err)
+
+	d.Config.Auth = []ssh.AuthMethod{ssh.Password("wrong")}
+	_, err = d.Dial("tcp", echo)
+	assert.Error(t, err)
+}
@@ -0,0 +1,155 @@
+package indiclient
+
+import (
+	"sort"
+	"time"
+)
+
+// StaleOptions controls the EventTypeDeviceStale and EventTypeDeviceResumed events. See SetStaleDetection.
+type StaleOptions struct {
+	// Threshold is how long a device may go without sending anything before it is stale. Zero disables the events.
+	Threshold time.Duration
+	// Devices overrides Threshold for single devices, such as a weather station that only reports every few minutes.
+	// Zero disables the events for the device.
+	Devices map[string]time.Duration
+}
+
+// StaleDevice is a device that has not sent anything for a while. See StaleDevices.
+type StaleDevice struct {
+	Device   string    `json:"device"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// SetStaleDetection sends an EventTypeDeviceStale event when a device sends nothing for longer than its threshold, as
+// happens when a camera falls off the USB bus while indiserver and the connection are fine, and an
+// EventTypeDeviceResumed event when it sends something again. Devices are checked a few times per threshold, so the
+// event may come up to a quarter of the threshold late.
+func (c *INDIClient) SetStaleDetection(opts StaleOptions) {
+	devices := map[string]time.Duration{}
+	for name, d := range opts.Devices {
+		devices[c.resolveDevice(name)] = d
+	}
+	opts.Devices = devices
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.staleOpts = opts
+
+	if c.staleStop != nil {
+		close(c.staleStop)
+		c.staleStop = nil
+	}
+
+	interval := opts.Threshold
+	for _, d := range opts.Devices {
+		if d > 0 && (interval <= 0 || d < interval) {
+			interval = d
+		}
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	c.staleStop = make(chan struct{})
+	go c.checkStale(interval/4, c.staleStop)
+}
+
+// LastSeen returns when deviceName last sent anything, or false if it has not since it was defined.
+func (c *INDIClient) LastSeen(deviceName string) (time.Time, bool) {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	t, ok := c.deviceSeen[deviceName]
+
+	return t, ok
+}
+
+// StaleDevices returns the devices that have sent nothing for longer than threshold, the longest silent first.
+func (c *INDIClient) StaleDevices(threshold time.Duration) []StaleDevice {
+	now := c.now()
+
+	c.rwm.RLock()
+	stale := []StaleDevice{}
+	for name, seen := range c.deviceSeen {
+		if _, ok := c.devices[name]; ok && now.Sub(seen) > threshold {
+			stale = append(stale, StaleDevice{Device: c.aliasDevice(name), LastSeen: seen})
+		}
+	}
+	c.rwm.RUnlock()
+
+	sort.Slice(stale, func(i, j int) bool {
+		if stale[i].LastSeen.Equal(stale[j].LastSeen) {
+			return stale[i].Device < stale[j].Device
+		}
+		return stale[i].LastSeen.Before(stale[j].LastSeen)
+	})
+
+	return stale
+}
+
+// deviceActive records that deviceName sent something. Modifies INDIClient.deviceSeen. Only call when
+// INDIClient.rwm is locked.
+func (c *INDIClient) deviceActive(deviceName string) {
+	if len(deviceName) == 0 {
+		return
+	}
+
+	c.deviceSeen[deviceName] = c.now()
+
+	if c.staleDevices[deviceName] {
+		delete(c.staleDevices, deviceName)
+
+		c.emit(Event{
+			Type:   EventTypeDeviceResumed,
+			Device: deviceName,
+		})
+	}
+}
+
+// forgetDevice stops tracking deviceName, which indiserver deleted. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) forgetDevice(deviceName string) {
+	delete(c.deviceSeen, deviceName)
+	delete(c.staleDevices, deviceName)
+}
+
+// checkStale sends stale events every interval until stop is closed.
+func (c *INDIClient) checkStale(interval time.Duration, stop <-chan struct{}) {
+	clock := c.Clock()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-clock.After(interval):
+			now := clock.Now()
+
+			c.rwm.Lock()
+			for name, seen := range c.deviceSeen {
+				threshold, ok := c.staleOpts.Devices[name]
+				if !ok {
+					threshold = c.staleOpts.Threshold
+				}
+
+				if threshold <= 0 || c.staleDevices[name] || now.Sub(seen) <= threshold {
+					continue
+				}
+
+				if _, ok := c.devices[name]; !ok {
+					continue
+				}
+
+				c.staleDevices[name] = true
+
+				c.emit(Event{
+					Type:   EventTypeDeviceStale,
+					Device: name,
+				})
+			}
+			c.rwm.Unlock()
+		}
+	}
+}
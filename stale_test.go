@@ -0,0 +1,67 @@
+package indiclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_StaleDetection(t *testing.T) {
+	c := newTestClient()
+
+	c.rwm.Lock()
+	defineCoords(c)
+	defineBlob(c)
+	c.deviceActive("Mount")
+	c.deviceActive("Camera")
+	c.rwm.Unlock()
+
+	_, ok := c.LastSeen("Mount")
+	assert.True(t, ok)
+
+	events, id, err := c.Subscribe(SubscribeOptions{Types: []EventType{EventTypeDeviceStale, EventTypeDeviceResumed}})
+	require.NoError(t, err)
+	defer c.Unsubscribe(id)
+
+	// The camera only reports now and then.
+	c.SetStaleDetection(StaleOptions{Threshold: 40 * time.Millisecond, Devices: map[string]time.Duration{"Camera": 0}})
+	defer c.SetStaleDetection(StaleOptions{})
+
+	select {
+	case e := <-events:
+		assert.Equal(t, EventTypeDeviceStale, e.Type)
+		assert.Equal(t, "Mount", e.Device)
+	case <-time.After(time.Second):
+		t.Fatal("no stale event")
+	}
+
+	stale := c.StaleDevices(20 * time.Millisecond)
+	require.Len(t, stale, 2)
+	assert.Equal(t, "Mount", stale[0].Device)
+	assert.Equal(t, "Camera", stale[1].Device)
+
+	// Stale devices are only reported once.
+	assert.Empty(t, drain(events, 100*time.Millisecond))
+
+	c.rwm.Lock()
+	c.deviceActive("Mount")
+	c.rwm.Unlock()
+
+	select {
+	case e := <-events:
+		assert.Equal(t, EventTypeDeviceResumed, e.Type)
+		assert.Equal(t, "Mount", e.Device)
+	case <-time.After(time.Second):
+		t.Fatal("no resumed event")
+	}
+
+	// Deleted devices are forgotten.
+	c.rwm.Lock()
+	c.delProperty(&DelProperty{Device: "Mount"})
+	c.rwm.Unlock()
+
+	_, ok = c.LastSeen("Mount")
+	assert.False(t, ok)
+}
@@ -0,0 +1,215 @@
+package indiclient
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// ConnectionStats describes the traffic on the current connection to indiserver, or the last one if the client is
+// not connected. Counts start from zero each time the client connects. See Stats.
+type ConnectionStats struct {
+	Connected bool `json:"connected"`
+	// Uptime is how long the client has been connected. It is zero once the client disconnects.
+	Uptime time.Duration `json:"uptime"`
+	// BytesIn and BytesOut are the bytes read from and written to the connection, in the wire format of the Codec.
+	BytesIn  int64 `json:"bytesIn"`
+	BytesOut int64 `json:"bytesOut"`
+	// MessagesIn and MessagesOut count the messages received and sent by element name, e.g. "setNumberVector".
+	MessagesIn  map[string]int64 `json:"messagesIn"`
+	MessagesOut map[string]int64 `json:"messagesOut"`
+	// BlobBytes is the size of the BLOBs received, after base64 decoding.
+	BlobBytes int64 `json:"blobBytes"`
+	// DecodeErrors is the number of malformed messages that were skipped. Unknown elements are not counted.
+	DecodeErrors int64 `json:"decodeErrors"`
+	// RoundTrips is the number of commands sent by the Set*Value methods that the driver has answered, and
+	// AverageRoundTrip the average time from sending one to the driver's first update of its property.
+	RoundTrips       int64         `json:"roundTrips"`
+	AverageRoundTrip time.Duration `json:"averageRoundTrip"`
+}
+
+// connStats collects ConnectionStats. It has its own lock, since it is updated by the goroutines reading and writing
+// the connection whether or not INDIClient.rwm is locked.
+type connStats struct {
+	mu           sync.Mutex
+	connectedAt  time.Time
+	bytesIn      int64
+	bytesOut     int64
+	messagesIn   map[string]int64
+	messagesOut  map[string]int64
+	blobBytes    int64
+	decodeErrors int64
+	roundTrips   int64
+	roundTrip    time.Duration // The total of all round trips.
+}
+
+// Stats returns the statistics of the connection to indiserver, for showing its health to the user.
+func (c *INDIClient) Stats() ConnectionStats {
+	connected := c.IsConnected()
+	now := c.now()
+
+	s := &c.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := ConnectionStats{
+		Connected:    connected,
+		BytesIn:      s.bytesIn,
+		BytesOut:     s.bytesOut,
+		MessagesIn:   map[string]int64{},
+		MessagesOut:  map[string]int64{},
+		BlobBytes:    s.blobBytes,
+		DecodeErrors: s.decodeErrors,
+		RoundTrips:   s.roundTrips,
+	}
+
+	if connected && !s.connectedAt.IsZero() {
+		stats.Uptime = now.Sub(s.connectedAt)
+	}
+
+	for k, v := range s.messagesIn {
+		stats.MessagesIn[k] = v
+	}
+
+	for k, v := range s.messagesOut {
+		stats.MessagesOut[k] = v
+	}
+
+	if s.roundTrips > 0 {
+		stats.AverageRoundTrip = s.roundTrip / time.Duration(s.roundTrips)
+	}
+
+	return stats
+}
+
+// reset clears the statistics for a connection made at now.
+func (s *connStats) reset(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connectedAt = now
+	s.bytesIn = 0
+	s.bytesOut = 0
+	s.messagesIn = map[string]int64{}
+	s.messagesOut = map[string]int64{}
+	s.blobBytes = 0
+	s.decodeErrors = 0
+	s.roundTrips = 0
+	s.roundTrip = 0
+}
+
+func (s *connStats) received(msg interface{}) {
+	s.count(&s.messagesIn, msg)
+}
+
+func (s *connStats) sent(msg interface{}, n int) {
+	s.count(&s.messagesOut, msg)
+
+	s.mu.Lock()
+	s.bytesOut += int64(n)
+	s.mu.Unlock()
+}
+
+func (s *connStats) count(m *map[string]int64, msg interface{}) {
+	name := messageElement(msg)
+	if len(name) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if *m == nil {
+		*m = map[string]int64{}
+	}
+	(*m)[name]++
+}
+
+func (s *connStats) decodeError() {
+	s.mu.Lock()
+	s.decodeErrors++
+	s.mu.Unlock()
+}
+
+func (s *connStats) blob(n int) {
+	s.mu.Lock()
+	s.blobBytes += int64(n)
+	s.mu.Unlock()
+}
+
+func (s *connStats) answered(d time.Duration) {
+	s.mu.Lock()
+	s.roundTrips++
+	s.roundTrip += d
+	s.mu.Unlock()
+}
+
+// reader returns r, counting the bytes read from it.
+func (s *connStats) reader(r io.Reader) io.Reader {
+	return statsReader{r: r, s: s}
+}
+
+type statsReader struct {
+	r io.Reader
+	s *connStats
+}
+
+func (r statsReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+
+	r.s.mu.Lock()
+	r.s.bytesIn += int64(n)
+	r.s.mu.Unlock()
+
+	return n, err
+}
+
+// messageElement returns the element name of msg, one of the message or command types, or "" if it is not one.
+func messageElement(msg interface{}) string {
+	switch msg := msg.(type) {
+	case *GetProperties, GetProperties:
+		return "getProperties"
+	case *DefTextVector:
+		return "defTextVector"
+	case *DefNumberVector:
+		return "defNumberVector"
+	case *DefSwitchVector:
+		return "defSwitchVector"
+	case *DefLightVector:
+		return "defLightVector"
+	case *DefBlobVector:
+		return "defBLOBVector"
+	case *SetTextVector:
+		return "setTextVector"
+	case *SetNumberVector:
+		return "setNumberVector"
+	case *SetSwitchVector:
+		return "setSwitchVector"
+	case *SetLightVector:
+		return "setLightVector"
+	case *SetBlobVector:
+		return "setBLOBVector"
+	case *Message:
+		return "message"
+	case *DelProperty:
+		return "delProperty"
+	case EnableBlob, *EnableBlob:
+		return "enableBLOB"
+	case NewTextVector, *NewTextVector:
+		return "newTextVector"
+	case NewNumberVector, *NewNumberVector:
+		return "newNumberVector"
+	case NewSwitchVector, *NewSwitchVector:
+		return "newSwitchVector"
+	case NewBlobVector, *NewBlobVector:
+		return "newBLOBVector"
+	case RawCommand:
+		start, err := checkRawXML(msg.XML)
+		if err != nil {
+			return ""
+		}
+		return start.Name.Local
+	default:
+		return ""
+	}
+}
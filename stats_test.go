@@ -0,0 +1,83 @@
+package indiclient
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+func Test_Stats(t *testing.T) {
+	d := queueDialer{conns: make(chan net.Conn, 1)}
+	c := NewINDIClient(logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelInfo), d, afero.NewMemMapFs(), 100)
+
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	c.SetClock(clock)
+
+	assert.False(t, c.Stats().Connected)
+
+	server, commands := d.serve()
+	require.NoError(t, c.Connect("tcp", "localhost:7624"))
+	defer c.Disconnect()
+
+	def := `<defNumberVector device="Mount" name="EQUATORIAL_EOD_COORD" state="Idle" perm="rw">` +
+		`<defNumber name="RA">0</defNumber><defNumber name="DEC">0</defNumber></defNumberVector>`
+	blob := `<defBLOBVector device="CCD" name="CCD1" state="Idle" perm="ro"><defBLOB name="CCD1"/></defBLOBVector>` +
+		`<setBLOBVector device="CCD" name="CCD1" state="Ok"><oneBLOB name="CCD1" size="5" format=".fits">aGVsbG8=</oneBLOB></setBLOBVector>`
+
+	_, err := server.Write([]byte(def + malformedMessage + blob + `<message message="hi"/>`))
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return c.Stats().MessagesIn["message"] == 1 })
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"5"})
+	}()
+
+	cmd := <-commands
+	assert.Contains(t, cmd, "<newNumberVector")
+
+	clock.Advance(2 * time.Second)
+
+	_, err = server.Write([]byte(`<setNumberVector device="Mount" name="EQUATORIAL_EOD_COORD" state="Ok"><oneNumber name="RA">5</oneNumber></setNumberVector>`))
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+
+	clock.Advance(time.Minute)
+
+	stats := c.Stats()
+	assert.True(t, stats.Connected)
+	assert.Equal(t, 62*time.Second, stats.Uptime)
+	assert.Equal(t, int64(len(def+malformedMessage+blob+`<message message="hi"/>`)+len(`<setNumberVector device="Mount" name="EQUATORIAL_EOD_COORD" state="Ok"><oneNumber name="RA">5</oneNumber></setNumberVector>`)), stats.BytesIn)
+	assert.Equal(t, int64(len(cmd)), stats.BytesOut)
+	assert.Equal(t, map[string]int64{"defNumberVector": 1, "defBLOBVector": 1, "setBLOBVector": 1, "message": 1, "setNumberVector": 1}, stats.MessagesIn)
+	assert.Equal(t, map[string]int64{"newNumberVector": 1}, stats.MessagesOut)
+	assert.Equal(t, int64(5), stats.BlobBytes)
+	assert.Equal(t, int64(1), stats.DecodeErrors)
+	assert.Equal(t, int64(1), stats.RoundTrips)
+	assert.Equal(t, 2*time.Second, stats.AverageRoundTrip)
+
+	require.NoError(t, c.Disconnect())
+
+	stats = c.Stats()
+	assert.False(t, stats.Connected)
+	assert.Equal(t, time.Duration(0), stats.Uptime)
+	assert.Equal(t, int64(1), stats.RoundTrips)
+}
+
+func Test_messageElement(t *testing.T) {
+	assert.Equal(t, "setBLOBVector", messageElement(&SetBlobVector{}))
+	assert.Equal(t, "newSwitchVector", messageElement(NewSwitchVector{}))
+	assert.Equal(t, "getProperties", messageElement(GetProperties{}))
+	assert.Equal(t, "myCommand", messageElement(RawCommand{XML: []byte(`<myCommand device="A"/>`)}))
+	assert.Equal(t, "", messageElement(RawCommand{XML: []byte(`not xml`)}))
+	assert.Equal(t, "", messageElement(42))
+}
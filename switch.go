@@ -0,0 +1,150 @@
+package indiclient
+
+import (
+	"errors"
+)
+
+// ErrSwitchRule is returned when a switch operation is not allowed by the rule of the switchVector.
+var ErrSwitchRule = errors.New("operation not allowed by switch rule")
+
+// SelectSwitch turns on switchName in a switchVector. For OneOfMany and AtMostOne vectors every other switch is sent
+// as Off in the same command, since some drivers ignore a command that doesn't describe the whole vector. Waits to
+// return until the state of the vector is ok.
+func (c *INDIClient) SelectSwitch(deviceName, propName, switchName string) error {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.RLock()
+	prop, err := c.findSwitchProperty(deviceName, propName, switchName)
+	c.rwm.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if prop.Rule == SwitchRuleAnyOfMany {
+		return c.SetSwitchValue(deviceName, propName, []string{switchName}, []SwitchState{SwitchStateOn})
+	}
+
+	names := []string{}
+	values := []SwitchState{}
+
+	for _, name := range prop.Order {
+		names = append(names, name)
+		if name == switchName {
+			values = append(values, SwitchStateOn)
+		} else {
+			values = append(values, SwitchStateOff)
+		}
+	}
+
+	return c.SetSwitchValue(deviceName, propName, names, values)
+}
+
+// ToggleSwitch flips the state of switchName in an AnyOfMany switchVector, and returns the new state. Returns
+// ErrSwitchRule for other rules, since turning a switch off could leave the vector in a state the rule forbids; use
+// SelectSwitch instead. Waits to return until the state of the vector is ok.
+func (c *INDIClient) ToggleSwitch(deviceName, propName, switchName string) (SwitchState, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	c.rwm.RLock()
+	prop, err := c.findSwitchProperty(deviceName, propName, switchName)
+	c.rwm.RUnlock()
+	if err != nil {
+		return "", err
+	}
+
+	if prop.Rule != SwitchRuleAnyOfMany {
+		return "", ErrSwitchRule
+	}
+
+	state := SwitchStateOn
+	if prop.Values[switchName].Value == SwitchStateOn {
+		state = SwitchStateOff
+	}
+
+	err = c.SetSwitchValue(deviceName, propName, []string{switchName}, []SwitchState{state})
+	if err != nil {
+		return "", err
+	}
+
+	return state, nil
+}
+
+// Reads INDIClient.devices. Only call when INDIClient.rwm is at least reader locked.
+func (c *INDIClient) findSwitchProperty(deviceName, propName, switchName string) (SwitchProperty, error) {
+	device, err := c.findDevice(deviceName)
+	if err != nil {
+		return SwitchProperty{}, err
+	}
+
+	prop, ok := device.SwitchProperties[propName]
+	if !ok {
+		return SwitchProperty{}, ErrPropertyNotFound
+	}
+
+	if _, ok := prop.Values[switchName]; !ok {
+		return SwitchProperty{}, ErrPropertyValueNotFound
+	}
+
+	return prop.Copy(), nil
+}
+
+// SwitchOption is an element of a switchVector used as a choice, such as a frame type or transfer format. See Options.
+type SwitchOption struct {
+	Name     string `json:"name"`
+	Label    string `json:"label"`
+	Selected bool   `json:"selected"`
+}
+
+// Options returns the elements of a switchVector in the order the driver defined them, for offering a OneOfMany or
+// AtMostOne vector as a choice between modes.
+func (c *INDIClient) Options(deviceName, propName string) ([]SwitchOption, error) {
+	prop, err := c.GetSwitchProperty(deviceName, propName)
+	if err != nil {
+		return nil, err
+	}
+
+	options := make([]SwitchOption, 0, len(prop.Order))
+
+	for _, name := range prop.Order {
+		v := prop.Values[name]
+		options = append(options, SwitchOption{Name: name, Label: v.Label, Selected: v.Value == SwitchStateOn})
+	}
+
+	return options, nil
+}
+
+// GetSelected returns the name of the switch that is on in a OneOfMany or AtMostOne switchVector, or an empty string
+// if none is. Returns ErrSwitchRule for AnyOfMany vectors, which may have several.
+func (c *INDIClient) GetSelected(deviceName, propName string) (string, error) {
+	prop, err := c.GetSwitchProperty(deviceName, propName)
+	if err != nil {
+		return "", err
+	}
+
+	if prop.Rule == SwitchRuleAnyOfMany {
+		return "", ErrSwitchRule
+	}
+
+	for _, name := range prop.Order {
+		if prop.Values[name].Value == SwitchStateOn {
+			return name, nil
+		}
+	}
+
+	return "", nil
+}
+
+// SetSelected selects elementName in a OneOfMany or AtMostOne switchVector, as SelectSwitch does. Returns
+// ErrSwitchRule for AnyOfMany vectors. Waits to return until the state of the vector is ok.
+func (c *INDIClient) SetSelected(deviceName, propName, elementName string) error {
+	prop, err := c.GetSwitchProperty(deviceName, propName)
+	if err != nil {
+		return err
+	}
+
+	if prop.Rule == SwitchRuleAnyOfMany {
+		return ErrSwitchRule
+	}
+
+	return c.SelectSwitch(deviceName, propName, elementName)
+}
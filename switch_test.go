@@ -0,0 +1,154 @@
+package indiclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func defineFrameType(c *INDIClient, rule SwitchRule) {
+	c.defSwitchVector(&DefSwitchVector{
+		Device: "CCD Simulator",
+		Name:   "CCD_FRAME_TYPE",
+		State:  PropertyStateIdle,
+		Perm:   PropertyPermissionReadWrite,
+		Rule:   rule,
+		Switches: []DefSwitch{
+			{Name: "FRAME_LIGHT", Label: "Light", Value: SwitchStateOff},
+			{Name: "FRAME_BIAS", Label: "Bias", Value: SwitchStateOff},
+			{Name: "FRAME_DARK", Label: "Dark", Value: SwitchStateOn},
+		},
+	})
+}
+
+// answerSwitch plays the driver for the next switch command: it applies the command and reports the vector Ok, and
+// returns the command.
+func answerSwitch(c *INDIClient) NewSwitchVector {
+	cmd := (<-c.write).(NewSwitchVector)
+
+	c.rwm.Lock()
+	c.setSwitchVector(&SetSwitchVector{Device: cmd.Device, Name: cmd.Name, State: PropertyStateOk, Switches: cmd.Switches})
+	c.rwm.Unlock()
+
+	return cmd
+}
+
+func switchValues(t *testing.T, c *INDIClient) map[string]SwitchState {
+	prop, err := c.GetSwitchProperty("CCD Simulator", "CCD_FRAME_TYPE")
+	require.NoError(t, err)
+
+	values := map[string]SwitchState{}
+	for name, v := range prop.Values {
+		values[name] = v.Value
+	}
+
+	return values
+}
+
+func Test_SelectSwitch(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	defineFrameType(c, SwitchRuleOneOfMany)
+
+	sent := make(chan NewSwitchVector, 1)
+	go func() { sent <- answerSwitch(c) }()
+
+	require.NoError(t, c.SelectSwitch("CCD Simulator", "CCD_FRAME_TYPE", "FRAME_BIAS"))
+
+	// The whole vector is sent, for drivers that ignore partial commands.
+	assert.Equal(t, []OneSwitch{
+		{Name: "FRAME_LIGHT", Value: SwitchStateOff},
+		{Name: "FRAME_BIAS", Value: SwitchStateOn},
+		{Name: "FRAME_DARK", Value: SwitchStateOff},
+	}, (<-sent).Switches)
+
+	assert.Equal(t, map[string]SwitchState{
+		"FRAME_LIGHT": SwitchStateOff,
+		"FRAME_BIAS":  SwitchStateOn,
+		"FRAME_DARK":  SwitchStateOff,
+	}, switchValues(t, c))
+
+	_, err := c.ToggleSwitch("CCD Simulator", "CCD_FRAME_TYPE", "FRAME_DARK")
+	assert.Equal(t, ErrSwitchRule, err)
+
+	assert.Equal(t, ErrPropertyValueNotFound, c.SelectSwitch("CCD Simulator", "CCD_FRAME_TYPE", "FRAME_UNKNOWN"))
+	assert.Empty(t, c.write)
+}
+
+func Test_ToggleSwitch(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	defineFrameType(c, SwitchRuleAnyOfMany)
+
+	sent := make(chan NewSwitchVector, 1)
+
+	go func() { sent <- answerSwitch(c) }()
+
+	state, err := c.ToggleSwitch("CCD Simulator", "CCD_FRAME_TYPE", "FRAME_LIGHT")
+	require.NoError(t, err)
+	assert.Equal(t, SwitchStateOn, state)
+
+	// Only the toggled switch is sent.
+	assert.Equal(t, []OneSwitch{{Name: "FRAME_LIGHT", Value: SwitchStateOn}}, (<-sent).Switches)
+
+	go func() { sent <- answerSwitch(c) }()
+
+	state, err = c.ToggleSwitch("CCD Simulator", "CCD_FRAME_TYPE", "FRAME_DARK")
+	require.NoError(t, err)
+	assert.Equal(t, SwitchStateOff, state)
+	assert.Equal(t, []OneSwitch{{Name: "FRAME_DARK", Value: SwitchStateOff}}, (<-sent).Switches)
+
+	assert.Equal(t, map[string]SwitchState{
+		"FRAME_LIGHT": SwitchStateOn,
+		"FRAME_BIAS":  SwitchStateOff,
+		"FRAME_DARK":  SwitchStateOff,
+	}, switchValues(t, c))
+
+	_, err = c.ToggleSwitch("CCD Simulator", "CCD_FRAME_TYPE", "FRAME_UNKNOWN")
+	assert.Equal(t, ErrPropertyValueNotFound, err)
+}
+
+func Test_SwitchSelection(t *testing.T) {
+	c := newTestClient()
+	defineFrameType(c, SwitchRuleOneOfMany)
+
+	options, err := c.Options("CCD Simulator", "CCD_FRAME_TYPE")
+	require.NoError(t, err)
+	assert.Equal(t, []SwitchOption{
+		{Name: "FRAME_LIGHT", Label: "Light"},
+		{Name: "FRAME_BIAS", Label: "Bias"},
+		{Name: "FRAME_DARK", Label: "Dark", Selected: true},
+	}, options)
+
+	selected, err := c.GetSelected("CCD Simulator", "CCD_FRAME_TYPE")
+	require.NoError(t, err)
+	assert.Equal(t, "FRAME_DARK", selected)
+
+	_, err = c.GetSelected("CCD Simulator", "CCD_TRANSFER_FORMAT")
+	assert.Equal(t, ErrPropertyNotFound, err)
+
+	assert.Equal(t, ErrPropertyValueNotFound, c.SetSelected("CCD Simulator", "CCD_FRAME_TYPE", "FRAME_FLAT"))
+
+	// Without a connection, this would block forever if it was sent.
+	c.SetDryRun(true)
+
+	err = c.SetSelected("CCD Simulator", "CCD_FRAME_TYPE", "FRAME_LIGHT")
+	require.IsType(t, &DryRunError{}, err)
+	assert.Equal(t, `<newSwitchVector device="CCD Simulator" name="CCD_FRAME_TYPE"><oneSwitch name="FRAME_LIGHT">On</oneSwitch><oneSwitch name="FRAME_BIAS">Off</oneSwitch><oneSwitch name="FRAME_DARK">Off</oneSwitch></newSwitchVector>`, err.(*DryRunError).XML)
+}
+
+func Test_SwitchSelection_AnyOfMany(t *testing.T) {
+	c := newTestClient()
+	defineFrameType(c, SwitchRuleAnyOfMany)
+
+	_, err := c.GetSelected("CCD Simulator", "CCD_FRAME_TYPE")
+	assert.Equal(t, ErrSwitchRule, err)
+
+	assert.Equal(t, ErrSwitchRule, c.SetSelected("CCD Simulator", "CCD_FRAME_TYPE", "FRAME_LIGHT"))
+
+	// The options can still be listed.
+	options, err := c.Options("CCD Simulator", "CCD_FRAME_TYPE")
+	require.NoError(t, err)
+	assert.Len(t, options, 3)
+}
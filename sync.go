@@ -0,0 +1,133 @@
+package indiclient
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultSyncSettle is how long SyncProperties waits without new definitions when settle is zero.
+const DefaultSyncSettle = 500 * time.Millisecond
+
+// SyncSummary describes the devices and properties known after SyncProperties.
+type SyncSummary struct {
+	// Devices maps each device name to its property names, in the order they were defined.
+	Devices map[string][]string `json:"devices"`
+	// Properties is the total number of properties.
+	Properties int `json:"properties"`
+	// Elapsed is how long the sync took.
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// syncRequest is a SyncProperties call in flight, shared by every caller that arrives before it finishes.
+type syncRequest struct {
+	done    chan struct{}
+	summary SyncSummary
+}
+
+// SyncProperties asks indiserver for all property definitions, and returns once the initial burst of definitions has
+// settled: no new definition has arrived for settle (DefaultSyncSettle if zero), and every message already received
+// from indiserver has been processed. After it returns, it is safe to start sending commands.
+//
+// Concurrent calls share a single getProperties, and all return the same summary. Cancelling ctx only stops the
+// caller from waiting.
+func (c *INDIClient) SyncProperties(ctx context.Context, settle time.Duration) (SyncSummary, error) {
+	if !c.IsConnected() {
+		return SyncSummary{}, ErrNotConnected
+	}
+
+	if settle <= 0 {
+		settle = DefaultSyncSettle
+	}
+
+	c.syncMu.Lock()
+	req := c.syncing
+	if req == nil {
+		req = &syncRequest{done: make(chan struct{})}
+		c.syncing = req
+
+		events, id, err := c.Subscribe(SubscribeOptions{Types: []EventType{EventTypeDefine}})
+		if err != nil {
+			c.syncing = nil
+			c.syncMu.Unlock()
+			return SyncSummary{}, err
+		}
+
+		if err := c.GetProperties("", ""); err != nil {
+			c.Unsubscribe(id)
+			c.syncing = nil
+			c.syncMu.Unlock()
+			return SyncSummary{}, err
+		}
+
+		go c.waitForSync(req, events, id, settle)
+	}
+	c.syncMu.Unlock()
+
+	select {
+	case <-req.done:
+		return req.summary, nil
+	case <-ctx.Done():
+		return SyncSummary{}, ctx.Err()
+	}
+}
+
+func (c *INDIClient) waitForSync(req *syncRequest, events <-chan Event, id string, settle time.Duration) {
+	clock := c.Clock()
+
+	start := clock.Now()
+	last := start
+
+	tick := clock.After(settle / 10)
+
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				c.finishSync(req, start)
+				return
+			}
+			last = clock.Now()
+		case <-tick:
+			if clock.Now().Sub(last) >= settle && c.readQueueDepth() == 0 {
+				c.Unsubscribe(id)
+				c.finishSync(req, start)
+				return
+			}
+			tick = clock.After(settle / 10)
+		}
+	}
+}
+
+func (c *INDIClient) finishSync(req *syncRequest, start time.Time) {
+	summary := SyncSummary{
+		Devices: map[string][]string{},
+		Elapsed: c.now().Sub(start),
+	}
+
+	c.rwm.RLock()
+	for name, device := range c.devices {
+		summary.Devices[c.aliasDevice(name)] = append([]string{}, device.PropertyOrder...)
+		summary.Properties += len(device.PropertyOrder)
+	}
+	c.rwm.RUnlock()
+
+	req.summary = summary
+
+	c.syncMu.Lock()
+	c.syncing = nil
+	c.syncMu.Unlock()
+
+	close(req.done)
+}
+
+// readQueueDepth is the number of messages received from indiserver that have not been processed yet.
+func (c *INDIClient) readQueueDepth() int {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	if c.session == nil {
+		return 0
+	}
+
+	return len(c.session.read)
+}
@@ -0,0 +1,57 @@
+package indiclient
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidTimestamp is returned when a timestamp attribute cannot be parsed.
+var ErrInvalidTimestamp = errors.New("invalid timestamp")
+
+// timestampLayouts are the ISO 8601 variants drivers send. Fractional seconds of any length are accepted after the
+// seconds by time.Parse, so they are not listed.
+var timestampLayouts = []string{
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05Z07",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// ParseTimestamp parses the timestamp attribute of an INDI element. The protocol specifies UTC in the form
+// YYYY-MM-DDTHH:MM:SS.S, but drivers send many ISO 8601 variants: with or without fractional seconds, with a Z suffix
+// or a UTC offset, with a space instead of the T, or without seconds. Timestamps without an offset are UTC.
+func ParseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if len(s) > 10 && s[10] == ' ' {
+		s = s[:10] + "T" + s[11:]
+	}
+
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, ErrInvalidTimestamp
+}
+
+// parseTimestamp parses the timestamp attribute of an inbound vector, falling back to the current time if it is
+// missing or cannot be parsed.
+func (c *INDIClient) parseTimestamp(s string) time.Time {
+	if len(strings.TrimSpace(s)) == 0 {
+		return c.now()
+	}
+
+	t, err := ParseTimestamp(s)
+	if err != nil {
+		c.log.WithField("timestamp", s).WithError(err).Warn("error in ParseTimestamp")
+		return c.now()
+	}
+
+	return t
+}
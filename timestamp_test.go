@@ -0,0 +1,39 @@
+package indiclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected time.Time
+	}{
+		{"2020-03-14T01:02:03", time.Date(2020, 3, 14, 1, 2, 3, 0, time.UTC)},
+		{"2020-03-14T01:02:03.5", time.Date(2020, 3, 14, 1, 2, 3, 500000000, time.UTC)},
+		{"2020-03-14T01:02:03.123456", time.Date(2020, 3, 14, 1, 2, 3, 123456000, time.UTC)},
+		{"2020-03-14T01:02:03Z", time.Date(2020, 3, 14, 1, 2, 3, 0, time.UTC)},
+		{"2020-03-14T01:02:03.25Z", time.Date(2020, 3, 14, 1, 2, 3, 250000000, time.UTC)},
+		{"2020-03-14T01:02:03+02:00", time.Date(2020, 3, 13, 23, 2, 3, 0, time.UTC)},
+		{"2020-03-14T01:02:03-0530", time.Date(2020, 3, 14, 6, 32, 3, 0, time.UTC)},
+		{"2020-03-14T01:02:03+01", time.Date(2020, 3, 14, 0, 2, 3, 0, time.UTC)},
+		{"2020-03-14 01:02:03", time.Date(2020, 3, 14, 1, 2, 3, 0, time.UTC)},
+		{"2020-03-14T01:02", time.Date(2020, 3, 14, 1, 2, 0, 0, time.UTC)},
+		{" 2020-03-14T01:02:03 ", time.Date(2020, 3, 14, 1, 2, 3, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			actual, err := ParseTimestamp(tt.in)
+			require.NoError(t, err)
+			assert.True(t, tt.expected.Equal(actual), "expected %s, got %s", tt.expected, actual)
+		})
+	}
+
+	_, err := ParseTimestamp("yesterday")
+	assert.Equal(t, ErrInvalidTimestamp, err)
+}
@@ -0,0 +1,184 @@
+package indiclient
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tracer creates spans for INDI transactions. Its shape follows the OpenTelemetry tracing API, so an OpenTelemetry
+// tracer can be plugged in with a small adapter, without this package (or its users who don't trace) depending on
+// OpenTelemetry:
+//
+//	type otelTracer struct{ t trace.Tracer }
+//
+//	func (o otelTracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, indiclient.Span) {
+//		ctx, span := o.t.Start(ctx, name)
+//		for k, v := range attrs {
+//			span.SetAttributes(attribute.String(k, v))
+//		}
+//		return ctx, otelSpan{span}
+//	}
+type Tracer interface {
+	// Start begins a span named name with the given attributes, as a child of the span in ctx if there is one, and
+	// returns ctx with the new span in it. ctx is SetOptions.Context, or the ctx of a method such as CaptureFrame or
+	// ApplyEquipment, and context.Background() otherwise.
+	Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span)
+}
+
+// Span is a single traced operation.
+type Span interface {
+	// AddEvent records something that happened during the span, such as a state change reported by the device.
+	AddEvent(name string, attrs map[string]string)
+	// SetError marks the span as failed.
+	SetError(err error)
+	// End completes the span.
+	End()
+}
+
+// Span attributes set by the client.
+const (
+	SpanAttrDevice        = "indi.device"
+	SpanAttrProperty      = "indi.property"
+	SpanAttrElements      = "indi.elements"
+	SpanAttrState         = "indi.state"
+	SpanAttrMessage       = "indi.message"
+	SpanAttrSize          = "indi.blob.size"
+	SpanAttrFormat        = "indi.blob.format"
+	SpanAttrCorrelationID = "indi.correlation_id"
+)
+
+type nopSpan struct{}
+
+func (nopSpan) AddEvent(string, map[string]string) {}
+func (nopSpan) SetError(error)                     {}
+func (nopSpan) End()                               {}
+
+// SetTracer sets the Tracer used to trace commands sent to indiserver and BLOBs received from it. Set*Value calls
+// create a span that records the command being sent, each state the device reports for the property (usually Busy,
+// then Ok or Alert), and ends when the call returns. Passing nil disables tracing, which is the default.
+func (c *INDIClient) SetTracer(t Tracer) {
+	c.tracerMu.Lock()
+	defer c.tracerMu.Unlock()
+
+	c.tracer = t
+}
+
+// startSpan starts a span in ctx, which may be nil.
+func (c *INDIClient) startSpan(ctx context.Context, name string, attrs map[string]string) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	c.tracerMu.RLock()
+	defer c.tracerMu.RUnlock()
+
+	if c.tracer == nil {
+		return ctx, nopSpan{}
+	}
+
+	return c.tracer.Start(ctx, name, attrs)
+}
+
+// transaction is a command in flight, from the new*Vector being sent until the device reports Ok or Alert.
+type transaction struct {
+	deviceName string
+	propName   string
+	span       Span
+	entry      *AuditEntry
+	start      time.Time
+	answered   bool  // Protected by INDIClient.rwm
+	abort      error // Protected by INDIClient.rwm
+}
+
+// startTransaction starts a span in ctx and an audit entry for cmd, which must be one of the new*Vector types. State
+// updates received for the property are added to both until endTransaction is called.
+func (c *INDIClient) startTransaction(ctx context.Context, name string, cmd interface{}) *transaction {
+	entry := c.newAuditEntry(cmd)
+
+	names := make([]string, 0, len(entry.Values))
+	for k := range entry.Values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	_, span := c.startSpan(ctx, name, map[string]string{
+		SpanAttrDevice:        entry.Device,
+		SpanAttrProperty:      entry.Property,
+		SpanAttrElements:      strings.Join(names, ","),
+		SpanAttrCorrelationID: entry.ID,
+	})
+
+	tx := &transaction{
+		deviceName: entry.Device,
+		propName:   entry.Property,
+		entry:      entry,
+		start:      c.now(),
+		span:       span,
+	}
+
+	c.transactions.Store(transactionKey(entry.Device, entry.Property), tx)
+
+	return tx
+}
+
+// sent records that the command has been queued for indiserver.
+func (tx *transaction) sent() {
+	tx.span.AddEvent("sent", nil)
+}
+
+// traceState adds the state reported by a set*Vector for deviceName.propName to any command in flight.
+func (c *INDIClient) traceState(deviceName, propName string, state PropertyState, message string) {
+	v, ok := c.transactions.Load(transactionKey(deviceName, propName))
+	if !ok {
+		return
+	}
+
+	tx := v.(*transaction)
+
+	attrs := map[string]string{SpanAttrState: string(state)}
+	if len(message) > 0 {
+		attrs[SpanAttrMessage] = message
+	}
+
+	tx.span.AddEvent("state", attrs)
+
+	if !tx.answered {
+		tx.answered = true
+		c.stats.answered(c.now().Sub(tx.start))
+	}
+
+	c.auditTransition(tx.entry, state, message)
+}
+
+func (c *INDIClient) endTransaction(tx *transaction, err error) {
+	c.transactions.Delete(transactionKey(tx.deviceName, tx.propName))
+
+	c.auditComplete(tx.entry, err)
+
+	if err != nil {
+		tx.span.SetError(err)
+	}
+
+	tx.span.End()
+}
+
+// abortTransactions makes the Set*Value calls waiting for propName of deviceName fail with err, since their answer
+// will not come. An empty propName matches every property of the device, and an empty deviceName every device. Only
+// call when INDIClient.rwm is locked.
+func (c *INDIClient) abortTransactions(deviceName, propName string, err error) {
+	c.transactions.Range(func(_, v interface{}) bool {
+		tx := v.(*transaction)
+
+		if (len(deviceName) == 0 || tx.deviceName == deviceName) && (len(propName) == 0 || tx.propName == propName) && tx.abort == nil {
+			tx.abort = err
+		}
+
+		return true
+	})
+}
+
+func transactionKey(deviceName, propName string) string {
+	return deviceName + "." + propName
+}
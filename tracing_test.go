@@ -0,0 +1,143 @@
+package indiclient_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/rickbassham/logging"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient"
+	"github.com/goastro/indiclient/internal/testutil"
+	"github.com/goastro/indiclient/simulators"
+)
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+// spanKey is the context key recordingTracer keeps the current span under.
+type spanKey struct{}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, indiclient.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := &recordingSpan{name: name, attrs: attrs}
+	s.parent, _ = ctx.Value(spanKey{}).(*recordingSpan)
+	t.spans = append(t.spans, s)
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (t *recordingTracer) find(name string) *recordingSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range t.spans {
+		if s.name == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
+type recordingSpan struct {
+	mu     sync.Mutex
+	name   string
+	parent *recordingSpan
+	attrs  map[string]string
+	events []string
+	err    error
+	ended  bool
+}
+
+func (s *recordingSpan) AddEvent(name string, attrs map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state, ok := attrs[indiclient.SpanAttrState]; ok {
+		name = fmt.Sprintf("%s=%s", name, state)
+	}
+
+	s.events = append(s.events, name)
+}
+
+func (s *recordingSpan) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+func (s *recordingSpan) End() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ended = true
+}
+
+func Test_Tracer_SetNumberValue(t *testing.T) {
+	log := logging.NewLogger(os.Stdout, logging.JSONFormatter{}, logging.LogLevelError)
+	server := simulators.NewServer(simulators.NewFocuser("Focuser Simulator"))
+
+	tracer := &recordingTracer{}
+
+	c := indiclient.NewINDIClient(log, server, afero.NewMemMapFs(), 100)
+	c.SetTracer(tracer)
+
+	err := c.Connect("tcp", "localhost:7624")
+	require.NoError(t, err)
+	defer c.Disconnect()
+
+	err = c.GetProperties("", "")
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return c.SwitchPropertySet("Focuser Simulator", "CONNECTION") })
+
+	err = c.SetSwitchValue("Focuser Simulator", "CONNECTION", []string{"CONNECT"}, []indiclient.SwitchState{indiclient.SwitchStateOn})
+	require.NoError(t, err)
+
+	testutil.WaitFor(t, func() bool { return c.NumberPropertySet("Focuser Simulator", "ABS_FOCUS_POSITION") })
+
+	err = c.SetNumberValue("Focuser Simulator", "ABS_FOCUS_POSITION", []string{"FOCUS_ABSOLUTE_POSITION"}, []string{"50100"})
+	require.NoError(t, err)
+
+	span := tracer.find("SetNumberValue")
+	require.NotNil(t, span)
+
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	assert.Equal(t, "Focuser Simulator", span.attrs[indiclient.SpanAttrDevice])
+	assert.Equal(t, "ABS_FOCUS_POSITION", span.attrs[indiclient.SpanAttrProperty])
+	assert.Equal(t, "FOCUS_ABSOLUTE_POSITION", span.attrs[indiclient.SpanAttrElements])
+	assert.Equal(t, "sent", span.events[0])
+	assert.Contains(t, span.events, "state=Busy")
+	assert.Equal(t, "state=Ok", span.events[len(span.events)-1])
+	assert.NoError(t, span.err)
+	assert.True(t, span.ended)
+
+	assert.NotNil(t, tracer.find("GetProperties"))
+	assert.Nil(t, span.parent)
+
+	// SetOptions.Context makes the call's span a child of the caller's.
+	ctx, parent := tracer.Start(context.Background(), "focus", nil)
+
+	err = c.SetNumberValueWithOptions("Focuser Simulator", "ABS_FOCUS_POSITION", []string{"FOCUS_ABSOLUTE_POSITION"}, []string{"50200"}, indiclient.SetOptions{Context: ctx})
+	require.NoError(t, err)
+
+	tracer.mu.Lock()
+	child := tracer.spans[len(tracer.spans)-1]
+	tracer.mu.Unlock()
+
+	assert.Equal(t, "SetNumberValue", child.name)
+	assert.Equal(t, parent, child.parent)
+}
@@ -0,0 +1,188 @@
+package indiclient
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TransactionOptions controls how a Transaction is committed.
+type TransactionOptions struct {
+	// BestEffort sends every command, even if some are not valid for the device tree. Otherwise every command is
+	// checked first, as DryRunNumberValue etc. would, and nothing is sent unless they all pass.
+	BestEffort bool
+}
+
+// transactionCommand is a command queued in a Transaction.
+type transactionCommand struct {
+	device   string
+	property string
+	check    func() error
+	send     func() error
+}
+
+// Transaction queues commands to any number of devices and sends them together with Commit, for example to apply an
+// equipment profile. Commands to different properties are sent at once, and commands to the same property one after
+// another, in the order they were queued. A Transaction is not safe for concurrent use.
+type Transaction struct {
+	c        *INDIClient
+	opts     TransactionOptions
+	commands []transactionCommand
+}
+
+// TransactionError is returned by Commit when any command of a Transaction fails. Use errors.Is and errors.As on the
+// errors in Errors to branch on their causes; errors.Is and errors.As on the TransactionError itself only see the
+// first of them.
+type TransactionError struct {
+	// Errors are the errors of the failed commands, usually *SetError, in the order the commands were queued.
+	Errors []error
+	// Sent is false if the commands were checked before sending and none were sent.
+	Sent bool
+	// Total is the number of commands in the transaction.
+	Total int
+}
+
+func (e *TransactionError) Error() string {
+	b := strings.Builder{}
+
+	b.WriteString("indiclient: ")
+	b.WriteString(strconv.Itoa(len(e.Errors)))
+	b.WriteString(" of ")
+	b.WriteString(strconv.Itoa(e.Total))
+	b.WriteString(" commands failed")
+
+	if !e.Sent {
+		b.WriteString(", none sent")
+	}
+
+	for _, err := range e.Errors {
+		b.WriteString("; ")
+		b.WriteString(err.Error())
+	}
+
+	return b.String()
+}
+
+// Unwrap returns the first error.
+func (e *TransactionError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e.Errors[0]
+}
+
+// NewTransaction returns an empty Transaction.
+func (c *INDIClient) NewTransaction(opts TransactionOptions) *Transaction {
+	return &Transaction{c: c, opts: opts}
+}
+
+// SetTextValue queues SetTextValue.
+func (tx *Transaction) SetTextValue(deviceName, propName string, textNames, textValues []string) {
+	tx.add(deviceName, propName, func() error {
+		_, err := tx.c.DryRunTextValue(deviceName, propName, textNames, textValues)
+		return err
+	}, func() error {
+		return tx.c.SetTextValue(deviceName, propName, textNames, textValues)
+	})
+}
+
+// SetNumberValue queues SetNumberValue.
+func (tx *Transaction) SetNumberValue(deviceName, propName string, numberNames, numberValues []string) {
+	tx.add(deviceName, propName, func() error {
+		_, err := tx.c.DryRunNumberValue(deviceName, propName, numberNames, numberValues)
+		return err
+	}, func() error {
+		return tx.c.SetNumberValue(deviceName, propName, numberNames, numberValues)
+	})
+}
+
+// SetSwitchValue queues SetSwitchValue.
+func (tx *Transaction) SetSwitchValue(deviceName, propName string, switchNames []string, switchValues []SwitchState) {
+	tx.add(deviceName, propName, func() error {
+		_, err := tx.c.DryRunSwitchValue(deviceName, propName, switchNames, switchValues)
+		return err
+	}, func() error {
+		return tx.c.SetSwitchValue(deviceName, propName, switchNames, switchValues)
+	})
+}
+
+// Len returns the number of queued commands.
+func (tx *Transaction) Len() int {
+	return len(tx.commands)
+}
+
+func (tx *Transaction) add(deviceName, propName string, check, send func() error) {
+	tx.commands = append(tx.commands, transactionCommand{
+		device:   tx.c.resolveDevice(deviceName),
+		property: propName,
+		check:    check,
+		send:     send,
+	})
+}
+
+// Commit sends the queued commands, and waits for every property to reach Ok, as the Set*Value methods do. It returns
+// a *TransactionError if any command fails. Commands that have been sent are not undone when others fail. The
+// transaction keeps its commands, so it can be committed again.
+func (tx *Transaction) Commit() error {
+	errs := make([]error, len(tx.commands))
+
+	if !tx.opts.BestEffort {
+		failed := false
+		for i, cmd := range tx.commands {
+			if err := cmd.check(); err != nil {
+				if _, ok := err.(*DryRunError); !ok {
+					errs[i] = err
+					failed = true
+				}
+			}
+		}
+
+		if failed {
+			return tx.result(errs, false)
+		}
+	}
+
+	// Each property gets its own goroutine, which sends its commands in order.
+	order := []string{}
+	byProperty := map[string][]int{}
+	for i, cmd := range tx.commands {
+		key := cmd.device + "_" + cmd.property
+		if _, ok := byProperty[key]; !ok {
+			order = append(order, key)
+		}
+		byProperty[key] = append(byProperty[key], i)
+	}
+
+	var wg sync.WaitGroup
+	for _, key := range order {
+		wg.Add(1)
+		go func(indexes []int) {
+			defer wg.Done()
+
+			for _, i := range indexes {
+				errs[i] = tx.commands[i].send()
+			}
+		}(byProperty[key])
+	}
+	wg.Wait()
+
+	return tx.result(errs, true)
+}
+
+// result returns a *TransactionError for errs, or nil if they are all nil.
+func (tx *Transaction) result(errs []error, sent bool) error {
+	e := &TransactionError{Sent: sent, Total: len(errs)}
+
+	for _, err := range errs {
+		if err != nil {
+			e.Errors = append(e.Errors, err)
+		}
+	}
+
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e
+}
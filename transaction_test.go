@@ -0,0 +1,129 @@
+package indiclient
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func defineFocuser(c *INDIClient) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.defNumberVector(&DefNumberVector{
+		Device:  "Focuser",
+		Name:    "ABS_FOCUS_POSITION",
+		State:   PropertyStateIdle,
+		Perm:    PropertyPermissionReadWrite,
+		Numbers: []DefNumber{{Name: "FOCUS_ABSOLUTE_POSITION", Value: "0"}},
+	})
+}
+
+// answerCommands answers every number command with Ok, except those to the property alert, which get Alert.
+func answerCommands(c *INDIClient, alert string) {
+	go func() {
+		for cmd := range c.write {
+			n, ok := cmd.(NewNumberVector)
+			if !ok {
+				continue
+			}
+
+			state := PropertyStateOk
+			if n.Name == alert {
+				state = PropertyStateAlert
+			}
+
+			c.rwm.Lock()
+			c.setNumberVector(&SetNumberVector{Device: n.Device, Name: n.Name, State: state, Numbers: n.Numbers})
+			c.rwm.Unlock()
+		}
+	}()
+}
+
+func Test_Transaction(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	defer close(c.write)
+
+	c.rwm.Lock()
+	defineCoords(c)
+	c.rwm.Unlock()
+	defineFocuser(c)
+
+	answerCommands(c, "")
+
+	tx := c.NewTransaction(TransactionOptions{})
+	tx.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"})
+	tx.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"DEC"}, []string{"2"})
+	tx.SetNumberValue("Focuser", "ABS_FOCUS_POSITION", []string{"FOCUS_ABSOLUTE_POSITION"}, []string{"1000"})
+	assert.Equal(t, 3, tx.Len())
+
+	require.NoError(t, tx.Commit())
+
+	coords, err := c.GetNumberProperty("Mount", "EQUATORIAL_EOD_COORD")
+	require.NoError(t, err)
+	assert.Equal(t, "1", coords.Values["RA"].Value)
+	assert.Equal(t, "2", coords.Values["DEC"].Value)
+
+	pos, err := c.GetNumber("Focuser", "ABS_FOCUS_POSITION", "FOCUS_ABSOLUTE_POSITION")
+	require.NoError(t, err)
+	assert.Equal(t, "1000", pos.Value)
+}
+
+func Test_Transaction_Checked(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+
+	defineFocuser(c)
+
+	tx := c.NewTransaction(TransactionOptions{})
+	tx.SetNumberValue("Focuser", "ABS_FOCUS_POSITION", []string{"FOCUS_ABSOLUTE_POSITION"}, []string{"1000"})
+	tx.SetSwitchValue("Focuser", "FOCUS_MOTION", []string{"FOCUS_INWARD"}, []SwitchState{SwitchStateOn})
+
+	err := tx.Commit()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrPropertyNotFound))
+
+	var txErr *TransactionError
+	require.True(t, errors.As(err, &txErr))
+	assert.False(t, txErr.Sent)
+	assert.Len(t, txErr.Errors, 1)
+	assert.Equal(t, 2, txErr.Total)
+
+	// Nothing was sent.
+	assert.Empty(t, c.write)
+}
+
+func Test_Transaction_BestEffort(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+	defer close(c.write)
+
+	c.rwm.Lock()
+	defineCoords(c)
+	c.rwm.Unlock()
+	defineFocuser(c)
+
+	answerCommands(c, "EQUATORIAL_EOD_COORD")
+
+	tx := c.NewTransaction(TransactionOptions{BestEffort: true})
+	tx.SetNumberValue("Mount", "EQUATORIAL_EOD_COORD", []string{"RA"}, []string{"1"})
+	tx.SetSwitchValue("Focuser", "FOCUS_MOTION", []string{"FOCUS_INWARD"}, []SwitchState{SwitchStateOn})
+	tx.SetNumberValue("Focuser", "ABS_FOCUS_POSITION", []string{"FOCUS_ABSOLUTE_POSITION"}, []string{"1000"})
+
+	err := tx.Commit()
+
+	var txErr *TransactionError
+	require.True(t, errors.As(err, &txErr))
+	assert.True(t, txErr.Sent)
+	require.Len(t, txErr.Errors, 2)
+	assert.True(t, errors.Is(txErr.Errors[0], ErrPropertyAlert))
+	assert.True(t, errors.Is(txErr.Errors[1], ErrPropertyNotFound))
+	assert.Contains(t, err.Error(), "2 of 3 commands failed")
+
+	pos, err := c.GetNumber("Focuser", "ABS_FOCUS_POSITION", "FOCUS_ABSOLUTE_POSITION")
+	require.NoError(t, err)
+	assert.Equal(t, "1000", pos.Value)
+}
@@ -0,0 +1,159 @@
+package indiclient
+
+import (
+	"strings"
+)
+
+// Value is an element of any type of property, so code that only displays values, such as logging or a command line
+// tool, does not need a case for each type.
+//
+// The methods are ElementName and ElementLabel, rather than Name and Label, because the value types already have
+// fields with those names.
+type Value interface {
+	ElementName() string
+	ElementLabel() string
+	// String returns the value as indi_getprop would print it.
+	String() string
+}
+
+// ElementName returns the name of the element.
+func (v TextValue) ElementName() string { return v.Name }
+
+// ElementLabel returns the label of the element.
+func (v TextValue) ElementLabel() string { return v.Label }
+
+// String returns the text.
+func (v TextValue) String() string { return v.Value }
+
+// ElementName returns the name of the element.
+func (v NumberValue) ElementName() string { return v.Name }
+
+// ElementLabel returns the label of the element.
+func (v NumberValue) ElementLabel() string { return v.Label }
+
+// String returns the number as the driver sent it, without padding.
+func (v NumberValue) String() string { return strings.TrimSpace(v.Value) }
+
+// ElementName returns the name of the element.
+func (v SwitchValue) ElementName() string { return v.Name }
+
+// ElementLabel returns the label of the element.
+func (v SwitchValue) ElementLabel() string { return v.Label }
+
+// String returns On or Off.
+func (v SwitchValue) String() string { return string(v.Value) }
+
+// ElementName returns the name of the element.
+func (v LightValue) ElementName() string { return v.Name }
+
+// ElementLabel returns the label of the element.
+func (v LightValue) ElementLabel() string { return v.Label }
+
+// String returns the state of the light, such as Ok or Alert.
+func (v LightValue) String() string { return string(v.Value) }
+
+// ElementName returns the name of the element.
+func (v BlobValue) ElementName() string { return v.Name }
+
+// ElementLabel returns the label of the element.
+func (v BlobValue) ElementLabel() string { return v.Label }
+
+// String returns the name of the file the BLOB was saved to.
+func (v BlobValue) String() string { return v.Value }
+
+// Elements returns the values of p in the order the driver defined them.
+func (p TextProperty) Elements() []Value {
+	values := make([]Value, 0, len(p.Order))
+	for _, n := range p.Order {
+		values = append(values, p.Values[n])
+	}
+	return values
+}
+
+// Elements returns the values of p in the order the driver defined them.
+func (p NumberProperty) Elements() []Value {
+	values := make([]Value, 0, len(p.Order))
+	for _, n := range p.Order {
+		values = append(values, p.Values[n])
+	}
+	return values
+}
+
+// Elements returns the values of p in the order the driver defined them.
+func (p SwitchProperty) Elements() []Value {
+	values := make([]Value, 0, len(p.Order))
+	for _, n := range p.Order {
+		values = append(values, p.Values[n])
+	}
+	return values
+}
+
+// Elements returns the values of p in the order the driver defined them.
+func (p LightProperty) Elements() []Value {
+	values := make([]Value, 0, len(p.Order))
+	for _, n := range p.Order {
+		values = append(values, p.Values[n])
+	}
+	return values
+}
+
+// Elements returns the values of p in the order the driver defined them.
+func (p BlobProperty) Elements() []Value {
+	values := make([]Value, 0, len(p.Order))
+	for _, n := range p.Order {
+		values = append(values, p.Values[n])
+	}
+	return values
+}
+
+// Elements returns the values of the property name, of any type, in the order the driver defined them.
+func (d Device) Elements(name string) ([]Value, bool) {
+	if p, ok := d.TextProperties[name]; ok {
+		return p.Elements(), true
+	}
+
+	if p, ok := d.NumberProperties[name]; ok {
+		return p.Elements(), true
+	}
+
+	if p, ok := d.SwitchProperties[name]; ok {
+		return p.Elements(), true
+	}
+
+	if p, ok := d.LightProperties[name]; ok {
+		return p.Elements(), true
+	}
+
+	if p, ok := d.BlobProperties[name]; ok {
+		return p.Elements(), true
+	}
+
+	return nil, false
+}
+
+// FormatProperty formats values the way indi_getprop does, one "device.property.element=value" line per element, such
+// as:
+//
+//	Mount.EQUATORIAL_EOD_COORD.RA=5.5
+//	Mount.EQUATORIAL_EOD_COORD.DEC=-10
+//
+// The lines are separated, but not terminated, by a newline.
+func FormatProperty(deviceName, propName string, values []Value) string {
+	var sb strings.Builder
+
+	for i, v := range values {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+
+		sb.WriteString(deviceName)
+		sb.WriteByte('.')
+		sb.WriteString(propName)
+		sb.WriteByte('.')
+		sb.WriteString(v.ElementName())
+		sb.WriteByte('=')
+		sb.WriteString(v.String())
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,44 @@
+package indiclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Value(t *testing.T) {
+	values := []Value{
+		TextValue{Name: "NAME", Label: "Name", Value: "Mount"},
+		NumberValue{Name: "RA", Label: "RA (hh:mm:ss)", Value: "  5:30:00"},
+		SwitchValue{Name: "CONNECT", Label: "Connect", Value: SwitchStateOn},
+		LightValue{Name: "RAIN", Label: "Rain", Value: PropertyStateAlert},
+		BlobValue{Name: "CCD1", Label: "Image", Value: "/tmp/ccd1.fits"},
+	}
+
+	expected := []string{"Mount", "5:30:00", "On", "Alert", "/tmp/ccd1.fits"}
+
+	for i, v := range values {
+		assert.NotEmpty(t, v.ElementName())
+		assert.NotEmpty(t, v.ElementLabel())
+		assert.Equal(t, expected[i], v.String())
+	}
+}
+
+func Test_FormatProperty(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+	setCoords(c, "5.5")
+
+	device, err := c.GetDevice("Mount")
+	require.NoError(t, err)
+
+	values, ok := device.Elements("EQUATORIAL_EOD_COORD")
+	require.True(t, ok)
+	assert.Equal(t, "Mount.EQUATORIAL_EOD_COORD.RA=5.5\nMount.EQUATORIAL_EOD_COORD.DEC=0", FormatProperty("Mount", "EQUATORIAL_EOD_COORD", values))
+
+	_, ok = device.Elements("MISSING")
+	assert.False(t, ok)
+
+	assert.Equal(t, "", FormatProperty("Mount", "EQUATORIAL_EOD_COORD", nil))
+}
@@ -0,0 +1,94 @@
+package indiclient
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DefaultProtocolVersion is the version of the INDI protocol the client sends in getProperties, unless changed with
+// SetProtocolVersion.
+const DefaultProtocolVersion = "1.7"
+
+// SetProtocolVersion sets the version of the INDI protocol the client sends in getProperties, for servers that expect a
+// different one. An empty version restores DefaultProtocolVersion. It takes effect on the next call to GetProperties.
+func (c *INDIClient) SetProtocolVersion(version string) {
+	if len(version) == 0 {
+		version = DefaultProtocolVersion
+	}
+
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.protocolVersion = version
+}
+
+// ClientProtocolVersion returns the version of the INDI protocol the client sends in getProperties.
+func (c *INDIClient) ClientProtocolVersion() string {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.clientVersion()
+}
+
+// ServerProtocolVersion returns the version of the INDI protocol the server sent in the version attribute of its own
+// getProperties, or an empty string if it has not sent one since the client connected. Not all servers do.
+func (c *INDIClient) ServerProtocolVersion() string {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	return c.serverVersion
+}
+
+// ProtocolVersion returns the version of the INDI protocol both ends understand: the lower of the client and server
+// versions, or the client version if the server has not sent one.
+func (c *INDIClient) ProtocolVersion() string {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+
+	if len(c.serverVersion) > 0 && compareVersions(c.serverVersion, c.clientVersion()) < 0 {
+		return c.serverVersion
+	}
+
+	return c.clientVersion()
+}
+
+// getProperties records the version of a getProperties sent by the server, which drivers send to snoop on other
+// devices. Modifies INDIClient.serverVersion. Only call when INDIClient.rwm is locked.
+func (c *INDIClient) getProperties(item *GetProperties) {
+	if len(item.Version) == 0 {
+		return
+	}
+
+	if c.serverVersion != item.Version {
+		c.log.WithField("version", item.Version).Info("server protocol version")
+	}
+
+	c.serverVersion = item.Version
+}
+
+// compareVersions compares dotted version numbers such as "1.7" and "2.0", returning -1, 0 or 1 as a is lower than,
+// equal to or higher than b. Parts that are missing or not numbers count as 0.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+
+		if i < len(as) {
+			x, _ = strconv.Atoi(strings.TrimSpace(as[i]))
+		}
+
+		if i < len(bs) {
+			y, _ = strconv.Atoi(strings.TrimSpace(bs[i]))
+		}
+
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,39 @@
+package indiclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ProtocolVersion(t *testing.T) {
+	c := newTestClient()
+
+	assert.Equal(t, DefaultProtocolVersion, c.ClientProtocolVersion())
+	assert.Empty(t, c.ServerProtocolVersion())
+	assert.Equal(t, DefaultProtocolVersion, c.ProtocolVersion())
+
+	c.SetProtocolVersion("2.0")
+	assert.Equal(t, "2.0", c.ClientProtocolVersion())
+
+	items, errs := parseAll(`<getProperties version="1.7" device="Mount"/>`, DefaultParserLimits)
+	require.Empty(t, errs)
+	require.Len(t, items, 1)
+
+	c.getProperties(items[0].(*GetProperties))
+	assert.Equal(t, "1.7", c.ServerProtocolVersion())
+	assert.Equal(t, "1.7", c.ProtocolVersion())
+
+	c.SetProtocolVersion("")
+	c.getProperties(&GetProperties{Version: "1.10"})
+	assert.Equal(t, DefaultProtocolVersion, c.ProtocolVersion())
+}
+
+func Test_compareVersions(t *testing.T) {
+	assert.Equal(t, 0, compareVersions("1.7", "1.7"))
+	assert.Equal(t, 0, compareVersions("2", "2.0"))
+	assert.Equal(t, -1, compareVersions("1.7", "2.0"))
+	assert.Equal(t, 1, compareVersions("1.10", "1.7"))
+	assert.Equal(t, -1, compareVersions("", "1.7"))
+}
@@ -0,0 +1,193 @@
+package indiclient
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// VideoStreamProperty is the switch vector CCD drivers use to start and stop streaming video.
+	VideoStreamProperty = "CCD_VIDEO_STREAM"
+	// VideoStreamOn and VideoStreamOff are the switches of VideoStreamProperty.
+	VideoStreamOn  = "STREAM_ON"
+	VideoStreamOff = "STREAM_OFF"
+	// DefaultVideoBlobProperty is the BLOB vector CCD drivers send video frames on.
+	DefaultVideoBlobProperty = "CCD1"
+)
+
+// VideoFrame is a single frame of a video stream.
+type VideoFrame struct {
+	// Sequence counts the frames received from the driver, starting at 1. A gap in Sequence means frames were dropped
+	// because the reader fell behind.
+	Sequence uint64 `json:"sequence"`
+	// Name is the name of the BLOB element the frame was sent on.
+	Name string `json:"name"`
+	// Format is the format of the frame as sent by the driver, e.g. ".stream" for raw frames or ".stream_jpg".
+	Format    string    `json:"format"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      []byte    `json:"-"`
+}
+
+// VideoStreamStats counts the frames of a video stream.
+type VideoStreamStats struct {
+	// Received is the number of frames received from the driver.
+	Received uint64 `json:"received"`
+	// Delivered is the number of frames queued on the Frames channel.
+	Delivered uint64 `json:"delivered"`
+	// Dropped is the number of frames discarded because the Frames channel was full.
+	Dropped uint64 `json:"dropped"`
+}
+
+// VideoStreamOptions controls a stream started by StartVideoStreamWithOptions.
+type VideoStreamOptions struct {
+	// Buffer is the number of frames that can be queued for the reader before new frames are dropped. Defaults to the
+	// client's bufferSize.
+	Buffer int
+	// BlobProperty is the BLOB vector the driver sends frames on. Defaults to DefaultVideoBlobProperty.
+	BlobProperty string
+}
+
+// VideoStream delivers the frames of a CCD's video stream. Frames are never queued behind a slow reader: once the
+// buffer is full, new frames are dropped and counted in Stats, so live previews always show recent frames.
+type VideoStream struct {
+	// Accessed atomically, and first in the struct so they are 64-bit aligned.
+	received  uint64
+	delivered uint64
+	dropped   uint64
+
+	c      *INDIClient
+	device string
+	prop   string
+	id     string
+
+	// policy is the enableBLOB setting to restore when the stream stops.
+	policy BlobEnable
+
+	mu     sync.Mutex
+	frames chan VideoFrame
+	closed bool
+}
+
+// StartVideoStream enables BLOBs for the video frames of deviceName, turns on its CCD_VIDEO_STREAM and returns a
+// VideoStream delivering the frames. Remember to call Stop when you are done with it.
+func (c *INDIClient) StartVideoStream(deviceName string) (*VideoStream, error) {
+	return c.StartVideoStreamWithOptions(deviceName, VideoStreamOptions{})
+}
+
+// StartVideoStreamWithOptions is like StartVideoStream, but allows control over buffering and the BLOB vector frames
+// are sent on.
+func (c *INDIClient) StartVideoStreamWithOptions(deviceName string, opts VideoStreamOptions) (*VideoStream, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	if opts.Buffer <= 0 {
+		opts.Buffer = c.bufferSize
+	}
+
+	if len(opts.BlobProperty) == 0 {
+		opts.BlobProperty = DefaultVideoBlobProperty
+	}
+
+	c.rwm.RLock()
+	_, err := c.findSwitchProperty(deviceName, VideoStreamProperty, VideoStreamOn)
+	if err == nil {
+		if _, ok := c.devices[deviceName].BlobProperties[opts.BlobProperty]; !ok {
+			err = ErrPropertyNotFound
+		}
+	}
+	policy := blobPolicyFor(c.blobPolicies, deviceName, opts.BlobProperty)
+	c.rwm.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &VideoStream{
+		c:      c,
+		device: deviceName,
+		prop:   opts.BlobProperty,
+		policy: policy,
+		frames: make(chan VideoFrame, opts.Buffer),
+	}
+
+	s.id, err = c.OnBlob(deviceName, opts.BlobProperty, "", s.frame)
+	if err != nil {
+		return nil, err
+	}
+
+	// Frames are sent along with everything else, so property updates keep flowing while streaming.
+	if policy != BlobEnableAlso && policy != BlobEnableOnly && policy != BlobEnableURL {
+		if err := c.EnableBlob(deviceName, opts.BlobProperty, BlobEnableAlso); err != nil {
+			s.cleanup()
+			return nil, err
+		}
+	}
+
+	if err := c.SelectSwitch(deviceName, VideoStreamProperty, VideoStreamOn); err != nil {
+		s.cleanup()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Frames returns the channel frames are delivered on. It is closed when the stream stops.
+func (s *VideoStream) Frames() <-chan VideoFrame {
+	return s.frames
+}
+
+// Stats returns the frame counters of the stream.
+func (s *VideoStream) Stats() VideoStreamStats {
+	return VideoStreamStats{
+		Received:  atomic.LoadUint64(&s.received),
+		Delivered: atomic.LoadUint64(&s.delivered),
+		Dropped:   atomic.LoadUint64(&s.dropped),
+	}
+}
+
+// Stop turns off CCD_VIDEO_STREAM, restores the previous enableBLOB setting and closes the Frames channel. Frames
+// still in the channel can be read after Stop returns.
+func (s *VideoStream) Stop() error {
+	err := s.c.SelectSwitch(s.device, VideoStreamProperty, VideoStreamOff)
+
+	s.cleanup()
+
+	return err
+}
+
+// cleanup stops delivering frames and restores the previous enableBLOB setting.
+func (s *VideoStream) cleanup() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.frames)
+	s.mu.Unlock()
+
+	s.c.RemoveBlobHandler(s.id)
+
+	if s.policy != BlobEnableAlso && s.policy != BlobEnableOnly {
+		if err := s.c.EnableBlob(s.device, s.prop, s.policy); err != nil {
+			s.c.log.WithField("device", s.device).WithError(err).Warn("error restoring blob policy")
+		}
+	}
+}
+
+func (s *VideoStream) frame(e BlobEvent) {
+	seq := atomic.AddUint64(&s.received, 1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.frames <- VideoFrame{Sequence: seq, Name: e.Name, Format: e.Format, Timestamp: e.Timestamp, Data: e.data}:
+		atomic.AddUint64(&s.delivered, 1)
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
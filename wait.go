@@ -0,0 +1,129 @@
+package indiclient
+
+import (
+	"context"
+)
+
+// WaitForNumber blocks until the number element numberName of propName on deviceName satisfies predicate, and returns
+// its value. For example, to wait for a camera to cool down:
+//
+//	temp, err := c.WaitForNumber(ctx, "CCD Simulator", "CCD_TEMPERATURE", "CCD_TEMPERATURE_VALUE", func(v float64) bool { return v <= -10 })
+//
+// The device and property do not need to be defined yet; it keeps waiting until they are. It returns
+// ErrPropertyValueNotFound if the property is defined without the element, and ctx.Err() if ctx is done first.
+func (c *INDIClient) WaitForNumber(ctx context.Context, deviceName, propName, numberName string, predicate func(float64) bool) (float64, error) {
+	var value float64
+
+	err := c.waitForValue(ctx, deviceName, propName, func() (bool, error) {
+		v, err := c.GetNumber(deviceName, propName, numberName)
+		if err != nil {
+			return false, err
+		}
+
+		value, err = ParseNumber(v.Value)
+		if err != nil {
+			return false, err
+		}
+
+		return predicate(value), nil
+	})
+
+	return value, err
+}
+
+// WaitForSwitch blocks until the switch element switchName of propName on deviceName satisfies predicate, and returns
+// its value. See WaitForNumber.
+func (c *INDIClient) WaitForSwitch(ctx context.Context, deviceName, propName, switchName string, predicate func(SwitchState) bool) (SwitchState, error) {
+	var value SwitchState
+
+	err := c.waitForValue(ctx, deviceName, propName, func() (bool, error) {
+		v, err := c.GetSwitch(deviceName, propName, switchName)
+		if err != nil {
+			return false, err
+		}
+
+		value = v.Value
+
+		return predicate(value), nil
+	})
+
+	return value, err
+}
+
+// WaitForText blocks until the text element textName of propName on deviceName satisfies predicate, and returns its
+// value. See WaitForNumber.
+func (c *INDIClient) WaitForText(ctx context.Context, deviceName, propName, textName string, predicate func(string) bool) (string, error) {
+	var value string
+
+	err := c.waitForValue(ctx, deviceName, propName, func() (bool, error) {
+		v, err := c.GetText(deviceName, propName, textName)
+		if err != nil {
+			return false, err
+		}
+
+		value = v.Value
+
+		return predicate(value), nil
+	})
+
+	return value, err
+}
+
+// WaitForLight blocks until the light element lightName of propName on deviceName satisfies predicate, and returns its
+// value. See WaitForNumber.
+func (c *INDIClient) WaitForLight(ctx context.Context, deviceName, propName, lightName string, predicate func(PropertyState) bool) (PropertyState, error) {
+	var value PropertyState
+
+	err := c.waitForValue(ctx, deviceName, propName, func() (bool, error) {
+		prop, err := c.GetLightProperty(deviceName, propName)
+		if err != nil {
+			return false, err
+		}
+
+		v, ok := prop.Values[lightName]
+		if !ok {
+			return false, ErrPropertyValueNotFound
+		}
+
+		value = v.Value
+
+		return predicate(value), nil
+	})
+
+	return value, err
+}
+
+// waitForValue calls check now and each time propName of deviceName is defined or updated, until it returns true or
+// an error other than the device or property not being defined yet.
+func (c *INDIClient) waitForValue(ctx context.Context, deviceName, propName string, check func() (bool, error)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	events, id, err := c.Subscribe(SubscribeOptions{
+		Device:   deviceName,
+		Property: propName,
+		Types:    []EventType{EventTypeDefine, EventTypeUpdate},
+	})
+	if err != nil {
+		return err
+	}
+	defer c.Unsubscribe(id)
+
+	for {
+		ok, err := check()
+		if err != nil && err != ErrDeviceNotFound && err != ErrPropertyNotFound {
+			return err
+		}
+
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-events:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
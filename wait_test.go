@@ -0,0 +1,69 @@
+package indiclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WaitForNumber(t *testing.T) {
+	c := newTestClient()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The property is defined and updated after the wait starts.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+
+		c.rwm.Lock()
+		defineCoords(c)
+		c.rwm.Unlock()
+
+		for _, ra := range []string{"1", "2", "3"} {
+			time.Sleep(10 * time.Millisecond)
+
+			c.rwm.Lock()
+			setCoords(c, ra)
+			c.rwm.Unlock()
+		}
+	}()
+
+	ra, err := c.WaitForNumber(ctx, "Mount", "EQUATORIAL_EOD_COORD", "RA", func(v float64) bool { return v >= 2 })
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, ra)
+
+	// Already true.
+	ra, err = c.WaitForNumber(ctx, "Mount", "EQUATORIAL_EOD_COORD", "RA", func(v float64) bool { return v > 0 })
+	require.NoError(t, err)
+	assert.True(t, ra >= 2)
+
+	_, err = c.WaitForNumber(ctx, "Mount", "EQUATORIAL_EOD_COORD", "ALT", func(v float64) bool { return true })
+	assert.Equal(t, ErrPropertyValueNotFound, err)
+
+	short, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = c.WaitForNumber(short, "Mount", "EQUATORIAL_EOD_COORD", "RA", func(v float64) bool { return v < 0 })
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func Test_WaitForLight(t *testing.T) {
+	c := newTestClient()
+	defineWeather(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		setWeather(c, PropertyStateAlert)
+	}()
+
+	state, err := c.WaitForLight(ctx, "Weather", "WEATHER_STATUS", "WEATHER_RAIN_HAZARD", func(s PropertyState) bool { return s == PropertyStateAlert })
+	require.NoError(t, err)
+	assert.Equal(t, PropertyStateAlert, state)
+}
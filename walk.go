@@ -0,0 +1,96 @@
+package indiclient
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrStopWalk can be returned by the function passed to WalkDevices to stop walking without WalkDevices returning an
+// error.
+var ErrStopWalk = errors.New("stop walk")
+
+// DeviceView is a read-only view of a device, passed to the function given to WalkDevices. Every view in a walk is
+// taken from the same snapshot of the device tree, so they are consistent with each other, however the tree changes
+// during the walk.
+type DeviceView struct {
+	device Device
+}
+
+// Name returns the name of the device, or its alias.
+func (v DeviceView) Name() string {
+	return v.device.Name
+}
+
+// PropertyNames returns the names of the device's properties, in the order the driver defined them.
+func (v DeviceView) PropertyNames() []string {
+	return append([]string{}, v.device.PropertyOrder...)
+}
+
+// Property describes the property name, without its values.
+func (v DeviceView) Property(name string) (PropertyInfo, bool) {
+	return v.device.PropertyInfo(name)
+}
+
+// TextProperty returns a copy of the text property name.
+func (v DeviceView) TextProperty(name string) (TextProperty, bool) {
+	p, ok := v.device.TextProperties[name]
+	return p.Copy(), ok
+}
+
+// NumberProperty returns a copy of the number property name.
+func (v DeviceView) NumberProperty(name string) (NumberProperty, bool) {
+	p, ok := v.device.NumberProperties[name]
+	return p.Copy(), ok
+}
+
+// SwitchProperty returns a copy of the switch property name.
+func (v DeviceView) SwitchProperty(name string) (SwitchProperty, bool) {
+	p, ok := v.device.SwitchProperties[name]
+	return p.Copy(), ok
+}
+
+// LightProperty returns a copy of the light property name.
+func (v DeviceView) LightProperty(name string) (LightProperty, bool) {
+	p, ok := v.device.LightProperties[name]
+	return p.Copy(), ok
+}
+
+// BlobProperty returns a copy of the BLOB property name.
+func (v DeviceView) BlobProperty(name string) (BlobProperty, bool) {
+	p, ok := v.device.BlobProperties[name]
+	return p.Copy(), ok
+}
+
+// Messages returns the messages kept for the device, oldest first.
+func (v DeviceView) Messages() []MessageJSON {
+	return append([]MessageJSON{}, v.device.Messages...)
+}
+
+// Device returns a copy of the whole device.
+func (v DeviceView) Device() Device {
+	return v.device.Copy()
+}
+
+// WalkDevices calls fn for every device, sorted by name, until fn returns an error, which WalkDevices returns unless
+// it is ErrStopWalk. The devices are copied while the client is locked, and fn is called after it is unlocked, so fn
+// may call the client's methods; changes made or received during the walk are not seen by it.
+func (c *INDIClient) WalkDevices(fn func(DeviceView) error) error {
+	snapshot := c.Snapshot()
+
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := fn(DeviceView{device: snapshot[name]}); err != nil {
+			if err == ErrStopWalk {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return nil
+}
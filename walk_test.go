@@ -0,0 +1,61 @@
+package indiclient
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WalkDevices(t *testing.T) {
+	c := newTestClient()
+	defineCoords(c)
+	defineBlob(c)
+
+	names := []string{}
+
+	err := c.WalkDevices(func(v DeviceView) error {
+		names = append(names, v.Name())
+
+		if v.Name() == "Mount" {
+			assert.Equal(t, []string{"EQUATORIAL_EOD_COORD"}, v.PropertyNames())
+
+			// Changes during the walk are not seen by it.
+			c.rwm.Lock()
+			setCoords(c, "5")
+			c.rwm.Unlock()
+
+			prop, ok := v.NumberProperty("EQUATORIAL_EOD_COORD")
+			require.True(t, ok)
+			assert.Equal(t, "0", prop.Values["RA"].Value)
+
+			info, ok := v.Property("EQUATORIAL_EOD_COORD")
+			require.True(t, ok)
+			assert.Equal(t, PropertyTypeNumber, info.Type)
+
+			_, ok = v.TextProperty("EQUATORIAL_EOD_COORD")
+			assert.False(t, ok)
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Camera", "Mount"}, names)
+
+	ra, err := c.GetNumber("Mount", "EQUATORIAL_EOD_COORD", "RA")
+	require.NoError(t, err)
+	assert.Equal(t, "5", ra.Value)
+
+	calls := 0
+	err = c.WalkDevices(func(v DeviceView) error {
+		calls++
+		return ErrStopWalk
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	failed := errors.New("failed")
+	err = c.WalkDevices(func(v DeviceView) error { return failed })
+	assert.Equal(t, failed, err)
+}
@@ -0,0 +1,249 @@
+package indiclient
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// WatchdogHeartbeatProperty is the number vector of the INDI WatchDog driver that holds its heartbeat threshold,
+	// in minutes. Setting it, even to the same value, restarts the watchdog's timer; setting it to 0 disables it.
+	WatchdogHeartbeatProperty = "WATCHDOG_HEARTBEAT"
+	// WatchdogHeartbeatElement is the element of WatchdogHeartbeatProperty.
+	WatchdogHeartbeatElement = "WATCHDOG_HEARTBEAT_VALUE"
+
+	// DefaultWatchdogTimeout is how long the watchdog has to acknowledge a heartbeat, unless set in WatchdogOptions.
+	DefaultWatchdogTimeout = 10 * time.Second
+	// DefaultWatchdogInterval is how often heartbeats are sent when neither WatchdogOptions nor the driver give a
+	// heartbeat threshold to derive it from.
+	DefaultWatchdogInterval = time.Minute
+)
+
+// ErrWatchdogTimeout is passed to OnFailure handlers when the watchdog does not acknowledge a heartbeat in time.
+var ErrWatchdogTimeout = errors.New("watchdog did not acknowledge the heartbeat")
+
+// WatchdogOptions controls how a Watchdog keeps the INDI WatchDog driver from shutting the observatory down.
+type WatchdogOptions struct {
+	// Heartbeat is the threshold set on the watchdog: if it does not receive a heartbeat for this long, it runs its
+	// shutdown procedure, such as parking the mount and closing the dome. The driver counts whole minutes, so it is
+	// rounded up. Zero keeps the threshold the driver already has.
+	Heartbeat time.Duration
+	// Interval is how often a heartbeat is sent. Zero means a third of the threshold, so two can be missed before the
+	// watchdog fires.
+	Interval time.Duration
+	// Timeout is how long the watchdog has to acknowledge each heartbeat. Zero means DefaultWatchdogTimeout.
+	Timeout time.Duration
+}
+
+// WatchdogFailure describes a heartbeat that could not be delivered.
+type WatchdogFailure struct {
+	Err  error     `json:"error"`
+	Time time.Time `json:"time"`
+	// LastBeat is when the watchdog last acknowledged a heartbeat, or zero if it never has. The watchdog fires once
+	// its threshold has passed since then.
+	LastBeat time.Time `json:"lastBeat"`
+}
+
+// Watchdog sends heartbeats to the INDI WatchDog driver on a schedule, so the watchdog only shuts the observatory down
+// when the client has really stalled or lost its connection. Each heartbeat sets WATCHDOG_HEARTBEAT, which restarts
+// the watchdog's timer. When a heartbeat cannot be delivered, OnFailure handlers are called, giving the application a
+// chance to act before the watchdog does.
+type Watchdog struct {
+	c      *INDIClient
+	device string
+	opts   WatchdogOptions
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	mu       sync.Mutex
+	lastBeat time.Time
+	failing  bool
+	handlers map[string]func(WatchdogFailure)
+}
+
+// NewWatchdog starts sending heartbeats to the WatchDog device deviceName, the first straight away. The device does
+// not need to be defined yet, but heartbeats fail until it is. Remember to call Close when you are done with it, and
+// Disable first if the watchdog should not fire once heartbeats stop.
+func NewWatchdog(c *INDIClient, deviceName string, opts WatchdogOptions) *Watchdog {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultWatchdogTimeout
+	}
+
+	w := &Watchdog{
+		c:        c,
+		device:   c.resolveDevice(deviceName),
+		opts:     opts,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		handlers: map[string]func(WatchdogFailure){},
+	}
+
+	go w.run()
+
+	return w
+}
+
+// LastBeat returns when the watchdog last acknowledged a heartbeat, or zero if it never has.
+func (w *Watchdog) LastBeat() time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.lastBeat
+}
+
+// OnFailure registers fn to be called each time a heartbeat cannot be delivered. Handlers are called one at a time
+// on the watchdog's goroutine, so a slow handler delays the next heartbeat. Use RemoveHandler with the returned id to
+// unregister it.
+func (w *Watchdog) OnFailure(fn func(WatchdogFailure)) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := uuid.New().String()
+	w.handlers[id] = fn
+
+	return id
+}
+
+// RemoveHandler unregisters a handler added by OnFailure.
+func (w *Watchdog) RemoveHandler(id string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.handlers[id]; !ok {
+		return ErrSubscriptionNotFound
+	}
+
+	delete(w.handlers, id)
+
+	return nil
+}
+
+// Disable stops sending heartbeats and sets the watchdog's threshold to 0, which turns it off, so it does not fire.
+// Call it at the end of a session, before Close.
+func (w *Watchdog) Disable() error {
+	w.halt()
+
+	return w.send("0")
+}
+
+// Close stops sending heartbeats. The watchdog fires once its threshold passes, unless Disable was called. Handlers
+// are not called after Close returns.
+func (w *Watchdog) Close() error {
+	w.mu.Lock()
+	w.handlers = map[string]func(WatchdogFailure){}
+	w.mu.Unlock()
+
+	w.halt()
+
+	return nil
+}
+
+// halt stops the heartbeat loop, and waits for it to finish.
+func (w *Watchdog) halt() {
+	w.once.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+func (w *Watchdog) run() {
+	defer close(w.done)
+
+	for {
+		interval := w.beat()
+
+		select {
+		case <-w.stop:
+			return
+		case <-w.c.Clock().After(interval):
+		}
+	}
+}
+
+// beat sends a heartbeat, and returns how long to wait before the next one.
+func (w *Watchdog) beat() time.Duration {
+	threshold := w.opts.Heartbeat
+
+	value, err := w.value()
+	if err == nil {
+		if threshold == 0 {
+			minutes, _ := ParseNumber(value)
+			threshold = time.Duration(minutes * float64(time.Minute))
+		}
+
+		err = w.send(value)
+	}
+
+	now := w.c.now()
+
+	w.mu.Lock()
+	wasFailing := w.failing
+	w.failing = err != nil
+	if err == nil {
+		w.lastBeat = now
+	}
+	failure := WatchdogFailure{Err: err, Time: now, LastBeat: w.lastBeat}
+
+	handlers := []func(WatchdogFailure){}
+	if err != nil {
+		for _, fn := range w.handlers {
+			handlers = append(handlers, fn)
+		}
+	}
+	w.mu.Unlock()
+
+	log := w.c.log.WithField("device", w.device)
+
+	if err != nil {
+		log.WithError(err).Warn("could not deliver watchdog heartbeat")
+	} else if wasFailing {
+		log.Info("watchdog heartbeat delivered again")
+	}
+
+	for _, fn := range handlers {
+		fn(failure)
+	}
+
+	switch {
+	case w.opts.Interval > 0:
+		return w.opts.Interval
+	case threshold > 0:
+		return threshold / 3
+	default:
+		return DefaultWatchdogInterval
+	}
+}
+
+// value returns the threshold to send in a heartbeat, in minutes.
+func (w *Watchdog) value() (string, error) {
+	if w.opts.Heartbeat > 0 {
+		return strconv.Itoa(int(math.Ceil(w.opts.Heartbeat.Minutes()))), nil
+	}
+
+	v, err := w.c.GetNumber(w.device, WatchdogHeartbeatProperty, WatchdogHeartbeatElement)
+	if err != nil {
+		return "", err
+	}
+
+	return v.Value, nil
+}
+
+// send sets the threshold to value, and waits up to the timeout for the watchdog to acknowledge it.
+func (w *Watchdog) send(value string) error {
+	sent := make(chan error, 1)
+
+	go func() {
+		sent <- w.c.SetNumberValue(w.device, WatchdogHeartbeatProperty, []string{WatchdogHeartbeatElement}, []string{value})
+	}()
+
+	select {
+	case err := <-sent:
+		return err
+	case <-w.c.Clock().After(w.opts.Timeout):
+		return ErrWatchdogTimeout
+	}
+}
@@ -0,0 +1,126 @@
+package indiclient
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+func defineWatchdog(c *INDIClient, minutes string) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.defNumberVector(&DefNumberVector{
+		Device:  "WatchDog",
+		Name:    WatchdogHeartbeatProperty,
+		State:   PropertyStateIdle,
+		Perm:    PropertyPermissionReadWrite,
+		Numbers: []DefNumber{{Name: WatchdogHeartbeatElement, Value: minutes}},
+	})
+}
+
+// ackHeartbeat receives a heartbeat sent by the client and acknowledges it as the driver would.
+func ackHeartbeat(t *testing.T, c *INDIClient) string {
+	var cmd NewNumberVector
+
+	select {
+	case sent := <-c.write:
+		cmd = sent.(NewNumberVector)
+	case <-time.After(time.Second):
+		t.Fatal("no heartbeat sent")
+	}
+
+	require.Equal(t, WatchdogHeartbeatProperty, cmd.Name)
+
+	c.rwm.Lock()
+	c.setNumberVector(&SetNumberVector{Device: "WatchDog", Name: WatchdogHeartbeatProperty, State: PropertyStateOk, Numbers: cmd.Numbers})
+	c.rwm.Unlock()
+
+	return cmd.Numbers[0].Value
+}
+
+func Test_Watchdog(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+
+	defineWatchdog(c, "5")
+
+	w := NewWatchdog(c, "WatchDog", WatchdogOptions{Interval: 50 * time.Millisecond, Timeout: 100 * time.Millisecond})
+
+	mu := sync.Mutex{}
+	failures := []WatchdogFailure{}
+
+	w.OnFailure(func(f WatchdogFailure) {
+		mu.Lock()
+		failures = append(failures, f)
+		mu.Unlock()
+	})
+
+	// Without a threshold in the options, the driver's is sent back.
+	assert.Equal(t, "5", ackHeartbeat(t, c))
+	testutil.WaitFor(t, func() bool { return !w.LastBeat().IsZero() })
+
+	first := w.LastBeat()
+	assert.Equal(t, "5", ackHeartbeat(t, c))
+	testutil.WaitFor(t, func() bool { return w.LastBeat().After(first) })
+
+	lastBeat := w.LastBeat()
+
+	// The driver stops answering.
+	<-c.write
+
+	testutil.WaitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(failures) >= 2
+	})
+
+	mu.Lock()
+	assert.Equal(t, ErrWatchdogTimeout, failures[0].Err)
+	assert.True(t, errors.Is(failures[1].Err, ErrPropertyStateBusy), "the unanswered heartbeat is still outstanding")
+	assert.Equal(t, lastBeat, failures[0].LastBeat)
+	mu.Unlock()
+
+	// It recovers once the driver answers again.
+	c.rwm.Lock()
+	c.setNumberVector(&SetNumberVector{Device: "WatchDog", Name: WatchdogHeartbeatProperty, State: PropertyStateOk})
+	c.rwm.Unlock()
+
+	ackHeartbeat(t, c)
+	testutil.WaitFor(t, func() bool { return w.LastBeat().After(lastBeat) })
+
+	done := make(chan error)
+	go func() { done <- w.Disable() }()
+
+	// Any heartbeat sent before Disable stopped the loop is acknowledged first.
+	for {
+		value := ackHeartbeat(t, c)
+		if value == "0" {
+			break
+		}
+	}
+
+	require.NoError(t, <-done)
+	require.NoError(t, w.Close())
+	assert.Empty(t, c.write)
+}
+
+func Test_Watchdog_Heartbeat(t *testing.T) {
+	c := newTestClient()
+	c.write = make(chan interface{}, 10)
+
+	defineWatchdog(c, "0")
+
+	w := NewWatchdog(c, "WatchDog", WatchdogOptions{Heartbeat: 90 * time.Second})
+
+	// Rounded up to whole minutes.
+	assert.Equal(t, "2", ackHeartbeat(t, c))
+
+	require.NoError(t, w.Close())
+}
@@ -0,0 +1,214 @@
+package indiclient
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// SafetyStatusProperties are the light vectors a SafetyMonitor watches. Weather drivers report WEATHER_STATUS, and
+// safety monitor drivers (e.g. a rain sensor or an observatory controller) report SAFETY_STATUS.
+var SafetyStatusProperties = []string{"WEATHER_STATUS", "SAFETY_STATUS"}
+
+// SafetyStatus is the safety of the site as reported by a device.
+type SafetyStatus struct {
+	// Safe is true if none of the status lights are in the Alert state.
+	Safe bool `json:"safe"`
+	// Alerts are the names of the lights that are in the Alert state. If the device has no status lights at all, for
+	// example because it has disconnected, this is empty and Safe is false.
+	Alerts []string `json:"alerts"`
+}
+
+// SafetyMonitor watches the WEATHER_STATUS or SAFETY_STATUS lights of a weather or safety device, and calls handlers
+// when conditions become unsafe, so automation can park the mount and close the dome. Only the Alert state is unsafe;
+// Busy is a warning and Idle means the parameter is not being monitored. A device that has not defined any status
+// lights is unsafe.
+type SafetyMonitor struct {
+	c      *INDIClient
+	device string
+	id     string
+
+	mu       sync.Mutex
+	safe     bool
+	handlers map[string]func(SafetyStatus)
+}
+
+// NewSafetyMonitor creates a SafetyMonitor for deviceName. The device does not need to be defined yet. Remember to
+// call Close when you are done with it.
+func NewSafetyMonitor(c *INDIClient, deviceName string) (*SafetyMonitor, error) {
+	deviceName = c.resolveDevice(deviceName)
+
+	events, id, err := c.Subscribe(SubscribeOptions{Device: deviceName})
+	if err != nil {
+		return nil, err
+	}
+
+	m := &SafetyMonitor{
+		c:        c,
+		device:   deviceName,
+		id:       id,
+		handlers: map[string]func(SafetyStatus){},
+	}
+
+	m.safe = m.Status().Safe
+
+	go m.run(events)
+
+	return m, nil
+}
+
+// Status returns the current safety status of the device.
+func (m *SafetyMonitor) Status() SafetyStatus {
+	m.c.rwm.RLock()
+	defer m.c.rwm.RUnlock()
+
+	status := SafetyStatus{
+		Alerts: []string{},
+	}
+
+	device, err := m.c.findDevice(m.device)
+	if err != nil {
+		return status
+	}
+
+	found := false
+
+	for _, name := range SafetyStatusProperties {
+		prop, ok := device.LightProperties[name]
+		if !ok {
+			continue
+		}
+
+		found = true
+
+		for _, v := range prop.Values {
+			if v.Value == PropertyStateAlert {
+				status.Alerts = append(status.Alerts, v.Name)
+			}
+		}
+	}
+
+	sort.Strings(status.Alerts)
+
+	status.Safe = found && len(status.Alerts) == 0
+
+	return status
+}
+
+// IsSafe returns true if the device has status lights, and none of them are in the Alert state.
+func (m *SafetyMonitor) IsSafe() bool {
+	return m.Status().Safe
+}
+
+// Parameters returns the current values of WEATHER_PARAMETERS, keyed by element name.
+func (m *SafetyMonitor) Parameters() (map[string]float64, error) {
+	m.c.rwm.RLock()
+	defer m.c.rwm.RUnlock()
+
+	device, err := m.c.findDevice(m.device)
+	if err != nil {
+		return nil, err
+	}
+
+	prop, ok := device.NumberProperties["WEATHER_PARAMETERS"]
+	if !ok {
+		return nil, ErrPropertyNotFound
+	}
+
+	params := map[string]float64{}
+
+	for name, v := range prop.Values {
+		f, err := strconv.ParseFloat(v.Value, 64)
+		if err != nil {
+			m.c.log.WithField("device", m.device).WithField("parameter", name).WithError(err).Warn("could not parse weather parameter")
+			continue
+		}
+
+		params[name] = f
+	}
+
+	return params, nil
+}
+
+// OnUnsafe registers fn to be called each time the device goes from safe to unsafe. Handlers are called one at a time
+// on the monitor's goroutine, so a slow handler delays the ones after it. Use RemoveHandler with the returned id to
+// unregister it.
+func (m *SafetyMonitor) OnUnsafe(fn func(SafetyStatus)) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := uuid.New().String()
+	m.handlers[id] = fn
+
+	return id
+}
+
+// RemoveHandler unregisters a handler added by OnUnsafe.
+func (m *SafetyMonitor) RemoveHandler(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.handlers[id]; !ok {
+		return ErrSubscriptionNotFound
+	}
+
+	delete(m.handlers, id)
+
+	return nil
+}
+
+// Close stops the monitor. Handlers are not called after Close returns.
+func (m *SafetyMonitor) Close() error {
+	m.mu.Lock()
+	m.handlers = map[string]func(SafetyStatus){}
+	m.mu.Unlock()
+
+	return m.c.Unsubscribe(m.id)
+}
+
+func (m *SafetyMonitor) run(events <-chan Event) {
+	for e := range events {
+		if !m.relevant(e) {
+			continue
+		}
+
+		status := m.Status()
+
+		m.mu.Lock()
+		wasSafe := m.safe
+		m.safe = status.Safe
+
+		handlers := []func(SafetyStatus){}
+		if wasSafe && !status.Safe {
+			for _, fn := range m.handlers {
+				handlers = append(handlers, fn)
+			}
+		}
+		m.mu.Unlock()
+
+		for _, fn := range handlers {
+			fn(status)
+		}
+	}
+}
+
+func (m *SafetyMonitor) relevant(e Event) bool {
+	if e.Type == EventTypeMessage {
+		return false
+	}
+
+	// Deleting the whole device leaves Property empty.
+	if len(e.Property) == 0 {
+		return true
+	}
+
+	for _, name := range SafetyStatusProperties {
+		if e.Property == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+package indiclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/goastro/indiclient/internal/testutil"
+)
+
+func defineWeather(c *INDIClient) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.defLightVector(&DefLightVector{
+		Device: "Weather",
+		Name:   "WEATHER_STATUS",
+		State:  PropertyStateOk,
+		Lights: []DefLight{
+			{Name: "WEATHER_RAIN_HAZARD", Value: PropertyStateOk},
+			{Name: "WEATHER_WIND_SPEED", Value: PropertyStateOk},
+		},
+	})
+
+	c.defNumberVector(&DefNumberVector{
+		Device: "Weather",
+		Name:   "WEATHER_PARAMETERS",
+		State:  PropertyStateOk,
+		Perm:   PropertyPermissionReadOnly,
+		Numbers: []DefNumber{
+			{Name: "WEATHER_RAIN_HAZARD", Value: "0"},
+			{Name: "WEATHER_WIND_SPEED", Value: "12.5"},
+		},
+	})
+}
+
+func setWeather(c *INDIClient, rain PropertyState) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+
+	c.setLightVector(&SetLightVector{
+		Device: "Weather",
+		Name:   "WEATHER_STATUS",
+		State:  rain,
+		Lights: []OneLight{{Name: "WEATHER_RAIN_HAZARD", Value: rain}},
+	})
+}
+
+func Test_SafetyMonitor(t *testing.T) {
+	c := newTestClient()
+
+	m, err := NewSafetyMonitor(c, "Weather")
+	require.NoError(t, err)
+	defer m.Close()
+
+	assert.False(t, m.IsSafe())
+
+	unsafe := make(chan SafetyStatus, 10)
+	m.OnUnsafe(func(s SafetyStatus) { unsafe <- s })
+
+	defineWeather(c)
+
+	// Wait for the monitor to see the safe state, not just the client, or the transition to unsafe could be missed.
+	testutil.WaitFor(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.safe
+	})
+
+	params, err := m.Parameters()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"WEATHER_RAIN_HAZARD": 0, "WEATHER_WIND_SPEED": 12.5}, params)
+
+	setWeather(c, PropertyStateBusy)
+
+	setWeather(c, PropertyStateAlert)
+
+	select {
+	case s := <-unsafe:
+		assert.False(t, s.Safe)
+		assert.Equal(t, []string{"WEATHER_RAIN_HAZARD"}, s.Alerts)
+	case <-time.After(time.Second):
+		t.Fatal("handler not called")
+	}
+
+	// Still unsafe, so no new transition.
+	setWeather(c, PropertyStateAlert)
+
+	select {
+	case <-unsafe:
+		t.Fatal("handler called without a transition")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
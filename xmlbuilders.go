@@ -0,0 +1,459 @@
+package indiclient
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMissingAttribute is returned by Validate when a required attribute is empty.
+	ErrMissingAttribute = errors.New("missing required attribute")
+
+	// ErrInvalidAttribute is returned by Validate when an attribute or value is not one the protocol allows.
+	ErrInvalidAttribute = errors.New("invalid attribute value")
+
+	// ErrNoElements is returned by Validate when a vector has no elements.
+	ErrNoElements = errors.New("vector has no elements")
+
+	// ErrDuplicateElement is returned by Validate when a vector has two elements with the same name.
+	ErrDuplicateElement = errors.New("duplicate element name")
+)
+
+// ValidationError describes why a message would be malformed XML for the INDI protocol.
+type ValidationError struct {
+	// Element is the name of the XML element, e.g. defNumberVector or oneNumber.
+	Element string
+	// Field is the name of the attribute or value that is wrong.
+	Field string
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("indiclient: invalid %s: %s: %s", e.Element, e.Field, e.Err.Error())
+}
+
+// Unwrap returns the underlying error, one of ErrMissingAttribute, ErrInvalidAttribute, ErrNoElements or
+// ErrDuplicateElement.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Valid returns true if s is one of the PropertyState constants.
+func (s PropertyState) Valid() bool {
+	switch s {
+	case PropertyStateIdle, PropertyStateOk, PropertyStateBusy, PropertyStateAlert:
+		return true
+	}
+	return false
+}
+
+// Valid returns true if s is one of the SwitchState constants.
+func (s SwitchState) Valid() bool {
+	return s == SwitchStateOn || s == SwitchStateOff
+}
+
+// Valid returns true if r is one of the SwitchRule constants.
+func (r SwitchRule) Valid() bool {
+	switch r {
+	case SwitchRuleOneOfMany, SwitchRuleAtMostOne, SwitchRuleAnyOfMany:
+		return true
+	}
+	return false
+}
+
+// Valid returns true if p is one of the PropertyPermission constants.
+func (p PropertyPermission) Valid() bool {
+	switch p {
+	case PropertyPermissionReadOnly, PropertyPermissionWriteOnly, PropertyPermissionReadWrite:
+		return true
+	}
+	return false
+}
+
+// normalize returns p as one of the PropertyPermission constants, ignoring case and surrounding spaces. A permission
+// that is missing or not understood is taken as PropertyPermissionReadWrite, so it does not stop commands the driver
+// may accept.
+func (p PropertyPermission) normalize() PropertyPermission {
+	n := PropertyPermission(strings.ToLower(strings.TrimSpace(string(p))))
+	if !n.Valid() {
+		return PropertyPermissionReadWrite
+	}
+	return n
+}
+
+// Valid returns true if b is one of the BlobEnable constants.
+func (b BlobEnable) Valid() bool {
+	switch b {
+	case BlobEnableNever, BlobEnableAlso, BlobEnableOnly, BlobEnableURL:
+		return true
+	}
+	return false
+}
+
+// validator collects the first problem found while validating an element.
+type validator struct {
+	element string
+	err     *ValidationError
+}
+
+func (v *validator) fail(field string, err error) {
+	if v.err == nil {
+		v.err = &ValidationError{Element: v.element, Field: field, Err: err}
+	}
+}
+
+func (v *validator) required(field, value string) {
+	if len(value) == 0 {
+		v.fail(field, ErrMissingAttribute)
+	}
+}
+
+func (v *validator) check(field string, ok bool) {
+	if !ok {
+		v.fail(field, ErrInvalidAttribute)
+	}
+}
+
+func (v *validator) number(field, value string) {
+	if _, err := ParseNumber(value); err != nil {
+		v.fail(field, ErrInvalidAttribute)
+	}
+}
+
+// vector checks the attributes shared by all vectors, and that names holds at least one unique, non-empty name.
+func (v *validator) vector(device, name string, names []string) {
+	v.required("device", device)
+	v.required("name", name)
+
+	if len(names) == 0 {
+		v.fail("elements", ErrNoElements)
+	}
+
+	seen := map[string]bool{}
+	for _, n := range names {
+		v.required("element name", n)
+
+		if seen[n] {
+			v.fail(n, ErrDuplicateElement)
+		}
+		seen[n] = true
+	}
+}
+
+func (v *validator) result() error {
+	if v.err == nil {
+		return nil
+	}
+	return v.err
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI.
+func (m GetProperties) Validate() error {
+	v := validator{element: "getProperties"}
+	v.required("version", m.Version)
+	if len(m.Name) > 0 && len(m.Device) == 0 {
+		v.fail("device", ErrMissingAttribute)
+	}
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI.
+func (m EnableBlob) Validate() error {
+	v := validator{element: "enableBLOB"}
+	v.required("device", m.Device)
+	v.check("value", m.Value.Valid())
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI.
+func (m DefTextVector) Validate() error {
+	v := validator{element: "defTextVector"}
+	names := make([]string, len(m.Texts))
+	for i, e := range m.Texts {
+		names[i] = e.Name
+	}
+	v.vector(m.Device, m.Name, names)
+	v.check("state", m.State.Valid())
+	v.check("perm", m.Perm.Valid())
+	v.check("timeout", m.Timeout >= 0)
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI.
+func (m DefNumberVector) Validate() error {
+	v := validator{element: "defNumberVector"}
+	names := make([]string, len(m.Numbers))
+	for i, e := range m.Numbers {
+		names[i] = e.Name
+		v.required(e.Name+" format", e.Format)
+		v.number(e.Name+" min", e.Min)
+		v.number(e.Name+" max", e.Max)
+		v.number(e.Name+" step", e.Step)
+		v.number(e.Name, e.Value)
+	}
+	v.vector(m.Device, m.Name, names)
+	v.check("state", m.State.Valid())
+	v.check("perm", m.Perm.Valid())
+	v.check("timeout", m.Timeout >= 0)
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI.
+func (m DefSwitchVector) Validate() error {
+	v := validator{element: "defSwitchVector"}
+	names := make([]string, len(m.Switches))
+	for i, e := range m.Switches {
+		names[i] = e.Name
+		v.check(e.Name, e.Value.Valid())
+	}
+	v.vector(m.Device, m.Name, names)
+	v.check("state", m.State.Valid())
+	v.check("perm", m.Perm.Valid())
+	v.check("rule", m.Rule.Valid())
+	v.check("timeout", m.Timeout >= 0)
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI.
+func (m DefLightVector) Validate() error {
+	v := validator{element: "defLightVector"}
+	names := make([]string, len(m.Lights))
+	for i, e := range m.Lights {
+		names[i] = e.Name
+		v.check(e.Name, e.Value.Valid())
+	}
+	v.vector(m.Device, m.Name, names)
+	v.check("state", m.State.Valid())
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI.
+func (m DefBlobVector) Validate() error {
+	v := validator{element: "defBLOBVector"}
+	names := make([]string, len(m.Blobs))
+	for i, e := range m.Blobs {
+		names[i] = e.Name
+	}
+	v.vector(m.Device, m.Name, names)
+	v.check("state", m.State.Valid())
+	v.check("perm", m.Perm.Valid())
+	v.check("timeout", m.Timeout >= 0)
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI.
+func (m NewTextVector) Validate() error {
+	v := validator{element: "newTextVector"}
+	names := make([]string, len(m.Texts))
+	for i, e := range m.Texts {
+		names[i] = e.Name
+	}
+	v.vector(m.Device, m.Name, names)
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI.
+func (m NewNumberVector) Validate() error {
+	v := validator{element: "newNumberVector"}
+	names := make([]string, len(m.Numbers))
+	for i, e := range m.Numbers {
+		names[i] = e.Name
+		v.number(e.Name, e.Value)
+	}
+	v.vector(m.Device, m.Name, names)
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI.
+func (m NewSwitchVector) Validate() error {
+	v := validator{element: "newSwitchVector"}
+	names := make([]string, len(m.Switches))
+	for i, e := range m.Switches {
+		names[i] = e.Name
+		v.check(e.Name, e.Value.Valid())
+	}
+	v.vector(m.Device, m.Name, names)
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI.
+func (m NewBlobVector) Validate() error {
+	v := validator{element: "newBLOBVector"}
+	names := make([]string, len(m.Blobs))
+	for i, e := range m.Blobs {
+		names[i] = e.Name
+		v.required(e.Name+" format", e.Format)
+		v.check(e.Name+" size", e.Size >= 0)
+	}
+	v.vector(m.Device, m.Name, names)
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI. State may be empty, in which case the
+// property keeps its state.
+func (m SetTextVector) Validate() error {
+	v := validator{element: "setTextVector"}
+	names := make([]string, len(m.Texts))
+	for i, e := range m.Texts {
+		names[i] = e.Name
+	}
+	v.vector(m.Device, m.Name, names)
+	v.check("state", len(m.State) == 0 || m.State.Valid())
+	v.check("timeout", m.Timeout >= 0)
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI. State may be empty, in which case the
+// property keeps its state.
+func (m SetNumberVector) Validate() error {
+	v := validator{element: "setNumberVector"}
+	names := make([]string, len(m.Numbers))
+	for i, e := range m.Numbers {
+		names[i] = e.Name
+		v.number(e.Name, e.Value)
+	}
+	v.vector(m.Device, m.Name, names)
+	v.check("state", len(m.State) == 0 || m.State.Valid())
+	v.check("timeout", m.Timeout >= 0)
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI. State may be empty, in which case the
+// property keeps its state.
+func (m SetSwitchVector) Validate() error {
+	v := validator{element: "setSwitchVector"}
+	names := make([]string, len(m.Switches))
+	for i, e := range m.Switches {
+		names[i] = e.Name
+		v.check(e.Name, e.Value.Valid())
+	}
+	v.vector(m.Device, m.Name, names)
+	v.check("state", len(m.State) == 0 || m.State.Valid())
+	v.check("timeout", m.Timeout >= 0)
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI. State may be empty, in which case the
+// property keeps its state.
+func (m SetLightVector) Validate() error {
+	v := validator{element: "setLightVector"}
+	names := make([]string, len(m.Lights))
+	for i, e := range m.Lights {
+		names[i] = e.Name
+		v.check(e.Name, e.Value.Valid())
+	}
+	v.vector(m.Device, m.Name, names)
+	v.check("state", len(m.State) == 0 || m.State.Valid())
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI. State may be empty, in which case the
+// property keeps its state.
+func (m SetBlobVector) Validate() error {
+	v := validator{element: "setBLOBVector"}
+	names := make([]string, len(m.Blobs))
+	for i, e := range m.Blobs {
+		names[i] = e.Name
+		v.required(e.Name+" format", e.Format)
+		v.check(e.Name+" size", e.Size >= 0)
+	}
+	v.vector(m.Device, m.Name, names)
+	v.check("state", len(m.State) == 0 || m.State.Valid())
+	v.check("timeout", m.Timeout >= 0)
+	return v.result()
+}
+
+// Validate returns a *ValidationError if the message is not valid INDI.
+func (m DelProperty) Validate() error {
+	v := validator{element: "delProperty"}
+	if len(m.Name) > 0 && len(m.Device) == 0 {
+		v.fail("device", ErrMissingAttribute)
+	}
+	return v.result()
+}
+
+// DefineText builds a defTextVector in the Idle state, timestamped now.
+func DefineText(device, name, label, group string, perm PropertyPermission, texts ...DefText) (DefTextVector, error) {
+	m := DefTextVector{Device: device, Name: name, Label: label, Group: group, State: PropertyStateIdle, Perm: perm, Timestamp: formatTimestamp(time.Now()), Texts: texts}
+	return m, m.Validate()
+}
+
+// DefineNumber builds a defNumberVector in the Idle state, timestamped now.
+func DefineNumber(device, name, label, group string, perm PropertyPermission, numbers ...DefNumber) (DefNumberVector, error) {
+	m := DefNumberVector{Device: device, Name: name, Label: label, Group: group, State: PropertyStateIdle, Perm: perm, Timestamp: formatTimestamp(time.Now()), Numbers: numbers}
+	return m, m.Validate()
+}
+
+// DefineSwitch builds a defSwitchVector in the Idle state, timestamped now.
+func DefineSwitch(device, name, label, group string, perm PropertyPermission, rule SwitchRule, switches ...DefSwitch) (DefSwitchVector, error) {
+	m := DefSwitchVector{Device: device, Name: name, Label: label, Group: group, State: PropertyStateIdle, Perm: perm, Rule: rule, Timestamp: formatTimestamp(time.Now()), Switches: switches}
+	return m, m.Validate()
+}
+
+// DefineLight builds a defLightVector in the Idle state, timestamped now.
+func DefineLight(device, name, label, group string, lights ...DefLight) (DefLightVector, error) {
+	m := DefLightVector{Device: device, Name: name, Label: label, Group: group, State: PropertyStateIdle, Timestamp: formatTimestamp(time.Now()), Lights: lights}
+	return m, m.Validate()
+}
+
+// DefineBlob builds a defBLOBVector in the Idle state, timestamped now.
+func DefineBlob(device, name, label, group string, perm PropertyPermission, blobs ...DefBlob) (DefBlobVector, error) {
+	m := DefBlobVector{Device: device, Name: name, Label: label, Group: group, State: PropertyStateIdle, Perm: perm, Timestamp: formatTimestamp(time.Now()), Blobs: blobs}
+	return m, m.Validate()
+}
+
+// CommandText builds a newTextVector.
+func CommandText(device, name string, texts ...OneText) (NewTextVector, error) {
+	m := NewTextVector{Device: device, Name: name, Texts: texts}
+	return m, m.Validate()
+}
+
+// CommandNumber builds a newNumberVector.
+func CommandNumber(device, name string, numbers ...OneNumber) (NewNumberVector, error) {
+	m := NewNumberVector{Device: device, Name: name, Numbers: numbers}
+	return m, m.Validate()
+}
+
+// CommandSwitch builds a newSwitchVector.
+func CommandSwitch(device, name string, switches ...OneSwitch) (NewSwitchVector, error) {
+	m := NewSwitchVector{Device: device, Name: name, Switches: switches}
+	return m, m.Validate()
+}
+
+// CommandBlob builds a newBLOBVector.
+func CommandBlob(device, name string, blobs ...OneBlob) (NewBlobVector, error) {
+	m := NewBlobVector{Device: device, Name: name, Blobs: blobs}
+	return m, m.Validate()
+}
+
+// UpdateText builds a setTextVector, timestamped now.
+func UpdateText(device, name string, state PropertyState, texts ...OneText) (SetTextVector, error) {
+	m := SetTextVector{Device: device, Name: name, State: state, Timestamp: formatTimestamp(time.Now()), Texts: texts}
+	return m, m.Validate()
+}
+
+// UpdateNumber builds a setNumberVector, timestamped now.
+func UpdateNumber(device, name string, state PropertyState, numbers ...OneNumber) (SetNumberVector, error) {
+	m := SetNumberVector{Device: device, Name: name, State: state, Timestamp: formatTimestamp(time.Now()), Numbers: numbers}
+	return m, m.Validate()
+}
+
+// UpdateSwitch builds a setSwitchVector, timestamped now.
+func UpdateSwitch(device, name string, state PropertyState, switches ...OneSwitch) (SetSwitchVector, error) {
+	m := SetSwitchVector{Device: device, Name: name, State: state, Timestamp: formatTimestamp(time.Now()), Switches: switches}
+	return m, m.Validate()
+}
+
+// UpdateLight builds a setLightVector, timestamped now.
+func UpdateLight(device, name string, state PropertyState, lights ...OneLight) (SetLightVector, error) {
+	m := SetLightVector{Device: device, Name: name, State: state, Timestamp: formatTimestamp(time.Now()), Lights: lights}
+	return m, m.Validate()
+}
+
+// UpdateBlob builds a setBLOBVector, timestamped now.
+func UpdateBlob(device, name string, state PropertyState, blobs ...OneBlob) (SetBlobVector, error) {
+	m := SetBlobVector{Device: device, Name: name, State: state, Timestamp: formatTimestamp(time.Now()), Blobs: blobs}
+	return m, m.Validate()
+}
@@ -0,0 +1,96 @@
+package indiclient
+
+import (
+	"encoding/xml"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Builders(t *testing.T) {
+	def, err := DefineNumber("Focuser", "ABS_FOCUS_POSITION", "Position", "Main", PropertyPermissionReadWrite,
+		DefNumber{Name: "FOCUS_ABSOLUTE_POSITION", Label: "Steps", Format: "%.f", Min: "0", Max: "100000", Step: "1", Value: "500"})
+	require.NoError(t, err)
+	assert.Equal(t, PropertyStateIdle, def.State)
+	assert.NotEmpty(t, def.Timestamp)
+
+	cmd, err := CommandSwitch("Focuser", "FOCUS_MOTION", OneSwitch{Name: "FOCUS_INWARD", Value: SwitchStateOn})
+	require.NoError(t, err)
+	assert.Equal(t, "Focuser", cmd.Device)
+
+	_, err = UpdateLight("Weather", "WEATHER_STATUS", PropertyStateAlert, OneLight{Name: "RAIN", Value: PropertyStateAlert})
+	require.NoError(t, err)
+}
+
+func Test_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     interface{ Validate() error }
+		element string
+		field   string
+		err     error
+	}{
+		{"missing device", NewTextVector{Name: "X", Texts: []OneText{{Name: "A"}}}, "newTextVector", "device", ErrMissingAttribute},
+		{"no elements", NewTextVector{Device: "D", Name: "X"}, "newTextVector", "elements", ErrNoElements},
+		{"duplicate", NewSwitchVector{Device: "D", Name: "X", Switches: []OneSwitch{{Name: "A", Value: SwitchStateOn}, {Name: "A", Value: SwitchStateOff}}}, "newSwitchVector", "A", ErrDuplicateElement},
+		{"bad switch", NewSwitchVector{Device: "D", Name: "X", Switches: []OneSwitch{{Name: "A", Value: "on"}}}, "newSwitchVector", "A", ErrInvalidAttribute},
+		{"bad number", NewNumberVector{Device: "D", Name: "X", Numbers: []OneNumber{{Name: "A", Value: "abc"}}}, "newNumberVector", "A", ErrInvalidAttribute},
+		{"bad rule", DefSwitchVector{Device: "D", Name: "X", State: PropertyStateOk, Perm: PropertyPermissionReadWrite, Rule: "OneOf", Switches: []DefSwitch{{Name: "A", Value: SwitchStateOn}}}, "defSwitchVector", "rule", ErrInvalidAttribute},
+		{"bad perm", DefTextVector{Device: "D", Name: "X", State: PropertyStateOk, Perm: "rx", Texts: []DefText{{Name: "A"}}}, "defTextVector", "perm", ErrInvalidAttribute},
+		{"bad state", SetTextVector{Device: "D", Name: "X", State: "Fine", Texts: []OneText{{Name: "A"}}}, "setTextVector", "state", ErrInvalidAttribute},
+		{"missing format", DefNumberVector{Device: "D", Name: "X", State: PropertyStateOk, Perm: PropertyPermissionReadOnly, Numbers: []DefNumber{{Name: "A", Min: "0", Max: "1", Step: "0", Value: "0"}}}, "defNumberVector", "A format", ErrMissingAttribute},
+		{"bad blob enable", EnableBlob{Device: "D", Value: "Sometimes"}, "enableBLOB", "value", ErrInvalidAttribute},
+		{"property without device", GetProperties{Version: "1.7", Name: "X"}, "getProperties", "device", ErrMissingAttribute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.msg.Validate()
+			require.Error(t, err)
+
+			var verr *ValidationError
+			require.True(t, errors.As(err, &verr))
+			assert.Equal(t, tt.element, verr.Element)
+			assert.Equal(t, tt.field, verr.Field)
+			assert.True(t, errors.Is(err, tt.err))
+		})
+	}
+
+	assert.NoError(t, SetTextVector{Device: "D", Name: "X", Texts: []OneText{{Name: "A"}}}.Validate())
+	assert.NoError(t, DelProperty{Device: "D"}.Validate())
+}
+
+func Test_Message_WireFormat(t *testing.T) {
+	// INDI sends a vector's message as an attribute, not a child element.
+	vectors := []interface{}{
+		&DefTextVector{Device: "D", Name: "X", Message: "Slew failed"},
+		&DefNumberVector{Device: "D", Name: "X", Message: "Slew failed"},
+		&DefSwitchVector{Device: "D", Name: "X", Message: "Slew failed"},
+		&DefLightVector{Device: "D", Name: "X", Message: "Slew failed"},
+		&DefBlobVector{Device: "D", Name: "X", Message: "Slew failed"},
+		&SetTextVector{Device: "D", Name: "X", Message: "Slew failed"},
+		&SetNumberVector{Device: "D", Name: "X", Message: "Slew failed"},
+		&SetSwitchVector{Device: "D", Name: "X", Message: "Slew failed"},
+		&SetLightVector{Device: "D", Name: "X", Message: "Slew failed"},
+		&SetBlobVector{Device: "D", Name: "X", Message: "Slew failed"},
+	}
+
+	for _, v := range vectors {
+		b, err := xml.Marshal(v)
+		require.NoError(t, err)
+		assert.Contains(t, string(b), ` message="Slew failed"`)
+		assert.NotContains(t, string(b), "<message>")
+
+		decoded := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+		require.NoError(t, xml.Unmarshal(b, decoded))
+		assert.Equal(t, "Slew failed", reflect.ValueOf(decoded).Elem().FieldByName("Message").String(), string(b))
+	}
+
+	item, err := ParseMessage([]byte(`<setTextVector device="D" name="X" state="Ok" message="text msg"><oneText name="A">a</oneText></setTextVector>`))
+	require.NoError(t, err)
+	require.IsType(t, &SetTextVector{}, item)
+	assert.Equal(t, "text msg", item.(*SetTextVector).Message)
+}